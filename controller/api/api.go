@@ -0,0 +1,227 @@
+// Package api is a client for the TorVM controller's control API, for
+// tools that show or drive TorVM (status bar widgets, browser extension
+// native hosts, scripts) without speaking the protocol by hand.
+//
+// The controller serves the API over HTTP on a Unix socket (api_socket
+// in the config); access is governed by the socket's file permissions.
+// Endpoints:
+//
+//	GET  /v1/status  Status as JSON
+//	POST /v1/start   start the VM
+//	POST /v1/stop    stop the VM, replying once it has shut down
+//	GET  /v1/events  stream of Event, one JSON object per line
+//	POST /v1/newnym  ask Tor for new circuits (a new identity)
+//	GET  /v1/config  the configuration, secrets redacted
+//	GET  /v1/logs    recent log lines as Logs; ?lines=N (default 100, max 1000)
+//
+// Errors are returned with a non-2xx status and a JSON body
+// {"error": "..."}.
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// Event kinds.
+const (
+	EventState     = "state"     // the lifecycle state changed; State is the new one, and Message why when it is "Shutdown"
+	EventBootstrap = "bootstrap" // Tor bootstrap progress; Progress and Message
+	EventFailsafe  = "failsafe"  // Message is "engaged" (traffic blocked) or "released"
+	EventVMExit    = "vm_exit"   // the VM exited unexpectedly; Message is the error
+)
+
+// Status is the controller's current state.
+type Status struct {
+	State     string `json:"state"`   // lifecycle state, e.g. "Running", "WaitBootstrap"
+	Running   bool   `json:"running"` // traffic is routed through Tor
+	Failsafe  bool   `json:"failsafe"`
+	Bootstrap int    `json:"bootstrap"` // Tor bootstrap percentage
+	Summary   string `json:"summary,omitempty"`
+	SOCKS     string `json:"socks"` // host:port of the VM's Tor SOCKS proxy
+	Version   string `json:"version"`
+
+	// ShutdownReason is why the last session shut down, e.g. "user",
+	// "signal", "vm_crash", "bootstrap_timeout" or "failsafe"; empty
+	// before one has.
+	ShutdownReason string `json:"shutdown_reason,omitempty"`
+}
+
+// Event is one entry of the /v1/events stream.
+type Event struct {
+	Time     string `json:"time"` // RFC 3339
+	Kind     string `json:"kind"`
+	State    string `json:"state,omitempty"`
+	Progress int    `json:"progress,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Logs is the reply to GET /v1/logs.
+type Logs struct {
+	Lines []string `json:"lines"` // oldest first
+}
+
+// Error is a non-2xx API response.
+type Error struct {
+	Code    int    `json:"-"` // HTTP status, e.g. 409 when the VM cannot be started
+	Message string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("torvm api: %s (HTTP %d)", e.Message, e.Code)
+}
+
+// DefaultSocketPath is the socket the controller listens on by default.
+func DefaultSocketPath() string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "TorVM", "api.sock")
+	}
+	return "/run/torvm/api.sock"
+}
+
+// Client talks to the API on one socket. It is safe for concurrent use.
+type Client struct {
+	hc *http.Client
+}
+
+// NewClient returns a client for the API at socketPath. No connection is
+// made until the first call.
+func NewClient(socketPath string) *Client {
+	return &Client{hc: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}}
+}
+
+// Status returns the controller's current state.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var st Status
+	resp, err := c.do(ctx, http.MethodGet, "/v1/status")
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return st, fmt.Errorf("torvm api: decode status: %w", err)
+	}
+	return st, nil
+}
+
+// Start starts the VM. It returns once the controller has begun starting
+// it; watch Events or poll Status for progress.
+func (c *Client) Start(ctx context.Context) error {
+	return c.post(ctx, "/v1/start")
+}
+
+// Stop stops the VM and restores the host network, returning once that
+// is done. Open Tor connections are cut off without confirmation. An
+// *Error with Code 409 means the VM was not running; 500 means the
+// session had failed or the host network could not be restored.
+func (c *Client) Stop(ctx context.Context) error {
+	return c.post(ctx, "/v1/stop")
+}
+
+// NewIdentity asks Tor for new circuits, so new connections look like
+// they come from someone else. An *Error with Code 409 means the VM is
+// not running.
+func (c *Client) NewIdentity(ctx context.Context) error {
+	return c.post(ctx, "/v1/newnym")
+}
+
+// Config returns the controller's configuration as JSON, with secrets
+// such as proxy passwords redacted. It is returned raw so that clients
+// need not track the configuration's format.
+func (c *Client) Config(ctx context.Context) (json.RawMessage, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/config")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("torvm api: decode config: %w", err)
+	}
+	return raw, nil
+}
+
+// Logs returns the last n log lines, oldest first.
+func (c *Client) Logs(ctx context.Context, n int) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/logs?lines="+strconv.Itoa(n))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var logs Logs
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		return nil, fmt.Errorf("torvm api: decode logs: %w", err)
+	}
+	return logs.Lines, nil
+}
+
+// Events streams controller events until ctx is cancelled or the
+// controller exits, then closes the channel.
+func (c *Client) Events(ctx context.Context) (<-chan Event, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/events")
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan Event)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			var ev Event
+			if json.Unmarshal(sc.Bytes(), &ev) != nil {
+				continue
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (c *Client) post(ctx context.Context, path string) error {
+	resp, err := c.do(ctx, http.MethodPost, path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a request and turns a non-2xx response into an *Error.
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+	// The host is ignored; DialContext always uses the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://torvm"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("torvm api: %w", err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	apiErr := &Error{Code: resp.StatusCode}
+	if json.NewDecoder(resp.Body).Decode(apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return nil, apiErr
+}
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/user/extorvm/controller/api"
+)
+
+// A status bar widget polls Status.
+func ExampleClient_Status() {
+	c := api.NewClient(api.DefaultSocketPath())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	st, err := c.Status(ctx)
+	if err != nil {
+		fmt.Println("TorVM: unavailable")
+		return
+	}
+	switch {
+	case st.Running:
+		fmt.Println("TorVM: on")
+	case st.Failsafe:
+		fmt.Println("TorVM: blocked (failsafe)")
+	default:
+		fmt.Printf("TorVM: %s %d%%\n", st.State, st.Bootstrap)
+	}
+}
+
+// Start the VM and wait until Tor is connected.
+func ExampleClient_Events() {
+	c := api.NewClient(api.DefaultSocketPath())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// Subscribe before starting so no event is missed.
+	events, err := c.Events(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	for ev := range events {
+		switch ev.Kind {
+		case api.EventBootstrap:
+			fmt.Printf("bootstrap %d%%: %s\n", ev.Progress, ev.Message)
+		case api.EventState:
+			if ev.State == "Running" {
+				fmt.Println("connected")
+				return
+			}
+		case api.EventVMExit:
+			log.Fatalf("VM exited: %s", ev.Message)
+		}
+	}
+	log.Fatal("controller went away")
+}
+
+// Stopping a VM that is not running fails with a 409 Error.
+func ExampleClient_Stop() {
+	c := api.NewClient(api.DefaultSocketPath())
+	err := c.Stop(context.Background())
+	if apiErr, ok := err.(*api.Error); ok {
+		fmt.Println("not stopped:", apiErr.Message)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+}
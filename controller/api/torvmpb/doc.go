@@ -0,0 +1,11 @@
+// Package torvmpb holds the gRPC control API's protocol buffer
+// definitions (torvm.proto) and the Go code generated from them. The
+// controller serves the API on grpc_socket when that is set; clients dial
+// it with a "unix://" target:
+//
+//	conn, err := grpc.NewClient("unix:///run/torvm/grpc.sock",
+//		grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	c := torvmpb.NewControlClient(conn)
+package torvmpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative torvm.proto
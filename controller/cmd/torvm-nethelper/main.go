@@ -0,0 +1,14 @@
+// Command torvm-nethelper is the Linux network helper. It is installed
+// setuid root or with cap_net_admin and run by the controller, never by
+// hand; see package nethelper.
+package main
+
+import (
+	"os"
+
+	"github.com/user/extorvm/controller/internal/nethelper"
+)
+
+func main() {
+	os.Exit(nethelper.Main())
+}
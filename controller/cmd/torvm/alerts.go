@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/alert"
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/journal"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// startAlerts wires alert delivery to failsafe activation and VM crash
+// loops. Crash-loop detection is seeded from the event journal (if any) so
+// that restarts by a service manager across processes are counted.
+func startAlerts(cfg *config.Config, engine *lifecycle.Engine, logger *logging.Logger, events *journal.Journal) {
+	if !cfg.Alerts.Enabled() {
+		return
+	}
+
+	var senders []alert.Sender
+	if cfg.Alerts.SMTP.Host != "" {
+		senders = append(senders, &alert.SMTPSender{
+			Host:     cfg.Alerts.SMTP.Host,
+			Port:     cfg.Alerts.SMTP.Port,
+			Username: cfg.Alerts.SMTP.Username,
+			Password: cfg.Alerts.SMTP.Password,
+			From:     cfg.Alerts.SMTP.From,
+			To:       cfg.Alerts.SMTP.To,
+		})
+	}
+	if cfg.Alerts.Push.URL != "" {
+		senders = append(senders, &alert.PushSender{
+			URL:    cfg.Alerts.Push.URL,
+			Format: cfg.Alerts.Push.Format,
+			Token:  cfg.Alerts.Push.Token,
+		})
+	}
+
+	hostname, _ := os.Hostname()
+	notifier := alert.NewNotifier(senders,
+		time.Duration(cfg.Alerts.MinIntervalSec)*time.Second, hostname, logger)
+
+	window := time.Duration(cfg.Alerts.CrashLoopWindowSec) * time.Second
+	crashLoop := alert.NewCrashLoopDetector(cfg.Alerts.CrashLoopThreshold, window)
+	if events != nil {
+		past, err := events.Query(time.Now().Add(-window), time.Time{})
+		if err == nil {
+			for _, ev := range past {
+				if ev.Kind == journal.KindState && strings.HasSuffix(ev.Message, "-> "+lifecycle.StateLaunchVM.String()) {
+					crashLoop.RecordLaunch(ev.Time)
+				}
+			}
+		}
+	}
+
+	engine.FailSafe.OnActivate(func() {
+		notifier.Notify("Failsafe activated",
+			"The TorVM failsafe engaged at %s and is blocking all host network traffic.\n"+
+				"Last lifecycle state: %s.", time.Now().Format(time.RFC1123), engine.State())
+	})
+	engine.OnStateChange(func(_, to lifecycle.State) {
+		if to != lifecycle.StateLaunchVM {
+			return
+		}
+		if crashLoop.RecordLaunch(time.Now()) {
+			notifier.Notify("VM crash loop",
+				"The Tor VM has been launched %d times in the last %v. It is probably crashing on start; check the logs.",
+				crashLoop.Count(), window)
+		}
+	})
+	logger.Info("alerts enabled (%d destination(s))", len(senders))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/grpcapi"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// startAPI serves the control API on cfg.APISocket, if set, with the log
+// lines of ring. The returned server (nil when disabled or on error) must
+// be closed by the caller.
+func startAPI(cfg *config.Config, engine *lifecycle.Engine, ctrl controlapi.Controller, ring *logging.RingWriter, logger *logging.Logger) *controlapi.Server {
+	if cfg.APISocket == "" {
+		return nil
+	}
+	srv, err := controlapi.NewServer(cfg.APISocket, engine, ctrl, controllerVersion)
+	if err != nil {
+		logger.Error("%v", err)
+		return nil
+	}
+	srv.SetLogs(ring)
+	srv.Start()
+	logger.Info("control API listening on %s", cfg.APISocket)
+	return srv
+}
+
+// startGRPC serves the gRPC control API on cfg.GRPCSocket, if set, and
+// streams logger's lines to its watchers. The returned server (nil when
+// disabled or on error) must be closed by the caller.
+func startGRPC(cfg *config.Config, engine *lifecycle.Engine, ctrl controlapi.Controller, logger *logging.Logger) *grpcapi.Server {
+	if cfg.GRPCSocket == "" {
+		return nil
+	}
+	srv, err := grpcapi.NewServer(cfg.GRPCSocket, engine, ctrl, controllerVersion)
+	if err != nil {
+		logger.Error("%v", err)
+		return nil
+	}
+	logger.AddWriter(srv)
+	srv.Start()
+	logger.Info("gRPC control API listening on %s", cfg.GRPCSocket)
+	return srv
+}
+
+// headlessControl is the API's Controller in headless mode, where the VM
+// runs for the life of the process: it can be stopped (ending the
+// process) but not started again.
+type headlessControl struct {
+	engine *lifecycle.Engine
+}
+
+func (h headlessControl) StartVM() error { return controlapi.ErrRunning }
+
+func (h headlessControl) StopVM(ctx context.Context) error {
+	return <-h.engine.Stop(ctx)
+}
+
+// backendControl is the API's Controller with --backend, where the
+// process outlives the VM: a GUI run by a user, or "torvm start" and
+// "torvm stop", start and stop sessions through the API.
+type backendControl struct {
+	engine *lifecycle.Engine
+	ctx    context.Context // the process's; a session ends with it
+	logger *logging.Logger
+
+	mu   sync.Mutex
+	done chan struct{} // closed when the current session ends; nil between sessions
+}
+
+func (b *backendControl) StartVM() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.done != nil {
+		return controlapi.ErrRunning
+	}
+	done := make(chan struct{})
+	b.done = done
+	result := b.engine.Start(b.ctx)
+	go func() {
+		if err := <-result; err != nil {
+			b.logger.Error("lifecycle error: %v", err)
+		}
+		b.mu.Lock()
+		b.done = nil
+		b.mu.Unlock()
+		close(done)
+	}()
+	return nil
+}
+
+func (b *backendControl) StopVM(ctx context.Context) error {
+	return <-b.engine.Stop(ctx)
+}
+
+// wait blocks until the process's context ends and then until the
+// session it stops, if one is running, has shut down.
+func (b *backendControl) wait() {
+	<-b.ctx.Done()
+	b.mu.Lock()
+	done := b.done
+	b.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// findBackend returns a client for the controller answering on
+// cfg.APISocket, normally a back end (torvm --backend), for a GUI run by
+// a user to drive. It returns nil if none answers, and the GUI runs the
+// VM itself.
+func findBackend(cfg *config.Config) *api.Client {
+	if cfg.APISocket == "" {
+		return nil
+	}
+	c := api.NewClient(cfg.APISocket)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := c.Status(ctx); err != nil {
+		return nil
+	}
+	return c
+}
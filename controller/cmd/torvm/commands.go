@@ -0,0 +1,245 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/user/extorvm/controller/internal/nativehost"
+)
+
+// command describes a subcommand. The table drives the usage text, shell
+// completion scripts, and the man page, so a new subcommand only needs an
+// entry here (and its dispatch in main).
+type command struct {
+	Name    string
+	Args    string   // synopsis after the name, e.g. "[flags]"
+	Summary string   // one line, lower case, no trailing period
+	Values  []string // completions for the first positional argument
+	Flags   func() *flag.FlagSet
+}
+
+var commands = []command{
+	{
+		Name:    "run",
+		Args:    "[flags]",
+		Summary: "run the controller with the GUI, --tui, or --headless; the same as giving no command",
+	},
+	{
+		Name:    "start",
+		Summary: "start the VM of a running controller, such as a headless daemon (ctl start)",
+	},
+	{
+		Name:    "stop",
+		Summary: "stop the VM of a running controller and wait for it to shut down (ctl stop)",
+	},
+	{
+		Name:    "status",
+		Args:    "[--json]",
+		Summary: "print the state, bootstrap progress, and failsafe of a running controller (ctl status)",
+	},
+	{
+		Name:    "newnym",
+		Summary: "ask the Tor of a running controller for new circuits (ctl newnym)",
+	},
+	{
+		Name:    "doctor",
+		Args:    "[--json] [flags]",
+		Summary: "check QEMU, acceleration, TAP support, privileges, VM images, and ports (--doctor)",
+	},
+	{
+		Name:    "version",
+		Args:    "[--json]",
+		Summary: "print the version, build, QEMU, guest images, and enabled features",
+	},
+	{
+		Name:    "config",
+		Args:    "init [--force] [PATH]",
+		Summary: "write a commented default configuration, fitted to this host, to PATH, the --config file, or the platform config directory",
+		Values:  []string{"init"},
+		Flags: func() *flag.FlagSet {
+			fs, _ := configInitFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "purge-host-artifacts",
+		Args:    "[--dry-run]",
+		Summary: "remove TAP devices, routes, and firewall rules left behind by a crashed session",
+		Flags: func() *flag.FlagSet {
+			fs, _ := purgeFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "events",
+		Args:    "[--since T] [--until T] [--kind K]",
+		Summary: "print journaled events (state changes, bootstrap, errors) in a time range",
+		Flags: func() *flag.FlagSet {
+			fs, _ := eventsFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "vm",
+		Args:    "stats [--json]",
+		Summary: "print memory and disk I/O statistics of the running VM",
+		Values:  []string{"stats"},
+		Flags: func() *flag.FlagSet {
+			fs, _ := vmStatsFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "migrate",
+		Args:    "--to host:port [--tls-dir DIR]",
+		Summary: "live-migrate the running VM to a host started with --incoming",
+		Flags: func() *flag.FlagSet {
+			fs, _, _ := migrateFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "native-host",
+		Args:    "[install --extension-id ID | uninstall] [--browser B]",
+		Summary: "run or register the native messaging host for the browser extension",
+		Values:  []string{"install", "uninstall"},
+		Flags: func() *flag.FlagSet {
+			fs, _, _ := nativeHostFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "ctl",
+		Args:    "status|start|stop|newnym|config|logs [--json] [--lines N]",
+		Summary: "send a request to the control API of a running controller, such as a headless daemon",
+		Values:  ctlActions,
+		Flags: func() *flag.FlagSet {
+			fs, _, _ := ctlFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "share",
+		Args:    "[--qr] | import CODE",
+		Summary: "print the bridge, transport, and proxy settings as a share code, or import one",
+		Values:  []string{"import"},
+		Flags: func() *flag.FlagSet {
+			fs, _ := shareFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "identity",
+		Args:    "list | create NAME | switch NAME | delete NAME",
+		Summary: "keep several Tor identities, each with its own state disk of guards and keys, and choose the one the VM starts with",
+		Values:  identityActions,
+	},
+	{
+		Name:    "storage",
+		Args:    "[--clean]",
+		Summary: "show the disk space used by state disks, logs, and leftovers of interrupted work, and remove what can be reclaimed",
+		Flags: func() *flag.FlagSet {
+			fs, _ := storageFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "helper",
+		Args:    "install|uninstall|status",
+		Summary: "macOS: install the privileged helper, so network changes and launchd actions no longer ask for a password",
+		Values:  helperActions,
+	},
+	{
+		Name:    "trial",
+		Args:    "[--runs N] [--boot-timeout D] VARIANT VARIANT...",
+		Summary: "boot the VM with each config variant on a throwaway state disk and recommend the one that bootstraps best",
+		Values:  []string{"current"},
+		Flags: func() *flag.FlagSet {
+			fs, _, _ := trialFlags()
+			return fs
+		},
+	},
+	{
+		Name:    "completion",
+		Args:    "bash|zsh|fish|powershell",
+		Summary: "print a shell completion script",
+		Values:  completionShells,
+	},
+	{
+		Name:    "man",
+		Summary: "print the torvm(1) man page in troff format",
+	},
+}
+
+// hiddenFlags are left out of completions and the man page.
+var hiddenFlags = map[string]bool{
+	"service-run": true, // invoked by the Windows SCM only
+}
+
+// flagValues lists the accepted values of enumerated flags.
+var flagValues = map[string][]string{
+	"accel":      {"kvm", "hvf", "whpx", "tcg"},
+	"log-format": {"text", "json"},
+	"kind":       {"state", "bootstrap", "error", "security", "session"},
+	"browser":    nativehost.Browsers,
+}
+
+// fileFlags take a file path.
+var fileFlags = map[string]bool{
+	"config":   true,
+	"log-file": true,
+	"tls-dir":  true,
+}
+
+// cliFlag is a flag as shown in completions and the man page.
+type cliFlag struct {
+	Name    string
+	Arg     string // argument placeholder; empty for boolean flags
+	Usage   string
+	Default string // empty when the default is the zero value
+}
+
+// visibleFlags returns the non-hidden flags of fs in name order.
+func visibleFlags(fs *flag.FlagSet) []cliFlag {
+	var flags []cliFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		arg, usage := flag.UnquoteUsage(f)
+		cf := cliFlag{Name: f.Name, Arg: arg, Usage: usage}
+		switch f.DefValue {
+		case "", "false", "0", "0s":
+		default:
+			cf.Default = f.DefValue
+		}
+		flags = append(flags, cf)
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// commandFlags returns the visible flags of c, or nil if it has none.
+func commandFlags(c command) []cliFlag {
+	if c.Flags == nil {
+		return nil
+	}
+	return visibleFlags(c.Flags())
+}
+
+// usage prints the top-level help, listing subcommands after the flags.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "Usage:\n  torvm [flags]\n  torvm run [flags]\n  torvm [flags] <command> [args]\n\nCommands:\n")
+	printCommands(w)
+	fmt.Fprintf(w, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func printCommands(w io.Writer) {
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-22s %s\n", c.Name, c.Summary)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// runCompletion implements the "completion" command: print the completion
+// script for the named shell. Returns the process exit code.
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: torvm completion %s\n", strings.Join(completionShells, "|"))
+		return 2
+	}
+	if err := writeCompletion(os.Stdout, args[0], flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// writeCompletion writes a completion script for shell, covering the
+// global flags in global and the subcommands in the commands table.
+func writeCompletion(w io.Writer, shell string, global *flag.FlagSet) error {
+	flags := visibleFlags(global)
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	case "powershell":
+		writePowerShellCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q (want %s)", shell, strings.Join(completionShells, ", "))
+	}
+	return nil
+}
+
+// allValueFlags returns every flag, global or per command, that takes an
+// argument.
+func allValueFlags(global []cliFlag) []cliFlag {
+	var out []cliFlag
+	seen := make(map[string]bool)
+	add := func(flags []cliFlag) {
+		for _, f := range flags {
+			if f.Arg != "" && !seen[f.Name] {
+				seen[f.Name] = true
+				out = append(out, f)
+			}
+		}
+	}
+	add(global)
+	for _, c := range commands {
+		add(commandFlags(c))
+	}
+	return out
+}
+
+func flagWords(flags []cliFlag) []string {
+	words := make([]string, len(flags))
+	for i, f := range flags {
+		words[i] = "--" + f.Name
+	}
+	return words
+}
+
+func writeBashCompletion(w io.Writer, global []cliFlag) {
+	valueFlags := allValueFlags(global)
+	names := make([]string, len(valueFlags))
+	for i, f := range valueFlags {
+		names[i] = f.Name
+	}
+
+	top := flagWords(global)
+	for _, c := range commands {
+		top = append(top, c.Name)
+	}
+
+	fmt.Fprintf(w, `# bash completion for torvm. Generated by "torvm completion bash".
+_torvm() {
+    local cur prev cmd name i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    # Find the subcommand, skipping flags and their arguments.
+    cmd=""
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        name="${COMP_WORDS[i]#-}"
+        name="${name#-}"
+        case "${COMP_WORDS[i]}" in
+        -*)
+            case " %s " in
+            *" $name "*) ((i++)) ;;
+            esac
+            ;;
+        *)
+            cmd="${COMP_WORDS[i]}"
+            break
+            ;;
+        esac
+    done
+
+    name="${prev#-}"
+    name="${name#-}"
+    if [[ "$prev" == -* ]]; then
+        case "$name" in
+`, strings.Join(names, " "))
+	for _, f := range valueFlags {
+		switch {
+		case flagValues[f.Name] != nil:
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n",
+				f.Name, strings.Join(flagValues[f.Name], " "))
+		case fileFlags[f.Name]:
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", f.Name)
+		default:
+			fmt.Fprintf(w, "        %s) return ;;\n", f.Name)
+		}
+	}
+	fmt.Fprintf(w, `        esac
+    fi
+
+    case "$cmd" in
+    "") COMPREPLY=($(compgen -W %q -- "$cur")) ;;
+`, strings.Join(top, " "))
+	for _, c := range commands {
+		words := append(flagWords(commandFlags(c)), c.Values...)
+		if len(words) > 0 {
+			fmt.Fprintf(w, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", c.Name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprint(w, `    esac
+}
+complete -F _torvm torvm
+`)
+}
+
+// zshQuote escapes s for use inside a single-quoted _arguments spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+}
+
+func zshFlagSpec(f cliFlag) string {
+	if f.Arg == "" {
+		return fmt.Sprintf("'--%s[%s]'", f.Name, zshQuote(f.Usage))
+	}
+	action := ""
+	switch {
+	case flagValues[f.Name] != nil:
+		action = "(" + strings.Join(flagValues[f.Name], " ") + ")"
+	case fileFlags[f.Name]:
+		action = "_files"
+	}
+	return fmt.Sprintf("'--%s=[%s]:%s:%s'", f.Name, zshQuote(f.Usage), f.Arg, action)
+}
+
+func writeZshCompletion(w io.Writer, global []cliFlag) {
+	fmt.Fprint(w, `#compdef torvm
+# zsh completion for torvm. Generated by "torvm completion zsh".
+_torvm() {
+  local curcontext="$curcontext" state line
+  local -a subcmds
+  subcmds=(
+`)
+	for _, c := range commands {
+		fmt.Fprintf(w, "    '%s:%s'\n", c.Name, zshQuote(c.Summary))
+	}
+	fmt.Fprint(w, "  )\n\n  _arguments -C \\\n")
+	for _, f := range global {
+		fmt.Fprintf(w, "    %s \\\n", zshFlagSpec(f))
+	}
+	fmt.Fprint(w, `    '1: :->command' \
+    '*:: :->args'
+
+  case $state in
+  command)
+    _describe -t commands 'torvm command' subcmds
+    ;;
+  args)
+    case $words[1] in
+`)
+	for _, c := range commands {
+		flags := commandFlags(c)
+		if len(flags) == 0 && len(c.Values) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "    %s)\n      _arguments", c.Name)
+		for _, f := range flags {
+			fmt.Fprintf(w, " \\\n        %s", zshFlagSpec(f))
+		}
+		if len(c.Values) > 0 {
+			fmt.Fprintf(w, " \\\n        '1:value:(%s)'", strings.Join(c.Values, " "))
+		}
+		fmt.Fprint(w, "\n      ;;\n")
+	}
+	fmt.Fprint(w, `    esac
+    ;;
+  esac
+}
+
+_torvm "$@"
+`)
+}
+
+// fishQuote single-quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func fishFlagLine(cond string, f cliFlag) string {
+	line := fmt.Sprintf("complete -c torvm -n %s -l %s", fishQuote(cond), f.Name)
+	switch {
+	case f.Arg == "":
+	case flagValues[f.Name] != nil:
+		line += " -x -a " + fishQuote(strings.Join(flagValues[f.Name], " "))
+	case fileFlags[f.Name]:
+		line += " -r -F"
+	default:
+		line += " -x"
+	}
+	return line + " -d " + fishQuote(f.Usage)
+}
+
+func writeFishCompletion(w io.Writer, global []cliFlag) {
+	fmt.Fprint(w, "# fish completion for torvm. Generated by \"torvm completion fish\".\n")
+	fmt.Fprint(w, "complete -c torvm -f\n")
+	for _, f := range global {
+		fmt.Fprintln(w, fishFlagLine("__fish_use_subcommand", f))
+	}
+	for _, c := range commands {
+		fmt.Fprintf(w, "complete -c torvm -n __fish_use_subcommand -a %s -d %s\n", c.Name, fishQuote(c.Summary))
+	}
+	for _, c := range commands {
+		cond := "__fish_seen_subcommand_from " + c.Name
+		for _, f := range commandFlags(c) {
+			fmt.Fprintln(w, fishFlagLine(cond, f))
+		}
+		if len(c.Values) > 0 {
+			fmt.Fprintf(w, "complete -c torvm -n %s -a %s\n", fishQuote(cond), fishQuote(strings.Join(c.Values, " ")))
+		}
+	}
+}
+
+// psList formats words as a PowerShell array literal.
+func psList(words []string) string {
+	quoted := make([]string, len(words))
+	for i, s := range words {
+		quoted[i] = "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	}
+	return "@(" + strings.Join(quoted, ", ") + ")"
+}
+
+func writePowerShellCompletion(w io.Writer, global []cliFlag) {
+	valueFlags := allValueFlags(global)
+	names := make([]string, len(valueFlags))
+	for i, f := range valueFlags {
+		names[i] = f.Name
+	}
+
+	fmt.Fprintf(w, `# PowerShell completion for torvm. Generated by "torvm completion powershell".
+Register-ArgumentCompleter -Native -CommandName torvm, torvm.exe -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $takesValue = %s
+    $values = @{
+`, psList(names))
+	for _, f := range valueFlags {
+		if v := flagValues[f.Name]; v != nil {
+			fmt.Fprintf(w, "        '%s' = %s\n", f.Name, psList(v))
+		}
+	}
+	top := flagWords(global)
+	for _, c := range commands {
+		top = append(top, c.Name)
+	}
+	fmt.Fprintf(w, "    }\n    $completions = @{\n        '' = %s\n", psList(top))
+	for _, c := range commands {
+		words := append(flagWords(commandFlags(c)), c.Values...)
+		if len(words) > 0 {
+			fmt.Fprintf(w, "        '%s' = %s\n", c.Name, psList(words))
+		}
+	}
+	fmt.Fprint(w, `    }
+
+    $elems = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { "$_" })
+    if ($wordToComplete) { $elems = @($elems | Select-Object -SkipLast 1) }
+
+    # Find the subcommand, skipping flags and their arguments.
+    $cmd = ''
+    for ($i = 0; $i -lt $elems.Count; $i++) {
+        if ($elems[$i].StartsWith('-')) {
+            if ($takesValue -contains $elems[$i].TrimStart('-')) { $i++ }
+            continue
+        }
+        $cmd = $elems[$i]
+        break
+    }
+
+    $candidates = $completions[$cmd]
+    if ($elems.Count -gt 0 -and $elems[-1].StartsWith('-')) {
+        $prev = $elems[-1].TrimStart('-')
+        if ($takesValue -contains $prev) {
+            # Unlisted values fall back to file name completion.
+            $candidates = $values[$prev]
+            if (-not $candidates) { return }
+        }
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`)
+}
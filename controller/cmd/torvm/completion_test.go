@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func testFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("torvm", flag.ContinueOnError)
+	fs.String("accel", "", "acceleration backend: kvm, hvf, whpx, tcg")
+	fs.String("config", "", "path to JSON config file")
+	fs.Bool("verbose", false, "enable debug logging")
+	fs.Bool("service-run", false, "run as Windows service")
+	return fs
+}
+
+func TestWriteCompletion(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCompletion(&buf, shell, testFlagSet()); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			for _, want := range []string{"accel", "verbose", "kvm", "purge-host-artifacts", "events", "since", "powershell"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("%s script lacks %q", shell, want)
+				}
+			}
+			if strings.Contains(out, "service-run") {
+				t.Errorf("%s script includes hidden flag", shell)
+			}
+		})
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, "tcsh", testFlagSet()); err == nil {
+		t.Error("unsupported shell accepted")
+	}
+}
+
+func TestWriteManPage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeManPage(&buf, testFlagSet()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		".TH TORVM 1",
+		`.BI \-\-accel " " string`,
+		`.B \-\-verbose`,
+		`.BR events " [\-\-since T]`,
+		`.BI \-\-since " " string`,
+		"(default 1h)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("man page lacks %q", want)
+		}
+	}
+	if strings.Contains(out, "service") {
+		t.Error("man page includes hidden flag")
+	}
+}
+
+func TestManEscape(t *testing.T) {
+	for in, want := range map[string]string{
+		"--config":   `\-\-config`,
+		`C:\torvm`:   `C:\etorvm`,
+		".hidden":    `\&.hidden`,
+		"plain text": "plain text",
+	} {
+		if got := manEscape(in); got != want {
+			t.Errorf("manEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
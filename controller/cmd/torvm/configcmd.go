@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/datadir"
+	"github.com/user/extorvm/controller/internal/network"
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+// configInitFlags defines the "config init" command's flags. It is
+// shared with the completion and man page generators.
+func configInitFlags() (fs *flag.FlagSet, force *bool) {
+	fs = flag.NewFlagSet("config init", flag.ContinueOnError)
+	force = fs.Bool("force", false, "overwrite an existing file")
+	return fs, force
+}
+
+// runConfig implements the "config" command. Its one action, init,
+// writes the default configuration to PATH, or to the --config file, or
+// to torvm.toml in the platform's config directory (see datadir), as
+// a starting point to edit, in the format of its extension. TOML and
+// YAML files have every key commented. The defaults are fitted to this
+// host: the accelerator it has, and a TAP subnet its networks do not
+// use. Returns the process exit code.
+func runConfig(configFile string, args []string) int {
+	if len(args) == 0 || args[0] != "init" {
+		fmt.Fprintln(os.Stderr, "usage: torvm config init [--force] [PATH]")
+		return 2
+	}
+	fs, force := configInitFlags()
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	path := configFile
+	switch {
+	case fs.NArg() == 1:
+		path = fs.Arg(0)
+	case fs.NArg() > 1:
+		fmt.Fprintln(os.Stderr, "usage: torvm config init [--force] [PATH]; PATH defaults to --config, then the platform config directory")
+		return 2
+	case path == "":
+		// TOML rather than ConfigFile's JSON, which cannot hold the
+		// comments; FindConfig finds either.
+		path = filepath.Join(datadir.Default().Config, "torvm.toml")
+	}
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "error: %s already exists; use --force to overwrite it\n", path)
+		return 1
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Version = config.ConfigVersion
+	detectDefaults(cfg)
+	format := config.FormatOf(path)
+	data, err := config.MarshalCommented(cfg, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	// The file will hold secrets once edited, and config.Load refuses
+	// one that others can write.
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote the default configuration to %s\n", path)
+	fmt.Printf("  accelerator %s, TAP link %s (host) and %s (VM)\n", cfg.Accel, cfg.HostIP, cfg.VMIP)
+	if format == config.FormatJSON {
+		fmt.Println("  JSON has no comments; give a .toml or .yaml path for a file that explains each setting")
+	}
+	return 0
+}
+
+// detectDefaults fits cfg to this host: the best accelerator it has, and
+// TAP addresses in a subnet none of its networks use. The subnet is
+// checked again at each start while auto_subnet is set; writing it down
+// keeps the addresses the same from run to run.
+func detectDefaults(cfg *config.Config) {
+	info, _ := platform.Detect()
+	cfg.Accel = string(info.Accel)
+
+	used, err := network.HostNetworks(cfg.TAPName)
+	if err != nil {
+		return
+	}
+	mask := net.IPMask(net.ParseIP(cfg.SubnetMask).To4())
+	host, vm, changed, err := network.SelectSubnet(net.ParseIP(cfg.HostIP), net.ParseIP(cfg.VMIP), mask, used)
+	if err == nil && changed {
+		cfg.HostIP, cfg.VMIP = host.String(), vm.String()
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// ctlActions are the "ctl" command's actions.
+var ctlActions = []string{"status", "start", "stop", "newnym", "config", "logs"}
+
+// daemonActions are the ctl actions that are also commands of their own,
+// as in "torvm stop".
+var daemonActions = []string{"start", "stop", "status", "newnym"}
+
+// ctlFlags defines the "ctl" command's flags. It is shared with the
+// completion and man page generators.
+func ctlFlags() (fs *flag.FlagSet, jsonOut *bool, lines *int) {
+	fs = flag.NewFlagSet("ctl", flag.ContinueOnError)
+	jsonOut = fs.Bool("json", false, "status: print JSON")
+	lines = fs.Int("lines", 100, "logs: number of lines")
+	return fs, jsonOut, lines
+}
+
+// runCtl implements the "ctl" command: it sends one request to the
+// control API of a running controller, such as a headless daemon, and
+// prints the reply. asJSON is the global --json flag, which does what
+// the command's own does. Returns the process exit code.
+func runCtl(cfg *config.Config, args []string, asJSON bool) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: torvm ctl status|start|stop|newnym|config|logs [--json] [--lines N]")
+		return 2
+	}
+	action := args[0]
+	fs, jsonOut, lines := ctlFlags()
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	*jsonOut = *jsonOut || asJSON
+	if cfg.APISocket == "" {
+		fmt.Fprintln(os.Stderr, "error: the control API is disabled (api_socket is empty)")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	c := api.NewClient(cfg.APISocket)
+	var err error
+	switch action {
+	case "status":
+		var st api.Status
+		if st, err = c.Status(ctx); err == nil {
+			printStatus(st, *jsonOut)
+		}
+	case "start":
+		err = c.Start(ctx)
+	case "stop":
+		err = c.Stop(ctx)
+	case "newnym":
+		err = c.NewIdentity(ctx)
+	case "config":
+		var raw json.RawMessage
+		if raw, err = c.Config(ctx); err == nil {
+			var b bytes.Buffer
+			json.Indent(&b, raw, "", "  ")
+			fmt.Println(b.String())
+		}
+	case "logs":
+		var out []string
+		if out, err = c.Logs(ctx, *lines); err == nil {
+			for _, l := range out {
+				fmt.Println(l)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown action %q\n", action)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printStatus(st api.Status, asJSON bool) {
+	if asJSON {
+		json.NewEncoder(os.Stdout).Encode(st)
+		return
+	}
+	fmt.Printf("State:     %s\n", st.State)
+	fmt.Printf("Bootstrap: %d%%", st.Bootstrap)
+	if st.Summary != "" {
+		fmt.Printf(" (%s)", st.Summary)
+	}
+	fmt.Println()
+	fmt.Printf("Failsafe:  %v\n", st.Failsafe)
+	fmt.Printf("SOCKS:     %s\n", st.SOCKS)
+	fmt.Printf("Version:   %s\n", st.Version)
+	if st.ShutdownReason != "" {
+		fmt.Printf("Stopped:   %s\n", st.ShutdownReason)
+	}
+}
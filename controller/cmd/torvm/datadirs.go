@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/datadir"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// prepareDataDirs creates the platform's data directories and moves the
+// files of the old layout under ./dist to where cfg now has them. Only
+// files whose path in cfg is the default move; a path the config file
+// sets is left as it is. A state disk still missing is copied from the
+// images, which may ship a fresh one. Failures are logged only: the VM
+// start reports a missing file itself.
+func prepareDataDirs(cfg *config.Config, logger *logging.Logger) {
+	dirs := datadir.Default()
+	if err := dirs.Ensure(); err != nil {
+		logger.Error("%v", err)
+		return
+	}
+
+	def := config.DefaultConfig()
+	var moves []datadir.Move
+	move := func(path, defPath string, legacy ...string) {
+		if path == defPath {
+			moves = append(moves, datadir.Move{From: filepath.Join(append([]string{datadir.Legacy}, legacy...)...), To: path})
+		}
+	}
+	move(cfg.StateDiskPath, def.StateDiskPath, "vm", "state.img")
+	move(cfg.Browser.StateDiskPath, def.Browser.StateDiskPath, "browservm", "state.img")
+	move(cfg.Journal.Path, def.Journal.Path, "events.jsonl")
+	move(cfg.Vector.IndexDir, def.Vector.IndexDir, "vector")
+	move(cfg.FHE.IndexDir, def.FHE.IndexDir, "fhe")
+	move(cfg.Migration.TLSDir, def.Migration.TLSDir, "migration-tls")
+
+	// An incoming migration brings its own state disk.
+	if cfg.Incoming == "" && cfg.StateDiskPath == def.StateDiskPath {
+		moves = append(moves, datadir.Move{From: filepath.Join(dirs.Images, "state.img"), To: cfg.StateDiskPath, Copy: true})
+	}
+	if cfg.Browser.StateDiskPath == def.Browser.StateDiskPath {
+		moves = append(moves, datadir.Move{From: filepath.Join(dirs.BrowserImages, "state.img"), To: cfg.Browser.StateDiskPath, Copy: true})
+	}
+
+	done, err := datadir.Migrate(moves)
+	for _, m := range done {
+		if m.Copy {
+			logger.Info("data: copied %s to %s", m.From, m.To)
+		} else {
+			logger.Info("data: moved %s to %s", m.From, m.To)
+		}
+	}
+	if err != nil {
+		logger.Error("%v", err)
+	}
+}
+
+// logImagePaths logs the absolute paths of the VM images, which a path
+// relative to the working directory or the config file would hide.
+func logImagePaths(cfg *config.Config, logger *logging.Logger) {
+	logger.Info("VM kernel %s, initramfs %s, state disk %s",
+		absPath(cfg.KernelPath), absPath(cfg.InitrdPath), absPath(cfg.StateDiskPath))
+}
+
+// absPath returns path made absolute, or path if it cannot be.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/supervisor"
+)
+
+// diagLogLines is how many recent log lines a diagnostics snapshot
+// repeats.
+const diagLogLines = 100
+
+// logDiagnostics writes a snapshot of the controller to the log, as on
+// SIGUSR1: the process, the session state, the running configuration
+// without its secrets, and the recent log lines. ring and sup may be nil.
+func logDiagnostics(engine *lifecycle.Engine, ring *logging.RingWriter, sup *supervisor.Supervisor, logger *logging.Logger) {
+	// Taken first, so the snapshot does not repeat itself.
+	var recent []string
+	if ring != nil {
+		recent = ring.Lines()
+		recent = recent[max(0, len(recent)-diagLogLines):]
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	logger.Info("diagnostics: torvm %s, pid %d, %s %s/%s, %d goroutines, heap %d KiB",
+		controllerVersion, os.Getpid(), runtime.Version(), runtime.GOOS, runtime.GOARCH,
+		runtime.NumGoroutine(), mem.HeapAlloc>>10)
+
+	session := fmt.Sprintf("state %s, VM running %t, failsafe active %t",
+		engine.State(), engine.VM.IsRunning(), engine.FailSafe.IsActive())
+	if bw, ok := engine.Bandwidth(); ok {
+		session += fmt.Sprintf(", traffic %d B/s in, %d B/s out", bw.BytesRead, bw.BytesWritten)
+	}
+	logger.Info("diagnostics: %s", session)
+	if sup != nil {
+		logger.Info("diagnostics: helpers running: %s", strings.Join(sup.Running(), ", "))
+	}
+
+	if data, err := json.Marshal(engine.Config.Redacted()); err != nil {
+		logger.Error("diagnostics: config: %v", err)
+	} else {
+		logger.Info("diagnostics: config: %s", data)
+	}
+
+	logger.Info("diagnostics: last %d log lines:", len(recent))
+	for _, line := range recent {
+		logger.Info("diagnostics: | %s", line)
+	}
+	logger.Info("diagnostics: end")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/journal"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// openJournal opens the configured event journal and wires it to the
+// engine's observers and the logger's error output. Returns nil when the
+// journal is disabled or cannot be opened.
+func openJournal(cfg *config.Config, engine *lifecycle.Engine, logger *logging.Logger) *journal.Journal {
+	if cfg.Journal.Path == "" {
+		return nil
+	}
+	j, err := journal.Open(cfg.Journal.Path, int64(cfg.Journal.MaxSizeKB)*1024)
+	if err != nil {
+		logger.Error("event journal: %v", err)
+		return nil
+	}
+	logger.AddWriter(j.LogWriter())
+	engine.Events.Subscribe(func(ev lifecycle.Event) {
+		if ev.Kind != lifecycle.EventState {
+			return
+		}
+		if ev.Reason != lifecycle.ShutdownNone {
+			j.Record(journal.KindState, "%s -> %s (%s)", ev.From, ev.To, ev.Reason.Description())
+			return
+		}
+		j.Record(journal.KindState, "%s -> %s", ev.From, ev.To)
+	})
+	engine.OnBootstrapProgress(func(progress int, summary string) {
+		j.Record(journal.KindBootstrap, "%d%% %s", progress, summary)
+	})
+	engine.OnSessionEnd(func(r lifecycle.SessionReport) {
+		j.Record(journal.KindSession, "%s", r.Summary())
+	})
+	return j
+}
+
+// eventsOptions holds the parsed flags of the "events" command.
+type eventsOptions struct {
+	since, until, kind *string
+}
+
+// eventsFlags defines the "events" command's flags. It is shared with the
+// completion and man page generators.
+func eventsFlags() (*flag.FlagSet, eventsOptions) {
+	fs := flag.NewFlagSet("events", flag.ContinueOnError)
+	return fs, eventsOptions{
+		since: fs.String("since", "1h", "start of range: duration ago (e.g. 30m, 24h) or RFC 3339 time"),
+		until: fs.String("until", "", "end of range: duration ago or RFC 3339 time (default now)"),
+		kind:  fs.String("kind", "", "only show events of this kind: state, bootstrap, error, security, session"),
+	}
+}
+
+// runEvents implements the "events" command: print journal entries in a
+// time range. Returns the process exit code.
+func runEvents(cfg *config.Config, args []string) int {
+	fs, opts := eventsFlags()
+	since, until, kind := opts.since, opts.until, opts.kind
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if cfg.Journal.Path == "" {
+		fmt.Fprintln(os.Stderr, "error: event journal is disabled (journal.path is empty)")
+		return 1
+	}
+
+	now := time.Now()
+	from, err := parseEventTime(*since, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --since: %v\n", err)
+		return 2
+	}
+	var to time.Time
+	if *until != "" {
+		if to, err = parseEventTime(*until, now); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --until: %v\n", err)
+			return 2
+		}
+	}
+
+	events, err := journal.Query(cfg.Journal.Path, from, to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	for _, ev := range events {
+		if *kind != "" && ev.Kind != *kind {
+			continue
+		}
+		fmt.Println(ev)
+	}
+	return 0
+}
+
+// parseEventTime accepts either a duration before now ("90m") or an
+// absolute RFC 3339 timestamp.
+func parseEventTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
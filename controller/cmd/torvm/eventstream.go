@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// eventStreamBuffer is how many events --events-json holds for a reader
+// that has fallen behind before it drops them.
+const eventStreamBuffer = 1024
+
+// startEventStream writes the engine's events to w, one JSON object per
+// line, for --events-json. A goroutine does the writing, so a wrapper
+// that stops reading never holds up the engine: events beyond
+// eventStreamBuffer are dropped, and the log says so. The returned
+// function stops the stream once the events so far are written.
+func startEventStream(w io.Writer, engine *lifecycle.Engine, logger *logging.Logger) (stop func()) {
+	ch := make(chan lifecycle.Event, eventStreamBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := json.NewEncoder(w)
+		for ev := range ch {
+			if err := enc.Encode(ev); err != nil {
+				logger.Error("events-json: %v", err)
+			}
+		}
+	}()
+
+	// mu guards against a publisher that was already delivering when
+	// stop ran, and dropping limits the log to one line per backlog.
+	var mu sync.Mutex
+	var closed, dropping bool
+	unsubscribe := engine.Events.Subscribe(func(ev lifecycle.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- ev:
+			dropping = false
+		default:
+			if !dropping {
+				dropping = true
+				logger.Error("events-json: output is not being read; dropping events")
+			}
+		}
+	})
+	return func() {
+		unsubscribe()
+		mu.Lock()
+		closed = true
+		close(ch)
+		mu.Unlock()
+		<-done
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func TestEventStream(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	engine := lifecycle.NewEngine(config.DefaultConfig(), logger)
+	var out bytes.Buffer
+	stop := startEventStream(&out, engine, logger)
+	engine.Events.Publish(lifecycle.Event{Kind: lifecycle.EventState, From: lifecycle.StateWaitBootstrap, To: lifecycle.StateRunning})
+	engine.Events.Publish(lifecycle.Event{Kind: lifecycle.EventBootstrap, Progress: 100, Summary: "Done"})
+	stop()
+	engine.Events.Publish(lifecycle.Event{Kind: lifecycle.EventFailsafe, Active: true})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2 (none after stop):\n%s", len(lines), out.String())
+	}
+	var ev map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev["kind"] != "state" || ev["to"] != "Running" {
+		t.Errorf("first event = %v", ev)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev["kind"] != "bootstrap" || ev["progress"] != 100.0 {
+		t.Errorf("second event = %v", ev)
+	}
+}
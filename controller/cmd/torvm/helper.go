@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/platform"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/privhelper"
+)
+
+// helperActions are the arguments of the "helper" command; "serve" is
+// left out, as launchd runs it.
+var helperActions = []string{"install", "uninstall", "status"}
+
+// runHelper implements the "helper" command: install, remove, or check
+// the macOS privileged helper, or, with "serve", be the helper. Returns
+// the process exit code.
+func runHelper(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: torvm helper install|uninstall|status")
+		return 2
+	}
+	switch args[0] {
+	case "install":
+		if err := privhelper.Install(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		fmt.Println("Privileged helper installed; TorVM no longer asks for your password for network and service changes.")
+	case "uninstall":
+		if err := privhelper.Uninstall(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		fmt.Println("Privileged helper removed.")
+	case "status":
+		if !privhelper.Installed() {
+			fmt.Println("Privileged helper: not installed")
+			return 1
+		}
+		_, err := privhelper.Client{}.RunOps(nil)
+		if errors.Is(err, privexec.ErrNoElevator) {
+			fmt.Printf("Privileged helper: installed, not running (%v)\n", err)
+			return 1
+		}
+		fmt.Println("Privileged helper: running")
+	case "serve":
+		return serveHelper()
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown helper action %q\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// serveHelper runs the helper until launchd stops it.
+func serveHelper() int {
+	logger, err := logging.NewLogger(logging.Options{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: create logger: %v\n", err)
+		return 1
+	}
+	if !platform.Elevated() {
+		logger.Error("privileged helper: must run as root")
+		return 1
+	}
+	ln, err := privhelper.Listen()
+	if err != nil {
+		logger.Error("privileged helper: %v", err)
+		return 1
+	}
+	privexec.Default.SetAudit(func(rec privexec.Record) {
+		logger.Info("privileged helper: %s", rec)
+	})
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		ln.Close()
+	}()
+	logger.Info("privileged helper: listening on %s", privhelper.SocketPath)
+	if err := privhelper.NewServer(privexec.Default).Serve(ln); err != nil {
+		logger.Error("privileged helper: %v", err)
+		return 1
+	}
+	return 0
+}
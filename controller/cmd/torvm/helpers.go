@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/supervisor"
+)
+
+// startHelpers supervises the configured auxiliary processes, starting
+// each when the session enters the states it runs in and stopping it when
+// the session leaves them. The returned supervisor (nil when no helpers
+// are configured) must be stopped by the caller.
+func startHelpers(cfg *config.Config, engine *lifecycle.Engine, logger *logging.Logger) *supervisor.Supervisor {
+	if len(cfg.Helpers) == 0 {
+		return nil
+	}
+	sup := supervisor.New(logger)
+	helpers := cfg.Helpers
+	engine.OnStateChange(func(_, to lifecycle.State) {
+		for _, h := range helpers {
+			if helperRunsIn(h.When, to) {
+				sup.Start(supervisor.Helper{Name: h.Name, Path: h.Path, Args: h.Args})
+			} else {
+				sup.Stop(h.Name)
+			}
+		}
+	})
+	logger.Info("supervising %d helper(s)", len(helpers))
+	return sup
+}
+
+// helperRunsIn reports whether a helper with the given "when" setting
+// runs in state s. A paused VM keeps its helpers: it resumes where it
+// left off.
+func helperRunsIn(when string, s lifecycle.State) bool {
+	switch s {
+	case lifecycle.StateRunning, lifecycle.StatePaused:
+		return true
+	case lifecycle.StateLaunchVM, lifecycle.StateWaitTAP, lifecycle.StateConfigureTAP,
+		lifecycle.StateVerifyRoutes, lifecycle.StateFlushDNS, lifecycle.StateWaitBootstrap,
+		lifecycle.StateShutdown, lifecycle.StateRestoreNetwork:
+		return when == "session"
+	}
+	return false
+}
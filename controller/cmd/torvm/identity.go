@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/identity"
+)
+
+// identityActions are the arguments of the "identity" command.
+var identityActions = []string{"list", "create", "switch", "delete"}
+
+const identityUsage = "usage: torvm identity list | create NAME | switch NAME | delete NAME"
+
+// runIdentity implements the "identity" command: list, create, switch,
+// or delete the saved Tor identities of the configured state disk.
+// Changing them takes the instance lock, so it is refused while a
+// controller runs; the GUI switches a running VM by restarting it.
+// Returns the process exit code.
+func runIdentity(cfg *config.Config, configPath string, args []string) int {
+	want := 2 // an action and a name
+	if len(args) > 0 && args[0] == "list" {
+		want = 1
+	}
+	if len(args) != want {
+		fmt.Fprintln(os.Stderr, identityUsage)
+		return 2
+	}
+	store := identity.Open(cfg.StateDiskPath)
+	if args[0] == "list" {
+		list, err := store.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tSIZE\tLAST USED")
+		for _, id := range list {
+			mark, size, used := "", "-", "-"
+			if id.Active {
+				mark = "*"
+			}
+			if id.Size > 0 {
+				size = fmt.Sprintf("%d MB", id.Size>>20)
+				used = id.Modified.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, id.Name, size, used)
+		}
+		w.Flush()
+		return 0
+	}
+
+	lock := lockInstance(cfg, configPath, false)
+	defer lock.Release()
+	name := args[1]
+	var err error
+	switch args[0] {
+	case "create":
+		if err = store.Create(name, 0); err == nil {
+			fmt.Printf("Identity %s created; \"torvm identity switch %s\" makes it active.\n", name, name)
+		}
+	case "switch":
+		if err = store.Switch(name); err == nil {
+			fmt.Printf("Identity %s is active; the VM uses its guards and keys from the next start.\n", name)
+		}
+	case "delete":
+		if err = store.Delete(name); err == nil {
+			fmt.Printf("Identity %s deleted.\n", name)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown identity action %q\n", args[0])
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/instancelock"
+	"github.com/user/extorvm/controller/internal/network"
+)
+
+// lockInstance keeps a second controller off this one's instance, TAP
+// device, and state disk, exiting if another controller already has any
+// of them unless force is set. Locking is best effort otherwise: if the
+// lock files cannot be written, the controller warns and runs unlocked.
+// The returned lock (nil when none was taken) is released by the caller.
+func lockInstance(cfg *config.Config, configPath string, force bool) *instancelock.Lock {
+	lock, err := instancelock.Acquire(network.DefaultStateDir(), cfg, instancelock.Owner{
+		PID:      os.Getpid(),
+		Config:   configPath,
+		Instance: cfg.Instance,
+		Started:  time.Now(),
+	})
+	var held *instancelock.HeldError
+	switch {
+	case err == nil:
+		return lock
+	case errors.As(err, &held) && force:
+		fmt.Fprintf(os.Stderr, "warning: %v; starting anyway (--force)\n", err)
+	case errors.As(err, &held):
+		fmt.Fprintf(os.Stderr, "error: %v; stop it first, or pass --force to start anyway\n", err)
+		os.Exit(1)
+	default:
+		fmt.Fprintf(os.Stderr, "warning: %v; not guarding against a second controller\n", err)
+	}
+	return nil
+}
@@ -2,63 +2,148 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"runtime"
+	"slices"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/user/extorvm/controller/api"
 	"github.com/user/extorvm/controller/gui"
+	"github.com/user/extorvm/controller/internal/about"
 	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/datadir"
+	"github.com/user/extorvm/controller/internal/doctor"
+	"github.com/user/extorvm/controller/internal/instancelock"
+	"github.com/user/extorvm/controller/internal/journal"
 	"github.com/user/extorvm/controller/internal/launchd"
 	"github.com/user/extorvm/controller/internal/lifecycle"
 	"github.com/user/extorvm/controller/internal/logging"
 	"github.com/user/extorvm/controller/internal/metrics"
+	"github.com/user/extorvm/controller/internal/nethelper"
+	"github.com/user/extorvm/controller/internal/network"
 	"github.com/user/extorvm/controller/internal/platform"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/privhelper"
+	"github.com/user/extorvm/controller/internal/secwatch"
 	"github.com/user/extorvm/controller/internal/systemd"
 	"github.com/user/extorvm/controller/internal/tor"
+	"github.com/user/extorvm/controller/internal/vm"
 	"github.com/user/extorvm/controller/internal/winsvc"
+	"github.com/user/extorvm/controller/tui"
 )
 
+// controllerVersion is printed by --version and reported by the health
+// endpoint and the control API.
+const controllerVersion = "0.1.0"
+
 func main() {
 	var (
 		accelFlag        = flag.String("accel", "", "acceleration backend: kvm, hvf, whpx, tcg")
 		verboseFlag      = flag.Bool("verbose", false, "enable debug logging")
 		headless         = flag.Bool("headless", false, "run without GUI")
-		configFile       = flag.String("config", "", "path to JSON config file")
+		backend          = flag.Bool("backend", false, "run headless as the privileged back end of a GUI run by a user; the VM starts and stops through the control API")
+		tuiMode          = flag.Bool("tui", false, "run with a terminal UI instead of the GUI")
+		configFile       = flag.String("config", "", "path to config file: JSON, or TOML or YAML by extension")
 		clean            = flag.Bool("clean", false, "remove state disk before starting")
 		replace          = flag.Bool("replace", false, "replace existing state disk with fresh copy")
 		serviceInstall   = flag.Bool("service-install", false, "install as system service and exit")
 		serviceUninstall = flag.Bool("service-uninstall", false, "uninstall system service and exit")
 		serviceRun       = flag.Bool("service-run", false, "run as Windows service (used by SCM, not for manual invocation)")
-		metricsAddr      = flag.String("metrics-addr", "", "address for metrics/health HTTP server (e.g. 127.0.0.1:9100)")
+		metricsAddr      = flag.String("metrics-addr", "", "address for the metrics, health and status HTTP server (e.g. 127.0.0.1:9100)")
 		logFormat        = flag.String("log-format", "", "log format: text (default) or json")
+		eventsJSON       = flag.Bool("events-json", false, "headless: write each lifecycle, bootstrap, and failsafe event to stdout as a JSON line")
 		logFile          = flag.String("log-file", "", "path to log file (in addition to stderr)")
 		timeout          = flag.Duration("timeout", 0, "maximum runtime duration; 0 means unlimited")
 		status           = flag.Bool("status", false, "query running instance status and exit")
+		doctorMode       = flag.Bool("doctor", false, "check QEMU, acceleration, TAP support, privileges, VM images, and ports, then exit")
+		force            = flag.Bool("force", false, "start despite another controller using the same instance, TAP device, or state disk; headless: stop on signal without waiting for active Tor connections")
 		version          = flag.Bool("version", false, "print version and exit")
+		jsonOut          = flag.Bool("json", false, "print version, status, and doctor output as JSON")
+		incoming         = flag.String("incoming", "", "receive a live migration on host:port instead of booting the VM")
 	)
+	flag.Usage = usage
 	flag.Parse()
 
+	// Without --config, use the config file in the platform's config
+	// directory, if there is one.
+	if *configFile == "" {
+		*configFile = datadir.Default().FindConfig()
+	}
+
+	// fullVersion is set by "torvm version", as opposed to --version.
+	fullVersion := false
+
+	// Handle the completion and man commands before loading the config,
+	// so they work on a machine without one.
+	switch flag.Arg(0) {
+	case "completion":
+		os.Exit(runCompletion(flag.Args()[1:]))
+	case "man":
+		os.Exit(runMan())
+	case "config":
+		os.Exit(runConfig(*configFile, flag.Args()[1:]))
+	case "helper":
+		os.Exit(runHelper(flag.Args()[1:]))
+	case "run", "doctor", "version":
+		// "torvm run [flags]" is "torvm [flags]", and "torvm doctor
+		// [flags]" is "torvm --doctor [flags]": the global flags may
+		// follow the command too.
+		cmd := flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() > 0 {
+			fmt.Fprintf(os.Stderr, "error: %s takes no arguments, got %q\n", cmd, flag.Arg(0))
+			os.Exit(2)
+		}
+		switch cmd {
+		case "doctor":
+			*doctorMode = true
+		case "version":
+			*version = true
+			fullVersion = true
+		}
+	}
+
+	// "torvm version" reports the build, QEMU, images, and features;
+	// --version only the version, unless --json is given.
 	if *version {
-		fmt.Println("torvm version 0.1.0")
+		printVersion(*configFile, fullVersion, *jsonOut)
 		return
 	}
 
-	// Handle service install/uninstall commands and exit.
+	if *backend {
+		*headless = true
+	}
+	if *eventsJSON && !*headless {
+		fmt.Fprintln(os.Stderr, "error: --events-json requires --headless")
+		os.Exit(2)
+	}
+
+	// Handle service install/uninstall commands and exit. Install
+	// applies the service overrides from the config.
 	if *serviceInstall {
-		var err error
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: load config: %v\n", err)
+			os.Exit(1)
+		}
 		switch runtime.GOOS {
 		case "darwin":
-			err = launchd.Install(false)
+			err = launchd.Install(cfg.Service, *configFile)
 		case "linux":
-			err = systemd.Install()
+			err = systemd.Install(cfg.Service, cfg.Entropy.SerialEntropyDevice)
 		case "windows":
-			err = winsvc.InstallService()
+			err = winsvc.InstallService(cfg.Service)
 		default:
 			fmt.Fprintf(os.Stderr, "error: service install not supported on %s\n", runtime.GOOS)
 			os.Exit(1)
@@ -97,13 +182,65 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Handle the purge-host-artifacts command: remove labelled leftovers
+	// from a crashed session and exit.
+	if flag.Arg(0) == "purge-host-artifacts" {
+		os.Exit(purgeHostArtifacts(cfg, flag.Args()[1:]))
+	}
+
+	// Handle the events command: print journal entries and exit.
+	if flag.Arg(0) == "events" {
+		os.Exit(runEvents(cfg, flag.Args()[1:]))
+	}
+
+	// Handle the vm command: query the running VM over QMP and exit.
+	if flag.Arg(0) == "vm" {
+		os.Exit(runVM(cfg, flag.Args()[1:]))
+	}
+
+	// Handle the migrate command: move the running VM to another host.
+	if flag.Arg(0) == "migrate" {
+		os.Exit(runMigrate(cfg, flag.Args()[1:]))
+	}
+
+	// Handle the native-host command: bridge a browser extension to the
+	// control API, or register the host with a browser.
+	if flag.Arg(0) == "native-host" {
+		os.Exit(runNativeHost(cfg, *configFile, flag.Args()[1:]))
+	}
+
+	// Handle the ctl command: one request to a running controller's API.
+	// start, stop, status and newnym are short for its actions.
+	if flag.Arg(0) == "ctl" {
+		os.Exit(runCtl(cfg, flag.Args()[1:], *jsonOut))
+	}
+	if slices.Contains(daemonActions, flag.Arg(0)) {
+		os.Exit(runCtl(cfg, flag.Args(), *jsonOut))
+	}
+
+	// Handle the share command: print or import a share code.
+	if flag.Arg(0) == "share" {
+		os.Exit(runShare(cfg, *configFile, flag.Args()[1:]))
+	}
+
+	// Handle the identity command: manage the saved Tor identities.
+	if flag.Arg(0) == "identity" {
+		os.Exit(runIdentity(cfg, *configFile, flag.Args()[1:]))
+	}
+
+	// Handle the storage command: report disk usage and clean up.
+	if flag.Arg(0) == "storage" {
+		os.Exit(runStorage(cfg, *logFile, flag.Args()[1:]))
+	}
+
 	// Handle --status: query running instance and exit.
 	if *status {
-		exitCode := queryStatus(cfg)
+		exitCode := queryStatus(cfg, *jsonOut)
 		os.Exit(exitCode)
 	}
 
 	cfg.Verbose = *verboseFlag
+	cfg.Incoming = *incoming
 
 	// Detect platform capabilities.
 	platInfo, _ := platform.Detect()
@@ -115,7 +252,9 @@ func main() {
 			os.Exit(1)
 		}
 		cfg.Accel = string(accel)
-	} else {
+	} else if cfg.Accel == "" {
+		// An accelerator set in the config file, as "torvm config init"
+		// writes it, is kept; an empty one is detected at each start.
 		cfg.Accel = string(platInfo.Accel)
 	}
 
@@ -123,22 +262,89 @@ func main() {
 	cfg.VhostNet = platInfo.VhostNet
 	cfg.IOMMUEnabled = platInfo.IOMMUSupport
 
+	// On macOS, the privileged helper runs the commands that change the
+	// host without a password prompt. On Linux, the network helper makes
+	// network changes without pkexec, so the controller need not run as
+	// root. Set before --doctor, whose privilege check is the run's.
+	if privhelper.Installed() {
+		privexec.Default.SetElevator(privhelper.Client{})
+	}
+	if nethelper.Installed() {
+		privexec.Default.SetElevator(nethelper.Client{})
+	}
+
+	// Handle --doctor: run the preflight checks against the effective
+	// accelerator and exit, non-zero if any failed.
+	if *doctorMode {
+		results := doctor.Run(doctor.Options{
+			Config:      cfg,
+			APISocket:   cfg.APISocket,
+			MetricsAddr: *metricsAddr,
+			QMPSocket:   cfg.QMPSocketPath,
+		})
+		if *jsonOut {
+			doctor.WriteJSON(os.Stdout, results)
+		} else {
+			doctor.Write(os.Stdout, results)
+		}
+		if doctor.Failed(results) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A GUI run by a user rather than root drives the back end (torvm
+	// --backend) if one answers on the control API, and leaves the TAP
+	// device, routes, firewall, and QEMU to it.
+	var backendClient *api.Client
+	if !*headless && !*tuiMode && flag.Arg(0) != "trial" && !platform.Elevated() {
+		backendClient = findBackend(cfg)
+	}
+
+	// From here on the controller drives the TAP device and state disk,
+	// which a second controller must leave alone.
+	var lock *instancelock.Lock
+	if backendClient == nil {
+		lock = lockInstance(cfg, *configFile, *force)
+	}
+	defer lock.Release()
+
+	// Handle the trial command: boot configuration variants and compare
+	// how Tor bootstraps with each.
+	if flag.Arg(0) == "trial" {
+		code := runTrial(cfg, *logFile, flag.Args()[1:])
+		lock.Release()
+		os.Exit(code)
+	}
+
 	logger, err := logging.NewLogger(logging.Options{
-		Verbose: cfg.Verbose,
-		LogFile: *logFile,
+		Verbose:  cfg.Verbose,
+		LogFile:  *logFile,
+		NoStderr: *tuiMode,
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: create logger: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Log every command that changes the host, so the log shows what a
+	// session did to the network and firewall.
+	privexec.Default.SetAudit(func(rec privexec.Record) {
+		logger.Debug("privexec: %s", rec)
+	})
+
 	// If JSON log format requested, add a JSON writer to the logger.
-	if *logFormat == "json" {
-		jw := logging.NewJSONWriter(os.Stderr)
-		logger.AddWriter(jw)
+	var jsonLog *logging.JSONWriter
+	if *logFormat == "json" && !*tuiMode {
+		jsonLog = logging.NewJSONWriter(os.Stderr)
+		logger.AddWriter(jsonLog)
 	}
 
 	logger.Info("TorVM controller starting (accel=%s)", cfg.Accel)
+	if backendClient == nil {
+		prepareDataDirs(cfg, logger)
+		logImagePaths(cfg, logger)
+	}
 
 	// If running as a Windows service, hand off to the SCM handler.
 	if *serviceRun {
@@ -156,8 +362,25 @@ func main() {
 	defer recorder.Stop()
 
 	// engineRef is set once the engine is created (below), so the health
-	// endpoint can report live state.
+	// endpoint can report live state. setEngine sets it and follows the
+	// engine's bootstrap progress.
 	var engineRef *lifecycle.Engine
+	var bootMu sync.Mutex
+	var bootProgress int
+	var bootSummary string
+	setEngine := func(engine *lifecycle.Engine) {
+		engineRef = engine
+		engine.Events.Subscribe(func(ev lifecycle.Event) {
+			bootMu.Lock()
+			defer bootMu.Unlock()
+			switch {
+			case ev.Kind == lifecycle.EventBootstrap:
+				bootProgress, bootSummary = ev.Progress, ev.Summary
+			case ev.Kind == lifecycle.EventState && (ev.To == lifecycle.StateInit || ev.To == lifecycle.StateSaveNetwork):
+				bootProgress, bootSummary = 0, ""
+			}
+		})
+	}
 
 	startTime := time.Now()
 	var lastError string
@@ -167,23 +390,30 @@ func main() {
 			if engineRef == nil {
 				return metrics.HealthStatus{
 					State:   "Init",
-					Version: "0.1.0",
+					Version: controllerVersion,
 				}
 			}
-			bootstrap := 0
-			if engineRef.State() == lifecycle.StateRunning {
+			state := engineRef.State()
+			bootMu.Lock()
+			bootstrap, summary := bootProgress, bootSummary
+			bootMu.Unlock()
+			if state == lifecycle.StateRunning {
 				bootstrap = 100
 			}
 			return metrics.HealthStatus{
-				State:            engineRef.State().String(),
+				State:            state.String(),
 				Bootstrap:        bootstrap,
 				Failsafe:         engineRef.FailSafe.IsActive(),
 				UptimeSeconds:    int(time.Since(startTime).Seconds()),
 				BootstrapPercent: bootstrap,
+				BootstrapSummary: summary,
 				LastError:        lastError,
-				Version:          "0.1.0",
+				Version:          controllerVersion,
 			}
 		}
+		if !metrics.IsLoopback(*metricsAddr) {
+			logger.Info("warning: metrics server address %s is not a loopback address; lifecycle state is visible to other machines", *metricsAddr)
+		}
 		metricsSrv, mErr := metrics.NewServer(*metricsAddr, reg, healthFn)
 		if mErr != nil {
 			fmt.Fprintf(os.Stderr, "error: metrics server: %v\n", mErr)
@@ -195,7 +425,7 @@ func main() {
 	}
 
 	// Handle --clean: remove state disk.
-	if *clean || *replace {
+	if (*clean || *replace) && backendClient == nil {
 		logger.Info("removing state disk: %s", cfg.StateDiskPath)
 		os.Remove(cfg.StateDiskPath)
 	}
@@ -214,6 +444,7 @@ func main() {
 
 		// If running under systemd, attach journal writer and set up notifications.
 		underSystemd := systemd.IsRunningUnderSystemd()
+		var journal *systemd.JournalWriter
 		if underSystemd {
 			jw, jwErr := systemd.NewJournalWriter()
 			if jwErr != nil {
@@ -221,10 +452,34 @@ func main() {
 			} else {
 				logger.AddWriter(jw)
 				defer jw.Close()
+				journal = jw
+				// The journal also records stderr, as timestamped lines
+				// without a priority; keep only the native entries.
+				if systemd.StderrIsJournal() {
+					logger.RemoveWriter(os.Stderr)
+				}
 			}
 			_ = systemd.Status("starting")
 		}
 
+		// Recent log lines for the control API.
+		ring := logging.NewRingWriter(1000)
+		logger.AddWriter(ring)
+
+		engine := lifecycle.NewEngine(cfg, logger)
+		engine.Metrics = recorder
+		setEngine(engine)
+		if jsonLog != nil {
+			// Interleave the engine's events with the log lines.
+			engine.Events.Subscribe(func(ev lifecycle.Event) {
+				jsonLog.WriteEvent(ev.Time, ev)
+			})
+		}
+		stopEvents := func() {}
+		if *eventsJSON {
+			stopEvents = startEventStream(os.Stdout, engine, logger)
+		}
+
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 		go func() {
@@ -233,77 +488,137 @@ func main() {
 			if underSystemd {
 				_ = systemd.Stopping()
 			}
-			cancel()
+			if !*force {
+				awaitStreams(engine, logger, sigCh)
+			}
+			// Before Run has begun there is nothing to stop in order. A
+			// back end ends with its session, or idle.
+			if err := <-engine.StopFor(context.Background(), lifecycle.ShutdownSignal); *backend || errors.Is(err, lifecycle.ErrNotRunning) {
+				cancel()
+			}
 		}()
 
-		engine := lifecycle.NewEngine(cfg, logger)
-		engine.Metrics = recorder
-		engineRef = engine
+		events := openJournal(cfg, engine, logger)
+		if events != nil {
+			defer events.Close()
+		}
+		startAlerts(cfg, engine, logger, events)
+		if sched := startMaintenance(cfg, engine, logger); sched != nil {
+			defer sched.Stop()
+		}
+		defer startRetention(cfg, storageOptions(cfg, *logFile), logger)()
+		sup := startHelpers(cfg, engine, logger)
+		if sup != nil {
+			defer sup.StopAll()
+		}
+		var ctrl controlapi.Controller = headlessControl{engine}
+		var back *backendControl
+		if *backend {
+			back = &backendControl{engine: engine, ctx: ctx, logger: logger}
+			ctrl = back
+		}
+		apiSrv := startAPI(cfg, engine, ctrl, ring, logger)
+		if apiSrv != nil {
+			defer apiSrv.Close()
+		}
+		if grpcSrv := startGRPC(cfg, engine, ctrl, logger); grpcSrv != nil {
+			defer grpcSrv.Close()
+		}
+		if back != nil && apiSrv == nil {
+			logger.Error("--backend needs the control API (api_socket)")
+			os.Exit(1)
+		}
 
 		// Start config file watcher for hot reload.
-		if *configFile != "" {
-			watcher, wErr := config.NewConfigWatcher(*configFile, func(newCfg *config.Config) {
-				diff := config.Diff(engine.Config, newCfg)
-				if !diff.HasChanges() {
-					return
-				}
-				for _, field := range diff.RestartRequired {
-					logger.Info("config watcher: %s changed, restart required", field)
-				}
-				if len(diff.HotReloadable) > 0 {
-					if rErr := engine.ReloadConfig(newCfg); rErr != nil {
-						logger.Error("config watcher: reload failed: %v", rErr)
-					}
-				}
-			})
-			if wErr != nil {
-				logger.Error("config watcher: %v", wErr)
-			} else {
-				defer watcher.Close()
-			}
+		if watcher := watchConfig(*configFile, engine, logger); watcher != nil {
+			defer watcher.Close()
 		}
+		// SIGHUP reloads the config file; SIGUSR1 logs diagnostics.
+		stopSignals := handleControlSignals(*configFile, engine, ring, sup, logger)
+		defer stopSignals()
 
-		// Register systemd state observer for Ready/Status notifications.
+		// Report status and readiness (after Tor bootstraps) to systemd.
 		if underSystemd {
-			watchdogStop := make(chan struct{})
-			engine.OnStateChange(func(from, to lifecycle.State) {
-				switch to {
-				case lifecycle.StateRunning:
-					_ = systemd.Ready()
-					_ = systemd.Status("running - Tor connected")
-					// Start watchdog goroutine (WatchdogSec=60, ping every 25s).
-					go func() {
-						ticker := time.NewTicker(25 * time.Second)
-						defer ticker.Stop()
-						for {
-							select {
-							case <-ticker.C:
-								_ = systemd.Watchdog()
-							case <-watchdogStop:
-								return
-							}
-						}
-					}()
-				case lifecycle.StateShutdown:
-					close(watchdogStop)
-					_ = systemd.Status("shutting down")
-				case lifecycle.StateWaitBootstrap:
-					_ = systemd.Status("waiting for Tor bootstrap")
-				case lifecycle.StateLaunchVM:
-					_ = systemd.Status("launching VM")
-				case lifecycle.StateCreateTAP:
-					_ = systemd.Status("creating TAP adapter")
-				}
-			})
+			stopNotify := notifySystemd(engine, journal, back != nil)
+			defer stopNotify()
 		}
 
-		if err := engine.Run(ctx); err != nil {
+		var err error
+		if back != nil {
+			logger.Info("waiting for the control API to start the VM")
+			back.wait()
+		} else {
+			err = engine.Run(ctx)
+		}
+		stopEvents()
+		// The exit status tells why the session ended; see
+		// ShutdownReason.ExitCode. A back end outlives its sessions,
+		// whose reasons are in the log and the API.
+		reason := engine.ShutdownReason()
+		code := reason.ExitCode()
+		if back != nil {
+			code = 0
+		}
+		if err != nil {
 			lastError = err.Error()
 			logger.Error("lifecycle error: %v", err)
-			os.Exit(1)
+			if code == 0 {
+				code = 1
+			}
+		}
+		if code != 0 {
+			logger.Info("TorVM controller exiting with status %d (%s)", code, reason.Description())
+			os.Exit(code)
 		}
 
 		logger.Info("TorVM controller exiting")
+	} else if *tuiMode {
+		// TUI mode: the terminal UI owns stdout/stderr; logs are shown from
+		// the ring buffer (and still go to --log-file if set).
+		ring := logging.NewRingWriter(1000)
+		logger.AddWriter(ring)
+
+		engine := lifecycle.NewEngine(cfg, logger)
+		engine.Metrics = recorder
+		setEngine(engine)
+
+		events := openJournal(cfg, engine, logger)
+		if events != nil {
+			defer events.Close()
+		}
+		startAlerts(cfg, engine, logger, events)
+		if sched := startMaintenance(cfg, engine, logger); sched != nil {
+			defer sched.Stop()
+		}
+		defer startRetention(cfg, storageOptions(cfg, *logFile), logger)()
+		if sup := startHelpers(cfg, engine, logger); sup != nil {
+			defer sup.StopAll()
+		}
+		if watcher := watchConfig(*configFile, engine, logger); watcher != nil {
+			defer watcher.Close()
+		}
+
+		app := tui.New(engine, logger, ring)
+		app.SetAutoStart(true)
+		if apiSrv := startAPI(cfg, engine, app, ring, logger); apiSrv != nil {
+			defer apiSrv.Close()
+		}
+		if grpcSrv := startGRPC(cfg, engine, app, logger); grpcSrv != nil {
+			defer grpcSrv.Close()
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-sigCh
+			logger.Info("received signal %v, shutting down TUI", sig)
+			app.RequestShutdown()
+		}()
+
+		if err := app.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: tui: %v\n", err)
+			os.Exit(1)
+		}
 	} else {
 		// GUI mode: Fyne event loop on main thread, lifecycle in goroutine.
 		ring := logging.NewRingWriter(1000)
@@ -311,37 +626,55 @@ func main() {
 
 		engine := lifecycle.NewEngine(cfg, logger)
 		engine.Metrics = recorder
-		engineRef = engine
+		setEngine(engine)
+
+		events := openJournal(cfg, engine, logger)
+		if events != nil {
+			defer events.Close()
+		}
+		startAlerts(cfg, engine, logger, events)
+		if sched := startMaintenance(cfg, engine, logger); sched != nil {
+			defer sched.Stop()
+		}
+		if backendClient == nil {
+			// The back end's files are its own to clean.
+			defer startRetention(cfg, storageOptions(cfg, *logFile), logger)()
+		}
+		if sup := startHelpers(cfg, engine, logger); sup != nil {
+			defer sup.StopAll()
+		}
 
 		// Start config file watcher for hot reload in GUI mode.
-		if *configFile != "" {
-			watcher, wErr := config.NewConfigWatcher(*configFile, func(newCfg *config.Config) {
-				diff := config.Diff(engine.Config, newCfg)
-				if !diff.HasChanges() {
-					return
-				}
-				for _, field := range diff.RestartRequired {
-					logger.Info("config watcher: %s changed, restart required", field)
-				}
-				if len(diff.HotReloadable) > 0 {
-					if rErr := engine.ReloadConfig(newCfg); rErr != nil {
-						logger.Error("config watcher: reload failed: %v", rErr)
-					}
-				}
-			})
-			if wErr != nil {
-				logger.Error("config watcher: %v", wErr)
-			} else {
-				defer watcher.Close()
-			}
+		if watcher := watchConfig(*configFile, engine, logger); watcher != nil {
+			defer watcher.Close()
 		}
 
 		app := gui.New(cfg, engine, logger, ring, *configFile)
+		app.SetVersion(controllerVersion)
+		app.SetJournal(events)
+		app.SetStorage(storageOptions(cfg, *logFile))
+		if backendClient != nil {
+			// The back end serves the API.
+			logger.Info("driving the back end on %s", cfg.APISocket)
+			app.SetBackend(backendClient)
+		} else {
+			if apiSrv := startAPI(cfg, engine, app, ring, logger); apiSrv != nil {
+				defer apiSrv.Close()
+			}
+			if grpcSrv := startGRPC(cfg, engine, app, logger); grpcSrv != nil {
+				defer grpcSrv.Close()
+			}
+		}
 
 		// Set up browser VM engine if enabled.
 		if cfg.Browser.Enabled {
 			browserEngine := lifecycle.NewBrowserEngine(cfg, logger, engine)
 			app.SetBrowserEngine(browserEngine)
+			if events != nil {
+				browserEngine.SecMonitor.OnEvent(func(ev secwatch.SecurityEvent) {
+					events.Record(journal.KindSecurity, "%s (%s): %s", ev.Type, ev.Severity, ev.Detail)
+				})
+			}
 
 			// Auto-start browser when Tor reaches Running.
 			if cfg.Browser.AutoStart {
@@ -370,16 +703,170 @@ func main() {
 	}
 }
 
-// queryStatus connects to a running TorVM instance and prints its status.
-// Returns 0 if running, 1 if not running or error.
-func queryStatus(cfg *config.Config) int {
-	vmAddr := fmt.Sprintf("%s:%d", cfg.VMIP, cfg.ControlPort)
+// watchConfig starts a config file watcher that hot-reloads what it can
+// and logs fields that need a restart. It returns nil if path is empty or
+// the watcher could not be started.
+func watchConfig(path string, engine *lifecycle.Engine, logger *logging.Logger) *config.ConfigWatcher {
+	if path == "" {
+		return nil
+	}
+	watcher, err := config.NewConfigWatcher(path, func(newCfg *config.Config) {
+		applyConfig("config watcher", engine, newCfg, logger)
+	})
+	if err != nil {
+		logger.Error("config watcher: %v", err)
+		return nil
+	}
+	return watcher
+}
+
+// purgeFlags defines the purge-host-artifacts command's flags. It is
+// shared with the completion and man page generators.
+func purgeFlags() (fs *flag.FlagSet, dryRun *bool) {
+	fs = flag.NewFlagSet("purge-host-artifacts", flag.ContinueOnError)
+	dryRun = fs.Bool("dry-run", false, "print the commands that would remove the artifacts, and run none")
+	return fs, dryRun
+}
+
+// purgeHostArtifacts removes TAP devices, routes, and firewall rules tagged
+// with this instance's label. If a crashed session left a record, its VM
+// is stopped if it still runs and its saved network configuration is
+// restored too. With --dry-run it prints the commands instead and changes
+// nothing. Returns 0 on success, 1 on error, 2 on a usage error.
+func purgeHostArtifacts(cfg *config.Config, args []string) int {
+	fs, dryRun := purgeFlags()
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	label := network.InstanceLabel(cfg.Instance)
+	stateDir := network.DefaultStateDir()
+	netMgr := network.NewManager(label, stateDir)
+
+	session := &network.Session{TAPName: cfg.TAPName, VMIP: cfg.VMIP}
+	store, err := network.NewSessionStore(stateDir, label)
+	if err == nil {
+		var prev *network.Session
+		if prev, err = store.Load(); prev != nil {
+			if prev.Alive() {
+				fmt.Fprintf(os.Stderr, "error: instance %q is running (pid %d); stop it first\n", cfg.Instance, prev.PID)
+				return 1
+			}
+			session = prev
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; saved network configuration not restored\n", err)
+	}
+
+	if *dryRun {
+		return purgeDryRun(netMgr, session, label)
+	}
+	if session.QEMUPID > 0 {
+		stopOrphanVM(cfg, session)
+	}
+
+	removed, err := network.Recover(netMgr, session, false)
+	for _, item := range removed {
+		fmt.Printf("removed %s\n", item)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: purge host artifacts: %v\n", err)
+		return 1
+	}
+	if store != nil {
+		if err := store.Clear(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	}
+	if len(removed) == 0 {
+		fmt.Printf("No host artifacts found for %s.\n", label)
+	}
+	return 0
+}
+
+// purgeDryRun prints what purgeHostArtifacts would remove and the
+// commands it would run. The firewall and route queries still run; the
+// crashed session's VM and saved configuration are only reported.
+func purgeDryRun(netMgr network.Manager, session *network.Session, label string) int {
+	privexec.Default.SetDryRun(true)
+	defer privexec.Default.SetDryRun(false)
+	privexec.Default.SetAudit(func(rec privexec.Record) {
+		fmt.Printf("would run: %s\n", rec.Op)
+	})
+	defer privexec.Default.SetAudit(nil)
+
+	if session.QEMUPID > 0 {
+		fmt.Printf("would stop the VM of the crashed session (pid %d)\n", session.QEMUPID)
+	}
+	saved := session.Saved
+	session.Saved = nil
+	removed, err := network.Recover(netMgr, session, false)
+	for _, item := range removed {
+		fmt.Printf("would remove %s\n", item)
+	}
+	if saved != nil {
+		fmt.Printf("would restore the network configuration saved %s\n", session.Started.Format(time.RFC3339))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: purge host artifacts: %v\n", err)
+		return 1
+	}
+	if len(removed) == 0 && saved == nil && session.QEMUPID == 0 {
+		fmt.Printf("No host artifacts found for %s.\n", label)
+	}
+	return 0
+}
+
+// stopOrphanVM stops the VM of a crashed session if it is still
+// running; it would keep the TAP device and the state disk in use.
+func stopOrphanVM(cfg *config.Config, s *network.Session) {
+	logger, err := logging.NewLogger(logging.Options{NoStderr: true})
+	if err != nil {
+		return
+	}
+	inst := vm.NewInstance(cfg, logger)
+	if err := inst.Attach(s.QEMUPID, s.QMPPath); err != nil {
+		return // not running
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := inst.Stop(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: stop VM (pid %d): %v\n", s.QEMUPID, err)
+		return
+	}
+	fmt.Printf("stopped VM (pid %d)\n", s.QEMUPID)
+}
+
+// vmStatus is what queryStatus found out, as printed by --status --json.
+type vmStatus struct {
+	State     string `json:"state"` // "running" or "stopped"
+	SOCKSPort int    `json:"socks_port"`
+	Bootstrap *int   `json:"bootstrap,omitempty"` // nil if Tor could not be asked
+	Summary   string `json:"summary,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// queryStatus connects to a running TorVM instance and prints its status,
+// as JSON if asJSON is set. Returns 0 if running, 1 if not running or
+// error.
+func queryStatus(cfg *config.Config, asJSON bool) int {
+	st := vmStatus{State: "running", SOCKSPort: cfg.SOCKSPort}
+	defer func() {
+		if asJSON {
+			json.NewEncoder(os.Stdout).Encode(st)
+		}
+	}()
+	vmAddr := net.JoinHostPort(cfg.VMIP, strconv.Itoa(cfg.ControlPort))
 
 	// Check if VM control port is reachable.
 	conn, err := net.DialTimeout("tcp", vmAddr, 3*time.Second)
 	if err != nil {
-		fmt.Println("TorVM Status: Stopped")
-		fmt.Printf("  (could not reach %s)\n", vmAddr)
+		st.State, st.Error = "stopped", fmt.Sprintf("could not reach %s", vmAddr)
+		if !asJSON {
+			fmt.Println("TorVM Status: Stopped")
+			fmt.Printf("  (%s)\n", st.Error)
+		}
 		return 1
 	}
 	if tc, ok := conn.(*net.TCPConn); ok {
@@ -387,21 +874,47 @@ func queryStatus(cfg *config.Config) int {
 	}
 	conn.Close()
 
-	fmt.Println("TorVM Status: Running")
-	fmt.Printf("  SOCKS Port: %d\n", cfg.SOCKSPort)
+	if !asJSON {
+		fmt.Println("TorVM Status: Running")
+		fmt.Printf("  SOCKS Port: %d\n", cfg.SOCKSPort)
+	}
 
 	// Try to get bootstrap status via Tor Control.
-	ctrlAddr := fmt.Sprintf("%s:%d", cfg.VMIP, cfg.ControlPort)
+	ctrlAddr := net.JoinHostPort(cfg.VMIP, strconv.Itoa(cfg.ControlPort))
 	client, err := tor.NewControlClient(ctrlAddr, 5*time.Second)
 	if err == nil {
 		defer client.Close()
 		if err := client.Authenticate(""); err == nil {
 			status, err := client.GetBootstrapStatus()
 			if err == nil {
-				fmt.Printf("  Bootstrap: %d%% - %s\n", status.Progress, status.Summary)
+				st.Bootstrap, st.Summary = &status.Progress, status.Summary
+				if !asJSON {
+					fmt.Printf("  Bootstrap: %d%% - %s\n", status.Progress, status.Summary)
+				}
 			}
 		}
 	}
 
 	return 0
 }
+
+// printVersion prints the controller version. With full or asJSON set it
+// adds what a support request needs (see package about), reading the
+// guest images and QEMU named by the config file at configPath.
+func printVersion(configPath string, full, asJSON bool) {
+	if !full && !asJSON {
+		fmt.Println("torvm version " + controllerVersion)
+		return
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: load config: %v; showing the default images and features\n", err)
+		cfg = config.DefaultConfig()
+	}
+	info := about.Collect(cfg, controllerVersion)
+	if asJSON {
+		json.NewEncoder(os.Stdout).Encode(info)
+		return
+	}
+	about.WriteText(os.Stdout, info)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/maintenance"
+	"github.com/user/extorvm/controller/internal/update"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// startMaintenance starts the maintenance scheduler if enabled. The
+// returned scheduler (nil when disabled) must be stopped by the caller.
+func startMaintenance(cfg *config.Config, engine *lifecycle.Engine, logger *logging.Logger) *maintenance.Scheduler {
+	mc := cfg.Maintenance
+	if !mc.Enabled {
+		return nil
+	}
+	window, err := maintenance.ParseWindow(mc.Window, mc.Days)
+	if err != nil {
+		logger.Error("maintenance: %v", err)
+		return nil
+	}
+
+	sched := maintenance.NewScheduler(window, engine.ActiveStreams, logger)
+	if mc.UpdateCheck {
+		checker := update.NewChecker(update.DefaultOwner, update.DefaultRepo, logger)
+		sched.AddTask("update check", func() error {
+			if info := checker.CheckNow(); !info.Available {
+				logger.Info("maintenance: no update available")
+			}
+			return nil
+		})
+	}
+	if mc.RotateLogs {
+		sched.AddTask("log rotation", logger.Rotate)
+	}
+	if mc.RestartVM {
+		var stopped []maintenance.Task
+		if mc.FsckStateDisk {
+			stopped = append(stopped, maintenance.Task{
+				Name: "state disk check",
+				Run:  func() error { return vm.CheckStateDisk(cfg.StateDiskPath) },
+			})
+		}
+		sched.SetRestart(engine.RequestVMRestart, stopped...)
+	} else if mc.FsckStateDisk {
+		logger.Info("maintenance: fsck_state_disk requires restart_vm; state disk check disabled")
+	}
+
+	sched.Start()
+	logger.Info("maintenance scheduled in window %s", mc.Window)
+	return sched
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runMan implements the "man" command.
+func runMan() int {
+	if err := writeManPage(os.Stdout, flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// manEscape escapes s for troff body text.
+func manEscape(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func writeManFlags(w io.Writer, flags []cliFlag) {
+	for _, f := range flags {
+		fmt.Fprintln(w, ".TP")
+		if f.Arg == "" {
+			fmt.Fprintf(w, ".B \\-\\-%s\n", manEscape(f.Name))
+		} else {
+			fmt.Fprintf(w, ".BI \\-\\-%s \" \" %s\n", manEscape(f.Name), manEscape(f.Arg))
+		}
+		usage := f.Usage
+		if f.Default != "" {
+			usage += fmt.Sprintf(" (default %s)", f.Default)
+		}
+		fmt.Fprintln(w, manEscape(usage))
+	}
+}
+
+// writeManPage writes the torvm(1) man page, generated from the global
+// flags in global and the commands table.
+func writeManPage(w io.Writer, global *flag.FlagSet) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, `.TH TORVM 1 "" "torvm" "User Commands"
+.SH NAME
+torvm \- route all host traffic through Tor via a lightweight VM
+.SH SYNOPSIS
+.B torvm
+.RI [ flags ]
+.br
+.B torvm
+.RI [ flags ] " command " [ args ]
+.SH DESCRIPTION
+.B torvm
+launches a minimal Linux VM running Tor, points the host's default route
+at it through a TAP adapter, and restores the original network
+configuration on exit. Without
+.B \-\-headless
+or
+.B \-\-tui
+it opens the graphical interface.
+.SH OPTIONS
+`)
+	writeManFlags(bw, visibleFlags(global))
+
+	fmt.Fprintln(bw, ".SH COMMANDS")
+	for _, c := range commands {
+		fmt.Fprintln(bw, ".TP")
+		if c.Args == "" {
+			fmt.Fprintf(bw, ".B %s\n", manEscape(c.Name))
+		} else {
+			fmt.Fprintf(bw, ".BR %s \" %s\"\n", manEscape(c.Name), manEscape(c.Args))
+		}
+		fmt.Fprintln(bw, manEscape(c.Summary)+".")
+		if flags := commandFlags(c); len(flags) > 0 {
+			fmt.Fprintln(bw, ".RS")
+			writeManFlags(bw, flags)
+			fmt.Fprintln(bw, ".RE")
+		}
+	}
+
+	fmt.Fprint(bw, `.SH EXAMPLES
+Run without a GUI, waiting for open Tor connections on shutdown:
+.PP
+.RS
+sudo torvm \-\-headless
+.RE
+.PP
+Install bash completion:
+.PP
+.RS
+torvm completion bash > /etc/bash_completion.d/torvm
+.RE
+.SH SEE ALSO
+.BR tor (1),
+.BR qemu\-system\-x86_64 (1)
+`)
+	return bw.Flush()
+}
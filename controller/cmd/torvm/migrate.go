@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// migrateFlags defines the "migrate" command's flags. It is shared with
+// the completion and man page generators.
+func migrateFlags() (fs *flag.FlagSet, to, tlsDir *string) {
+	fs = flag.NewFlagSet("migrate", flag.ContinueOnError)
+	to = fs.String("to", "", "host:port of the destination started with --incoming")
+	tlsDir = fs.String("tls-dir", "", "directory with ca-cert.pem, client-cert.pem and client-key.pem (default: migration.tls_dir from the config)")
+	return fs, to, tlsDir
+}
+
+// runMigrate implements the "migrate" command: it live-migrates the
+// running VM to another host over QMP, then quits the local QEMU so the
+// running controller restores the host network and exits. Returns the
+// process exit code.
+func runMigrate(cfg *config.Config, args []string) int {
+	fs, to, tlsDir := migrateFlags()
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *to == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: torvm migrate --to host:port [--tls-dir DIR]")
+		return 2
+	}
+	if *tlsDir == "" {
+		*tlsDir = cfg.Migration.TLSDir
+	}
+
+	qmp, err := vm.NewQMPClient(cfg.QMPSocketPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v (is the VM running?)\n", err)
+		return 1
+	}
+	defer qmp.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = qmp.MigrateOut(ctx, *to, *tlsDir, func(info vm.MigrationInfo) {
+		if info.RAM.Total > 0 {
+			fmt.Printf("migration %s: %s of %s transferred, %s remaining\n",
+				info.Status, mib(info.RAM.Transferred), mib(info.RAM.Total), mib(info.RAM.Remaining))
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("VM now running on %s; stopping the local copy\n", *to)
+	if err := qmp.Quit(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: quit local VM: %v\n", err)
+		return 1
+	}
+	return 0
+}
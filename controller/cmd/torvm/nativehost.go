@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/nativehost"
+)
+
+// nativeHostFlags defines the "native-host install|uninstall" flags. It is
+// shared with the completion and man page generators.
+func nativeHostFlags() (fs *flag.FlagSet, browser, extensionID *string) {
+	fs = flag.NewFlagSet("native-host", flag.ContinueOnError)
+	browser = fs.String("browser", "firefox", "browser to register with: chrome, chromium, firefox")
+	extensionID = fs.String("extension-id", "", "ID of the extension allowed to use the host (install only)")
+	return fs, browser, extensionID
+}
+
+// runNativeHost implements the "native-host" command. With "install" or
+// "uninstall" it registers the host with a browser for the current user;
+// otherwise it is the host itself, started by the browser with
+// native messaging on stdin and stdout. Returns the process exit code.
+func runNativeHost(cfg *config.Config, configFile string, args []string) int {
+	if len(args) > 0 && (args[0] == "install" || args[0] == "uninstall") {
+		return nativeHostInstall(configFile, args[0], args[1:])
+	}
+
+	// Any other arguments come from the browser (the extension's origin,
+	// or the manifest path and add-on ID) and are not needed.
+	if cfg.APISocket == "" {
+		fmt.Fprintln(os.Stderr, "error: the control API is disabled (api_socket is empty)")
+		return 1
+	}
+	host := nativehost.New(api.NewClient(cfg.APISocket))
+	if err := host.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func nativeHostInstall(configFile, action string, args []string) int {
+	fs, browser, extensionID := nativeHostFlags()
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 || (action == "install" && *extensionID == "") {
+		fmt.Fprintln(os.Stderr, "usage: torvm native-host install --extension-id ID [--browser B]\n       torvm native-host uninstall [--browser B]")
+		return 2
+	}
+
+	if action == "uninstall" {
+		if err := nativehost.Uninstall(*browser); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Native messaging host removed from %s.\n", *browser)
+		return 0
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	command := []string{exe}
+	if configFile != "" {
+		abs, err := filepath.Abs(configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		command = append(command, "--config", abs)
+	}
+	command = append(command, "native-host")
+
+	path, err := nativehost.Install(*browser, *extensionID, command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Native messaging host installed for %s: %s\n", *browser, path)
+	return 0
+}
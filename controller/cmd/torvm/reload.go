@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// applyConfig hands newCfg to the engine, which applies what it can while
+// running, keeps the rest for the next VM start, and logs which is which,
+// and which changes need TorVM restarted. source prefixes the log lines,
+// e.g. "config watcher".
+func applyConfig(source string, engine *lifecycle.Engine, newCfg *config.Config, logger *logging.Logger) {
+	keepRuntimeSettings(newCfg, engine.Config)
+	diff, err := engine.ReloadConfig(newCfg)
+	if err != nil {
+		logger.Error("%s: reload failed: %v", source, err)
+		return
+	}
+	if !diff.HasChanges() {
+		logger.Debug("%s: no changes", source)
+	}
+}
+
+// keepRuntimeSettings copies to a freshly loaded config the settings that
+// main takes from flags and host detection rather than the file, so a
+// reload does not undo them.
+func keepRuntimeSettings(newCfg, cur *config.Config) {
+	newCfg.Accel = cur.Accel
+	newCfg.Verbose = cur.Verbose
+	newCfg.VhostNet = cur.VhostNet
+	newCfg.IOMMUEnabled = cur.IOMMUEnabled
+	newCfg.Incoming = cur.Incoming
+}
+
+// reloadConfigFile re-reads the config file at path and applies it, as on
+// SIGHUP. A file that no longer loads is reported and the running
+// configuration kept.
+func reloadConfigFile(path string, engine *lifecycle.Engine, logger *logging.Logger) {
+	if path == "" {
+		logger.Info("reload: no --config file to reload")
+		return
+	}
+	newCfg, err := config.Load(path)
+	if err != nil {
+		logger.Error("reload: %v; keeping the running configuration", err)
+		return
+	}
+	logger.Info("reload: re-read %s", path)
+	applyConfig("reload", engine, newCfg, logger)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func TestReloadConfigFile(t *testing.T) {
+	logger, buf := testutil.NewTestLogger()
+	cfg := config.DefaultConfig()
+	cfg.Accel = "kvm" // detected, not from the file
+	engine := lifecycle.NewEngine(cfg, logger)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"vm_memory_mb": 512, "bridge": {"use_bridges": true, "bridges": ["192.0.2.1:443 0123456789ABCDEF0123456789ABCDEF01234567"]}}`), 0600)
+	reloadConfigFile(path, engine, logger)
+	if engine.Config.VMMemoryMB != 512 || !engine.Config.Bridge.UseBridges {
+		t.Errorf("config not reloaded: memory %d, bridges %t", engine.Config.VMMemoryMB, engine.Config.Bridge.UseBridges)
+	}
+	if engine.Config.Accel != "kvm" {
+		t.Errorf("Accel = %q after reload, want the detected kvm", engine.Config.Accel)
+	}
+	if !strings.Contains(buf.String(), "VMMemoryMB") || !strings.Contains(buf.String(), "restart") {
+		t.Errorf("log does not say the memory change waits for a restart:\n%s", buf.String())
+	}
+
+	os.WriteFile(path, []byte(`{"vm_memory_mb": `), 0600)
+	reloadConfigFile(path, engine, logger)
+	if engine.Config.VMMemoryMB != 512 {
+		t.Errorf("a broken file replaced the config")
+	}
+	if !strings.Contains(buf.String(), "keeping the running configuration") {
+		t.Errorf("log does not report the broken file:\n%s", buf.String())
+	}
+}
+
+func TestLogDiagnostics(t *testing.T) {
+	logger, buf := testutil.NewTestLogger()
+	ring := logging.NewRingWriter(10)
+	logger.AddWriter(ring)
+	cfg := config.DefaultConfig()
+	cfg.Proxy = config.ProxyConfig{Type: "socks5", Address: "192.0.2.9:1080", Username: "u", Password: "hunter2"}
+	engine := lifecycle.NewEngine(cfg, logger)
+	logger.Info("bootstrap stalled at 45%%")
+
+	logDiagnostics(engine, ring, nil, logger)
+	out := buf.String()
+	for _, want := range []string{"state Init", `"socks_port"`, "diagnostics: | ", "bootstrap stalled at 45%", "diagnostics: end"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("diagnostics lack %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "hunter2") {
+		t.Errorf("diagnostics contain the proxy password:\n%s", out)
+	}
+}
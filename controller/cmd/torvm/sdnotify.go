@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/systemd"
+)
+
+// startupGrace is how much longer each startup step asks systemd to wait
+// for READY=1. Tor's bootstrap reports progress far more often.
+const startupGrace = 90 * time.Second
+
+// notifySystemd reports the session to systemd as a Type=notify service:
+// STATUS= with each state and Tor's bootstrap progress, READY=1 once Tor
+// has bootstrapped and the session runs, and watchdog pings from then on.
+// With readyNow, as for a --backend controller whose VM starts later if
+// at all, READY=1 and the pings start at once instead. journal, if not
+// nil, tags each later log entry with TORVM_STATE, and with
+// TORVM_SHUTDOWN_REASON once the session shuts down. The returned func
+// stops the notifications.
+func notifySystemd(engine *lifecycle.Engine, journal *systemd.JournalWriter, readyNow bool) (stop func()) {
+	var ready atomic.Bool
+	var once sync.Once
+	done := make(chan struct{})
+	markReady := func() {
+		once.Do(func() {
+			ready.Store(true)
+			_ = systemd.Ready()
+			if interval, ok := systemd.WatchdogInterval(); ok {
+				go pingWatchdog(interval, done)
+			}
+		})
+	}
+	if readyNow {
+		markReady()
+	}
+
+	unsubscribe := engine.Events.Subscribe(func(ev lifecycle.Event) {
+		if ev.Kind == lifecycle.EventState && journal != nil {
+			journal.SetField("TORVM_STATE", ev.To.String())
+			if ev.Reason != lifecycle.ShutdownNone {
+				journal.SetField("TORVM_SHUTDOWN_REASON", ev.Reason.String())
+			}
+		}
+		if status := systemdStatus(ev); status != "" {
+			_ = systemd.Status(status)
+		}
+		if ev.Kind == lifecycle.EventState && ev.To == lifecycle.StateRunning {
+			markReady()
+			return
+		}
+		if ev.Step != nil && !ready.Load() {
+			_ = systemd.ExtendTimeout(startupGrace)
+		}
+	})
+	return func() {
+		unsubscribe()
+		close(done)
+	}
+}
+
+func pingWatchdog(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = systemd.Watchdog()
+		case <-done:
+			return
+		}
+	}
+}
+
+// systemdStatus returns the STATUS= text "systemctl status" shows after
+// ev, or "" if ev does not change it.
+func systemdStatus(ev lifecycle.Event) string {
+	switch ev.Kind {
+	case lifecycle.EventBootstrap:
+		if ev.Summary == "" {
+			return fmt.Sprintf("Connecting to Tor: %d%%", ev.Progress)
+		}
+		return fmt.Sprintf("Connecting to Tor: %d%% - %s", ev.Progress, ev.Summary)
+	case lifecycle.EventRetry:
+		if ev.Step != nil {
+			return fmt.Sprintf("%s (retry %d)", ev.Step.Description, ev.Step.Retries)
+		}
+	case lifecycle.EventState:
+		if ev.Step != nil {
+			return ev.Step.Description
+		}
+		switch ev.To {
+		case lifecycle.StateRunning:
+			return "Running - Tor connected"
+		case lifecycle.StatePaused:
+			return "Paused"
+		case lifecycle.StateShutdown:
+			if ev.Reason != lifecycle.ShutdownNone {
+				return "Shutting down: " + ev.Reason.Description()
+			}
+			return "Shutting down"
+		case lifecycle.StateRestoreNetwork:
+			return "Restoring the host network"
+		case lifecycle.StateCleanup:
+			return "Cleaning up"
+		case lifecycle.StateFailed:
+			return "Failed"
+		}
+	}
+	return ""
+}
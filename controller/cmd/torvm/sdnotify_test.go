@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func TestSystemdStatus(t *testing.T) {
+	for _, tt := range []struct {
+		ev   lifecycle.Event
+		want string
+	}{
+		{lifecycle.Event{Kind: lifecycle.EventBootstrap, Progress: 45, Summary: "Loading relay descriptors"}, "Connecting to Tor: 45% - Loading relay descriptors"},
+		{lifecycle.Event{Kind: lifecycle.EventState, To: lifecycle.StateCreateTAP, Step: &lifecycle.StepProgress{Description: "Creating the TAP device"}}, "Creating the TAP device"},
+		{lifecycle.Event{Kind: lifecycle.EventRetry, To: lifecycle.StateCreateTAP, Step: &lifecycle.StepProgress{Description: "Creating the TAP device", Retries: 2}}, "Creating the TAP device (retry 2)"},
+		{lifecycle.Event{Kind: lifecycle.EventState, To: lifecycle.StateRunning}, "Running - Tor connected"},
+		{lifecycle.Event{Kind: lifecycle.EventState, To: lifecycle.StateShutdown}, "Shutting down"},
+		{lifecycle.Event{Kind: lifecycle.EventState, To: lifecycle.StateShutdown, Reason: lifecycle.ShutdownVMCrash}, "Shutting down: the VM crashed"},
+		{lifecycle.Event{Kind: lifecycle.EventFailsafe, Active: true}, ""},
+	} {
+		if got := systemdStatus(tt.ev); got != tt.want {
+			t.Errorf("systemdStatus(%v) = %q, want %q", tt.ev.Kind, got, tt.want)
+		}
+	}
+}
+
+func TestNotifySystemdReadyAfterBootstrap(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sd_notify is Linux only")
+	}
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	srv, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	logger, _ := testutil.NewTestLogger()
+	engine := lifecycle.NewEngine(config.DefaultConfig(), logger)
+	stop := notifySystemd(engine, nil, false)
+	defer stop()
+
+	engine.Events.Publish(lifecycle.Event{Kind: lifecycle.EventState, To: lifecycle.StateWaitBootstrap,
+		Step: &lifecycle.StepProgress{Description: "Connecting to Tor"}})
+	engine.Events.Publish(lifecycle.Event{Kind: lifecycle.EventBootstrap, Progress: 80})
+	engine.Events.Publish(lifecycle.Event{Kind: lifecycle.EventState, To: lifecycle.StateRunning})
+
+	var msgs []string
+	buf := make([]byte, 1024)
+	srv.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		n, err := srv.Read(buf)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, string(buf[:n]))
+		srv.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	}
+	got := strings.Join(msgs, "|")
+	want := "STATUS=Connecting to Tor|EXTEND_TIMEOUT_USEC=90000000|STATUS=Connecting to Tor: 80%|STATUS=Running - Tor connected|READY=1"
+	if got != want {
+		t.Errorf("notifications = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/qr"
+)
+
+// shareFlags defines the "share" command's flags. It is shared with the
+// completion and man page generators.
+func shareFlags() (fs *flag.FlagSet, showQR *bool) {
+	fs = flag.NewFlagSet("share", flag.ContinueOnError)
+	showQR = fs.Bool("qr", false, "also print the code as a QR code")
+	return fs, showQR
+}
+
+// runShare implements the "share" command: it prints the bridge,
+// transport, and proxy settings as a share code, or imports a share code
+// into the config file. Returns the process exit code.
+func runShare(cfg *config.Config, configFile string, args []string) int {
+	if len(args) > 0 && args[0] == "import" {
+		return shareImport(cfg, configFile, args[1:])
+	}
+	fs, showQR := shareFlags()
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: torvm share [--qr] | torvm share import CODE")
+		return 2
+	}
+	code, err := cfg.Share().Encode()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if *showQR {
+		c, err := qr.Encode([]byte(code), qr.Low)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		fmt.Print(c)
+	}
+	fmt.Println(code)
+	return 0
+}
+
+// shareImport replaces the settings in the config file with those of a
+// share code. The code may be split across several arguments.
+func shareImport(cfg *config.Config, configFile string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: torvm share import CODE")
+		return 2
+	}
+	if configFile == "" {
+		fmt.Fprintln(os.Stderr, "error: share import needs --config to know which file to update")
+		return 2
+	}
+	var code string
+	for _, a := range args {
+		code += a
+	}
+	s, err := config.ParseShare(code)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	cfg.ApplyShare(s)
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	data, err := config.Marshal(cfg, config.FormatOf(configFile))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(configFile, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Imported %d bridge(s), transport %q", len(s.Bridges), s.Transport)
+	if s.ProxyType != "" {
+		fmt.Printf(", %s proxy %s", s.ProxyType, s.ProxyAddr)
+	}
+	fmt.Printf(" into %s\n", configFile)
+	return 0
+}
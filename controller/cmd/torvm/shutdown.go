@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// streamDrainTimeout bounds how long a headless stop waits for open Tor
+// streams, staying well inside systemd's default 90s stop timeout.
+const streamDrainTimeout = 30 * time.Second
+
+// awaitStreams delays a headless shutdown while Tor streams are open. It
+// returns once the streams have closed, another signal arrives, or
+// streamDrainTimeout passes.
+func awaitStreams(engine *lifecycle.Engine, logger *logging.Logger, sigCh <-chan os.Signal) {
+	n, err := engine.ActiveStreams()
+	if err != nil || n == 0 {
+		return
+	}
+	logger.Info("%d active connection(s) will be terminated; waiting up to %v for them to close "+
+		"(signal again or run with --force to stop immediately)", n, streamDrainTimeout)
+
+	deadline := time.NewTimer(streamDrainTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case sig := <-sigCh:
+			logger.Info("received signal %v again, stopping now", sig)
+			return
+		case <-deadline.C:
+			logger.Info("connections still open after %v, stopping", streamDrainTimeout)
+			return
+		case <-ticker.C:
+			if n, err := engine.ActiveStreams(); err != nil || n == 0 {
+				return
+			}
+		}
+	}
+}
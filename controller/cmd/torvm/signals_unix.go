@@ -0,0 +1,41 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/supervisor"
+)
+
+// handleControlSignals reloads the config file at configPath on SIGHUP
+// and logs a diagnostics snapshot on SIGUSR1, until the returned stop is
+// called. ring and sup may be nil.
+func handleControlSignals(configPath string, engine *lifecycle.Engine, ring *logging.RingWriter, sup *supervisor.Supervisor, logger *logging.Logger) (stop func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGUSR1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				if sig == syscall.SIGHUP {
+					logger.Info("received SIGHUP, reloading the config file")
+					reloadConfigFile(configPath, engine, logger)
+				} else {
+					logDiagnostics(engine, ring, sup, logger)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
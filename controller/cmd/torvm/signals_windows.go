@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import (
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/supervisor"
+)
+
+// handleControlSignals does nothing on Windows, which has no SIGHUP or
+// SIGUSR1. The config file watcher reloads the config there, and the
+// control API serves the state, config, and logs.
+func handleControlSignals(configPath string, engine *lifecycle.Engine, ring *logging.RingWriter, sup *supervisor.Supervisor, logger *logging.Logger) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/launchd"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/privhelper"
+	"github.com/user/extorvm/controller/internal/storage"
+)
+
+// storageOptions says where this controller keeps its files, given the
+// --log-file path.
+func storageOptions(cfg *config.Config, logFile string) storage.Options {
+	opts := storage.Options{
+		StateDisks: []string{cfg.StateDiskPath},
+		Logs:       []string{logFile, cfg.Journal.Path},
+	}
+	if cfg.Browser.Enabled {
+		opts.StateDisks = append(opts.StateDisks, cfg.Browser.StateDiskPath)
+	}
+	if runtime.GOOS == "darwin" {
+		// Written by launchd for the controller and the helper.
+		opts.Logs = append(opts.Logs, launchd.LogPath(), privhelper.LogPath)
+	}
+	return opts
+}
+
+// storagePolicy returns the retention rules of the config.
+func storagePolicy(cfg *config.Config) storage.Policy {
+	const day = 24 * time.Hour
+	return storage.Policy{
+		LeftoverAge: time.Duration(cfg.Storage.LeftoverDays) * day,
+		LogAge:      time.Duration(cfg.Storage.LogDays) * day,
+	}
+}
+
+// startRetention enforces the storage retention rules now and every
+// check_hours until the returned stop function is called.
+func startRetention(cfg *config.Config, opts storage.Options, logger *logging.Logger) (stop func()) {
+	policy := storagePolicy(cfg)
+	if policy.LeftoverAge == 0 && policy.LogAge == 0 {
+		return func() {}
+	}
+	enforce := func() {
+		freed, err := storage.Enforce(opts, policy, time.Now())
+		if err != nil {
+			logger.Error("storage: %v", err)
+		}
+		if freed > 0 {
+			logger.Info("storage: retention rules freed %s", storage.FormatSize(freed))
+		}
+	}
+	ticker := time.NewTicker(time.Duration(cfg.Storage.CheckHours) * time.Hour)
+	done := make(chan struct{})
+	go func() {
+		enforce()
+		for {
+			select {
+			case <-ticker.C:
+				enforce()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+func storageFlags() (fs *flag.FlagSet, clean *bool) {
+	fs = flag.NewFlagSet("storage", flag.ContinueOnError)
+	clean = fs.Bool("clean", false, "remove the reclaimable items: rotated logs and leftovers of interrupted work")
+	return fs, clean
+}
+
+// runStorage implements the "storage" command: it lists the space used
+// by state disks, logs, and leftovers, and with --clean removes what can
+// be reclaimed. Returns the process exit code.
+func runStorage(cfg *config.Config, logFile string, args []string) int {
+	fs, clean := storageFlags()
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: torvm storage [--clean]")
+		return 2
+	}
+	r, err := storage.Scan(storageOptions(cfg, logFile), time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSIZE\tMODIFIED\tPATH")
+	for _, c := range storage.Categories {
+		fmt.Fprintf(w, "%s\t%s\t\t\n", c, storage.FormatSize(r.Total(c)))
+		for _, it := range r.Items {
+			if it.Category != c {
+				continue
+			}
+			mark := ""
+			if it.Reclaimable {
+				mark = " (reclaimable)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s%s\n", it.Note, storage.FormatSize(it.Size),
+				it.Modified.Format("2006-01-02 15:04"), it.Path, mark)
+		}
+	}
+	w.Flush()
+
+	reclaim := r.Reclaimable()
+	var size int64
+	for _, it := range reclaim {
+		size += it.Size
+	}
+	if !*clean {
+		fmt.Printf("\n%s reclaimable; \"torvm storage --clean\" removes it.\n", storage.FormatSize(size))
+		return 0
+	}
+	freed, err := storage.Clean(reclaim)
+	fmt.Printf("\nFreed %s.\n", storage.FormatSize(freed))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/trial"
+)
+
+// trialFlags defines the "trial" command's flags. It is shared with the
+// completion and man page generators.
+func trialFlags() (fs *flag.FlagSet, runs *int, timeout *time.Duration) {
+	fs = flag.NewFlagSet("trial", flag.ContinueOnError)
+	runs = fs.Int("runs", 3, "boots per variant")
+	timeout = fs.Duration("boot-timeout", 5*time.Minute, "give up on a boot that has not bootstrapped after this long")
+	return fs, runs, timeout
+}
+
+// runTrial implements the "trial" command: it boots the VM with each
+// variant of the configuration in turn, on throwaway state disks, and
+// recommends the one that bootstrapped best. A variant is "current", a
+// JSON file of config settings to change, or a share code. Returns the
+// process exit code.
+func runTrial(cfg *config.Config, logFile string, args []string) int {
+	fs, runs, timeout := trialFlags()
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 2 || fs.NArg() > 26 || *runs < 1 || *timeout <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: torvm trial [--runs N] [--boot-timeout D] VARIANT VARIANT...")
+		fmt.Fprintln(os.Stderr, "a VARIANT is current, a JSON file of config settings, or a share code")
+		return 2
+	}
+
+	var variants []trial.Variant
+	labels := make(map[string]string)
+	for i, spec := range fs.Args() {
+		v, err := trialVariant(cfg, spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: variant %s: %v\n", spec, err)
+			return 1
+		}
+		v.Name = string(rune('A' + i))
+		variants = append(variants, v)
+		labels[v.Name] = trialLabel(spec)
+		fmt.Printf("%s  %s\n", v.Name, labels[v.Name])
+	}
+	fmt.Println()
+
+	// The engine's log goes to --log-file, and to stderr with --verbose.
+	logger, err := logging.NewLogger(logging.Options{Verbose: cfg.Verbose, LogFile: logFile, NoStderr: !cfg.Verbose})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: create logger: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	r := trial.NewRunner(logger, *runs, *timeout)
+	results := r.Run(ctx, variants, func(res trial.Result) {
+		if res.OK {
+			fmt.Printf("%s run %d: bootstrapped in %v\n", res.Variant, res.Run, res.Bootstrap.Round(time.Second))
+		} else {
+			fmt.Printf("%s run %d: failed at %d%%: %s\n", res.Variant, res.Run, res.Progress, res.Error)
+		}
+	})
+	if ctx.Err() != nil {
+		fmt.Println("interrupted")
+	}
+
+	sums := trial.Summarize(results)
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIANT\tRUNS\tBOOTSTRAPPED\tMEDIAN\tFASTEST")
+	for _, s := range sums {
+		median, fastest := "-", "-"
+		if s.OK > 0 {
+			median, fastest = s.Median.Round(time.Second).String(), s.Fastest.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", s.Variant, s.Runs, s.OK, median, fastest)
+	}
+	tw.Flush()
+
+	best, reason := trial.Recommend(sums)
+	if best == "" {
+		fmt.Printf("\nNo recommendation: %s.\n", reason)
+		return 1
+	}
+	fmt.Printf("\nRecommended: %s, %s (%s).\n", best, labels[best], reason)
+	return 0
+}
+
+// trialVariant makes the configuration of one variant from cfg.
+func trialVariant(cfg *config.Config, spec string) (trial.Variant, error) {
+	if spec == "current" {
+		return trial.Variant{Config: cfg}, nil
+	}
+	if data, err := os.ReadFile(spec); err == nil {
+		c, err := cfg.Patch(data)
+		return trial.Variant{Config: c}, err
+	} else if !os.IsNotExist(err) {
+		return trial.Variant{}, err
+	}
+	s, err := config.ParseShare(spec)
+	if err != nil {
+		return trial.Variant{}, fmt.Errorf("neither a file nor a share code: %w", err)
+	}
+	c, err := cfg.Patch([]byte("{}"))
+	if err != nil {
+		return trial.Variant{}, err
+	}
+	c.ApplyShare(s)
+	return trial.Variant{Config: c}, c.Validate()
+}
+
+// trialLabel describes a variant spec briefly.
+func trialLabel(spec string) string {
+	switch {
+	case spec == "current":
+		return "the current configuration"
+	case strings.HasSuffix(strings.ToLower(spec), ".json"):
+		return filepath.Base(spec)
+	case len(spec) > 24:
+		return "share code " + spec[:20] + "..."
+	default:
+		return spec
+	}
+}
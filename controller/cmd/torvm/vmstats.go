@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// vmStatsFlags defines the "vm stats" command's flags. It is shared with
+// the completion and man page generators.
+func vmStatsFlags() (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet("vm stats", flag.ContinueOnError)
+	return fs, fs.Bool("json", false, "print the statistics as JSON")
+}
+
+// vmStats is the output of "vm stats".
+type vmStats struct {
+	Status  string            `json:"status"`
+	Balloon vm.BalloonInfo    `json:"balloon"`
+	Memdevs []vm.Memdev       `json:"memdevs"`
+	Guest   *vm.GuestMemStats `json:"guest,omitempty"` // nil until the guest reports
+	Block   []vm.BlockStats   `json:"block"`
+}
+
+// runVM implements the "vm" command. Its only subcommand, "stats",
+// prints memory and disk I/O statistics of the running VM queried over
+// QMP. Returns the process exit code.
+func runVM(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "stats" {
+		fmt.Fprintln(os.Stderr, "usage: torvm vm stats [--json]")
+		return 2
+	}
+	fs, jsonOut := vmStatsFlags()
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	qmp, err := vm.NewQMPClient(cfg.QMPSocketPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v (is the VM running?)\n", err)
+		return 1
+	}
+	defer qmp.Close()
+
+	stats, err := collectVMStats(qmp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	printVMStats(os.Stdout, stats)
+	return 0
+}
+
+func collectVMStats(qmp *vm.QMPClient) (vmStats, error) {
+	var s vmStats
+	var err error
+	if s.Status, _, err = qmp.QueryStatus(); err != nil {
+		return s, err
+	}
+	if s.Balloon, err = qmp.QueryBalloon(); err != nil {
+		return s, err
+	}
+	if s.Memdevs, err = qmp.QueryMemdev(); err != nil {
+		return s, err
+	}
+	if s.Block, err = qmp.QueryBlockstats(); err != nil {
+		return s, err
+	}
+
+	// The guest only reports while polling is enabled; turn it on so
+	// the next run has data.
+	guest, err := qmp.GuestMemStats()
+	if err != nil {
+		return s, err
+	}
+	if guest.LastUpdate == 0 {
+		if err := qmp.EnableGuestMemStats(5 * time.Second); err != nil {
+			return s, err
+		}
+	} else {
+		s.Guest = &guest
+	}
+	return s, nil
+}
+
+func printVMStats(w io.Writer, s vmStats) {
+	fmt.Fprintf(w, "VM status:      %s\n", s.Status)
+	fmt.Fprintf(w, "Balloon size:   %s\n", mib(s.Balloon.Actual))
+	for _, d := range s.Memdevs {
+		name := d.ID
+		if name == "" {
+			name = "(main)"
+		}
+		fmt.Fprintf(w, "Memory backend: %s %s, policy %s\n", name, mib(d.Size), d.Policy)
+	}
+	for _, b := range s.Block {
+		name := b.Device
+		if name == vm.StateDriveID {
+			name = "state disk"
+		}
+		fmt.Fprintf(w, "Disk I/O:       %s: read %s in %d ops, wrote %s in %d ops\n",
+			name, mib(b.Stats.RdBytes), b.Stats.RdOperations, mib(b.Stats.WrBytes), b.Stats.WrOperations)
+	}
+	if s.Guest == nil {
+		fmt.Fprintln(w, "Guest memory:   not reported yet; run again in a few seconds")
+		return
+	}
+	g := s.Guest.Stats
+	fmt.Fprintf(w, "Guest memory:   %s free, %s available of %s (as of %s)\n",
+		mib(g.Free), mib(g.Available), mib(g.Total),
+		time.Unix(s.Guest.LastUpdate, 0).Format(time.TimeOnly))
+}
+
+// mib formats a byte count in MiB; negative counts are unreported.
+func mib(n int64) string {
+	if n < 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
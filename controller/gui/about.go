@@ -0,0 +1,55 @@
+package gui
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/about"
+)
+
+// SetVersion sets the controller version shown in the About dialog.
+func (a *App) SetVersion(v string) {
+	a.version = v
+}
+
+// showAbout gathers the installation details in the background, since it
+// hashes the guest images, and shows them with buttons to copy them for
+// a support request.
+func (a *App) showAbout() {
+	a.goWorker("about", func(ctx context.Context) {
+		info := about.Collect(a.cfg, a.version)
+		fyne.Do(func() { a.showAboutInfo(info) })
+	})
+}
+
+func (a *App) showAboutInfo(info *about.Info) {
+	var b strings.Builder
+	about.WriteText(&b, info)
+	text := b.String()
+
+	body := widget.NewLabel(text)
+	body.TextStyle = fyne.TextStyle{Monospace: true}
+	body.Wrapping = fyne.TextWrapBreak
+	copyBtn := widget.NewButton("Copy", func() {
+		a.copyText(text)
+	})
+	copyJSONBtn := widget.NewButton("Copy as JSON", func() {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		a.copyText(string(data))
+	})
+
+	d := dialog.NewCustom("About TorVM", "Close",
+		container.NewVBox(body, container.NewHBox(copyBtn, copyJSONBtn)), a.window)
+	d.Resize(fyne.NewSize(640, 0))
+	d.Show()
+}
@@ -2,6 +2,9 @@ package gui
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	fyneapp "fyne.io/fyne/v2/app"
@@ -11,10 +14,15 @@ import (
 
 	"fyne.io/fyne/v2"
 
+	"github.com/user/extorvm/controller/api"
 	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/journal"
 	"github.com/user/extorvm/controller/internal/launchd"
 	"github.com/user/extorvm/controller/internal/lifecycle"
 	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/poll"
+	"github.com/user/extorvm/controller/internal/storage"
 )
 
 // App is the Fyne-based TorVM GUI application.
@@ -26,21 +34,65 @@ type App struct {
 	ring    *logging.RingWriter
 	cfg     *config.Config
 
-	configPath    string
-	cancel        context.CancelFunc
-	serviceMode   bool
-	serviceTicker *time.Ticker
+	configPath  string
+	version     string // controller version, for the About dialog
+	cancel      context.CancelFunc
+	serviceMode bool
+
+	// ctx scopes background workers to the app; stopWorkers cancels it
+	// on quit. workers counts the running ones (see goWorker).
+	ctx         context.Context
+	stopWorkers context.CancelFunc
+	workers     atomic.Int32
+
+	// Runs the periodic status checks of all tabs.
+	poller *poll.Coordinator
+
+	// backend, if set, runs the VM (see SetBackend); backendState is the
+	// state it last reported.
+	backend      *api.Client
+	backendMu    sync.Mutex
+	backendState lifecycle.State
+
+	// servicePoll follows the launchd service while in service mode.
+	modeMu      sync.Mutex
+	servicePoll *poll.Handle
+
+	// trayRate is Tor's traffic rate as shown in the tray menu header.
+	rateMu   sync.Mutex
+	trayRate string
 
 	// Browser VM engine (nil if browser not enabled).
 	browserEngine *lifecycle.BrowserEngine
 
+	// Persistent event journal (nil if disabled).
+	journal *journal.Journal
+
+	// Where the controller keeps its files, for the Storage tab.
+	storageOpts storage.Options
+
+	// failedIn is the state the last run left for shutdown, shown by the
+	// recovery assistant.
+	failMu   sync.Mutex
+	failedIn lifecycle.State
+
+	// The Help tab, opened by help hints and error dialogs.
+	help *helpPane
+
+	// copied is the text the GUI last put on the clipboard, which the
+	// emergency stop clears if it is still there. UI thread only.
+	copied string
+
 	// Widgets updated by observers.
 	statusLight    *StatusLight
 	stateLabel     *widget.Label
+	pauseBtn       *widget.Button
 	logView        *LogView
 	modeLabel      *widget.Label
+	identityLabel  *widget.Label
 	bootstrapBar   *widget.ProgressBar
 	bootstrapLabel *widget.Label
+	ackLabel       *widget.Label
 	tabs           *container.AppTabs
 }
 
@@ -57,13 +109,15 @@ func New(cfg *config.Config, engine *lifecycle.Engine, logger *logging.Logger, r
 
 // Run creates the window and starts the Fyne event loop. Blocks until exit.
 func (a *App) Run() {
+	a.ctx, a.stopWorkers = context.WithCancel(context.Background())
 	a.fyneApp = fyneapp.New()
 	a.window = a.fyneApp.NewWindow("TorVM")
 	a.window.Resize(fyne.NewSize(640, 480))
 
-	// Auto-detect service mode: if service is installed, default to service mode.
+	// Auto-detect service mode: if service is installed, default to
+	// service mode, unless the GUI drives a back end.
 	st := launchd.QueryStatus()
-	a.serviceMode = st.Installed
+	a.serviceMode = st.Installed && a.backend == nil
 
 	// Restore saved window size from preferences.
 	prefs := a.fyneApp.Preferences()
@@ -74,10 +128,20 @@ func (a *App) Run() {
 		}
 	}
 
+	a.poller = poll.New(func() bool {
+		return a.engine.State() == lifecycle.StateRunning
+	}, seconds(a.cfg.Polling.MaxBackoffSec), a.logger)
+	a.poller.Start()
+
 	// Register lifecycle observer for UI updates.
 	a.engine.OnStateChange(func(from, to lifecycle.State) {
 		a.updateStatus(from, to)
 		a.refreshTrayMenu()
+		if to == lifecycle.StateShutdown {
+			a.failMu.Lock()
+			a.failedIn = from
+			a.failMu.Unlock()
+		}
 
 		// Show error dialog when entering Failed state with recovery options.
 		if to == lifecycle.StateFailed {
@@ -93,6 +157,7 @@ func (a *App) Run() {
 		container.NewTabItem("Circuits", a.circuitsTab()),
 		container.NewTabItem("Settings", a.settingsTab()),
 		container.NewTabItem("Logs", a.logTab()),
+		container.NewTabItem("Storage", a.storageTab()),
 	)
 
 	// Conditionally add Browser tab.
@@ -100,11 +165,18 @@ func (a *App) Run() {
 		a.tabs.Append(container.NewTabItem("Browser", a.browserTab()))
 	}
 
+	// Conditionally add History tab.
+	if a.journal != nil {
+		a.tabs.Append(container.NewTabItem("History", a.historyTab()))
+	}
+
 	// Conditionally add Service tab (returns nil on unsupported platforms).
 	if svcTab := a.serviceTab(); svcTab != nil {
 		a.tabs.Append(container.NewTabItem("Service", svcTab))
 	}
 
+	a.tabs.Append(container.NewTabItem("Help", a.helpTab()))
+
 	a.window.SetContent(a.tabs)
 
 	// Minimize to tray on close instead of quitting. Save window size.
@@ -116,16 +188,38 @@ func (a *App) Run() {
 	})
 
 	a.setupSystemTray()
+	a.setupEmergencyStop()
+	a.setupNotifications()
+	a.setupSessionReport()
 	a.window.ShowAndRun()
 }
 
-// startVM begins the lifecycle engine in the background,
-// or starts the launchd service if in service mode.
+// pollEvery has fn polled every sec seconds by the poller. Checks with
+// needsVM set are skipped, with backoff, while the VM is down.
+func (a *App) pollEvery(name string, sec int, needsVM bool, fn func() error) *poll.Handle {
+	return a.poller.Add(poll.Task{
+		Name:     name,
+		Interval: seconds(sec),
+		NeedsVM:  needsVM,
+		Run:      func(context.Context) error { return fn() },
+	})
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// startVM begins the lifecycle engine in the background, asks the back
+// end to start the VM, or starts the launchd service if in service mode.
 func (a *App) startVM() {
+	if a.backend != nil {
+		a.backendAction("start", a.backend.Start)
+		return
+	}
 	if a.serviceMode {
 		if err := launchd.Start(); err != nil {
 			a.logger.Error("service start: %v", err)
-			dialog.ShowError(err, a.window)
+			a.showError(err)
 		}
 		return
 	}
@@ -134,22 +228,31 @@ func (a *App) startVM() {
 		// Already running.
 		return
 	}
+	if a.stateDiskMissing() {
+		a.showCreateStateDisk()
+		return
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	a.cancel = cancel
 	errCh := a.engine.Start(ctx)
 
 	// Watch for completion in the background.
-	go func() {
-		err := <-errCh
+	a.goWorker("lifecycle watcher", func(appCtx context.Context) {
+		var err error
+		select {
+		case err = <-errCh:
+		case <-appCtx.Done():
+			return
+		}
 		a.cancel = nil
 		a.refreshTrayMenu()
 		if err != nil {
 			a.logger.Error("lifecycle error: %v", err)
 			a.window.Canvas().Content().Refresh()
-			dialog.ShowError(err, a.window)
+			fyne.Do(func() { a.showRecovery(err) })
 		}
-	}()
+	})
 }
 
 // showFailedDialog displays an error dialog with recovery options.
@@ -158,15 +261,7 @@ func (a *App) showFailedDialog() {
 		a.startVM()
 	})
 	logsBtn := widget.NewButton("View Logs", func() {
-		// Switch to the Logs tab by name.
-		if a.tabs != nil {
-			for i, item := range a.tabs.Items {
-				if item.Text == "Logs" {
-					a.tabs.SelectIndex(i)
-					break
-				}
-			}
-		}
+		a.selectTab("Logs")
 	})
 	content := container.NewVBox(
 		widget.NewLabel("TorVM encountered an error and could not continue."),
@@ -177,24 +272,104 @@ func (a *App) showFailedDialog() {
 	d.Show()
 }
 
+// selectTab switches to the tab with the given name.
+func (a *App) selectTab(name string) {
+	if a.tabs == nil {
+		return
+	}
+	for _, item := range a.tabs.Items {
+		if item.Text == name {
+			a.tabs.Select(item)
+			return
+		}
+	}
+}
+
 // SetBrowserEngine sets the browser lifecycle engine for the GUI.
 func (a *App) SetBrowserEngine(be *lifecycle.BrowserEngine) {
 	a.browserEngine = be
 }
 
-// stopVM signals the lifecycle engine to shut down,
-// or stops the launchd service if in service mode.
+// SetJournal sets the event journal browsed by the History tab.
+func (a *App) SetJournal(j *journal.Journal) {
+	a.journal = j
+}
+
+// stopVM signals the lifecycle engine to shut down (after confirmation if
+// Tor connections are open), asks the back end to stop the VM, or stops
+// the launchd service if in service mode.
 func (a *App) stopVM() {
+	if a.backend != nil {
+		a.backendAction("stop", a.backend.Stop)
+		return
+	}
 	if a.serviceMode {
 		if err := launchd.Stop(); err != nil {
 			a.logger.Error("service stop: %v", err)
-			dialog.ShowError(err, a.window)
+			a.showError(err)
 		}
 		return
 	}
 
-	if a.cancel != nil {
-		a.cancel()
-		a.cancel = nil
+	// The lifecycle watcher reports the outcome of the stop.
+	a.confirmActiveStreams("Stop TorVM", func() {
+		a.engine.Stop(context.Background())
+	})
+}
+
+// StartVM starts the VM (or the service) for the control API. It is safe
+// to call from any goroutine.
+func (a *App) StartVM() error {
+	var err error
+	fyne.DoAndWait(func() {
+		if a.cancel != nil && !a.serviceMode {
+			err = controlapi.ErrRunning
+			return
+		}
+		a.startVM()
+	})
+	return err
+}
+
+// StopVM stops the VM (or the service) for the control API, without the
+// confirmation the Stop button asks for, and waits for the shutdown. It
+// is safe to call from any goroutine.
+func (a *App) StopVM(ctx context.Context) error {
+	var err error
+	var stopped <-chan error
+	fyne.DoAndWait(func() {
+		switch {
+		case a.serviceMode:
+			err = launchd.Stop()
+		case a.cancel == nil:
+			err = controlapi.ErrNotRunning
+		default:
+			stopped = a.engine.Stop(ctx)
+		}
+	})
+	if stopped != nil {
+		err = <-stopped
 	}
+	return err
+}
+
+// confirmActiveStreams runs proceed, first asking the user to confirm when
+// open Tor connections would be cut off by stopping the VM.
+func (a *App) confirmActiveStreams(title string, proceed func()) {
+	if a.cancel == nil || a.engine.State() != lifecycle.StateRunning {
+		proceed()
+		return
+	}
+	n, err := a.engine.ActiveStreams()
+	if err != nil || n == 0 {
+		proceed()
+		return
+	}
+	msg := fmt.Sprintf("%d active connection(s) will be terminated.\n\nContinue anyway?", n)
+	a.window.Show()
+	dialog.ShowConfirm(title, msg, func(ok bool) {
+		if ok {
+			proceed()
+		}
+	}, a.window)
 }
@@ -0,0 +1,54 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/autostart"
+)
+
+// autostartCheck builds the "Start at login" checkbox. It takes effect at
+// once rather than on Save Config, as it changes the desktop's login
+// items rather than the config file.
+func (a *App) autostartCheck() *widget.Check {
+	check := widget.NewCheck("Start at login", nil)
+	on, err := autostart.Enabled()
+	if err != nil {
+		a.logger.Error("%v", err)
+	}
+	check.Checked = on
+	var toggled func(bool)
+	toggled = func(on bool) {
+		if err := setAutostart(on, a.configPath); err != nil {
+			a.logger.Error("%v", err)
+			a.showError(err)
+			// Show the setting as it still is.
+			check.OnChanged = nil
+			check.SetChecked(!on)
+			check.OnChanged = toggled
+			return
+		}
+		if on {
+			a.logger.Info("TorVM starts at login")
+		} else {
+			a.logger.Info("TorVM no longer starts at login")
+		}
+	}
+	check.OnChanged = toggled
+	if !autostart.Supported() {
+		check.Disable()
+	}
+	return check
+}
+
+// setAutostart makes the GUI, with the config file at configPath, start
+// at login or not.
+func setAutostart(on bool, configPath string) error {
+	if !on {
+		return autostart.Disable()
+	}
+	command, err := autostart.Command(configPath)
+	if err != nil {
+		return err
+	}
+	return autostart.Enable(command)
+}
@@ -0,0 +1,148 @@
+package gui
+
+import (
+	"context"
+	"time"
+
+	"fyne.io/fyne/v2"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// backendRetry is how long the GUI waits before reconnecting to a back
+// end it lost.
+const backendRetry = 3 * time.Second
+
+// SetBackend has the GUI drive a privileged back end (torvm --backend)
+// through its control API instead of running the VM itself, so the GUI
+// runs as the logged-in user: the back end owns the TAP device, routes,
+// firewall, and QEMU. Call it before Run. Features that need the engine
+// in-process, such as pausing, the emergency stop, and the tabs that read
+// Tor's control port, are unavailable.
+func (a *App) SetBackend(c *api.Client) {
+	a.backend = c
+}
+
+// vmState returns the VM's state: the engine's, or the last one the back
+// end reported.
+func (a *App) vmState() lifecycle.State {
+	if a.backend == nil {
+		return a.engine.State()
+	}
+	a.backendMu.Lock()
+	defer a.backendMu.Unlock()
+	return a.backendState
+}
+
+// settled reports whether st is a state between sessions, from which the
+// VM can be started.
+func settled(st lifecycle.State) bool {
+	return st == lifecycle.StateInit || st == lifecycle.StateCleanup || st == lifecycle.StateFailed
+}
+
+// backendAction runs one request to the back end in a worker and shows
+// its error. A stop replies only once the VM has shut down.
+func (a *App) backendAction(name string, fn func(context.Context) error) {
+	a.goWorker("back end "+name, func(ctx context.Context) {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			a.logger.Error("back end %s: %v", name, err)
+			fyne.Do(func() { a.showError(err) })
+		}
+	})
+}
+
+// newIdentity asks Tor for new circuits, through the back end if there
+// is one.
+func (a *App) newIdentity() error {
+	if a.backend != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return a.backend.NewIdentity(ctx)
+	}
+	return a.engine.NewIdentity()
+}
+
+// followBackend keeps the status widgets and the tray menu in sync with
+// the back end, reconnecting when it goes away.
+func (a *App) followBackend() {
+	a.goWorker("back end events", func(ctx context.Context) {
+		for {
+			if err := a.syncBackend(ctx); err != nil {
+				a.logger.Debug("gui: back end: %v", err)
+			}
+			fyne.Do(func() {
+				a.showBackendState(lifecycle.StateInit, "")
+				a.stateLabel.SetText("Back end not reachable")
+			})
+			select {
+			case <-time.After(backendRetry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// syncBackend shows the back end's status, then its events until the
+// stream ends.
+func (a *App) syncBackend(ctx context.Context) error {
+	// Subscribe first, so no change is lost between the two requests.
+	events, err := a.backend.Events(ctx)
+	if err != nil {
+		return err
+	}
+	st, err := a.backend.Status(ctx)
+	if err != nil {
+		return err
+	}
+	state, _ := lifecycle.ParseState(st.State)
+	reason := st.ShutdownReason
+	why := reason
+	fyne.Do(func() {
+		a.showBackendState(state, why)
+		a.bootstrapBar.SetValue(float64(st.Bootstrap))
+		a.bootstrapLabel.SetText(st.Summary)
+	})
+	for ev := range events {
+		switch ev.Kind {
+		case api.EventState:
+			state, _ := lifecycle.ParseState(ev.State)
+			switch {
+			case ev.Message != "":
+				reason = ev.Message
+			case state == lifecycle.StateInit || state == lifecycle.StateSaveNetwork:
+				reason = ""
+			}
+			why := reason
+			fyne.Do(func() { a.showBackendState(state, why) })
+		case api.EventBootstrap:
+			fyne.Do(func() {
+				a.bootstrapBar.SetValue(float64(ev.Progress))
+				a.bootstrapLabel.SetText(ev.Message)
+			})
+		}
+	}
+	return ctx.Err()
+}
+
+// showBackendState shows a state the back end reported, as updateStatus
+// does the engine's, with why its session shut down (a ShutdownReason
+// name).
+func (a *App) showBackendState(st lifecycle.State, reason string) {
+	a.backendMu.Lock()
+	a.backendState = st
+	a.backendMu.Unlock()
+
+	a.statusLight.SetState(st)
+	text := a.statusLight.Description()
+	switch st {
+	case lifecycle.StateShutdown, lifecycle.StateRestoreNetwork, lifecycle.StateCleanup:
+		var r lifecycle.ShutdownReason
+		if reason != "" && r.UnmarshalText([]byte(reason)) == nil {
+			text += " (" + r.Description() + ")"
+		}
+	}
+	a.stateLabel.SetText(text)
+	a.refreshTrayMenu()
+}
@@ -1,35 +1,32 @@
 package gui
 
 import (
+	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/help"
 )
 
 // bridgesTab builds the Bridges configuration tab.
 func (a *App) bridgesTab() fyne.CanvasObject {
-	useBridges := widget.NewCheck("Use Bridges", func(on bool) {
-		a.cfg.Bridge.UseBridges = on
-	})
-	useBridges.Checked = a.cfg.Bridge.UseBridges
-
-	transportSelect := widget.NewSelect(
-		[]string{"none", "obfs4", "meek-azure", "snowflake"},
-		func(val string) {
-			a.cfg.Bridge.Transport = val
-		},
-	)
-	if a.cfg.Bridge.Transport != "" {
-		transportSelect.SetSelected(a.cfg.Bridge.Transport)
-	} else {
-		transportSelect.SetSelected("none")
+	// bridgeStatus says what is wrong with the bridge lines as they are
+	// typed, rather than leaving it to Tor in the VM.
+	bridgeStatus := widget.NewLabel("")
+	bridgeStatus.Wrapping = fyne.TextWrapWord
+	bridgeStatus.Importance = widget.DangerImportance
+	bridgeLines := widget.NewMultiLineEntry()
+	checkBridges := func() {
+		bridgeStatus.SetText(bridgeProblems(bridgeLines.Text, a.cfg.Bridge.Transport))
 	}
 
-	bridgeLines := widget.NewMultiLineEntry()
 	bridgeLines.SetPlaceHolder("Paste bridge lines here, one per line...")
 	bridgeLines.SetMinRowsVisible(6)
 	bridgeLines.SetText(strings.Join(a.cfg.Bridge.Bridges, "\n"))
@@ -43,18 +40,130 @@ func (a *App) bridgesTab() fyne.CanvasObject {
 			}
 		}
 		a.cfg.Bridge.Bridges = filtered
+		checkBridges()
+	}
+
+	useBridges := widget.NewCheck("Use Bridges", func(on bool) {
+		a.cfg.Bridge.UseBridges = on
+	})
+	useBridges.Checked = a.cfg.Bridge.UseBridges
+
+	snowflake := widget.NewAccordion(widget.NewAccordionItem("Snowflake Options", a.snowflakeForm()))
+	transportSelect := widget.NewSelect(
+		[]string{"none", "obfs4", "meek-azure", "snowflake", "webtunnel"},
+		func(val string) {
+			a.cfg.Bridge.Transport = val
+			checkBridges()
+			if val == "snowflake" {
+				snowflake.Show()
+			} else {
+				snowflake.Hide()
+			}
+		},
+	)
+	if a.cfg.Bridge.Transport != "" {
+		transportSelect.SetSelected(a.cfg.Bridge.Transport)
+	} else {
+		transportSelect.SetSelected("none")
 	}
 
 	getBridgesURL, _ := url.Parse("https://bridges.torproject.org")
 	getBridges := widget.NewHyperlink("Get Bridges from torproject.org", getBridgesURL)
 
+	shareRow := container.NewHBox(
+		a.withHelp(widget.NewButton("Request Bridges...", a.showRequestBridges), help.RequestBridges),
+		widget.NewButton("Share Settings...", a.showShareCode),
+		widget.NewButton("Import Share Code...", a.showImportShare),
+	)
+
 	return container.NewVBox(
-		useBridges,
-		widget.NewLabel("Transport:"),
+		a.withHelp(useBridges, help.Bridges),
+		a.withHelp(widget.NewLabel("Transport:"), help.Transports),
 		transportSelect,
-		widget.NewLabel("Bridge Lines:"),
+		snowflake,
+		a.withHelp(widget.NewLabel("Bridge Lines:"), help.Bridges),
 		bridgeLines,
+		bridgeStatus,
 		getBridges,
+		shareRow,
 		layout.NewSpacer(),
 	)
 }
+
+// snowflakeForm builds the form for the snowflake settings, which
+// replace the matching parameters of the snowflake bridge lines. Lists
+// are entered comma-separated.
+func (a *App) snowflakeForm() fyne.CanvasObject {
+	s := &a.cfg.Bridge.Snowflake
+	broker := widget.NewEntry()
+	broker.SetPlaceHolder("https://... (default from the bridge lines)")
+	broker.SetText(s.BrokerURL)
+	broker.OnChanged = func(text string) { s.BrokerURL = strings.TrimSpace(text) }
+
+	fronts := widget.NewEntry()
+	fronts.SetPlaceHolder("cdn.example.com, www.example.org")
+	fronts.SetText(strings.Join(s.Fronts, ", "))
+	fronts.OnChanged = func(text string) { s.Fronts = splitList(text) }
+
+	ampcache := widget.NewEntry()
+	ampcache.SetPlaceHolder("https://cdn.ampproject.org/")
+	ampcache.SetText(s.AMPCache)
+	ampcache.OnChanged = func(text string) { s.AMPCache = strings.TrimSpace(text) }
+
+	stun := widget.NewEntry()
+	stun.SetPlaceHolder("stun:stun.example.com:3478")
+	stun.SetText(strings.Join(s.STUN, ", "))
+	stun.OnChanged = func(text string) { s.STUN = splitList(text) }
+
+	peers := []string{"default"}
+	for i := 1; i <= 16; i++ {
+		peers = append(peers, strconv.Itoa(i))
+	}
+	maxPeers := widget.NewSelect(peers, func(val string) {
+		s.MaxPeers, _ = strconv.Atoi(val)
+	})
+	if s.MaxPeers > 0 {
+		maxPeers.SetSelected(strconv.Itoa(s.MaxPeers))
+	} else {
+		maxPeers.SetSelected("default")
+	}
+
+	return widget.NewForm(
+		widget.NewFormItem("Broker URL", broker),
+		widget.NewFormItem("Front domains", fronts),
+		widget.NewFormItem("AMP cache", ampcache),
+		widget.NewFormItem("STUN servers", stun),
+		widget.NewFormItem("Max peers", maxPeers),
+	)
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(text string) []string {
+	var items []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// bridgeProblems returns what is wrong with the bridge lines in text,
+// one line each numbered as in text, or "" if they will do with
+// transport.
+func bridgeProblems(text, transport string) string {
+	var problems []string
+	for i, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		b, err := config.ParseBridgeLine(line)
+		if err == nil {
+			err = config.CheckBridgeTransport(b, transport)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Line %d: %v", i+1, err))
+		}
+	}
+	return strings.Join(problems, "\n")
+}
@@ -178,11 +178,15 @@ func (a *App) launchBrowser() {
 	}
 
 	errCh := a.browserEngine.Start(context.Background())
-	go func() {
-		if err := <-errCh; err != nil {
-			a.logger.Error("browser VM: %v", err)
+	a.goWorker("browser VM watcher", func(ctx context.Context) {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				a.logger.Error("browser VM: %v", err)
+			}
+		case <-ctx.Done():
 		}
-	}()
+	})
 }
 
 // stopBrowser stops the browser VM.
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strings"
 	"sync"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -12,6 +11,7 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/poll"
 	"github.com/user/extorvm/controller/internal/tor"
 )
 
@@ -29,8 +29,7 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 	var circuits []circuitEntry
 	var selectedIdx int = -1
 	var autoRefresh bool
-	var ticker *time.Ticker
-	var tickerDone chan struct{}
+	var autoPoll *poll.Handle
 
 	// Relay location cache.
 	relayCache := make(map[string]*tor.RelayInfo)
@@ -131,15 +130,15 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 	}
 
 	// pollCircuits fetches current circuits and updates the UI.
-	pollCircuits := func() {
+	pollCircuits := func() error {
 		if a.engine.TorControl == nil || a.engine.State() != lifecycle.StateRunning {
-			return
+			return nil
 		}
 
 		circs, err := a.engine.TorControl.GetCircuits()
 		if err != nil {
 			a.logger.Error("circuits poll: %v", err)
-			return
+			return err
 		}
 
 		mu.Lock()
@@ -156,6 +155,7 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 		countLabel.SetText(fmt.Sprintf("Circuits: %d", len(circuits)))
 		circuitList.Refresh()
 		updateGlobe()
+		return nil
 	}
 
 	// Circuit list selection.
@@ -173,26 +173,11 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 	autoRefreshCheck := widget.NewCheck("Auto-refresh", func(on bool) {
 		autoRefresh = on
 		if on {
-			tickerDone = make(chan struct{})
-			ticker = time.NewTicker(5 * time.Second)
-			go func() {
-				for {
-					select {
-					case <-ticker.C:
-						pollCircuits()
-					case <-tickerDone:
-						return
-					}
-				}
-			}()
+			autoPoll = a.pollEvery("circuits", a.cfg.Polling.CircuitsSec, true, pollCircuits)
 			pollCircuits() // immediate first poll
-		} else {
-			if ticker != nil {
-				ticker.Stop()
-			}
-			if tickerDone != nil {
-				close(tickerDone)
-			}
+		} else if autoPoll != nil {
+			autoPoll.Remove()
+			autoPoll = nil
 		}
 	})
 
@@ -275,7 +260,7 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 
 				// Hot-reload if running.
 				if a.engine.State() == lifecycle.StateRunning {
-					if err := a.engine.ReloadConfig(a.cfg); err != nil {
+					if _, err := a.engine.ReloadConfig(a.cfg); err != nil {
 						a.logger.Error("reload config after blocking relay: %v", err)
 					}
 				}
@@ -301,7 +286,7 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 					a.cfg.Relays.ExcludeNodes = append(a.cfg.Relays.ExcludeNodes, fp)
 					a.logger.Info("blocked relay %s via globe", fp)
 					if a.engine.State() == lifecycle.StateRunning {
-						if err := a.engine.ReloadConfig(a.cfg); err != nil {
+						if _, err := a.engine.ReloadConfig(a.cfg); err != nil {
 							a.logger.Error("reload config after blocking relay: %v", err)
 						}
 					}
@@ -309,10 +294,11 @@ func (a *App) circuitsTab() fyne.CanvasObject {
 			}, a.window)
 	}
 
-	// Listen for state changes to auto-start/stop polling.
+	// Poll right away once the VM is up instead of waiting out the
+	// backoff accumulated while it was down.
 	a.engine.OnStateChange(func(_, to lifecycle.State) {
-		if to == lifecycle.StateRunning && autoRefresh {
-			pollCircuits()
+		if h := autoPoll; to == lifecycle.StateRunning && autoRefresh && h != nil {
+			h.Kick()
 		}
 	})
 
@@ -0,0 +1,57 @@
+package gui
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/doctor"
+)
+
+// runChecks runs the preflight checks in the background and shows the
+// results. btn is disabled while they run. The control API socket,
+// metrics address, and QMP socket are not checked: this process and its
+// VM hold them.
+func (a *App) runChecks(btn *widget.Button) {
+	btn.Disable()
+	a.goWorker("preflight checks", func(ctx context.Context) {
+		results := doctor.Run(doctor.Options{Config: a.cfg})
+		fyne.Do(func() {
+			btn.Enable()
+			a.showCheckResults(results)
+		})
+	})
+}
+
+func (a *App) showCheckResults(results []doctor.Result) {
+	var b strings.Builder
+	failed := 0
+	for _, r := range results {
+		switch r.Status {
+		case doctor.Pass:
+			a.logger.Info("preflight: %s: %s", r.Name, r.Detail)
+		case doctor.Warn:
+			a.logger.Info("preflight: warning: %s: %s", r.Name, r.Detail)
+		default:
+			failed++
+			a.logger.Error("preflight: %s FAILED: %s", r.Name, r.Detail)
+		}
+		b.WriteString(r.Status.String() + "  " + r.Name + "\n      " + r.Detail + "\n")
+		if r.Status != doctor.Pass && r.Fix != "" {
+			b.WriteString("      Fix: " + r.Fix + "\n")
+		}
+	}
+	title := "All Checks Passed"
+	if failed > 0 {
+		title = strconv.Itoa(failed) + " Check(s) Failed"
+	}
+	text := widget.NewLabel(b.String())
+	text.Wrapping = fyne.TextWrapWord
+	d := dialog.NewCustom(title, "Close", text, a.window)
+	d.Resize(fyne.NewSize(560, 0))
+	d.Show()
+}
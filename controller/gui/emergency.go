@@ -0,0 +1,70 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+// emergencyShortcut triggers the emergency stop (Ctrl+Shift+F12). It is
+// registered system-wide where the platform allows (see
+// registerEmergencyHotkey) and on the window everywhere.
+var emergencyShortcut = &desktop.CustomShortcut{
+	KeyName:  fyne.KeyF12,
+	Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
+}
+
+// emergencyStop is the panic button: it kills QEMU, blocks host traffic
+// and, if configured, wipes the state disk, then ends the session. It
+// also drops the log lines held in memory and what the GUI copied to the
+// clipboard, and, if configured, locks the screen. There is deliberately
+// no confirmation.
+func (a *App) emergencyStop() {
+	if a.cancel == nil {
+		return
+	}
+	if a.cfg.PanicLock {
+		// In parallel: the kill must not wait for the lock.
+		go func() {
+			if err := platform.LockScreen(); err != nil {
+				a.logger.Error("emergency stop: %v", err)
+			}
+		}()
+	}
+	if err := a.engine.EmergencyStop(a.cfg.PanicWipe); err != nil {
+		a.logger.Error("%v", err)
+	}
+	a.cancel()
+	a.clearTraces()
+}
+
+// clearTraces drops the log lines held in memory and in the Logs tab, and
+// empties the clipboard if it still holds what the GUI copied there. Log
+// files and the event journal on disk are left alone.
+func (a *App) clearTraces() {
+	a.ring.Clear()
+	if a.logView != nil {
+		a.logView.Clear()
+	}
+	if a.copied != "" {
+		if cb := a.fyneApp.Clipboard(); cb.Content() == a.copied {
+			cb.SetContent("")
+		}
+		a.copied = ""
+	}
+}
+
+// copyText puts text on the clipboard, remembering it for clearTraces.
+func (a *App) copyText(text string) {
+	a.fyneApp.Clipboard().SetContent(text)
+	a.copied = text
+}
+
+// setupEmergencyStop registers the emergency stop shortcuts.
+func (a *App) setupEmergencyStop() {
+	a.window.Canvas().AddShortcut(emergencyShortcut, func(fyne.Shortcut) {
+		a.emergencyStop()
+	})
+	a.registerEmergencyHotkey()
+}
@@ -0,0 +1,182 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/help"
+)
+
+// helpHint is a small help icon placed beside a setting. Hovering shows
+// the topic's summary as a tooltip; tapping opens the topic in the Help
+// tab.
+type helpHint struct {
+	widget.BaseWidget
+	app   *App
+	topic help.Topic
+	popup *widget.PopUp
+}
+
+var (
+	_ fyne.Tappable     = (*helpHint)(nil)
+	_ desktop.Hoverable = (*helpHint)(nil)
+)
+
+// helpHint returns a hint for the topic with the given ID.
+func (a *App) helpHint(id string) *helpHint {
+	topic, ok := help.Lookup(id)
+	if !ok {
+		a.logger.Error("help: no topic %q", id)
+	}
+	h := &helpHint{app: a, topic: topic}
+	h.ExtendBaseWidget(h)
+	return h
+}
+
+// withHelp places a hint for topic id to the right of obj.
+func (a *App) withHelp(obj fyne.CanvasObject, id string) fyne.CanvasObject {
+	return container.NewBorder(nil, nil, nil, a.helpHint(id), obj)
+}
+
+func (h *helpHint) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(widget.NewIcon(theme.HelpIcon()))
+}
+
+func (h *helpHint) MinSize() fyne.Size {
+	s := theme.IconInlineSize() + 2*theme.InnerPadding()
+	return fyne.NewSize(s, s)
+}
+
+func (h *helpHint) Tapped(*fyne.PointEvent) {
+	h.hideTooltip()
+	h.app.showHelp(h.topic.ID)
+}
+
+func (h *helpHint) MouseIn(*desktop.MouseEvent) {
+	c := fyne.CurrentApp().Driver().CanvasForObject(h)
+	if c == nil || h.topic.ID == "" {
+		return
+	}
+	text := widget.NewLabel(h.topic.Summary())
+	text.Wrapping = fyne.TextWrapWord
+	h.popup = widget.NewPopUp(text, c)
+	h.popup.Resize(fyne.NewSize(320, text.MinSize().Height))
+	// Below the icon, kept inside the window.
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(h).AddXY(0, h.Size().Height)
+	if over := pos.X + 320 - c.Size().Width; over > 0 {
+		pos.X -= over
+	}
+	h.popup.ShowAtPosition(pos)
+}
+
+func (h *helpHint) MouseMoved(*desktop.MouseEvent) {}
+
+func (h *helpHint) MouseOut() {
+	h.hideTooltip()
+}
+
+func (h *helpHint) hideTooltip() {
+	if h.popup != nil {
+		h.popup.Hide()
+		h.popup = nil
+	}
+}
+
+// helpPane is the Help tab: a search box, the matching topics, and the
+// selected topic.
+type helpPane struct {
+	search *widget.Entry
+	list   *widget.List
+	body   *widget.RichText
+	shown  []help.Topic
+}
+
+// helpTab builds the Help tab.
+func (a *App) helpTab() fyne.CanvasObject {
+	p := &helpPane{shown: help.Topics()}
+	a.help = p
+
+	p.body = widget.NewRichTextFromMarkdown("")
+	p.body.Wrapping = fyne.TextWrapWord
+
+	p.list = widget.NewList(
+		func() int { return len(p.shown) },
+		func() fyne.CanvasObject { return widget.NewLabel("placeholder topic title") },
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			if id < len(p.shown) {
+				obj.(*widget.Label).SetText(p.shown[id].Title)
+			}
+		},
+	)
+	p.list.OnSelected = func(id widget.ListItemID) {
+		if id < len(p.shown) {
+			p.body.ParseMarkdown(p.shown[id].Markdown())
+		}
+	}
+
+	p.search = widget.NewEntry()
+	p.search.SetPlaceHolder("Search help...")
+	p.search.OnChanged = func(q string) {
+		p.shown = help.Search(q)
+		p.list.UnselectAll()
+		p.list.Refresh()
+		if len(p.shown) > 0 {
+			p.list.Select(0)
+		} else {
+			p.body.ParseMarkdown("No topics match.")
+		}
+	}
+	p.list.Select(0)
+
+	split := container.NewHSplit(
+		container.NewBorder(p.search, widget.NewButton("About TorVM", a.showAbout), nil, nil, p.list),
+		container.NewVScroll(p.body),
+	)
+	split.Offset = 0.3
+	return split
+}
+
+// showHelp switches to the Help tab and opens the topic with the given
+// ID.
+func (a *App) showHelp(id string) {
+	if a.help == nil || a.tabs == nil {
+		return
+	}
+	for _, item := range a.tabs.Items {
+		if item.Text == "Help" {
+			a.tabs.Select(item)
+			break
+		}
+	}
+	a.help.search.SetText("")
+	for i, t := range a.help.shown {
+		if t.ID == id {
+			a.help.list.Select(i)
+			a.help.list.ScrollTo(i)
+			return
+		}
+	}
+}
+
+// showError shows err in a dialog. If a help topic explains it, the
+// dialog offers to open that topic.
+func (a *App) showError(err error) {
+	topic, ok := help.ForError(err)
+	if !ok {
+		dialog.ShowError(err, a.window)
+		return
+	}
+	text := widget.NewLabel(err.Error())
+	text.Wrapping = fyne.TextWrapWord
+	d := dialog.NewCustomConfirm("Error", "Help: "+topic.Title, "Close", text, func(open bool) {
+		if open {
+			a.showHelp(topic.ID)
+		}
+	}, a.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
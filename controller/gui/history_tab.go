@@ -0,0 +1,109 @@
+package gui
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/journal"
+)
+
+// historyRanges maps the range selector labels to look-back durations.
+// Zero means the whole journal.
+var historyRanges = []struct {
+	label string
+	d     time.Duration
+}{
+	{"Last hour", time.Hour},
+	{"Last 24 hours", 24 * time.Hour},
+	{"Last 7 days", 7 * 24 * time.Hour},
+	{"All", 0},
+}
+
+// historyTab builds the History tab for browsing the persistent event
+// journal by time range and kind.
+func (a *App) historyTab() fyne.CanvasObject {
+	var mu sync.Mutex
+	var events []journal.Event
+	lookback := time.Hour
+	kind := ""
+
+	countLabel := widget.NewLabel("Events: 0")
+
+	list := widget.NewList(
+		func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(events)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("placeholder event")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			mu.Lock()
+			defer mu.Unlock()
+			if id < len(events) {
+				obj.(*widget.Label).SetText(events[id].String())
+			}
+		},
+	)
+
+	reload := func() {
+		var since time.Time
+		if lookback > 0 {
+			since = time.Now().Add(-lookback)
+		}
+		evs, err := a.journal.Query(since, time.Time{})
+		if err != nil {
+			dialog.ShowError(err, a.window)
+			return
+		}
+		// Newest first: the interesting event is usually the latest.
+		filtered := make([]journal.Event, 0, len(evs))
+		for i := len(evs) - 1; i >= 0; i-- {
+			if kind == "" || evs[i].Kind == kind {
+				filtered = append(filtered, evs[i])
+			}
+		}
+		mu.Lock()
+		events = filtered
+		mu.Unlock()
+		countLabel.SetText(fmt.Sprintf("Events: %d", len(filtered)))
+		list.Refresh()
+	}
+
+	labels := make([]string, len(historyRanges))
+	for i, r := range historyRanges {
+		labels[i] = r.label
+	}
+	rangeSelect := widget.NewSelect(labels, func(sel string) {
+		for _, r := range historyRanges {
+			if r.label == sel {
+				lookback = r.d
+			}
+		}
+		reload()
+	})
+
+	kindSelect := widget.NewSelect([]string{"All", journal.KindState, journal.KindBootstrap, journal.KindError, journal.KindSecurity, journal.KindSession}, func(sel string) {
+		if sel == "All" {
+			kind = ""
+		} else {
+			kind = sel
+		}
+		reload()
+	})
+
+	refreshBtn := widget.NewButton("Refresh", reload)
+
+	rangeSelect.SetSelected(historyRanges[0].label)
+	kindSelect.SetSelected("All")
+
+	toolbar := container.NewHBox(rangeSelect, kindSelect, refreshBtn, countLabel)
+	return container.NewBorder(toolbar, nil, nil, nil, list)
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package gui
+
+// registerEmergencyHotkey does nothing: Linux and macOS have no portable
+// system-wide hotkey API, so the emergency stop shortcut only works while
+// the window has focus.
+func (a *App) registerEmergencyHotkey() {}
@@ -0,0 +1,75 @@
+//go:build windows
+
+package gui
+
+import (
+	"context"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	user32                 = windows.NewLazySystemDLL("user32.dll")
+	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
+	procGetMessageW        = user32.NewProc("GetMessageW")
+	procPostThreadMessageW = user32.NewProc("PostThreadMessageW")
+)
+
+const (
+	modControl  = 0x0002
+	modShift    = 0x0004
+	modNoRepeat = 0x4000
+	vkF12       = 0x7B
+	wmQuit      = 0x0012
+	wmHotkey    = 0x0312
+
+	emergencyHotkeyID = 1
+)
+
+// winMsg is the Win32 MSG structure.
+type winMsg struct {
+	hwnd    uintptr
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	pt      struct{ x, y int32 }
+}
+
+// registerEmergencyHotkey registers Ctrl+Shift+F12 system-wide, so the
+// emergency stop works without switching to the window.
+func (a *App) registerEmergencyHotkey() {
+	a.goWorker("emergency hotkey", func(ctx context.Context) {
+		// WM_HOTKEY is posted to the queue of the registering thread.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		r, _, err := procRegisterHotKey.Call(0, emergencyHotkeyID, modControl|modShift|modNoRepeat, vkF12)
+		if r == 0 {
+			a.logger.Error("register emergency stop hotkey: %v", err)
+			return
+		}
+		defer procUnregisterHotKey.Call(0, emergencyHotkeyID)
+
+		tid := windows.GetCurrentThreadId()
+		stop := context.AfterFunc(ctx, func() {
+			procPostThreadMessageW.Call(uintptr(tid), wmQuit, 0, 0)
+		})
+		defer stop()
+
+		var msg winMsg
+		for {
+			// Returns 0 for WM_QUIT and -1 on error.
+			r, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			if int32(r) <= 0 {
+				return
+			}
+			if msg.message == wmHotkey && msg.wParam == emergencyHotkeyID {
+				a.emergencyStop()
+			}
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package gui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/help"
+	"github.com/user/extorvm/controller/internal/identity"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// identitySwitchTimeout bounds the wait for the VM restart that switches
+// a running VM's identity.
+const identitySwitchTimeout = 2 * time.Minute
+
+// identitySection builds the Settings tab's Tor identity chooser: pick
+// the identity the VM runs with, make a new one, or delete one.
+func (a *App) identitySection() fyne.CanvasObject {
+	store := identity.Open(a.cfg.StateDiskPath)
+	label := widget.NewLabel("Tor identity:")
+	sel := widget.NewSelect(nil, nil)
+	newBtn := widget.NewButton("New...", nil)
+	deleteBtn := widget.NewButton("Delete...", nil)
+
+	// refresh reloads the list and selects the active identity without
+	// triggering a switch.
+	var refresh func()
+	onSelect := func(name string) {
+		active, err := store.Active()
+		if err != nil || name == active {
+			return
+		}
+		dialog.ShowConfirm("Switch Identity",
+			fmt.Sprintf("Switch to the identity %q? Tor uses its guards and keys from the next start; a running VM restarts now, with traffic blocked meanwhile.", name),
+			func(ok bool) {
+				if !ok {
+					refresh()
+					return
+				}
+				a.switchIdentity(store, name, refresh)
+			}, a.window)
+	}
+	refresh = func() {
+		list, err := store.List()
+		if err != nil {
+			a.logger.Error("%v", err)
+			return
+		}
+		names := make([]string, len(list))
+		for i, id := range list {
+			names[i] = id.Name
+		}
+		sel.OnChanged = nil
+		sel.Options = names
+		sel.SetSelected(list[0].Name)
+		sel.OnChanged = onSelect
+		if a.identityLabel != nil {
+			a.identityLabel.SetText("Identity: " + list[0].Name)
+		}
+	}
+
+	newBtn.OnTapped = func() {
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("e.g. publishing")
+		entry.Validator = identity.ValidateName
+		dialog.ShowForm("New Identity", "Create", "Cancel",
+			[]*widget.FormItem{widget.NewFormItem("Name", entry)},
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := store.Create(entry.Text, 0); err != nil {
+					a.showError(err)
+					return
+				}
+				a.logger.Info("Tor identity %s created", entry.Text)
+				refresh()
+			}, a.window)
+	}
+	deleteBtn.OnTapped = func() {
+		name := sel.Selected
+		dialog.ShowConfirm("Delete Identity",
+			fmt.Sprintf("Delete the identity %q? Its guards and keys, including onion service keys, are erased for good.", name),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				if err := store.Delete(name); err != nil {
+					a.showError(err)
+					return
+				}
+				a.logger.Info("Tor identity %s deleted", name)
+				refresh()
+			}, a.window)
+	}
+
+	refresh()
+	if a.backend != nil {
+		// The back end's disks are not the GUI's to move.
+		sel.Disable()
+		newBtn.Disable()
+		deleteBtn.Disable()
+	}
+	return container.NewVBox(
+		a.withHelp(label, help.Identities),
+		container.NewBorder(nil, nil, nil, container.NewHBox(newBtn, deleteBtn), sel),
+	)
+}
+
+// switchIdentity makes name the active identity. A stopped VM starts with
+// it next time. A running VM is restarted with it, keeping the TAP device
+// and routes in place so traffic is blocked rather than leaked meanwhile.
+// done runs on the UI thread afterwards, whether or not the switch
+// happened.
+func (a *App) switchIdentity(store *identity.Store, name string, done func()) {
+	finish := func(err error) {
+		if err != nil {
+			a.logger.Error("%v", err)
+			a.showError(err)
+		} else {
+			a.logger.Info("Tor identity switched to %s", name)
+		}
+		done()
+	}
+	switch {
+	case a.cancel == nil:
+		finish(store.Switch(name))
+		return
+	case a.engine.State() != lifecycle.StateRunning:
+		finish(errors.New("identity: wait until the VM is running, or stop it, to switch identities"))
+		return
+	}
+
+	result := make(chan error, 1)
+	if !a.engine.RequestVMRestart(func() { result <- store.Switch(name) }) {
+		finish(errors.New("identity: the VM is already restarting; try again when it runs"))
+		return
+	}
+	a.goWorker("identity switch", func(ctx context.Context) {
+		var err error
+		select {
+		case err = <-result:
+		case <-time.After(identitySwitchTimeout):
+			err = errors.New("identity: the VM did not restart; the identity was not switched")
+		case <-ctx.Done():
+			return
+		}
+		fyne.Do(func() { finish(err) })
+	})
+}
+
+// activeIdentity returns the name of the state disk's active identity,
+// or "unknown".
+func activeIdentity(stateDiskPath string) string {
+	name, err := identity.Open(stateDiskPath).Active()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
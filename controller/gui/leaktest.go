@@ -0,0 +1,72 @@
+package gui
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/help"
+	"github.com/user/extorvm/controller/internal/leaktest"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// runLeakTest runs the leak checks in the background and shows the
+// results. btn is disabled while they run.
+func (a *App) runLeakTest(btn *widget.Button) {
+	if a.engine.State() != lifecycle.StateRunning {
+		dialog.ShowInformation("Not Ready", "TorVM must be running to test for leaks.", a.window)
+		return
+	}
+	btn.Disable()
+	opts := leaktest.Options{
+		SOCKSAddr: net.JoinHostPort(a.cfg.VMIP, strconv.Itoa(a.cfg.SOCKSPort)),
+	}
+	a.goWorker("leak test", func(ctx context.Context) {
+		results, err := leaktest.Run(ctx, opts)
+		fyne.Do(func() {
+			btn.Enable()
+			if err != nil {
+				dialog.ShowError(err, a.window)
+				return
+			}
+			a.showLeakTestResults(results)
+		})
+	})
+}
+
+func (a *App) showLeakTestResults(results []leaktest.Result) {
+	var b strings.Builder
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if r.Passed {
+			a.logger.Info("leak test: %s passed: %s", r.Name, r.Detail)
+		} else {
+			status = "FAIL"
+			failed++
+			a.logger.Error("leak test: %s FAILED: %s", r.Name, r.Detail)
+		}
+		b.WriteString(status + "  " + r.Name + "\n      " + r.Detail + "\n")
+	}
+	title := "Leak Test Passed"
+	if failed > 0 {
+		title = "Leak Test: " + strconv.Itoa(failed) + " Check(s) Failed"
+	}
+	text := widget.NewLabel(b.String())
+	text.Wrapping = fyne.TextWrapWord
+	var d dialog.Dialog = dialog.NewCustom(title, "Close", text, a.window)
+	if failed > 0 {
+		d = dialog.NewCustomConfirm(title, "Help: Leak test", "Close", text, func(open bool) {
+			if open {
+				a.showHelp(help.LeakTest)
+			}
+		}, a.window)
+	}
+	d.Resize(fyne.NewSize(520, 0))
+	d.Show()
+}
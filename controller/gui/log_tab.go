@@ -16,8 +16,12 @@ import (
 func (a *App) logTab() fyne.CanvasObject {
 	a.logView = NewLogView(a.ring)
 
-	// Register callback so new lines trigger a UI refresh.
+	// Register callback so new lines trigger a UI refresh. doQuit
+	// unregisters it; lines logged while quitting are dropped.
 	a.ring.OnLine(func(_ string) {
+		if a.ctx.Err() != nil {
+			return
+		}
 		a.logView.Refresh()
 	})
 
@@ -39,7 +43,7 @@ func (a *App) logTab() fyne.CanvasObject {
 	})
 
 	copyBtn := widget.NewButton("Copy", func() {
-		a.window.Clipboard().SetContent(a.logView.CopyText())
+		a.copyText(a.logView.CopyText())
 	})
 
 	exportBtn := widget.NewButton("Export", func() {
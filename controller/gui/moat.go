@@ -0,0 +1,131 @@
+package gui
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/moat"
+)
+
+// showRequestBridges asks which bridges to request from the Tor
+// Project's Moat service, and how to reach it, then requests them: obfs4
+// bridges after a CAPTCHA, the built-in snowflake and meek-azure bridges
+// right away.
+func (a *App) showRequestBridges() {
+	transport := widget.NewSelect([]string{"obfs4", "snowflake", "meek-azure"}, nil)
+	if a.cfg.Bridge.Transport == "snowflake" || a.cfg.Bridge.Transport == "meek-azure" {
+		transport.SetSelected(a.cfg.Bridge.Transport)
+	} else {
+		transport.SetSelected("obfs4")
+	}
+	fronted := widget.NewCheck("Hide the request behind a CDN (domain fronting)", nil)
+
+	form := container.NewVBox(
+		widget.NewLabel("TorVM asks bridges.torproject.org for bridges and adds them to your bridge lines.\nobfs4 bridges need a CAPTCHA solved first."),
+		widget.NewForm(widget.NewFormItem("Transport", transport)),
+		fronted,
+	)
+	d := dialog.NewCustomConfirm("Request Bridges", "Request", "Cancel", form, func(ok bool) {
+		if !ok {
+			return
+		}
+		c := moat.Direct()
+		if fronted.Checked {
+			c = moat.Fronted()
+		}
+		if transport.Selected == "obfs4" {
+			a.fetchCaptcha(c, "")
+			return
+		}
+		pt := transport.Selected
+		a.goWorker("moat builtin", func(ctx context.Context) {
+			lines, err := c.Builtin(ctx, pt)
+			fyne.Do(func() { a.bridgesReceived(pt, lines, err) })
+		})
+	}, a.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
+
+// fetchCaptcha fetches a CAPTCHA for obfs4 bridges and shows it, with
+// note above it if that is not "".
+func (a *App) fetchCaptcha(c *moat.Client, note string) {
+	a.goWorker("moat fetch", func(ctx context.Context) {
+		ch, err := c.Fetch(ctx, "obfs4")
+		fyne.Do(func() {
+			if err != nil {
+				a.logger.Error("request bridges: %v", err)
+				a.showError(err)
+				return
+			}
+			a.showCaptcha(c, ch, note)
+		})
+	})
+}
+
+func (a *App) showCaptcha(c *moat.Client, ch *moat.Challenge, note string) {
+	img := canvas.NewImageFromReader(bytes.NewReader(ch.Image), "captcha")
+	img.FillMode = canvas.ImageFillContain
+	img.SetMinSize(fyne.NewSize(400, 125))
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Enter the characters in the image")
+
+	items := []fyne.CanvasObject{img, entry}
+	if note != "" {
+		items = append([]fyne.CanvasObject{widget.NewLabel(note)}, items...)
+	}
+	d := dialog.NewCustomConfirm("Solve the CAPTCHA", "Submit", "Cancel", container.NewVBox(items...), func(ok bool) {
+		if !ok {
+			return
+		}
+		solution := entry.Text
+		a.goWorker("moat check", func(ctx context.Context) {
+			lines, err := c.Check(ctx, ch, solution)
+			fyne.Do(func() {
+				if errors.Is(err, moat.ErrWrongSolution) {
+					a.fetchCaptcha(c, "That was not right. Please try this one.")
+					return
+				}
+				a.bridgesReceived(ch.Transport, lines, err)
+			})
+		})
+	}, a.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
+
+// bridgesReceived adds the bridge lines received for transport to the
+// config, turns bridges on with that transport, and saves the config.
+func (a *App) bridgesReceived(transport string, lines []string, err error) {
+	if err != nil {
+		a.logger.Error("request bridges: %v", err)
+		a.showError(err)
+		return
+	}
+	b := &a.cfg.Bridge
+	msg := fmt.Sprintf("Added %d %s bridge(s).", len(lines), transport)
+	if b.Transport != transport && len(b.Bridges) > 0 {
+		// Lines for another transport would not be used.
+		msg += fmt.Sprintf(" They replace your %d %s bridge(s).", len(b.Bridges), orNone(b.Transport))
+		b.Bridges = nil
+	}
+	for _, line := range lines {
+		if !slices.Contains(b.Bridges, line) {
+			b.Bridges = append(b.Bridges, line)
+		}
+	}
+	b.UseBridges, b.Transport = true, transport
+	a.logger.Info("received %d %s bridge(s) from the Moat service", len(lines), transport)
+	a.rebuildConfigTabs()
+	a.saveConfig()
+	dialog.ShowInformation("Request Bridges", msg, a.window)
+}
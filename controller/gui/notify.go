@@ -0,0 +1,41 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// setupNotifications sends desktop notifications for events a user with
+// the window minimized to the tray must not miss: loss of protection
+// (failsafe, VM exit), devices sharing the connection without it, and Tor
+// becoming ready.
+func (a *App) setupNotifications() {
+	a.engine.FailSafe.OnActivate(func() {
+		a.notify("TorVM: traffic blocked",
+			"The failsafe is active. Host network traffic is blocked until TorVM recovers or is stopped.")
+	})
+	a.engine.OnVMExit(func(err error) {
+		a.notify("TorVM: VM exited unexpectedly",
+			"The Tor VM stopped ("+err.Error()+"). Traffic is no longer protected by Tor.")
+	})
+	a.engine.Events.Subscribe(func(ev lifecycle.Event) {
+		if ev.Kind == lifecycle.EventSharing && !ev.Active {
+			a.notify("TorVM: shared connection not protected",
+				"This computer shares its connection on "+ev.Summary+". Devices using it are NOT routed through Tor.")
+		}
+	})
+	a.engine.OnStateChange(func(from, to lifecycle.State) {
+		if from == lifecycle.StateWaitBootstrap && to == lifecycle.StateRunning {
+			a.notify("TorVM: connected", "Tor has bootstrapped. Traffic is routed through Tor.")
+		}
+	})
+}
+
+// notify sends a desktop notification. It may be called from any
+// goroutine, including with engine locks held.
+func (a *App) notify(title, content string) {
+	fyne.Do(func() {
+		a.fyneApp.SendNotification(fyne.NewNotification(title, content))
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/help"
 )
 
 // proxyTab builds the upstream Proxy configuration tab.
@@ -63,7 +65,7 @@ func (a *App) proxyTab() fyne.CanvasObject {
 	}
 
 	return container.NewVBox(
-		widget.NewLabel("Upstream Proxy Type:"),
+		a.withHelp(widget.NewLabel("Upstream Proxy Type:"), help.Proxy),
 		typeSelect,
 		proxyFields,
 		layout.NewSpacer(),
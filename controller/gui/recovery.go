@@ -0,0 +1,142 @@
+package gui
+
+import (
+	"context"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/help"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/platform"
+	"github.com/user/extorvm/controller/internal/recovery"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// recoveryLogLines is how many log lines the recovery assistant shows.
+const recoveryLogLines = 20
+
+// failingState returns the lifecycle state the last run failed in. A run
+// that fails before it starts the VM returns without shutting down and is
+// still in the failing state; any other run records the state it left
+// for shutdown.
+func (a *App) failingState() lifecycle.State {
+	if s := a.engine.State(); s != lifecycle.StateCleanup {
+		return s
+	}
+	a.failMu.Lock()
+	defer a.failMu.Unlock()
+	return a.failedIn
+}
+
+// showRecovery shows the recovery assistant for a run that ended with
+// err: the failing state, the most likely cause, the recent log, and a
+// button for each fix that applies.
+func (a *App) showRecovery(err error) {
+	diag := recovery.Diagnose(a.failingState().String(), err, a.ring.Lines(), recoveryLogLines)
+	a.logger.Info("recovery: %s failed, likely cause: %s", diag.State, diag.Cause.Title)
+
+	errText := widget.NewLabel(diag.Error)
+	errText.Wrapping = fyne.TextWrapWord
+	explain := widget.NewLabel(diag.Cause.Explain)
+	explain.Wrapping = fyne.TextWrapWord
+
+	logText := widget.NewLabel(strings.Join(diag.Log, "\n"))
+	logText.TextStyle = fyne.TextStyle{Monospace: true}
+	logScroll := container.NewScroll(logText)
+	logScroll.SetMinSize(fyne.NewSize(0, 140))
+
+	var d dialog.Dialog
+	fixes := container.NewHBox()
+	for i, fix := range diag.Cause.Fixes {
+		btn := widget.NewButton(fix.String(), nil)
+		if i == 0 {
+			btn.Importance = widget.HighImportance
+		}
+		btn.OnTapped = func() { a.applyFix(fix, btn, d) }
+		fixes.Add(btn)
+	}
+	if topic, ok := help.Lookup(diag.Cause.Topic); ok {
+		fixes.Add(widget.NewButton("Help: "+topic.Title, func() {
+			d.Hide()
+			a.showHelp(topic.ID)
+		}))
+	}
+
+	cause := widget.NewLabelWithStyle("Likely cause: "+diag.Cause.Title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	content := container.NewBorder(
+		container.NewVBox(
+			widget.NewLabel("TorVM failed in state "+diag.State+":"),
+			errText,
+			widget.NewSeparator(),
+			cause,
+			explain,
+			fixes,
+			widget.NewSeparator(),
+			widget.NewLabel("Recent log:"),
+		),
+		nil, nil, nil,
+		logScroll,
+	)
+	d = dialog.NewCustom("TorVM Failed", "Close", content, a.window)
+	d.Resize(fyne.NewSize(600, 520))
+	a.window.Show()
+	d.Show()
+}
+
+// applyFix carries out fix from the recovery dialog d, whose button btn
+// was tapped.
+func (a *App) applyFix(fix recovery.Fix, btn *widget.Button, d dialog.Dialog) {
+	switch fix {
+	case recovery.Retry:
+		d.Hide()
+		a.startVM()
+
+	case recovery.RetryTCG:
+		d.Hide()
+		a.logger.Info("recovery: switching to software emulation (tcg)")
+		a.cfg.Accel = string(platform.TCG)
+		a.startVM()
+
+	case recovery.ResetStateDisk:
+		msg := "The state disk holds Tor's cached consensus and guard choices. " +
+			"Resetting replaces it with an empty disk; Tor rebuilds its state on the next start.\n\nReset the state disk?"
+		dialog.ShowConfirm("Reset State Disk", msg, func(ok bool) {
+			if ok {
+				a.resetStateDisk(btn)
+			}
+		}, a.window)
+
+	case recovery.FetchBridges:
+		d.Hide()
+		a.selectTab("Bridges")
+		a.showRequestBridges()
+
+	case recovery.RunDoctor:
+		a.runChecks(btn)
+	}
+}
+
+// resetStateDisk replaces the state disk in the background. The VM is
+// down after a failed run, as ResetStateDisk requires.
+func (a *App) resetStateDisk(btn *widget.Button) {
+	btn.Disable()
+	path := a.cfg.StateDiskPath
+	a.goWorker("state disk reset", func(ctx context.Context) {
+		err := vm.ResetStateDisk(path)
+		fyne.Do(func() {
+			btn.Enable()
+			if err != nil {
+				a.logger.Error("recovery: %v", err)
+				a.showError(err)
+				return
+			}
+			a.logger.Info("recovery: state disk %s reset", path)
+			btn.SetText("State disk reset")
+			btn.Disable()
+		})
+	})
+}
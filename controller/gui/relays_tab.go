@@ -12,6 +12,7 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/user/extorvm/controller/internal/help"
 	"github.com/user/extorvm/controller/internal/lifecycle"
 	"github.com/user/extorvm/controller/internal/tor"
 )
@@ -365,7 +366,7 @@ func (a *App) relaysTab() fyne.CanvasObject {
 	activeListBox := container.New(layout.NewGridWrapLayout(fyne.NewSize(600, 130)), activeList)
 
 	content := container.NewVBox(
-		header,
+		a.withHelp(header, help.Relays),
 		widget.NewSeparator(),
 		excludeLabel,
 		excludeRow,
@@ -391,7 +392,7 @@ func (a *App) relaysTab() fyne.CanvasObject {
 // hotReloadRelays applies relay exclusion changes to the running Tor instance.
 func (a *App) hotReloadRelays() {
 	if a.engine.State() == lifecycle.StateRunning {
-		if err := a.engine.ReloadConfig(a.cfg); err != nil {
+		if _, err := a.engine.ReloadConfig(a.cfg); err != nil {
 			a.logger.Error("relay hot-reload: %v", err)
 		}
 	}
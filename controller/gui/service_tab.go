@@ -3,8 +3,6 @@
 package gui
 
 import (
-	"time"
-
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
@@ -12,6 +10,8 @@ import (
 	"fyne.io/fyne/v2/widget"
 
 	"github.com/user/extorvm/controller/internal/launchd"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/privhelper"
 )
 
 // serviceTab builds the Service tab for macOS launchd management.
@@ -20,7 +20,7 @@ func (a *App) serviceTab() fyne.CanvasObject {
 	statusLabel.TextStyle = fyne.TextStyle{Bold: true}
 
 	installBtn := widget.NewButton("Install Service", func() {
-		if err := launchd.Install(false); err != nil {
+		if err := launchd.Install(a.cfg.Service, a.configPath); err != nil {
 			dialog.ShowError(err, a.window)
 			return
 		}
@@ -32,7 +32,7 @@ func (a *App) serviceTab() fyne.CanvasObject {
 			dialog.ShowError(err, a.window)
 			return
 		}
-		a.serviceMode = false
+		a.setServiceMode(false)
 		dialog.ShowInformation("Service", "Service uninstalled.", a.window)
 	})
 
@@ -69,6 +69,38 @@ func (a *App) serviceTab() fyne.CanvasObject {
 		d.Show()
 	})
 
+	// The privileged helper, installed once, spares the password prompt
+	// of every action above and of each network change.
+	helperLabel := widget.NewLabel("")
+	var helperInstallBtn, helperRemoveBtn *widget.Button
+	updateHelper := func() {
+		if privhelper.Installed() {
+			helperLabel.SetText("Privileged helper: installed")
+			helperInstallBtn.Disable()
+			helperRemoveBtn.Enable()
+		} else {
+			helperLabel.SetText("Privileged helper: not installed (each change asks for your password)")
+			helperInstallBtn.Enable()
+			helperRemoveBtn.Disable()
+		}
+	}
+	helperInstallBtn = widget.NewButton("Install Helper", func() {
+		if err := privhelper.Install(); err != nil {
+			dialog.ShowError(err, a.window)
+			return
+		}
+		privexec.Default.SetElevator(privhelper.Client{})
+		updateHelper()
+	})
+	helperRemoveBtn = widget.NewButton("Remove Helper", func() {
+		privexec.Default.SetElevator(nil)
+		if err := privhelper.Uninstall(); err != nil {
+			dialog.ShowError(err, a.window)
+		}
+		updateHelper()
+	})
+	updateHelper()
+
 	// Update button/checkbox states based on service status.
 	updateUI := func() {
 		st := launchd.QueryStatus()
@@ -91,7 +123,7 @@ func (a *App) serviceTab() fyne.CanvasObject {
 			bootCheck.Enable()
 			bootCheck.SetChecked(st.RunAtLoad)
 			viewLogsBtn.Enable()
-			a.serviceMode = true
+			a.setServiceMode(true)
 		} else {
 			statusLabel.SetText("Status: Stopped")
 			startBtn.Enable()
@@ -101,20 +133,17 @@ func (a *App) serviceTab() fyne.CanvasObject {
 			bootCheck.Enable()
 			bootCheck.SetChecked(st.RunAtLoad)
 			viewLogsBtn.Enable()
-			a.serviceMode = true
+			a.setServiceMode(true)
 		}
 	}
 
 	// Initial update.
 	updateUI()
 
-	// Poll every 5 seconds.
-	a.serviceTicker = time.NewTicker(5 * time.Second)
-	go func() {
-		for range a.serviceTicker.C {
-			updateUI()
-		}
-	}()
+	a.pollEvery("service status", a.cfg.Polling.ServiceSec, false, func() error {
+		updateUI()
+		return nil
+	})
 
 	return container.NewVBox(
 		widget.NewLabelWithStyle("macOS Service Management", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
@@ -127,6 +156,9 @@ func (a *App) serviceTab() fyne.CanvasObject {
 		bootCheck,
 		widget.NewSeparator(),
 		viewLogsBtn,
+		widget.NewSeparator(),
+		helperLabel,
+		container.NewHBox(helperInstallBtn, helperRemoveBtn),
 		layout.NewSpacer(),
 	)
 }
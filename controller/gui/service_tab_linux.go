@@ -4,7 +4,6 @@ package gui
 
 import (
 	"strconv"
-	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -21,7 +20,7 @@ func (a *App) serviceTab() fyne.CanvasObject {
 	statusLabel.TextStyle = fyne.TextStyle{Bold: true}
 
 	installBtn := widget.NewButton("Install Service", func() {
-		if err := systemd.Install(); err != nil {
+		if err := systemd.Install(a.cfg.Service, a.cfg.Entropy.SerialEntropyDevice); err != nil {
 			dialog.ShowError(err, a.window)
 			return
 		}
@@ -133,13 +132,10 @@ func (a *App) serviceTab() fyne.CanvasObject {
 	// Initial update.
 	updateUI()
 
-	// Poll every 5 seconds.
-	a.serviceTicker = time.NewTicker(5 * time.Second)
-	go func() {
-		for range a.serviceTicker.C {
-			updateUI()
-		}
-	}()
+	a.pollEvery("service status", a.cfg.Polling.ServiceSec, false, func() error {
+		updateUI()
+		return nil
+	})
 
 	return container.NewVBox(
 		widget.NewLabelWithStyle("Linux Service Management", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
@@ -3,8 +3,6 @@
 package gui
 
 import (
-	"time"
-
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
@@ -22,7 +20,7 @@ func (a *App) serviceTab() fyne.CanvasObject {
 	tapStatusLabel := widget.NewLabel("TAP: Checking...")
 
 	installBtn := widget.NewButton("Install Service", func() {
-		if err := winsvc.InstallService(); err != nil {
+		if err := winsvc.InstallService(a.cfg.Service); err != nil {
 			dialog.ShowError(err, a.window)
 			return
 		}
@@ -83,13 +81,10 @@ func (a *App) serviceTab() fyne.CanvasObject {
 	// Initial update.
 	updateUI()
 
-	// Poll every 5 seconds.
-	a.serviceTicker = time.NewTicker(5 * time.Second)
-	go func() {
-		for range a.serviceTicker.C {
-			updateUI()
-		}
-	}()
+	a.pollEvery("service status", a.cfg.Polling.ServiceSec, false, func() error {
+		updateUI()
+		return nil
+	})
 
 	return container.NewVBox(
 		widget.NewLabelWithStyle("Windows Service Management", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
@@ -0,0 +1,42 @@
+package gui
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// setupSessionReport shows the session report when a session shuts down
+// cleanly.
+func (a *App) setupSessionReport() {
+	a.engine.OnSessionEnd(func(r lifecycle.SessionReport) {
+		fyne.Do(func() { a.showSessionReport(r) })
+	})
+}
+
+func (a *App) showSessionReport(r lifecycle.SessionReport) {
+	form := widget.NewForm(
+		widget.NewFormItem("Duration", widget.NewLabel(r.Duration().Round(time.Second).String())),
+		widget.NewFormItem("Received", widget.NewLabel(lifecycle.FormatBytes(r.BytesRead))),
+		widget.NewFormItem("Sent", widget.NewLabel(lifecycle.FormatBytes(r.BytesWritten))),
+		widget.NewFormItem("New identities", widget.NewLabel(strconv.Itoa(r.Identities))),
+		widget.NewFormItem("Circuits built", widget.NewLabel(strconv.Itoa(r.Circuits))),
+		widget.NewFormItem("Errors", widget.NewLabel(strconv.Itoa(r.ErrorCount))),
+	)
+	content := []fyne.CanvasObject{form}
+	if len(r.Errors) > 0 {
+		errs := widget.NewLabel(strings.Join(r.Errors, "\n"))
+		errs.Wrapping = fyne.TextWrapWord
+		content = append(content, errs)
+	}
+	d := dialog.NewCustom("TorVM Session Report", "Close", container.NewVBox(content...), a.window)
+	d.Resize(fyne.NewSize(520, 0))
+	d.Show()
+}
@@ -1,9 +1,11 @@
 package gui
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -11,6 +13,10 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/datadir"
+	"github.com/user/extorvm/controller/internal/help"
 )
 
 // settingsTab builds the Settings tab.
@@ -20,6 +26,11 @@ func (a *App) settingsTab() fyne.CanvasObject {
 	origCPU := a.cfg.VMCPUs
 	origSOCKS := a.cfg.SOCKSPort
 	origVerbose := a.cfg.Verbose
+	origDisk := a.cfg.Disk
+	origPanicWipe := a.cfg.PanicWipe
+	origPanicLock := a.cfg.PanicLock
+	origWipeOnExit := a.cfg.WipeOnExit
+	origPauseUnroute := a.cfg.PauseUnroute
 
 	dirty := false
 	var settingsTabItem *container.TabItem // set later to update label
@@ -28,7 +39,12 @@ func (a *App) settingsTab() fyne.CanvasObject {
 		isDirty := a.cfg.VMMemoryMB != origMem ||
 			a.cfg.VMCPUs != origCPU ||
 			a.cfg.SOCKSPort != origSOCKS ||
-			a.cfg.Verbose != origVerbose
+			a.cfg.Verbose != origVerbose ||
+			a.cfg.Disk != origDisk ||
+			a.cfg.PanicWipe != origPanicWipe ||
+			a.cfg.PanicLock != origPanicLock ||
+			a.cfg.WipeOnExit != origWipeOnExit ||
+			a.cfg.PauseUnroute != origPauseUnroute
 		if isDirty != dirty {
 			dirty = isDirty
 			if a.tabs != nil && settingsTabItem != nil {
@@ -86,6 +102,61 @@ func (a *App) settingsTab() fyne.CanvasObject {
 	})
 	verboseCheck.Checked = a.cfg.Verbose
 
+	// State disk I/O limits; 0 leaves a limit off.
+	diskValidLabel := widget.NewLabel("")
+	diskValidLabel.TextStyle = fyne.TextStyle{Italic: true}
+	limitEntry := func(val *int) *widget.Entry {
+		entry := widget.NewEntry()
+		entry.SetText(strconv.Itoa(*val))
+		entry.OnChanged = func(s string) {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || n > 1000000 {
+				diskValidLabel.SetText("Invalid limit (0-1000000, 0 = unlimited)")
+				return
+			}
+			diskValidLabel.SetText("")
+			*val = n
+			markDirty()
+		}
+		return entry
+	}
+	readMBEntry := limitEntry(&a.cfg.Disk.ReadMBps)
+	writeMBEntry := limitEntry(&a.cfg.Disk.WriteMBps)
+	readIOPSEntry := limitEntry(&a.cfg.Disk.ReadIOPS)
+	writeIOPSEntry := limitEntry(&a.cfg.Disk.WriteIOPS)
+	diskForm := widget.NewForm(
+		widget.NewFormItem("Read MB/s", readMBEntry),
+		widget.NewFormItem("Write MB/s", writeMBEntry),
+		widget.NewFormItem("Read IOPS", readIOPSEntry),
+		widget.NewFormItem("Write IOPS", writeIOPSEntry),
+	)
+
+	panicWipeCheck := widget.NewCheck("Emergency Stop also wipes the state disk", func(on bool) {
+		a.cfg.PanicWipe = on
+		markDirty()
+	})
+	panicWipeCheck.Checked = a.cfg.PanicWipe
+
+	panicLockCheck := widget.NewCheck("Emergency Stop also locks the screen", func(on bool) {
+		a.cfg.PanicLock = on
+		markDirty()
+	})
+	panicLockCheck.Checked = a.cfg.PanicLock
+
+	wipeOnExitCheck := widget.NewCheck("Shred the torrc overlay and temporary files when the VM stops", func(on bool) {
+		a.cfg.WipeOnExit = on
+		markDirty()
+	})
+	wipeOnExitCheck.Checked = a.cfg.WipeOnExit
+
+	pauseUnrouteCheck := widget.NewCheck("While paused, route traffic outside Tor", func(on bool) {
+		a.cfg.PauseUnroute = on
+		markDirty()
+	})
+	pauseUnrouteCheck.Checked = a.cfg.PauseUnroute
+
+	autostartCheck := a.autostartCheck()
+
 	configPathLabel := widget.NewLabel("Config: " + a.configPath)
 
 	saveBtn := widget.NewButton("Save Config", func() {
@@ -95,6 +166,11 @@ func (a *App) settingsTab() fyne.CanvasObject {
 		origCPU = a.cfg.VMCPUs
 		origSOCKS = a.cfg.SOCKSPort
 		origVerbose = a.cfg.Verbose
+		origDisk = a.cfg.Disk
+		origPanicWipe = a.cfg.PanicWipe
+		origPanicLock = a.cfg.PanicLock
+		origWipeOnExit = a.cfg.WipeOnExit
+		origPauseUnroute = a.cfg.PauseUnroute
 		markDirty()
 	})
 
@@ -109,29 +185,54 @@ func (a *App) settingsTab() fyne.CanvasObject {
 				a.cfg.VMCPUs = 2
 				a.cfg.SOCKSPort = 9050
 				a.cfg.Verbose = false
+				a.cfg.Disk = config.DiskConfig{}
+				a.cfg.PanicWipe = false
+				a.cfg.PanicLock = false
+				a.cfg.WipeOnExit = false
+				a.cfg.PauseUnroute = false
 				memSlider.SetValue(float64(a.cfg.VMMemoryMB))
 				cpuSlider.SetValue(float64(a.cfg.VMCPUs))
 				socksEntry.SetText(strconv.Itoa(a.cfg.SOCKSPort))
 				verboseCheck.SetChecked(a.cfg.Verbose)
+				panicWipeCheck.SetChecked(false)
+				panicLockCheck.SetChecked(false)
+				wipeOnExitCheck.SetChecked(false)
+				pauseUnrouteCheck.SetChecked(false)
 				socksValidLabel.SetText("")
+				for _, e := range []*widget.Entry{readMBEntry, writeMBEntry, readIOPSEntry, writeIOPSEntry} {
+					e.SetText("0")
+				}
 				markDirty()
 			}, a.window)
 	})
 
 	content := container.NewVBox(
-		accelLabel,
+		a.withHelp(accelLabel, help.Acceleration),
 		widget.NewSeparator(),
-		memLabel,
+		a.withHelp(memLabel, help.VMResources),
 		memSlider,
 		widget.NewSeparator(),
-		cpuLabel,
+		a.withHelp(cpuLabel, help.VMResources),
 		cpuSlider,
 		widget.NewSeparator(),
-		widget.NewLabel("SOCKS Port:"),
+		a.withHelp(widget.NewLabel("SOCKS Port:"), help.SOCKS),
 		socksEntry,
 		socksValidLabel,
 		widget.NewSeparator(),
-		verboseCheck,
+		a.withHelp(verboseCheck, help.Logging),
+		widget.NewSeparator(),
+		a.withHelp(widget.NewLabel("State Disk Limits (0 = unlimited):"), help.DiskLimits),
+		diskForm,
+		diskValidLabel,
+		widget.NewSeparator(),
+		a.withHelp(panicWipeCheck, help.EmergencyStop),
+		a.withHelp(panicLockCheck, help.EmergencyStop),
+		a.withHelp(wipeOnExitCheck, help.WipeOnExit),
+		a.withHelp(pauseUnrouteCheck, help.Pause),
+		widget.NewSeparator(),
+		a.withHelp(autostartCheck, help.Autostart),
+		widget.NewSeparator(),
+		a.identitySection(),
 		widget.NewSeparator(),
 		configPathLabel,
 		container.NewHBox(saveBtn, resetBtn),
@@ -141,9 +242,13 @@ func (a *App) settingsTab() fyne.CanvasObject {
 	// Store tab item reference for dirty label updates.
 	// The tab item is created in app.go, so we find it after Run() sets up tabs.
 	// Poll with sleep instead of busy-wait to avoid CPU spin.
-	go func() {
+	a.goWorker("settings tab lookup", func(ctx context.Context) {
 		for a.tabs == nil {
-			time.Sleep(50 * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
 		}
 		for _, item := range a.tabs.Items {
 			if item.Text == "Settings" || item.Text == "Settings *" {
@@ -151,7 +256,7 @@ func (a *App) settingsTab() fyne.CanvasObject {
 				break
 			}
 		}
-	}()
+	})
 
 	return content
 }
@@ -159,10 +264,16 @@ func (a *App) settingsTab() fyne.CanvasObject {
 func (a *App) saveConfig() {
 	path := a.configPath
 	if path == "" {
-		path = "torvm.json"
+		dirs := datadir.Default()
+		if err := dirs.Ensure(); err != nil {
+			dialog.ShowError(err, a.window)
+			return
+		}
+		path = dirs.ConfigFile()
+		a.configPath = path
 	}
 
-	data, err := json.MarshalIndent(a.cfg, "", "  ")
+	data, err := config.Marshal(a.cfg, config.FormatOf(path))
 	if err != nil {
 		dialog.ShowError(err, a.window)
 		return
@@ -173,5 +284,28 @@ func (a *App) saveConfig() {
 		return
 	}
 
-	dialog.ShowInformation("Saved", "Configuration saved to "+path, a.window)
+	// Apply what changed, each change when it can take effect.
+	diff, err := a.engine.ReloadConfig(a.cfg)
+	if err != nil {
+		a.logger.Error("apply saved config: %v", err)
+	}
+	dialog.ShowInformation("Saved", "Configuration saved to "+path+savedSummary(diff), a.window)
+}
+
+// savedSummary says when the changes of a saved config take effect.
+func savedSummary(diff config.ConfigDiff) string {
+	var b strings.Builder
+	for _, g := range []struct {
+		title  string
+		fields []string
+	}{
+		{"Applied now", diff.HotReloadable},
+		{"Applies from the next VM start", diff.RestartRequired},
+		{"Restart TorVM to apply", diff.RestartNow},
+	} {
+		if len(g.fields) > 0 {
+			fmt.Fprintf(&b, "\n\n%s: %s", g.title, strings.Join(g.fields, ", "))
+		}
+	}
+	return b.String()
 }
@@ -0,0 +1,114 @@
+package gui
+
+import (
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/qr"
+)
+
+// showShareCode shows the bridge, transport, and proxy settings as a
+// share code and QR code, for handing a working setup to someone else.
+func (a *App) showShareCode() {
+	code, err := a.cfg.Share().Encode()
+	if err != nil {
+		a.showError(err)
+		return
+	}
+
+	text := widget.NewEntry()
+	text.SetText(code)
+	text.Wrapping = fyne.TextWrapBreak
+	text.MultiLine = true
+	text.SetMinRowsVisible(3)
+	copyBtn := widget.NewButton("Copy", func() {
+		a.copyText(code)
+	})
+
+	items := []fyne.CanvasObject{
+		widget.NewLabel("Send this code to the person you are helping, or let them scan it.\nProxy passwords are not included."),
+	}
+	if c, err := qr.Encode([]byte(code), qr.Low); err == nil {
+		img := canvas.NewImageFromImage(c.Image(4, 4))
+		img.FillMode = canvas.ImageFillContain
+		img.ScaleMode = canvas.ImageScalePixels
+		img.SetMinSize(fyne.NewSize(260, 260))
+		items = append(items, img)
+	} else {
+		items = append(items, widget.NewLabel("Too many bridges for a QR code; share the text instead."))
+	}
+	items = append(items, text, copyBtn)
+
+	d := dialog.NewCustom("Share Settings", "Close", container.NewVBox(items...), a.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
+
+// showImportShare asks for a share code and, once the user confirms the
+// settings it holds, replaces the bridge and proxy settings with them
+// and saves the config.
+func (a *App) showImportShare() {
+	entry := widget.NewMultiLineEntry()
+	entry.SetPlaceHolder(config.ShareCodePrefix + "...")
+	entry.Wrapping = fyne.TextWrapBreak
+	entry.SetMinRowsVisible(4)
+
+	d := dialog.NewCustomConfirm("Import Share Code", "Import", "Cancel", entry, func(ok bool) {
+		if !ok {
+			return
+		}
+		s, err := config.ParseShare(entry.Text)
+		if err != nil {
+			a.showError(err)
+			return
+		}
+		msg := fmt.Sprintf("Bridges: %d, transport: %s", len(s.Bridges), orNone(s.Transport))
+		if s.ProxyType != "" {
+			msg += fmt.Sprintf("\nProxy: %s %s", s.ProxyType, s.ProxyAddr)
+		} else {
+			msg += "\nProxy: none"
+		}
+		msg += "\n\nReplace your bridge and proxy settings with these?"
+		dialog.ShowConfirm("Import Share Code", msg, func(ok bool) {
+			if ok {
+				a.importShare(s)
+			}
+		}, a.window)
+	}, a.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
+
+func (a *App) importShare(s config.Share) {
+	a.cfg.ApplyShare(s)
+	a.logger.Info("imported share code: %d bridge(s), transport %q, proxy %q", len(s.Bridges), s.Transport, s.ProxyType)
+	a.rebuildConfigTabs()
+	a.saveConfig()
+}
+
+// rebuildConfigTabs rebuilds the Bridges and Proxy tabs after their
+// settings changed elsewhere; the tabs read the config when built.
+func (a *App) rebuildConfigTabs() {
+	for _, item := range a.tabs.Items {
+		switch item.Text {
+		case "Bridges":
+			item.Content = a.bridgesTab()
+		case "Proxy":
+			item.Content = a.proxyTab()
+		}
+	}
+	a.tabs.Refresh()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
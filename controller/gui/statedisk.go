@@ -0,0 +1,142 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/datadir"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// stateDiskMissing reports whether the configured state disk does not
+// exist, as on a first run with a state_disk_path of the user's own.
+func (a *App) stateDiskMissing() bool {
+	_, err := os.Stat(a.cfg.StateDiskPath)
+	return os.IsNotExist(err)
+}
+
+// stateDiskTemplate returns the fresh state disk installed with the
+// images, if there is one and the config points elsewhere. The default
+// state disk is not one: a VM may have run with it, and a copy would
+// share its Tor keys and guards.
+func (a *App) stateDiskTemplate() (string, int64) {
+	path := filepath.Join(datadir.Default().Images, "state.img")
+	abs, err1 := filepath.Abs(path)
+	cur, err2 := filepath.Abs(a.cfg.StateDiskPath)
+	if err1 != nil || err2 != nil || abs == cur {
+		return "", 0
+	}
+	fi, err := os.Stat(abs)
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", 0
+	}
+	return abs, fi.Size()
+}
+
+// showCreateStateDisk offers to create the missing state disk, as a copy
+// of the one shipped with TorVM or as a new empty disk of a chosen size,
+// and starts the VM once it exists.
+func (a *App) showCreateStateDisk() {
+	path := a.cfg.StateDiskPath
+	template, templateSize := a.stateDiskTemplate()
+
+	const copyChoice, emptyChoice = "Copy the disk that came with TorVM", "Create an empty disk"
+	sizes := make([]string, len(vm.StateDiskSizes))
+	for i, s := range vm.StateDiskSizes {
+		sizes[i] = formatDiskSize(s)
+	}
+	sizeSelect := widget.NewSelect(sizes, nil)
+	sizeSelect.SetSelectedIndex(0)
+	choice := widget.NewRadioGroup([]string{copyChoice, emptyChoice}, func(s string) {
+		if s == copyChoice {
+			sizeSelect.Disable()
+		} else {
+			sizeSelect.Enable()
+		}
+	})
+	choice.Required = true
+	if template != "" {
+		choice.Options[0] = fmt.Sprintf("%s (%s)", copyChoice, formatDiskSize(templateSize))
+		choice.SetSelected(choice.Options[0])
+	} else {
+		choice.Options = choice.Options[1:]
+		choice.SetSelected(emptyChoice)
+	}
+
+	intro := widget.NewLabel("The state disk, where Tor keeps its keys and guard choices between runs, does not exist yet:\n" + path)
+	intro.Wrapping = fyne.TextWrapWord
+	status := widget.NewLabel("")
+	bar := widget.NewProgressBar()
+	bar.Hide()
+
+	var d dialog.Dialog
+	createBtn := widget.NewButton("Create and Start", nil)
+	createBtn.Importance = widget.HighImportance
+	cancelBtn := widget.NewButton("Cancel", func() { d.Hide() })
+	createBtn.OnTapped = func() {
+		createBtn.Disable()
+		cancelBtn.Disable()
+		choice.Disable()
+		sizeSelect.Disable()
+		bar.Show()
+		useTemplate := choice.Selected != emptyChoice
+		size := vm.StateDiskSizes[sizeSelect.SelectedIndex()]
+		a.goWorker("state disk create", func(ctx context.Context) {
+			var err error
+			if useTemplate {
+				fyne.Do(func() { status.SetText("Copying " + template + "...") })
+				err = vm.CopyStateDisk(path, template, func(done, total int64) {
+					fyne.Do(func() { bar.SetValue(float64(done) / float64(total)) })
+				})
+			} else {
+				fyne.Do(func() { status.SetText("Formatting a " + formatDiskSize(size) + " disk...") })
+				err = vm.CreateStateDisk(path, size)
+			}
+			fyne.Do(func() {
+				if err != nil {
+					a.logger.Error("%v", err)
+					status.SetText("")
+					bar.Hide()
+					createBtn.Enable()
+					cancelBtn.Enable()
+					choice.Enable()
+					choice.OnChanged(choice.Selected)
+					a.showError(err)
+					return
+				}
+				a.logger.Info("created state disk %s", path)
+				bar.SetValue(1)
+				d.Hide()
+				a.startVM()
+			})
+		})
+	}
+
+	content := container.NewVBox(
+		intro,
+		choice,
+		container.NewHBox(widget.NewLabel("Size:"), sizeSelect),
+		status,
+		bar,
+		container.NewHBox(layout.NewSpacer(), cancelBtn, createBtn),
+	)
+	d = dialog.NewCustomWithoutButtons("Create State Disk", content, a.window)
+	d.Resize(fyne.NewSize(480, 0))
+	d.Show()
+}
+
+// formatDiskSize formats a disk size in whole MB or GB.
+func formatDiskSize(n int64) string {
+	if n >= 1<<30 && n%(1<<30) == 0 {
+		return fmt.Sprintf("%d GB", n>>30)
+	}
+	return fmt.Sprintf("%d MB", n>>20)
+}
@@ -1,14 +1,17 @@
 package gui
 
 import (
+	"context"
+	"fmt"
 	"strconv"
-	"time"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 
+	"github.com/user/extorvm/controller/internal/help"
 	"github.com/user/extorvm/controller/internal/launchd"
 	"github.com/user/extorvm/controller/internal/lifecycle"
 )
@@ -20,7 +23,10 @@ func (a *App) statusTab() fyne.CanvasObject {
 	a.stateLabel.TextStyle = fyne.TextStyle{Bold: true}
 
 	modeTxt := "Mode: Direct"
-	if a.serviceMode {
+	switch {
+	case a.backend != nil:
+		modeTxt = "Mode: Back end"
+	case a.serviceMode:
 		modeTxt = "Mode: Service"
 	}
 	a.modeLabel = widget.NewLabel(modeTxt)
@@ -30,52 +36,56 @@ func (a *App) statusTab() fyne.CanvasObject {
 	a.bootstrapBar.Min = 0
 	a.bootstrapBar.Max = 100
 	a.bootstrapLabel = widget.NewLabel("")
+	a.ackLabel = widget.NewLabel("")
+	a.ackLabel.Wrapping = fyne.TextWrapWord
 
 	startBtn := widget.NewButton("Start", func() { a.startVM() })
 	stopBtn := widget.NewButton("Stop", func() { a.stopVM() })
+	a.pauseBtn = widget.NewButton("Pause", a.togglePause)
+	a.pauseBtn.Disable()
 	newIdentityBtn := widget.NewButton("New Identity", func() {
-		if err := a.engine.NewIdentity(); err != nil {
+		if err := a.newIdentity(); err != nil {
 			a.logger.Error("new identity: %v", err)
 		} else {
 			a.logger.Info("Tor identity renewed")
 		}
 	})
 
-	statusRow := container.NewHBox(a.statusLight, a.stateLabel)
-	buttonRow := container.NewHBox(startBtn, stopBtn, newIdentityBtn)
+	var leakTestBtn *widget.Button
+	leakTestBtn = widget.NewButton("Leak Test", func() { a.runLeakTest(leakTestBtn) })
+	var checksBtn *widget.Button
+	checksBtn = widget.NewButton("Run Checks", func() { a.runChecks(checksBtn) })
+
+	statusRow := container.NewHBox(a.statusLight, a.stateLabel, a.helpHint(help.TransparentMode))
+	buttonRow := container.NewHBox(startBtn, stopBtn, a.pauseBtn, newIdentityBtn, leakTestBtn, checksBtn)
 
 	accelLabel := widget.NewLabel("Acceleration: " + a.cfg.Accel)
 	cpuLabel := widget.NewLabel("VM CPUs: " + strconv.Itoa(a.cfg.VMCPUs))
 	memLabel := widget.NewLabel("VM Memory: " + strconv.Itoa(a.cfg.VMMemoryMB) + " MB")
 	hostIPLabel := widget.NewLabel("Host IP: " + a.cfg.HostIP)
 	vmIPLabel := widget.NewLabel("VM IP: " + a.cfg.VMIP)
+	a.identityLabel = widget.NewLabel("Identity: " + activeIdentity(a.cfg.StateDiskPath))
 
 	info := container.NewVBox(
-		accelLabel,
+		a.withHelp(accelLabel, help.Acceleration),
 		cpuLabel,
 		memLabel,
 		hostIPLabel,
 		vmIPLabel,
+		a.withHelp(a.identityLabel, help.Identities),
 	)
 
-	// Register bootstrap progress observer.
-	a.engine.OnBootstrapProgress(func(progress int, summary string) {
-		a.bootstrapBar.SetValue(float64(progress))
-		a.bootstrapLabel.SetText(summary)
-	})
+	a.engine.Events.Subscribe(a.showProgress)
+	a.engine.Events.Subscribe(a.showConfigAck)
+
+	// With a back end, follow its events for status display.
+	if a.backend != nil {
+		a.followBackend()
+	}
 
 	// In service mode, poll launchd for status display.
 	if a.serviceMode {
-		go func() {
-			ticker := time.NewTicker(5 * time.Second)
-			defer ticker.Stop()
-			for range ticker.C {
-				if !a.serviceMode {
-					return
-				}
-				a.pollServiceStatus()
-			}
-		}()
+		a.setServiceMode(true)
 		// Initial poll.
 		a.pollServiceStatus()
 	}
@@ -87,6 +97,7 @@ func (a *App) statusTab() fyne.CanvasObject {
 		widget.NewSeparator(),
 		a.bootstrapBar,
 		a.bootstrapLabel,
+		a.ackLabel,
 		widget.NewSeparator(),
 		info,
 		layout.NewSpacer(),
@@ -96,7 +107,112 @@ func (a *App) statusTab() fyne.CanvasObject {
 // updateStatus is called by the observer to update the status tab.
 func (a *App) updateStatus(_, to lifecycle.State) {
 	a.statusLight.SetState(to)
-	a.stateLabel.SetText(a.statusLight.Description())
+	text := a.statusLight.Description()
+	switch to {
+	case lifecycle.StateShutdown, lifecycle.StateRestoreNetwork, lifecycle.StateCleanup:
+		// Say why, e.g. "Status: TorVM is stopped (the VM crashed)".
+		if reason := a.engine.ShutdownReason(); reason != lifecycle.ShutdownNone {
+			text += " (" + reason.Description() + ")"
+		}
+	}
+	a.stateLabel.SetText(text)
+	switch to {
+	case lifecycle.StateRunning:
+		a.pauseBtn.SetText("Pause")
+		a.pauseBtn.Enable()
+	case lifecycle.StatePaused:
+		a.pauseBtn.SetText("Resume")
+		a.pauseBtn.Enable()
+	default:
+		a.pauseBtn.SetText("Pause")
+		a.pauseBtn.Disable()
+	}
+}
+
+// showProgress follows startup in the progress bar, from the step
+// progress the engine's state, bootstrap and retry events carry.
+func (a *App) showProgress(ev lifecycle.Event) {
+	var value float64
+	var text string
+	switch {
+	case ev.Kind != lifecycle.EventState && ev.Kind != lifecycle.EventBootstrap && ev.Kind != lifecycle.EventRetry:
+		return
+	case ev.Step != nil:
+		value = float64(ev.Step.Percent)
+		text = fmt.Sprintf("Step %d of %d: %s", ev.Step.Step, ev.Step.Steps, ev.Step.Description)
+		if ev.Kind == lifecycle.EventBootstrap && ev.Summary != "" {
+			text += " (" + ev.Summary + ")"
+		}
+		if ev.Step.Retries > 0 {
+			text += fmt.Sprintf(", retry %d", ev.Step.Retries)
+		}
+	case ev.Kind == lifecycle.EventState && ev.To == lifecycle.StateRunning:
+		value, text = 100, "Connected to Tor"
+	case ev.Kind == lifecycle.EventRetry, ev.To == lifecycle.StatePaused:
+		return
+	}
+	fyne.Do(func() {
+		a.bootstrapBar.SetValue(value)
+		a.bootstrapLabel.SetText(text)
+	})
+}
+
+// showConfigAck shows what the VM reports it loaded of the bridge and
+// proxy settings, and clears it when the VM starts again.
+func (a *App) showConfigAck(ev lifecycle.Event) {
+	var text string
+	switch {
+	case ev.Kind == lifecycle.EventConfigAck:
+		text = formatConfigAck(ev.Ack)
+	case ev.Kind == lifecycle.EventState && ev.To != lifecycle.StateRunning && ev.To != lifecycle.StatePaused:
+	default:
+		return
+	}
+	fyne.Do(func() { a.ackLabel.SetText(text) })
+}
+
+// formatConfigAck describes a ConfigAck in a few lines, such as
+// "Bridges: 3 configured, 3 loaded, transport obfs4".
+func formatConfigAck(ack *lifecycle.ConfigAck) string {
+	var lines []string
+	if ack.BridgesConfigured > 0 || ack.BridgesLoaded > 0 {
+		line := fmt.Sprintf("Bridges: %d configured, %d loaded", ack.BridgesConfigured, ack.BridgesLoaded)
+		if len(ack.Transports) > 0 {
+			line += ", transport " + strings.Join(ack.Transports, ", ")
+		}
+		lines = append(lines, line)
+	}
+	if ack.Proxy != "" {
+		lines = append(lines, "Proxy: "+ack.Proxy+" loaded")
+	}
+	if len(lines) == 0 && len(ack.Problems) == 0 {
+		lines = append(lines, "Bridges and proxy: none configured, none loaded")
+	}
+	for _, p := range ack.Problems {
+		lines = append(lines, "Warning: "+p)
+	}
+	if len(ack.Problems) > 0 {
+		lines = append(lines, "Restart the VM to apply the current settings.")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// togglePause pauses the running VM or resumes the paused one. Routing
+// changes with pause_unroute can take a moment, so it runs in a worker.
+func (a *App) togglePause() {
+	pause := a.engine.State() == lifecycle.StateRunning
+	a.goWorker("pause", func(context.Context) {
+		var err error
+		if pause {
+			err = a.engine.Pause()
+		} else {
+			err = a.engine.Resume()
+		}
+		if err != nil {
+			a.logger.Error("%v", err)
+			fyne.Do(func() { a.showError(err) })
+		}
+	})
 }
 
 // pollServiceStatus queries launchd and updates the status widgets.
@@ -109,8 +225,7 @@ func (a *App) pollServiceStatus() {
 		a.statusLight.SetState(lifecycle.StateInit)
 		a.stateLabel.SetText("Stopped (Service)")
 	} else {
-		a.serviceMode = false
-		a.modeLabel.SetText("Mode: Direct")
+		a.setServiceMode(false)
 		a.statusLight.SetState(lifecycle.StateInit)
 		a.stateLabel.SetText("Stopped")
 	}
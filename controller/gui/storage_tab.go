@@ -0,0 +1,159 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/user/extorvm/controller/internal/help"
+	"github.com/user/extorvm/controller/internal/storage"
+)
+
+// SetStorage sets where the controller keeps its files, for the Storage
+// tab.
+func (a *App) SetStorage(opts storage.Options) {
+	a.storageOpts = opts
+}
+
+// storageTab builds the Storage tab: the space used by state disks, logs,
+// and leftovers, a button that removes the reclaimable items, and the
+// retention rules that remove them automatically.
+func (a *App) storageTab() fyne.CanvasObject {
+	var mu sync.Mutex
+	var report storage.Report
+
+	totals := make(map[storage.Category]*widget.Label, len(storage.Categories))
+	totalBox := container.NewVBox()
+	for _, c := range storage.Categories {
+		totals[c] = widget.NewLabel("")
+		totalBox.Add(totals[c])
+	}
+	reclaimLabel := widget.NewLabel("")
+
+	list := widget.NewList(
+		func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(report.Items)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("placeholder storage item")
+		},
+		func(id widget.ListItemID, obj fyne.CanvasObject) {
+			mu.Lock()
+			defer mu.Unlock()
+			if id >= len(report.Items) {
+				return
+			}
+			it := report.Items[id]
+			text := fmt.Sprintf("%s  %s  %s", storage.FormatSize(it.Size), it.Note, it.Path)
+			if it.Reclaimable {
+				text += "  (reclaimable)"
+			}
+			obj.(*widget.Label).SetText(text)
+		},
+	)
+
+	cleanBtn := widget.NewButton("Clean Up", nil)
+	cleanBtn.Disable()
+
+	// show displays a scan; call it on the UI thread.
+	show := func(r storage.Report) {
+		mu.Lock()
+		report = r
+		mu.Unlock()
+		var size int64
+		for _, it := range r.Reclaimable() {
+			size += it.Size
+		}
+		for _, c := range storage.Categories {
+			totals[c].SetText(fmt.Sprintf("%s: %s", c, storage.FormatSize(r.Total(c))))
+		}
+		reclaimLabel.SetText("Reclaimable: " + storage.FormatSize(size))
+		if size > 0 {
+			cleanBtn.Enable()
+		} else {
+			cleanBtn.Disable()
+		}
+		list.Refresh()
+	}
+	// scan rescans in a worker, as walking trial directories may take a
+	// while.
+	scan := func() {
+		a.goWorker("storage scan", func(ctx context.Context) {
+			r, err := storage.Scan(a.storageOpts, time.Now())
+			if err != nil {
+				a.logger.Debug("storage: %v", err)
+			}
+			fyne.Do(func() { show(r) })
+		})
+	}
+
+	cleanBtn.OnTapped = func() {
+		mu.Lock()
+		items := report.Reclaimable()
+		mu.Unlock()
+		dialog.ShowConfirm("Clean Up",
+			fmt.Sprintf("Remove %d rotated logs and leftovers of interrupted work? State disks and current logs are kept.", len(items)),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				freed, err := storage.Clean(items)
+				if err != nil {
+					a.logger.Error("%v", err)
+					a.showError(err)
+				}
+				a.logger.Info("storage: cleanup freed %s", storage.FormatSize(freed))
+				scan()
+			}, a.window)
+	}
+
+	leftoverEntry := widget.NewEntry()
+	leftoverEntry.SetText(strconv.Itoa(a.cfg.Storage.LeftoverDays))
+	leftoverEntry.Validator = retentionDays
+	logEntry := widget.NewEntry()
+	logEntry.SetText(strconv.Itoa(a.cfg.Storage.LogDays))
+	logEntry.Validator = retentionDays
+	saveBtn := widget.NewButton("Save Rules", func() {
+		if leftoverEntry.Validate() != nil || logEntry.Validate() != nil {
+			return
+		}
+		a.cfg.Storage.LeftoverDays, _ = strconv.Atoi(leftoverEntry.Text)
+		a.cfg.Storage.LogDays, _ = strconv.Atoi(logEntry.Text)
+		a.saveConfig()
+	})
+	rules := widget.NewForm(
+		widget.NewFormItem("Remove leftovers after (days)", leftoverEntry),
+		widget.NewFormItem("Remove rotated logs after (days)", logEntry),
+	)
+
+	scan()
+	top := container.NewVBox(
+		a.withHelp(widget.NewLabelWithStyle("Disk usage", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), help.Storage),
+		totalBox,
+		container.NewHBox(reclaimLabel, cleanBtn, widget.NewButton("Refresh", scan)),
+	)
+	bottom := container.NewVBox(
+		widget.NewLabelWithStyle("Retention rules (0 turns a rule off; applied from the next start)", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		rules,
+		container.NewHBox(saveBtn),
+	)
+	return container.NewBorder(top, bottom, nil, nil, list)
+}
+
+// retentionDays validates a retention rule's number of days.
+func retentionDays(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > 3650 {
+		return fmt.Errorf("enter 0-3650 days")
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package gui
 
 import (
+	"fmt"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/driver/desktop"
 
@@ -13,13 +15,52 @@ func (a *App) setupSystemTray() {
 		menu := a.buildTrayMenu()
 		drv.SetSystemTrayMenu(menu)
 		drv.SetSystemTrayIcon(trayIconResource)
+		a.pollEvery("tray bandwidth", a.cfg.Polling.BandwidthSec, true, func() error {
+			a.updateTrayRate()
+			return nil
+		})
+	}
+}
+
+// updateTrayRate refreshes the tray menu when Tor's traffic rate, as
+// shown there, has changed.
+func (a *App) updateTrayRate() {
+	rate := ""
+	if bw, ok := a.engine.Bandwidth(); ok {
+		rate = "↓" + formatRate(bw.BytesRead) + " ↑" + formatRate(bw.BytesWritten)
+	}
+	a.rateMu.Lock()
+	changed := rate != a.trayRate
+	a.trayRate = rate
+	a.rateMu.Unlock()
+	if changed {
+		a.refreshTrayMenu()
 	}
 }
 
+// formatRate formats a rate in bytes per second compactly, e.g. "120 KB/s".
+func formatRate(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB/s", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB/s", n>>10)
+	}
+	return fmt.Sprintf("%d B/s", n)
+}
+
 // buildTrayMenu creates the system tray menu with current state.
 func (a *App) buildTrayMenu() *fyne.Menu {
-	// State label at the top (disabled, informational only).
-	stateItem := fyne.NewMenuItem("TorVM: "+a.engine.State().String(), nil)
+	// State label at the top (disabled, informational only), with the
+	// traffic rate while running.
+	state := a.vmState()
+	header := "TorVM: " + state.String()
+	a.rateMu.Lock()
+	if a.trayRate != "" && state == lifecycle.StateRunning {
+		header += "  " + a.trayRate
+	}
+	a.rateMu.Unlock()
+	stateItem := fyne.NewMenuItem(header, nil)
 	stateItem.Disabled = true
 
 	showItem := fyne.NewMenuItem("Show Window", func() {
@@ -28,11 +69,11 @@ func (a *App) buildTrayMenu() *fyne.Menu {
 	})
 
 	var toggleItem *fyne.MenuItem
-	if a.engine.State() == lifecycle.StateRunning {
+	if state == lifecycle.StateRunning || state == lifecycle.StatePaused {
 		toggleItem = fyne.NewMenuItem("Stop TorVM", func() {
 			a.stopVM()
 		})
-	} else if a.cancel != nil {
+	} else if a.cancel != nil || a.backend != nil && !settled(state) {
 		// Transitional state (starting up / shutting down).
 		toggleItem = fyne.NewMenuItem("TorVM Busy...", nil)
 		toggleItem.Disabled = true
@@ -42,20 +83,44 @@ func (a *App) buildTrayMenu() *fyne.Menu {
 		})
 	}
 
+	// Pause/Resume: freeze the VM without losing Tor's state.
+	pauseItem := fyne.NewMenuItem("Pause TorVM", a.togglePause)
+	switch {
+	case a.backend != nil:
+		pauseItem.Disabled = true
+	case state == lifecycle.StateRunning:
+	case state == lifecycle.StatePaused:
+		pauseItem.Label = "Resume TorVM"
+	default:
+		pauseItem.Disabled = true
+	}
+
 	// New Identity: request a new Tor circuit.
 	newIdentityItem := fyne.NewMenuItem("New Identity", func() {
-		if err := a.engine.NewIdentity(); err != nil {
+		if err := a.newIdentity(); err != nil {
 			a.logger.Error("new identity: %v", err)
 		} else {
 			a.logger.Info("Tor identity renewed via tray")
 		}
 	})
-	if a.engine.State() != lifecycle.StateRunning {
+	if state != lifecycle.StateRunning {
 		newIdentityItem.Disabled = true
 	}
 
+	// Emergency Stop: kill the VM and block traffic at once, without
+	// the graceful shutdown or any confirmation.
+	emergencyItem := fyne.NewMenuItem("Emergency Stop", a.emergencyStop)
+	if a.cancel == nil {
+		emergencyItem.Disabled = true
+	}
+
+	aboutItem := fyne.NewMenuItem("About TorVM", func() {
+		a.window.Show()
+		a.showAbout()
+	})
+
 	quitItem := fyne.NewMenuItem("Quit", func() {
-		a.doQuit()
+		a.confirmActiveStreams("Quit TorVM", a.doQuit)
 	})
 
 	return fyne.NewMenu("TorVM",
@@ -63,8 +128,12 @@ func (a *App) buildTrayMenu() *fyne.Menu {
 		fyne.NewMenuItemSeparator(),
 		showItem,
 		toggleItem,
+		pauseItem,
 		newIdentityItem,
 		fyne.NewMenuItemSeparator(),
+		emergencyItem,
+		fyne.NewMenuItemSeparator(),
+		aboutItem,
 		quitItem,
 	)
 }
@@ -78,9 +147,13 @@ func (a *App) refreshTrayMenu() {
 
 // doQuit performs a clean quit: stop VM if running, then exit.
 func (a *App) doQuit() {
-	if a.serviceTicker != nil {
-		a.serviceTicker.Stop()
+	if a.poller != nil {
+		a.poller.Stop()
+	}
+	if a.stopWorkers != nil {
+		a.stopWorkers()
 	}
+	a.ring.OnLine(nil)
 	if a.cancel != nil {
 		a.cancel()
 	}
@@ -8,34 +8,76 @@ import (
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
 	"github.com/user/extorvm/controller/internal/lifecycle"
 	"github.com/user/extorvm/controller/internal/logging"
 )
 
-// StatusLight is a colored circle widget that reflects lifecycle state.
+// StatusLight shows lifecycle state as a colored dot with a shape inside
+// it and a short label beside it. Color is never the only cue: the shape
+// and label differ for every status, so the light reads the same without
+// color vision.
 type StatusLight struct {
 	widget.BaseWidget
-	dot       *canvas.Circle
 	lastState lifecycle.State
+	indicator statusIndicator
+}
+
+// statusShape is the symbol drawn inside the dot.
+type statusShape int
+
+const (
+	shapeCheck  statusShape = iota // running
+	shapeCross                     // failed
+	shapeSquare                    // stopped
+	shapePause                     // paused
+	shapeDots                      // starting or stopping
+)
+
+// statusIndicator is how a StatusLight shows one status.
+type statusIndicator struct {
+	color color.Color
+	shape statusShape
+	label string
+}
+
+// indicatorForState maps a lifecycle state to its indicator. The colors
+// have at least 4.5:1 contrast against the white symbols drawn on them.
+func indicatorForState(st lifecycle.State) statusIndicator {
+	switch st {
+	case lifecycle.StateRunning:
+		return statusIndicator{color.NRGBA{R: 0, G: 120, B: 0, A: 255}, shapeCheck, "Running"}
+	case lifecycle.StateFailed:
+		return statusIndicator{color.NRGBA{R: 200, G: 0, B: 0, A: 255}, shapeCross, "Error"}
+	case lifecycle.StatePaused:
+		return statusIndicator{color.NRGBA{R: 0, G: 90, B: 200, A: 255}, shapePause, "Paused"}
+	case lifecycle.StateInit, lifecycle.StateCleanup, lifecycle.StateShutdown,
+		lifecycle.StateRestoreNetwork:
+		return statusIndicator{color.NRGBA{R: 100, G: 100, B: 100, A: 255}, shapeSquare, "Stopped"}
+	default:
+		return statusIndicator{color.NRGBA{R: 160, G: 90, B: 0, A: 255}, shapeDots, "Starting"}
+	}
 }
 
 // NewStatusLight creates a StatusLight starting in Init state.
 func NewStatusLight() *StatusLight {
-	s := &StatusLight{}
-	s.dot = canvas.NewCircle(colorForState(lifecycle.StateInit))
-	s.dot.StrokeWidth = 1
-	s.dot.StrokeColor = color.Black
+	s := &StatusLight{indicator: indicatorForState(lifecycle.StateInit)}
 	s.ExtendBaseWidget(s)
 	return s
 }
 
-// SetState updates the displayed state color.
+// SetState updates the displayed color, shape, and label.
 func (s *StatusLight) SetState(st lifecycle.State) {
 	s.lastState = st
-	s.dot.FillColor = colorForState(st)
-	s.dot.Refresh()
+	s.indicator = indicatorForState(st)
+	s.Refresh()
+}
+
+// Label returns the short label shown beside the dot, e.g. "Running".
+func (s *StatusLight) Label() string {
+	return s.indicator.label
 }
 
 // Description returns a human-readable description of the current state,
@@ -49,42 +91,123 @@ func (s *StatusLight) Description() string {
 	case lifecycle.StateInit, lifecycle.StateCleanup, lifecycle.StateShutdown,
 		lifecycle.StateRestoreNetwork:
 		return "Status: TorVM is stopped"
+	case lifecycle.StatePaused:
+		return "Status: TorVM is paused"
 	case lifecycle.StateWaitBootstrap:
 		return "Status: Waiting for Tor to connect"
 	case lifecycle.StateLaunchVM:
 		return "Status: Launching virtual machine"
 	case lifecycle.StateCreateTAP:
 		return "Status: Creating network adapter"
+	case lifecycle.StateVerifyRoutes:
+		return "Status: Verifying traffic is routed through Tor"
 	default:
 		return "Status: TorVM is starting up"
 	}
 }
 
-// MinSize returns the minimum size for the status light.
-func (s *StatusLight) MinSize() fyne.Size {
-	return fyne.NewSize(24, 24)
-}
+// statusDotSize is the diameter of the dot; statusLabelGap separates it
+// from the label.
+const (
+	statusDotSize  = 24
+	statusLabelGap = 6
+)
 
 // CreateRenderer implements fyne.Widget.
 func (s *StatusLight) CreateRenderer() fyne.WidgetRenderer {
-	return widget.NewSimpleRenderer(s.dot)
+	r := &statusLightRenderer{light: s}
+	r.dot = canvas.NewCircle(color.Transparent)
+	r.dot.StrokeWidth = 2
+	r.dot.StrokeColor = color.Black
+	for i := range r.lines {
+		r.lines[i] = canvas.NewLine(color.White)
+		r.lines[i].StrokeWidth = 2.5
+	}
+	for i := range r.bars {
+		r.bars[i] = canvas.NewRectangle(color.White)
+	}
+	for i := range r.dots {
+		r.dots[i] = canvas.NewCircle(color.White)
+	}
+	r.label = canvas.NewText("", theme.Color(theme.ColorNameForeground))
+	r.label.TextStyle = fyne.TextStyle{Bold: true}
+	r.objects = []fyne.CanvasObject{r.dot, r.lines[0], r.lines[1], r.bars[0], r.bars[1],
+		r.dots[0], r.dots[1], r.dots[2], r.label}
+	r.Refresh()
+	return r
 }
 
-func colorForState(st lifecycle.State) color.Color {
-	switch st {
-	case lifecycle.StateRunning:
-		return color.NRGBA{R: 0, G: 179, B: 0, A: 255} // WCAG AAA 7:1 contrast vs white
-	case lifecycle.StateFailed:
-		return color.NRGBA{R: 230, G: 0, B: 0, A: 255} // WCAG AAA 7:1
-	case lifecycle.StateInit, lifecycle.StateCleanup, lifecycle.StateShutdown,
-		lifecycle.StateRestoreNetwork:
-		return color.NRGBA{R: 140, G: 140, B: 140, A: 255} // WCAG AAA 7:1
-	default:
-		// Starting / transitional states → amber (WCAG AAA ~7:1).
-		return color.NRGBA{R: 190, G: 120, B: 0, A: 255}
+type statusLightRenderer struct {
+	light   *StatusLight
+	dot     *canvas.Circle
+	lines   [2]*canvas.Line      // check mark, cross
+	bars    [2]*canvas.Rectangle // square, pause bars
+	dots    [3]*canvas.Circle    // ellipsis
+	label   *canvas.Text
+	objects []fyne.CanvasObject
+}
+
+func (r *statusLightRenderer) MinSize() fyne.Size {
+	label := r.label.MinSize()
+	return fyne.NewSize(statusDotSize+statusLabelGap+label.Width, max(statusDotSize, label.Height))
+}
+
+func (r *statusLightRenderer) Layout(size fyne.Size) {
+	const d = statusDotSize
+	top := (size.Height - d) / 2
+	at := func(x, y float32) fyne.Position { return fyne.NewPos(x*d, top+y*d) }
+	r.dot.Move(fyne.NewPos(0, top))
+	r.dot.Resize(fyne.NewSize(d, d))
+
+	switch r.light.indicator.shape {
+	case shapeCheck:
+		r.lines[0].Position1, r.lines[0].Position2 = at(0.27, 0.52), at(0.44, 0.69)
+		r.lines[1].Position1, r.lines[1].Position2 = at(0.44, 0.69), at(0.73, 0.33)
+	case shapeCross:
+		r.lines[0].Position1, r.lines[0].Position2 = at(0.32, 0.32), at(0.68, 0.68)
+		r.lines[1].Position1, r.lines[1].Position2 = at(0.68, 0.32), at(0.32, 0.68)
+	case shapeSquare:
+		r.bars[0].Move(at(0.33, 0.33))
+		r.bars[0].Resize(fyne.NewSize(0.34*d, 0.34*d))
+	case shapePause:
+		r.bars[0].Move(at(0.32, 0.3))
+		r.bars[1].Move(at(0.56, 0.3))
+		r.bars[0].Resize(fyne.NewSize(0.12*d, 0.4*d))
+		r.bars[1].Resize(fyne.NewSize(0.12*d, 0.4*d))
+	case shapeDots:
+		for i, c := range r.dots {
+			c.Move(at(0.22+float32(i)*0.2, 0.44))
+			c.Resize(fyne.NewSize(0.14*d, 0.14*d))
+		}
+	}
+
+	label := r.label.MinSize()
+	r.label.Move(fyne.NewPos(d+statusLabelGap, (size.Height-label.Height)/2))
+	r.label.Resize(label)
+}
+
+func (r *statusLightRenderer) Refresh() {
+	ind := r.light.indicator
+	r.dot.FillColor = ind.color
+	r.lines[0].Hidden = ind.shape != shapeCheck && ind.shape != shapeCross
+	r.lines[1].Hidden = r.lines[0].Hidden
+	r.bars[0].Hidden = ind.shape != shapeSquare && ind.shape != shapePause
+	r.bars[1].Hidden = ind.shape != shapePause
+	for _, c := range r.dots {
+		c.Hidden = ind.shape != shapeDots
 	}
+	r.label.Text = ind.label
+	r.label.Color = theme.Color(theme.ColorNameForeground)
+	r.Layout(r.light.Size())
+	canvas.Refresh(r.light)
 }
 
+func (r *statusLightRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *statusLightRenderer) Destroy() {}
+
 // LogView wraps a Fyne List widget to efficiently display log lines
 // from a RingWriter with debounced filtering.
 type LogView struct {
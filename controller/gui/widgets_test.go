@@ -0,0 +1,30 @@
+package gui
+
+import (
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// TestIndicatorsDistinctWithoutColor checks that every status a
+// StatusLight can show differs in shape and label, not only in color.
+func TestIndicatorsDistinctWithoutColor(t *testing.T) {
+	shapes := make(map[statusShape]string)
+	labels := make(map[string]statusShape)
+	for st := lifecycle.StateInit; st <= lifecycle.StatePaused; st++ {
+		ind := indicatorForState(st)
+		if ind.label == "" {
+			t.Errorf("%v: empty label", st)
+		}
+		if label, ok := shapes[ind.shape]; ok && label != ind.label {
+			t.Errorf("%v: shape %d is shared by %q and %q", st, ind.shape, label, ind.label)
+		}
+		if shape, ok := labels[ind.label]; ok && shape != ind.shape {
+			t.Errorf("%v: label %q is shared by shapes %d and %d", st, ind.label, shape, ind.shape)
+		}
+		shapes[ind.shape], labels[ind.label] = ind.label, ind.shape
+	}
+	if len(shapes) != 5 {
+		t.Errorf("got %d distinct statuses, want 5", len(shapes))
+	}
+}
@@ -0,0 +1,54 @@
+package gui
+
+import "context"
+
+// goWorker runs fn in a background goroutine scoped to the app: ctx is
+// cancelled when the app quits, and fn must return then. Workers are
+// counted so leaks show up in the debug log.
+func (a *App) goWorker(name string, fn func(ctx context.Context)) {
+	n := a.workers.Add(1)
+	a.logger.Debug("gui: worker %q started (%d active)", name, n)
+	go func() {
+		defer func() {
+			n := a.workers.Add(-1)
+			a.logger.Debug("gui: worker %q stopped (%d active)", name, n)
+		}()
+		fn(a.ctx)
+	}()
+}
+
+// ActiveWorkers returns the number of background goroutines and poller
+// tasks the GUI is running.
+func (a *App) ActiveWorkers() int {
+	n := int(a.workers.Load())
+	if a.poller != nil {
+		n += a.poller.Len()
+	}
+	return n
+}
+
+// setServiceMode switches between service and direct mode. In service
+// mode a single poller task keeps the status widgets in sync with the
+// launchd service; switching back removes it.
+func (a *App) setServiceMode(on bool) {
+	a.modeMu.Lock()
+	defer a.modeMu.Unlock()
+	a.serviceMode = on
+	switch {
+	case on && a.servicePoll == nil:
+		a.servicePoll = a.pollEvery("service mode status", a.cfg.Polling.ServiceSec, false, func() error {
+			a.pollServiceStatus()
+			return nil
+		})
+	case !on && a.servicePoll != nil:
+		a.servicePoll.Remove()
+		a.servicePoll = nil
+	}
+	if a.modeLabel != nil {
+		if on {
+			a.modeLabel.SetText("Mode: Service")
+		} else {
+			a.modeLabel.SetText("Mode: Direct")
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package gui
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func TestGoWorkerStopsWithApp(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	a := &App{logger: logger}
+	a.ctx, a.stopWorkers = context.WithCancel(context.Background())
+
+	stopped := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		a.goWorker("test", func(ctx context.Context) {
+			<-ctx.Done()
+			stopped <- struct{}{}
+		})
+	}
+	if n := a.ActiveWorkers(); n != 3 {
+		t.Errorf("ActiveWorkers = %d, want 3", n)
+	}
+
+	a.stopWorkers()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-stopped:
+		case <-time.After(time.Second):
+			t.Fatal("worker did not stop")
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for a.ActiveWorkers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := a.ActiveWorkers(); n != 0 {
+		t.Errorf("ActiveWorkers after quit = %d, want 0", n)
+	}
+}
@@ -0,0 +1,300 @@
+// Package about gathers what a support request needs to know about a
+// TorVM installation: the controller build, the QEMU it would run, the
+// guest images it would boot, the host's virtualization capabilities, and
+// the features the configuration turns on. It only reads; nothing is
+// started or changed.
+package about
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/platform"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// Info describes a TorVM installation. The fields that cannot be
+// determined carry an Error instead.
+type Info struct {
+	Version  string   `json:"version"`
+	Go       string   `json:"go"`
+	OS       string   `json:"os"`
+	Arch     string   `json:"arch"`
+	Build    Build    `json:"build"`
+	QEMU     QEMU     `json:"qemu"`
+	Kernel   Image    `json:"kernel"`
+	Initrd   Image    `json:"initrd"`
+	Platform Platform `json:"platform"`
+	Features []string `json:"features"`
+}
+
+// Build identifies the source the controller was built from, as the Go
+// toolchain recorded it.
+type Build struct {
+	Revision string `json:"revision,omitempty"` // VCS commit
+	Time     string `json:"time,omitempty"`     // commit time
+	Modified bool   `json:"modified,omitempty"` // built from a dirty tree
+	Tags     string `json:"tags,omitempty"`     // build tags
+}
+
+// QEMU describes the QEMU binary the controller would launch.
+type QEMU struct {
+	Path    string   `json:"path,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Accels  []string `json:"accels,omitempty"` // accelerators it was built with
+	Error   string   `json:"error,omitempty"`
+}
+
+// Image describes a guest image file.
+type Image struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Version string `json:"version,omitempty"` // kernel release, x86 kernels only
+	Error   string `json:"error,omitempty"`
+}
+
+// Platform describes the host's virtualization capabilities.
+type Platform struct {
+	Accel    string `json:"accel"` // best accelerator detected
+	VhostNet bool   `json:"vhost_net"`
+	IOMMU    bool   `json:"iommu"`
+	Elevated bool   `json:"elevated"` // running with the privileges TorVM needs
+}
+
+// Collect gathers the Info for a controller of the given version running
+// cfg. It runs QEMU to ask for its version and reads the guest images
+// whole to hash them, so it takes a moment.
+func Collect(cfg *config.Config, version string) *Info {
+	info := &Info{
+		Version:  version,
+		Go:       runtime.Version(),
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Build:    buildInfo(),
+		QEMU:     qemuInfo(),
+		Kernel:   imageInfo(cfg.KernelPath, true),
+		Initrd:   imageInfo(cfg.InitrdPath, false),
+		Features: Features(cfg),
+	}
+	if p, _ := platform.Detect(); p != nil {
+		info.Platform = Platform{
+			Accel:    string(p.Accel),
+			VhostNet: p.VhostNet,
+			IOMMU:    p.IOMMUSupport,
+		}
+	}
+	info.Platform.Elevated = platform.Elevated()
+	return info
+}
+
+func buildInfo() Build {
+	var b Build
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		case "-tags":
+			b.Tags = s.Value
+		}
+	}
+	return b
+}
+
+func qemuInfo() QEMU {
+	path, v, _, err := vm.ProbeQEMU()
+	q := QEMU{Path: path}
+	if v != (vm.QEMUVersion{}) {
+		q.Version = v.String()
+	}
+	if err != nil {
+		q.Error = err.Error()
+	}
+	if path != "" {
+		q.Accels, _ = vm.QEMUAccels(path)
+	}
+	return q
+}
+
+// imageInfo hashes the image at path and, for a kernel, reads its
+// release.
+func imageInfo(path string, kernel bool) Image {
+	img := Image{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		img.Error = err.Error()
+		return img
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		img.Error = err.Error()
+		return img
+	}
+	img.Size = n
+	img.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if kernel {
+		img.Version, _ = KernelVersion(f)
+	}
+	return img
+}
+
+// KernelVersion reads the release of an x86 Linux kernel image (bzImage)
+// from its boot header, e.g. "6.12.13-0-virt". Other images carry no
+// version where it can be found without decompressing them.
+func KernelVersion(r io.ReaderAt) (string, error) {
+	// The setup header: "HdrS" at 0x202, the boot protocol version at
+	// 0x206, and at 0x20e the offset from 0x200 of the version string.
+	var hdr [16]byte
+	if _, err := r.ReadAt(hdr[:], 0x200); err != nil {
+		return "", fmt.Errorf("read kernel header: %w", err)
+	}
+	if string(hdr[2:6]) != "HdrS" || binary.LittleEndian.Uint16(hdr[6:]) < 0x200 {
+		return "", errors.New("not an x86 kernel image")
+	}
+	off := binary.LittleEndian.Uint16(hdr[14:])
+	if off == 0 {
+		return "", errors.New("kernel image has no version string")
+	}
+	buf := make([]byte, 256)
+	n, err := r.ReadAt(buf, 0x200+int64(off))
+	if n == 0 {
+		return "", fmt.Errorf("read kernel version: %w", err)
+	}
+	s, _, _ := strings.Cut(string(buf[:n]), "\x00")
+	// The release comes first, followed by who built it and when.
+	release, _, _ := strings.Cut(s, " ")
+	if release == "" {
+		return "", errors.New("kernel image has no version string")
+	}
+	return release, nil
+}
+
+// Features lists the optional features cfg turns on, by their config
+// keys, with the mode of those that have one.
+func Features(cfg *config.Config) []string {
+	f := []string{}
+	add := func(on bool, name string) {
+		if on {
+			f = append(f, name)
+		}
+	}
+	add(cfg.AutoSubnet, "auto_subnet")
+	add(cfg.KillSwitch, "kill_switch")
+	add(cfg.BlockDNSLeaks, "block_dns_leaks")
+	add(cfg.PauseUnroute, "pause_unroute")
+	add(cfg.GuestFirewall, "guest_firewall")
+	add(cfg.PanicWipe, "panic_wipe_state_disk")
+	add(cfg.PanicLock, "panic_lock_screen")
+	add(cfg.WipeOnExit, "wipe_on_exit")
+	add(cfg.IPv6.Mode != "", "ipv6="+cfg.IPv6.Mode)
+	add(cfg.Sharing.Mode != "", "sharing="+cfg.Sharing.Mode)
+	add(cfg.LAN.Allow, "lan.allow")
+	add(cfg.Bridge.UseBridges, "bridge.use_bridges")
+	add(cfg.Proxy.Type != "", "proxy="+cfg.Proxy.Type)
+	add(len(cfg.TorrcExtra) > 0, "torrc_extra")
+	add(cfg.APISocket != "", "api_socket")
+	add(cfg.GRPCSocket != "", "grpc_socket")
+	add(cfg.Journal.Path != "", "journal")
+	add(cfg.Alerts.Enabled(), "alerts")
+	add(cfg.Maintenance.Enabled, "maintenance")
+	add(len(cfg.Helpers) > 0, "helpers")
+	add(cfg.Browser.Enabled, "browser")
+	add(cfg.FHE.Enabled, "fhe")
+	add(cfg.Vector.Enabled, "vector")
+	return f
+}
+
+// WriteText prints info for people, starting with the line the plain
+// "torvm version" prints.
+func WriteText(w io.Writer, info *Info) {
+	fmt.Fprintf(w, "torvm version %s\n", info.Version)
+
+	build := fmt.Sprintf("%s %s/%s", info.Go, info.OS, info.Arch)
+	if b := info.Build; b.Revision != "" {
+		build += ", revision " + b.Revision
+		if b.Time != "" {
+			build += " (" + b.Time + ")"
+		}
+		if b.Modified {
+			build += ", modified"
+		}
+	}
+	if info.Build.Tags != "" {
+		build += ", tags " + info.Build.Tags
+	}
+	line(w, "build", build)
+
+	q := info.QEMU
+	switch {
+	case q.Path == "":
+		line(w, "qemu", "not found: "+q.Error)
+	case q.Version == "":
+		line(w, "qemu", q.Path+", version unknown: "+q.Error)
+	default:
+		s := q.Version + " at " + q.Path
+		if len(q.Accels) > 0 {
+			s += " (" + strings.Join(q.Accels, ", ") + ")"
+		}
+		if q.Error != "" {
+			s += ": " + q.Error
+		}
+		line(w, "qemu", s)
+	}
+
+	line(w, "kernel", imageText(info.Kernel))
+	line(w, "initrd", imageText(info.Initrd))
+
+	p := info.Platform
+	caps := []string{"accel " + p.Accel}
+	add := func(on bool, yes, no string) {
+		if on {
+			caps = append(caps, yes)
+		} else {
+			caps = append(caps, no)
+		}
+	}
+	add(p.VhostNet, "vhost-net", "no vhost-net")
+	add(p.IOMMU, "IOMMU", "no IOMMU")
+	add(p.Elevated, "elevated", "not elevated")
+	line(w, "platform", strings.Join(caps, ", "))
+
+	features := "none"
+	if len(info.Features) > 0 {
+		features = strings.Join(info.Features, ", ")
+	}
+	line(w, "features", features)
+}
+
+func line(w io.Writer, label, value string) {
+	fmt.Fprintf(w, "  %-9s %s\n", label+":", value)
+}
+
+func imageText(img Image) string {
+	if img.Error != "" {
+		return img.Error
+	}
+	s := img.Path
+	if img.Version != "" {
+		s = img.Version + ", " + s
+	}
+	return s + ", sha256 " + img.SHA256
+}
@@ -0,0 +1,91 @@
+package about
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// bzImage returns the start of an x86 kernel image whose boot header
+// points at version.
+func bzImage(version string) []byte {
+	img := make([]byte, 0x400)
+	copy(img[0x202:], "HdrS")
+	binary.LittleEndian.PutUint16(img[0x206:], 0x20f)
+	binary.LittleEndian.PutUint16(img[0x20e:], 0x100)
+	copy(img[0x300:], version+"\x00")
+	return img
+}
+
+func TestKernelVersion(t *testing.T) {
+	got, err := KernelVersion(bytes.NewReader(bzImage("6.12.13-0-virt (buildd@build-3-21-x86_64) #1-Alpine SMP PREEMPT_DYNAMIC")))
+	if err != nil || got != "6.12.13-0-virt" {
+		t.Errorf("KernelVersion = %q, %v", got, err)
+	}
+	if _, err := KernelVersion(bytes.NewReader(make([]byte, 0x400))); err == nil {
+		t.Error("KernelVersion of an image without a boot header succeeded")
+	}
+	if _, err := KernelVersion(bytes.NewReader(bzImage(""))); err == nil {
+		t.Error("KernelVersion of an empty version string succeeded")
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.KillSwitch = true
+	cfg.IPv6.Mode = "route"
+	cfg.Proxy.Type = "socks5"
+	cfg.Alerts.Push.URL = "https://ntfy.sh/topic"
+	got := Features(cfg)
+	for _, want := range []string{"kill_switch", "ipv6=route", "proxy=socks5", "alerts"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("Features = %v, lacks %q", got, want)
+		}
+	}
+	cfg.KillSwitch = false
+	if slices.Contains(Features(cfg), "kill_switch") {
+		t.Error("Features lists kill_switch while it is off")
+	}
+}
+
+func TestCollectImages(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.KernelPath = filepath.Join(dir, "vmlinuz")
+	cfg.InitrdPath = filepath.Join(dir, "missing.gz")
+	os.WriteFile(cfg.KernelPath, bzImage("6.6.1-virt #1"), 0644)
+
+	info := Collect(cfg, "1.2.3")
+	if info.Kernel.Version != "6.6.1-virt" || len(info.Kernel.SHA256) != 64 || info.Kernel.Size != 0x400 {
+		t.Errorf("Kernel = %+v", info.Kernel)
+	}
+	if info.Initrd.Error == "" {
+		t.Errorf("Initrd = %+v, want an error for the missing file", info.Initrd)
+	}
+
+	var buf bytes.Buffer
+	WriteText(&buf, info)
+	if first, _, _ := strings.Cut(buf.String(), "\n"); first != "torvm version 1.2.3" {
+		t.Errorf("first line %q", first)
+	}
+	if !strings.Contains(buf.String(), "6.6.1-virt, "+cfg.KernelPath+", sha256 "+info.Kernel.SHA256) {
+		t.Errorf("text lacks the kernel:\n%s", buf.String())
+	}
+
+	// The keys "torvm version --json" printed before stay in place.
+	data, _ := json.Marshal(info)
+	var m map[string]any
+	json.Unmarshal(data, &m)
+	for _, key := range []string{"version", "go", "os", "arch", "qemu", "kernel", "initrd", "platform", "features"} {
+		if _, ok := m[key]; !ok {
+			t.Errorf("JSON lacks %q: %s", key, data)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package alert delivers notifications about failsafe activation and VM
+// crash loops to operators of unattended gateways via SMTP or an
+// ntfy/Gotify-style HTTP push endpoint.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// Alert is a single notification.
+type Alert struct {
+	Time    time.Time
+	Subject string
+	Body    string
+}
+
+// Sender delivers alerts to one destination.
+type Sender interface {
+	Send(ctx context.Context, a Alert) error
+}
+
+// Notifier fans alerts out to its senders, suppressing repeats of the same
+// subject within the rate-limit interval.
+type Notifier struct {
+	senders     []Sender
+	minInterval time.Duration
+	timeout     time.Duration
+	logger      *logging.Logger
+	hostname    string
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	clock    clock.Clock // replaceable in tests
+}
+
+// NewNotifier creates a notifier. Alerts with the same subject are sent at
+// most once per minInterval.
+func NewNotifier(senders []Sender, minInterval time.Duration, hostname string, logger *logging.Logger) *Notifier {
+	return &Notifier{
+		senders:     senders,
+		minInterval: minInterval,
+		timeout:     30 * time.Second,
+		logger:      logger,
+		hostname:    hostname,
+		lastSent:    make(map[string]time.Time),
+		clock:       clock.Real,
+	}
+}
+
+// Notify sends an alert in the background unless one with the same
+// subject was sent within the rate-limit interval. It returns false when
+// the alert was suppressed.
+func (n *Notifier) Notify(subject, format string, args ...any) bool {
+	now := n.clock.Now()
+
+	n.mu.Lock()
+	if last, ok := n.lastSent[subject]; ok && now.Sub(last) < n.minInterval {
+		n.mu.Unlock()
+		n.logger.Debug("alert: suppressing %q (rate limited)", subject)
+		return false
+	}
+	n.lastSent[subject] = now
+	n.mu.Unlock()
+
+	a := Alert{
+		Time:    now,
+		Subject: fmt.Sprintf("[TorVM %s] %s", n.hostname, subject),
+		Body:    fmt.Sprintf(format, args...),
+	}
+	go n.send(a)
+	return true
+}
+
+func (n *Notifier) send(a Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	for _, s := range n.senders {
+		if err := s.Send(ctx, a); err != nil {
+			n.logger.Error("alert: deliver %q: %v", a.Subject, err)
+		}
+	}
+}
+
+// CrashLoopDetector reports when the VM has been launched too many times
+// within a sliding window.
+type CrashLoopDetector struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	launches []time.Time
+}
+
+// NewCrashLoopDetector creates a detector that trips after threshold
+// launches within window.
+func NewCrashLoopDetector(threshold int, window time.Duration) *CrashLoopDetector {
+	return &CrashLoopDetector{threshold: threshold, window: window}
+}
+
+// RecordLaunch records a VM launch at t and reports whether the number of
+// launches within the window has reached the threshold.
+func (d *CrashLoopDetector) RecordLaunch(t time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	cutoff := t.Add(-d.window)
+	kept := d.launches[:0]
+	for _, l := range d.launches {
+		if l.After(cutoff) {
+			kept = append(kept, l)
+		}
+	}
+	d.launches = append(kept, t)
+	return len(d.launches) >= d.threshold
+}
+
+// Count returns the number of launches currently inside the window.
+func (d *CrashLoopDetector) Count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.launches)
+}
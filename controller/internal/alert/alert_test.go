@@ -0,0 +1,136 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+type recordSender struct {
+	mu     sync.Mutex
+	alerts []Alert
+	sent   chan struct{}
+}
+
+func (r *recordSender) Send(_ context.Context, a Alert) error {
+	r.mu.Lock()
+	r.alerts = append(r.alerts, a)
+	r.mu.Unlock()
+	r.sent <- struct{}{}
+	return nil
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	rec := &recordSender{sent: make(chan struct{}, 4)}
+	n := NewNotifier([]Sender{rec}, 10*time.Minute, "gw", logger)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	n.clock = clk
+
+	if !n.Notify("Failsafe activated", "first") {
+		t.Fatal("first alert suppressed")
+	}
+	<-rec.sent
+	if n.Notify("Failsafe activated", "second") {
+		t.Error("repeat within interval not suppressed")
+	}
+	if !n.Notify("VM crash loop", "other subject") {
+		t.Error("different subject suppressed")
+	}
+	<-rec.sent
+	clk.Advance(11 * time.Minute)
+	if !n.Notify("Failsafe activated", "third") {
+		t.Error("alert after interval suppressed")
+	}
+	<-rec.sent
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.alerts) != 3 || rec.alerts[0].Subject != "[TorVM gw] Failsafe activated" {
+		t.Errorf("unexpected alerts: %+v", rec.alerts)
+	}
+}
+
+func TestCrashLoopDetector(t *testing.T) {
+	d := NewCrashLoopDetector(3, 10*time.Minute)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if d.RecordLaunch(base) || d.RecordLaunch(base.Add(4*time.Minute)) {
+		t.Fatal("tripped below threshold")
+	}
+	if !d.RecordLaunch(base.Add(8 * time.Minute)) {
+		t.Error("expected trip at third launch within window")
+	}
+	// The first two launches age out of the window.
+	if d.RecordLaunch(base.Add(20 * time.Minute)) {
+		t.Error("tripped after launches aged out")
+	}
+	if d.Count() != 1 {
+		t.Errorf("Count = %d, want 1", d.Count())
+	}
+}
+
+func TestPushSenderFormats(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	defer srv.Close()
+
+	a := Alert{Time: time.Now(), Subject: "[TorVM gw] Failsafe activated", Body: "VM exited"}
+
+	ntfy := &PushSender{URL: srv.URL, Format: "ntfy", Token: "tk"}
+	if err := ntfy.Send(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	if gotHeader.Get("Title") != a.Subject || gotBody != "VM exited" || gotHeader.Get("Authorization") != "Bearer tk" {
+		t.Errorf("ntfy request: header=%v body=%q", gotHeader, gotBody)
+	}
+
+	gotify := &PushSender{URL: srv.URL, Format: "gotify", Token: "tk"}
+	if err := gotify.Send(context.Background(), a); err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal([]byte(gotBody), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["title"] != a.Subject || msg["message"] != "VM exited" || gotHeader.Get("X-Gotify-Key") != "tk" {
+		t.Errorf("gotify request: header=%v body=%q", gotHeader, gotBody)
+	}
+}
+
+func TestPushSenderHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	p := &PushSender{URL: srv.URL, Format: "ntfy"}
+	err := p.Send(context.Background(), Alert{Subject: "s", Body: "b"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected 401 error, got %v", err)
+	}
+}
+
+func TestFormatMessageStripsHeaderInjection(t *testing.T) {
+	msg := string(formatMessage("a@example.org", []string{"b@example.org"},
+		Alert{Time: time.Now(), Subject: "x\r\nBcc: evil@example.org", Body: "line1\nline2"}))
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("header injection not stripped:\n%s", msg)
+	}
+	if !strings.Contains(msg, "line1\r\nline2") {
+		t.Errorf("body not CRLF-normalized:\n%s", msg)
+	}
+}
@@ -0,0 +1,118 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// PushSender posts alerts to an HTTP push service. Format "ntfy" sends the
+// body as plain text with a Title header (ntfy.sh and compatible servers);
+// format "gotify" sends a JSON message object (Gotify and compatible).
+type PushSender struct {
+	URL    string
+	Format string
+	Token  string
+	Client *http.Client
+}
+
+// Send implements Sender.
+func (p *PushSender) Send(ctx context.Context, a Alert) error {
+	var (
+		body        []byte
+		contentType string
+	)
+	switch p.Format {
+	case "gotify":
+		body, _ = json.Marshal(map[string]any{
+			"title":    a.Subject,
+			"message":  a.Body,
+			"priority": 8,
+		})
+		contentType = "application/json"
+	default:
+		body = []byte(a.Body)
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if p.Format != "gotify" {
+		req.Header.Set("Title", a.Subject)
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	}
+	if p.Token != "" {
+		if p.Format == "gotify" {
+			req.Header.Set("X-Gotify-Key", p.Token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+p.Token)
+		}
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("push: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("push: server returned %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPSender mails alerts through an SMTP server using PLAIN auth when a
+// username is configured. net/smtp upgrades to STARTTLS when offered.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send implements Sender. net/smtp does not take a context, so a stalled
+// server only delays this background delivery.
+func (s *SMTPSender) Send(_ context.Context, a Alert) error {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	if err := smtp.SendMail(addr, auth, s.From, s.To, formatMessage(s.From, s.To, a)); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+// formatMessage builds an RFC 5322 message for a.
+func formatMessage(from string, to []string, a Alert) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", sanitizeHeader(a.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", a.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(a.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// sanitizeHeader strips CR/LF to prevent header injection.
+func sanitizeHeader(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,172 @@
+// Package autostart starts the tray app when the user logs in: through an
+// XDG autostart entry on Linux, a LaunchAgent on macOS, and a value under
+// the Run registry key on Windows. It changes only the current user's
+// settings, so it needs no privileges, and it is independent of running
+// the controller as a system service, which starts the VM at boot rather
+// than the GUI at login.
+package autostart
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Label names the login item: the LaunchAgent's label, and the base name
+// of the XDG autostart entry.
+const Label = "org.torproject.torvm.gui"
+
+// ErrUnsupported is returned by Enable on platforms without a login item
+// it knows how to make.
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// Supported reports whether Enable works on this platform.
+func Supported() bool {
+	return supported
+}
+
+// Command returns the command that starts the GUI: this executable, with
+// the config file at configPath if there is one.
+func Command(configPath string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("autostart: %w", err)
+	}
+	command := []string{exe}
+	if configPath != "" {
+		abs, err := filepath.Abs(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("autostart: %w", err)
+		}
+		command = append(command, "--config", abs)
+	}
+	return command, nil
+}
+
+// Enable arranges for command to run each time the current user logs in,
+// replacing what an earlier Enable arranged.
+func Enable(command []string) error {
+	if len(command) == 0 {
+		return errors.New("autostart: no command")
+	}
+	if err := enable(command); err != nil {
+		return fmt.Errorf("autostart: %w", err)
+	}
+	return nil
+}
+
+// Disable stops the GUI from starting at login. It is not an error if it
+// was not enabled.
+func Disable() error {
+	if err := disable(); err != nil {
+		return fmt.Errorf("autostart: %w", err)
+	}
+	return nil
+}
+
+// Enabled reports whether the GUI starts at login.
+func Enabled() (bool, error) {
+	on, err := enabled()
+	if err != nil {
+		return false, fmt.Errorf("autostart: %w", err)
+	}
+	return on, nil
+}
+
+// writeFile writes a login item file, creating its directory.
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// removeFile removes a login item file that may not exist.
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// fileExists reports whether a login item file exists.
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// desktopEntry returns an XDG autostart entry that runs command.
+func desktopEntry(command []string) string {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = desktopQuote(arg)
+	}
+	return "[Desktop Entry]\n" +
+		"Type=Application\n" +
+		"Name=TorVM\n" +
+		"Comment=Route this computer's traffic through Tor\n" +
+		"Exec=" + strings.Join(args, " ") + "\n" +
+		"Terminal=false\n" +
+		"X-GNOME-Autostart-enabled=true\n"
+}
+
+// desktopQuote quotes an argument of an Exec key: inside double quotes,
+// with `"`, "`", "$", and "\" escaped by a backslash, every backslash
+// then doubled again as the key's value is itself unescaped, and "%"
+// doubled so it is not taken for a field code.
+func desktopQuote(arg string) string {
+	var b strings.Builder
+	for _, r := range arg {
+		switch r {
+		case '"', '`', '$':
+			b.WriteString(`\\` + string(r))
+		case '\\':
+			b.WriteString(`\\\\`)
+		case '%':
+			b.WriteString("%%")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return `"` + b.String() + `"`
+}
+
+// launchAgent returns a LaunchAgent definition that runs command once,
+// in the user's graphical session, at login.
+func launchAgent(command []string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + Label + `</string>
+	<key>ProgramArguments</key>
+	<array>
+`)
+	for _, arg := range command {
+		b.WriteString("\t\t<string>" + xmlEscape(arg) + "</string>\n")
+	}
+	b.WriteString(`	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>LimitLoadToSessionType</key>
+	<string>Aqua</string>
+	<key>ProcessType</key>
+	<string>Interactive</string>
+</dict>
+</plist>
+`)
+	return b.String()
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+func xmlEscape(s string) string {
+	return xmlEscaper.Replace(s)
+}
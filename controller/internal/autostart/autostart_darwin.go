@@ -0,0 +1,44 @@
+//go:build darwin
+
+package autostart
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// agentPath returns the user's LaunchAgent for the GUI. launchd loads it
+// at the next login; it is not loaded now, as the GUI is running.
+func agentPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", Label+".plist"), nil
+}
+
+const supported = true
+
+func enable(command []string) error {
+	path, err := agentPath()
+	if err != nil {
+		return err
+	}
+	return writeFile(path, launchAgent(command))
+}
+
+func disable() error {
+	path, err := agentPath()
+	if err != nil {
+		return err
+	}
+	return removeFile(path)
+}
+
+func enabled() (bool, error) {
+	path, err := agentPath()
+	if err != nil {
+		return false, err
+	}
+	return fileExists(path)
+}
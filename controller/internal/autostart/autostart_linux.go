@@ -0,0 +1,47 @@
+//go:build linux
+
+package autostart
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// entryPath returns the user's XDG autostart entry for the GUI.
+func entryPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "autostart", Label+".desktop"), nil
+}
+
+const supported = true
+
+func enable(command []string) error {
+	path, err := entryPath()
+	if err != nil {
+		return err
+	}
+	return writeFile(path, desktopEntry(command))
+}
+
+func disable() error {
+	path, err := entryPath()
+	if err != nil {
+		return err
+	}
+	return removeFile(path)
+}
+
+func enabled() (bool, error) {
+	path, err := entryPath()
+	if err != nil {
+		return false, err
+	}
+	return fileExists(path)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package autostart
+
+const supported = false
+
+func enable(command []string) error { return ErrUnsupported }
+
+func disable() error { return nil }
+
+func enabled() (bool, error) { return false, nil }
@@ -0,0 +1,49 @@
+package autostart
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestDesktopQuote(t *testing.T) {
+	tests := []struct{ arg, want string }{
+		{"/usr/bin/torvm", `"/usr/bin/torvm"`},
+		{"/home/a b/torvm.json", `"/home/a b/torvm.json"`},
+		{`say "$HOME"`, `"say \\"\\$HOME\\""`},
+		{`C:\x`, `"C:\\\\x"`},
+		{"100%", `"100%%"`},
+	}
+	for _, tt := range tests {
+		if got := desktopQuote(tt.arg); got != tt.want {
+			t.Errorf("desktopQuote(%q) = %s, want %s", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestDesktopEntry(t *testing.T) {
+	entry := desktopEntry([]string{"/opt/torvm/torvm", "--config", "/etc/torvm.json"})
+	if !strings.HasPrefix(entry, "[Desktop Entry]\n") {
+		t.Errorf("entry does not start with its group:\n%s", entry)
+	}
+	if !strings.Contains(entry, "\nExec=\"/opt/torvm/torvm\" \"--config\" \"/etc/torvm.json\"\n") {
+		t.Errorf("entry has the wrong Exec line:\n%s", entry)
+	}
+}
+
+func TestLaunchAgent(t *testing.T) {
+	plist := launchAgent([]string{"/Applications/TorVM.app/torvm", "--config", "/Users/a&b/torvm.json"})
+	var doc struct {
+		Strings []string `xml:"dict>array>string"`
+	}
+	if err := xml.Unmarshal([]byte(plist), &doc); err != nil {
+		t.Fatalf("plist is not XML: %v\n%s", err, plist)
+	}
+	want := []string{"/Applications/TorVM.app/torvm", "--config", "/Users/a&b/torvm.json"}
+	if strings.Join(doc.Strings, "|") != strings.Join(want, "|") {
+		t.Errorf("ProgramArguments = %q, want %q", doc.Strings, want)
+	}
+	if !strings.Contains(plist, "<string>"+Label+"</string>") {
+		t.Errorf("plist has no label:\n%s", plist)
+	}
+}
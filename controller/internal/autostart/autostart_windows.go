@@ -0,0 +1,63 @@
+//go:build windows
+
+package autostart
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// runKey is the per-user key whose values Windows runs at login.
+const runKey = `Software\Microsoft\Windows\CurrentVersion\Run`
+
+// runValue names the GUI's value under runKey.
+const runValue = "TorVM"
+
+const supported = true
+
+func enable(command []string) error {
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = syscall.EscapeArg(arg)
+	}
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, runKey, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetStringValue(runValue, strings.Join(args, " "))
+}
+
+func disable() error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, runKey, registry.SET_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	if err := k.DeleteValue(runValue); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func enabled() (bool, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, runKey, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer k.Close()
+	_, _, err = k.GetStringValue(runValue)
+	if errors.Is(err, registry.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,88 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeTimer(t *testing.T) {
+	f := NewFake(epoch)
+	tm := f.NewTimer(time.Minute)
+	f.Advance(59 * time.Second)
+	select {
+	case <-tm.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	f.Advance(2 * time.Second)
+	if got := <-tm.C(); got != epoch.Add(time.Minute) {
+		t.Errorf("timer fired with %v, want its deadline", got)
+	}
+	if f.Now() != epoch.Add(61*time.Second) {
+		t.Errorf("Now = %v after advancing 61s", f.Now())
+	}
+	if tm.Stop() {
+		t.Error("Stop of a fired timer reported it active")
+	}
+
+	if tm.Reset(time.Second) {
+		t.Error("Reset of a fired timer reported it active")
+	}
+	if !tm.Stop() {
+		t.Error("Stop of a reset timer reported it inactive")
+	}
+	f.Advance(time.Hour)
+	select {
+	case <-tm.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if got := <-f.After(0); got != f.Now() {
+		t.Errorf("After(0) = %v, want now", got)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(epoch)
+	tk := f.NewTicker(10 * time.Second)
+	f.Advance(25 * time.Second)
+	// Like time.Ticker, a tick nobody received is dropped, not queued.
+	if got := <-tk.C(); got != epoch.Add(10*time.Second) {
+		t.Errorf("first tick = %v", got)
+	}
+	select {
+	case got := <-tk.C():
+		t.Errorf("extra tick %v", got)
+	default:
+	}
+	f.Advance(5 * time.Second)
+	if got := <-tk.C(); got != epoch.Add(30*time.Second) {
+		t.Errorf("tick = %v, want 30s", got)
+	}
+	tk.Stop()
+	f.Advance(time.Minute)
+	select {
+	case <-tk.C():
+		t.Error("stopped ticker ticked")
+	default:
+	}
+}
+
+func TestFakeOrderAndBlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	woke := make(chan time.Duration, 2)
+	for _, d := range []time.Duration{2 * time.Second, time.Second} {
+		go func() { f.Sleep(d); woke <- d }()
+	}
+	f.BlockUntil(2)
+	f.Advance(time.Second)
+	if d := <-woke; d != time.Second {
+		t.Errorf("woke the %v sleeper first", d)
+	}
+	f.Advance(time.Second)
+	if d := <-woke; d != 2*time.Second {
+		t.Errorf("woke %v, want the 2s sleeper", d)
+	}
+}
@@ -0,0 +1,206 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time stands still until Advance or Set moves it.
+// Timers, tickers, After, and Sleep fire as the time passes their
+// deadlines, in deadline order, each seeing the time it was due.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	// changed is closed, and replaced, when a waiter is added or removed.
+	changed chan struct{}
+}
+
+// fakeWaiter is a pending timer or ticker.
+type fakeWaiter struct {
+	at     time.Time
+	period time.Duration // zero for a timer
+	ch     chan time.Time
+}
+
+// NewFake returns a Fake clock set to t.
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t, changed: make(chan struct{})}
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t.
+func (f *Fake) Since(t time.Time) time.Duration { return f.Now().Sub(t) }
+
+// After returns a channel that receives the fake time once it has moved
+// on by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time { return f.NewTimer(d).C() }
+
+// Sleep blocks until the fake time has moved on by d.
+func (f *Fake) Sleep(d time.Duration) { <-f.After(d) }
+
+// NewTimer returns a timer that fires once the fake time has moved on by
+// d, or at once if d is not positive.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, w: &fakeWaiter{ch: make(chan time.Time, 1)}}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker returns a ticker that ticks each time the fake time moves on
+// by d. Like time.NewTicker, it panics if d is not positive.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTicker{f: f, w: &fakeWaiter{ch: make(chan time.Time, 1)}}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the fake time on by d, firing what falls due on the way.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the fake time to t, firing what falls due on the way. The
+// time never goes back: an earlier t only fires what is already due.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		var next *fakeWaiter
+		for _, w := range f.waiters {
+			if !w.at.After(t) && (next == nil || w.at.Before(next.at)) {
+				next = w
+			}
+		}
+		if next == nil {
+			break
+		}
+		if next.at.After(f.now) {
+			f.now = next.at
+		}
+		f.fire(next)
+	}
+	if t.After(f.now) {
+		f.now = t
+	}
+}
+
+// BlockUntil waits until at least n timers, tickers, and sleepers are
+// pending, so a test can be sure a goroutine is waiting before it
+// advances the time.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	for len(f.waiters) < n {
+		ch := f.changed
+		f.mu.Unlock()
+		<-ch
+		f.mu.Lock()
+	}
+	f.mu.Unlock()
+}
+
+// fire sends the time on w's channel, dropping it if the last one was
+// not received, as time.Ticker does, and reschedules or removes w.
+func (f *Fake) fire(w *fakeWaiter) {
+	select {
+	case w.ch <- f.now:
+	default:
+	}
+	if w.period > 0 {
+		w.at = w.at.Add(w.period)
+		return
+	}
+	f.remove(w)
+}
+
+// add schedules w at f.now plus d, or fires it at once if that is not in
+// the future. The caller holds f.mu.
+func (f *Fake) add(w *fakeWaiter, d time.Duration) {
+	w.at = f.now.Add(d)
+	if d <= 0 && w.period == 0 {
+		select {
+		case w.ch <- f.now:
+		default:
+		}
+		return
+	}
+	f.waiters = append(f.waiters, w)
+	f.notify()
+}
+
+// remove unschedules w and reports whether it was pending. The caller
+// holds f.mu.
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, x := range f.waiters {
+		if x == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.notify()
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+type fakeTimer struct {
+	f *Fake
+	w *fakeWaiter
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	return t.f.remove(t.w)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	active := t.f.remove(t.w)
+	// As with time.Timer since Go 1.23, no stale time is left to receive.
+	select {
+	case <-t.w.ch:
+	default:
+	}
+	t.f.add(t.w, d)
+	return active
+}
+
+type fakeTicker struct {
+	f *Fake
+	w *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTicker) Stop() {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.remove(t.w)
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.remove(t.w)
+	t.w.period = d
+	t.f.add(t.w, d)
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BridgeLine is a Tor bridge line taken apart:
+//
+//	[transport] address:port [fingerprint] [key=value ...]
+type BridgeLine struct {
+	Transport   string // "" for a plain bridge, else e.g. "obfs4"
+	Address     string // host:port; the host is an IP address
+	Fingerprint string // 40 hex characters, or ""
+	Params      map[string]string
+}
+
+// hexFingerprintRe matches a relay fingerprint as bridge lines give it.
+var hexFingerprintRe = regexp.MustCompile(`^[0-9a-fA-F]{40}$`)
+
+// transportNameRe matches a pluggable transport name.
+var transportNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// obfs4CertRe matches an obfs4 cert parameter: unpadded base64.
+var obfs4CertRe = regexp.MustCompile(`^[A-Za-z0-9+/]+={0,2}$`)
+
+// bridgePlugins maps the Bridge.Transport settings to the transport
+// their plugin serves, which the bridge lines must name.
+var bridgePlugins = map[string]string{
+	"":           "",
+	"none":       "",
+	"obfs4":      "obfs4",
+	"meek-azure": "meek_lite",
+	"snowflake":  "snowflake",
+	"webtunnel":  "webtunnel",
+}
+
+// ParseBridgeLine takes a bridge line apart and checks it as its
+// transport needs it: obfs4 needs a cert= and an iat-mode= of 0, 1, or
+// 2, meek_lite and webtunnel a url=, and a url= must be an https URL.
+// The error says what is wrong, for showing next to the line.
+func ParseBridgeLine(line string) (BridgeLine, error) {
+	var b BridgeLine
+	if err := sanitizeTorrcLine("bridge", line); err != nil {
+		return b, err
+	}
+	if len(line) > 1024 {
+		return b, fmt.Errorf("bridge line too long (%d chars, max 1024)", len(line))
+	}
+	if !bridgeLineRe.MatchString(line) {
+		return b, errors.New("bridge line contains invalid characters")
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return b, errors.New("empty bridge line")
+	}
+	if !strings.Contains(fields[0], ":") {
+		if !transportNameRe.MatchString(fields[0]) {
+			return b, fmt.Errorf("%q is not a transport name", fields[0])
+		}
+		b.Transport, fields = fields[0], fields[1:]
+	}
+	if len(fields) == 0 {
+		return b, fmt.Errorf("%s bridge has no address", b.Transport)
+	}
+	if err := checkBridgeAddress(fields[0]); err != nil {
+		return b, err
+	}
+	b.Address, fields = fields[0], fields[1:]
+
+	if len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		if !hexFingerprintRe.MatchString(fields[0]) {
+			return b, fmt.Errorf("fingerprint %q must be 40 hex characters", fields[0])
+		}
+		b.Fingerprint, fields = strings.ToUpper(fields[0]), fields[1:]
+	}
+	for _, f := range fields {
+		k, v, ok := strings.Cut(f, "=")
+		if !ok || k == "" {
+			return b, fmt.Errorf("%q is not a key=value parameter", f)
+		}
+		if b.Params == nil {
+			b.Params = make(map[string]string)
+		}
+		b.Params[k] = v
+	}
+	if b.Transport == "" && len(b.Params) > 0 {
+		return b, errors.New("a bridge without a transport takes no parameters")
+	}
+	return b, b.checkParams()
+}
+
+func checkBridgeAddress(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) == nil {
+		return fmt.Errorf("address %q must be IP:port", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("address %q has an invalid port", addr)
+	}
+	return nil
+}
+
+// checkParams checks the parameters b's transport requires.
+func (b BridgeLine) checkParams() error {
+	if u, ok := b.Params["url"]; ok {
+		if p, err := url.Parse(u); err != nil || p.Scheme != "https" || p.Host == "" {
+			return fmt.Errorf("%s bridge url %q must be an https URL", b.Transport, u)
+		}
+	}
+	switch b.Transport {
+	case "obfs4":
+		cert, ok := b.Params["cert"]
+		if !ok {
+			return errors.New("obfs4 bridge needs cert=")
+		}
+		if !obfs4CertRe.MatchString(cert) {
+			return fmt.Errorf("obfs4 cert %q is not base64", cert)
+		}
+		mode, ok := b.Params["iat-mode"]
+		if !ok {
+			return errors.New("obfs4 bridge needs iat-mode=")
+		}
+		if mode != "0" && mode != "1" && mode != "2" {
+			return fmt.Errorf("obfs4 iat-mode %q must be 0, 1, or 2", mode)
+		}
+	case "meek_lite", "webtunnel":
+		if _, ok := b.Params["url"]; !ok {
+			return fmt.Errorf("%s bridge needs url=", b.Transport)
+		}
+	}
+	return nil
+}
+
+// CheckBridgeTransport reports whether the bridge b can be used with the
+// Bridge.Transport setting transport, whose plugin must be b's: Tor
+// ignores a bridge without one.
+func CheckBridgeTransport(b BridgeLine, transport string) error {
+	want, ok := bridgePlugins[transport]
+	if !ok || b.Transport == want {
+		return nil
+	}
+	switch {
+	case b.Transport == "":
+		return fmt.Errorf("plain bridge, but the transport is %s", transport)
+	case want == "":
+		return fmt.Errorf("%s bridge, but no transport is selected", b.Transport)
+	}
+	return fmt.Errorf("%s bridge, but the transport is %s", b.Transport, transport)
+}
+
+// validateBridges checks the bridge lines of bc, with the snowflake
+// settings applied, if bridges are used. The snowflake settings need a
+// snowflake bridge line to go on, or they would be dropped unnoticed.
+func validateBridges(bc *BridgeConfig) error {
+	if !bc.UseBridges {
+		return nil
+	}
+	snowflake := false
+	for _, line := range bc.Bridges {
+		if line = bc.Snowflake.apply(strings.TrimSpace(line)); line == "" {
+			continue
+		}
+		if err := checkBridge(line, bc.Transport); err != nil {
+			return err
+		}
+		snowflake = snowflake || strings.HasPrefix(line, "snowflake ")
+	}
+	if bc.Transport == "snowflake" && !snowflake && len(bc.Snowflake.params()) > 0 {
+		return fmt.Errorf("bridge.snowflake is set, but there is no snowflake bridge line to apply it to")
+	}
+	return nil
+}
+
+// hostnameRe matches a DNS name, as the snowflake fronts are given.
+var hostnameRe = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+
+// stunRe matches a STUN server: stun: or stuns:, then host:port.
+var stunRe = regexp.MustCompile(`^stuns?:[a-zA-Z0-9.-]+:[0-9]{1,5}$`)
+
+// validateSnowflake checks the snowflake settings that are set.
+func validateSnowflake(s *SnowflakeConfig) error {
+	for _, u := range []struct{ key, val string }{
+		{"broker_url", s.BrokerURL},
+		{"ampcache", s.AMPCache},
+	} {
+		if u.val == "" {
+			continue
+		}
+		if p, err := url.Parse(u.val); err != nil || p.Scheme != "https" || p.Host == "" {
+			return fmt.Errorf("bridge.snowflake.%s %q must be an https URL", u.key, u.val)
+		}
+	}
+	for _, f := range s.Fronts {
+		if len(f) > 253 || !hostnameRe.MatchString(f) {
+			return fmt.Errorf("bridge.snowflake.fronts: %q is not a domain name", f)
+		}
+	}
+	for _, srv := range s.STUN {
+		if !stunRe.MatchString(srv) {
+			return fmt.Errorf("bridge.snowflake.stun: %q is not stun:host:port", srv)
+		}
+	}
+	if s.MaxPeers < 0 || s.MaxPeers > 16 {
+		return fmt.Errorf("bridge.snowflake.max_peers must be 0-16, got %d", s.MaxPeers)
+	}
+	for _, p := range s.params() {
+		if strings.Contains(p, " ") || !bridgeLineRe.MatchString(p) {
+			return fmt.Errorf("bridge.snowflake: %q has characters a bridge line cannot hold", p)
+		}
+	}
+	return nil
+}
+
+// params returns the bridge line parameters for the settings of s that
+// are set.
+func (s *SnowflakeConfig) params() []string {
+	var p []string
+	if s.BrokerURL != "" {
+		p = append(p, "url="+s.BrokerURL)
+	}
+	if len(s.Fronts) > 0 {
+		p = append(p, "fronts="+strings.Join(s.Fronts, ","))
+	}
+	if s.AMPCache != "" {
+		p = append(p, "ampcache="+s.AMPCache)
+	}
+	if len(s.STUN) > 0 {
+		p = append(p, "ice="+strings.Join(s.STUN, ","))
+	}
+	if s.MaxPeers > 0 {
+		p = append(p, "max="+strconv.Itoa(s.MaxPeers))
+	}
+	return p
+}
+
+// apply returns the bridge line with the parameters of the settings of
+// s that are set in place of its own, if it is a snowflake bridge.
+func (s *SnowflakeConfig) apply(line string) string {
+	params := s.params()
+	fields := strings.Fields(line)
+	if len(params) == 0 || len(fields) == 0 || fields[0] != "snowflake" {
+		return line
+	}
+	set := make(map[string]bool, len(params)+1)
+	for _, p := range params {
+		k, _, _ := strings.Cut(p, "=")
+		set[k] = true
+	}
+	if set["fronts"] {
+		// front= is the single-domain form of fronts=.
+		set["front"] = true
+	}
+	out := fields[:0]
+	for _, f := range fields {
+		if k, _, ok := strings.Cut(f, "="); !ok || !set[k] {
+			out = append(out, f)
+		}
+	}
+	return strings.Join(append(out, params...), " ")
+}
@@ -0,0 +1,377 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// keyDocs describes every config key, by its path ("bridge.use_bridges"),
+// for the comments MarshalCommented writes. A key added to Config needs
+// an entry here; TestKeyDocs checks that none is missing.
+var keyDocs = map[string]string{
+	"config_version":        "Schema version of this file; TorVM migrates older files when it loads them. Do not edit.",
+	"instance":              "Name that labels this instance's host artifacts (interface alias, firewall tables) as \"torvm:<instance>\". 1-32 letters, digits, \"_\" or \"-\".",
+	"tap_name":              "Name of the TAP interface between the host and the VM.",
+	"host_ip":               "IPv4 address of the host end of the TAP link.",
+	"vm_ip":                 "IPv4 address of the VM end of the TAP link; the host routes through it.",
+	"subnet_mask":           "Netmask of the TAP link.",
+	"auto_subnet":           "Move the TAP link to a free RFC 1918 subnet when the one above overlaps a host network, as on many VPNs.",
+	"mtu":                   "MTU of the TAP interface and the VM's eth0 (576-9000; at least 1280 in IPv6 route mode).",
+	"dns1":                  "First DNS server set on the TAP adapter (Windows).",
+	"dns2":                  "Second DNS server set on the TAP adapter (Windows).",
+	"socks_port":            "Tor SOCKS port in the VM.",
+	"control_port":          "Tor control port in the VM.",
+	"trans_port":            "Tor transparent proxy port in the VM.",
+	"dns_port":              "Tor DNS port in the VM.",
+	"vm_memory_mb":          "Memory of the Tor VM in megabytes (32-4096).",
+	"vm_cpus":               "Virtual CPUs of the Tor VM (1-16); changed while the VM runs, it is hot-plugged.",
+	"kernel_path":           "The VM kernel.",
+	"initrd_path":           "The VM initramfs.",
+	"state_disk_path":       "The VM's state disk, which keeps Tor's state between runs.",
+	"qmp_socket_path":       "QEMU's QMP socket, or named pipe on Windows.",
+	"api_socket":            "Socket of the control API used by \"torvm start\", \"torvm status\" and the like; empty disables it.",
+	"grpc_socket":           "Socket of the gRPC control API; empty disables it.",
+	"api_group":             "Group whose members may use the API sockets, besides root and the controller's user.",
+	"verbose":               "Log debug messages.",
+	"accel":                 "QEMU accelerator: \"kvm\", \"hvf\", \"whpx\", or \"tcg\" (software emulation, slow). Empty detects the best one at each start; --accel overrides it.",
+	"headless":              "Run without the GUI.",
+	"kill_switch":           "Keep the firewall rules if the session fails, so nothing leaks around Tor until TorVM is started again (not on Windows).",
+	"panic_wipe_state_disk": "Emergency Stop also wipes the state disk.",
+	"panic_lock_screen":     "Emergency Stop also locks the screen.",
+	"wipe_on_exit":          "Shred the torrc overlay and temporary files when a session ends.",
+	"block_dns_leaks":       "Drop DNS (ports 53 and 853) not sent to the VM while traffic is routed through it.",
+	"pause_unroute":         "Restore the host's own routes while the VM is paused.",
+	"guest_firewall":        "Firewall inside the VM: only Tor may connect out, and only Tor's ports are open.",
+	"torrc_extra":           "Extra torrc lines, \"Directive value\", such as \"MaxCircuitDirtiness 600\" or \"ConnectionPadding 1\". Only circuit, guard, and padding tuning directives are allowed; bridges, proxies, and relay exclusions have their own keys.",
+
+	"ipv6":                           "Host IPv6 traffic. TorVM routes IPv4 through the VM; without this, IPv6 leaks around it.",
+	"ipv6.mode":                      "\"block\" (blackhole global IPv6), \"route\" (send IPv6 through the VM over a ULA link), or \"off\" (leave it alone; IPv6 bypasses Tor).",
+	"ipv6.host_ip":                   "ULA address of the host end of the link (route mode).",
+	"ipv6.vm_ip":                     "ULA address of the VM end of the link (route mode).",
+	"ipv6.prefix_len":                "Prefix length of the link (64-127).",
+	"ipv6.client_use_ipv6":           "Let Tor connect to relays and bridges over IPv6 as well as IPv4.",
+	"ipv6.client_prefer_ipv6_orport": "Make Tor try relays over IPv6 first.",
+
+	"route":          "How TorVM claims the host's IPv4 default route.",
+	"route.strategy": "\"metric\" (add a default route through the VM), \"replace\" (also remove the host's other default routes for the session), or \"split\" (route 0.0.0.0/1 and 128.0.0.0/1 through the VM). Empty means \"split\" on macOS and \"metric\" elsewhere.",
+	"route.metric":   "Metric of the routes through the VM (1-9999), or 0 for the platform default. On Windows it is the TAP adapter's interface metric; macOS ignores it.",
+
+	"lan":        "Local network access while routed. Traffic to these ranges does NOT go through Tor.",
+	"lan.allow":  "Route the ranges below through the host's own gateway, so printers, NAS boxes and SSH keep working.",
+	"lan.ranges": "IPv4 CIDRs, at most /8 wide.",
+
+	"sharing":      "Devices the host shares its connection with (hotspot, Internet Connection Sharing, Internet Sharing). Their traffic is not routed through Tor unless mode is \"route\".",
+	"sharing.mode": "\"warn\" (start and warn), \"refuse\" (do not start while the connection is shared), or \"route\" (send shared clients through the VM and drop the rest; Linux only).",
+
+	"journal":             "The persistent event journal.",
+	"journal.path":        "JSON-lines file; empty disables the journal.",
+	"journal.max_size_kb": "Rotate the journal after this many kilobytes (16-1048576).",
+
+	"alerts":                       "Alerts for unattended gateways, sent when the failsafe activates or the VM crash-loops. While the failsafe is active only destinations reachable without the VM can be delivered to.",
+	"alerts.smtp":                  "Email alerts; an empty host disables them.",
+	"alerts.smtp.host":             "SMTP server.",
+	"alerts.smtp.port":             "SMTP port.",
+	"alerts.smtp.username":         "SMTP user name.",
+	"alerts.smtp.password":         "SMTP password, or \"file:PATH\" or \"env:NAME\" to read it from a file or the environment.",
+	"alerts.smtp.from":             "Sender address.",
+	"alerts.smtp.to":               "Recipient addresses.",
+	"alerts.push":                  "HTTP push alerts; an empty url disables them.",
+	"alerts.push.url":              "For example https://ntfy.sh/my-topic or https://gotify.lan/message.",
+	"alerts.push.format":           "\"ntfy\" or \"gotify\".",
+	"alerts.push.token":            "Bearer token (ntfy) or app key (gotify), or \"file:PATH\" or \"env:NAME\".",
+	"alerts.min_interval_sec":      "Suppress repeats of the same alert for this many seconds (60-86400).",
+	"alerts.crash_loop_threshold":  "VM launches within the window below that count as a crash loop (2-100).",
+	"alerts.crash_loop_window_sec": "Crash loop window in seconds (60-86400).",
+
+	"maintenance":                 "Unattended upkeep, run once per window and deferred while any Tor stream is open.",
+	"maintenance.enabled":         "Run the tasks below.",
+	"maintenance.window":          "Local time window, \"HH:MM-HH:MM\"; it may wrap past midnight.",
+	"maintenance.days":            "Days to run on, \"mon\" to \"sun\"; empty means every day.",
+	"maintenance.update_check":    "Check for a newer release.",
+	"maintenance.rotate_logs":     "Rotate the --log-file.",
+	"maintenance.restart_vm":      "Restart the VM cleanly, keeping the host routing.",
+	"maintenance.fsck_state_disk": "Check the state disk while the VM is down (needs restart_vm).",
+
+	"storage":               "Retention of rotated logs and the leftovers of interrupted work. 0 days disables a rule.",
+	"storage.leftover_days": "Remove leftovers older than this many days (0-3650).",
+	"storage.log_days":      "Remove rotated logs older than this many days (0-3650).",
+	"storage.check_hours":   "How often the rules are enforced, in hours (1-720).",
+
+	"polling":                 "How often the GUI refreshes, in seconds. Checks that need the VM back off while it is down.",
+	"polling.service_sec":     "Service manager status (1-3600).",
+	"polling.circuits_sec":    "Circuit list (1-3600).",
+	"polling.bandwidth_sec":   "Tray menu traffic rate (1-3600).",
+	"polling.max_backoff_sec": "Longest back-off; at least the intervals above, at most 3600.",
+
+	"disk":            "Limits on the state disk's I/O, e.g. on a shared SSD. 0 leaves a limit off.",
+	"disk.read_mbps":  "Read megabytes per second.",
+	"disk.write_mbps": "Write megabytes per second.",
+	"disk.read_iops":  "Read operations per second.",
+	"disk.write_iops": "Write operations per second.",
+
+	"migration":         "Live migration of the VM between hosts (\"torvm migrate\" and --incoming).",
+	"migration.tls_dir": "x509 files for the migration channel: ca-cert.pem, plus server-cert.pem and server-key.pem on the destination and client-cert.pem and client-key.pem on the source.",
+
+	"bridge":                      "Tor bridges and pluggable transports, for networks that block Tor.",
+	"bridge.use_bridges":          "Connect through the bridges below.",
+	"bridge.transport":            "\"none\", \"obfs4\", \"meek-azure\", \"snowflake\", or \"webtunnel\".",
+	"bridge.bridges":              "Bridge lines, as from bridges.torproject.org.",
+	"bridge.snowflake":            "Snowflake settings, for where the default broker is blocked. Each one set replaces the matching parameter of every snowflake bridge line; they need at least one such line.",
+	"bridge.snowflake.broker_url": "https URL of the snowflake broker.",
+	"bridge.snowflake.fronts":     "CDN domains to front the broker with.",
+	"bridge.snowflake.ampcache":   "https URL of an AMP cache to reach the broker through, such as \"https://cdn.ampproject.org/\".",
+	"bridge.snowflake.stun":       "STUN servers, as \"stun:host:port\".",
+	"bridge.snowflake.max_peers":  "Snowflake proxies to use at once, 1-16; 0 keeps the default.",
+
+	"proxy":          "Upstream proxy Tor connects through.",
+	"proxy.type":     "\"\" (none), \"http\", \"https\", or \"socks5\".",
+	"proxy.address":  "host:port",
+	"proxy.username": "Proxy user name.",
+	"proxy.password": "Proxy password, or \"file:PATH\" or \"env:NAME\".",
+
+	"service":                "The generated system service (launchd plist, systemd unit, or Windows service); takes effect when it is (re)installed.",
+	"service.run_at_load":    "Start at boot (macOS; systemd units are enabled and Windows services start automatically).",
+	"service.nice":           "Scheduling priority, -20 to 19 (macOS and Linux).",
+	"service.max_open_files": "Open file limit; 0 keeps the system default (macOS and Linux).",
+	"service.max_processes":  "Process limit; 0 keeps the system default (macOS and Linux).",
+	"service.watch_paths":    "Start the service when one of these paths changes (macOS).",
+	"service.environment":    "Environment variables of the service.",
+	"service.log_path":       "The service's output (macOS); empty means /var/log/torvm/torvm.log.",
+	"service.backend":        "Run as the privileged back end of a GUI run by a user (macOS and Linux): the VM starts when the GUI or \"torvm start\" asks.",
+
+	"retry":                     "Retries of failed lifecycle steps and restarts of a crashed VM.",
+	"retry.retry_enabled":       "Retry a failed step.",
+	"retry.retry_max_attempts":  "Attempts per step.",
+	"retry.restart_max_retries": "Relaunches in a row of a VM that crashes while running, before the session ends (0-100); 0 disables them.",
+	"retry.restart_backoff_sec": "Wait before the first relaunch, doubled each time (1-3600).",
+
+	"entropy":                       "Entropy sources for the VM.",
+	"entropy.enable_haveged":        "Run haveged in the VM (CPU timing jitter).",
+	"entropy.enable_rngd":           "Run rngd in the VM (hardware sources such as RDRAND).",
+	"entropy.expose_rdrand":         "Expose RDRAND under software emulation; with hardware acceleration it passes through anyway.",
+	"entropy.serial_entropy_device": "A host hardware RNG device, such as /dev/ttyUSB0, passed to the VM as a serial port.",
+	"entropy.virtio_rng_max_bytes":  "virtio-rng rate limit: bytes per period (64-65536).",
+	"entropy.virtio_rng_period":     "virtio-rng rate limit period in milliseconds (100-60000).",
+	"entropy.kernel_entropy_bytes":  "Random bytes passed on the VM kernel command line (16-256).",
+	"entropy.reseed_interval_sec":   "How often fresh host entropy is sent to the running VM, in seconds (0 or 10-86400); 0 turns reseeding off.",
+	"entropy.reseed_bytes":          "Bytes sent per reseed (16-4096).",
+
+	"relays":                    "Relays Tor avoids when building circuits.",
+	"relays.exclude_nodes":      "\"$fingerprint\" or \"{CC}\" country code entries.",
+	"relays.exclude_exit_nodes": "The same, for exits only.",
+	"relays.strict_nodes":       "Never use excluded relays, even when Tor would fail without them.",
+
+	"browser":                         "The hardened Chromium browser VM.",
+	"browser.browser_enabled":         "Enable the browser VM.",
+	"browser.browser_vm_memory_mb":    "Memory of the browser VM in megabytes (256-4096).",
+	"browser.browser_vm_cpus":         "Virtual CPUs of the browser VM (1-8).",
+	"browser.browser_kernel_path":     "The browser VM kernel.",
+	"browser.browser_initrd_path":     "The browser VM initramfs.",
+	"browser.browser_state_disk_path": "The browser VM's state disk.",
+	"browser.browser_qmp_socket_path": "The browser VM's QMP socket.",
+	"browser.browser_vnc_display":     "VNC display (0-99); 1 is port 5901, and 0 disables VNC.",
+	"browser.browser_auto_start":      "Start the browser VM when Tor is running.",
+	"browser.canary_interval_sec":     "How often canaries are checked, in seconds (1-300).",
+	"browser.honey_tokens_enabled":    "Plant honey tokens in the browser VM.",
+	"browser.auto_remediate":          "Kill and restart the browser VM on a breach.",
+
+	"fhe":                         "FHE-encrypted document search and sharing.",
+	"fhe.fhe_enabled":             "Enable encrypted search.",
+	"fhe.fhe_index_dir":           "Directory of the encrypted index.",
+	"fhe.fhe_document_dirs":       "Directories of documents to index.",
+	"fhe.fhe_share_enabled":       "Share the index with peers over an onion service.",
+	"fhe.fhe_hidden_service_port": "Port of the onion service.",
+	"fhe.fhe_peers":               "Onion addresses of peers.",
+	"fhe.fhe_ring_degree":         "log2 of the ring degree (10-15).",
+	"fhe.fhe_auto_index":          "Reindex the document directories periodically.",
+	"fhe.fhe_auto_index_interval": "Reindex interval in minutes (1-1440).",
+	"fhe.fhe_max_index_size_mb":   "Largest index in megabytes (1-10240).",
+
+	"vector":                          "Semantic search with an HNSW index.",
+	"vector.vector_enabled":           "Enable semantic search.",
+	"vector.vector_index_dir":         "Directory of the index.",
+	"vector.vector_dimension":         "Embedding dimension (8-2048).",
+	"vector.vector_model_path":        "ONNX model for neural embeddings; empty uses TF-IDF.",
+	"vector.vector_hnsw_m":            "Connections per layer (4-64).",
+	"vector.vector_hnsw_ef_construct": "Build quality (10-1000).",
+	"vector.vector_hnsw_ef_search":    "Query quality (10-500).",
+	"vector.vector_search_mode":       "\"keyword\", \"vector\", or \"hybrid\".",
+	"vector.vector_top_k":             "Results per query (1-1000).",
+
+	"helpers":      "Host processes run alongside the VM, such as a pluggable transport client or a DNS forwarder, restarted with back-off when they exit.",
+	"helpers.name": "Name in the log: letters, digits, \"_\" and \"-\".",
+	"helpers.path": "Absolute path of the executable.",
+	"helpers.args": "Its arguments.",
+	"helpers.when": "\"running\" (while Tor is up, the default) or \"session\" (from the VM launch until the host network is restored).",
+}
+
+// commentHeader starts every file MarshalCommented writes.
+const commentHeader = "TorVM configuration. Every setting is shown with its default; " +
+	"a setting left out of the file keeps its default, so those you do not change may be deleted."
+
+// MarshalCommented encodes c in format f as Marshal does, in TOML or YAML
+// with each key preceded by a comment saying what it does, for a config
+// file to be read and edited by hand. JSON has no comments, so it is
+// written as Marshal writes it. Empty lists and maps are written out
+// rather than left out, so that every key is shown.
+func MarshalCommented(c *Config, f Format) ([]byte, error) {
+	if f == FormatJSON {
+		return Marshal(c, f)
+	}
+	c = c.Clone()
+	fillEmpty(reflect.ValueOf(c).Elem())
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	// Decoded from JSON, the node keeps the order of the fields.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+
+	var b bytes.Buffer
+	switch f {
+	case FormatTOML:
+		writeComment(&b, commentHeader)
+		b.WriteByte('\n')
+		if err := writeTOMLTable(&b, "", root); err != nil {
+			return nil, fmt.Errorf("encode TOML: %w", err)
+		}
+		return b.Bytes(), nil
+	case FormatYAML:
+		blockStyle(root)
+		commentYAML("", root)
+		doc.HeadComment = comment(commentHeader)
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, fmt.Errorf("encode YAML: %w", err)
+		}
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown config format %q", f)
+}
+
+// writeTOMLTable writes the keys of the mapping m, the table at path:
+// its plain keys first, as TOML requires, then its tables and arrays of
+// tables.
+func writeTOMLTable(b *bytes.Buffer, path string, m *yaml.Node) error {
+	var tables []int
+	for i := 0; i < len(m.Content); i += 2 {
+		key, val := m.Content[i].Value, m.Content[i+1]
+		if val.Kind == yaml.MappingNode || isTableArray(val) {
+			tables = append(tables, i)
+			continue
+		}
+		var v any
+		if err := val.Decode(&v); err != nil {
+			return err
+		}
+		line, err := toml.Marshal(map[string]any{key: v})
+		if err != nil {
+			return err
+		}
+		writeComment(b, keyDocs[joinPath(path, key)])
+		b.Write(line)
+	}
+	for _, i := range tables {
+		at := joinPath(path, m.Content[i].Value)
+		val := m.Content[i+1]
+		b.WriteByte('\n')
+		writeComment(b, keyDocs[at])
+		if val.Kind == yaml.MappingNode {
+			fmt.Fprintf(b, "[%s]\n", at)
+			if err := writeTOMLTable(b, at, val); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, e := range val.Content {
+			fmt.Fprintf(b, "[[%s]]\n", at)
+			if err := writeTOMLTable(b, at, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTableArray reports whether n is a non-empty list of mappings, which
+// TOML writes as an array of tables.
+func isTableArray(n *yaml.Node) bool {
+	return n.Kind == yaml.SequenceNode && len(n.Content) > 0 && n.Content[0].Kind == yaml.MappingNode
+}
+
+// commentYAML sets the comment of each key in the mapping m, the value
+// at path, and of the keys below it.
+func commentYAML(path string, m *yaml.Node) {
+	for i := 0; i < len(m.Content); i += 2 {
+		at := joinPath(path, m.Content[i].Value)
+		m.Content[i].HeadComment = comment(keyDocs[at])
+		switch val := m.Content[i+1]; val.Kind {
+		case yaml.MappingNode:
+			commentYAML(at, val)
+		case yaml.SequenceNode:
+			for _, e := range val.Content {
+				if e.Kind == yaml.MappingNode {
+					commentYAML(at, e)
+				}
+			}
+		}
+	}
+}
+
+func writeComment(b *bytes.Buffer, text string) {
+	if text != "" {
+		b.WriteString(comment(text))
+		b.WriteByte('\n')
+	}
+}
+
+// comment returns text as "#" comment lines of at most 72 columns.
+func comment(text string) string {
+	if text == "" {
+		return ""
+	}
+	var lines []string
+	line := "#"
+	for _, word := range strings.Fields(text) {
+		if len(line) > 1 && len(line)+1+len(word) > 72 {
+			lines = append(lines, line)
+			line = "#"
+		}
+		line += " " + word
+	}
+	return strings.Join(append(lines, line), "\n")
+}
+
+// fillEmpty replaces the nil slices and maps in v with empty ones.
+func fillEmpty(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fillEmpty(v.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		}
+		for i := 0; i < v.Len(); i++ {
+			fillEmpty(v.Index(i))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+	}
+}
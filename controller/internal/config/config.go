@@ -9,6 +9,9 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/datadir"
 )
 
 // tapNameUnixRe matches valid Unix TAP interface names: starts with a letter,
@@ -36,11 +39,204 @@ func validateTAPName(name string) error {
 	return nil
 }
 
+// maintenanceWindowRe matches a "HH:MM-HH:MM" maintenance window.
+var maintenanceWindowRe = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]-([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// instanceNameRe matches valid instance names used to label host artifacts.
+var instanceNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// envNameRe matches portable environment variable names for
+// Service.Environment.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// MaxVMCPUs is the largest VMCPUs value, and the number of vCPU slots the
+// VM gets for CPU hot-plug.
+const MaxVMCPUs = 16
+
 // BridgeConfig holds Tor bridge and pluggable transport settings.
 type BridgeConfig struct {
 	UseBridges bool     `json:"use_bridges"`
-	Transport  string   `json:"transport"` // "none", "obfs4", "meek-azure", "snowflake"
+	Transport  string   `json:"transport"` // "none", "obfs4", "meek-azure", "snowflake", "webtunnel"
 	Bridges    []string `json:"bridges"`   // bridge lines (address:port fingerprint)
+
+	// Snowflake overrides the rendezvous settings of the snowflake
+	// bridge lines, for where the default broker or its fronts are
+	// blocked.
+	Snowflake SnowflakeConfig `json:"snowflake"`
+}
+
+// SnowflakeConfig holds snowflake client settings. Each one that is set
+// replaces the matching parameter of every snowflake bridge line.
+type SnowflakeConfig struct {
+	BrokerURL string   `json:"broker_url"` // https URL of the broker (url=)
+	Fronts    []string `json:"fronts"`     // CDN domains to front the broker with (fronts=)
+	AMPCache  string   `json:"ampcache"`   // https URL of an AMP cache to reach the broker through (ampcache=)
+	STUN      []string `json:"stun"`       // STUN servers, as stun:host:port (ice=)
+	MaxPeers  int      `json:"max_peers"`  // proxies to use at once, 1-16; 0 keeps the client's default (max=)
+}
+
+// IPv6Config controls how host IPv6 traffic is handled while TorVM routes
+// IPv4 through the VM. Without it, any IPv6-enabled host leaks traffic
+// around the VM.
+type IPv6Config struct {
+	// Mode is "block" (blackhole global IPv6), "route" (send IPv6 through
+	// the VM over a ULA link), or "off" (leave host IPv6 untouched; IPv6
+	// traffic bypasses Tor).
+	Mode      string `json:"mode"`
+	HostIP    string `json:"host_ip"`    // ULA address of the host end (route mode)
+	VMIP      string `json:"vm_ip"`      // ULA address of the VM end (route mode)
+	PrefixLen int    `json:"prefix_len"` // 64-127
+
+	// ClientUseIPv6 lets Tor in the VM connect to relays and bridges over
+	// IPv6 as well as IPv4, and ClientPreferIPv6ORPort makes it try IPv6
+	// first. Tor falls back to IPv4 when the VM's uplink has no IPv6.
+	// They are independent of Mode, which decides what happens to the
+	// host's own IPv6 traffic.
+	ClientUseIPv6          bool `json:"client_use_ipv6"`
+	ClientPreferIPv6ORPort bool `json:"client_prefer_ipv6_orport"`
+}
+
+// RouteConfig controls how TorVM claims the host's IPv4 default route.
+// A DHCP client may install a default route with a lower metric than
+// TorVM's, which then silently wins; "replace" and "split" do not depend
+// on metrics.
+type RouteConfig struct {
+	// Strategy is "metric" (add a default route through the VM),
+	// "replace" (also remove the host's other default routes until the
+	// session ends), or "split" (route 0.0.0.0/1 and 128.0.0.0/1 through
+	// the VM, which outrank any default route). Empty means the platform
+	// default: "split" on macOS, which has no route metrics, and "metric"
+	// elsewhere.
+	Strategy string `json:"strategy"`
+	// Metric is the metric of the routes through the VM (1-9999), or 0 for
+	// the platform default: 50 on Linux, automatic on Windows. On Windows
+	// it is the TAP adapter's interface metric; macOS ignores it.
+	Metric int `json:"metric"`
+}
+
+// SharingConfig controls what happens when the host shares its connection
+// with other devices (a Wi-Fi hotspot, Windows Internet Connection
+// Sharing, macOS Internet Sharing). Their traffic is forwarded by the
+// host, not sent by it, and is NOT routed through Tor unless Mode is
+// "route".
+type SharingConfig struct {
+	// Mode is "warn" (start and warn that shared clients are not
+	// protected), "refuse" (do not start while the connection is shared),
+	// or "route" (send shared clients' traffic through the VM and drop it
+	// anywhere else; Linux only).
+	Mode string `json:"mode"`
+}
+
+// LANConfig controls local network access while traffic is routed through
+// the VM. When enabled, the listed ranges are routed through the host's
+// original gateway so printers, NAS boxes, and SSH to local machines keep
+// working. Traffic to these ranges does NOT go through Tor.
+type LANConfig struct {
+	Allow  bool     `json:"allow"`
+	Ranges []string `json:"ranges"` // IPv4 CIDRs, at most /8 wide
+}
+
+// JournalConfig holds settings for the persistent event journal.
+type JournalConfig struct {
+	Path      string `json:"path"`        // JSON-lines file; empty disables the journal
+	MaxSizeKB int    `json:"max_size_kb"` // rotate after this size (16-1048576)
+}
+
+// AlertConfig holds optional alert delivery settings for unattended
+// gateways. Alerts fire when the failsafe activates or the VM crash-loops.
+// While the failsafe is active only destinations reachable without the
+// VM (for example on the local network) can be delivered to.
+type AlertConfig struct {
+	SMTP               SMTPAlertConfig `json:"smtp"`
+	Push               PushAlertConfig `json:"push"`
+	MinIntervalSec     int             `json:"min_interval_sec"`      // suppress repeats of the same alert (60-86400)
+	CrashLoopThreshold int             `json:"crash_loop_threshold"`  // VM launches within the window (2-100)
+	CrashLoopWindowSec int             `json:"crash_loop_window_sec"` // 60-86400
+}
+
+// SMTPAlertConfig configures email alerts. Empty Host disables SMTP.
+type SMTPAlertConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// PushAlertConfig configures HTTP push alerts. Empty URL disables push.
+type PushAlertConfig struct {
+	URL    string `json:"url"`    // e.g. https://ntfy.sh/my-topic or https://gotify.lan/message
+	Format string `json:"format"` // "ntfy" or "gotify"
+	Token  string `json:"token"`  // bearer token (ntfy) or app key (gotify)
+}
+
+// Enabled reports whether any alert destination is configured.
+func (a AlertConfig) Enabled() bool {
+	return a.SMTP.Host != "" || a.Push.URL != ""
+}
+
+// MaintenanceConfig schedules unattended upkeep. Tasks run once per window
+// and are deferred while any Tor stream is open.
+type MaintenanceConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Window        string   `json:"window"`          // local "HH:MM-HH:MM"; may wrap past midnight
+	Days          []string `json:"days"`            // "mon".."sun"; empty means every day
+	UpdateCheck   bool     `json:"update_check"`    // check for a newer release
+	RotateLogs    bool     `json:"rotate_logs"`     // rotate the --log-file
+	RestartVM     bool     `json:"restart_vm"`      // clean VM restart, host routing kept
+	FsckStateDisk bool     `json:"fsck_state_disk"` // e2fsck while the VM is down (needs restart_vm)
+}
+
+// StorageConfig sets the retention rules enforced on the files the
+// controller leaves behind: rotated logs and the leftovers of interrupted
+// work. A limit of 0 days disables its rule.
+type StorageConfig struct {
+	LeftoverDays int `json:"leftover_days"` // remove leftovers older than this
+	LogDays      int `json:"log_days"`      // remove rotated logs older than this
+	CheckHours   int `json:"check_hours"`   // how often the rules are enforced
+}
+
+// PollingConfig sets how often the GUI refreshes status displays. Checks
+// that need the VM back off while it is down, up to MaxBackoffSec.
+type PollingConfig struct {
+	ServiceSec    int `json:"service_sec"`     // service manager status (1-3600)
+	CircuitsSec   int `json:"circuits_sec"`    // circuit list auto-refresh (1-3600)
+	BandwidthSec  int `json:"bandwidth_sec"`   // tray menu traffic rate (1-3600)
+	MaxBackoffSec int `json:"max_backoff_sec"` // at least the intervals above, at most 3600
+}
+
+// MigrationConfig configures live migration of the VM between hosts
+// ("torvm migrate" and --incoming).
+type MigrationConfig struct {
+	// TLSDir holds the x509 files for the migration channel: ca-cert.pem
+	// plus server-cert.pem/server-key.pem on the destination and
+	// client-cert.pem/client-key.pem on the source.
+	TLSDir string `json:"tls_dir"`
+}
+
+// HelperConfig is an auxiliary host process, such as a pluggable
+// transport client, a DNS forwarder, or a proxy frontend, that the
+// controller runs alongside the VM. It is restarted with backoff when it
+// exits, and its output goes to the controller's log.
+type HelperConfig struct {
+	Name string   `json:"name"` // as in the log; letters, digits, "_" and "-"
+	Path string   `json:"path"` // absolute path of the executable
+	Args []string `json:"args"`
+	// When is "running" (the default) to run the helper while Tor is up,
+	// or "session" to run it from the VM launch until the host network
+	// is restored.
+	When string `json:"when"`
+}
+
+// DiskConfig caps the VM's state disk I/O, e.g. on a shared SSD.
+// Limits are applied over QMP when the VM starts and when they change
+// while it runs. Zero leaves a limit off.
+type DiskConfig struct {
+	ReadMBps  int `json:"read_mbps"`  // megabytes per second
+	WriteMBps int `json:"write_mbps"` // megabytes per second
+	ReadIOPS  int `json:"read_iops"`
+	WriteIOPS int `json:"write_iops"`
 }
 
 // ProxyConfig holds upstream proxy settings for Tor.
@@ -55,11 +251,40 @@ type ProxyConfig struct {
 type RetryConfig struct {
 	Enabled     bool `json:"retry_enabled"`
 	MaxAttempts int  `json:"retry_max_attempts"`
+
+	// RestartMaxRetries is how many times in a row a VM that crashes
+	// while running is relaunched before the session ends; 0 disables
+	// restarts. The wait before each one starts at RestartBackoffSec and
+	// doubles.
+	RestartMaxRetries int `json:"restart_max_retries"`
+	RestartBackoffSec int `json:"restart_backoff_sec"`
 }
 
-// ServiceConfig holds launchd service settings (macOS).
+// ServiceConfig holds settings of the generated system service: the
+// launchd plist (macOS), the systemd unit (Linux), and the Windows
+// service. They take effect when the service is (re)installed.
 type ServiceConfig struct {
-	RunAtLoad bool `json:"run_at_load"`
+	RunAtLoad bool `json:"run_at_load"` // macOS; systemd units are enabled, Windows services start automatically
+
+	Nice         int               `json:"nice"`           // scheduling priority, -20 to 19; macOS and Linux
+	MaxOpenFiles int               `json:"max_open_files"` // 0 keeps the system default; macOS and Linux
+	MaxProcesses int               `json:"max_processes"`  // 0 keeps the system default; macOS and Linux
+	WatchPaths   []string          `json:"watch_paths"`    // macOS: start the service when one of these changes
+	Environment  map[string]string `json:"environment"`
+	LogPath      string            `json:"log_path"` // macOS: the service's output; "" means /var/log/torvm/torvm.log
+
+	// Backend runs the service as the privileged back end of a GUI run
+	// by a user (--backend, macOS and Linux): the VM starts when the GUI
+	// or "torvm start" asks rather than with the service.
+	Backend bool `json:"backend"`
+}
+
+// Args returns the controller's flags for the service on macOS and Linux.
+func (s ServiceConfig) Args() []string {
+	if s.Backend {
+		return []string{"--backend"}
+	}
+	return []string{"--headless"}
 }
 
 // EntropyConfig holds hardware entropy and RNG settings for the VM.
@@ -94,6 +319,16 @@ type EntropyConfig struct {
 	// VM via the kernel command line ENTROPY= parameter.
 	// Range: 16-256. Default: 64.
 	KernelEntropyBytes int `json:"kernel_entropy_bytes"`
+
+	// ReseedIntervalSec is how often, in seconds, the controller sends
+	// fresh host entropy to the running VM over a virtio-serial channel,
+	// on top of the boot-time ENTROPY= seed. 0 turns reseeding off.
+	// Range: 0 or 10-86400. Default: 300.
+	ReseedIntervalSec int `json:"reseed_interval_sec"`
+
+	// ReseedBytes is how many random bytes each reseed sends.
+	// Range: 16-4096. Default: 256.
+	ReseedBytes int `json:"reseed_bytes"`
 }
 
 // VectorConfig holds settings for vector (semantic) search using HNSW.
@@ -149,11 +384,14 @@ type RelayConfig struct {
 // Config holds all configuration for the TorVM controller.
 type Config struct {
 	Version       int    `json:"config_version"` // schema version for migration
+	Instance      string `json:"instance"`       // labels host artifacts as "torvm:<instance>"
 	TAPName       string `json:"tap_name"`
 	HostIP        string `json:"host_ip"`
 	VMIP          string `json:"vm_ip"`
 	SubnetMask    string `json:"subnet_mask"`
-	DNS1          string `json:"dns1"`
+	AutoSubnet    bool   `json:"auto_subnet"` // pick a free RFC 1918 subnet on conflict
+	MTU           int    `json:"mtu"`         // TAP and guest eth0 MTU (576-9000)
+	DNS1          string `json:"dns1"`        // TAP adapter DNS servers (Windows)
 	DNS2          string `json:"dns2"`
 	SOCKSPort     int    `json:"socks_port"`
 	ControlPort   int    `json:"control_port"`
@@ -165,23 +403,58 @@ type Config struct {
 	InitrdPath    string `json:"initrd_path"`
 	StateDiskPath string `json:"state_disk_path"`
 	QMPSocketPath string `json:"qmp_socket_path"`
+	APISocket     string `json:"api_socket"` // control API socket (see package api); empty disables it
+	GRPCSocket    string `json:"grpc_socket"` // gRPC control API socket (see package torvmpb); empty disables it
+	APIGroup      string `json:"api_group"`   // group whose members may use the API sockets besides root and the controller's user
 	Verbose       bool   `json:"verbose"`
 	Accel         string `json:"accel"`
 	Headless      bool   `json:"headless"`
+	KillSwitch    bool   `json:"kill_switch"` // keep the firewall rules if the session fails (not on Windows)
+	PanicWipe     bool   `json:"panic_wipe_state_disk"` // Emergency Stop also wipes the state disk
+	PanicLock     bool   `json:"panic_lock_screen"`     // Emergency Stop also locks the screen
+	WipeOnExit    bool   `json:"wipe_on_exit"`          // shred the torrc overlay and temporaries when a session ends
+	BlockDNSLeaks bool   `json:"block_dns_leaks"`       // drop DNS (53, 853) not sent to the VM while routed
+	PauseUnroute  bool   `json:"pause_unroute"`         // restore the host's own routes while the VM is paused
+	GuestFirewall bool   `json:"guest_firewall"`        // in-guest policy: only Tor connects out, only Tor's ports in (see GuestFirewallRules)
+
+	// TorrcExtra holds extra torrc lines, "Directive value", appended to
+	// the overlay. Only tuning directives are accepted (see
+	// torrcExtraDirectives).
+	TorrcExtra []string `json:"torrc_extra"`
 
 	// Runtime-detected platform capabilities (not persisted).
 	VhostNet     bool `json:"-"`
 	IOMMUEnabled bool `json:"-"`
 
-	Bridge        BridgeConfig  `json:"bridge"`
-	Proxy         ProxyConfig   `json:"proxy"`
-	Service       ServiceConfig `json:"service"`
-	Retry         RetryConfig   `json:"retry"`
-	Entropy       EntropyConfig `json:"entropy"`
-	Relays        RelayConfig   `json:"relays"`
-	Browser       BrowserConfig `json:"browser"`
-	FHE           FHEConfig     `json:"fhe"`
-	Vector        VectorConfig  `json:"vector"`
+	// Incoming is the address to receive a live migration on (the
+	// --incoming flag), or empty for a normal start.
+	Incoming string `json:"-"`
+
+	IPv6        IPv6Config        `json:"ipv6"`
+	Route       RouteConfig       `json:"route"`
+	LAN         LANConfig         `json:"lan"`
+	Sharing     SharingConfig     `json:"sharing"`
+	Journal     JournalConfig     `json:"journal"`
+	Alerts      AlertConfig       `json:"alerts"`
+	Maintenance MaintenanceConfig `json:"maintenance"`
+	Storage     StorageConfig     `json:"storage"`
+	Polling     PollingConfig     `json:"polling"`
+	Disk        DiskConfig        `json:"disk"`
+	Migration   MigrationConfig   `json:"migration"`
+	Bridge      BridgeConfig      `json:"bridge"`
+	Proxy       ProxyConfig       `json:"proxy"`
+	Service     ServiceConfig     `json:"service"`
+	Retry       RetryConfig       `json:"retry"`
+	Entropy     EntropyConfig     `json:"entropy"`
+	Relays      RelayConfig       `json:"relays"`
+	Browser     BrowserConfig     `json:"browser"`
+	FHE         FHEConfig         `json:"fhe"`
+	Vector      VectorConfig      `json:"vector"`
+	Helpers     []HelperConfig    `json:"helpers"`
+
+	// secretRefs maps secret fields loaded from "file:"/"env:" references
+	// to those references (see secret.go).
+	secretRefs map[string]secretRef
 }
 
 // DefaultConfig returns a Config with sensible defaults.
@@ -191,11 +464,15 @@ func DefaultConfig() *Config {
 		tapName = "TorVM Tap"
 	}
 
+	dirs := datadir.Default()
 	return &Config{
+		Instance:      "default",
 		TAPName:       tapName,
 		HostIP:        "10.10.10.2",
 		VMIP:          "10.10.10.1",
 		SubnetMask:    "255.255.255.252",
+		AutoSubnet:    true,
+		MTU:           1500,
 		DNS1:          "4.2.2.4",
 		DNS2:          "4.2.2.2",
 		SOCKSPort:     9050,
@@ -204,15 +481,60 @@ func DefaultConfig() *Config {
 		DNSPort:       9093,
 		VMMemoryMB:    128,
 		VMCPUs:        2,
-		KernelPath:    filepath.Join("dist", "vm", "vmlinuz"),
-		InitrdPath:    filepath.Join("dist", "vm", "initramfs.gz"),
-		StateDiskPath: filepath.Join("dist", "vm", "state.img"),
-		QMPSocketPath: defaultQMPPath(),
+		KernelPath:    filepath.Join(dirs.Images, "vmlinuz"),
+		InitrdPath:    filepath.Join(dirs.Images, "initramfs.gz"),
+		StateDiskPath: filepath.Join(dirs.Data, "state.img"),
+		QMPSocketPath: defaultQMPPath(dirs),
+		APISocket:     api.DefaultSocketPath(),
 		Verbose:       false,
 		Accel:         "",
+		BlockDNSLeaks: true,
+		IPv6: IPv6Config{
+			Mode:      "block",
+			HostIP:    "fd10:10:10::2",
+			VMIP:      "fd10:10:10::1",
+			PrefixLen: 126,
+		},
+		LAN: LANConfig{
+			Ranges: []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "169.254.0.0/16"},
+		},
+		Sharing: SharingConfig{Mode: "warn"},
+		Migration: MigrationConfig{
+			TLSDir: filepath.Join(dirs.Data, "migration-tls"),
+		},
+		Journal: JournalConfig{
+			Path:      filepath.Join(dirs.Data, "events.jsonl"),
+			MaxSizeKB: 1024,
+		},
+		Alerts: AlertConfig{
+			SMTP:               SMTPAlertConfig{Port: 587},
+			Push:               PushAlertConfig{Format: "ntfy"},
+			MinIntervalSec:     900,
+			CrashLoopThreshold: 3,
+			CrashLoopWindowSec: 600,
+		},
+		Maintenance: MaintenanceConfig{
+			Window:        "03:00-05:00",
+			UpdateCheck:   true,
+			RotateLogs:    true,
+			FsckStateDisk: true,
+		},
+		Storage: StorageConfig{
+			LeftoverDays: 7,
+			LogDays:      30,
+			CheckHours:   24,
+		},
+		Polling: PollingConfig{
+			ServiceSec:    5,
+			CircuitsSec:   5,
+			BandwidthSec:  2,
+			MaxBackoffSec: 60,
+		},
 		Retry: RetryConfig{
-			Enabled:     true,
-			MaxAttempts: 3,
+			Enabled:           true,
+			MaxAttempts:       3,
+			RestartMaxRetries: 3,
+			RestartBackoffSec: 10,
 		},
 		Entropy: EntropyConfig{
 			EnableHaveged:      true,
@@ -221,10 +543,12 @@ func DefaultConfig() *Config {
 			VirtioRNGMaxBytes:  1024,
 			VirtioRNGPeriod:    1000,
 			KernelEntropyBytes: 64,
+			ReseedIntervalSec:  300,
+			ReseedBytes:        256,
 		},
 		Vector: VectorConfig{
 			Enabled:         false,
-			IndexDir:        filepath.Join("dist", "vector"),
+			IndexDir:        filepath.Join(dirs.Data, "vector"),
 			Dimension:       128,
 			HNSWm:           16,
 			HNSWefConstruct: 200,
@@ -234,7 +558,7 @@ func DefaultConfig() *Config {
 		},
 		FHE: FHEConfig{
 			Enabled:           false,
-			IndexDir:          filepath.Join("dist", "fhe"),
+			IndexDir:          filepath.Join(dirs.Data, "fhe"),
 			HiddenServicePort: 8443,
 			RingDegree:        12, // logN=12, N=4096
 			AutoIndexInterval: 60,
@@ -244,10 +568,10 @@ func DefaultConfig() *Config {
 			Enabled:           false,
 			VMMemoryMB:        512,
 			VMCPUs:            2,
-			KernelPath:        filepath.Join("dist", "browservm", "vmlinuz"),
-			InitrdPath:        filepath.Join("dist", "browservm", "initramfs.gz"),
-			StateDiskPath:     filepath.Join("dist", "browservm", "state.img"),
-			QMPSocketPath:     defaultBrowserQMPPath(),
+			KernelPath:        filepath.Join(dirs.BrowserImages, "vmlinuz"),
+			InitrdPath:        filepath.Join(dirs.BrowserImages, "initramfs.gz"),
+			StateDiskPath:     filepath.Join(dirs.Data, "browservm", "state.img"),
+			QMPSocketPath:     defaultBrowserQMPPath(dirs),
 			VNCDisplay:        1,
 			AutoStart:         true,
 			CanaryIntervalSec: 5,
@@ -257,7 +581,8 @@ func DefaultConfig() *Config {
 	}
 }
 
-// Load reads configuration from a JSON file and merges it with defaults.
+// Load reads configuration from a JSON, TOML, or YAML file, by its
+// extension (see FormatOf), and merges it with defaults.
 func Load(path string) (*Config, error) {
 	cfg := DefaultConfig()
 	if path == "" {
@@ -293,10 +618,19 @@ func Load(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if data, err = toJSON(data, FormatOf(path)); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
 	data, _ = migrateJSON(data)
 
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, err
+	if err := decodeStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.resolvePaths(data, path); err != nil {
+		return nil, fmt.Errorf("config paths: %w", err)
+	}
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("config secrets: %w", err)
 	}
 	cfg.Version = ConfigVersion
 	if err := cfg.Validate(); err != nil {
@@ -305,6 +639,60 @@ func Load(path string) (*Config, error) {
 	return cfg, nil
 }
 
+// pathFields returns the file paths that a config file may give relative
+// to its own directory, keyed by their JSON path.
+func (c *Config) pathFields() map[string]*string {
+	return map[string]*string{
+		"kernel_path":                     &c.KernelPath,
+		"initrd_path":                     &c.InitrdPath,
+		"state_disk_path":                 &c.StateDiskPath,
+		"browser.browser_kernel_path":     &c.Browser.KernelPath,
+		"browser.browser_initrd_path":     &c.Browser.InitrdPath,
+		"browser.browser_state_disk_path": &c.Browser.StateDiskPath,
+	}
+}
+
+// resolvePaths makes the relative paths that the config JSON data, read
+// from the file at path, sets absolute against the file's directory
+// rather than the working directory, which is / for a service. Defaults
+// the file leaves alone are not touched. Saving the config writes the
+// absolute paths.
+func (c *Config) resolvePaths(data []byte, path string) error {
+	var set map[string]any
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	for name, p := range c.pathFields() {
+		if *p == "" || filepath.IsAbs(*p) || !hasKey(set, name) {
+			continue
+		}
+		*p = filepath.Join(dir, *p)
+	}
+	return nil
+}
+
+// hasKey reports whether the decoded JSON object v has the key at the
+// JSON path name, in any case, as the decoder matches keys.
+func hasKey(v map[string]any, name string) bool {
+	first, rest, nested := strings.Cut(name, ".")
+	for key, e := range v {
+		if !strings.EqualFold(key, first) {
+			continue
+		}
+		if !nested {
+			return true
+		}
+		if m, ok := e.(map[string]any); ok && hasKey(m, rest) {
+			return true
+		}
+	}
+	return false
+}
+
 // Validate checks all config fields for safety and correctness.
 func (c *Config) Validate() error {
 	// Validate IP addresses.
@@ -320,6 +708,25 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if err := validateIPv6(&c.IPv6); err != nil {
+		return err
+	}
+	if c.MTU < 576 || c.MTU > 9000 {
+		return fmt.Errorf("MTU must be 576-9000, got %d", c.MTU)
+	}
+	if c.IPv6.Mode == "route" && c.MTU < 1280 {
+		return fmt.Errorf("MTU must be at least 1280 in IPv6 route mode, got %d", c.MTU)
+	}
+	if err := validateRoute(&c.Route); err != nil {
+		return err
+	}
+	if err := validateLAN(&c.LAN); err != nil {
+		return err
+	}
+	if err := validateSharing(&c.Sharing); err != nil {
+		return err
+	}
+
 	// Validate ports.
 	if err := validatePort("SOCKSPort", c.SOCKSPort); err != nil {
 		return err
@@ -340,8 +747,8 @@ func (c *Config) Validate() error {
 	}
 
 	// Validate VM CPUs.
-	if c.VMCPUs < 1 || c.VMCPUs > 16 {
-		return fmt.Errorf("VMCPUs must be 1-16, got %d", c.VMCPUs)
+	if c.VMCPUs < 1 || c.VMCPUs > MaxVMCPUs {
+		return fmt.Errorf("VMCPUs must be 1-%d, got %d", MaxVMCPUs, c.VMCPUs)
 	}
 
 	// Required paths must be non-empty.
@@ -356,11 +763,22 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Instance names are embedded in interface aliases and firewall rule
+	// names, so restrict them to a conservative character set.
+	if !instanceNameRe.MatchString(c.Instance) {
+		return fmt.Errorf("Instance %q must be 1-32 letters, digits, underscores, or hyphens", c.Instance)
+	}
+
 	// TAPName must match a strict whitelist pattern.
 	if err := validateTAPName(c.TAPName); err != nil {
 		return err
 	}
 
+	// Windows Firewall cannot exempt the TAP adapter from a block rule.
+	if c.KillSwitch && runtime.GOOS == "windows" {
+		return fmt.Errorf("KillSwitch is not supported on Windows")
+	}
+
 	// Whitelist acceleration backends.
 	switch c.Accel {
 	case "", "kvm", "hvf", "whpx", "tcg":
@@ -379,11 +797,21 @@ func (c *Config) Validate() error {
 
 	// Whitelist bridge transports.
 	switch c.Bridge.Transport {
-	case "", "none", "obfs4", "meek-azure", "snowflake":
+	case "", "none", "obfs4", "meek-azure", "snowflake", "webtunnel":
 		// valid
 	default:
 		return fmt.Errorf("invalid Bridge.Transport: %q", c.Bridge.Transport)
 	}
+	if err := validateSnowflake(&c.Bridge.Snowflake); err != nil {
+		return err
+	}
+	if err := validateBridges(&c.Bridge); err != nil {
+		return err
+	}
+
+	if err := validateTorrcExtra(c.TorrcExtra); err != nil {
+		return err
+	}
 
 	// Validate entropy settings.
 	if c.Entropy.VirtioRNGMaxBytes < 64 || c.Entropy.VirtioRNGMaxBytes > 65536 {
@@ -395,6 +823,12 @@ func (c *Config) Validate() error {
 	if c.Entropy.KernelEntropyBytes < 16 || c.Entropy.KernelEntropyBytes > 256 {
 		return fmt.Errorf("Entropy.KernelEntropyBytes must be 16-256, got %d", c.Entropy.KernelEntropyBytes)
 	}
+	if r := c.Entropy.ReseedIntervalSec; r != 0 && (r < 10 || r > 86400) {
+		return fmt.Errorf("Entropy.ReseedIntervalSec must be 0 or 10-86400, got %d", r)
+	}
+	if c.Entropy.ReseedBytes < 16 || c.Entropy.ReseedBytes > 4096 {
+		return fmt.Errorf("Entropy.ReseedBytes must be 16-4096, got %d", c.Entropy.ReseedBytes)
+	}
 	if c.Entropy.SerialEntropyDevice != "" {
 		if strings.Contains(c.Entropy.SerialEntropyDevice, "\x00") {
 			return fmt.Errorf("Entropy.SerialEntropyDevice contains null byte")
@@ -407,6 +841,66 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate event journal settings if enabled.
+	if c.Journal.Path != "" {
+		if strings.Contains(c.Journal.Path, "\x00") {
+			return fmt.Errorf("Journal.Path contains null byte")
+		}
+		if c.Journal.MaxSizeKB < 16 || c.Journal.MaxSizeKB > 1048576 {
+			return fmt.Errorf("Journal.MaxSizeKB must be 16-1048576, got %d", c.Journal.MaxSizeKB)
+		}
+	}
+
+	// Validate alert settings if any destination is configured.
+	if c.Alerts.Enabled() {
+		if err := validateAlerts(&c.Alerts); err != nil {
+			return err
+		}
+	}
+
+	// Validate maintenance schedule if enabled.
+	if c.Maintenance.Enabled {
+		if !maintenanceWindowRe.MatchString(c.Maintenance.Window) {
+			return fmt.Errorf("Maintenance.Window must be HH:MM-HH:MM, got %q", c.Maintenance.Window)
+		}
+		for _, d := range c.Maintenance.Days {
+			switch strings.ToLower(d) {
+			case "mon", "tue", "wed", "thu", "fri", "sat", "sun":
+				// valid
+			default:
+				return fmt.Errorf("invalid Maintenance.Days entry: %q", d)
+			}
+		}
+	}
+
+	// Validate storage retention rules.
+	if c.Storage.LeftoverDays < 0 || c.Storage.LeftoverDays > 3650 {
+		return fmt.Errorf("Storage.LeftoverDays must be 0-3650, got %d", c.Storage.LeftoverDays)
+	}
+	if c.Storage.LogDays < 0 || c.Storage.LogDays > 3650 {
+		return fmt.Errorf("Storage.LogDays must be 0-3650, got %d", c.Storage.LogDays)
+	}
+	if c.Storage.CheckHours < 1 || c.Storage.CheckHours > 720 {
+		return fmt.Errorf("Storage.CheckHours must be 1-720, got %d", c.Storage.CheckHours)
+	}
+
+	if err := validateService(&c.Service); err != nil {
+		return err
+	}
+
+	if err := validatePolling(&c.Polling); err != nil {
+		return err
+	}
+	if err := validateRetry(&c.Retry); err != nil {
+		return err
+	}
+	if err := validateDisk(&c.Disk); err != nil {
+		return err
+	}
+	if err := validateHelpers(c.Helpers); err != nil {
+		return err
+	}
+
 	// Validate vector search settings if enabled.
 	if c.Vector.Enabled {
 		if c.Vector.Dimension < 8 || c.Vector.Dimension > 2048 {
@@ -479,6 +973,235 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// validateAlerts checks alert destinations and rate-limit settings.
+func validateAlerts(a *AlertConfig) error {
+	if a.MinIntervalSec < 60 || a.MinIntervalSec > 86400 {
+		return fmt.Errorf("Alerts.MinIntervalSec must be 60-86400, got %d", a.MinIntervalSec)
+	}
+	if a.CrashLoopThreshold < 2 || a.CrashLoopThreshold > 100 {
+		return fmt.Errorf("Alerts.CrashLoopThreshold must be 2-100, got %d", a.CrashLoopThreshold)
+	}
+	if a.CrashLoopWindowSec < 60 || a.CrashLoopWindowSec > 86400 {
+		return fmt.Errorf("Alerts.CrashLoopWindowSec must be 60-86400, got %d", a.CrashLoopWindowSec)
+	}
+	if a.SMTP.Host != "" {
+		if err := validatePort("Alerts.SMTP.Port", a.SMTP.Port); err != nil {
+			return err
+		}
+		if a.SMTP.From == "" || len(a.SMTP.To) == 0 {
+			return fmt.Errorf("Alerts.SMTP requires from and at least one to address")
+		}
+		for _, addr := range append([]string{a.SMTP.From}, a.SMTP.To...) {
+			if strings.ContainsAny(addr, "\r\n") {
+				return fmt.Errorf("Alerts.SMTP address %q contains a line break", addr)
+			}
+		}
+	}
+	if a.Push.URL != "" {
+		if !strings.HasPrefix(a.Push.URL, "https://") && !strings.HasPrefix(a.Push.URL, "http://") {
+			return fmt.Errorf("Alerts.Push.URL must be an http(s) URL, got %q", a.Push.URL)
+		}
+		switch a.Push.Format {
+		case "ntfy", "gotify":
+			// valid
+		default:
+			return fmt.Errorf("invalid Alerts.Push.Format: %q", a.Push.Format)
+		}
+	}
+	return nil
+}
+
+func validatePolling(p *PollingConfig) error {
+	for _, f := range []struct {
+		name string
+		val  int
+	}{
+		{"Polling.ServiceSec", p.ServiceSec},
+		{"Polling.CircuitsSec", p.CircuitsSec},
+		{"Polling.BandwidthSec", p.BandwidthSec},
+	} {
+		if f.val < 1 || f.val > 3600 {
+			return fmt.Errorf("%s must be 1-3600, got %d", f.name, f.val)
+		}
+		if f.val > p.MaxBackoffSec {
+			return fmt.Errorf("Polling.MaxBackoffSec (%d) must be at least %s (%d)", p.MaxBackoffSec, f.name, f.val)
+		}
+	}
+	if p.MaxBackoffSec > 3600 {
+		return fmt.Errorf("Polling.MaxBackoffSec must be at most 3600, got %d", p.MaxBackoffSec)
+	}
+	return nil
+}
+
+func validateRetry(r *RetryConfig) error {
+	if r.RestartMaxRetries < 0 || r.RestartMaxRetries > 100 {
+		return fmt.Errorf("Retry.RestartMaxRetries must be 0-100, got %d", r.RestartMaxRetries)
+	}
+	if r.RestartMaxRetries > 0 && (r.RestartBackoffSec < 1 || r.RestartBackoffSec > 3600) {
+		return fmt.Errorf("Retry.RestartBackoffSec must be 1-3600, got %d", r.RestartBackoffSec)
+	}
+	return nil
+}
+
+func validateHelpers(helpers []HelperConfig) error {
+	names := make(map[string]bool)
+	for _, h := range helpers {
+		if !instanceNameRe.MatchString(h.Name) {
+			return fmt.Errorf("Helpers name %q must be 1-32 letters, digits, underscores, or hyphens", h.Name)
+		}
+		if names[h.Name] {
+			return fmt.Errorf("Helpers name %q is used twice", h.Name)
+		}
+		names[h.Name] = true
+		if !filepath.IsAbs(h.Path) || strings.Contains(h.Path, "\x00") {
+			return fmt.Errorf("Helpers %s: path must be absolute, got %q", h.Name, h.Path)
+		}
+		switch h.When {
+		case "", "running", "session":
+			// valid
+		default:
+			return fmt.Errorf("Helpers %s: invalid when: %q", h.Name, h.When)
+		}
+	}
+	return nil
+}
+
+func validateDisk(d *DiskConfig) error {
+	for _, f := range []struct {
+		name string
+		val  int
+	}{
+		{"Disk.ReadMBps", d.ReadMBps},
+		{"Disk.WriteMBps", d.WriteMBps},
+		{"Disk.ReadIOPS", d.ReadIOPS},
+		{"Disk.WriteIOPS", d.WriteIOPS},
+	} {
+		if f.val < 0 || f.val > 1000000 {
+			return fmt.Errorf("%s must be 0-1000000, got %d", f.name, f.val)
+		}
+	}
+	return nil
+}
+
+// ulaNet is the IPv6 unique local address range (fc00::/7).
+var ulaNet = &net.IPNet{IP: net.ParseIP("fc00::"), Mask: net.CIDRMask(7, 128)}
+
+// validateIPv6 checks the IPv6 policy. Addresses are only required in
+// route mode, where they must be distinct ULAs sharing one prefix.
+func validateIPv6(c *IPv6Config) error {
+	if c.ClientPreferIPv6ORPort && !c.ClientUseIPv6 {
+		return fmt.Errorf("IPv6.ClientPreferIPv6ORPort requires IPv6.ClientUseIPv6")
+	}
+	switch c.Mode {
+	case "block", "off":
+		return nil
+	case "route":
+	default:
+		return fmt.Errorf("invalid IPv6.Mode: %q", c.Mode)
+	}
+	if c.PrefixLen < 64 || c.PrefixLen > 127 {
+		return fmt.Errorf("IPv6.PrefixLen must be 64-127, got %d", c.PrefixLen)
+	}
+	for _, pair := range []struct{ name, val string }{
+		{"IPv6.HostIP", c.HostIP},
+		{"IPv6.VMIP", c.VMIP},
+	} {
+		ip := net.ParseIP(pair.val)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid IPv6 address for %s: %q", pair.name, pair.val)
+		}
+		if !ulaNet.Contains(ip) {
+			return fmt.Errorf("%s must be a unique local address (fc00::/7), got %q", pair.name, pair.val)
+		}
+	}
+	host, vm := net.ParseIP(c.HostIP), net.ParseIP(c.VMIP)
+	if host.Equal(vm) {
+		return fmt.Errorf("IPv6.HostIP and IPv6.VMIP must differ")
+	}
+	mask := net.CIDRMask(c.PrefixLen, 128)
+	if !host.Mask(mask).Equal(vm.Mask(mask)) {
+		return fmt.Errorf("IPv6.HostIP and IPv6.VMIP must share a /%d prefix", c.PrefixLen)
+	}
+	return nil
+}
+
+// validateRoute checks the default route policy.
+func validateRoute(c *RouteConfig) error {
+	switch c.Strategy {
+	case "", "replace", "split":
+	case "metric":
+		if runtime.GOOS == "darwin" {
+			return fmt.Errorf("Route.Strategy %q is not supported on macOS, which has no route metrics", c.Strategy)
+		}
+	default:
+		return fmt.Errorf("invalid Route.Strategy: %q", c.Strategy)
+	}
+	if c.Metric < 0 || c.Metric > 9999 {
+		return fmt.Errorf("Route.Metric must be 0-9999, got %d", c.Metric)
+	}
+	return nil
+}
+
+// validateLAN checks the LAN exclusion ranges. Wide ranges are rejected so
+// that a typo cannot route a large share of the internet around Tor.
+func validateLAN(c *LANConfig) error {
+	if c.Allow && len(c.Ranges) == 0 {
+		return fmt.Errorf("LAN.Ranges must not be empty when LAN.Allow is set")
+	}
+	for _, r := range c.Ranges {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil || n.IP.To4() == nil {
+			return fmt.Errorf("invalid IPv4 CIDR in LAN.Ranges: %q", r)
+		}
+		if ones, _ := n.Mask.Size(); ones < 8 {
+			return fmt.Errorf("LAN.Ranges entry %q is wider than /8", r)
+		}
+	}
+	return nil
+}
+
+// validateSharing checks the connection sharing policy.
+func validateSharing(c *SharingConfig) error {
+	switch c.Mode {
+	case "warn", "refuse":
+	case "route":
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("Sharing.Mode %q is only supported on Linux", c.Mode)
+		}
+	default:
+		return fmt.Errorf("invalid Sharing.Mode: %q", c.Mode)
+	}
+	return nil
+}
+
+// validateService checks the service overrides, which end up in plist
+// XML, systemd unit lines, and the registry.
+func validateService(c *ServiceConfig) error {
+	if c.Nice < -20 || c.Nice > 19 {
+		return fmt.Errorf("Service.Nice must be -20 to 19, got %d", c.Nice)
+	}
+	if c.MaxOpenFiles < 0 || c.MaxProcesses < 0 {
+		return fmt.Errorf("Service.MaxOpenFiles and Service.MaxProcesses must not be negative")
+	}
+	for _, p := range c.WatchPaths {
+		if !filepath.IsAbs(p) || strings.ContainsAny(p, "\x00\n\r") {
+			return fmt.Errorf("invalid Service.WatchPaths entry: %q", p)
+		}
+	}
+	if c.LogPath != "" && (!filepath.IsAbs(c.LogPath) || strings.ContainsAny(c.LogPath, "\x00\n\r")) {
+		return fmt.Errorf("Service.LogPath must be an absolute path, got %q", c.LogPath)
+	}
+	for k, v := range c.Environment {
+		if !envNameRe.MatchString(k) {
+			return fmt.Errorf("invalid Service.Environment name: %q", k)
+		}
+		if strings.ContainsAny(v, "\x00\n\r") {
+			return fmt.Errorf("Service.Environment %s contains a control character", k)
+		}
+	}
+	return nil
+}
+
 func validatePort(name string, port int) error {
 	if port < 1 || port > 65535 {
 		return fmt.Errorf("%s must be 1-65535, got %d", name, port)
@@ -486,16 +1209,16 @@ func validatePort(name string, port int) error {
 	return nil
 }
 
-func defaultQMPPath() string {
+func defaultQMPPath(dirs datadir.Dirs) string {
 	if runtime.GOOS == "windows" {
 		return `\\.\pipe\torvm-qmp`
 	}
-	return "/run/torvm/qmp.sock"
+	return filepath.Join(dirs.Runtime, "qmp.sock")
 }
 
-func defaultBrowserQMPPath() string {
+func defaultBrowserQMPPath(dirs datadir.Dirs) string {
 	if runtime.GOOS == "windows" {
 		return `\\.\pipe\torvm-browser-qmp`
 	}
-	return "/run/torvm/browser-qmp.sock"
+	return filepath.Join(dirs.Runtime, "browser-qmp.sock")
 }
@@ -2,8 +2,11 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -104,6 +107,33 @@ func TestValidateCPUBounds(t *testing.T) {
 	}
 }
 
+func TestValidateMTUBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		mtu     int
+		ipv6    string
+		wantErr bool
+	}{
+		{"too low", 575, "block", true},
+		{"minimum", 576, "block", false},
+		{"pppoe", 1492, "route", false},
+		{"maximum", 9000, "block", false},
+		{"too high", 9001, "block", true},
+		{"below ipv6 minimum", 1200, "route", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MTU = tt.mtu
+			cfg.IPv6.Mode = tt.ipv6
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MTU=%d: got err=%v, wantErr=%v", tt.mtu, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateTAPNameUnix(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -179,6 +209,55 @@ func TestValidateProxyType(t *testing.T) {
 	}
 }
 
+func TestValidateRoute(t *testing.T) {
+	tests := []struct {
+		strategy string
+		metric   int
+		wantErr  bool
+	}{
+		{"", 0, false},
+		{"metric", 10, runtime.GOOS == "darwin"},
+		{"replace", 0, false},
+		{"split", 9999, false},
+		{"scoped", 0, true},
+		{"split", -1, true},
+		{"", 10000, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("route=%s/%d", tt.strategy, tt.metric), func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Route = RouteConfig{Strategy: tt.strategy, Metric: tt.metric}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Route=%+v: got err=%v, wantErr=%v", cfg.Route, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSharing(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{"warn", false},
+		{"refuse", false},
+		{"route", runtime.GOOS != "linux"},
+		{"", true},
+		{"ignore", true},
+	}
+	for _, tt := range tests {
+		t.Run("mode="+tt.mode, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Sharing.Mode = tt.mode
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sharing.Mode=%q: got err=%v, wantErr=%v", tt.mode, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateBridgeTransport(t *testing.T) {
 	tests := []struct {
 		transport string
@@ -258,6 +337,64 @@ func TestLoadValidJSON(t *testing.T) {
 	}
 }
 
+func TestLoadUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"sock_port": 9150, "bridge": {"use_bridge": true}, "helpers": [{"name": "x", "path": "/bin/true", "argz": []}], "frobnicate": 1}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("Load accepted unknown keys")
+	}
+	for _, want := range []string{
+		"sock_port: did you mean socks_port?",
+		"bridge.use_bridge: did you mean use_bridges?",
+		"helpers[0].argz: did you mean args?",
+		"frobnicate;",
+	} {
+		if !strings.Contains(err.Error()+";", want) {
+			t.Errorf("error %q lacks %q", err, want)
+		}
+	}
+
+	// Keys match fields regardless of case, as encoding/json has it.
+	if err := os.WriteFile(path, []byte(`{"SOCKS_PORT": 9150}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := Load(path); err != nil || cfg.SOCKSPort != 9150 {
+		t.Errorf("Load with an upper-case key = %v", err)
+	}
+}
+
+func TestLoadRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	abs := filepath.Join(dir, "browservm", "initramfs.gz")
+	data := fmt.Sprintf(`{"kernel_path": "vm/vmlinuz", "STATE_DISK_PATH": "../state.img", "browser": {"browser_initrd_path": %q}}`, abs)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Load from elsewhere, with the file named by a relative path.
+	t.Chdir(filepath.Dir(dir))
+	cfg, err := Load(filepath.Join(filepath.Base(dir), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := DefaultConfig()
+	for _, tt := range []struct{ name, got, want string }{
+		{"KernelPath", cfg.KernelPath, filepath.Join(dir, "vm", "vmlinuz")},
+		{"StateDiskPath", cfg.StateDiskPath, filepath.Join(filepath.Dir(dir), "state.img")},
+		{"Browser.InitrdPath", cfg.Browser.InitrdPath, abs},
+		// Defaults the file leaves alone stay as they are.
+		{"InitrdPath", cfg.InitrdPath, def.InitrdPath},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
 func TestLoadInsecurePermissions(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "config.json")
@@ -352,6 +489,33 @@ func TestValidateEntropyKernelBytes(t *testing.T) {
 	}
 }
 
+func TestValidateEntropyReseed(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval int
+		bytes    int
+		wantErr  bool
+	}{
+		{"default", 300, 256, false},
+		{"off", 0, 256, false},
+		{"interval too short", 5, 256, true},
+		{"interval too long", 86401, 256, true},
+		{"too few bytes", 300, 8, true},
+		{"too many bytes", 300, 8192, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Entropy.ReseedIntervalSec = tt.interval
+			cfg.Entropy.ReseedBytes = tt.bytes
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ReseedIntervalSec=%d ReseedBytes=%d: got err=%v, wantErr=%v", tt.interval, tt.bytes, err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateEntropySerialDevice(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -390,3 +554,248 @@ func TestLoadConfigWithInvalidValues(t *testing.T) {
 		t.Error("expected validation error for VMMemoryMB=8")
 	}
 }
+
+func TestValidateIPv6(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*IPv6Config)
+		wantErr bool
+	}{
+		{"default block", func(c *IPv6Config) {}, false},
+		{"off", func(c *IPv6Config) { c.Mode = "off" }, false},
+		{"route", func(c *IPv6Config) { c.Mode = "route" }, false},
+		{"unknown mode", func(c *IPv6Config) { c.Mode = "tunnel" }, true},
+		{"block ignores addresses", func(c *IPv6Config) { c.HostIP = "bogus" }, false},
+		{"route non-ULA", func(c *IPv6Config) { c.Mode = "route"; c.HostIP = "2001:db8::2" }, true},
+		{"route IPv4", func(c *IPv6Config) { c.Mode = "route"; c.VMIP = "10.10.10.1" }, true},
+		{"route same address", func(c *IPv6Config) { c.Mode = "route"; c.VMIP = c.HostIP }, true},
+		{"route different prefix", func(c *IPv6Config) { c.Mode = "route"; c.VMIP = "fd10:10:11::1" }, true},
+		{"route prefix too short", func(c *IPv6Config) { c.Mode = "route"; c.PrefixLen = 48 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.IPv6)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLAN(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*LANConfig)
+		wantErr bool
+	}{
+		{"default ranges", func(c *LANConfig) { c.Allow = true }, false},
+		{"custom range", func(c *LANConfig) { c.Allow = true; c.Ranges = []string{"192.168.1.0/24"} }, false},
+		{"empty when allowed", func(c *LANConfig) { c.Allow = true; c.Ranges = nil }, true},
+		{"not a CIDR", func(c *LANConfig) { c.Ranges = []string{"192.168.1.1"} }, true},
+		{"IPv6 range", func(c *LANConfig) { c.Ranges = []string{"fd00::/8"} }, true},
+		{"too wide", func(c *LANConfig) { c.Ranges = []string{"0.0.0.0/1"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.LAN)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAlerts(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*AlertConfig)
+		wantErr bool
+	}{
+		{"disabled ignores limits", func(a *AlertConfig) { a.MinIntervalSec = 0 }, false},
+		{"ntfy", func(a *AlertConfig) { a.Push.URL = "https://ntfy.sh/gw" }, false},
+		{"gotify", func(a *AlertConfig) { a.Push.URL = "http://gotify.lan/message"; a.Push.Format = "gotify" }, false},
+		{"push bad scheme", func(a *AlertConfig) { a.Push.URL = "file:///etc/passwd" }, true},
+		{"push bad format", func(a *AlertConfig) { a.Push.URL = "https://ntfy.sh/gw"; a.Push.Format = "slack" }, true},
+		{"smtp", func(a *AlertConfig) {
+			a.SMTP.Host = "mail.lan"
+			a.SMTP.From = "torvm@lan"
+			a.SMTP.To = []string{"me@lan"}
+		}, false},
+		{"smtp missing recipients", func(a *AlertConfig) { a.SMTP.Host = "mail.lan"; a.SMTP.From = "torvm@lan" }, true},
+		{"smtp header injection", func(a *AlertConfig) {
+			a.SMTP.Host = "mail.lan"
+			a.SMTP.From = "torvm@lan\r\nBcc: x@y"
+			a.SMTP.To = []string{"me@lan"}
+		}, true},
+		{"interval too short", func(a *AlertConfig) { a.Push.URL = "https://ntfy.sh/gw"; a.MinIntervalSec = 5 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.Alerts)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMaintenance(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*MaintenanceConfig)
+		wantErr bool
+	}{
+		{"disabled ignores window", func(m *MaintenanceConfig) { m.Window = "bogus" }, false},
+		{"default window", func(m *MaintenanceConfig) { m.Enabled = true }, false},
+		{"wraps midnight", func(m *MaintenanceConfig) { m.Enabled = true; m.Window = "23:30-01:00" }, false},
+		{"bad window", func(m *MaintenanceConfig) { m.Enabled = true; m.Window = "3am-5am" }, true},
+		{"days", func(m *MaintenanceConfig) { m.Enabled = true; m.Days = []string{"sat", "Sun"} }, false},
+		{"bad day", func(m *MaintenanceConfig) { m.Enabled = true; m.Days = []string{"weekend"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.Maintenance)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*StorageConfig)
+		wantErr bool
+	}{
+		{"defaults", func(s *StorageConfig) {}, false},
+		{"rules disabled", func(s *StorageConfig) { s.LeftoverDays = 0; s.LogDays = 0 }, false},
+		{"negative days", func(s *StorageConfig) { s.LogDays = -1 }, true},
+		{"no check interval", func(s *StorageConfig) { s.CheckHours = 0 }, true},
+		{"check interval too long", func(s *StorageConfig) { s.CheckHours = 721 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.Storage)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHelpers(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "dnsproxy")
+	tests := []struct {
+		name    string
+		helpers []HelperConfig
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"running", []HelperConfig{{Name: "dns", Path: bin}}, false},
+		{"session", []HelperConfig{{Name: "pt", Path: bin, Args: []string{"-v"}, When: "session"}}, false},
+		{"bad when", []HelperConfig{{Name: "dns", Path: bin, When: "always"}}, true},
+		{"relative path", []HelperConfig{{Name: "dns", Path: "dnsproxy"}}, true},
+		{"bad name", []HelperConfig{{Name: "dns proxy", Path: bin}}, true},
+		{"duplicate name", []HelperConfig{{Name: "dns", Path: bin}, {Name: "dns", Path: bin}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Helpers = tt.helpers
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePolling(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*PollingConfig)
+		wantErr bool
+	}{
+		{"defaults", func(p *PollingConfig) {}, false},
+		{"zero interval", func(p *PollingConfig) { p.ServiceSec = 0 }, true},
+		{"interval above backoff", func(p *PollingConfig) { p.CircuitsSec = 120 }, true},
+		{"zero bandwidth interval", func(p *PollingConfig) { p.BandwidthSec = 0 }, true},
+		{"long backoff", func(p *PollingConfig) { p.MaxBackoffSec = 3600 }, false},
+		{"backoff too long", func(p *PollingConfig) { p.MaxBackoffSec = 7200 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.Polling)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDisk(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*DiskConfig)
+		wantErr bool
+	}{
+		{"unlimited", func(d *DiskConfig) {}, false},
+		{"limits", func(d *DiskConfig) { d.WriteMBps = 20; d.ReadIOPS = 500 }, false},
+		{"negative", func(d *DiskConfig) { d.ReadMBps = -1 }, true},
+		{"too high", func(d *DiskConfig) { d.WriteIOPS = 2000000 }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.Disk)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateService(t *testing.T) {
+	tests := []struct {
+		name    string
+		set     func(*ServiceConfig)
+		wantErr bool
+	}{
+		{"defaults", func(s *ServiceConfig) {}, false},
+		{"overrides", func(s *ServiceConfig) {
+			s.Nice = -5
+			s.MaxOpenFiles = 4096
+			s.WatchPaths = []string{"/etc/torvm/config.json"}
+			s.Environment = map[string]string{"TZ": "UTC"}
+		}, false},
+		{"nice too low", func(s *ServiceConfig) { s.Nice = -21 }, true},
+		{"negative limit", func(s *ServiceConfig) { s.MaxProcesses = -1 }, true},
+		{"relative watch path", func(s *ServiceConfig) { s.WatchPaths = []string{"config.json"} }, true},
+		{"bad env name", func(s *ServiceConfig) { s.Environment = map[string]string{"A=B": "x"} }, true},
+		{"newline in env", func(s *ServiceConfig) { s.Environment = map[string]string{"A": "x\nExecStart=/bin/sh"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.set(&cfg.Service)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,38 +1,85 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"maps"
 	"reflect"
 )
 
 // ConfigDiff categorizes the differences between two Config values.
 type ConfigDiff struct {
 	// HotReloadable lists field names that changed and can be applied
-	// at runtime via the Tor Control Protocol (bridges, proxy, verbose).
+	// at runtime via the Tor Control Protocol (bridges, proxy, verbose)
+	// or QMP (disk throttle).
 	HotReloadable []string
 
-	// RestartRequired lists field names that changed but require a
-	// full VM restart to take effect (memory, CPUs, paths, ports, etc.).
+	// RestartRequired lists field names that changed but take effect
+	// only from the next VM start (memory, CPUs, paths, ports, etc.).
 	RestartRequired []string
+
+	// RestartNow lists field names that changed but are read only when
+	// the controller starts (API sockets, journal, helpers, etc.), so
+	// TorVM itself must be restarted to apply them.
+	RestartNow []string
 }
 
 // HasChanges returns true if any fields differ between old and new.
 func (d ConfigDiff) HasChanges() bool {
-	return len(d.HotReloadable) > 0 || len(d.RestartRequired) > 0
+	return len(d.HotReloadable) > 0 || len(d.RestartRequired) > 0 || len(d.RestartNow) > 0
 }
 
+// Apply is when a changed Config field takes effect.
+type Apply int
+
+const (
+	ApplyLive      Apply = iota // at once, in HotReloadable
+	ApplyNextStart              // from the next VM start, in RestartRequired
+	ApplyRestart                // once TorVM restarts, in RestartNow
+)
+
 // hotReloadableFields lists Config fields that can be applied at runtime.
 var hotReloadableFields = map[string]bool{
-	"Bridge":  true,
-	"Proxy":   true,
-	"Verbose": true,
-	"Relays":  true,
-	"FHE":     true,
-	"Vector":  true,
+	"Bridge":     true,
+	"Proxy":      true,
+	"Verbose":    true,
+	"Relays":     true,
+	"TorrcExtra": true,
+	"FHE":        true,
+	"Vector":     true,
+	"Disk":       true,
+}
+
+// restartNowFields lists Config fields that only the controller's
+// startup reads: the services it starts beside the engine, and the
+// engine's own settings.
+var restartNowFields = map[string]bool{
+	"Instance":    true,
+	"APISocket":   true,
+	"GRPCSocket":  true,
+	"APIGroup":    true,
+	"Journal":     true,
+	"Alerts":      true,
+	"Maintenance": true,
+	"Storage":     true,
+	"Polling":     true,
+	"Retry":       true,
+	"Helpers":     true,
+}
+
+// ApplyOf returns when a change to the Config field name takes effect.
+func ApplyOf(name string) Apply {
+	switch {
+	case hotReloadableFields[name]:
+		return ApplyLive
+	case restartNowFields[name]:
+		return ApplyRestart
+	}
+	return ApplyNextStart
 }
 
 // Diff compares old and new Config and returns a ConfigDiff describing what
-// changed. Fields are categorised as hot-reloadable or restart-required.
+// changed. Fields are categorised by when they take effect; see Apply.
 func Diff(old, new *Config) ConfigDiff {
 	var diff ConfigDiff
 
@@ -62,12 +109,53 @@ func Diff(old, new *Config) ConfigDiff {
 		name := field.Name
 		label := fmt.Sprintf("%s (%s)", name, tag)
 
-		if hotReloadableFields[name] {
+		switch ApplyOf(name) {
+		case ApplyLive:
 			diff.HotReloadable = append(diff.HotReloadable, label)
-		} else {
+		case ApplyRestart:
+			diff.RestartNow = append(diff.RestartNow, label)
+		default:
 			diff.RestartRequired = append(diff.RestartRequired, label)
 		}
 	}
 
 	return diff
 }
+
+// CopyFields sets the fields of c that take effect at when to those of
+// src. Runtime-only fields are left alone.
+func (c *Config) CopyFields(src *Config, when Apply) {
+	dst := reflect.ValueOf(c).Elem()
+	from := reflect.ValueOf(src).Elem()
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if ApplyOf(field.Name) == when {
+			dst.Field(i).Set(from.Field(i))
+		}
+	}
+}
+
+// Clone returns a deep copy of c, one that shares no slices or maps
+// with it, so later edits of c do not show through.
+func (c *Config) Clone() *Config {
+	// Encode the fields as they are; MarshalJSON would put back secret
+	// references.
+	type plain Config
+	n := *c
+	data, err := json.Marshal((*plain)(c))
+	if err != nil {
+		return &n
+	}
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return &n
+	}
+	d := Config(p)
+	d.VhostNet, d.IOMMUEnabled, d.Incoming = c.VhostNet, c.IOMMUEnabled, c.Incoming
+	d.secretRefs = maps.Clone(c.secretRefs)
+	return &d
+}
@@ -102,3 +102,44 @@ func TestDiffMixed(t *testing.T) {
 		t.Fatalf("expected 1 restart-required, got %d", len(diff.RestartRequired))
 	}
 }
+
+func TestDiffRestartNow(t *testing.T) {
+	a := DefaultConfig()
+	b := DefaultConfig()
+	b.APISocket = "/tmp/torvm-api.sock"
+	b.Helpers = []HelperConfig{{Name: "x"}}
+
+	diff := Diff(a, b)
+	if len(diff.RestartNow) != 2 || len(diff.RestartRequired) != 0 || len(diff.HotReloadable) != 0 {
+		t.Fatalf("diff = %+v, want 2 fields that need TorVM restarted", diff)
+	}
+}
+
+func TestCopyFields(t *testing.T) {
+	a := DefaultConfig()
+	b := DefaultConfig()
+	b.Verbose = true
+	b.VMMemoryMB = 512
+	b.APISocket = "/tmp/torvm-api.sock"
+	b.Incoming = "tcp:0:4444"
+
+	a.CopyFields(b, ApplyNextStart)
+	if a.VMMemoryMB != 512 || a.Verbose || a.APISocket == b.APISocket || a.Incoming != "" {
+		t.Errorf("CopyFields(ApplyNextStart) copied the wrong fields: %+v", a)
+	}
+}
+
+func TestClone(t *testing.T) {
+	a := DefaultConfig()
+	a.Bridge.Bridges = []string{"192.0.2.1:443"}
+	a.Incoming = "tcp:0:4444"
+
+	b := a.Clone()
+	if Diff(a, b).HasChanges() || b.Incoming != a.Incoming {
+		t.Fatalf("clone differs: %+v", Diff(a, b))
+	}
+	b.Bridge.Bridges[0] = "192.0.2.2:443"
+	if a.Bridge.Bridges[0] != "192.0.2.1:443" {
+		t.Error("clone shares the bridge lines")
+	}
+}
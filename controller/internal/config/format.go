@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a config file.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatTOML Format = "toml"
+	FormatYAML Format = "yaml"
+)
+
+// FormatOf returns the format of the config file at path, by its
+// extension: TOML for ".toml", YAML for ".yaml" and ".yml", and JSON for
+// anything else.
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return FormatJSON
+}
+
+// toJSON converts a config file in format f to JSON. The keys are the
+// JSON ones in every format, so a TOML or YAML file is decoded the same
+// way as a JSON file, migrations and defaults included.
+func toJSON(data []byte, f Format) ([]byte, error) {
+	var v map[string]any
+	switch f {
+	case FormatJSON:
+		return data, nil
+	case FormatTOML:
+		if err := toml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", f)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("convert %s to JSON: %w", f, err)
+	}
+	return data, nil
+}
+
+// Marshal encodes c in format f, for writing to a config file. Comments
+// in a TOML or YAML file that c was loaded from are not kept.
+func Marshal(c *Config, f Format) ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case FormatJSON:
+		return append(data, '\n'), nil
+	case FormatTOML:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var v map[string]any
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := toml.NewEncoder(&b).Encode(tomlValue(v)); err != nil {
+			return nil, fmt.Errorf("encode TOML: %w", err)
+		}
+		return b.Bytes(), nil
+	case FormatYAML:
+		// JSON is YAML, so it decodes to a node that keeps the order of
+		// the fields; only its flow style and quotes need undoing.
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		blockStyle(&doc)
+		var b bytes.Buffer
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		if err := enc.Encode(&doc); err != nil {
+			return nil, fmt.Errorf("encode YAML: %w", err)
+		}
+		return b.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown config format %q", f)
+}
+
+// tomlValue prepares a decoded JSON value for the TOML encoder: numbers
+// become integers where they are whole, and nulls, which TOML lacks, are
+// left out.
+func tomlValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if e == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = tomlValue(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = tomlValue(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// blockStyle clears the flow style of n and its children, and the
+// quotes of strings that need none.
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadTOMLAndYAML(t *testing.T) {
+	files := map[string]string{
+		"torvm.toml": `# Bridges from bridges.torproject.org
+vm_memory_mb = 256
+
+[bridge]
+use_bridges = true
+transport = "obfs4"
+bridges = [
+  "obfs4 192.0.2.1:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=abc iat-mode=0", # trailing commas are fine
+]
+
+[proxy]
+type = "socks5"
+address = "127.0.0.1:1080"
+`,
+		"torvm.yaml": `# Bridges from bridges.torproject.org
+vm_memory_mb: 256
+bridge:
+  use_bridges: true
+  transport: obfs4
+  bridges:
+    - obfs4 192.0.2.1:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=abc iat-mode=0
+proxy:
+  type: socks5
+  address: 127.0.0.1:1080
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.VMMemoryMB != 256 || !cfg.Bridge.UseBridges || cfg.Bridge.Transport != "obfs4" ||
+			len(cfg.Bridge.Bridges) != 1 || cfg.Proxy.Type != "socks5" || cfg.Proxy.Address != "127.0.0.1:1080" {
+			t.Errorf("%s: loaded %+v, %+v, memory %d", name, cfg.Bridge, cfg.Proxy, cfg.VMMemoryMB)
+		}
+		if cfg.HostIP != DefaultConfig().HostIP {
+			t.Errorf("%s: HostIP = %q, want the default", name, cfg.HostIP)
+		}
+	}
+}
+
+func TestLoadTOMLError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "torvm.toml")
+	if err := os.WriteFile(path, []byte("vm_memory_mb = 256\n[bridge\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "line ") {
+		t.Errorf("Load = %v, want an error naming the line", err)
+	}
+}
+
+// TestMarshalRoundTrip checks that a config written in each format loads
+// back unchanged.
+func TestMarshalRoundTrip(t *testing.T) {
+	want := DefaultConfig()
+	want.Version = ConfigVersion
+	want.VMMemoryMB = 384
+	want.Bridge.Bridges = []string{"obfs4 192.0.2.1:443 cert=a+b/c== iat-mode=0", "123"}
+	want.Proxy.Password = "yes"
+	wantJSON, _ := json.Marshal(want)
+
+	for _, name := range []string{"torvm.json", "torvm.toml", "torvm.yml"} {
+		data, err := Marshal(want, FormatOf(name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", name, err, data)
+		}
+		if gotJSON, _ := json.Marshal(got); string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: round trip changed the config:\n%s", name, data)
+		}
+	}
+}
+
+// TestKeyDocs checks that keyDocs describes every config key, and only
+// those.
+func TestKeyDocs(t *testing.T) {
+	keys := map[string]bool{}
+	var walk func(path string, typ reflect.Type)
+	walk = func(path string, typ reflect.Type) {
+		for typ.Kind() == reflect.Slice {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return
+		}
+		for name, ft := range jsonFields(typ) {
+			at := joinPath(path, name)
+			keys[at] = true
+			walk(at, ft)
+		}
+	}
+	walk("", reflect.TypeFor[Config]())
+	for key := range keys {
+		if keyDocs[key] == "" {
+			t.Errorf("no doc for %s", key)
+		}
+	}
+	for key := range keyDocs {
+		if !keys[key] {
+			t.Errorf("doc for %s, which is not a config key", key)
+		}
+	}
+}
+
+// TestMarshalCommented checks that a commented config loads back
+// unchanged and comments its keys.
+func TestMarshalCommented(t *testing.T) {
+	want := DefaultConfig()
+	want.Version = ConfigVersion
+	want.Bridge.Bridges = []string{"obfs4 192.0.2.1:443 cert=a+b/c== iat-mode=0"}
+	want.Helpers = []HelperConfig{{Name: "dnscrypt", Path: "/usr/bin/dnscrypt-proxy", Args: []string{"-config", "x.toml"}}}
+	fillEmpty(reflect.ValueOf(want).Elem())
+	wantJSON, _ := json.Marshal(want)
+
+	for _, name := range []string{"torvm.toml", "torvm.yaml"} {
+		data, err := MarshalCommented(want, FormatOf(name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", name, err, data)
+		}
+		fillEmpty(reflect.ValueOf(got).Elem())
+		if gotJSON, _ := json.Marshal(got); string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s: round trip changed the config:\n%s", name, data)
+		}
+		for _, line := range []string{
+			"# Connect through the bridges below.",
+			"# Name in the log:",
+			"environment",
+		} {
+			if !strings.Contains(string(data), line) {
+				t.Errorf("%s: no %q in\n%s", name, line, data)
+			}
+		}
+	}
+}
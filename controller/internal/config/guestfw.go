@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// guestTorUser is the account Tor runs as in the guest; only its
+// connections may leave the VM.
+const guestTorUser = "tor"
+
+// GuestFirewallRules generates the in-guest firewall policy GuestFirewall
+// turns on, in iptables-restore format: the IPv4 ruleset, a line
+// "# ip6tables", and the IPv6 ruleset, each loaded with --noflush on top
+// of the guest's router rules. Returns an empty string if GuestFirewall
+// is off.
+//
+// The policy adds two chains that every packet passes first. TORVM_OUT
+// lets the guest originate connections only as Tor (and DHCP, for a guest
+// without a static address); everything else it sends must answer a
+// connection made to it. TORVM_IN admits new connections only to Tor's
+// SOCKS, transparent, and DNS ports, and to its control port from the
+// host. So a compromised process in the guest can neither reach the
+// network around Tor nor be reached through a service Tor does not need.
+func (c *Config) GuestFirewallRules() string {
+	if !c.GuestFirewall {
+		return ""
+	}
+	var b strings.Builder
+	chains := func() {
+		b.WriteString("*filter\n")
+		b.WriteString(":TORVM_IN - [0:0]\n")
+		b.WriteString(":TORVM_OUT - [0:0]\n")
+	}
+	rule := func(format string, args ...any) {
+		fmt.Fprintf(&b, format+"\n", args...)
+	}
+	drop := func(chain, prefix string) {
+		rule("-A %s -m limit --limit 5/min --limit-burst 10 -j LOG --log-prefix %q", chain, prefix)
+		rule("-A %s -j DROP", chain)
+	}
+	hook := func() {
+		rule("-I INPUT 1 -j TORVM_IN")
+		rule("-I OUTPUT 1 -j TORVM_OUT")
+		b.WriteString("COMMIT\n")
+	}
+
+	chains()
+	rule("-A TORVM_IN -i lo -j ACCEPT")
+	rule("-A TORVM_IN -m state --state RELATED,ESTABLISHED -j ACCEPT")
+	rule("-A TORVM_IN -p tcp --dport %d -j ACCEPT", c.SOCKSPort)
+	rule("-A TORVM_IN -p tcp --dport %d -j ACCEPT", c.TransPort)
+	rule("-A TORVM_IN -p udp --dport %d -j ACCEPT", c.DNSPort)
+	rule("-A TORVM_IN -s %s -p tcp --dport %d -j ACCEPT", c.HostIP, c.ControlPort)
+	rule("-A TORVM_IN -p udp --sport 67 --dport 68 -j ACCEPT")
+	drop("TORVM_IN", "torvm_fw_IN_DROP: ")
+	rule("-A TORVM_OUT -o lo -j ACCEPT")
+	rule("-A TORVM_OUT -m state --state RELATED,ESTABLISHED -j ACCEPT")
+	rule("-A TORVM_OUT -m owner --uid-owner %s -j ACCEPT", guestTorUser)
+	rule("-A TORVM_OUT -p udp --sport 68 --dport 67 -j ACCEPT")
+	drop("TORVM_OUT", "torvm_fw_OUT_DROP: ")
+	hook()
+
+	// IPv6 carries only redirected client traffic, to the transparent
+	// and DNS ports, and neighbour discovery.
+	b.WriteString("# ip6tables\n")
+	chains()
+	rule("-A TORVM_IN -i lo -j ACCEPT")
+	rule("-A TORVM_IN -m state --state RELATED,ESTABLISHED -j ACCEPT")
+	rule("-A TORVM_IN -p ipv6-icmp -j ACCEPT")
+	rule("-A TORVM_IN -p tcp --dport %d -j ACCEPT", c.TransPort)
+	rule("-A TORVM_IN -p udp --dport %d -j ACCEPT", c.DNSPort)
+	drop("TORVM_IN", "torvm_fw6_IN_DROP: ")
+	rule("-A TORVM_OUT -o lo -j ACCEPT")
+	rule("-A TORVM_OUT -m state --state RELATED,ESTABLISHED -j ACCEPT")
+	rule("-A TORVM_OUT -p ipv6-icmp -j ACCEPT")
+	rule("-A TORVM_OUT -m owner --uid-owner %s -j ACCEPT", guestTorUser)
+	drop("TORVM_OUT", "torvm_fw6_OUT_DROP: ")
+	hook()
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Patch returns a copy of c in which the fields set in data, a JSON
+// object in the config file's format, replace c's own. Secret references
+// in data are resolved, and a secret given as "[redacted]", as Redacted
+// shows it, keeps its current value, so a client may send back a config
+// it was shown. The result is validated; c is not changed.
+func (c *Config) Patch(data []byte) (*Config, error) {
+	cur, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("config patch: %w", err)
+	}
+	// Start from a deep copy, so the patch cannot write through to the
+	// slices and maps c shares.
+	n := DefaultConfig()
+	if err := json.Unmarshal(cur, n); err != nil {
+		return nil, fmt.Errorf("config patch: %w", err)
+	}
+	if err := decodeStrict(data, n); err != nil {
+		return nil, fmt.Errorf("config patch: %w", err)
+	}
+
+	old := c.secretFields()
+	for name, p := range n.secretFields() {
+		if *p != redacted {
+			continue
+		}
+		*p = *old[name]
+		if r, ok := c.secretRefs[name]; ok && r.value == *p {
+			*p = r.ref
+		}
+	}
+	if err := n.resolveSecrets(); err != nil {
+		return nil, fmt.Errorf("config secrets: %w", err)
+	}
+	n.Version, n.VhostNet, n.IOMMUEnabled, n.Incoming = c.Version, c.VhostNet, c.IOMMUEnabled, c.Incoming
+	if err := n.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation: %w", err)
+	}
+	return n, nil
+}
+
+// liveFields are the top-level keys a client of the control APIs may
+// patch: settings that take effect at once and name no file. The others,
+// such as the disk images, the kernel, and the leak protections, are
+// for whoever can edit the config file.
+var liveFields = map[string]bool{
+	"verbose":     true,
+	"bridge":      true,
+	"proxy":       true,
+	"relays":      true,
+	"torrc_extra": true,
+	"disk":        true,
+}
+
+// PatchLive is Patch for a client of the control APIs, who runs with
+// less privilege than the controller: data may hold only the fields in
+// liveFields, and no secret references, which the controller would
+// resolve with its own.
+func (c *Config) PatchLive(data []byte) (*Config, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("config patch: %w", err)
+	}
+	for k := range fields {
+		if !liveFields[k] {
+			return nil, fmt.Errorf("config patch: %s cannot be changed while TorVM runs; edit the config file", k)
+		}
+	}
+	var p Config
+	if err := decodeStrict(data, &p); err != nil {
+		return nil, fmt.Errorf("config patch: %w", err)
+	}
+	for name, v := range p.secretFields() {
+		if isSecretRef(*v) {
+			return nil, fmt.Errorf("config patch: %s: secret references are only read from the config file", name)
+		}
+	}
+	return c.Patch(data)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Secret references. A secret config field whose value starts with one of
+// these prefixes is resolved at load time instead of being used verbatim:
+//
+//	"file:/run/credentials/torvm.service/proxy"  contents of the file
+//	"file:$CREDENTIALS_DIRECTORY/proxy"          environment variables expanded in the path
+//	"env:TORVM_PROXY_PASSWORD"                   value of the environment variable
+//
+// This keeps secrets out of the main JSON and works with systemd
+// credentials and Docker secrets.
+const (
+	secretFilePrefix = "file:"
+	secretEnvPrefix  = "env:"
+)
+
+// secretRef remembers the reference a secret field was loaded from, so
+// saving the config writes the reference back rather than the secret.
+type secretRef struct {
+	ref   string
+	value string
+}
+
+// secretFields returns the fields that accept secret references, keyed by
+// their JSON path.
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		"proxy.password":       &c.Proxy.Password,
+		"alerts.smtp.password": &c.Alerts.SMTP.Password,
+		"alerts.push.token":    &c.Alerts.Push.Token,
+	}
+}
+
+// resolveSecrets replaces secret references with the values they point to.
+func (c *Config) resolveSecrets() error {
+	for name, p := range c.secretFields() {
+		if !isSecretRef(*p) {
+			continue
+		}
+		value, err := resolveSecret(*p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if c.secretRefs == nil {
+			c.secretRefs = make(map[string]secretRef)
+		}
+		c.secretRefs[name] = secretRef{ref: *p, value: value}
+		*p = value
+	}
+	return nil
+}
+
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, secretFilePrefix) || strings.HasPrefix(s, secretEnvPrefix)
+}
+
+// resolveSecret returns the value a "file:" or "env:" reference points to.
+// A trailing newline in a secret file is dropped.
+func resolveSecret(ref string) (string, error) {
+	if name, ok := strings.CutPrefix(ref, secretEnvPrefix); ok {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %q is not set", name)
+		}
+		return v, nil
+	}
+	path := os.ExpandEnv(strings.TrimPrefix(ref, secretFilePrefix))
+	if path == "" {
+		return "", fmt.Errorf("empty secret file path in %q", ref)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// MarshalJSON writes secret fields that were loaded from a reference, and
+// have not been changed since, as the reference.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	for name, p := range c.secretFields() {
+		if r, ok := c.secretRefs[name]; ok && *p == r.value {
+			*p = r.ref
+		}
+	}
+	return json.Marshal(plain(c))
+}
+
+// redacted replaces the secrets of a redacted config.
+const redacted = "[redacted]"
+
+// Redacted returns a copy of c for display, with each secret that is set
+// replaced by "[redacted]". A secret loaded from a reference shows the
+// reference, which reveals where the secret is kept but not the secret.
+func (c *Config) Redacted() *Config {
+	r := *c
+	for name, p := range r.secretFields() {
+		if *p == "" {
+			continue
+		}
+		if ref, ok := r.secretRefs[name]; ok && *p == ref.value {
+			*p = ref.ref
+		} else {
+			*p = redacted
+		}
+	}
+	return &r
+}
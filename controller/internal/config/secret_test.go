@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadResolvesSecretRefs(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "smtp"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TORVM_TEST_CREDS", tmpDir)
+	t.Setenv("TORVM_TEST_PROXY_PW", "hunter2")
+
+	path := filepath.Join(tmpDir, "config.json")
+	data := `{
+		"proxy": {"type": "socks5", "address": "127.0.0.1:1080", "username": "u", "password": "env:TORVM_TEST_PROXY_PW"},
+		"alerts": {"smtp": {"password": "file:$TORVM_TEST_CREDS/smtp"}, "push": {"token": "literal"}}
+	}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Proxy.Password != "hunter2" {
+		t.Errorf("proxy password = %q, want hunter2", cfg.Proxy.Password)
+	}
+	if cfg.Alerts.SMTP.Password != "s3cret" {
+		t.Errorf("smtp password = %q, want s3cret (newline trimmed)", cfg.Alerts.SMTP.Password)
+	}
+	if cfg.Alerts.Push.Token != "literal" {
+		t.Errorf("push token = %q, want literal", cfg.Alerts.Push.Token)
+	}
+
+	// Saving writes the references back, not the secrets, unless the
+	// value was changed in the meantime.
+	cfg.Alerts.SMTP.Password = "typed-in-gui"
+	out, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if strings.Contains(s, "hunter2") || !strings.Contains(s, `"env:TORVM_TEST_PROXY_PW"`) {
+		t.Errorf("proxy password reference not preserved:\n%s", s)
+	}
+	if !strings.Contains(s, `"typed-in-gui"`) {
+		t.Errorf("changed secret not saved:\n%s", s)
+	}
+	if cfg.Proxy.Password != "hunter2" {
+		t.Error("marshaling modified the loaded config")
+	}
+}
+
+func TestLoadSecretRefErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, ref := range []string{"env:TORVM_TEST_UNSET_VAR", "file:" + filepath.Join(tmpDir, "missing"), "file:"} {
+		path := filepath.Join(tmpDir, "config.json")
+		data := `{"alerts": {"push": {"token": "` + ref + `"}}}`
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load(path)
+		if err == nil || !strings.Contains(err.Error(), "alerts.push.token") {
+			t.Errorf("Load with %q: err = %v, want alerts.push.token error", ref, err)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	t.Setenv("TORVM_TEST_PROXY_PW", "hunter2")
+	cfg := DefaultConfig()
+	cfg.Bridge.Bridges = []string{"obfs4 192.0.2.1:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=abc iat-mode=0"}
+	cfg.Proxy = ProxyConfig{Type: "socks5", Address: "127.0.0.1:1080", Username: "u", Password: "env:TORVM_TEST_PROXY_PW"}
+	if err := cfg.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.VhostNet = true
+
+	n, err := cfg.Patch([]byte(`{"vm_memory_mb": 256, "bridge": {"bridges": []}, "proxy": {"type": "socks5", "address": "127.0.0.1:1081", "username": "u", "password": "[redacted]"}}`))
+	if err != nil {
+		t.Fatalf("Patch: %v", err)
+	}
+	if n.VMMemoryMB != 256 || n.Proxy.Address != "127.0.0.1:1081" || len(n.Bridge.Bridges) != 0 {
+		t.Errorf("patch not applied: memory %d, proxy %q, bridges %v", n.VMMemoryMB, n.Proxy.Address, n.Bridge.Bridges)
+	}
+	if n.VMCPUs != cfg.VMCPUs || !n.VhostNet {
+		t.Error("fields outside the patch changed")
+	}
+	if n.Proxy.Password != "hunter2" {
+		t.Errorf("redacted password = %q, want the current one", n.Proxy.Password)
+	}
+	if data, _ := json.Marshal(n); !strings.Contains(string(data), "env:TORVM_TEST_PROXY_PW") {
+		t.Error("patched config lost the password's secret reference")
+	}
+	if len(cfg.Bridge.Bridges) != 1 || cfg.VMMemoryMB == 256 {
+		t.Error("Patch changed the original config")
+	}
+
+	if _, err := cfg.Patch([]byte(`{"vm_memory_mb": -1}`)); err == nil {
+		t.Error("Patch accepted an invalid config")
+	}
+	if _, err := cfg.Patch([]byte(`not json`)); err == nil {
+		t.Error("Patch accepted malformed JSON")
+	}
+}
+
+func TestPatchLive(t *testing.T) {
+	t.Setenv("TORVM_TEST_PROXY_PW", "hunter2")
+	cfg := DefaultConfig()
+	cfg.Proxy = ProxyConfig{Type: "socks5", Address: "127.0.0.1:1080", Username: "u", Password: "env:TORVM_TEST_PROXY_PW"}
+	if err := cfg.resolveSecrets(); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := cfg.PatchLive([]byte(`{"verbose": true, "proxy": {"type": "socks5", "address": "127.0.0.1:1081", "username": "u", "password": "[redacted]"}}`))
+	if err != nil {
+		t.Fatalf("PatchLive: %v", err)
+	}
+	if !n.Verbose || n.Proxy.Password != "hunter2" {
+		t.Errorf("patch not applied: verbose %v, password %q", n.Verbose, n.Proxy.Password)
+	}
+
+	for patch, want := range map[string]string{
+		`{"kernel_path": "/tmp/vmlinuz"}`:                     "kernel_path",
+		`{"block_dns_leaks": false}`:                          "block_dns_leaks",
+		`{"verbose": true, "state_disk_path": "/etc/shadow"}`: "state_disk_path",
+		`{"proxy": {"password": "file:/etc/shadow"}}`:         "proxy.password",
+		`{"proxy": {"password": "env:HOME"}}`:                 "proxy.password",
+	} {
+		if _, err := cfg.PatchLive([]byte(patch)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("PatchLive(%s): err = %v, want %s refused", patch, err, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ShareCodePrefix starts every share code, naming the format and its
+// version.
+const ShareCodePrefix = "torvm1:"
+
+// maxShareSize bounds a decoded share code, so a crafted code cannot
+// inflate without limit.
+const maxShareSize = 64 << 10
+
+// Share is the part of a configuration that gets a censored user
+// connected: bridges, the pluggable transport, and the upstream proxy.
+// It carries no secrets beyond the bridge lines; proxy credentials stay
+// on the machine they were entered on.
+type Share struct {
+	UseBridges bool     `json:"u,omitempty"`
+	Transport  string   `json:"t,omitempty"`
+	Bridges    []string `json:"b,omitempty"`
+	ProxyType  string   `json:"pt,omitempty"`
+	ProxyAddr  string   `json:"pa,omitempty"`
+}
+
+// Share returns the shareable anti-censorship settings of c.
+func (c *Config) Share() Share {
+	s := Share{
+		UseBridges: c.Bridge.UseBridges,
+		Transport:  c.Bridge.Transport,
+	}
+	for _, b := range c.Bridge.Bridges {
+		if b = strings.TrimSpace(b); b != "" {
+			s.Bridges = append(s.Bridges, b)
+		}
+	}
+	if c.Proxy.Type != "" && c.Proxy.Address != "" {
+		s.ProxyType, s.ProxyAddr = strings.ToLower(c.Proxy.Type), c.Proxy.Address
+	}
+	return s
+}
+
+// Encode returns s as a share code: the prefix followed by the settings
+// as compressed JSON in URL-safe base64, short enough to paste into a
+// chat message or show as a QR code.
+func (s Share) Encode() (string, error) {
+	if err := s.validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("share code: %w", err)
+	}
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.BestCompression)
+	w.Write(data)
+	w.Close()
+	return ShareCodePrefix + base64.RawURLEncoding.EncodeToString(b.Bytes()), nil
+}
+
+// ParseShare decodes a share code made by Share.Encode. Whitespace in the
+// code, as added by chat programs that wrap long lines, is ignored. The
+// settings are validated as Validate would.
+func ParseShare(code string) (Share, error) {
+	code = strings.Join(strings.Fields(code), "")
+	rest, ok := strings.CutPrefix(code, ShareCodePrefix)
+	if !ok {
+		return Share{}, fmt.Errorf("share code: not a TorVM share code (want prefix %q)", ShareCodePrefix)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(rest)
+	if err != nil {
+		return Share{}, fmt.Errorf("share code: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw)), maxShareSize+1))
+	if err != nil {
+		return Share{}, fmt.Errorf("share code: %w", err)
+	}
+	if len(data) > maxShareSize {
+		return Share{}, fmt.Errorf("share code: too large")
+	}
+	var s Share
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Share{}, fmt.Errorf("share code: %w", err)
+	}
+	if err := s.validate(); err != nil {
+		return Share{}, err
+	}
+	return s, nil
+}
+
+// validate checks the settings with the rules Validate and the torrc
+// overlay apply.
+func (s Share) validate() error {
+	switch s.Transport {
+	case "", "none", "obfs4", "meek-azure", "snowflake", "webtunnel":
+	default:
+		return fmt.Errorf("share code: invalid transport %q", s.Transport)
+	}
+	for _, b := range s.Bridges {
+		err := validateBridgeLine(b)
+		if err == nil && s.UseBridges {
+			err = checkBridge(b, s.Transport)
+		}
+		if err != nil {
+			return fmt.Errorf("share code: %w", err)
+		}
+	}
+	switch s.ProxyType {
+	case "", "http", "https", "socks5":
+	default:
+		return fmt.Errorf("share code: invalid proxy type %q", s.ProxyType)
+	}
+	if s.ProxyType != "" {
+		if err := validateProxyAddress(s.ProxyAddr); err != nil {
+			return fmt.Errorf("share code: %w", err)
+		}
+	}
+	return nil
+}
+
+// ApplyShare replaces the bridge, transport, and proxy settings of c with
+// those of s. A proxy set by the share keeps no credentials: they belong
+// to the previous proxy.
+func (c *Config) ApplyShare(s Share) {
+	c.Bridge = BridgeConfig{
+		UseBridges: s.UseBridges,
+		Transport:  s.Transport,
+		Bridges:    s.Bridges,
+	}
+	if c.Proxy.Type != s.ProxyType || c.Proxy.Address != s.ProxyAddr {
+		c.Proxy = ProxyConfig{Type: s.ProxyType, Address: s.ProxyAddr}
+	}
+}
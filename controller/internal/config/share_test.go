@@ -0,0 +1,81 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestShareRoundTrip(t *testing.T) {
+	src := DefaultConfig()
+	src.Bridge = BridgeConfig{
+		UseBridges: true,
+		Transport:  "obfs4",
+		Bridges: []string{
+			"obfs4 192.0.2.10:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=AbCdEf+gh/ij iat-mode=0",
+			"  ",
+			"obfs4 [2001:db8::1]:9001 89ABCDEF0123456789ABCDEF0123456789ABCDEF cert=xyz iat-mode=1",
+		},
+	}
+	src.Proxy = ProxyConfig{Type: "SOCKS5", Address: "10.0.0.1:1080", Username: "alice", Password: "secret"}
+
+	code, err := src.Share().Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(code, ShareCodePrefix) || strings.Contains(code, "secret") || strings.Contains(code, "alice") {
+		t.Fatalf("code = %q", code)
+	}
+
+	// Chat programs wrap long codes.
+	wrapped := code[:20] + "\n  " + code[20:]
+	s, err := ParseShare(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := DefaultConfig()
+	dst.Proxy = ProxyConfig{Type: "http", Address: "127.0.0.1:8080", Username: "bob", Password: "pw"}
+	dst.ApplyShare(s)
+
+	if !dst.Bridge.UseBridges || dst.Bridge.Transport != "obfs4" || len(dst.Bridge.Bridges) != 2 {
+		t.Errorf("bridges = %+v", dst.Bridge)
+	}
+	if dst.Proxy != (ProxyConfig{Type: "socks5", Address: "10.0.0.1:1080"}) {
+		t.Errorf("proxy = %+v, want the shared proxy without credentials", dst.Proxy)
+	}
+	if err := dst.Validate(); err != nil {
+		t.Errorf("imported config invalid: %v", err)
+	}
+}
+
+func TestApplyShareKeepsCredentials(t *testing.T) {
+	c := DefaultConfig()
+	c.Proxy = ProxyConfig{Type: "socks5", Address: "10.0.0.1:1080", Username: "alice", Password: "secret"}
+	c.ApplyShare(Share{Transport: "snowflake", UseBridges: true, ProxyType: "socks5", ProxyAddr: "10.0.0.1:1080"})
+	if c.Proxy.Username != "alice" || c.Bridge.Transport != "snowflake" || !slices.Equal(c.Bridge.Bridges, nil) {
+		t.Errorf("config = %+v %+v", c.Bridge, c.Proxy)
+	}
+}
+
+func TestParseShareRejects(t *testing.T) {
+	bad, _ := Share{Bridges: []string{"192.0.2.1:443"}}.Encode()
+	for name, code := range map[string]string{
+		"no prefix":   "obfs4 192.0.2.1:443",
+		"bad base64":  ShareCodePrefix + "!!!",
+		"not deflate": ShareCodePrefix + "AAAA",
+		"truncated":   bad[:len(bad)-4],
+	} {
+		if _, err := ParseShare(code); err == nil {
+			t.Errorf("%s: parsed", name)
+		}
+	}
+	if _, err := (Share{Bridges: []string{"obfs4 1.2.3.4:1\nControlPort 9051"}}).Encode(); err == nil {
+		t.Error("bridge line with a newline encoded")
+	}
+	if _, err := (Share{Bridges: []string{"obfs4 192.0.2.1:443 cert=abc"}}).Encode(); err == nil {
+		t.Error("obfs4 bridge without iat-mode encoded")
+	}
+	if _, err := (Share{ProxyType: "ftp", ProxyAddr: "1.2.3.4:21"}).Encode(); err == nil {
+		t.Error("invalid proxy type encoded")
+	}
+}
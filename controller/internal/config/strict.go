@@ -0,0 +1,159 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// decodeStrict decodes the config JSON data into c, refusing keys that
+// name no field. Such a key is most likely a typo, which would otherwise
+// leave the setting it meant at its default without a word. The error
+// lists every unknown key with the known one it is closest to.
+func decodeStrict(data []byte, c *Config) error {
+	if err := checkKeys(data); err != nil {
+		return err
+	}
+	// checkKeys found nothing; the decoder is strict as well in case it
+	// missed a key.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(c)
+}
+
+// checkKeys returns an error listing the keys of the config JSON data
+// that name no Config field, by their path ("bridge.use_bridge"), with a
+// suggestion where a known key is close. It leaves data that does not
+// parse to the decoder.
+func checkKeys(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+	var unknown []string
+	walkKeys("", v, reflect.TypeFor[Config](), &unknown)
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.Sort(unknown)
+	word := "key"
+	if len(unknown) > 1 {
+		word = "keys"
+	}
+	return fmt.Errorf("unknown config %s: %s", word, strings.Join(unknown, "; "))
+}
+
+// walkKeys adds to unknown the keys in v, the decoded JSON for a value
+// of type t at path, that t has no field for.
+func walkKeys(path string, v any, t reflect.Type, unknown *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for key, val := range obj {
+			ft, ok := fields[key]
+			if !ok {
+				// As encoding/json, match a key of another case.
+				for name, f := range fields {
+					if strings.EqualFold(name, key) {
+						ft, ok = f, true
+						break
+					}
+				}
+			}
+			at := joinPath(path, key)
+			if !ok {
+				msg := at
+				if s := suggest(key, fields); s != "" {
+					msg += ": did you mean " + s + "?"
+				}
+				*unknown = append(*unknown, msg)
+				continue
+			}
+			walkKeys(at, val, ft, unknown)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := v.([]any); ok {
+			for i, e := range arr {
+				walkKeys(path+"["+strconv.Itoa(i)+"]", e, t.Elem(), unknown)
+			}
+		}
+	case reflect.Map:
+		if obj, ok := v.(map[string]any); ok {
+			for key, val := range obj {
+				walkKeys(joinPath(path, key), val, t.Elem(), unknown)
+			}
+		}
+	}
+}
+
+// jsonFields maps the JSON names of t's fields to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggest returns the name in fields closest to key, if it is close
+// enough to be a typo of it: a third of its letters or fewer differ.
+func suggest(key string, fields map[string]reflect.Type) string {
+	best, bestDist := "", len(key)/3+1
+	for name := range fields {
+		d := editDistance(strings.ToLower(key), name)
+		if d < bestDist || d == bestDist && best != "" && name < best {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -39,16 +39,24 @@ func sanitizeTorrcLine(field, value string) error {
 	return nil
 }
 
-// validateBridgeLine validates a bridge configuration line format.
+// validateBridgeLine validates a bridge configuration line, as
+// ParseBridgeLine takes it apart.
 func validateBridgeLine(line string) error {
-	if err := sanitizeTorrcLine("bridge", line); err != nil {
-		return err
+	if _, err := ParseBridgeLine(line); err != nil {
+		return fmt.Errorf("bridge %q: %w", line, err)
 	}
-	if len(line) > 1024 {
-		return fmt.Errorf("bridge line too long (%d chars, max 1024)", len(line))
+	return nil
+}
+
+// checkBridge validates a bridge line and that its transport is the one
+// the transport setting starts a plugin for.
+func checkBridge(line, transport string) error {
+	b, err := ParseBridgeLine(line)
+	if err == nil {
+		err = CheckBridgeTransport(b, transport)
 	}
-	if !bridgeLineRe.MatchString(line) {
-		return fmt.Errorf("bridge line contains invalid characters: %q", line)
+	if err != nil {
+		return fmt.Errorf("bridge %q: %w", line, err)
 	}
 	return nil
 }
@@ -115,7 +123,99 @@ func validateRelayConfig(rc *RelayConfig) error {
 	return nil
 }
 
-// TorrcOverlay generates torrc configuration lines from Bridge, Proxy, and Relay settings.
+// torrcExtraDirectives are the directives TorrcExtra may set, by their
+// lower-case names: circuit, guard, and padding tuning and the client
+// options of that kind. Directives that open ports, run programs, name
+// files, or change what TorVM relies on are left out. So are those the
+// VM's base torrc sets, such as SafeSocks: a live push resets a removed
+// line to Tor's default, not to the base torrc's value.
+var torrcExtraDirectives = map[string]string{}
+
+func init() {
+	for _, d := range []string{
+		"CircuitBuildTimeout", "CircuitPadding", "CircuitStreamTimeout",
+		"CircuitsAvailableTimeout", "ClientUseIPv4", "ConfluxClientUX",
+		"ConfluxEnabled", "ConnectionPadding", "DormantClientTimeout",
+		"EntryNodes", "ExitNodes", "FascistFirewall", "FirewallPorts",
+		"GuardLifetime", "KeepalivePeriod", "LearnCircuitBuildTimeout",
+		"LongLivedPorts", "MaxCircuitDirtiness", "MaxClientCircuitsPending",
+		"NewCircuitPeriod", "NumDirectoryGuards", "NumEntryGuards",
+		"ReducedCircuitPadding", "ReducedConnectionPadding",
+		"RejectPlaintextPorts", "SocksTimeout", "TestSocks",
+		"UseMicrodescriptors", "VanguardsLiteEnabled",
+	} {
+		torrcExtraDirectives[strings.ToLower(d)] = d
+	}
+}
+
+// torrcManagedDirectives are directives other settings write, by their
+// lower-case names, with the config key to use instead.
+var torrcManagedDirectives = map[string]string{
+	"usebridges":              "bridge.use_bridges",
+	"bridge":                  "bridge.bridges",
+	"clienttransportplugin":   "bridge.transport",
+	"httpproxy":               "proxy",
+	"httpproxyauthenticator":  "proxy",
+	"httpsproxy":              "proxy",
+	"httpsproxyauthenticator": "proxy",
+	"socks5proxy":             "proxy",
+	"socks5proxyusername":     "proxy",
+	"socks5proxypassword":     "proxy",
+	"excludenodes":            "relays.exclude_nodes",
+	"excludeexitnodes":        "relays.exclude_exit_nodes",
+	"strictnodes":             "relays.strict_nodes",
+	"clientuseipv6":           "ipv6.client_use_ipv6",
+	"clientpreferipv6orport":  "ipv6.client_prefer_ipv6_orport",
+}
+
+// torrcExtraValueRe matches the value of a TorrcExtra line: one word,
+// as SETCONF passes it on, without quotes or escapes.
+var torrcExtraValueRe = regexp.MustCompile(`^[a-zA-Z0-9.:,*{}$/_+=-]{1,512}$`)
+
+// parseTorrcExtra checks a TorrcExtra line and returns it with the
+// directive in its canonical case.
+func parseTorrcExtra(line string) (string, error) {
+	if err := sanitizeTorrcLine("extra line", line); err != nil {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("torrc extra line %q must be a directive and one value", line)
+	}
+	name := strings.ToLower(fields[0])
+	if key, ok := torrcManagedDirectives[name]; ok {
+		return "", fmt.Errorf("torrc extra line %q: %s is set by %s", line, fields[0], key)
+	}
+	directive, ok := torrcExtraDirectives[name]
+	if !ok {
+		return "", fmt.Errorf("torrc extra line %q: %s is not an allowed directive", line, fields[0])
+	}
+	if !torrcExtraValueRe.MatchString(fields[1]) {
+		return "", fmt.Errorf("torrc extra line %q: value contains invalid characters", line)
+	}
+	return directive + " " + fields[1], nil
+}
+
+// validateTorrcExtra checks the TorrcExtra lines. Each directive may be
+// given once.
+func validateTorrcExtra(lines []string) error {
+	seen := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		parsed, err := parseTorrcExtra(l)
+		if err != nil {
+			return fmt.Errorf("TorrcExtra: %w", err)
+		}
+		directive, _, _ := strings.Cut(parsed, " ")
+		if seen[directive] {
+			return fmt.Errorf("TorrcExtra: %s is given more than once", directive)
+		}
+		seen[directive] = true
+	}
+	return nil
+}
+
+// TorrcOverlay generates torrc configuration lines from Bridge, Proxy, and Relay settings,
+// and TorrcExtra.
 // Returns an empty string and nil error if no overlay is needed.
 func (c *Config) TorrcOverlay() (string, error) {
 	var lines []string
@@ -131,6 +231,8 @@ func (c *Config) TorrcOverlay() (string, error) {
 			lines = append(lines, "ClientTransportPlugin meek_lite exec /usr/bin/obfs4proxy")
 		case "snowflake":
 			lines = append(lines, "ClientTransportPlugin snowflake exec /usr/bin/snowflake-client")
+		case "webtunnel":
+			lines = append(lines, "ClientTransportPlugin webtunnel exec /usr/bin/webtunnel-client")
 		case "", "none":
 			// no transport plugin needed
 		default:
@@ -138,9 +240,9 @@ func (c *Config) TorrcOverlay() (string, error) {
 		}
 
 		for _, b := range c.Bridge.Bridges {
-			b = strings.TrimSpace(b)
+			b = c.Bridge.Snowflake.apply(strings.TrimSpace(b))
 			if b != "" {
-				if err := validateBridgeLine(b); err != nil {
+				if err := checkBridge(b, c.Bridge.Transport); err != nil {
 					return "", err
 				}
 				lines = append(lines, fmt.Sprintf("Bridge %s", b))
@@ -180,6 +282,14 @@ func (c *Config) TorrcOverlay() (string, error) {
 		}
 	}
 
+	// Reaching relays over IPv6.
+	if c.IPv6.ClientUseIPv6 {
+		lines = append(lines, "ClientUseIPv6 1")
+		if c.IPv6.ClientPreferIPv6ORPort {
+			lines = append(lines, "ClientPreferIPv6ORPort 1")
+		}
+	}
+
 	// Relay exclusion configuration.
 	if err := validateRelayConfig(&c.Relays); err != nil {
 		return "", err
@@ -201,6 +311,15 @@ func (c *Config) TorrcOverlay() (string, error) {
 			c.FHE.HiddenServicePort, c.HostIP, c.FHE.HiddenServicePort))
 	}
 
+	// Power users' extra directives.
+	if err := validateTorrcExtra(c.TorrcExtra); err != nil {
+		return "", err
+	}
+	for _, l := range c.TorrcExtra {
+		parsed, _ := parseTorrcExtra(l)
+		lines = append(lines, parsed)
+	}
+
 	if len(lines) == 0 {
 		return "", nil
 	}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -36,9 +37,11 @@ func TestValidateBridgeLine(t *testing.T) {
 		line    string
 		wantErr bool
 	}{
-		{"valid simple", "obfs4 192.168.1.1:443 AAAA", false},
+		{"valid simple", "192.168.1.1:443", false},
 		{"valid with fingerprint", "obfs4 1.2.3.4:9001 ABCDEF1234567890ABCDEF1234567890ABCDEF12 cert=abc iat-mode=0", false},
-		{"valid ipv6", "obfs4 [::1]:443 ABCD", false},
+		{"valid ipv6", "obfs4 [::1]:443 cert=abc iat-mode=1", false},
+		{"short fingerprint", "obfs4 192.168.1.1:443 AAAA cert=abc iat-mode=0", true},
+		{"hostname", "obfs4 bridge.example:443 cert=abc iat-mode=0", true},
 		{"too long", strings.Repeat("a", 1025), true},
 		{"contains semicolon", "obfs4 1.2.3.4:443;rm -rf /", true},
 		{"contains backtick", "obfs4 1.2.3.4:443`whoami`", true},
@@ -56,6 +59,79 @@ func TestValidateBridgeLine(t *testing.T) {
 	}
 }
 
+func TestParseBridgeLine(t *testing.T) {
+	b, err := ParseBridgeLine("obfs4 192.0.2.1:443 0123456789abcdef0123456789abcdef01234567 cert=Ab+c/d== iat-mode=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BridgeLine{
+		Transport:   "obfs4",
+		Address:     "192.0.2.1:443",
+		Fingerprint: "0123456789ABCDEF0123456789ABCDEF01234567",
+		Params:      map[string]string{"cert": "Ab+c/d==", "iat-mode": "2"},
+	}
+	if !reflect.DeepEqual(b, want) {
+		t.Errorf("ParseBridgeLine = %+v, want %+v", b, want)
+	}
+
+	for line, msg := range map[string]string{
+		"obfs4 192.0.2.1:443 cert=abc":                      "needs iat-mode=",
+		"obfs4 192.0.2.1:443 iat-mode=0":                    "needs cert=",
+		"obfs4 192.0.2.1:443 cert=abc iat-mode=3":           "must be 0, 1, or 2",
+		"obfs4 192.0.2.1:443 cert=a=b iat-mode=0":           "not base64",
+		"obfs4 192.0.2.1:443 ABCD cert=abc iat-mode=0":      "40 hex characters",
+		"obfs4 192.0.2.1:99999 cert=abc iat-mode=0":         "invalid port",
+		"obfs4 192.0.2.1 cert=abc iat-mode=0":               "must be IP:port",
+		"obfs4":                                             "has no address",
+		"meek_lite 192.0.2.2:80":                            "needs url=",
+		"meek_lite 192.0.2.2:80 url=http://example.com/":    "https URL",
+		"192.0.2.1:443 cert=abc":                            "takes no parameters",
+		"webtunnel [2001:db8::1]:443 ver=0.0.1":             "needs url=",
+		"webtunnel [2001:db8::1]:443 url=http://a.example/": "https URL",
+		"obfs4 192.0.2.1:443 cert=abc iat-mode=0 stray":     "not a key=value",
+		"snowflake 192.0.2.3:80 url=https://example.com/":   "",
+	} {
+		_, err := ParseBridgeLine(line)
+		switch {
+		case msg == "" && err != nil:
+			t.Errorf("ParseBridgeLine(%q): %v", line, err)
+		case msg != "" && (err == nil || !strings.Contains(err.Error(), msg)):
+			t.Errorf("ParseBridgeLine(%q) = %v, want an error with %q", line, err, msg)
+		}
+	}
+}
+
+func TestCheckBridgeTransport(t *testing.T) {
+	obfs4 := BridgeLine{Transport: "obfs4"}
+	plain := BridgeLine{}
+	for _, tt := range []struct {
+		b         BridgeLine
+		transport string
+		ok        bool
+	}{
+		{obfs4, "obfs4", true},
+		{obfs4, "snowflake", false},
+		{obfs4, "none", false},
+		{plain, "", true},
+		{plain, "obfs4", false},
+		{BridgeLine{Transport: "meek_lite"}, "meek-azure", true},
+	} {
+		if err := CheckBridgeTransport(tt.b, tt.transport); (err == nil) != tt.ok {
+			t.Errorf("CheckBridgeTransport(%q, %q) = %v", tt.b.Transport, tt.transport, err)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.Bridge = BridgeConfig{UseBridges: true, Transport: "snowflake", Bridges: []string{"192.0.2.1:443"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted a plain bridge with the snowflake transport")
+	}
+	cfg.Bridge.UseBridges = false
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate checked the bridges of a config that does not use them: %v", err)
+	}
+}
+
 func TestValidateProxyAddress(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -118,7 +194,7 @@ func TestTorrcOverlayObfs4(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Bridge.UseBridges = true
 	cfg.Bridge.Transport = "obfs4"
-	cfg.Bridge.Bridges = []string{"obfs4 1.2.3.4:443 ABCD cert=xyz iat-mode=0"}
+	cfg.Bridge.Bridges = []string{"obfs4 1.2.3.4:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=xyz iat-mode=0"}
 
 	overlay, err := cfg.TorrcOverlay()
 	if err != nil {
@@ -130,11 +206,89 @@ func TestTorrcOverlayObfs4(t *testing.T) {
 	if !strings.Contains(overlay, "ClientTransportPlugin obfs4 exec /usr/bin/obfs4proxy") {
 		t.Error("expected obfs4 transport plugin line")
 	}
-	if !strings.Contains(overlay, "Bridge obfs4 1.2.3.4:443 ABCD cert=xyz iat-mode=0") {
+	if !strings.Contains(overlay, "Bridge obfs4 1.2.3.4:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=xyz iat-mode=0") {
 		t.Error("expected bridge line")
 	}
 }
 
+func TestTorrcOverlayWebTunnel(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Bridge.UseBridges = true
+	cfg.Bridge.Transport = "webtunnel"
+	cfg.Bridge.Bridges = []string{"webtunnel [2001:db8::1]:443 0123456789ABCDEF0123456789ABCDEF01234567 url=https://example.com/secret-path ver=0.0.1"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(overlay, "ClientTransportPlugin webtunnel exec /usr/bin/webtunnel-client") {
+		t.Error("expected webtunnel transport plugin line")
+	}
+	if !strings.Contains(overlay, "Bridge webtunnel [2001:db8::1]:443") {
+		t.Error("expected bridge line")
+	}
+}
+
+func TestTorrcOverlaySnowflakeOptions(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Bridge.UseBridges = true
+	cfg.Bridge.Transport = "snowflake"
+	cfg.Bridge.Bridges = []string{"snowflake 192.0.2.3:80 2B280B23E1107BB62ABFC40DDCC8824814F80A72 url=https://broker.example/ front=old.example utls-imitate=hellorandomizedalpn"}
+	cfg.Bridge.Snowflake = SnowflakeConfig{
+		BrokerURL: "https://broker.example.net/",
+		Fronts:    []string{"a.example.com", "b.example.org"},
+		STUN:      []string{"stun:stun.example.com:3478", "stuns:stun.example.org:5349"},
+		MaxPeers:  3,
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Bridge snowflake 192.0.2.3:80 2B280B23E1107BB62ABFC40DDCC8824814F80A72 utls-imitate=hellorandomizedalpn " +
+		"url=https://broker.example.net/ fronts=a.example.com,b.example.org " +
+		"ice=stun:stun.example.com:3478,stuns:stun.example.org:5349 max=3\n"
+	if !strings.Contains(overlay, want) {
+		t.Errorf("overlay lacks %q:\n%s", want, overlay)
+	}
+
+	for name, s := range map[string]SnowflakeConfig{
+		"http broker":     {BrokerURL: "http://broker.example/"},
+		"ampcache query":  {AMPCache: "https://cdn.example/?x=1"},
+		"front with port": {Fronts: []string{"a.example:443"}},
+		"stun scheme":     {STUN: []string{"turn:stun.example.com:3478"}},
+		"max peers":       {MaxPeers: 17},
+	} {
+		cfg.Bridge.Snowflake = s
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, s)
+		}
+	}
+}
+
+func TestSnowflakeOptionsNeedBridge(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Bridge.UseBridges = true
+	cfg.Bridge.Transport = "snowflake"
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("no snowflake settings: %v", err)
+	}
+	cfg.Bridge.Snowflake.BrokerURL = "https://broker.example.net/"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "no snowflake bridge line") {
+		t.Errorf("snowflake settings without a bridge line: err = %v", err)
+	}
+	cfg.Bridge.Bridges = []string{"snowflake 192.0.2.3:80 2B280B23E1107BB62ABFC40DDCC8824814F80A72"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("snowflake settings with a bridge line: %v", err)
+	}
+}
+
 func TestTorrcOverlayMeekAzure(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Bridge.UseBridges = true
@@ -167,7 +321,7 @@ func TestTorrcOverlayNoneTransport(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Bridge.UseBridges = true
 	cfg.Bridge.Transport = "none"
-	cfg.Bridge.Bridges = []string{"1.2.3.4:443 ABCD"}
+	cfg.Bridge.Bridges = []string{"1.2.3.4:443 0123456789ABCDEF0123456789ABCDEF01234567"}
 
 	overlay, err := cfg.TorrcOverlay()
 	if err != nil {
@@ -367,7 +521,7 @@ func TestTorrcOverlayBridgeAndProxy(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Bridge.UseBridges = true
 	cfg.Bridge.Transport = "obfs4"
-	cfg.Bridge.Bridges = []string{"obfs4 1.2.3.4:443 ABCD cert=xyz iat-mode=0"}
+	cfg.Bridge.Bridges = []string{"obfs4 1.2.3.4:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=xyz iat-mode=0"}
 	cfg.Proxy.Type = "socks5"
 	cfg.Proxy.Address = "127.0.0.1:1080"
 
@@ -382,3 +536,100 @@ func TestTorrcOverlayBridgeAndProxy(t *testing.T) {
 		t.Error("expected Socks5Proxy")
 	}
 }
+
+func TestTorrcOverlayClientIPv6(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.IPv6.ClientUseIPv6 = true
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(overlay, "ClientUseIPv6 1") || strings.Contains(overlay, "ClientPreferIPv6ORPort") {
+		t.Errorf("overlay = %q, want ClientUseIPv6 only", overlay)
+	}
+
+	cfg.IPv6.ClientPreferIPv6ORPort = true
+	overlay, _ = cfg.TorrcOverlay()
+	if !strings.Contains(overlay, "ClientPreferIPv6ORPort 1") {
+		t.Errorf("overlay = %q, want ClientPreferIPv6ORPort 1", overlay)
+	}
+
+	cfg.IPv6.ClientUseIPv6 = false
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate accepted ClientPreferIPv6ORPort without ClientUseIPv6")
+	}
+}
+
+func TestTorrcOverlayExtra(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TorrcExtra = []string{"maxcircuitdirtiness 600", "  ConnectionPadding   1 "}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overlay != "MaxCircuitDirtiness 600\nConnectionPadding 1\n" {
+		t.Errorf("overlay = %q", overlay)
+	}
+
+	for _, extra := range [][]string{
+		{"ControlPort 0.0.0.0:9051"},
+		{"ClientTransportPlugin obfs4 exec /bin/sh"},
+		{"%include /etc/passwd"},
+		{"UseBridges 0"},
+		{"ExitNodes {us}\nSocksPort 0.0.0.0:9050"},
+		{"ExitNodes"},
+		{"LongLivedPorts 21, 22"},
+		{"ExitNodes \"{us}\""},
+		{"NumEntryGuards 1", "numentryguards 2"},
+		// Set by the VM's base torrc.
+		{"SafeSocks 0"},
+		{"EnforceDistinctSubnets 0"},
+		{"WarnPlaintextPorts 1"},
+	} {
+		cfg.TorrcExtra = extra
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate accepted %q", extra)
+		}
+		if _, err := cfg.TorrcOverlay(); err == nil {
+			t.Errorf("TorrcOverlay accepted %q", extra)
+		}
+	}
+}
+
+func TestGuestFirewallRules(t *testing.T) {
+	cfg := DefaultConfig()
+	if rules := cfg.GuestFirewallRules(); rules != "" {
+		t.Errorf("rules with the guest firewall off:\n%s", rules)
+	}
+
+	cfg.GuestFirewall = true
+	cfg.SOCKSPort = 9150
+	rules := cfg.GuestFirewallRules()
+	v4, v6, ok := strings.Cut(rules, "# ip6tables\n")
+	if !ok {
+		t.Fatalf("no IPv6 section:\n%s", rules)
+	}
+	for _, want := range []string{
+		"-A TORVM_IN -p tcp --dport 9150 -j ACCEPT",
+		"-A TORVM_IN -p tcp --dport 9095 -j ACCEPT",
+		"-A TORVM_IN -p udp --dport 9093 -j ACCEPT",
+		"-A TORVM_IN -s 10.10.10.2 -p tcp --dport 9051 -j ACCEPT",
+		"-A TORVM_OUT -m owner --uid-owner tor -j ACCEPT",
+		"-I OUTPUT 1 -j TORVM_OUT",
+	} {
+		if !strings.Contains(v4, want) {
+			t.Errorf("IPv4 rules lack %q:\n%s", want, v4)
+		}
+	}
+	for _, section := range []string{v4, v6} {
+		if !strings.HasPrefix(section, "*filter\n") || !strings.HasSuffix(section, "-A TORVM_OUT -j DROP\n-I INPUT 1 -j TORVM_IN\n-I OUTPUT 1 -j TORVM_OUT\nCOMMIT\n") {
+			t.Errorf("section does not end in drops and hooks:\n%s", section)
+		}
+	}
+	if strings.Contains(v6, "9150") || strings.Contains(v6, "9051") {
+		t.Errorf("IPv6 rules admit the SOCKS or control port:\n%s", v6)
+	}
+}
@@ -0,0 +1,94 @@
+package controlapi
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+)
+
+// peer is the user at the other end of a connection.
+type peer struct {
+	UID    uint32
+	Groups []uint32 // primary and supplementary
+}
+
+// authListener accepts only connections from users allowed to control
+// the controller, closing the others unanswered. The socket's mode keeps
+// other users out already; checking the peer's credentials as well means
+// a socket left with a wider mode, or a directory another user could
+// bind a socket in, does not hand them the API.
+type authListener struct {
+	net.Listener
+	allow func(peer) bool
+
+	peer func(*net.UnixConn) (peer, bool, error) // replaceable in tests
+}
+
+// Accept returns the next connection from an allowed peer. A peer whose
+// credentials the platform cannot report is left to the socket's mode.
+func (l *authListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		uc, ok := conn.(*net.UnixConn)
+		if !ok {
+			return conn, nil
+		}
+		p, known, err := l.peer(uc)
+		if err == nil && (!known || l.allow(p)) {
+			return conn, nil
+		}
+		conn.Close()
+	}
+}
+
+// allowPeer returns the API's access policy: root, the controller's own
+// user, and, if gid is not negative, members of that group. A GUI run by
+// a user in the group can then drive a controller running as root.
+func allowPeer(gid int) func(peer) bool {
+	self := uint32(os.Geteuid())
+	return func(p peer) bool {
+		if p.UID == 0 || p.UID == self {
+			return true
+		}
+		return gid >= 0 && slices.Contains(p.Groups, uint32(gid))
+	}
+}
+
+// lookupGroup returns the ID of the named group.
+func lookupGroup(name string) (int, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("api group: %w", err)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("api group %s: gid %q: %w", name, g.Gid, err)
+	}
+	return gid, nil
+}
+
+// userGroups returns the IDs of uid's groups from the user database, for
+// platforms whose peer credentials carry only the primary group.
+func userGroups(uid uint32) []uint32 {
+	u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return nil
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+	var groups []uint32
+	for _, id := range ids {
+		if n, err := strconv.ParseUint(id, 10, 32); err == nil {
+			groups = append(groups, uint32(n))
+		}
+	}
+	return groups
+}
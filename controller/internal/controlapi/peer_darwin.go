@@ -0,0 +1,28 @@
+package controlapi
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials returns the user and groups of the process at the
+// other end of conn, from the kernel (LOCAL_PEERCRED).
+func peerCredentials(conn *net.UnixConn) (peer, bool, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return peer{}, false, err
+	}
+	var cred *unix.Xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return peer{}, false, err
+	}
+	if credErr != nil {
+		return peer{}, false, credErr
+	}
+	n := max(0, min(int(cred.Ngroups), len(cred.Groups)))
+	return peer{UID: cred.Uid, Groups: append([]uint32(nil), cred.Groups[:n]...)}, true, nil
+}
@@ -0,0 +1,28 @@
+package controlapi
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials returns the user and groups of the process at the
+// other end of conn, from the kernel (SO_PEERCRED) and, for its
+// supplementary groups, the user database.
+func peerCredentials(conn *net.UnixConn) (peer, bool, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return peer{}, false, err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return peer{}, false, err
+	}
+	if credErr != nil {
+		return peer{}, false, credErr
+	}
+	return peer{UID: cred.Uid, Groups: append([]uint32{cred.Gid}, userGroups(cred.Uid)...)}, true, nil
+}
@@ -0,0 +1,356 @@
+// Package controlapi serves the controller's control API (see package
+// api for the protocol and client) on a Unix socket.
+package controlapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// Controller starts and stops the VM on behalf of API clients. Each UI
+// mode (headless, TUI, GUI) provides its own, since each owns the
+// engine's context differently. StopVM waits until the VM has shut down
+// and returns the result of the session (see lifecycle.Engine.Stop), or
+// ctx's error if ctx ends first.
+type Controller interface {
+	StartVM() error
+	StopVM(ctx context.Context) error
+}
+
+// Errors for a Controller to return when the request does not fit the
+// VM's state. The API reports them (like any Controller error) as 409.
+var (
+	ErrRunning    = errors.New("the VM is already running")
+	ErrNotRunning = errors.New("the VM is not running")
+)
+
+// LogSource provides the recent log lines the API serves, oldest first.
+// A logging.RingWriter is one.
+type LogSource interface {
+	Lines() []string
+}
+
+// Server serves the control API for one engine.
+type Server struct {
+	engine  *lifecycle.Engine
+	ctrl    Controller
+	version string
+	logs    LogSource
+
+	httpServer *http.Server
+	listener   net.Listener
+
+	mu          sync.Mutex
+	progress    int
+	summary     string
+	subscribers map[chan api.Event]struct{}
+}
+
+// NewServer listens on the Unix socket at path as ListenUnix does, for
+// the engine's configured api_group, and registers with engine for
+// events.
+func NewServer(path string, engine *lifecycle.Engine, ctrl Controller, version string) (*Server, error) {
+	ln, err := ListenUnix(path, engine.Config.APIGroup)
+	if err != nil {
+		return nil, fmt.Errorf("control api: %w", err)
+	}
+
+	s := &Server{
+		engine:      engine,
+		ctrl:        ctrl,
+		version:     version,
+		listener:    ln,
+		subscribers: make(map[chan api.Event]struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", s.handleStatus)
+	mux.HandleFunc("POST /v1/start", s.handleAction(ctrl.StartVM))
+	mux.HandleFunc("POST /v1/stop", s.handleStop)
+	mux.HandleFunc("GET /v1/events", s.handleEvents)
+	mux.HandleFunc("POST /v1/newnym", s.handleNewIdentity)
+	mux.HandleFunc("GET /v1/config", s.handleConfig)
+	mux.HandleFunc("GET /v1/logs", s.handleLogs)
+	s.httpServer = &http.Server{Handler: mux}
+
+	engine.Events.Subscribe(s.engineEvent)
+	return s, nil
+}
+
+// engineEvent tracks bootstrap progress and forwards the engine events
+// the API exposes to the subscribers.
+func (s *Server) engineEvent(ev lifecycle.Event) {
+	switch ev.Kind {
+	case lifecycle.EventState:
+		if ev.To == lifecycle.StateInit || ev.To == lifecycle.StateSaveNetwork {
+			s.setBootstrap(0, "")
+		}
+		var reason string
+		if ev.Reason != lifecycle.ShutdownNone {
+			reason = ev.Reason.String()
+		}
+		s.publish(api.Event{Kind: api.EventState, State: ev.To.String(), Message: reason})
+	case lifecycle.EventBootstrap:
+		s.setBootstrap(ev.Progress, ev.Summary)
+		s.publish(api.Event{Kind: api.EventBootstrap, Progress: ev.Progress, Message: ev.Summary})
+	case lifecycle.EventFailsafe:
+		msg := "released"
+		if ev.Active {
+			msg = "engaged"
+		}
+		s.publish(api.Event{Kind: api.EventFailsafe, Message: msg})
+	case lifecycle.EventVMExit:
+		s.publish(api.Event{Kind: api.EventVMExit, Message: ev.Err.Error()})
+	}
+}
+
+// SetLogs sets where GET /v1/logs reads log lines from. Without it, the
+// endpoint reports 404.
+func (s *Server) SetLogs(logs LogSource) {
+	s.logs = logs
+}
+
+// Start begins serving in a goroutine.
+func (s *Server) Start() {
+	go s.httpServer.Serve(s.listener)
+}
+
+// closeGrace is how long Close waits for requests in flight, such as a
+// stop whose reply is still being written as the process exits.
+const closeGrace = 2 * time.Second
+
+// Close stops the server, ending open event streams, and removes the
+// socket.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for ch := range s.subscribers {
+		close(ch)
+		delete(s.subscribers, ch)
+	}
+	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), closeGrace)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err == nil {
+		return nil
+	}
+	return s.httpServer.Close()
+}
+
+func (s *Server) setBootstrap(progress int, summary string) {
+	s.mu.Lock()
+	s.progress, s.summary = progress, summary
+	s.mu.Unlock()
+}
+
+// publish sends ev to every subscriber, dropping it for those that are
+// not keeping up rather than blocking the engine.
+func (s *Server) publish(ev api.Event) {
+	ev.Time = time.Now().UTC().Format(time.RFC3339)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (s *Server) status() api.Status {
+	state := s.engine.State()
+	s.mu.Lock()
+	progress, summary := s.progress, s.summary
+	s.mu.Unlock()
+	if state == lifecycle.StateRunning {
+		progress = 100
+	}
+	var reason string
+	if r := s.engine.ShutdownReason(); r != lifecycle.ShutdownNone {
+		reason = r.String()
+	}
+	return api.Status{
+		State:     state.String(),
+		Running:   state == lifecycle.StateRunning,
+		Failsafe:  s.engine.FailSafe.IsActive(),
+		Bootstrap: progress,
+		Summary:   summary,
+		SOCKS:     net.JoinHostPort(s.engine.Config.VMIP, strconv.Itoa(s.engine.Config.SOCKSPort)),
+		Version:   s.version,
+
+		ShutdownReason: reason,
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.status())
+}
+
+// ListenUnix listens on the Unix socket at path, replacing a stale one.
+// The socket is accessible to its owner and group only, and, where the
+// platform reports who connects, the listener accepts only root, the
+// controller's own user, and members of group (if not empty), which the
+// socket is given to. Run as root, it refuses a socket directory that
+// other users can write to, where they could swap in a socket of their
+// own.
+func ListenUnix(path, group string) (net.Listener, error) {
+	gid := -1
+	if group != "" {
+		var err error
+		if gid, err = lookupGroup(group); err != nil {
+			return nil, err
+		}
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if os.Geteuid() == 0 {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode().Perm()&0022 != 0 {
+			return nil, fmt.Errorf("socket directory %s is writable by other users (mode %04o)", dir, fi.Mode().Perm())
+		}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("remove stale socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("api group %s: %w", group, err)
+		}
+	}
+	return &authListener{Listener: ln, allow: allowPeer(gid), peer: peerCredentials}, nil
+}
+
+// handleAction runs fn and reports its error as 409 Conflict: the VM is
+// in a state where the action cannot be taken.
+func (s *Server) handleAction(fn func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(); err != nil {
+			writeJSON(w, http.StatusConflict, api.Error{Message: err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleStop stops the VM and replies once it has shut down. A VM that
+// is not running is 409 Conflict; a session that failed, or a shutdown
+// that could not restore the host network, is 500.
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	err := s.ctrl.StopVM(r.Context())
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrNotRunning), errors.Is(err, lifecycle.ErrNotRunning):
+		writeJSON(w, http.StatusConflict, api.Error{Message: ErrNotRunning.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, api.Error{Message: err.Error()})
+	}
+}
+
+// handleNewIdentity asks Tor for new circuits. It is 409 Conflict unless
+// the VM is running.
+func (s *Server) handleNewIdentity(w http.ResponseWriter, r *http.Request) {
+	if s.engine.State() != lifecycle.StateRunning {
+		writeJSON(w, http.StatusConflict, api.Error{Message: ErrNotRunning.Error()})
+		return
+	}
+	if err := s.engine.NewIdentity(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, api.Error{Message: err.Error()})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleConfig returns the engine's configuration with its secrets
+// redacted.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.engine.Config.Redacted())
+}
+
+// maxLogLines bounds the lines parameter of GET /v1/logs.
+const maxLogLines = 1000
+
+// handleLogs returns the last lines log lines (default 100).
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if s.logs == nil {
+		writeJSON(w, http.StatusNotFound, api.Error{Message: "logs are not available"})
+		return
+	}
+	n := 100
+	if v := r.URL.Query().Get("lines"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > maxLogLines {
+			writeJSON(w, http.StatusBadRequest, api.Error{Message: fmt.Sprintf("lines must be 1-%d", maxLogLines)})
+			return
+		}
+	}
+	lines := s.logs.Lines()
+	lines = lines[max(0, len(lines)-n):]
+	writeJSON(w, http.StatusOK, api.Logs{Lines: lines})
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, api.Error{Message: "streaming unsupported"})
+		return
+	}
+	ch := make(chan api.Event, 16)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,242 @@
+package controlapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/api"
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+type fakeController struct {
+	running bool
+	stopErr error // the result of the session StopVM ends
+}
+
+func (f *fakeController) StartVM() error {
+	if f.running {
+		return ErrRunning
+	}
+	f.running = true
+	return nil
+}
+
+func (f *fakeController) StopVM(ctx context.Context) error {
+	if !f.running {
+		return ErrNotRunning
+	}
+	f.running = false
+	return f.stopErr
+}
+
+// startTestServer serves the API for an idle engine on a temporary
+// socket and returns a client for it.
+func startTestServer(t *testing.T, ctrl Controller) (*Server, *api.Client) {
+	t.Helper()
+	logger, _ := logging.NewLogger(logging.Options{})
+	engine := lifecycle.NewEngineWithDeps(config.DefaultConfig(), logger, nil, nil)
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	srv, err := NewServer(sock, engine, ctrl, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Start()
+	t.Cleanup(func() { srv.Close() })
+	return srv, api.NewClient(sock)
+}
+
+func TestStatusAndActions(t *testing.T) {
+	ctrl := &fakeController{}
+	_, c := startTestServer(t, ctrl)
+	ctx := context.Background()
+
+	st, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "Init" || st.Running || st.SOCKS != "10.10.10.1:9050" || st.Version != "test" {
+		t.Errorf("Status = %+v", st)
+	}
+
+	if err := c.Start(ctx); err != nil || !ctrl.running {
+		t.Fatalf("Start: err = %v, running = %v", err, ctrl.running)
+	}
+	var apiErr *api.Error
+	if err := c.Start(ctx); !errors.As(err, &apiErr) || apiErr.Code != http.StatusConflict || apiErr.Message != ErrRunning.Error() {
+		t.Errorf("second Start: err = %v, want 409 %q", err, ErrRunning)
+	}
+	if err := c.Stop(ctx); err != nil || ctrl.running {
+		t.Fatalf("Stop: err = %v, running = %v", err, ctrl.running)
+	}
+	if err := c.Stop(ctx); !errors.As(err, &apiErr) || apiErr.Code != http.StatusConflict {
+		t.Errorf("second Stop: err = %v, want 409", err)
+	}
+
+	ctrl.running = true
+	ctrl.stopErr = errors.New("lifecycle: restore network: netsh failed")
+	if err := c.Stop(ctx); !errors.As(err, &apiErr) || apiErr.Code != http.StatusInternalServerError || apiErr.Message != ctrl.stopErr.Error() {
+		t.Errorf("failed Stop: err = %v, want 500 %q", err, ctrl.stopErr)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	srv, c := startTestServer(t, &fakeController{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	events, err := c.Events(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The stream is open once Events returns, so the subscriber exists.
+	bus := srv.engine.Events
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventBootstrap, Progress: 40, Summary: "Loading relay descriptors"})
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventNetwork, Op: "setup routing"})
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventFailsafe, Active: true})
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventState, From: lifecycle.StateWaitBootstrap, To: lifecycle.StateRunning})
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventState, From: lifecycle.StateRunning, To: lifecycle.StateShutdown,
+		Reason: lifecycle.ShutdownVMCrash})
+
+	for _, want := range []api.Event{
+		{Kind: api.EventBootstrap, Progress: 40, Message: "Loading relay descriptors"},
+		{Kind: api.EventFailsafe, Message: "engaged"},
+		{Kind: api.EventState, State: "Running"},
+		{Kind: api.EventState, State: "Shutdown", Message: "vm_crash"},
+	} {
+		ev, ok := <-events
+		if !ok {
+			t.Fatal("event stream closed early")
+		}
+		if ev.Time == "" {
+			t.Error("event has no time")
+		}
+		ev.Time = ""
+		if ev != want {
+			t.Errorf("event = %+v, want %+v", ev, want)
+		}
+	}
+
+	if st, err := c.Status(ctx); err != nil || st.Bootstrap != 40 || st.Summary != "Loading relay descriptors" {
+		t.Errorf("Status = %+v, %v; want bootstrap 40", st, err)
+	}
+
+	srv.Close()
+	if _, ok := <-events; ok {
+		t.Error("event stream not closed by Close")
+	}
+}
+
+type fakeLogs []string
+
+func (f fakeLogs) Lines() []string { return f }
+
+func TestNewIdentityConfigLogs(t *testing.T) {
+	srv, c := startTestServer(t, &fakeController{})
+	ctx := context.Background()
+
+	var apiErr *api.Error
+	if err := c.NewIdentity(ctx); !errors.As(err, &apiErr) || apiErr.Code != http.StatusConflict {
+		t.Errorf("NewIdentity while stopped: err = %v, want 409", err)
+	}
+
+	srv.engine.Config.Proxy.Password = "hunter2"
+	raw, err := c.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("hunter2")) || !bytes.Contains(raw, []byte(`"password":"[redacted]"`)) {
+		t.Errorf("config not redacted: %s", raw)
+	}
+	if srv.engine.Config.Proxy.Password != "hunter2" {
+		t.Error("redacting changed the engine's config")
+	}
+
+	if _, err := c.Logs(ctx, 10); !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+		t.Errorf("Logs without a source: err = %v, want 404", err)
+	}
+	srv.SetLogs(fakeLogs{"one", "two", "three"})
+	if lines, err := c.Logs(ctx, 2); err != nil || !slices.Equal(lines, []string{"two", "three"}) {
+		t.Errorf("Logs(2) = %q, %v", lines, err)
+	}
+	if _, err := c.Logs(ctx, 0); !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+		t.Errorf("Logs(0): err = %v, want 400", err)
+	}
+}
+
+func TestAllowPeer(t *testing.T) {
+	self := uint32(os.Geteuid())
+	tests := []struct {
+		gid  int
+		p    peer
+		want bool
+	}{
+		{-1, peer{UID: 0}, true},
+		{-1, peer{UID: self}, true},
+		{-1, peer{UID: 4242, Groups: []uint32{4242}}, false},
+		{4242, peer{UID: 4243, Groups: []uint32{100, 4242}}, true},
+		{4242, peer{UID: 4243, Groups: []uint32{100}}, false},
+	}
+	if self == 4242 || self == 4243 {
+		t.Skip("test user ids collide")
+	}
+	for _, tt := range tests {
+		if got := allowPeer(tt.gid)(tt.p); got != tt.want {
+			t.Errorf("allowPeer(%d)(%+v) = %v, want %v", tt.gid, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestRefusedPeer(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := ListenUnix(sock, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	refuse := true
+	ln.(*authListener).peer = func(*net.UnixConn) (peer, bool, error) {
+		if refuse {
+			refuse = false
+			return peer{UID: 4242}, true, nil
+		}
+		return peer{UID: 0}, true, nil
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	refused, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer refused.Close()
+	refused.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := refused.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("refused connection: read err = %v, want it closed", err)
+	}
+	root, err := net.Dial("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Error("allowed connection not accepted")
+	}
+}
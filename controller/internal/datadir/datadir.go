@@ -0,0 +1,171 @@
+// Package datadir resolves where TorVM keeps its files on each platform,
+// instead of under a dist directory relative to wherever it was started:
+// the XDG base directories on Linux (or /etc, /var/lib, and /run when
+// run as root), ~/Library/Application Support on macOS, and %ProgramData%
+// on Windows. The VM images that ship with TorVM are found where the
+// installer put them.
+//
+// It also creates the directories and moves the files of the old
+// layout, such as dist/vm/state.img, to their new places.
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Dirs are the directories TorVM uses.
+type Dirs struct {
+	Config string // the config file
+	Data   string // the state disks, event journal, indexes, and migration TLS files
+
+	// Images holds the VM kernel and initramfs, and BrowserImages the
+	// browser VM's. They are read only, and may also hold a fresh state
+	// disk to start from.
+	Images        string
+	BrowserImages string
+
+	// Runtime holds the QMP sockets. It is empty on Windows, where QEMU
+	// uses named pipes.
+	Runtime string
+}
+
+// Legacy is the directory, relative to the working directory, that
+// TorVM's files were kept in before, as the build leaves them.
+const Legacy = "dist"
+
+// geteuid tells whether TorVM runs as root, which takes the system
+// directories; replaceable in tests.
+var geteuid = os.Geteuid
+
+// configNames are the file names FindConfig looks for, in order.
+var configNames = []string{"torvm.json", "torvm.toml", "torvm.yaml", "torvm.yml"}
+
+// ConfigFile returns the path of the config file in d.Config that TorVM
+// writes when no other is given.
+func (d Dirs) ConfigFile() string {
+	return filepath.Join(d.Config, configNames[0])
+}
+
+// FindConfig returns the path of the config file in d.Config, in any of
+// the formats config.Load reads, or "" if there is none.
+func (d Dirs) FindConfig() string {
+	for _, name := range configNames {
+		p := filepath.Join(d.Config, name)
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p
+		}
+	}
+	return ""
+}
+
+// Ensure creates the directories TorVM writes to, readable by their
+// owner only.
+func (d Dirs) Ensure() error {
+	for _, dir := range []string{d.Config, d.Data, d.Runtime} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("datadir: %w", err)
+		}
+	}
+	return nil
+}
+
+// Move puts a file or directory in place: From is moved to To, or
+// copied if Copy is set.
+type Move struct {
+	From, To string
+	Copy     bool
+}
+
+// Migrate carries out moves, skipping those whose From is missing or
+// whose To already exists, and returns those it made. A move that fails
+// is reported in the error and the rest are still made.
+func Migrate(moves []Move) ([]Move, error) {
+	var done []Move
+	var errs []error
+	for _, m := range moves {
+		if m.From == "" || m.To == "" || exists(m.To) || !exists(m.From) {
+			continue
+		}
+		if err := migrate(m); err != nil {
+			errs = append(errs, fmt.Errorf("datadir: %s to %s: %w", m.From, m.To, err))
+			continue
+		}
+		done = append(done, m)
+	}
+	return done, errors.Join(errs...)
+}
+
+func migrate(m Move) error {
+	if err := os.MkdirAll(filepath.Dir(m.To), 0700); err != nil {
+		return err
+	}
+	if !m.Copy && os.Rename(m.From, m.To) == nil {
+		return nil
+	}
+	// A copy, or a move to another file system.
+	fi, err := os.Stat(m.From)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = os.CopyFS(m.To, os.DirFS(m.From))
+	} else {
+		err = copyFile(m.From, m.To, fi.Mode().Perm())
+	}
+	if err != nil {
+		os.RemoveAll(m.To)
+		return err
+	}
+	if m.Copy {
+		return nil
+	}
+	return os.RemoveAll(m.From)
+}
+
+func copyFile(from, to string, perm fs.FileMode) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// images returns the first of dirs that holds a VM kernel, or, if none
+// does, the first of dirs.
+func images(dirs ...string) string {
+	for _, dir := range dirs {
+		if exists(filepath.Join(dir, "vmlinuz")) {
+			return dir
+		}
+	}
+	return dirs[0]
+}
+
+// legacyImages are the directories the build leaves the VM images in,
+// where images looks last, so a source tree still runs.
+var (
+	legacyImages        = filepath.Join(Legacy, "vm")
+	legacyBrowserImages = filepath.Join(Legacy, "browservm")
+)
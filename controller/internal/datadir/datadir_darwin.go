@@ -0,0 +1,25 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Default returns the directories for the current user: its Application
+// Support directory, or the system one when run as root.
+func Default() Dirs {
+	base := "/Library/Application Support/TorVM"
+	runtime := "/var/run/torvm"
+	if geteuid() != 0 {
+		home, _ := os.UserHomeDir()
+		base = filepath.Join(home, "Library", "Application Support", "TorVM")
+		runtime = filepath.Join(base, "run")
+	}
+	return Dirs{
+		Config:        base,
+		Data:          base,
+		Images:        images(filepath.Join(base, "vm"), "/usr/local/share/torvm", "/opt/homebrew/share/torvm", legacyImages),
+		BrowserImages: images(filepath.Join(base, "browservm"), "/usr/local/share/torvm/browservm", "/opt/homebrew/share/torvm/browservm", legacyBrowserImages),
+		Runtime:       runtime,
+	}
+}
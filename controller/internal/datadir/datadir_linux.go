@@ -0,0 +1,69 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default returns the directories for the current user: the XDG base
+// directories, or the system ones when run as root.
+func Default() Dirs {
+	if geteuid() == 0 {
+		return Dirs{
+			Config:        "/etc/torvm",
+			Data:          "/var/lib/torvm",
+			Images:        images("/usr/local/share/torvm", "/usr/share/torvm", legacyImages),
+			BrowserImages: images("/usr/local/share/torvm/browservm", "/usr/share/torvm/browservm", legacyBrowserImages),
+			Runtime:       "/run/torvm",
+		}
+	}
+
+	home, _ := os.UserHomeDir()
+	data := filepath.Join(xdg("XDG_DATA_HOME", filepath.Join(home, ".local", "share")), "torvm")
+	d := Dirs{
+		Config:  filepath.Join(xdg("XDG_CONFIG_HOME", filepath.Join(home, ".config")), "torvm"),
+		Data:    data,
+		Runtime: filepath.Join(data, "run"),
+	}
+	if dir := xdg("XDG_RUNTIME_DIR", ""); dir != "" {
+		d.Runtime = filepath.Join(dir, "torvm")
+	}
+
+	// The images are installed system-wide, or in the user's own data
+	// directory.
+	var dirs, browser []string
+	for _, dir := range append([]string{data}, dataDirs()...) {
+		if dir != data {
+			dir = filepath.Join(dir, "torvm")
+		}
+		dirs = append(dirs, dir)
+		browser = append(browser, filepath.Join(dir, "browservm"))
+	}
+	d.Images = images(append(dirs, legacyImages)...)
+	d.BrowserImages = images(append(browser, legacyBrowserImages)...)
+	return d
+}
+
+// xdg returns the XDG base directory the environment variable name
+// sets, or def. As the specification asks, a relative path is ignored.
+func xdg(name, def string) string {
+	if dir := os.Getenv(name); filepath.IsAbs(dir) {
+		return dir
+	}
+	return def
+}
+
+// dataDirs returns the system data directories, from XDG_DATA_DIRS.
+func dataDirs() []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv("XDG_DATA_DIRS"), ":") {
+		if filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = []string{"/usr/local/share", "/usr/share"}
+	}
+	return dirs
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !windows
+
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Default returns the directories under the user's config directory.
+func Default() Dirs {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	base := filepath.Join(dir, "torvm")
+	return Dirs{
+		Config:        base,
+		Data:          base,
+		Images:        images(filepath.Join(base, "vm"), legacyImages),
+		BrowserImages: images(filepath.Join(base, "browservm"), legacyBrowserImages),
+		Runtime:       filepath.Join(base, "run"),
+	}
+}
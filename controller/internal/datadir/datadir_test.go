@@ -0,0 +1,108 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "dist")
+	data := filepath.Join(dir, "data")
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(legacy, "vm", "state.img"), "old state")
+	write(filepath.Join(legacy, "fhe", "index", "a"), "index")
+	write(filepath.Join(legacy, "events.jsonl"), "old journal")
+	write(filepath.Join(data, "events.jsonl"), "new journal")
+	write(filepath.Join(dir, "images", "state.img"), "fresh")
+
+	done, err := Migrate([]Move{
+		{From: filepath.Join(legacy, "vm", "state.img"), To: filepath.Join(data, "state.img")},
+		{From: filepath.Join(dir, "images", "state.img"), To: filepath.Join(data, "state.img"), Copy: true},
+		{From: filepath.Join(legacy, "fhe"), To: filepath.Join(data, "fhe")},
+		{From: filepath.Join(legacy, "events.jsonl"), To: filepath.Join(data, "events.jsonl")},
+		{From: filepath.Join(legacy, "vector"), To: filepath.Join(data, "vector")},
+		{From: filepath.Join(dir, "images", "browservm", "state.img"), To: filepath.Join(data, "browservm", "state.img"), Copy: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 {
+		t.Errorf("made %d moves, want the state disk and the index: %+v", len(done), done)
+	}
+	for path, want := range map[string]string{
+		filepath.Join(data, "state.img"):          "old state",
+		filepath.Join(data, "fhe", "index", "a"):  "index",
+		filepath.Join(data, "events.jsonl"):       "new journal",
+		filepath.Join(legacy, "events.jsonl"):     "old journal",
+		filepath.Join(dir, "images", "state.img"): "fresh",
+	} {
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	if exists(filepath.Join(legacy, "vm", "state.img")) || exists(filepath.Join(legacy, "fhe")) {
+		t.Error("moved files left behind")
+	}
+
+	// A missing state disk is copied from the images.
+	os.Remove(filepath.Join(data, "state.img"))
+	if done, err := Migrate([]Move{{From: filepath.Join(dir, "images", "state.img"), To: filepath.Join(data, "state.img"), Copy: true}}); err != nil || len(done) != 1 {
+		t.Fatalf("copy = %+v, %v", done, err)
+	}
+	if !exists(filepath.Join(dir, "images", "state.img")) {
+		t.Error("copy removed the source")
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	d := Dirs{Config: t.TempDir()}
+	if p := d.FindConfig(); p != "" {
+		t.Errorf("FindConfig in an empty directory = %q", p)
+	}
+	toml := filepath.Join(d.Config, "torvm.toml")
+	os.WriteFile(toml, []byte("verbose = true\n"), 0600)
+	if p := d.FindConfig(); p != toml {
+		t.Errorf("FindConfig = %q, want %q", p, toml)
+	}
+	if p := d.ConfigFile(); p != filepath.Join(d.Config, "torvm.json") {
+		t.Errorf("ConfigFile = %q", p)
+	}
+}
+
+func TestDefaultXDG(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG directories are for Linux")
+	}
+	geteuid = func() int { return 1000 }
+	defer func() { geteuid = os.Geteuid }()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	t.Setenv("XDG_RUNTIME_DIR", "relative/run") // ignored
+	t.Setenv("XDG_DATA_DIRS", filepath.Join(dir, "system"))
+	os.MkdirAll(filepath.Join(dir, "system", "torvm"), 0755)
+	os.WriteFile(filepath.Join(dir, "system", "torvm", "vmlinuz"), nil, 0644)
+
+	d := Default()
+	want := Dirs{
+		Config:        filepath.Join(dir, "config", "torvm"),
+		Data:          filepath.Join(dir, "data", "torvm"),
+		Images:        filepath.Join(dir, "system", "torvm"),
+		BrowserImages: filepath.Join(dir, "data", "torvm", "browservm"),
+		Runtime:       filepath.Join(dir, "data", "torvm", "run"),
+	}
+	if d != want {
+		t.Errorf("Default() = %+v, want %+v", d, want)
+	}
+}
@@ -0,0 +1,26 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Default returns the directories under %ProgramData%\TorVM. The images
+// are found beside torvm.exe, where the installer puts them.
+func Default() Dirs {
+	root := os.Getenv("ProgramData")
+	if root == "" {
+		root = `C:\ProgramData`
+	}
+	base := filepath.Join(root, "TorVM")
+	install := base
+	if exe, err := os.Executable(); err == nil {
+		install = filepath.Dir(exe)
+	}
+	return Dirs{
+		Config:        base,
+		Data:          base,
+		Images:        images(filepath.Join(install, "vm"), filepath.Join(base, "vm"), legacyImages),
+		BrowserImages: images(filepath.Join(install, "browservm"), filepath.Join(base, "browservm"), legacyBrowserImages),
+	}
+}
@@ -0,0 +1,320 @@
+// Package doctor runs preflight checks before TorVM starts: the QEMU
+// binary and its version, hardware acceleration, TAP support, privileges,
+// the VM images, and the addresses the controller listens on. Every
+// problem comes with a remedy.
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/nethelper"
+	"github.com/user/extorvm/controller/internal/network"
+	"github.com/user/extorvm/controller/internal/platform"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// Status is the outcome of a check.
+type Status int
+
+const (
+	Pass Status = iota
+	Warn        // TorVM runs, but not as well as it could
+	Fail        // TorVM will not start
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pass:
+		return "PASS"
+	case Warn:
+		return "WARN"
+	}
+	return "FAIL"
+}
+
+// Result is the outcome of one check. Fix says what to do about a
+// warning or failure.
+type Result struct {
+	Name   string
+	Status Status
+	Detail string
+	Fix    string
+}
+
+// Options configures Run.
+type Options struct {
+	Config *config.Config
+
+	// APISocket, MetricsAddr, and QMPSocket are checked for another
+	// process using them, if set. A running controller leaves them out:
+	// it holds them itself.
+	APISocket   string
+	MetricsAddr string
+	QMPSocket   string
+}
+
+// Run performs the checks in order and returns one Result for each.
+func Run(opts Options) []Result {
+	cfg := opts.Config
+	qemu, results := checkQEMU()
+	results = append(results, checkAccel(cfg.Accel, qemu))
+	results = append(results, checkTAP(cfg.TAPName), checkPrivileges())
+	results = append(results, checkImages(cfg.KernelPath, cfg.InitrdPath, cfg.StateDiskPath)...)
+	results = append(results, checkPorts(cfg))
+	if opts.QMPSocket != "" {
+		results = append(results, checkQMPSocket(opts.QMPSocket))
+	}
+	if opts.APISocket != "" {
+		results = append(results, checkAPISocket(opts.APISocket))
+	}
+	if opts.MetricsAddr != "" {
+		results = append(results, checkListen("Metrics address", opts.MetricsAddr))
+	}
+	return results
+}
+
+// Failed reports whether any check failed.
+func Failed(results []Result) bool {
+	return slices.ContainsFunc(results, func(r Result) bool { return r.Status == Fail })
+}
+
+// Write prints results as a report, one check per line with its remedy
+// indented below.
+func Write(w io.Writer, results []Result) {
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", r.Status, r.Name, r.Detail)
+		if r.Fix != "" && r.Status != Pass {
+			fmt.Fprintf(w, "       fix: %s\n", r.Fix)
+		}
+	}
+}
+
+// report is the JSON form of a set of results.
+type report struct {
+	OK     bool         `json:"ok"` // no check failed
+	Checks []jsonResult `json:"checks"`
+}
+
+type jsonResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // "pass", "warn", or "fail"
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// WriteJSON prints results as one JSON object, for scripts: "ok" is false
+// if any check failed, and "checks" holds each check with its status and,
+// unless it passed, its remedy.
+func WriteJSON(w io.Writer, results []Result) error {
+	rep := report{OK: !Failed(results), Checks: []jsonResult{}}
+	for _, r := range results {
+		jr := jsonResult{Name: r.Name, Status: strings.ToLower(r.Status.String()), Detail: r.Detail}
+		if r.Status != Pass {
+			jr.Fix = r.Fix
+		}
+		rep.Checks = append(rep.Checks, jr)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// byOS picks the remedy for the current platform.
+func byOS(linux, darwin, windows string) string {
+	switch runtime.GOOS {
+	case "darwin":
+		return darwin
+	case "windows":
+		return windows
+	}
+	return linux
+}
+
+// checkQEMU checks the QEMU binary and its release. It returns the
+// binary's path for the acceleration check, or "" if there is none.
+func checkQEMU() (string, []Result) {
+	r := Result{Name: "QEMU"}
+	path, v, warnings, err := vm.ProbeQEMU()
+	switch {
+	case path == "":
+		r.Status, r.Detail = Fail, err.Error()
+		r.Fix = byOS(
+			`install QEMU, e.g. "sudo apt install qemu-system-x86" or "sudo dnf install qemu-system-x86"`,
+			`install QEMU with "brew install qemu"`,
+			`install QEMU for Windows under C:\Program Files and add it to PATH`)
+		return "", []Result{r}
+	case v == vm.QEMUVersion{}:
+		r.Status, r.Detail = Warn, err.Error()
+		r.Fix = "make sure " + path + " is a working qemu-system-x86_64"
+		return path, []Result{r}
+	case err != nil:
+		r.Status, r.Detail = Fail, err.Error()
+		r.Fix = "upgrade QEMU to a supported release"
+		return path, []Result{r}
+	}
+	r.Detail = fmt.Sprintf("%s %s", path, v)
+	results := []Result{r}
+	for _, w := range warnings {
+		results = append(results, Result{Name: "QEMU", Status: Warn, Detail: w,
+			Fix: "upgrade or downgrade QEMU to a release without this issue"})
+	}
+	return path, results
+}
+
+// checkAccel checks that accel (empty for the best available) is
+// supported by the host and by the QEMU binary at qemu.
+func checkAccel(accel, qemu string) Result {
+	r := Result{Name: "Acceleration"}
+	info, _ := platform.Detect()
+	hostFix := byOS(
+		"enable VT-x/AMD-V in the firmware settings, load the kvm_intel or kvm_amd module, and make sure /dev/kvm is accessible",
+		"TorVM needs a Mac with Hypervisor.framework support (kern.hv_support = 1)",
+		`enable the Windows Hypervisor Platform: "Enable-WindowsOptionalFeature -Online -FeatureName HypervisorPlatform", then reboot`)
+	if accel == "" {
+		accel = string(info.Accel)
+	}
+	if accel != string(info.Accel) && accel != string(platform.TCG) {
+		r.Status, r.Detail, r.Fix = Fail, accel+" was requested but is not available on this host", hostFix
+		return r
+	}
+	if qemu != "" {
+		accels, err := vm.QEMUAccels(qemu)
+		if err == nil && !slices.Contains(accels, accel) {
+			r.Status = Fail
+			r.Detail = fmt.Sprintf("QEMU was built without %s (it supports %s)", accel, strings.Join(accels, ", "))
+			r.Fix = "install a QEMU build with " + accel + " support"
+			return r
+		}
+	}
+	if accel == string(platform.TCG) {
+		r.Status, r.Detail = Warn, "no hardware acceleration; the VM runs in slow software emulation (tcg)"
+		r.Fix = hostFix
+		return r
+	}
+	r.Detail = accel
+	return r
+}
+
+func checkTAP(name string) Result {
+	r := Result{Name: "TAP driver", Detail: "available"}
+	if runtime.GOOS == "darwin" {
+		r.Detail = "not needed (vmnet)"
+	}
+	if err := network.CheckTAPSupport(name); err != nil {
+		r.Status, r.Detail = Fail, err.Error()
+		r.Fix = byOS(
+			`load the tun module: "sudo modprobe tun"`,
+			"",
+			`install the TAP-Windows6 driver (shipped with OpenVPN) and rename its adapter to "`+name+`", or set tap_name to the adapter's name`)
+	}
+	return r
+}
+
+func checkPrivileges() Result {
+	r := Result{Name: "Privileges"}
+	// The check a run makes before it changes anything.
+	if err := privexec.CheckAccess(); err == nil {
+		switch {
+		case platform.Elevated():
+			r.Detail = "can change the host network"
+		case nethelper.Installed():
+			r.Detail = "network changes go through " + nethelper.DefaultPath
+		default:
+			r.Detail = "network changes go through the privileged helper"
+		}
+		return r
+	}
+	r.Status = Fail
+	r.Detail = "not running with the privileges needed to change the host network"
+	r.Fix = byOS(`run torvm with "sudo", install it as a service, or install torvm-nethelper (see "Network helper" in the README)`, `run torvm with "sudo", or install it as a service`,
+		`run torvm from an Administrator prompt, or install it as a service`)
+	return r
+}
+
+// checkAPISocket fails if another controller answers on the control API
+// socket.
+func checkAPISocket(path string) Result {
+	r := Result{Name: "Control API socket", Detail: path + " is free"}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return r
+	}
+	conn.Close()
+	r.Status = Fail
+	r.Detail = path + " is in use: another TorVM controller is running"
+	r.Fix = `stop it ("torvm --status" shows its state), or set api_socket to another path`
+	return r
+}
+
+// checkPorts fails if Tor's ports in the VM clash with each other or
+// with a program on the host (see vm.PortConflicts).
+func checkPorts(cfg *config.Config) Result {
+	r := Result{Name: "Tor ports", Detail: fmt.Sprintf("SOCKS %d, control %d, transparent %d, and DNS %d are free",
+		cfg.SOCKSPort, cfg.ControlPort, cfg.TransPort, cfg.DNSPort)}
+	conflicts := vm.PortConflicts(cfg)
+	if len(conflicts) == 0 {
+		return r
+	}
+	r.Status, r.Detail, r.Fix = Fail, joinConflicts(conflicts), conflictFix(conflicts)
+	return r
+}
+
+// checkQMPSocket fails if another process listens on the QMP socket.
+func checkQMPSocket(path string) Result {
+	r := Result{Name: "QMP socket", Detail: path + " is free"}
+	if c := vm.QMPSocketConflict(path); c != nil {
+		r.Status, r.Detail = Fail, c.String()
+		r.Fix = "stop the other instance, or " + conflictFix([]vm.Conflict{*c})
+	}
+	return r
+}
+
+func joinConflicts(conflicts []vm.Conflict) string {
+	s := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		s[i] = c.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+// conflictFix suggests the free values the conflicts found.
+func conflictFix(conflicts []vm.Conflict) string {
+	var s []string
+	for _, c := range conflicts {
+		if c.Free != "" {
+			s = append(s, fmt.Sprintf("set %s to %s", c.Key, c.Free))
+		}
+	}
+	if len(s) == 0 {
+		return "choose other values in the config"
+	}
+	return strings.Join(s, ", ") + " in the config"
+}
+
+// checkListen fails if addr cannot be listened on.
+func checkListen(name, addr string) Result {
+	r := Result{Name: name, Detail: addr + " is free"}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		r.Status, r.Detail = Fail, err.Error()
+		if errors.Is(err, os.ErrPermission) {
+			r.Fix = "use a port above 1023"
+		} else {
+			r.Fix = "stop the program listening on " + addr + " or choose another address"
+		}
+		return r
+	}
+	ln.Close()
+	return r
+}
@@ -0,0 +1,146 @@
+package doctor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckImages(t *testing.T) {
+	dir := t.TempDir()
+	kernel := make([]byte, 0x400)
+	copy(kernel[0x202:], "HdrS")
+	disk := make([]byte, 2048)
+	disk[1080], disk[1081] = 0x53, 0xef
+	writeFile(t, filepath.Join(dir, "vmlinuz"), kernel)
+	writeFile(t, filepath.Join(dir, "initramfs.gz"), []byte{0x1f, 0x8b, 0x08, 0x00})
+	writeFile(t, filepath.Join(dir, "state.img"), disk)
+
+	results := checkImages(filepath.Join(dir, "vmlinuz"), filepath.Join(dir, "initramfs.gz"), filepath.Join(dir, "state.img"))
+	if len(results) != 3 || Failed(results) {
+		t.Fatalf("valid images: %+v", results)
+	}
+
+	// A truncated kernel and a missing state disk fail.
+	writeFile(t, filepath.Join(dir, "vmlinuz"), kernel[:0x100])
+	os.Remove(filepath.Join(dir, "state.img"))
+	results = checkImages(filepath.Join(dir, "vmlinuz"), filepath.Join(dir, "initramfs.gz"), filepath.Join(dir, "state.img"))
+	for i, want := range []Status{Fail, Pass, Fail} {
+		if results[i].Status != want {
+			t.Errorf("%s: status %v, want %v (%s)", results[i].Name, results[i].Status, want, results[i].Detail)
+		}
+	}
+	if results[0].Fix == "" {
+		t.Error("failed image check has no fix")
+	}
+}
+
+func TestCheckChecksums(t *testing.T) {
+	dir := t.TempDir()
+	sumsPath := filepath.Join(dir, checksumFile)
+	if _, ok := checkChecksums(sumsPath); ok {
+		t.Fatal("missing checksum file should skip the check")
+	}
+
+	kernel := []byte("kernel")
+	sum := sha256.Sum256(kernel)
+	writeFile(t, filepath.Join(dir, "vmlinuz"), kernel)
+	writeFile(t, filepath.Join(dir, "initramfs.gz"), []byte("initrd"))
+	writeFile(t, sumsPath, []byte(
+		hex.EncodeToString(sum[:])+"  vmlinuz\n"+
+			strings.Repeat("0", 64)+" *state.img\n"+
+			strings.Repeat("0", 64)+"  ../escape\n"))
+	r, ok := checkChecksums(sumsPath)
+	if !ok || r.Status != Pass || !strings.HasPrefix(r.Detail, "1 file(s)") {
+		t.Errorf("matching checksums: %+v", r)
+	}
+
+	writeFile(t, sumsPath, []byte(strings.Repeat("0", 64)+"  initramfs.gz\n"))
+	r, _ = checkChecksums(sumsPath)
+	if r.Status != Fail || !strings.Contains(r.Detail, "initramfs.gz") {
+		t.Errorf("mismatched checksum: %+v", r)
+	}
+}
+
+func TestCheckListen(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if r := checkListen("Metrics address", ln.Addr().String()); r.Status != Fail || r.Fix == "" {
+		t.Errorf("address in use: %+v", r)
+	}
+	if r := checkListen("Metrics address", "127.0.0.1:0"); r.Status != Pass {
+		t.Errorf("free address: %+v", r)
+	}
+}
+
+func TestCheckAPISocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	if r := checkAPISocket(path); r.Status != Pass {
+		t.Errorf("no socket: %+v", r)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	if r := checkAPISocket(path); r.Status != Fail {
+		t.Errorf("socket in use: %+v", r)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var b bytes.Buffer
+	Write(&b, []Result{
+		{Name: "QEMU", Detail: "/usr/bin/qemu-system-x86_64 8.2.2", Fix: "ignored"},
+		{Name: "Acceleration", Status: Warn, Detail: "tcg", Fix: "enable KVM"},
+	})
+	want := "[PASS] QEMU: /usr/bin/qemu-system-x86_64 8.2.2\n" +
+		"[WARN] Acceleration: tcg\n" +
+		"       fix: enable KVM\n"
+	if b.String() != want {
+		t.Errorf("Write:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	err := WriteJSON(&b, []Result{
+		{Name: "QEMU", Detail: "8.2.2", Fix: "ignored"},
+		{Name: "TAP", Status: Fail, Detail: "/dev/net/tun missing", Fix: "modprobe tun"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		OK     bool
+		Checks []map[string]string
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, b.String())
+	}
+	if got.OK || len(got.Checks) != 2 {
+		t.Fatalf("got %+v, want ok false and two checks", got)
+	}
+	if c := got.Checks[0]; c["status"] != "pass" || c["fix"] != "" {
+		t.Errorf("passed check = %v, want status pass and no fix", c)
+	}
+	if c := got.Checks[1]; c["name"] != "TAP" || c["status"] != "fail" || c["fix"] != "modprobe tun" {
+		t.Errorf("failed check = %v", c)
+	}
+}
@@ -0,0 +1,147 @@
+package doctor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// imageFix is the remedy for a missing or damaged VM image.
+const imageFix = "rebuild the VM images with scripts/build-vm.sh or reinstall TorVM, or correct the path in the config"
+
+// imageMagic is a signature at a fixed offset in an image file.
+type imageMagic struct {
+	offset int64
+	magic  []byte
+}
+
+var (
+	// kernelMagic is the boot protocol header signature of a bzImage.
+	kernelMagic = []imageMagic{{0x202, []byte("HdrS")}}
+
+	// initrdMagic covers the compressions the kernel can unpack an
+	// initramfs from, and an uncompressed cpio archive.
+	initrdMagic = []imageMagic{
+		{0, []byte{0x1f, 0x8b}},                     // gzip
+		{0, []byte{0x28, 0xb5, 0x2f, 0xfd}},         // zstd
+		{0, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}}, // xz
+		{0, []byte{0x02, 0x21, 0x4c, 0x18}},         // lz4
+		{0, []byte("070701")},                       // cpio (newc)
+	}
+
+	// stateDiskMagic is the ext2/3/4 superblock signature.
+	stateDiskMagic = []imageMagic{{1024 + 56, []byte{0x53, 0xef}}}
+)
+
+// checksumFile lists the expected SHA-256 of the images in sha256sum
+// format. Image directories that have one are verified against it.
+const checksumFile = "SHA256SUMS"
+
+// checkImages checks that the VM images exist and look like what they
+// should be, and verifies them against a checksum file next to the
+// kernel if there is one.
+func checkImages(kernel, initrd, stateDisk string) []Result {
+	results := []Result{
+		checkImage("Kernel image", kernel, "a Linux kernel (bzImage)", kernelMagic),
+		checkImage("Initramfs image", initrd, "a compressed initramfs", initrdMagic),
+		checkImage("State disk", stateDisk, "an ext4 filesystem", stateDiskMagic),
+	}
+	if r, ok := checkChecksums(filepath.Join(filepath.Dir(kernel), checksumFile)); ok {
+		results = append(results, r)
+	}
+	return results
+}
+
+func checkImage(name, path, want string, magics []imageMagic) Result {
+	r := Result{Name: name, Status: Fail, Fix: imageFix}
+	// The report shows the path the VM will use, whatever directory it
+	// was given relative to.
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		r.Detail = err.Error()
+		return r
+	}
+	defer f.Close()
+	for _, m := range magics {
+		buf := make([]byte, len(m.magic))
+		if _, err := f.ReadAt(buf, m.offset); err == nil && bytes.Equal(buf, m.magic) {
+			r.Status, r.Detail, r.Fix = Pass, path, ""
+			return r
+		}
+	}
+	r.Detail = path + " is not " + want + " (truncated or damaged?)"
+	return r
+}
+
+// checkChecksums verifies the files listed in the checksum file at path.
+// It returns false if there is no such file.
+func checkChecksums(path string) (Result, bool) {
+	r := Result{Name: "Image checksums"}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return r, false
+	}
+	if err != nil {
+		r.Status, r.Detail, r.Fix = Fail, err.Error(), imageFix
+		return r, true
+	}
+	defer f.Close()
+	dir := filepath.Dir(path)
+	var bad []string
+	verified := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// "<hex digest>  <name>", or " *<name>" in binary mode.
+		sum, name, ok := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		if !ok {
+			continue
+		}
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		// The state disk changes as Tor runs; it is not verified.
+		if name == "" || filepath.Base(name) != name || name == "state.img" {
+			continue
+		}
+		got, err := fileSHA256(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || !strings.EqualFold(got, sum) {
+			bad = append(bad, name)
+			continue
+		}
+		verified++
+	}
+	if err := sc.Err(); err != nil {
+		r.Status, r.Detail, r.Fix = Fail, fmt.Sprintf("read %s: %v", path, err), imageFix
+		return r, true
+	}
+	if len(bad) > 0 {
+		r.Status, r.Fix = Fail, imageFix
+		r.Detail = "checksum mismatch: " + strings.Join(bad, ", ")
+		return r, true
+	}
+	r.Detail = fmt.Sprintf("%d file(s) match %s", verified, path)
+	return r, true
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
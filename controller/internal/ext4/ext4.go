@@ -0,0 +1,418 @@
+// Package ext4 formats disk images with an empty ext4 filesystem in pure
+// Go, so the controller can make a state disk on hosts without
+// mkfs.ext4, such as Windows and macOS.
+//
+// The filesystem is deliberately plain: 4 KiB blocks, 256-byte inodes,
+// sparse superblock backups, an internal journal, and extents for new
+// files, with no flex_bg, 64bit, or metadata checksums. The kernel and
+// e2fsck accept it as they accept one made by mke2fs.
+package ext4
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// BlockSize is the filesystem block size.
+	BlockSize = 4096
+	// MinSize and MaxSize bound the image sizes Format accepts.
+	MinSize = 16 << 20
+	MaxSize = 1 << 40
+
+	blocksPerGroup = 8 * BlockSize // one block bitmap's worth
+	inodeSize      = 256
+	inodesPerBlock = BlockSize / inodeSize
+	bytesPerInode  = 16 << 10
+	descSize       = 32
+	extraIsize     = 32
+
+	journalIno   = 8
+	rootIno      = 2
+	lostFoundIno = 11
+	firstIno     = 11
+)
+
+// Superblock feature flags.
+const (
+	compatHasJournal = 0x4
+	compatDirIndex   = 0x20
+
+	incompatFiletype = 0x2
+	incompatExtents  = 0x40
+
+	roCompatSparseSuper = 0x1
+	roCompatLargeFile   = 0x2
+	roCompatExtraIsize  = 0x40
+)
+
+// Options are the optional settings of a new filesystem.
+type Options struct {
+	Label string    // volume label, at most 16 bytes
+	UUID  [16]byte  // filesystem UUID; zero for a random one
+	Time  time.Time // creation time; zero for now
+}
+
+// layout is the geometry of a filesystem.
+type layout struct {
+	blocks         uint32
+	groups         uint32
+	inodesPerGroup uint32
+	itableBlocks   uint32
+	gdtBlocks      uint32
+	journalBlocks  uint32
+}
+
+// Format writes an empty ext4 filesystem of size bytes to w, rounded down
+// to whole blocks. Only metadata is written: w must read back as zeros
+// elsewhere, as a newly created file truncated to size does.
+func Format(w io.WriterAt, size int64, opts Options) error {
+	if size < MinSize || size > MaxSize {
+		return fmt.Errorf("ext4: size %d out of range (%d to %d bytes)", size, int64(MinSize), int64(MaxSize))
+	}
+	if len(opts.Label) > 16 {
+		return fmt.Errorf("ext4: label %q longer than 16 bytes", opts.Label)
+	}
+	if opts.UUID == ([16]byte{}) {
+		if _, err := rand.Read(opts.UUID[:]); err != nil {
+			return fmt.Errorf("ext4: %w", err)
+		}
+		opts.UUID[6] = opts.UUID[6]&0x0f | 0x40 // version 4
+		opts.UUID[8] = opts.UUID[8]&0x3f | 0x80 // RFC 4122 variant
+	}
+	if opts.Time.IsZero() {
+		opts.Time = time.Now()
+	}
+	var hashSeed [16]byte
+	if _, err := rand.Read(hashSeed[:]); err != nil {
+		return fmt.Errorf("ext4: %w", err)
+	}
+
+	l := newLayout(size)
+	f := &formatter{w: w, l: l, opts: opts, hashSeed: hashSeed, now: uint32(opts.Time.Unix())}
+	if err := f.write(); err != nil {
+		return fmt.Errorf("ext4: %w", err)
+	}
+	return nil
+}
+
+// newLayout picks the geometry for an image of size bytes. Like mke2fs,
+// it drops a last group too small to hold its own metadata and some data.
+func newLayout(size int64) layout {
+	var l layout
+	l.blocks = uint32(size / BlockSize)
+	switch {
+	case l.blocks < 32768:
+		l.journalBlocks = 1024
+	case l.blocks < 256<<10:
+		l.journalBlocks = 4096
+	case l.blocks < 512<<10:
+		l.journalBlocks = 8192
+	default:
+		l.journalBlocks = 16384
+	}
+	for {
+		l.groups = (l.blocks + blocksPerGroup - 1) / blocksPerGroup
+		l.gdtBlocks = (l.groups*descSize + BlockSize - 1) / BlockSize
+		inodes := uint32(int64(l.blocks) * BlockSize / bytesPerInode)
+		ipg := (inodes + l.groups - 1) / l.groups
+		ipg = (ipg + inodesPerBlock - 1) / inodesPerBlock * inodesPerBlock
+		l.inodesPerGroup = min(max(ipg, inodesPerBlock), blocksPerGroup)
+		l.itableBlocks = l.inodesPerGroup / inodesPerBlock
+
+		last := l.groups - 1
+		if last == 0 || l.groupBlocks(last) >= l.overhead(last)+50 {
+			return l
+		}
+		l.blocks -= l.groupBlocks(last)
+	}
+}
+
+// hasSuper reports whether group g holds a superblock and descriptor
+// backup: groups 0 and 1 and powers of 3, 5, and 7 (sparse_super).
+func hasSuper(g uint32) bool {
+	if g <= 1 {
+		return true
+	}
+	for _, base := range []uint32{3, 5, 7} {
+		n := base
+		for n < g {
+			n *= base
+		}
+		if n == g {
+			return true
+		}
+	}
+	return false
+}
+
+func (l layout) groupStart(g uint32) uint32 { return g * blocksPerGroup }
+
+func (l layout) groupBlocks(g uint32) uint32 {
+	return min(blocksPerGroup, l.blocks-l.groupStart(g))
+}
+
+// blockBitmap returns the first block after group g's superblock and
+// descriptor backup; the inode bitmap and inode table follow it.
+func (l layout) blockBitmap(g uint32) uint32 {
+	b := l.groupStart(g)
+	if hasSuper(g) {
+		b += 1 + l.gdtBlocks
+	}
+	return b
+}
+
+// overhead is the number of metadata blocks in group g.
+func (l layout) overhead(g uint32) uint32 {
+	return l.blockBitmap(g) - l.groupStart(g) + 2 + l.itableBlocks
+}
+
+// used is the number of blocks in use in group g of a new filesystem.
+// They are always the first blocks of the group: group 0 holds the root
+// and lost+found directories and the journal after its metadata.
+func (l layout) used(g uint32) uint32 {
+	n := l.overhead(g)
+	if g == 0 {
+		n += 2 + l.journalBlocks
+	}
+	return n
+}
+
+// Data blocks of group 0.
+func (l layout) rootBlock() uint32      { return l.blockBitmap(0) + 2 + l.itableBlocks }
+func (l layout) lostFoundBlock() uint32 { return l.rootBlock() + 1 }
+func (l layout) journalStart() uint32   { return l.rootBlock() + 2 }
+
+type formatter struct {
+	w        io.WriterAt
+	l        layout
+	opts     Options
+	hashSeed [16]byte
+	now      uint32
+}
+
+func (f *formatter) writeBlock(block uint32, off int, data []byte) error {
+	_, err := f.w.WriteAt(data, int64(block)*BlockSize+int64(off))
+	return err
+}
+
+func (f *formatter) write() error {
+	l := f.l
+	var freeBlocks, freeInodes uint32
+	gdt := make([]byte, l.gdtBlocks*BlockSize)
+	for g := uint32(0); g < l.groups; g++ {
+		fb := l.groupBlocks(g) - l.used(g)
+		fi := l.inodesPerGroup
+		dirs := uint16(0)
+		if g == 0 {
+			fi -= firstIno
+			dirs = 2
+		}
+		freeBlocks += fb
+		freeInodes += fi
+
+		d := gdt[g*descSize:]
+		bb := l.blockBitmap(g)
+		binary.LittleEndian.PutUint32(d[0:], bb)
+		binary.LittleEndian.PutUint32(d[4:], bb+1)
+		binary.LittleEndian.PutUint32(d[8:], bb+2)
+		binary.LittleEndian.PutUint16(d[12:], uint16(fb))
+		binary.LittleEndian.PutUint16(d[14:], uint16(fi))
+		binary.LittleEndian.PutUint16(d[16:], dirs)
+
+		if err := f.writeBitmaps(g); err != nil {
+			return err
+		}
+	}
+
+	for g := uint32(0); g < l.groups; g++ {
+		if !hasSuper(g) {
+			continue
+		}
+		sb := f.superblock(g, freeBlocks, freeInodes)
+		start, off := l.groupStart(g), 0
+		if g == 0 {
+			off = 1024 // after the boot sector
+		}
+		if err := f.writeBlock(start, off, sb); err != nil {
+			return err
+		}
+		if err := f.writeBlock(start+1, 0, gdt); err != nil {
+			return err
+		}
+	}
+
+	if err := f.writeInodes(); err != nil {
+		return err
+	}
+	if err := f.writeDirs(); err != nil {
+		return err
+	}
+	return f.writeBlock(l.journalStart(), 0, f.journalSuperblock())
+}
+
+// writeBitmaps marks the used blocks and inodes of group g, and the bits
+// past the end of the group, which have nothing to map.
+func (f *formatter) writeBitmaps(g uint32) error {
+	l := f.l
+	bitmap := make([]byte, BlockSize)
+	setBits(bitmap, 0, l.used(g))
+	setBits(bitmap, l.groupBlocks(g), blocksPerGroup)
+	if err := f.writeBlock(l.blockBitmap(g), 0, bitmap); err != nil {
+		return err
+	}
+	clear(bitmap)
+	if g == 0 {
+		setBits(bitmap, 0, firstIno)
+	}
+	setBits(bitmap, l.inodesPerGroup, blocksPerGroup)
+	return f.writeBlock(l.blockBitmap(g)+1, 0, bitmap)
+}
+
+func setBits(b []byte, from, to uint32) {
+	for i := from; i < to; i++ {
+		b[i/8] |= 1 << (i % 8)
+	}
+}
+
+func (f *formatter) superblock(group, freeBlocks, freeInodes uint32) []byte {
+	l := f.l
+	sb := make([]byte, 1024)
+	le := binary.LittleEndian
+	le.PutUint32(sb[0:], l.inodesPerGroup*l.groups) // s_inodes_count
+	le.PutUint32(sb[4:], l.blocks)                  // s_blocks_count_lo
+	le.PutUint32(sb[8:], l.blocks/20)               // s_r_blocks_count_lo: 5%
+	le.PutUint32(sb[12:], freeBlocks)
+	le.PutUint32(sb[16:], freeInodes)
+	le.PutUint32(sb[20:], 0) // s_first_data_block
+	le.PutUint32(sb[24:], 2) // s_log_block_size: 1024 << 2
+	le.PutUint32(sb[28:], 2) // s_log_cluster_size
+	le.PutUint32(sb[32:], blocksPerGroup)
+	le.PutUint32(sb[36:], blocksPerGroup) // s_clusters_per_group
+	le.PutUint32(sb[40:], l.inodesPerGroup)
+	le.PutUint32(sb[48:], f.now)    // s_wtime
+	le.PutUint16(sb[54:], 0xffff)   // s_max_mnt_count: no mount-count checks
+	le.PutUint16(sb[56:], 0xef53)   // s_magic
+	le.PutUint16(sb[58:], 1)        // s_state: clean
+	le.PutUint16(sb[60:], 1)        // s_errors: continue
+	le.PutUint32(sb[64:], f.now)    // s_lastcheck
+	le.PutUint32(sb[76:], 1)        // s_rev_level: dynamic
+	le.PutUint32(sb[84:], firstIno) // s_first_ino
+	le.PutUint16(sb[88:], inodeSize)
+	le.PutUint16(sb[90:], uint16(group)) // s_block_group_nr
+	le.PutUint32(sb[92:], compatHasJournal|compatDirIndex)
+	le.PutUint32(sb[96:], incompatFiletype|incompatExtents)
+	le.PutUint32(sb[100:], roCompatSparseSuper|roCompatLargeFile|roCompatExtraIsize)
+	copy(sb[104:120], f.opts.UUID[:])
+	copy(sb[120:136], f.opts.Label)
+	le.PutUint32(sb[224:], journalIno) // s_journal_inum
+	copy(sb[236:252], f.hashSeed[:])
+	sb[252] = 1                   // s_def_hash_version: half MD4
+	sb[253] = 1                   // s_jnl_backup_type: s_jnl_blocks holds i_block and i_size
+	le.PutUint32(sb[264:], f.now) // s_mkfs_time
+	copy(sb[268:328], f.journalInodeBlocks())
+	le.PutUint32(sb[332:], l.journalBlocks*BlockSize) // s_jnl_blocks[16]: i_size
+	le.PutUint16(sb[348:], extraIsize)                // s_min_extra_isize
+	le.PutUint16(sb[350:], extraIsize)                // s_want_extra_isize
+	le.PutUint32(sb[352:], 2)                         // s_flags: unsigned directory hash
+	return sb
+}
+
+// journalInodeBlocks returns the journal inode's i_block: an extent tree
+// of one leaf covering the whole journal.
+func (f *formatter) journalInodeBlocks() []byte {
+	b := make([]byte, 60)
+	le := binary.LittleEndian
+	le.PutUint16(b[0:], 0xf30a) // eh_magic
+	le.PutUint16(b[2:], 1)      // eh_entries
+	le.PutUint16(b[4:], 4)      // eh_max
+	le.PutUint16(b[6:], 0)      // eh_depth
+	le.PutUint32(b[12:], 0)     // ee_block
+	le.PutUint16(b[16:], uint16(f.l.journalBlocks))
+	le.PutUint16(b[18:], 0) // ee_start_hi
+	le.PutUint32(b[20:], f.l.journalStart())
+	return b
+}
+
+// inode returns an inode with the given mode, link count, and size in
+// blocks, timestamped with the creation time.
+func (f *formatter) inode(mode, links uint16, blocks uint32) []byte {
+	b := make([]byte, inodeSize)
+	le := binary.LittleEndian
+	le.PutUint16(b[0:], mode)
+	le.PutUint32(b[4:], blocks*BlockSize) // i_size_lo
+	le.PutUint32(b[8:], f.now)            // i_atime
+	le.PutUint32(b[12:], f.now)           // i_ctime
+	le.PutUint32(b[16:], f.now)           // i_mtime
+	le.PutUint16(b[26:], links)
+	le.PutUint32(b[28:], blocks*BlockSize/512) // i_blocks_lo
+	le.PutUint16(b[128:], extraIsize)
+	le.PutUint32(b[144:], f.now) // i_crtime
+	return b
+}
+
+func (f *formatter) writeInodes() error {
+	// Inodes 1 through 16 share the first inode table block.
+	table := make([]byte, BlockSize)
+	put := func(ino uint32, inode []byte) { copy(table[(ino-1)*inodeSize:], inode) }
+
+	root := f.inode(0o40755, 3, 1)
+	binary.LittleEndian.PutUint32(root[40:], f.l.rootBlock())
+	put(rootIno, root)
+
+	lf := f.inode(0o40700, 2, 1)
+	binary.LittleEndian.PutUint32(lf[40:], f.l.lostFoundBlock())
+	put(lostFoundIno, lf)
+
+	j := f.inode(0o100600, 1, f.l.journalBlocks)
+	binary.LittleEndian.PutUint32(j[32:], 0x80000) // i_flags: EXT4_EXTENTS_FL
+	copy(j[40:100], f.journalInodeBlocks())
+	put(journalIno, j)
+
+	return f.writeBlock(f.l.blockBitmap(0)+2, 0, table)
+}
+
+// dirent appends a directory entry to b.
+func dirent(b []byte, ino uint32, recLen uint16, name string, fileType byte) []byte {
+	var h [8]byte
+	binary.LittleEndian.PutUint32(h[0:], ino)
+	binary.LittleEndian.PutUint16(h[4:], recLen)
+	h[6] = byte(len(name))
+	h[7] = fileType
+	b = append(b, h[:]...)
+	b = append(b, name...)
+	return append(b, make([]byte, int(recLen)-8-len(name))...)
+}
+
+const fileTypeDir = 2
+
+func (f *formatter) writeDirs() error {
+	root := dirent(nil, rootIno, 12, ".", fileTypeDir)
+	root = dirent(root, rootIno, 12, "..", fileTypeDir)
+	root = dirent(root, lostFoundIno, BlockSize-24, "lost+found", fileTypeDir)
+	if err := f.writeBlock(f.l.rootBlock(), 0, root); err != nil {
+		return err
+	}
+	lf := dirent(nil, lostFoundIno, 12, ".", fileTypeDir)
+	lf = dirent(lf, rootIno, BlockSize-12, "..", fileTypeDir)
+	return f.writeBlock(f.l.lostFoundBlock(), 0, lf)
+}
+
+// journalSuperblock returns the first block of an empty jbd2 journal.
+// jbd2 fields are big-endian.
+func (f *formatter) journalSuperblock() []byte {
+	b := make([]byte, 1024)
+	be := binary.BigEndian
+	be.PutUint32(b[0x0:], 0xc03b3998) // h_magic
+	be.PutUint32(b[0x4:], 4)          // h_blocktype: superblock v2
+	be.PutUint32(b[0xc:], BlockSize)
+	be.PutUint32(b[0x10:], f.l.journalBlocks) // s_maxlen
+	be.PutUint32(b[0x14:], 1)                 // s_first
+	be.PutUint32(b[0x18:], 1)                 // s_sequence
+	copy(b[0x30:0x40], f.opts.UUID[:])
+	be.PutUint32(b[0x40:], 1) // s_nr_users
+	return b
+}
@@ -0,0 +1,108 @@
+package ext4
+
+import (
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHasSuper(t *testing.T) {
+	var got []uint32
+	for g := uint32(0); g < 130; g++ {
+		if hasSuper(g) {
+			got = append(got, g)
+		}
+	}
+	want := []uint32{0, 1, 3, 5, 7, 9, 25, 27, 49, 81, 125}
+	if len(got) != len(want) {
+		t.Fatalf("groups with backups %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("groups with backups %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		size                int64
+		blocks, groups, ipg uint32
+		journalBlocks       uint32
+	}{
+		{16 << 20, 4096, 1, 1024, 1024},
+		{64 << 20, 16384, 1, 4096, 1024},
+		{200 << 20, 51200, 2, 6400, 4096},
+		// The second group would have 16 blocks, too few for its metadata.
+		{128<<20 + 16*BlockSize, 32768, 1, 8192, 4096},
+	}
+	for _, tt := range tests {
+		l := newLayout(tt.size)
+		if l.blocks != tt.blocks || l.groups != tt.groups || l.inodesPerGroup != tt.ipg || l.journalBlocks != tt.journalBlocks {
+			t.Errorf("newLayout(%d) = %+v, want blocks %d, groups %d, inodes per group %d, journal %d",
+				tt.size, l, tt.blocks, tt.groups, tt.ipg, tt.journalBlocks)
+		}
+		if l.used(0) > l.groupBlocks(0) {
+			t.Errorf("newLayout(%d): group 0 needs %d blocks, has %d", tt.size, l.used(0), l.groupBlocks(0))
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, size := range []int64{MinSize, 64 << 20, 200 << 20, 1 << 30} {
+		path := filepath.Join(t.TempDir(), "fs.img")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Truncate(size); err != nil {
+			t.Fatal(err)
+		}
+		created := time.Unix(1700000000, 0)
+		err = Format(f, size, Options{Label: "torstate", Time: created})
+		f.Close()
+		if err != nil {
+			t.Fatalf("Format(%d): %v", size, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sb := data[1024:2048]
+		if magic := binary.LittleEndian.Uint16(sb[56:]); magic != 0xef53 {
+			t.Fatalf("Format(%d): superblock magic %#x", size, magic)
+		}
+		if label := string(sb[120:128]); label != "torstate" {
+			t.Errorf("Format(%d): label %q", size, label)
+		}
+		if mkfs := binary.LittleEndian.Uint32(sb[264:]); mkfs != uint32(created.Unix()) {
+			t.Errorf("Format(%d): mkfs time %d", size, mkfs)
+		}
+
+		if _, err := exec.LookPath("e2fsck"); err != nil {
+			continue
+		}
+		if out, err := exec.Command("e2fsck", "-fn", path).CombinedOutput(); err != nil {
+			t.Errorf("Format(%d): e2fsck: %v\n%s", size, err, out)
+		}
+	}
+}
+
+func TestFormatRejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fs.img")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := Format(f, MinSize-BlockSize, Options{}); err == nil {
+		t.Error("Format accepted a size below MinSize")
+	}
+	if err := Format(f, MinSize, Options{Label: "a label far too long"}); err == nil {
+		t.Error("Format accepted a label longer than 16 bytes")
+	}
+}
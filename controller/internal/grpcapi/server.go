@@ -0,0 +1,266 @@
+// Package grpcapi serves the controller's gRPC control API (see package
+// torvmpb for the protocol) on a Unix socket. It offers what the HTTP
+// control API does, with typed messages, log streaming, and config
+// updates.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/user/extorvm/controller/api/torvmpb"
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// watchBuffer is how many events a Watch stream may fall behind before
+// events are dropped for it.
+const watchBuffer = 64
+
+// closeGrace is how long Close waits for calls in flight.
+const closeGrace = 2 * time.Second
+
+// Server serves the gRPC control API for one engine.
+type Server struct {
+	engine  *lifecycle.Engine
+	ctrl    controlapi.Controller
+	version string
+
+	grpcServer *grpc.Server
+	listener   net.Listener
+
+	mu       sync.Mutex
+	progress int
+	summary  string
+	watchers map[*watcher]struct{}
+}
+
+// watcher is one Watch stream.
+type watcher struct {
+	ch   chan *torvmpb.Event
+	logs bool
+}
+
+// NewServer listens on the Unix socket at path, with the permissions and
+// api_group of controlapi.ListenUnix, and registers with engine for events. ctrl
+// starts and stops the VM, as for the HTTP control API.
+func NewServer(path string, engine *lifecycle.Engine, ctrl controlapi.Controller, version string) (*Server, error) {
+	ln, err := controlapi.ListenUnix(path, engine.Config.APIGroup)
+	if err != nil {
+		return nil, fmt.Errorf("grpc api: %w", err)
+	}
+	s := &Server{
+		engine:     engine,
+		ctrl:       ctrl,
+		version:    version,
+		grpcServer: grpc.NewServer(),
+		listener:   ln,
+		watchers:   make(map[*watcher]struct{}),
+	}
+	torvmpb.RegisterControlServer(s.grpcServer, service{Server: s})
+	engine.Events.Subscribe(s.engineEvent)
+	return s, nil
+}
+
+// Start begins serving in a goroutine.
+func (s *Server) Start() {
+	go s.grpcServer.Serve(s.listener)
+}
+
+// Close ends the Watch streams, waits briefly for other calls in flight,
+// and stops the server.
+func (s *Server) Close() {
+	s.mu.Lock()
+	for w := range s.watchers {
+		close(w.ch)
+		delete(s.watchers, w)
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(closeGrace):
+		s.grpcServer.Stop()
+	}
+}
+
+// Write implements io.Writer for the controller's log, so Watch can
+// stream log lines: add the server with logging.Logger.AddWriter. It
+// never blocks.
+func (s *Server) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		s.publish(&torvmpb.Event{Kind: torvmpb.Event_LOG, Message: line})
+	}
+	return len(p), nil
+}
+
+// engineEvent tracks bootstrap progress and forwards the engine's events
+// to the Watch streams.
+func (s *Server) engineEvent(ev lifecycle.Event) {
+	switch ev.Kind {
+	case lifecycle.EventState:
+		if ev.To == lifecycle.StateInit || ev.To == lifecycle.StateSaveNetwork {
+			s.setBootstrap(0, "")
+		}
+		s.publish(&torvmpb.Event{Kind: torvmpb.Event_STATE, State: ev.To.String()})
+	case lifecycle.EventBootstrap:
+		s.setBootstrap(ev.Progress, ev.Summary)
+		s.publish(&torvmpb.Event{Kind: torvmpb.Event_BOOTSTRAP, Progress: int32(ev.Progress), Message: ev.Summary})
+	case lifecycle.EventFailsafe:
+		s.publish(&torvmpb.Event{Kind: torvmpb.Event_FAILSAFE, Failsafe: ev.Active})
+	case lifecycle.EventVMExit:
+		s.publish(&torvmpb.Event{Kind: torvmpb.Event_VM_EXIT, Message: ev.Err.Error()})
+	}
+}
+
+func (s *Server) setBootstrap(progress int, summary string) {
+	s.mu.Lock()
+	s.progress, s.summary = progress, summary
+	s.mu.Unlock()
+}
+
+// publish sends ev to every watcher that wants it, dropping it for those
+// that are not keeping up rather than blocking the engine or the logger.
+func (s *Server) publish(ev *torvmpb.Event) {
+	ev.Time = timestamppb.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for w := range s.watchers {
+		if ev.Kind == torvmpb.Event_LOG && !w.logs {
+			continue
+		}
+		select {
+		case w.ch <- ev:
+		default:
+		}
+	}
+}
+
+// service implements the RPCs; its Start is the RPC, not Server.Start.
+type service struct {
+	torvmpb.UnimplementedControlServer
+	*Server
+}
+
+// The methods below implement torvmpb.ControlServer.
+var _ torvmpb.ControlServer = service{}
+
+// Status returns the current lifecycle state.
+func (s service) Status(ctx context.Context, req *torvmpb.StatusRequest) (*torvmpb.StatusResponse, error) {
+	state := s.engine.State()
+	s.mu.Lock()
+	progress, summary := s.progress, s.summary
+	s.mu.Unlock()
+	if state == lifecycle.StateRunning {
+		progress = 100
+	}
+	return &torvmpb.StatusResponse{
+		State:     state.String(),
+		Running:   state == lifecycle.StateRunning,
+		Failsafe:  s.engine.FailSafe.IsActive(),
+		Bootstrap: int32(progress),
+		Summary:   summary,
+		Socks:     net.JoinHostPort(s.engine.Config.VMIP, strconv.Itoa(s.engine.Config.SOCKSPort)),
+		Version:   s.version,
+	}, nil
+}
+
+// Watch streams events, starting with the current state, until the
+// client cancels or the server closes.
+func (s service) Watch(req *torvmpb.WatchRequest, stream grpc.ServerStreamingServer[torvmpb.Event]) error {
+	w := &watcher{ch: make(chan *torvmpb.Event, watchBuffer), logs: req.GetLogs()}
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers, w)
+		s.mu.Unlock()
+	}()
+
+	first := &torvmpb.Event{Time: timestamppb.Now(), Kind: torvmpb.Event_STATE, State: s.engine.State().String()}
+	if err := stream.Send(first); err != nil {
+		return err
+	}
+	for {
+		select {
+		case ev, ok := <-w.ch:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Start starts the VM.
+func (s service) Start(ctx context.Context, req *torvmpb.StartRequest) (*torvmpb.StartResponse, error) {
+	if err := s.ctrl.StartVM(); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &torvmpb.StartResponse{}, nil
+}
+
+// Stop stops the VM and returns once it has shut down. A session that
+// failed, or a shutdown that could not restore the host network, is an
+// internal error.
+func (s service) Stop(ctx context.Context, req *torvmpb.StopRequest) (*torvmpb.StopResponse, error) {
+	err := s.ctrl.StopVM(ctx)
+	switch {
+	case err == nil:
+		return &torvmpb.StopResponse{}, nil
+	case errors.Is(err, controlapi.ErrNotRunning), errors.Is(err, lifecycle.ErrNotRunning):
+		return nil, status.Error(codes.FailedPrecondition, controlapi.ErrNotRunning.Error())
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+}
+
+// NewIdentity asks Tor for new circuits.
+func (s service) NewIdentity(ctx context.Context, req *torvmpb.NewIdentityRequest) (*torvmpb.NewIdentityResponse, error) {
+	if s.engine.State() != lifecycle.StateRunning {
+		return nil, status.Error(codes.FailedPrecondition, controlapi.ErrNotRunning.Error())
+	}
+	if err := s.engine.NewIdentity(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &torvmpb.NewIdentityResponse{}, nil
+}
+
+// UpdateConfig patches the engine's configuration and reloads it, as an
+// edit of the config file would. The change is not saved to the file.
+// Only the fields config.PatchLive allows may be changed.
+func (s service) UpdateConfig(ctx context.Context, req *torvmpb.UpdateConfigRequest) (*torvmpb.UpdateConfigResponse, error) {
+	n, err := s.engine.Config.PatchLive([]byte(req.GetConfigJson()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	diff, err := s.engine.ReloadConfig(n)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	// Fields that need TorVM restarted need a restart all the same.
+	return &torvmpb.UpdateConfigResponse{
+		Applied:         diff.HotReloadable,
+		RestartRequired: append(diff.RestartRequired, diff.RestartNow...),
+	}, nil
+}
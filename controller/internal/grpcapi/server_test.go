@@ -0,0 +1,181 @@
+package grpcapi
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/user/extorvm/controller/api/torvmpb"
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+type fakeController struct {
+	running bool
+}
+
+func (f *fakeController) StartVM() error {
+	if f.running {
+		return controlapi.ErrRunning
+	}
+	f.running = true
+	return nil
+}
+
+func (f *fakeController) StopVM(ctx context.Context) error {
+	if !f.running {
+		return controlapi.ErrNotRunning
+	}
+	f.running = false
+	return nil
+}
+
+// startTestServer serves the API for an idle engine on a temporary
+// socket and returns a client for it.
+func startTestServer(t *testing.T, ctrl controlapi.Controller) (*Server, *logging.Logger, torvmpb.ControlClient) {
+	t.Helper()
+	logger, _ := logging.NewLogger(logging.Options{})
+	engine := lifecycle.NewEngineWithDeps(config.DefaultConfig(), logger, nil, nil)
+	sock := filepath.Join(t.TempDir(), "grpc.sock")
+	srv, err := NewServer(sock, engine, ctrl, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.AddWriter(srv)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	conn, err := grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, logger, torvmpb.NewControlClient(conn)
+}
+
+func TestStatusAndActions(t *testing.T) {
+	ctrl := &fakeController{}
+	_, _, c := startTestServer(t, ctrl)
+	ctx := context.Background()
+
+	st, err := c.Status(ctx, &torvmpb.StatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != "Init" || st.Running || st.Socks != "10.10.10.1:9050" || st.Version != "test" {
+		t.Errorf("Status = %v", st)
+	}
+
+	if _, err := c.Start(ctx, &torvmpb.StartRequest{}); err != nil || !ctrl.running {
+		t.Fatalf("Start: err = %v, running = %v", err, ctrl.running)
+	}
+	if _, err := c.Start(ctx, &torvmpb.StartRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("second Start: err = %v, want FailedPrecondition", err)
+	}
+	if _, err := c.Stop(ctx, &torvmpb.StopRequest{}); err != nil || ctrl.running {
+		t.Fatalf("Stop: err = %v, running = %v", err, ctrl.running)
+	}
+	if _, err := c.Stop(ctx, &torvmpb.StopRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("second Stop: err = %v, want FailedPrecondition", err)
+	}
+	if _, err := c.NewIdentity(ctx, &torvmpb.NewIdentityRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("NewIdentity while stopped: err = %v, want FailedPrecondition", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	srv, logger, c := startTestServer(t, &fakeController{})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := c.Watch(ctx, &torvmpb.WatchRequest{Logs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The watcher is registered before the first event is sent.
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.Kind != torvmpb.Event_STATE || ev.State != "Init" {
+		t.Errorf("first event = %v, want the current state", ev)
+	}
+
+	bus := srv.engine.Events
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventBootstrap, Progress: 40, Summary: "Loading relay descriptors"})
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventNetwork, Op: "setup routing"})
+	logger.Info("hello from the log")
+	bus.Publish(lifecycle.Event{Kind: lifecycle.EventFailsafe, Active: true})
+
+	for _, want := range []*torvmpb.Event{
+		{Kind: torvmpb.Event_BOOTSTRAP, Progress: 40, Message: "Loading relay descriptors"},
+		{Kind: torvmpb.Event_LOG},
+		{Kind: torvmpb.Event_FAILSAFE, Failsafe: true},
+	} {
+		ev, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Time == nil {
+			t.Error("event has no time")
+		}
+		if ev.Kind == torvmpb.Event_LOG {
+			if !strings.HasSuffix(ev.Message, "hello from the log") {
+				t.Errorf("log event = %q", ev.Message)
+			}
+			continue
+		}
+		if ev.Kind != want.Kind || ev.Progress != want.Progress || ev.Message != want.Message || ev.Failsafe != want.Failsafe {
+			t.Errorf("event = %v, want %v", ev, want)
+		}
+	}
+
+	st, err := c.Status(ctx, &torvmpb.StatusRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Bootstrap != 40 || st.Summary != "Loading relay descriptors" {
+		t.Errorf("Status after bootstrap event = %v", st)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	srv, _, c := startTestServer(t, &fakeController{})
+	ctx := context.Background()
+
+	resp, err := c.UpdateConfig(ctx, &torvmpb.UpdateConfigRequest{ConfigJson: `{"verbose": true, "relays": {"strict_nodes": true}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resp.Applied, []string{"Verbose (verbose)", "Relays (relays)"}) || len(resp.RestartRequired) != 0 {
+		t.Errorf("UpdateConfig = %v", resp)
+	}
+	if !srv.engine.Config.Verbose || !srv.engine.Config.Relays.StrictNodes {
+		t.Error("engine config not updated")
+	}
+
+	for _, patch := range []string{
+		`{"proxy": {"type": "gopher"}}`,
+		`{"vm_memory_mb": 256}`,
+		`{"state_disk_path": "/etc/shadow"}`,
+		`{"kill_switch": false}`,
+		`{"proxy": {"type": "socks5", "address": "127.0.0.1:1081", "password": "file:/etc/shadow"}}`,
+	} {
+		if _, err := c.UpdateConfig(ctx, &torvmpb.UpdateConfigRequest{ConfigJson: patch}); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("UpdateConfig(%s): err = %v, want InvalidArgument", patch, err)
+		}
+	}
+	if srv.engine.Config.Proxy.Password != "" {
+		t.Error("a refused patch changed the config")
+	}
+}
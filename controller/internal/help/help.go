@@ -0,0 +1,185 @@
+// Package help holds TorVM's help topics. They are markdown files
+// embedded in the binary, so help works without a network connection.
+// The GUI shows them in the Help tab, as tooltips on settings, and behind
+// error dialogs.
+package help
+
+import (
+	"embed"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Topic IDs, one per file in topics/.
+const (
+	Acceleration      = "acceleration"
+	Autostart         = "autostart"
+	Bridges           = "bridges"
+	ConnectionSharing = "connection-sharing"
+	CrashRecovery     = "crash-recovery"
+	DiskLimits        = "disk-limits"
+	DNSLeaks          = "dns-leaks"
+	EmergencyStop     = "emergency-stop"
+	Failsafe          = "failsafe"
+	Identities        = "identities"
+	LAN               = "lan"
+	LeakTest          = "leak-test"
+	Logging           = "logging"
+	Pause             = "pause"
+	Privileges        = "privileges"
+	Proxy             = "proxy"
+	QEMU              = "qemu"
+	Relays            = "relays"
+	RequestBridges    = "request-bridges"
+	Routing           = "routing"
+	SOCKS             = "socks"
+	Storage           = "storage"
+	TAP               = "tap"
+	TransparentMode   = "transparent-mode"
+	Transports        = "transports"
+	VMResources       = "vm-resources"
+	WipeOnExit        = "wipe-on-exit"
+)
+
+//go:embed topics/*.md
+var topicFS embed.FS
+
+// Topic is one help page.
+type Topic struct {
+	ID    string
+	Title string
+	Body  string // markdown, without the title line
+}
+
+// Summary returns the first paragraph of the body, as plain text, for
+// use as a tooltip.
+func (t Topic) Summary() string {
+	para, _, _ := strings.Cut(strings.TrimSpace(t.Body), "\n\n")
+	para = strings.Join(strings.Fields(para), " ")
+	return strings.NewReplacer("**", "", "`", "", "*", "").Replace(para)
+}
+
+// Markdown returns the whole topic, title included.
+func (t Topic) Markdown() string {
+	return "# " + t.Title + "\n\n" + t.Body
+}
+
+var topics = loadTopics()
+
+// loadTopics parses the embedded topics, sorted by title. Each file
+// starts with a "# Title" line.
+func loadTopics() []Topic {
+	entries, err := topicFS.ReadDir("topics")
+	if err != nil {
+		panic(err)
+	}
+	var list []Topic
+	for _, e := range entries {
+		data, err := topicFS.ReadFile(path.Join("topics", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		title, body, _ := strings.Cut(string(data), "\n")
+		list = append(list, Topic{
+			ID:    strings.TrimSuffix(e.Name(), ".md"),
+			Title: strings.TrimSpace(strings.TrimPrefix(title, "#")),
+			Body:  strings.TrimSpace(body) + "\n",
+		})
+	}
+	slices.SortFunc(list, func(a, b Topic) int { return strings.Compare(a.Title, b.Title) })
+	return list
+}
+
+// Topics returns every topic, sorted by title.
+func Topics() []Topic {
+	return slices.Clone(topics)
+}
+
+// Lookup returns the topic with the given ID.
+func Lookup(id string) (Topic, bool) {
+	i := slices.IndexFunc(topics, func(t Topic) bool { return t.ID == id })
+	if i < 0 {
+		return Topic{}, false
+	}
+	return topics[i], true
+}
+
+// Search returns the topics containing every word of query, ignoring
+// case. Topics whose title matches come first. An empty query matches
+// every topic.
+func Search(query string) []Topic {
+	words := strings.Fields(strings.ToLower(query))
+	var titled, other []Topic
+	for _, t := range topics {
+		title := strings.ToLower(t.Title)
+		text := title + "\n" + strings.ToLower(t.Body)
+		if !containsAll(text, words) {
+			continue
+		}
+		if containsAll(title, words) {
+			titled = append(titled, t)
+		} else {
+			other = append(other, t)
+		}
+	}
+	return append(titled, other...)
+}
+
+func containsAll(s string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(s, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// errorTopics maps phrases in error messages to the topic that explains
+// them. The first match wins, so more specific phrases come first.
+var errorTopics = []struct {
+	phrase string
+	topic  string
+}{
+	{"shares its connection", ConnectionSharing},
+	{"shared clients", ConnectionSharing},
+	{"bypass tor", Routing},
+	{"route verification", Routing},
+	{"crash recovery", CrashRecovery},
+	{"is already running (pid", CrashRecovery},
+	{"must run as root", Privileges},
+	{"access is denied", Privileges},
+	{"operation not permitted", Privileges},
+	{"permission denied", Privileges},
+	{"emergency stop", EmergencyStop},
+	{"pause", Pause},
+	{"resume", Pause},
+	{"moat", RequestBridges},
+	{"bootstrap timeout", Bridges},
+	{"bridge", Bridges},
+	{"dns leaks", DNSLeaks},
+	{"lan range", LAN},
+	{"proxy", Proxy},
+	{"tap", TAP},
+	{"/dev/net/tun", TAP},
+	{"kvm", Acceleration},
+	{"hvf", Acceleration},
+	{"whpx", Acceleration},
+	{"accel", Acceleration},
+	{"qemu", QEMU},
+	{"failsafe", Failsafe},
+}
+
+// ForError returns the topic that explains err, if there is one.
+func ForError(err error) (Topic, bool) {
+	if err == nil {
+		return Topic{}, false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, e := range errorTopics {
+		if strings.Contains(msg, e.phrase) {
+			return Lookup(e.topic)
+		}
+	}
+	return Topic{}, false
+}
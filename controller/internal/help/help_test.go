@@ -0,0 +1,74 @@
+package help
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTopics(t *testing.T) {
+	ids := []string{
+		Acceleration, Autostart, Bridges, ConnectionSharing, CrashRecovery, DiskLimits,
+		DNSLeaks, EmergencyStop, Failsafe, Identities, LAN, LeakTest, Logging,
+		Pause, Privileges, Proxy, QEMU, Relays, RequestBridges, Routing, SOCKS,
+		Storage, TAP, TransparentMode, Transports, VMResources, WipeOnExit,
+	}
+	for _, id := range ids {
+		if _, ok := Lookup(id); !ok {
+			t.Errorf("topic %q is not embedded", id)
+		}
+	}
+	if len(Topics()) != len(ids) {
+		t.Errorf("%d topics embedded, %d IDs declared", len(Topics()), len(ids))
+	}
+	for _, topic := range Topics() {
+		if topic.Title == "" || topic.Summary() == "" {
+			t.Errorf("topic %q has no title or summary", topic.ID)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	topic := Topic{Body: "A **bold** `code`\nline.\n\nSecond paragraph.\n"}
+	if got, want := topic.Summary(), "A bold code line."; got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	if got := Search(""); len(got) != len(Topics()) {
+		t.Errorf("empty query matched %d topics, want all %d", len(got), len(Topics()))
+	}
+	got := Search("BRIDGE")
+	if len(got) < 2 || got[0].ID != Bridges {
+		t.Fatalf("Search(BRIDGE) = %v, want the Bridges topic first", got)
+	}
+	if got := Search("bridge zzzz"); len(got) != 0 {
+		t.Errorf("every word must match, got %d topics", len(got))
+	}
+}
+
+func TestForError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("lifecycle: %w", errors.New("must run as root (current uid=1000)")), Privileges},
+		{errors.New("route verification failed, traffic would bypass Tor: no route"), Routing},
+		{errors.New("the host shares its connection on wlan0 (hotspot); devices using it would bypass Tor"), ConnectionSharing},
+		{errors.New("TAP connect timeout after 30s"), TAP},
+		{errors.New("QEMU 4.1.0 is too old; TorVM requires 4.2.0 or newer"), QEMU},
+	}
+	for _, tt := range tests {
+		topic, ok := ForError(tt.err)
+		if !ok || topic.ID != tt.want {
+			t.Errorf("ForError(%q) = %q, %v; want %q", tt.err, topic.ID, ok, tt.want)
+		}
+	}
+	if _, ok := ForError(errors.New("something else")); ok {
+		t.Error("unrelated error matched a topic")
+	}
+	if _, ok := ForError(nil); ok {
+		t.Error("nil error matched a topic")
+	}
+}
@@ -0,0 +1,282 @@
+// Package identity keeps named Tor identities. Each is a state disk of
+// its own, holding Tor's guard choices and keys, including onion service
+// keys, so that one machine can keep a "publishing" identity apart from a
+// "browsing" one: they share no guards, and neither's keys are on the
+// other's disk.
+//
+// The active identity's disk is the configured state disk, so the VM and
+// everything else that uses state_disk_path need not know about
+// identities. The others wait beside it in an identities directory, and
+// switching swaps the disks by renaming them. A switch is recorded before
+// it starts and finished by the next Store call if it was interrupted, so
+// a crash cannot leave an identity without its disk. Disks must only be
+// switched, created, or deleted while the VM is stopped.
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// DefaultName is the identity of a state disk that was never switched.
+const DefaultName = "default"
+
+const (
+	dirName    = "identities"
+	activeFile = "active" // the active identity's name
+	switchFile = "switch" // "FROM\nTO" while a switch is in progress
+	diskSuffix = ".img"
+)
+
+// Identity is one saved identity.
+type Identity struct {
+	Name     string
+	Active   bool
+	Size     int64     // of its state disk; 0 if it has none yet
+	Modified time.Time // when its state disk last changed
+}
+
+var nameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidateName checks that name can name an identity: up to 32 lower-case
+// letters, digits, hyphens, and underscores, starting with a letter or
+// digit.
+func ValidateName(name string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("identity: invalid name %q: use up to 32 lower-case letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// ErrActive is returned for an action on the active identity that needs
+// another one active.
+var ErrActive = errors.New("identity: that identity is active; switch to another one first")
+
+// Store manages the identities of one state disk.
+type Store struct {
+	disk string // the configured state disk: the active identity's
+	dir  string
+}
+
+// Open returns the store for the state disk at stateDiskPath. Its other
+// identities are kept in the directory "identities" beside it.
+func Open(stateDiskPath string) *Store {
+	return &Store{disk: stateDiskPath, dir: filepath.Join(filepath.Dir(stateDiskPath), dirName)}
+}
+
+// Dir returns the directory the inactive identities are kept in.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) diskFile(name string) string {
+	return filepath.Join(s.dir, name+diskSuffix)
+}
+
+// Active returns the name of the active identity.
+func (s *Store) Active() (string, error) {
+	if err := s.recover(); err != nil {
+		return "", err
+	}
+	return s.active()
+}
+
+func (s *Store) active() (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, activeFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultName, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("identity: %w", err)
+	}
+	name := strings.TrimSpace(string(data))
+	if err := ValidateName(name); err != nil {
+		return "", fmt.Errorf("identity: %s: %w", filepath.Join(s.dir, activeFile), err)
+	}
+	return name, nil
+}
+
+// List returns the identities, the active one first and the others by
+// name.
+func (s *Store) List() ([]Identity, error) {
+	active, err := s.Active()
+	if err != nil {
+		return nil, err
+	}
+	list := []Identity{describe(active, s.disk)}
+	list[0].Active = true
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("identity: %w", err)
+	}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), diskSuffix)
+		if !ok || !e.Type().IsRegular() || ValidateName(name) != nil || name == active {
+			continue
+		}
+		list = append(list, describe(name, s.diskFile(name)))
+	}
+	slices.SortFunc(list[1:], func(a, b Identity) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+func describe(name, disk string) Identity {
+	id := Identity{Name: name}
+	if fi, err := os.Stat(disk); err == nil {
+		id.Size, id.Modified = fi.Size(), fi.ModTime()
+	}
+	return id
+}
+
+// Create makes a new identity with an empty state disk of size bytes, on
+// which Tor starts afresh: new guards and new keys. A size of 0 takes the
+// active identity's, or the smallest of vm.StateDiskSizes. It does not
+// switch to it.
+func (s *Store) Create(name string, size int64) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	active, err := s.Active()
+	if err != nil {
+		return err
+	}
+	if name == active {
+		return fmt.Errorf("identity: %q already exists", name)
+	}
+	path := s.diskFile(name)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("identity: %q already exists", name)
+	}
+	if size == 0 {
+		size = vm.StateDiskSizes[0]
+		if fi, err := os.Stat(s.disk); err == nil {
+			size = fi.Size()
+		}
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("identity: %w", err)
+	}
+	if err := vm.CreateStateDisk(path, size); err != nil {
+		return fmt.Errorf("identity %s: %w", name, err)
+	}
+	return nil
+}
+
+// Switch makes name the active identity, moving the active one's state
+// disk aside and name's into its place. The VM must be stopped; it
+// starts with the new identity's guards and keys.
+func (s *Store) Switch(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	active, err := s.Active()
+	if err != nil {
+		return err
+	}
+	if name == active {
+		return nil
+	}
+	if _, err := os.Stat(s.diskFile(name)); err != nil {
+		return fmt.Errorf("identity: no identity %q", name)
+	}
+	if err := writeFile(filepath.Join(s.dir, switchFile), active+"\n"+name+"\n"); err != nil {
+		return err
+	}
+	return s.finishSwitch(active, name)
+}
+
+// finishSwitch carries out the switch from one identity to another, or
+// what is left of it, and clears the record of it. Each step checks
+// whether it was done already.
+func (s *Store) finishSwitch(from, to string) error {
+	parked, incoming := s.diskFile(from), s.diskFile(to)
+	if !exists(parked) && exists(s.disk) {
+		if err := os.Rename(s.disk, parked); err != nil {
+			return fmt.Errorf("identity: move %s aside: %w", from, err)
+		}
+	}
+	if exists(incoming) {
+		if exists(s.disk) {
+			return fmt.Errorf("identity: switch to %s: %s is still in place", to, s.disk)
+		}
+		if err := os.Rename(incoming, s.disk); err != nil {
+			return fmt.Errorf("identity: activate %s: %w", to, err)
+		}
+	}
+	if err := writeFile(filepath.Join(s.dir, activeFile), to+"\n"); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, switchFile)); err != nil {
+		return fmt.Errorf("identity: %w", err)
+	}
+	return nil
+}
+
+// recover finishes a switch that was interrupted.
+func (s *Store) recover() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, switchFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("identity: %w", err)
+	}
+	from, to, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+	if ValidateName(from) != nil || ValidateName(to) != nil {
+		return fmt.Errorf("identity: %s is damaged; remove it after checking which disk is %s", filepath.Join(s.dir, switchFile), s.disk)
+	}
+	return s.finishSwitch(from, to)
+}
+
+// Delete wipes an inactive identity's state disk, as vm.WipeStateDisk
+// does, discarding its guards and keys for good.
+func (s *Store) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	active, err := s.Active()
+	if err != nil {
+		return err
+	}
+	if name == active {
+		return ErrActive
+	}
+	path := s.diskFile(name)
+	if !exists(path) {
+		return fmt.Errorf("identity: no identity %q", name)
+	}
+	if err := vm.WipeStateDisk(path); err != nil {
+		return fmt.Errorf("identity %s: %w", name, err)
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// writeFile replaces the file at path with content, by renaming a
+// complete copy into place.
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("identity: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0600); err != nil {
+		return fmt.Errorf("identity: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("identity: %w", err)
+	}
+	return nil
+}
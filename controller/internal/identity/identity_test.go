@@ -0,0 +1,128 @@
+package identity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newStore returns a store for a state disk holding marker.
+func newStore(t *testing.T, marker string) *Store {
+	t.Helper()
+	disk := filepath.Join(t.TempDir(), "state.img")
+	if err := os.WriteFile(disk, []byte(marker), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return Open(disk)
+}
+
+func names(t *testing.T, s *Store) []string {
+	t.Helper()
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, id := range list {
+		out = append(out, id.Name)
+	}
+	return out
+}
+
+func TestCreateSwitchDelete(t *testing.T) {
+	s := newStore(t, "browsing")
+	if active, err := s.Active(); err != nil || active != DefaultName {
+		t.Fatalf("Active = %q, %v", active, err)
+	}
+	if err := s.Create("publishing", 16<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Create("publishing", 16<<20); err == nil {
+		t.Error("second Create succeeded")
+	}
+	if err := s.Create("default", 16<<20); err == nil {
+		t.Error("Create of the active identity succeeded")
+	}
+	if got := names(t, s); len(got) != 2 || got[0] != "default" || got[1] != "publishing" {
+		t.Errorf("List = %q", got)
+	}
+
+	if err := s.Switch("publishing"); err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := s.Active(); active != "publishing" {
+		t.Errorf("Active after Switch = %q", active)
+	}
+	if data, _ := os.ReadFile(s.diskFile("default")); string(data) != "browsing" {
+		t.Errorf("default's disk holds %q", data)
+	}
+	if fi, err := os.Stat(s.disk); err != nil || fi.Size() != 16<<20 {
+		t.Errorf("state disk after Switch: %v, %v", fi, err)
+	}
+	if got := names(t, s); len(got) != 2 || got[0] != "publishing" || got[1] != "default" {
+		t.Errorf("List = %q", got)
+	}
+
+	if err := s.Delete("publishing"); !errors.Is(err, ErrActive) {
+		t.Errorf("Delete of the active identity: err = %v, want ErrActive", err)
+	}
+	if err := s.Switch("default"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(s.disk); string(data) != "browsing" {
+		t.Errorf("state disk after switching back holds %q", data)
+	}
+	if err := s.Delete("publishing"); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, s); len(got) != 1 {
+		t.Errorf("List after Delete = %q", got)
+	}
+	if err := s.Switch("nobody"); err == nil {
+		t.Error("Switch to a missing identity succeeded")
+	}
+}
+
+// TestInterruptedSwitch checks that a switch cut short after each step
+// is finished by the next call.
+func TestInterruptedSwitch(t *testing.T) {
+	for step := 0; step < 3; step++ {
+		s := newStore(t, "old")
+		os.MkdirAll(s.dir, 0700)
+		os.WriteFile(s.diskFile("new"), []byte("new"), 0600)
+		os.WriteFile(filepath.Join(s.dir, switchFile), []byte("default\nnew\n"), 0600)
+		if step >= 1 {
+			os.Rename(s.disk, s.diskFile("default"))
+		}
+		if step >= 2 {
+			os.Rename(s.diskFile("new"), s.disk)
+		}
+
+		if active, err := s.Active(); err != nil || active != "new" {
+			t.Errorf("step %d: Active = %q, %v", step, active, err)
+		}
+		if data, _ := os.ReadFile(s.disk); string(data) != "new" {
+			t.Errorf("step %d: state disk holds %q", step, data)
+		}
+		if data, _ := os.ReadFile(s.diskFile("default")); string(data) != "old" {
+			t.Errorf("step %d: default's disk holds %q", step, data)
+		}
+		if exists(filepath.Join(s.dir, switchFile)) {
+			t.Errorf("step %d: switch record left behind", step)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"default", "publishing", "work-2", "a_b"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Work", "../x", "a/b", "-x", "active.img", "x y"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) succeeded", name)
+		}
+	}
+}
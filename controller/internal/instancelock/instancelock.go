@@ -0,0 +1,190 @@
+// Package instancelock keeps two controllers from driving the same
+// instance, TAP device, or state disk at once, where they would fight
+// over the host routes and corrupt the disk. A controller takes an
+// exclusive lock on a file for each of them in the state directory. The
+// operating system drops the locks when the process exits, so a crashed
+// controller never leaves a stale one behind.
+package instancelock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// errLocked is returned by tryLock when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// Owner identifies the controller holding a lock. It is written into the
+// lock files for the error a second controller reports.
+type Owner struct {
+	PID      int       `json:"pid"`
+	Config   string    `json:"config,omitempty"` // config file path
+	Instance string    `json:"instance"`
+	Started  time.Time `json:"started"`
+}
+
+// HeldError is returned by Acquire when another controller holds one of
+// the locks.
+type HeldError struct {
+	Resource string // what is locked, e.g. `TAP device "tap0"`
+	Owner    *Owner // nil if the lock file could not be read
+}
+
+func (e *HeldError) Error() string {
+	if e.Owner == nil || e.Owner.PID == 0 {
+		return fmt.Sprintf("%s is in use by another controller", e.Resource)
+	}
+	msg := fmt.Sprintf("%s is in use by another controller (pid %d, instance %q", e.Resource, e.Owner.PID, e.Owner.Instance)
+	if e.Owner.Config != "" {
+		msg += ", config " + e.Owner.Config
+	}
+	return msg + ")"
+}
+
+// resource is one thing to lock.
+type resource struct {
+	file string // lock file name
+	desc string
+}
+
+// resources lists what a controller running cfg must have to itself.
+func resources(cfg *config.Config) []resource {
+	return []resource{
+		{"instance-" + cfg.Instance + ".lock", fmt.Sprintf("instance %q", cfg.Instance)},
+		{"tap-" + cfg.TAPName + ".lock", fmt.Sprintf("TAP device %q", cfg.TAPName)},
+		{"disk-" + diskKey(cfg.StateDiskPath) + ".lock", fmt.Sprintf("state disk %s", cfg.StateDiskPath)},
+	}
+}
+
+// diskKey names the lock of the state disk at path, the same for every
+// path that leads to the file.
+func diskKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Lock is the set of locks a controller holds.
+type Lock struct {
+	files   []*os.File
+	pidFile string
+}
+
+// Acquire locks cfg's instance, TAP device, and state disk in dir and
+// writes owner into each lock file. It also writes a PID file named after
+// the instance, for service managers and scripts. It returns a
+// *HeldError if another controller holds any of the locks.
+func Acquire(dir string, cfg *config.Config, owner Owner) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("instance lock: %w", err)
+	}
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return nil, err
+	}
+	l := &Lock{}
+	for _, r := range resources(cfg) {
+		f, err := lockFile(filepath.Join(dir, r.file), data)
+		if errors.Is(err, errLocked) {
+			l.Release()
+			return nil, &HeldError{Resource: r.desc, Owner: readOwner(filepath.Join(dir, r.file))}
+		}
+		if err != nil {
+			l.Release()
+			return nil, fmt.Errorf("instance lock: %w", err)
+		}
+		l.files = append(l.files, f)
+	}
+	l.pidFile = filepath.Join(dir, "torvm-"+cfg.Instance+".pid")
+	if err := os.WriteFile(l.pidFile, []byte(strconv.Itoa(owner.PID)+"\n"), 0644); err != nil {
+		l.Release()
+		return nil, fmt.Errorf("instance lock: write PID file: %w", err)
+	}
+	return l, nil
+}
+
+// lockFile opens and locks the file at path and replaces its contents
+// with data.
+func lockFile(path string, data []byte) (*os.File, error) {
+	var f *os.File
+	for {
+		var err error
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := tryLock(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		// A controller releasing the lock removes the file before it
+		// unlocks it. If that happened between the open and the lock,
+		// this is the removed file, and locking it would not keep out a
+		// controller that creates a new one: start over.
+		if fi, err := f.Stat(); err == nil {
+			if pi, err := os.Stat(path); err == nil && os.SameFile(fi, pi) {
+				break
+			}
+		}
+		f.Close()
+	}
+	err := f.Truncate(0)
+	if err == nil {
+		_, err = f.WriteAt(data, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// readOwner reads the owner recorded in the lock file at path.
+func readOwner(path string) *Owner {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, 4096))
+	if err != nil {
+		return nil
+	}
+	var o Owner
+	if json.Unmarshal(data, &o) != nil {
+		return nil
+	}
+	return &o
+}
+
+// Release removes the PID file and lock files and drops the locks. It is
+// safe on a nil Lock.
+func (l *Lock) Release() {
+	if l == nil {
+		return
+	}
+	if l.pidFile != "" {
+		os.Remove(l.pidFile)
+	}
+	for _, f := range l.files {
+		// Removed before it is unlocked; see lockFile.
+		os.Remove(f.Name())
+		f.Close()
+	}
+	l.files, l.pidFile = nil, ""
+}
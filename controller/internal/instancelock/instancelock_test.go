@@ -0,0 +1,64 @@
+package instancelock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+func TestAcquireExcludesSecondController(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.StateDiskPath = filepath.Join(dir, "state.img")
+	owner := Owner{PID: 4242, Config: "/etc/torvm/a.json", Instance: cfg.Instance, Started: time.Now()}
+
+	l, err := Acquire(dir, cfg, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := os.ReadFile(filepath.Join(dir, "torvm-"+cfg.Instance+".pid"))
+	if err != nil || string(pid) != "4242\n" {
+		t.Errorf("PID file = %q, %v", pid, err)
+	}
+
+	// Another instance name, but the same TAP device.
+	other := *cfg
+	other.Instance = "second"
+	_, err = Acquire(dir, &other, Owner{PID: 1, Instance: other.Instance})
+	var held *HeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("second Acquire: err = %v, want *HeldError", err)
+	}
+	if held.Owner == nil || held.Owner.PID != 4242 || !strings.Contains(err.Error(), "TAP device") {
+		t.Errorf("second Acquire: err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "instance-second.lock")); err == nil {
+		t.Error("failed Acquire left its instance lock file behind")
+	}
+
+	// The same disk reached through a symlink.
+	other.TAPName = "tap9"
+	link := filepath.Join(dir, "link.img")
+	os.WriteFile(cfg.StateDiskPath, nil, 0600)
+	if err := os.Symlink(cfg.StateDiskPath, link); err == nil {
+		other.StateDiskPath = link
+		if _, err := Acquire(dir, &other, Owner{PID: 1}); !errors.As(err, &held) || !strings.Contains(err.Error(), "state disk") {
+			t.Errorf("Acquire of the same disk by symlink: err = %v", err)
+		}
+	}
+
+	l.Release()
+	if _, err := os.Stat(filepath.Join(dir, "torvm-"+cfg.Instance+".pid")); !os.IsNotExist(err) {
+		t.Error("Release left the PID file")
+	}
+	l, err = Acquire(dir, &other, Owner{PID: 2})
+	if err != nil {
+		t.Fatalf("Acquire after Release: %v", err)
+	}
+	l.Release()
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package instancelock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockOffset is where the locked byte range starts. Windows locks are
+// mandatory, so the range lies past the owner record, which a second
+// controller must still be able to read.
+const lockOffset = 1 << 30
+
+// tryLock takes an exclusive lock on f without waiting.
+func tryLock(f *os.File) error {
+	ol := &windows.Overlapped{Offset: lockOffset}
+	err := windows.LockFileEx(windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+	return err
+}
@@ -0,0 +1,216 @@
+// Package journal persists controller events (state transitions, bootstrap
+// progress, errors) to a bounded append-only file so they can be queried
+// after the fact by time range.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event kinds recorded by the controller.
+const (
+	KindState     = "state"
+	KindBootstrap = "bootstrap"
+	KindError     = "error"
+	KindSecurity  = "security"
+	KindSession   = "session"
+)
+
+// Event is a single journal entry.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Message string    `json:"message"`
+}
+
+// String formats the event as a single human-readable line.
+func (e Event) String() string {
+	return fmt.Sprintf("%s  %-9s  %s", e.Time.Local().Format("2006-01-02 15:04:05"), e.Kind, e.Message)
+}
+
+// Journal is an append-only JSON-lines event file. When the file grows past
+// its size limit it is rotated to "<path>.1", replacing any previous
+// rotation, so disk use is bounded to roughly twice the limit.
+type Journal struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	f        *os.File
+	size     int64
+	onEvent  func(Event)
+}
+
+// Open opens (creating if needed) the journal at path with the given
+// size limit in bytes.
+func Open(path string, maxBytes int64) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat journal: %w", err)
+	}
+	return &Journal{
+		path:     path,
+		maxBytes: maxBytes,
+		f:        f,
+		size:     fi.Size(),
+	}, nil
+}
+
+// Record appends an event stamped with the current time.
+func (j *Journal) Record(kind, format string, args ...any) {
+	j.Append(Event{Time: time.Now().UTC(), Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// Append writes ev to the journal, rotating first if the size limit has
+// been reached. Write errors are dropped: the journal is diagnostic and
+// must never interfere with the lifecycle.
+func (j *Journal) Append(ev Event) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+
+	j.mu.Lock()
+	if j.f == nil {
+		j.mu.Unlock()
+		return
+	}
+	if j.maxBytes > 0 && j.size+int64(len(data)) > j.maxBytes {
+		j.rotate()
+	}
+	if n, err := j.f.Write(data); err == nil {
+		j.size += int64(n)
+	}
+	cb := j.onEvent
+	j.mu.Unlock()
+
+	if cb != nil {
+		cb(ev)
+	}
+}
+
+// rotate moves the current file to "<path>.1" and starts a new one.
+// Caller must hold j.mu.
+func (j *Journal) rotate() {
+	j.f.Close()
+	os.Rename(j.path, j.path+".1")
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		j.f = nil
+		return
+	}
+	j.f = f
+	j.size = 0
+}
+
+// OnEvent sets a callback invoked after each appended event.
+func (j *Journal) OnEvent(fn func(Event)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.onEvent = fn
+}
+
+// Query returns the events in this journal between since and until
+// (inclusive). A zero until means "now".
+func (j *Journal) Query(since, until time.Time) ([]Event, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return Query(j.path, since, until)
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Query reads the journal at path (including its rotated predecessor) and
+// returns events between since and until, oldest first. A zero until means
+// no upper bound. It does not require the journal to be open, so the CLI
+// can inspect the journal of a running instance.
+func Query(path string, since, until time.Time) ([]Event, error) {
+	var events []Event
+	for _, p := range []string{path + ".1", path} {
+		evs, err := readFile(p, since, until)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, evs...)
+	}
+	sort.SliceStable(events, func(a, b int) bool {
+		return events[a].Time.Before(events[b].Time)
+	})
+	return events, nil
+}
+
+func readFile(path string, since, until time.Time) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var ev Event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			// Skip a torn final line from an unclean shutdown.
+			continue
+		}
+		if ev.Time.Before(since) {
+			continue
+		}
+		if !until.IsZero() && ev.Time.After(until) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return events, nil
+}
+
+// LogWriter returns an io.Writer suitable for logging.Logger.AddWriter that
+// records ERROR-level log lines as KindError events.
+func (j *Journal) LogWriter() *LogWriter {
+	return &LogWriter{j: j}
+}
+
+// LogWriter forwards ERROR log lines to a journal.
+type LogWriter struct {
+	j *Journal
+}
+
+// Write implements io.Writer. Each call is one formatted log line of the
+// form "[<time> UTC] LEVEL: message".
+func (w *LogWriter) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	if idx := strings.Index(line, "] ERROR: "); idx >= 0 {
+		w.j.Record(KindError, "%s", line[idx+len("] ERROR: "):])
+	}
+	return len(p), nil
+}
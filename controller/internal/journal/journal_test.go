@@ -0,0 +1,91 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalQueryTimeRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	base := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		j.Append(Event{Time: base.Add(time.Duration(i) * time.Hour), Kind: KindState, Message: fmt.Sprintf("ev%d", i)})
+	}
+
+	got, err := j.Query(base.Add(time.Hour), base.Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Message != "ev1" || got[2].Message != "ev3" {
+		t.Errorf("Query = %v, want ev1..ev3", got)
+	}
+
+	got, err = Query(path, base.Add(4*time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Message != "ev4" {
+		t.Errorf("Query open-ended = %v, want [ev4]", got)
+	}
+}
+
+func TestJournalRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j, err := Open(path, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	for i := 0; i < 50; i++ {
+		j.Record(KindBootstrap, "progress %d", i)
+	}
+
+	for _, p := range []string{path, path + ".1"} {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("stat %s: %v", p, err)
+		}
+		if fi.Size() > 512 {
+			t.Errorf("%s size %d exceeds limit", p, fi.Size())
+		}
+	}
+
+	got, err := Query(path, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[len(got)-1].Message != "progress 49" {
+		t.Errorf("expected newest event retained, got %v", got)
+	}
+}
+
+func TestLogWriterRecordsErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	j, err := Open(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	w := j.LogWriter()
+	fmt.Fprint(w, "[2026/01/02 03:04:05.000 UTC] INFO: starting\n")
+	fmt.Fprint(w, "[2026/01/02 03:04:06.000 UTC] ERROR: failsafe: ACTIVATING\n")
+
+	got, err := j.Query(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Kind != KindError || got[0].Message != "failsafe: ACTIVATING" {
+		t.Errorf("LogWriter recorded %v", got)
+	}
+}
@@ -6,23 +6,16 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
 	"strings"
-)
 
-// safeValueRe matches values safe for interpolation into shell commands
-// passed through osascript. Only allows alphanumeric, forward slash, dot,
-// underscore, hyphen, and space.
-var safeValueRe = regexp.MustCompile(`^[a-zA-Z0-9/._\- ]+$`)
-
-const (
-	serviceLabel = "org.torproject.torvm"
-	plistPath    = "/Library/LaunchDaemons/org.torproject.torvm.plist"
-	logDir       = "/var/log/torvm"
-	logPath      = "/var/log/torvm/torvm.log"
-	binaryPath   = "/usr/local/bin/torvm"
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/servicefile"
 )
 
+const plistPath = "/Library/LaunchDaemons/org.torproject.torvm.plist"
+
 // Status describes the current state of the launchd service.
 type Status struct {
 	Installed  bool
@@ -68,9 +61,28 @@ func QueryStatus() *Status {
 	return st
 }
 
-// Install generates the plist and writes it to /Library/LaunchDaemons/ via privilege escalation.
-func Install(runAtLoad bool) error {
-	plist := generatePlist(runAtLoad)
+// Install generates the plist with the overrides in svc, checks it with
+// plutil, and copies it to /Library/LaunchDaemons/ and loads it via
+// privilege escalation, asking for the password once. The service runs
+// this executable where it is installed, such as under /opt/homebrew,
+// with the config file at configPath if it is not empty, and logs to
+// svc.LogPath or DefaultLogPath. Re-install after moving either.
+func Install(svc config.ServiceConfig, configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("launchd: %w", err)
+	}
+	spec, err := serviceSpec(svc, exe, configPath)
+	if err != nil {
+		return err
+	}
+	plist, err := servicefile.Plist(spec)
+	if err != nil {
+		return err
+	}
+	if err := servicefile.ValidatePlist(plist); err != nil {
+		return err
+	}
 
 	// Use a temporary file to stage the plist content.
 	tmp, err := os.CreateTemp("", "torvm-plist-*.plist")
@@ -86,131 +98,51 @@ func Install(runAtLoad bool) error {
 	}
 	tmp.Close()
 
-	// Validate all interpolated path values before building the command.
-	for _, pair := range []struct{ name, val string }{
-		{"logDir", logDir},
-		{"tmpPath", tmpPath},
-		{"plistPath", plistPath},
-	} {
-		if err := validateShellValue(pair.name, pair.val); err != nil {
-			return err
-		}
-	}
-
-	cmd := fmt.Sprintf(
-		"mkdir -p '%s' && cp '%s' '%s' && chmod 644 '%s' && launchctl load '%s'",
-		logDir, tmpPath, plistPath, plistPath, plistPath,
+	return privexec.RunAll(
+		privexec.Command("mkdir", "-p", filepath.Dir(spec.LogPath)),
+		privexec.Command("cp", tmpPath, plistPath),
+		privexec.Command("chmod", "644", plistPath),
+		privexec.Command("launchctl", "load", plistPath),
 	)
-	return runPrivileged(cmd)
 }
 
 // Uninstall unloads and removes the plist via privilege escalation.
 func Uninstall() error {
-	cmd := fmt.Sprintf(
-		"launchctl unload '%s' 2>/dev/null; rm -f '%s'",
-		plistPath, plistPath,
-	)
-	return runPrivileged(cmd)
+	unload := privexec.Command("launchctl", "unload", plistPath)
+	unload.MayFail = true
+	return privexec.RunAll(unload, privexec.Command("rm", "-f", plistPath))
 }
 
 // Start kicks the service via launchctl.
 func Start() error {
-	return runPrivileged(fmt.Sprintf(
-		"launchctl kickstart -k system/%s",
-		serviceLabel,
-	))
+	return privexec.Run("launchctl", "kickstart", "-k", "system/"+serviceLabel)
 }
 
 // Stop sends SIGTERM to the service via launchctl.
 func Stop() error {
-	return runPrivileged(fmt.Sprintf(
-		"launchctl kill SIGTERM system/%s",
-		serviceLabel,
-	))
+	return privexec.Run("launchctl", "kill", "SIGTERM", "system/"+serviceLabel)
 }
 
 // SetRunAtLoad modifies the RunAtLoad key in the installed plist.
 func SetRunAtLoad(enabled bool) error {
-	cmd := fmt.Sprintf(
-		`/usr/libexec/PlistBuddy -c "Set :RunAtLoad %t" '%s'`,
-		enabled, plistPath,
-	)
-	return runPrivileged(cmd)
+	return privexec.Run("/usr/libexec/PlistBuddy", "-c", fmt.Sprintf("Set :RunAtLoad %t", enabled), plistPath)
+}
+
+// LogPath returns the log file of the installed service, as its plist
+// names it, or DefaultLogPath.
+func LogPath() string {
+	out, err := exec.Command("/usr/libexec/PlistBuddy", "-c", "Print :StandardOutPath", plistPath).Output()
+	if path := strings.TrimSpace(string(out)); err == nil && filepath.IsAbs(path) {
+		return path
+	}
+	return DefaultLogPath
 }
 
 // ReadLog returns the last n lines of the service log.
 func ReadLog(lines int) (string, error) {
-	out, err := exec.Command("tail", "-n", fmt.Sprintf("%d", lines), logPath).Output()
+	out, err := exec.Command("tail", "-n", fmt.Sprintf("%d", lines), LogPath()).Output()
 	if err != nil {
 		return "", fmt.Errorf("read log: %w", err)
 	}
 	return string(out), nil
 }
-
-// escapeAppleScript escapes a string for safe embedding in an AppleScript
-// "do shell script" string literal. Backslashes must be escaped first,
-// then double quotes, to prevent injection.
-func escapeAppleScript(s string) string {
-	s = strings.ReplaceAll(s, `\`, `\\`)
-	s = strings.ReplaceAll(s, `"`, `\"`)
-	return s
-}
-
-// validateShellValue ensures a value is safe for interpolation into a shell
-// command executed via osascript privilege escalation.
-func validateShellValue(name, value string) error {
-	if !safeValueRe.MatchString(value) {
-		return fmt.Errorf("%s contains unsafe characters: %q", name, value)
-	}
-	return nil
-}
-
-// runPrivileged executes a shell command with admin privileges via osascript.
-// All interpolated values in the command must have been validated with
-// validateShellValue before being included in the command string.
-func runPrivileged(command string) error {
-	script := fmt.Sprintf(
-		`do shell script "%s" with administrator privileges`,
-		escapeAppleScript(command),
-	)
-	cmd := exec.Command("osascript", "-e", script)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("privileged command failed: %w: %s", err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
-// generatePlist creates the launchd plist XML.
-func generatePlist(runAtLoad bool) string {
-	runAtLoadStr := "false"
-	if runAtLoad {
-		runAtLoadStr = "true"
-	}
-
-	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-<plist version="1.0">
-<dict>
-	<key>Label</key>
-	<string>%s</string>
-	<key>ProgramArguments</key>
-	<array>
-		<string>%s</string>
-		<string>--headless</string>
-	</array>
-	<key>RunAtLoad</key>
-	<%s/>
-	<key>KeepAlive</key>
-	<dict>
-		<key>SuccessfulExit</key>
-		<false/>
-	</dict>
-	<key>StandardOutPath</key>
-	<string>%s</string>
-	<key>StandardErrorPath</key>
-	<string>%s</string>
-</dict>
-</plist>
-`, serviceLabel, binaryPath, runAtLoadStr, logPath, logPath)
-}
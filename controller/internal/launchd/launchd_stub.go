@@ -5,6 +5,8 @@ package launchd
 import (
 	"fmt"
 	"runtime"
+
+	"github.com/user/extorvm/controller/internal/config"
 )
 
 // Status describes the current state of the launchd service.
@@ -25,7 +27,7 @@ func errUnsupported() error {
 func QueryStatus() *Status { return &Status{} }
 
 // Install is not supported on non-macOS platforms.
-func Install(_ bool) error { return errUnsupported() }
+func Install(_ config.ServiceConfig, _ string) error { return errUnsupported() }
 
 // Uninstall is not supported on non-macOS platforms.
 func Uninstall() error { return errUnsupported() }
@@ -39,5 +41,8 @@ func Stop() error { return errUnsupported() }
 // SetRunAtLoad is not supported on non-macOS platforms.
 func SetRunAtLoad(_ bool) error { return errUnsupported() }
 
+// LogPath returns DefaultLogPath on non-macOS platforms.
+func LogPath() string { return DefaultLogPath }
+
 // ReadLog is not supported on non-macOS platforms.
 func ReadLog(_ int) (string, error) { return "", errUnsupported() }
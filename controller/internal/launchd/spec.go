@@ -0,0 +1,51 @@
+package launchd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/servicefile"
+)
+
+const serviceLabel = "org.torproject.torvm"
+
+// DefaultLogPath receives the service's output unless the config's
+// service.log_path names another file.
+const DefaultLogPath = "/var/log/torvm/torvm.log"
+
+// serviceSpec describes the service that runs the controller at program,
+// with the config file at configPath if it is not empty. launchd runs it
+// as root, so program must not be writable by other users.
+func serviceSpec(svc config.ServiceConfig, program, configPath string) (servicefile.Spec, error) {
+	if !filepath.IsAbs(program) {
+		return servicefile.Spec{}, fmt.Errorf("launchd: program path %q is not absolute", program)
+	}
+	fi, err := os.Stat(program)
+	if err != nil {
+		return servicefile.Spec{}, fmt.Errorf("launchd: %w", err)
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return servicefile.Spec{}, fmt.Errorf("launchd: %s is writable by other users; the service would run it as root", program)
+	}
+	args := svc.Args()
+	if configPath != "" {
+		abs, err := filepath.Abs(configPath)
+		if err != nil {
+			return servicefile.Spec{}, fmt.Errorf("launchd: %w", err)
+		}
+		args = append([]string{"--config", abs}, args...)
+	}
+	logPath := svc.LogPath
+	if logPath == "" {
+		logPath = DefaultLogPath
+	}
+	return servicefile.Spec{
+		Label:         serviceLabel,
+		Program:       program,
+		Args:          args,
+		LogPath:       logPath,
+		ServiceConfig: svc,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package launchd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+func TestServiceSpec(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "torvm")
+	if err := os.WriteFile(program, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "torvm.json")
+
+	spec, err := serviceSpec(config.ServiceConfig{}, program, configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Program != program || spec.LogPath != DefaultLogPath {
+		t.Errorf("Program, LogPath = %q, %q", spec.Program, spec.LogPath)
+	}
+	if want := []string{"--config", configPath, "--headless"}; !slices.Equal(spec.Args, want) {
+		t.Errorf("Args = %q, want %q", spec.Args, want)
+	}
+
+	svc := config.ServiceConfig{Backend: true, LogPath: "/opt/homebrew/var/log/torvm.log"}
+	spec, err = serviceSpec(svc, program, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(spec.Args, []string{"--backend"}) || spec.LogPath != svc.LogPath {
+		t.Errorf("Args, LogPath = %q, %q", spec.Args, spec.LogPath)
+	}
+
+	if _, err := serviceSpec(svc, "torvm", ""); err == nil {
+		t.Error("relative program path accepted")
+	}
+	os.Chmod(program, 0777)
+	if _, err := serviceSpec(svc, program, ""); err == nil {
+		t.Error("world-writable program accepted")
+	}
+}
@@ -0,0 +1,170 @@
+// Package leaktest checks, while TorVM runs, that host traffic reaches the
+// internet only through Tor: DNS resolves, the SOCKS port reaches the Tor
+// network, and a direct connection does not get out around Tor.
+package leaktest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Default endpoints. The check API reports whether a request arrived over
+// Tor.
+const (
+	DefaultCanaryHost = "check.torproject.org"
+	DefaultCheckURL   = "https://check.torproject.org/api/ip"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// Options configures Run. Zero fields take the defaults above and a
+// 20-second timeout per check.
+type Options struct {
+	SOCKSAddr  string // host:port of Tor's SOCKS listener in the VM
+	CanaryHost string
+	CheckURL   string
+	Timeout    time.Duration
+}
+
+// checker holds the network clients used by the checks; tests replace
+// them.
+type checker struct {
+	opts   Options
+	lookup func(ctx context.Context, host string) ([]string, error)
+	socks  *http.Client
+	direct *http.Client
+}
+
+func newChecker(opts Options) (*checker, error) {
+	if opts.CanaryHost == "" {
+		opts.CanaryHost = DefaultCanaryHost
+	}
+	if opts.CheckURL == "" {
+		opts.CheckURL = DefaultCheckURL
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	if _, _, err := net.SplitHostPort(opts.SOCKSAddr); err != nil {
+		return nil, fmt.Errorf("invalid SOCKS address %q: %w", opts.SOCKSAddr, err)
+	}
+	proxy := &url.URL{Scheme: "socks5", Host: opts.SOCKSAddr}
+	return &checker{
+		opts:   opts,
+		lookup: net.DefaultResolver.LookupHost,
+		// Without keep-alives every check opens its own connection.
+		socks: &http.Client{Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxy),
+			DisableKeepAlives: true,
+		}},
+		direct: &http.Client{Transport: &http.Transport{DisableKeepAlives: true}},
+	}, nil
+}
+
+// Run performs the checks in order and returns one Result for each. It
+// only fails as a whole if opts is invalid.
+func Run(ctx context.Context, opts Options) ([]Result, error) {
+	c, err := newChecker(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.run(ctx), nil
+}
+
+func (c *checker) run(ctx context.Context) []Result {
+	return []Result{
+		c.checkDNS(ctx),
+		c.checkSOCKS(ctx),
+		c.checkDirect(ctx),
+	}
+}
+
+// checkDNS resolves the canary host with the system resolver, which the
+// host routes to Tor's DNSPort in the VM.
+func (c *checker) checkDNS(ctx context.Context) Result {
+	r := Result{Name: "DNS resolution"}
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	addrs, err := c.lookup(ctx, c.opts.CanaryHost)
+	if err != nil {
+		r.Detail = fmt.Sprintf("resolve %s: %v", c.opts.CanaryHost, err)
+		return r
+	}
+	r.Passed = true
+	r.Detail = fmt.Sprintf("%s resolved to %v", c.opts.CanaryHost, addrs)
+	return r
+}
+
+// checkSOCKS fetches the check URL through the SOCKS port and requires
+// it to report Tor.
+func (c *checker) checkSOCKS(ctx context.Context) Result {
+	r := Result{Name: "Tor via SOCKS"}
+	ip, isTor, err := c.fetch(ctx, c.socks)
+	switch {
+	case err != nil:
+		r.Detail = err.Error()
+	case !isTor:
+		r.Detail = "request arrived from " + ip + ", which is not a Tor exit"
+	default:
+		r.Passed = true
+		r.Detail = "exit " + ip
+	}
+	return r
+}
+
+// checkDirect fetches the check URL without the proxy. The connection
+// must not reach the internet around Tor: it passes if it fails (the VM
+// or the firewall dropped it) or was transparently routed through Tor.
+func (c *checker) checkDirect(ctx context.Context) Result {
+	r := Result{Name: "Direct connection blocked"}
+	ip, isTor, err := c.fetch(ctx, c.direct)
+	switch {
+	case err != nil:
+		r.Passed = true
+		r.Detail = "connection failed: " + err.Error()
+	case isTor:
+		r.Passed = true
+		r.Detail = "connection was routed through Tor (exit " + ip + ")"
+	default:
+		r.Detail = "LEAK: direct connection reached the internet from " + ip
+	}
+	return r
+}
+
+// fetch requests the check URL with client and returns the source
+// address it reports and whether that is a Tor exit.
+func (c *checker) fetch(ctx context.Context, client *http.Client) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.opts.CheckURL, nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("%s: %s", c.opts.CheckURL, resp.Status)
+	}
+	var body struct {
+		IsTor bool   `json:"IsTor"`
+		IP    string `json:"IP"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&body); err != nil {
+		return "", false, fmt.Errorf("%s: decode response: %w", c.opts.CheckURL, err)
+	}
+	return body.IP, body.IsTor, nil
+}
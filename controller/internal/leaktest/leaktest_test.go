@@ -0,0 +1,77 @@
+package leaktest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// checkServer serves a check API response reporting isTor.
+func checkServer(t *testing.T, isTor bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"IsTor":%t,"IP":"203.0.113.7"}`, isTor)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testChecker(t *testing.T, url string) *checker {
+	c, err := newChecker(Options{SOCKSAddr: "10.10.10.1:9050", CheckURL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.lookup = func(context.Context, string) ([]string, error) { return []string{"198.51.100.1"}, nil }
+	c.socks = http.DefaultClient
+	c.direct = http.DefaultClient
+	return c
+}
+
+func TestRunAllPass(t *testing.T) {
+	c := testChecker(t, checkServer(t, true).URL)
+	// The direct connection is routed transparently through Tor.
+	for _, r := range c.run(context.Background()) {
+		if !r.Passed {
+			t.Errorf("%s failed: %s", r.Name, r.Detail)
+		}
+	}
+}
+
+func TestRunDetectsLeak(t *testing.T) {
+	c := testChecker(t, checkServer(t, false).URL)
+	c.lookup = func(context.Context, string) ([]string, error) { return nil, errors.New("no such host") }
+
+	res := c.run(context.Background())
+	if len(res) != 3 {
+		t.Fatalf("got %d results, want 3", len(res))
+	}
+	for _, r := range res {
+		if r.Passed {
+			t.Errorf("%s passed: %s", r.Name, r.Detail)
+		}
+	}
+	if !strings.Contains(res[2].Detail, "LEAK") {
+		t.Errorf("direct check detail = %q", res[2].Detail)
+	}
+}
+
+func TestRunDirectBlocked(t *testing.T) {
+	srv := checkServer(t, true)
+	c := testChecker(t, srv.URL)
+	srv.Close() // direct connections fail
+	if r := c.checkDirect(context.Background()); !r.Passed {
+		t.Errorf("direct check failed although the connection was refused: %s", r.Detail)
+	}
+	if r := c.checkSOCKS(context.Background()); r.Passed {
+		t.Error("SOCKS check passed without a response")
+	}
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	if _, err := Run(context.Background(), Options{SOCKSAddr: "10.10.10.1"}); err == nil {
+		t.Error("Run accepted a SOCKS address without a port")
+	}
+}
@@ -0,0 +1,186 @@
+package lifecycle
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// ConfigAck is what the guest reports having loaded of the torrc overlay,
+// read back from Tor once it runs, so a user who set bridges or a proxy
+// can see that the VM uses them.
+type ConfigAck struct {
+	// Overlay is the checksum of the overlay the guest applied, as
+	// vm.OverlaySum computes it, or "" if it applied none.
+	Overlay string `json:"overlay,omitempty"`
+	// Current reports whether Overlay is the overlay of the engine's
+	// configuration.
+	Current bool `json:"current"`
+	// Firewall is the checksum of the guest firewall policy the guest
+	// applied, or "" if it applied none.
+	Firewall string `json:"firewall,omitempty"`
+
+	BridgesConfigured int      `json:"bridges_configured"`
+	BridgesLoaded     int      `json:"bridges_loaded"`
+	Transports        []string `json:"transports,omitempty"` // with a ClientTransportPlugin, e.g. "obfs4"
+	Proxy             string   `json:"proxy,omitempty"`      // the upstream proxy Tor uses, e.g. "socks5 192.0.2.1:1080"
+
+	// Problems describes each way the guest differs from the
+	// configuration; it is empty when the guest loaded what was set.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// ackOverlayPrefix and ackFirewallPrefix precede, in ContactInfo, the
+// checksums the guest's init records of the torrc overlay and the guest
+// firewall policy it applied. Either may be missing.
+const (
+	ackOverlayPrefix  = "torvm-overlay sha256 "
+	ackFirewallPrefix = "torvm-firewall sha256 "
+)
+
+// ackSum returns the word after prefix in v, or "".
+func ackSum(v, prefix string) string {
+	_, after, ok := strings.Cut(v, prefix)
+	if !ok {
+		return ""
+	}
+	sum, _, _ := strings.Cut(after, " ")
+	return sum
+}
+
+// ackContactInfo returns the ContactInfo that reports overlay as the one
+// applied, in place of the overlay checksum in contact, Tor's current
+// ContactInfo values. The guest firewall checksum is kept.
+func ackContactInfo(contact []string, overlay string) string {
+	var firewall string
+	for _, v := range contact {
+		firewall = ackSum(v, ackFirewallPrefix)
+	}
+	var parts []string
+	if overlay != "" {
+		parts = append(parts, ackOverlayPrefix+vm.OverlaySum(overlay))
+	}
+	if firewall != "" {
+		parts = append(parts, ackFirewallPrefix+firewall)
+	}
+	return strings.Join(parts, " ")
+}
+
+// proxyOptions are Tor's upstream proxy options and the proxy types of
+// config.ProxyConfig they correspond to.
+var proxyOptions = []struct{ option, kind string }{
+	{"HTTPSProxy", "https"},
+	{"HTTPProxy", "http"},
+	{"Socks5Proxy", "socks5"},
+	{"Socks4Proxy", "socks4"},
+}
+
+// confGetter reads Tor's configuration; *tor.ControlClient implements it.
+type confGetter interface {
+	GetConf(keys ...string) (map[string][]string, error)
+}
+
+// readConfigAck asks Tor what it loaded and compares it with cfg.
+func readConfigAck(tc confGetter, cfg *config.Config) (*ConfigAck, error) {
+	keys := []string{"ContactInfo", "UseBridges", "Bridge", "ClientTransportPlugin"}
+	for _, p := range proxyOptions {
+		keys = append(keys, p.option)
+	}
+	conf, err := tc.GetConf(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	ack := &ConfigAck{}
+	for _, v := range conf["ContactInfo"] {
+		ack.Overlay = ackSum(v, ackOverlayPrefix)
+		ack.Firewall = ackSum(v, ackFirewallPrefix)
+	}
+	if v := conf["UseBridges"]; len(v) > 0 && v[0] == "1" {
+		ack.BridgesLoaded = len(conf["Bridge"])
+	}
+	for _, v := range conf["ClientTransportPlugin"] {
+		if names, _, ok := strings.Cut(v, " "); ok {
+			ack.Transports = append(ack.Transports, strings.Split(names, ",")...)
+		}
+	}
+	for _, p := range proxyOptions {
+		if v := conf[p.option]; len(v) > 0 && v[0] != "" {
+			ack.Proxy = p.kind + " " + v[0]
+			break
+		}
+	}
+
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		return nil, err
+	}
+	want := ""
+	if overlay != "" {
+		want = vm.OverlaySum(overlay)
+	}
+	ack.Current = ack.Overlay == want
+	if !ack.Current {
+		ack.Problems = append(ack.Problems, "the VM applied other bridge and proxy settings than the current ones")
+	}
+
+	wantFirewall := ""
+	if rules := cfg.GuestFirewallRules(); rules != "" {
+		wantFirewall = vm.OverlaySum(rules)
+	}
+	if ack.Firewall != wantFirewall {
+		if wantFirewall == "" {
+			ack.Problems = append(ack.Problems, "the VM applied a guest firewall policy, which is not configured")
+		} else {
+			ack.Problems = append(ack.Problems, "the VM did not apply the current guest firewall policy")
+		}
+	}
+
+	if cfg.Bridge.UseBridges {
+		for _, b := range cfg.Bridge.Bridges {
+			if strings.TrimSpace(b) != "" {
+				ack.BridgesConfigured++
+			}
+		}
+	}
+	if ack.BridgesLoaded != ack.BridgesConfigured {
+		ack.Problems = append(ack.Problems, fmt.Sprintf("%d bridges configured but %d loaded", ack.BridgesConfigured, ack.BridgesLoaded))
+	}
+
+	wantProxy := ""
+	if cfg.Proxy.Type != "" && cfg.Proxy.Address != "" {
+		wantProxy = strings.ToLower(cfg.Proxy.Type) + " " + cfg.Proxy.Address
+	}
+	switch {
+	case ack.Proxy == wantProxy:
+	case wantProxy == "":
+		ack.Problems = append(ack.Problems, "Tor uses proxy "+ack.Proxy+", which is not configured")
+	case ack.Proxy == "":
+		ack.Problems = append(ack.Problems, "proxy "+wantProxy+" configured but not loaded")
+	default:
+		ack.Problems = append(ack.Problems, "proxy "+wantProxy+" configured but Tor uses "+ack.Proxy)
+	}
+	return ack, nil
+}
+
+// checkConfigAck reads back what the guest loaded, logs it, and publishes
+// it as EventConfigAck. A mismatch is logged as an error but leaves the VM
+// running: the failsafe keeps traffic on Tor either way.
+func (e *Engine) checkConfigAck() {
+	if e.TorControl == nil {
+		return
+	}
+	ack, err := readConfigAck(e.TorControl, e.Config)
+	if err != nil {
+		e.Logger.Error("config ack: %v", err)
+		return
+	}
+	if len(ack.Problems) > 0 {
+		e.Logger.Error("config ack: %s", strings.Join(ack.Problems, "; "))
+	} else {
+		e.Logger.Info("config ack: guest loaded %d bridges, transports %v, proxy %q", ack.BridgesLoaded, ack.Transports, ack.Proxy)
+	}
+	e.Events.Publish(Event{Kind: EventConfigAck, Ack: ack})
+}
@@ -117,7 +117,7 @@ func (b *BrowserEngine) run(ctx context.Context) error {
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case <-time.After(time.Second):
+			case <-b.TorEngine.clock.After(time.Second):
 			}
 		}
 	}
@@ -173,7 +173,7 @@ func (b *BrowserEngine) handleCompromise(ctx context.Context, ev secwatch.Securi
 	if b.Config.Browser.AutoRemediate {
 		b.Logger.Info("browser: auto-remediating, restarting in 3 seconds")
 		select {
-		case <-time.After(3 * time.Second):
+		case <-b.TorEngine.clock.After(3 * time.Second):
 		case <-ctx.Done():
 			return
 		}
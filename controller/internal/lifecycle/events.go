@@ -0,0 +1,199 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+)
+
+// EventKind identifies what an Event reports.
+type EventKind int
+
+const (
+	EventState     EventKind = iota // a state transition; From and To, Step during startup, and Reason into StateShutdown
+	EventBootstrap                  // Tor bootstrap progress; Progress, Summary and Step
+	EventFailsafe                   // the failsafe engaged or released; Active
+	EventVMExit                     // the VM exited unexpectedly; Err and ExitCode
+	EventNetwork                    // a host network operation; Op and Err
+	EventSession                    // a session shut down cleanly; Report
+	EventSharing                    // the host shares its connection; Summary and Active
+	EventRetry                      // a state failed and is tried again; To, Err, and Step during startup
+	EventConfigAck                  // what the guest loaded of the torrc overlay; Ack
+)
+
+var eventKindNames = [...]string{
+	EventState:     "state",
+	EventBootstrap: "bootstrap",
+	EventFailsafe:  "failsafe",
+	EventVMExit:    "vm_exit",
+	EventNetwork:   "network",
+	EventSession:   "session",
+	EventSharing:   "sharing",
+	EventRetry:     "retry",
+	EventConfigAck: "config_ack",
+}
+
+func (k EventKind) String() string {
+	if int(k) < len(eventKindNames) {
+		return eventKindNames[k]
+	}
+	return "unknown"
+}
+
+// Event is one entry on an engine's event bus. Which fields besides Kind
+// and Time are set depends on Kind.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+
+	From, To State  // EventState; EventRetry: To is the state retried
+	Progress int    // EventBootstrap, 0-100
+	Summary  string // EventBootstrap; EventSharing: the shared interfaces
+	Active   bool   // EventFailsafe: traffic is blocked; EventSharing: shared clients are routed through Tor
+	Op       string // EventNetwork, e.g. "setup routing"
+	Err      error  // EventVMExit; EventNetwork when the operation failed; EventRetry
+	ExitCode int    // EventVMExit: QEMU's exit code, -1 if unknown
+
+	Reason ShutdownReason // EventState into StateShutdown
+
+	Step   *StepProgress  // EventState, EventBootstrap and EventRetry while starting up
+	Report *SessionReport // EventSession
+	Ack    *ConfigAck     // EventConfigAck
+}
+
+// MarshalJSON encodes the event with its kind and states by name and only
+// the fields its kind uses, for JSON log output and APIs.
+func (ev Event) MarshalJSON() ([]byte, error) {
+	v := struct {
+		Kind     string         `json:"kind"`
+		Time     time.Time      `json:"time"`
+		From     string         `json:"from,omitempty"`
+		To       string         `json:"to,omitempty"`
+		Progress *int           `json:"progress,omitempty"`
+		Summary  string         `json:"summary,omitempty"`
+		Active   *bool          `json:"active,omitempty"`
+		Op       string         `json:"op,omitempty"`
+		Error    string         `json:"error,omitempty"`
+		ExitCode *int           `json:"exit_code,omitempty"`
+		Reason   string         `json:"reason,omitempty"`
+		Step     *StepProgress  `json:"step,omitempty"`
+		Report   *SessionReport `json:"report,omitempty"`
+		Ack      *ConfigAck     `json:"ack,omitempty"`
+	}{Kind: ev.Kind.String(), Time: ev.Time, Op: ev.Op, Summary: ev.Summary, Step: ev.Step, Report: ev.Report, Ack: ev.Ack}
+	switch ev.Kind {
+	case EventState:
+		v.From, v.To = ev.From.String(), ev.To.String()
+		if ev.Reason != ShutdownNone {
+			v.Reason = ev.Reason.String()
+		}
+	case EventRetry:
+		v.To = ev.To.String()
+	case EventBootstrap:
+		v.Progress = &ev.Progress
+	case EventFailsafe, EventSharing:
+		v.Active = &ev.Active
+	case EventVMExit:
+		v.ExitCode = &ev.ExitCode
+	}
+	if ev.Err != nil {
+		v.Error = ev.Err.Error()
+	}
+	return json.Marshal(v)
+}
+
+// EventHandler receives the events of an EventBus.
+type EventHandler func(Event)
+
+// eventHistory is how many events an engine's bus keeps.
+const eventHistory = 256
+
+// EventBus delivers an engine's events to its subscribers and keeps the
+// most recent ones, so a subscriber that comes late can catch up.
+//
+// Handlers run synchronously on the publishing goroutine, in the order
+// they subscribed, sometimes with engine locks held: they must return
+// quickly and must not call back into the engine's FailSafe.
+type EventBus struct {
+	mu      sync.Mutex
+	subs    []subscriber
+	nextID  int
+	history []Event
+	limit   int
+}
+
+type subscriber struct {
+	id int
+	fn EventHandler
+}
+
+// NewEventBus returns a bus that keeps the last limit events.
+func NewEventBus(limit int) *EventBus {
+	return &EventBus{limit: limit}
+}
+
+// Subscribe registers fn for all future events. The returned function
+// removes it again.
+func (b *EventBus) Subscribe(fn EventHandler) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextID
+	b.nextID++
+	b.subs = append(b.subs, subscriber{id, fn})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.subs = slices.DeleteFunc(b.subs, func(s subscriber) bool { return s.id == id })
+	}
+}
+
+// History returns the retained events, oldest first.
+func (b *EventBus) History() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.history)
+}
+
+// Publish stamps ev with the current time if unset, records it, and
+// delivers it to the subscribers.
+func (b *EventBus) Publish(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.mu.Lock()
+	if b.limit > 0 {
+		if len(b.history) == b.limit {
+			b.history = slices.Delete(b.history, 0, 1)
+		}
+		b.history = append(b.history, ev)
+	}
+	subs := slices.Clone(b.subs)
+	b.mu.Unlock()
+	for _, s := range subs {
+		s.fn(ev)
+	}
+}
+
+// wireFailsafeEvents publishes the failsafe's activations and releases on
+// the engine's bus.
+func (e *Engine) wireFailsafeEvents() {
+	e.FailSafe.OnActivate(func() { e.Events.Publish(Event{Kind: EventFailsafe, Active: true}) })
+	e.FailSafe.OnDeactivate(func() { e.Events.Publish(Event{Kind: EventFailsafe}) })
+}
+
+// networkOp publishes a host network operation and its outcome.
+func (e *Engine) networkOp(op string, err error) {
+	e.Events.Publish(Event{Kind: EventNetwork, Op: op, Err: err})
+}
+
+// exitCode returns the exit code of the VM process from its Wait error,
+// or -1 when the error does not carry one.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,218 @@
+package lifecycle
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+func TestEventBus(t *testing.T) {
+	b := NewEventBus(3)
+	var got []int
+	unsub := b.Subscribe(func(ev Event) { got = append(got, ev.Progress) })
+	for i := 1; i <= 4; i++ {
+		b.Publish(Event{Kind: EventBootstrap, Progress: i})
+	}
+	unsub()
+	b.Publish(Event{Kind: EventBootstrap, Progress: 5})
+
+	if !slices.Equal(got, []int{1, 2, 3, 4}) {
+		t.Errorf("delivered %v, want 1-4 and nothing after unsubscribing", got)
+	}
+	var hist []int
+	for _, ev := range b.History() {
+		if ev.Time.IsZero() {
+			t.Error("event in history has no time")
+		}
+		hist = append(hist, ev.Progress)
+	}
+	if !slices.Equal(hist, []int{3, 4, 5}) {
+		t.Errorf("history = %v, want the last 3 events", hist)
+	}
+}
+
+func TestEngineEvents(t *testing.T) {
+	e, _, _ := newTestEngine()
+	var kinds []EventKind
+	var exit Event
+	e.Events.Subscribe(func(ev Event) {
+		kinds = append(kinds, ev.Kind)
+		if ev.Kind == EventVMExit {
+			exit = ev
+		}
+	})
+	var legacy int
+	e.OnStateChange(func(from, to State) { legacy++ })
+
+	e.transition(StateRunning)
+	e.vmExited(errors.New("crash"))
+	e.FailSafe.Deactivate()
+
+	want := []EventKind{EventState, EventFailsafe, EventVMExit, EventFailsafe}
+	if !slices.Equal(kinds, want) {
+		t.Errorf("events = %v, want %v", kinds, want)
+	}
+	if legacy != 1 {
+		t.Errorf("OnStateChange observer ran %d times, want 1", legacy)
+	}
+	if exit.ExitCode != -1 || exit.Err == nil {
+		t.Errorf("VM exit event = %+v, want the error with exit code -1", exit)
+	}
+
+	b, err := json.Marshal(exit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	json.Unmarshal(b, &m)
+	if m["kind"] != "vm_exit" || m["error"] != "crash" || m["exit_code"] != -1.0 || m["from"] != nil {
+		t.Errorf("JSON = %s", b)
+	}
+
+	var shutdown Event
+	e.Events.Subscribe(func(ev Event) { shutdown = ev })
+	e.shutdown(ShutdownVMCrash)
+	if shutdown.Kind != EventState || shutdown.To != StateShutdown || shutdown.Reason != ShutdownVMCrash {
+		t.Errorf("shutdown event = %+v, want the transition with reason vm_crash", shutdown)
+	}
+	b, _ = json.Marshal(shutdown)
+	m = nil
+	json.Unmarshal(b, &m)
+	if m["to"] != "Shutdown" || m["reason"] != "vm_crash" {
+		t.Errorf("JSON = %s", b)
+	}
+}
+
+func TestStepProgress(t *testing.T) {
+	e, _, _ := newTestEngine()
+	var steps []*StepProgress
+	e.Events.Subscribe(func(ev Event) { steps = append(steps, ev.Step) })
+
+	e.transition(StateCreateTAP)
+	e.attempts[StateWaitBootstrap] = 2
+	e.transition(StateWaitBootstrap)
+	e.transition(StateRunning)
+
+	create, boot := steps[0], steps[1]
+	if create == nil || create.Step != 3 || create.Steps != len(startupSteps) || create.Description == "" {
+		t.Errorf("CreateTAP progress = %+v", create)
+	}
+	if boot == nil || boot.Percent <= create.Percent || boot.Retries != 2 {
+		t.Errorf("WaitBootstrap progress = %+v", boot)
+	}
+	if steps[2] != nil {
+		t.Errorf("Running has startup progress %+v", steps[2])
+	}
+
+	half := stepProgress(StateWaitBootstrap, 0, 50)
+	done := stepProgress(StateWaitBootstrap, 0, 100)
+	if half.Percent <= boot.Percent || half.Percent >= 100 || done.Percent != 100 {
+		t.Errorf("bootstrap progress: 50%% -> %d, 100%% -> %d", half.Percent, done.Percent)
+	}
+
+	b, err := json.Marshal(Event{Kind: EventRetry, To: StateCreateTAP, Err: errors.New("busy"), Step: create})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	json.Unmarshal(b, &m)
+	if m["kind"] != "retry" || m["to"] != "CreateTAP" || m["step"].(map[string]any)["step"] != 3.0 {
+		t.Errorf("JSON = %s", b)
+	}
+}
+
+type fakeConf map[string][]string
+
+func (f fakeConf) GetConf(keys ...string) (map[string][]string, error) {
+	m := make(map[string][]string, len(keys))
+	for _, k := range keys {
+		m[k] = f[k]
+	}
+	return m, nil
+}
+
+func TestReadConfigAck(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Bridge.UseBridges = true
+	cfg.Bridge.Transport = "obfs4"
+	cfg.Bridge.Bridges = []string{
+		"obfs4 192.0.2.1:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=abc iat-mode=0",
+		"obfs4 192.0.2.2:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=def iat-mode=0",
+	}
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := fakeConf{
+		"ContactInfo":           {ackOverlayPrefix + vm.OverlaySum(overlay)},
+		"UseBridges":            {"1"},
+		"Bridge":                cfg.Bridge.Bridges,
+		"ClientTransportPlugin": {"obfs4 exec /usr/bin/obfs4proxy"},
+	}
+
+	ack, err := readConfigAck(loaded, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ack.Current || ack.BridgesConfigured != 2 || ack.BridgesLoaded != 2 ||
+		!slices.Equal(ack.Transports, []string{"obfs4"}) || ack.Proxy != "" || len(ack.Problems) != 0 {
+		t.Errorf("matching guest: ack = %+v", ack)
+	}
+
+	// A guest still on the previous overlay, with one bridge and a proxy
+	// that has since been removed.
+	stale := fakeConf{
+		"ContactInfo": {ackOverlayPrefix + vm.OverlaySum("UseBridges 1\n")},
+		"UseBridges":  {"1"},
+		"Bridge":      cfg.Bridge.Bridges[:1],
+		"Socks5Proxy": {"192.0.2.9:1080"},
+	}
+	ack, err = readConfigAck(stale, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Current || ack.BridgesLoaded != 1 || ack.Proxy != "socks5 192.0.2.9:1080" || len(ack.Problems) != 3 {
+		t.Errorf("stale guest: ack = %+v", ack)
+	}
+
+	// No overlay configured or applied.
+	ack, err = readConfigAck(fakeConf{}, config.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ack.Current || ack.Overlay != "" || len(ack.Problems) != 0 {
+		t.Errorf("no overlay: ack = %+v", ack)
+	}
+
+	// The guest firewall, alone and after an overlay.
+	fw := config.DefaultConfig()
+	fw.GuestFirewall = true
+	sum := vm.OverlaySum(fw.GuestFirewallRules())
+	ack, err = readConfigAck(fakeConf{"ContactInfo": {ackFirewallPrefix + sum}}, fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Firewall != sum || !ack.Current || len(ack.Problems) != 0 {
+		t.Errorf("guest firewall: ack = %+v", ack)
+	}
+	loaded["ContactInfo"] = []string{ackOverlayPrefix + vm.OverlaySum(overlay) + " " + ackFirewallPrefix + sum}
+	cfg.GuestFirewall = true
+	ack, err = readConfigAck(loaded, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.Firewall != sum || !ack.Current || len(ack.Problems) != 0 {
+		t.Errorf("overlay and guest firewall: ack = %+v", ack)
+	}
+	ack, err = readConfigAck(fakeConf{}, fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack.Problems) != 1 || ack.Problems[0] != "the VM did not apply the current guest firewall policy" {
+		t.Errorf("guest without the firewall: ack = %+v", ack)
+	}
+}
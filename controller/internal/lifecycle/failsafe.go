@@ -1,6 +1,9 @@
 package lifecycle
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"sync"
 
 	"github.com/user/extorvm/controller/internal/logging"
@@ -13,8 +16,13 @@ type FailSafe struct {
 	netMgr network.Manager
 	logger *logging.Logger
 
-	mu     sync.Mutex
-	active bool
+	mu         sync.Mutex
+	active     bool
+	armed      bool // persistent kill switch installed
+	held       bool // emergency stop: keep the rules past the session
+	onActivate []func()
+	onRelease  []func()
+	block      network.BlockOptions
 }
 
 // NewFailSafe creates a new failsafe controller.
@@ -25,7 +33,26 @@ func NewFailSafe(netMgr network.Manager, logger *logging.Logger) *FailSafe {
 	}
 }
 
-// Activate enables the failsafe, tearing down routing to block traffic.
+// SetLink records the TAP adapter and subnet that stay reachable while
+// the failsafe is active, so the host can still talk to a restarted VM.
+func (f *FailSafe) SetLink(tapName string, subnet *net.IPNet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.block.TAPName = tapName
+	f.block.Subnet = subnet
+}
+
+// SetLAN records LAN ranges that stay reachable while the failsafe is
+// active. They already bypass Tor (lan.allow), and keeping them open lets
+// alerts reach a local mail or push server.
+func (f *FailSafe) SetLAN(ranges []*net.IPNet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.block.LAN = ranges
+}
+
+// Activate enables the failsafe, installing a drop-all firewall ruleset.
+// Where the platform has none, it falls back to tearing down routing.
 func (f *FailSafe) Activate() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -35,13 +62,42 @@ func (f *FailSafe) Activate() {
 	}
 
 	f.logger.Error("failsafe: ACTIVATING - blocking all network traffic")
-	if err := f.netMgr.TeardownRouting(); err != nil {
-		f.logger.Error("failsafe: teardown routing: %v", err)
+	err := f.netMgr.BlockTraffic(f.block)
+	switch {
+	case errors.Is(err, network.ErrBlockUnsupported):
+		if err := f.netMgr.TeardownRouting(); err != nil {
+			f.logger.Error("failsafe: teardown routing: %v", err)
+		}
+	case err != nil:
+		// The routes through the dead VM stay in place and still
+		// blackhole most traffic.
+		f.logger.Error("failsafe: %v", err)
 	}
 	f.active = true
+	for _, fn := range f.onActivate {
+		fn()
+	}
+}
+
+// OnActivate registers a callback invoked each time the failsafe engages.
+// Callbacks run with the failsafe lock held and must not call back into it.
+func (f *FailSafe) OnActivate(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onActivate = append(f.onActivate, fn)
 }
 
-// Deactivate disables the failsafe.
+// OnDeactivate registers a callback invoked each time the failsafe stops
+// blocking traffic, on Deactivate or Release. Callbacks run with the
+// failsafe lock held and must not call back into it.
+func (f *FailSafe) OnDeactivate(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.onRelease = append(f.onRelease, fn)
+}
+
+// Deactivate disables the failsafe. With the kill switch armed, the kill
+// switch ruleset replaces the failsafe one instead of being removed.
 func (f *FailSafe) Deactivate() {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -51,7 +107,97 @@ func (f *FailSafe) Deactivate() {
 	}
 
 	f.logger.Info("failsafe: deactivating")
+	f.held = false
+	var err error
+	if f.armed {
+		opts := f.block
+		opts.KillSwitch = true
+		err = f.netMgr.BlockTraffic(opts)
+	} else {
+		err = f.netMgr.UnblockTraffic()
+	}
+	if err != nil {
+		f.logger.Error("failsafe: %v", err)
+	}
+	f.active = false
+	for _, fn := range f.onRelease {
+		fn()
+	}
+}
+
+// Arm installs the persistent kill switch: a ruleset that lets host
+// traffic out only through the VM and, being kernel state, outlives a
+// crash of the controller or QEMU. It stays until Release.
+func (f *FailSafe) Arm() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	opts := f.block
+	opts.KillSwitch = true
+	if err := f.netMgr.BlockTraffic(opts); err != nil {
+		return fmt.Errorf("install kill switch: %w", err)
+	}
+	f.armed = true
 	f.active = false
+	f.logger.Info("kill switch: armed, host traffic can only leave through the VM")
+	return nil
+}
+
+// Hold activates the failsafe for an emergency stop and keeps its rules
+// past the end of the session, as after a failure with the kill switch
+// armed.
+func (f *FailSafe) Hold() {
+	f.Activate()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.held = true
+}
+
+// Release removes the failsafe and kill switch rules at the end of a
+// session and reports whether it kept them instead. If the kill switch was
+// armed and the failsafe engaged, or after an emergency stop, the session
+// did not end cleanly and the rules stay: only an explicit purge or the
+// next session removes them.
+func (f *FailSafe) Release() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if (f.armed || f.held) && f.active {
+		if f.held {
+			f.logger.Error("emergency stop: host traffic stays blocked until the next session or \"torvm purge-host-artifacts\"")
+		} else {
+			f.logger.Error("kill switch: session ended after a failure; host traffic stays blocked until the next clean shutdown or \"torvm purge-host-artifacts\"")
+		}
+		f.armed = false
+		f.held = false
+		return true
+	}
+	if !f.active && !f.armed {
+		return false
+	}
+	f.logger.Info("failsafe: removing firewall rules")
+	if err := f.netMgr.UnblockTraffic(); err != nil {
+		f.logger.Error("failsafe: %v", err)
+	}
+	wasActive := f.active
+	f.active = false
+	f.armed = false
+	if wasActive {
+		for _, fn := range f.onRelease {
+			fn()
+		}
+	}
+	return false
+}
+
+// Reset forgets rules kept by Release once crash recovery has removed
+// them (or, with the kill switch, before the new session re-arms).
+func (f *FailSafe) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active = false
+	f.armed = false
+	f.held = false
 }
 
 // IsActive reports whether the failsafe is currently engaged.
@@ -60,3 +206,10 @@ func (f *FailSafe) IsActive() bool {
 	defer f.mu.Unlock()
 	return f.active
 }
+
+// IsHeld reports whether an emergency stop holds the failsafe.
+func (f *FailSafe) IsHeld() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.held
+}
@@ -1,9 +1,11 @@
 package lifecycle
 
 import (
+	"fmt"
 	"sync"
 	"testing"
 
+	"github.com/user/extorvm/controller/internal/network"
 	"github.com/user/extorvm/controller/internal/testutil"
 )
 
@@ -17,6 +19,26 @@ func TestFailSafeActivate(t *testing.T) {
 		t.Error("failsafe should be active")
 	}
 
+	net.mu.Lock()
+	blocks, teardowns := net.blockCount, net.teardownCount
+	net.mu.Unlock()
+	if blocks != 1 {
+		t.Errorf("BlockTraffic called %d times, want 1", blocks)
+	}
+	// Routes through the dead VM blackhole traffic; removing them would
+	// expose the original default route.
+	if teardowns != 0 {
+		t.Errorf("TeardownRouting called %d times, want 0", teardowns)
+	}
+}
+
+func TestFailSafeActivateUnsupportedFallsBack(t *testing.T) {
+	net := &mockNetwork{blockErr: fmt.Errorf("wrapped: %w", network.ErrBlockUnsupported)}
+	logger, _ := testutil.NewTestLogger()
+	fs := NewFailSafe(net, logger)
+
+	fs.Activate()
+
 	net.mu.Lock()
 	teardowns := net.teardownCount
 	net.mu.Unlock()
@@ -25,6 +47,23 @@ func TestFailSafeActivate(t *testing.T) {
 	}
 }
 
+func TestFailSafeActivateBlockError(t *testing.T) {
+	net := &mockNetwork{blockErr: fmt.Errorf("nft: not found")}
+	logger, _ := testutil.NewTestLogger()
+	fs := NewFailSafe(net, logger)
+
+	fs.Activate()
+	if !fs.IsActive() {
+		t.Error("failsafe should be active even if the ruleset failed")
+	}
+	net.mu.Lock()
+	teardowns := net.teardownCount
+	net.mu.Unlock()
+	if teardowns != 0 {
+		t.Errorf("TeardownRouting called %d times, want 0", teardowns)
+	}
+}
+
 func TestFailSafeActivateIdempotent(t *testing.T) {
 	net := &mockNetwork{}
 	logger, _ := testutil.NewTestLogger()
@@ -35,10 +74,10 @@ func TestFailSafeActivateIdempotent(t *testing.T) {
 	fs.Activate()
 
 	net.mu.Lock()
-	teardowns := net.teardownCount
+	blocks := net.blockCount
 	net.mu.Unlock()
-	if teardowns != 1 {
-		t.Errorf("TeardownRouting called %d times, want 1 (idempotent)", teardowns)
+	if blocks != 1 {
+		t.Errorf("BlockTraffic called %d times, want 1 (idempotent)", blocks)
 	}
 }
 
@@ -52,6 +91,12 @@ func TestFailSafeDeactivate(t *testing.T) {
 	if fs.IsActive() {
 		t.Error("failsafe should not be active after deactivate")
 	}
+	net.mu.Lock()
+	unblocks := net.unblockCount
+	net.mu.Unlock()
+	if unblocks != 1 {
+		t.Errorf("UnblockTraffic called %d times, want 1", unblocks)
+	}
 }
 
 func TestFailSafeDeactivateIdempotent(t *testing.T) {
@@ -99,3 +144,55 @@ func TestFailSafeConcurrentSafety(t *testing.T) {
 	// Just verifying no race/panic occurred. Final state is non-deterministic.
 	_ = fs.IsActive()
 }
+
+func TestFailSafeKillSwitch(t *testing.T) {
+	net := &mockNetwork{}
+	logger, _ := testutil.NewTestLogger()
+	fs := NewFailSafe(net, logger)
+
+	if err := fs.Arm(); err != nil {
+		t.Fatal(err)
+	}
+	if !net.blockOpts.KillSwitch {
+		t.Error("Arm did not install the kill switch ruleset")
+	}
+
+	// A failure tightens the rules; recovery goes back to the kill
+	// switch instead of removing it.
+	fs.Activate()
+	if net.blockOpts.KillSwitch {
+		t.Error("Activate kept the kill switch exceptions")
+	}
+	fs.Deactivate()
+	if !net.blockOpts.KillSwitch || net.unblockCount != 0 {
+		t.Errorf("Deactivate: kill switch = %v, unblocks = %d; want kill switch restored",
+			net.blockOpts.KillSwitch, net.unblockCount)
+	}
+
+	// A clean session end removes everything.
+	fs.Release()
+	if net.unblockCount != 1 {
+		t.Errorf("UnblockTraffic called %d times after clean release, want 1", net.unblockCount)
+	}
+}
+
+func TestFailSafeKillSwitchSurvivesFailure(t *testing.T) {
+	net := &mockNetwork{}
+	logger, _ := testutil.NewTestLogger()
+	fs := NewFailSafe(net, logger)
+
+	if err := fs.Arm(); err != nil {
+		t.Fatal(err)
+	}
+	fs.Activate()
+	fs.Release()
+	if net.unblockCount != 0 || !fs.IsActive() {
+		t.Errorf("after failed session: unblocks = %d, active = %v; want rules kept", net.unblockCount, fs.IsActive())
+	}
+
+	// Without the kill switch, the next session's release clears them.
+	fs.Release()
+	if net.unblockCount != 1 || fs.IsActive() {
+		t.Errorf("after second release: unblocks = %d, active = %v", net.unblockCount, fs.IsActive())
+	}
+}
@@ -1,18 +1,25 @@
 package lifecycle
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
-	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/user/extorvm/controller/internal/clock"
 	"github.com/user/extorvm/controller/internal/config"
 	"github.com/user/extorvm/controller/internal/logging"
 	"github.com/user/extorvm/controller/internal/network"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/storage"
 	"github.com/user/extorvm/controller/internal/tor"
 	"github.com/user/extorvm/controller/internal/vm"
 )
@@ -28,6 +35,7 @@ const (
 	StateLaunchVM
 	StateWaitTAP
 	StateConfigureTAP
+	StateVerifyRoutes
 	StateFlushDNS
 	StateWaitBootstrap
 	StateRunning
@@ -35,14 +43,15 @@ const (
 	StateRestoreNetwork
 	StateCleanup
 	StateFailed
+	StatePaused // the VM's vCPUs are stopped (Engine.Pause)
 )
 
 func (s State) String() string {
 	names := [...]string{
 		"Init", "CheckPrivileges", "SaveNetwork", "CreateTAP",
-		"LaunchVM", "WaitTAP", "ConfigureTAP", "FlushDNS",
-		"WaitBootstrap", "Running", "Shutdown", "RestoreNetwork",
-		"Cleanup", "Failed",
+		"LaunchVM", "WaitTAP", "ConfigureTAP", "VerifyRoutes",
+		"FlushDNS", "WaitBootstrap", "Running", "Shutdown",
+		"RestoreNetwork", "Cleanup", "Failed", "Paused",
 	}
 	if int(s) < len(names) {
 		return names[s]
@@ -50,6 +59,17 @@ func (s State) String() string {
 	return fmt.Sprintf("State(%d)", s)
 }
 
+// ParseState returns the state String names, for clients of the control
+// API, which reports states by name.
+func ParseState(name string) (State, bool) {
+	for s := StateInit; s <= StatePaused; s++ {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return StateInit, false
+}
+
 // VMController abstracts VM operations so the lifecycle engine can be
 // tested without a real QEMU process.
 type VMController interface {
@@ -57,6 +77,8 @@ type VMController interface {
 	Stop(ctx context.Context) error
 	IsRunning() bool
 	Wait(ctx context.Context) error
+	// Kill terminates the VM immediately, without a guest shutdown.
+	Kill() error
 }
 
 // StateObserver is called when the lifecycle state changes.
@@ -70,6 +92,10 @@ type MetricsRecorder interface {
 // BootstrapObserver is called when bootstrap progress changes.
 type BootstrapObserver func(progress int, summary string)
 
+// VMExitObserver is called when the VM exits while running, without
+// being asked to stop.
+type VMExitObserver func(err error)
+
 // Engine drives the VM lifecycle state machine.
 type Engine struct {
 	Config   *config.Config
@@ -79,22 +105,114 @@ type Engine struct {
 	FailSafe *FailSafe
 	Metrics  MetricsRecorder
 
-	TorControl         *tor.ControlClient
-	bootstrapObservers []BootstrapObserver
+	// Session persists the host network changes of the running session,
+	// so the next start can undo them if the controller crashes; nil
+	// disables crash recovery.
+	Session *network.SessionStore
+
+	// Restart relaunches the VM when it crashes while running, instead
+	// of ending the session.
+	Restart RestartPolicy
+
+	// Events carries the engine's state changes, bootstrap progress,
+	// failsafe changes, VM exits, and host network operations.
+	Events *EventBus
+
+	TorControl *tor.ControlClient
 
 	state       State
 	savedNet    *network.SavedConfig
-	observerMu  sync.Mutex // guards observers and bootstrapObservers
-	observers   []StateObserver
+	session     *network.Session
 	retryPolicy map[State]*RetryPolicy
 	attempts    map[State]int
+
+	// checkAccess checks that the run can change the host network, as
+	// root or through a helper such as torvm-nethelper; replaceable in
+	// tests.
+	checkAccess func() error
+
+	// hostNetworks lists host IPv4 networks for subnet conflict
+	// detection; replaceable in tests.
+	hostNetworks func(excludeIface string) ([]*net.IPNet, error)
+
+	// verifyRoutes checks the effective host routes after ConfigureTAP;
+	// replaceable in tests.
+	verifyRoutes func(tapName string, hostIP, vmIP net.IP) error
+
+	// tapPresent reports whether the TAP device exists; doRunning polls
+	// it to recover a TAP deleted behind its back. Replaceable in tests.
+	tapPresent func(name string) bool
+
+	// hostFingerprint summarizes the host interfaces; doRunning polls it
+	// to re-apply routing after a network change. Replaceable in tests.
+	hostFingerprint func(excludeIface string) (string, error)
+
+	// detectSharing lists the interfaces the host shares its connection
+	// to; replaceable in tests. shared holds what checkSharing found.
+	detectSharing func() ([]network.SharedInterface, error)
+	shared        []network.SharedInterface
+
+	// restartCh carries maintenance restart requests to doRunning. routed
+	// records that host routing is in place so a relaunched VM reuses it.
+	restartCh chan func()
+	routed    bool
+
+	// pauseCh and resumeCh carry Pause and Resume requests to doRunning
+	// and doPaused, which reply on the enclosed channel. paused records
+	// that the guest's vCPUs are stopped.
+	pauseCh  chan chan error
+	resumeCh chan chan error
+	paused   bool
+
+	// runningSince is when the VM last reached StateRunning;
+	// crashRestarts counts crash restarts since it last ran stably, and
+	// launchDelay is the backoff doLaunchVM waits out before the next.
+	runningSince  time.Time
+	crashRestarts int
+	launchDelay   time.Duration
+
+	// clock times the retry and restart delays, the TAP and bootstrap
+	// waits, and doRunning's checks; replaceable in tests.
+	clock clock.Clock
+
+	// stats accumulates the session report; torWatchStop stops the Tor
+	// event watcher of the current control connection.
+	stats        sessionStats
+	torWatchStop chan struct{}
+
+	// failure is why the current run shut down on its own, joined with a
+	// failure to restore the host network; Run returns it.
+	failure error
+
+	// active is set while Run executes. stopRun cancels the current run
+	// for Stop; runDone is closed when it returns runErr.
+	active  atomic.Bool
+	runMu   sync.Mutex
+	stopRun context.CancelFunc
+	runDone chan struct{}
+	runErr  error
+
+	// requested is the reason given by StopFor or EmergencyStop, and
+	// reason the one the run shut down for; both under runMu.
+	requested ShutdownReason
+	reason    ShutdownReason
+
+	// applied is a copy of the configuration last reloaded, which
+	// ReloadConfig finds changes against; pending is the one whose
+	// next-start changes wait for the next run. Both under cfgMu.
+	cfgMu   sync.Mutex
+	applied *config.Config
+	pending *config.Config
 }
 
-// OnStateChange registers a callback for state transitions.
+// OnStateChange registers a callback for state transitions. It is a
+// shorthand for subscribing to EventState on Events.
 func (e *Engine) OnStateChange(fn StateObserver) {
-	e.observerMu.Lock()
-	defer e.observerMu.Unlock()
-	e.observers = append(e.observers, fn)
+	e.Events.Subscribe(func(ev Event) {
+		if ev.Kind == EventState {
+			fn(ev.From, ev.To)
+		}
+	})
 }
 
 // State returns the current lifecycle state.
@@ -102,9 +220,20 @@ func (e *Engine) State() State { return e.state }
 
 // OnBootstrapProgress registers a callback for bootstrap progress updates.
 func (e *Engine) OnBootstrapProgress(fn BootstrapObserver) {
-	e.observerMu.Lock()
-	defer e.observerMu.Unlock()
-	e.bootstrapObservers = append(e.bootstrapObservers, fn)
+	e.Events.Subscribe(func(ev Event) {
+		if ev.Kind == EventBootstrap {
+			fn(ev.Progress, ev.Summary)
+		}
+	})
+}
+
+// OnVMExit registers a callback for unexpected VM exits.
+func (e *Engine) OnVMExit(fn VMExitObserver) {
+	e.Events.Subscribe(func(ev Event) {
+		if ev.Kind == EventVMExit {
+			fn(ev.Err)
+		}
+	})
 }
 
 // NewIdentity sends a NEWNYM signal via the Tor Control Protocol to
@@ -113,57 +242,148 @@ func (e *Engine) NewIdentity() error {
 	if e.TorControl == nil {
 		return fmt.Errorf("tor control not connected")
 	}
-	return e.TorControl.Signal("NEWNYM")
+	if err := e.TorControl.Signal("NEWNYM"); err != nil {
+		return err
+	}
+	e.stats.update(func(r *SessionReport) { r.Identities++ })
+	return nil
 }
 
-// ReloadConfig applies a new configuration to the running engine.
-// Hot-reloadable changes (bridges, proxy, verbose) are applied via the Tor
-// Control Protocol. Changes that require a VM restart are logged as warnings.
-func (e *Engine) ReloadConfig(newCfg *config.Config) error {
-	diff := config.Diff(e.Config, newCfg)
+// ReloadConfig applies a new configuration to the engine, each changed
+// field when it can take effect (see config.Apply). Live changes (bridges,
+// proxy, relays, verbose, disk limits) are applied at once, the torrc ones
+// via the Tor Control Protocol. Changes that take effect from the next VM
+// start are held back while a run is in progress, which keeps the network
+// and VM it set up, and applied when the next run begins. Changes that
+// only a restart of TorVM applies are logged as such.
+//
+// Changes are found against the configuration last reloaded, so newCfg
+// may be Config itself after it was edited in place (the GUI settings).
+// Otherwise Config is updated in place, as the VM and the GUI share it.
+// The returned diff says which changes went where.
+func (e *Engine) ReloadConfig(newCfg *config.Config) (config.ConfigDiff, error) {
+	e.cfgMu.Lock()
+	defer e.cfgMu.Unlock()
+
+	old := e.applied
+	diff := config.Diff(old, newCfg)
 	if !diff.HasChanges() {
 		e.Logger.Debug("config reload: no changes detected")
-		return nil
+		return diff, nil
 	}
 
-	// Log restart-required changes as warnings.
+	// A running VM may take more vCPUs, which makes the change a live
+	// one; applyVCPUs explains why not otherwise.
+	cpusApplied := false
+	if newCfg.VMCPUs != old.VMCPUs && e.VM.IsRunning() {
+		if err := e.applyVCPUs(newCfg.VMCPUs); err != nil {
+			e.Logger.Info("config reload: %v", err)
+		} else {
+			cpusApplied = true
+		}
+	}
+
+	for _, field := range diff.RestartNow {
+		e.Logger.Info("config reload: %s changed; restart TorVM to apply it", field)
+	}
+	next := diff.RestartRequired[:0:0]
 	for _, field := range diff.RestartRequired {
-		e.Logger.Info("config reload: %s changed but requires VM restart to take effect", field)
+		if cpusApplied && strings.HasPrefix(field, "VMCPUs ") {
+			diff.HotReloadable = append(diff.HotReloadable, field)
+			continue
+		}
+		e.Logger.Info("config reload: %s changed; it applies from the next VM start, or restart the VM to apply it now", field)
+		next = append(next, field)
 	}
+	diff.RestartRequired = next
 
-	// Apply hot-reloadable changes via Tor Control Protocol.
+	// Apply live changes, the torrc ones via Tor Control Protocol.
+	pushed := false
 	if len(diff.HotReloadable) > 0 {
-		e.Logger.Info("config reload: applying hot-reloadable changes: %v", diff.HotReloadable)
+		e.Logger.Info("config reload: applying live changes: %v", diff.HotReloadable)
 
-		if e.TorControl != nil && e.state == StateRunning {
-			// Generate torrc overlay from the new config and push it.
-			overlay, err := newCfg.TorrcOverlay()
-			if err != nil {
-				return fmt.Errorf("config reload: generate torrc overlay: %w", err)
+		overlay, err := newCfg.TorrcOverlay()
+		if err != nil {
+			return diff, fmt.Errorf("config reload: generate torrc overlay: %w", err)
+		}
+		oldOverlay, _ := old.TorrcOverlay()
+		switch {
+		case overlay == oldOverlay:
+		case e.TorControl != nil && e.state == StateRunning:
+			directives := parseTorrcOverlay(overlay)
+			// A directive the new overlay dropped, such as a removed
+			// TorrcExtra line, is reset: SETCONF with an empty value
+			// puts it back to Tor's default. The overlay sets nothing
+			// the VM's base torrc does, so that is the value it had.
+			for k := range parseTorrcOverlay(oldOverlay) {
+				if _, ok := directives[k]; !ok {
+					directives[k] = ""
+				}
 			}
-
-			if overlay != "" {
-				directives := parseTorrcOverlay(overlay)
+			// ContactInfo carries the checksum of the overlay in force,
+			// which checkConfigAck compares with the config's.
+			if conf, err := e.TorControl.GetConf("ContactInfo"); err == nil {
+				directives["ContactInfo"] = ackContactInfo(conf["ContactInfo"], overlay)
+			} else {
+				e.Logger.Error("config reload: read ContactInfo (non-fatal): %v", err)
+			}
+			if len(directives) > 0 {
 				if err := e.TorControl.SetConf(directives); err != nil {
-					return fmt.Errorf("config reload: setconf: %w", err)
+					return diff, fmt.Errorf("config reload: setconf: %w", err)
 				}
 			}
 
 			if err := e.TorControl.Signal("RELOAD"); err != nil {
 				e.Logger.Error("config reload: RELOAD signal failed (non-fatal): %v", err)
 			}
-		} else {
-			e.Logger.Info("config reload: tor control not available, changes will apply on next restart")
+			pushed = true
+		default:
+			e.Logger.Info("config reload: tor control not available, torrc changes apply from the next VM start")
 		}
 	}
 
+	if newCfg.Disk != old.Disk && e.VM.IsRunning() {
+		e.applyDiskThrottle(newCfg.Disk)
+	}
+
 	// Update verbose logging level immediately.
-	if newCfg.Verbose != e.Config.Verbose {
+	if newCfg.Verbose != old.Verbose {
 		e.Logger.SetVerbose(newCfg.Verbose)
 	}
 
-	e.Config = newCfg
-	return nil
+	switch {
+	case newCfg == e.Config:
+		// Edited in place; what the file or API held back is superseded.
+		e.pending = nil
+	case e.active.Load():
+		e.Config.CopyFields(newCfg, config.ApplyLive)
+		e.Config.CopyFields(newCfg, config.ApplyRestart)
+		if cpusApplied {
+			e.Config.VMCPUs = newCfg.VMCPUs
+		}
+		e.pending = newCfg.Clone()
+	default:
+		*e.Config = *newCfg
+		e.pending = nil
+	}
+	e.applied = newCfg.Clone()
+	if pushed {
+		e.checkConfigAck()
+	}
+	return diff, nil
+}
+
+// applyPending applies the changes ReloadConfig held back for the next
+// run.
+func (e *Engine) applyPending() {
+	e.cfgMu.Lock()
+	defer e.cfgMu.Unlock()
+	if e.pending == nil {
+		return
+	}
+	e.Config.CopyFields(e.pending, config.ApplyNextStart)
+	e.pending = nil
+	e.Logger.Info("config reload: applied the changes held for this VM start")
 }
 
 // parseTorrcOverlay converts a torrc overlay string into a map of key=value
@@ -188,41 +408,187 @@ func parseTorrcOverlay(overlay string) map[string]string {
 // NewEngine creates a lifecycle engine.
 func NewEngine(cfg *config.Config, logger *logging.Logger) *Engine {
 	inst := vm.NewInstance(cfg, logger)
-	netMgr := network.NewManager()
+	label := network.InstanceLabel(cfg.Instance)
+	stateDir := network.DefaultStateDir()
+	netMgr := network.NewManager(label, stateDir)
+	store, err := network.NewSessionStore(stateDir, label)
+	if err != nil {
+		logger.Error("crash recovery disabled: %v", err)
+	}
 
-	return &Engine{
-		Config:      cfg,
-		Logger:      logger,
-		VM:          inst,
-		Network:     netMgr,
-		FailSafe:    NewFailSafe(netMgr, logger),
-		state:       StateInit,
-		retryPolicy: DefaultRetryPolicy(),
-		attempts:    make(map[State]int),
+	e := &Engine{
+		Config:       cfg,
+		Logger:       logger,
+		VM:           inst,
+		Network:      netMgr,
+		FailSafe:     NewFailSafe(netMgr, logger),
+		Events:       NewEventBus(eventHistory),
+		Session:      store,
+		Restart:      restartPolicy(cfg.Retry),
+		state:        StateInit,
+		retryPolicy:  DefaultRetryPolicy(),
+		attempts:     make(map[State]int),
+		checkAccess:  privexec.CheckAccess,
+		hostNetworks: network.HostNetworks,
+		verifyRoutes: network.VerifyRoutes,
+		tapPresent:   network.TAPPresent,
+		restartCh:    make(chan func(), 1),
+		pauseCh:      make(chan chan error),
+		resumeCh:     make(chan chan error),
+		clock:        clock.Real,
+
+		hostFingerprint: network.HostFingerprint,
+		detectSharing:   network.DetectSharing,
+		applied:         cfg.Clone(),
 	}
+	e.wireFailsafeEvents()
+	return e
 }
 
 // NewEngineWithDeps creates a lifecycle engine with explicit dependencies,
 // enabling testing with mock VM and network implementations.
 func NewEngineWithDeps(cfg *config.Config, logger *logging.Logger, vmCtrl VMController, netMgr network.Manager) *Engine {
-	return &Engine{
-		Config:      cfg,
-		Logger:      logger,
-		VM:          vmCtrl,
-		Network:     netMgr,
-		FailSafe:    NewFailSafe(netMgr, logger),
-		state:       StateInit,
-		retryPolicy: DefaultRetryPolicy(),
-		attempts:    make(map[State]int),
+	e := &Engine{
+		Config:       cfg,
+		Logger:       logger,
+		VM:           vmCtrl,
+		Network:      netMgr,
+		FailSafe:     NewFailSafe(netMgr, logger),
+		Events:       NewEventBus(eventHistory),
+		Restart:      restartPolicy(cfg.Retry),
+		state:        StateInit,
+		retryPolicy:  DefaultRetryPolicy(),
+		attempts:     make(map[State]int),
+		checkAccess:  privexec.CheckAccess,
+		hostNetworks: network.HostNetworks,
+		verifyRoutes: network.VerifyRoutes,
+		tapPresent:   network.TAPPresent,
+		restartCh:    make(chan func(), 1),
+		pauseCh:      make(chan chan error),
+		resumeCh:     make(chan chan error),
+		clock:        clock.Real,
+
+		hostFingerprint: network.HostFingerprint,
+		detectSharing:   network.DetectSharing,
+		applied:         cfg.Clone(),
 	}
+	e.wireFailsafeEvents()
+	return e
 }
 
-// Run progresses through the lifecycle states. It blocks until
-// the VM exits or the context is cancelled.
+// ErrNotRunning is returned by Stop when no run is in progress.
+var ErrNotRunning = errors.New("lifecycle: not running")
+
+// Run progresses through the lifecycle states. It blocks until the
+// session ends: the VM exits, Stop is called, or the context is
+// cancelled. It returns nil after a clean shutdown and an error when the
+// session failed (a state failed permanently, the VM exited for good) or
+// the host network could not be restored. After it returns, it may be
+// called again: the next run starts over from StateInit.
 func (e *Engine) Run(ctx context.Context) error {
+	ctx, err := e.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return e.run(ctx)
+}
+
+// Start runs the lifecycle loop in a background goroutine,
+// returning a channel that receives the result.
+func (e *Engine) Start(ctx context.Context) <-chan error {
+	ch := make(chan error, 1)
+	// Begin here rather than in the goroutine so the state is back at
+	// StateInit, and Stop works, when Start returns.
+	ctx, err := e.begin(ctx)
+	if err != nil {
+		ch <- err
+		return ch
+	}
+	go func() { ch <- e.run(ctx) }()
+	return ch
+}
+
+// Stop asks the current run for an orderly shutdown from whatever state
+// it is in: the VM is powered down and the host network restored, as
+// when the Run context is cancelled. The returned channel receives the
+// run's result once it has shut down (nil if it stopped cleanly, see
+// Run), or ctx's error if ctx ends first; the shutdown carries on
+// regardless. It receives ErrNotRunning at once when no run is in
+// progress. Stop is safe to call from any goroutine, and more than once.
+// The shutdown reports ShutdownUser; see StopFor.
+func (e *Engine) Stop(ctx context.Context) <-chan error {
+	return e.StopFor(ctx, ShutdownUser)
+}
+
+// StopFor is Stop with the reason the shutdown reports, unless an earlier
+// stop already gave one.
+func (e *Engine) StopFor(ctx context.Context, reason ShutdownReason) <-chan error {
+	ch := make(chan error, 1)
+	e.runMu.Lock()
+	stop, done := e.stopRun, e.runDone
+	if stop != nil && e.requested == ShutdownNone {
+		e.requested = reason
+	}
+	e.runMu.Unlock()
+	if stop == nil {
+		ch <- ErrNotRunning
+		return ch
+	}
+	e.Logger.Info("lifecycle: stop requested in state %s (%s)", e.State(), reason)
+	stop()
+	go func() {
+		select {
+		case <-done:
+			e.runMu.Lock()
+			ch <- e.runErr
+			e.runMu.Unlock()
+		case <-ctx.Done():
+			ch <- ctx.Err()
+		}
+	}()
+	return ch
+}
+
+// begin claims the engine for a run and returns the run's context, which
+// Stop cancels.
+func (e *Engine) begin(ctx context.Context) (context.Context, error) {
+	if !e.active.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("lifecycle: already running")
+	}
+	if e.state != StateInit {
+		e.reset()
+	}
+	e.applyPending()
+	e.stats.reset(e.clock.Now())
+	ctx, cancel := context.WithCancel(ctx)
+	e.runMu.Lock()
+	e.stopRun, e.runDone, e.runErr = cancel, make(chan struct{}), nil
+	e.requested, e.reason = ShutdownNone, ShutdownNone
+	e.runMu.Unlock()
+	return ctx, nil
+}
+
+// end records the result of a run for Stop and releases the engine.
+func (e *Engine) end(result error) {
+	e.runMu.Lock()
+	e.stopRun()
+	e.stopRun = nil
+	e.runErr = result
+	close(e.runDone)
+	e.runMu.Unlock()
+	e.active.Store(false)
+}
+
+func (e *Engine) run(ctx context.Context) (result error) {
+	defer func() { e.end(result) }()
 	for {
 		if ctx.Err() != nil {
-			e.transition(StateShutdown)
+			switch e.state {
+			case StateShutdown, StateRestoreNetwork, StateCleanup, StateFailed:
+				// Already on the way out.
+			default:
+				e.shutdown(ShutdownUser)
+			}
 		}
 
 		e.Logger.Info("lifecycle: entering state %s", e.state)
@@ -233,10 +599,32 @@ func (e *Engine) Run(ctx context.Context) error {
 			e.transition(StateCheckPrivileges)
 
 		case StateCheckPrivileges:
-			if err := checkPrivileges(); err != nil {
+			if err := e.checkAccess(); err != nil {
+				return err
+			}
+			reattached, err := e.recoverSession()
+			if err != nil {
 				return err
 			}
-			e.transition(StateSaveNetwork)
+			// An adopted VM holds its QMP socket itself.
+			if !reattached {
+				if err := e.checkConflicts(); err != nil {
+					return err
+				}
+			}
+			if err := e.checkSharing(); err != nil {
+				if !reattached {
+					return err
+				}
+				// The adopted VM and the crashed session's network
+				// configuration still need to be taken down.
+				e.failure = err
+				e.shutdown(ShutdownFailsafe)
+			} else if reattached {
+				e.transition(StateConfigureTAP)
+			} else {
+				e.transition(StateSaveNetwork)
+			}
 
 		case StateSaveNetwork:
 			err = e.doSaveNetwork()
@@ -253,6 +641,9 @@ func (e *Engine) Run(ctx context.Context) error {
 		case StateConfigureTAP:
 			err = e.doConfigureTAP()
 
+		case StateVerifyRoutes:
+			err = e.doVerifyRoutes()
+
 		case StateFlushDNS:
 			err = e.doFlushDNS()
 
@@ -262,6 +653,9 @@ func (e *Engine) Run(ctx context.Context) error {
 		case StateRunning:
 			err = e.doRunning(ctx)
 
+		case StatePaused:
+			err = e.doPaused(ctx)
+
 		case StateShutdown:
 			err = e.doShutdown(ctx)
 
@@ -269,7 +663,13 @@ func (e *Engine) Run(ctx context.Context) error {
 			err = e.doRestoreNetwork()
 
 		case StateCleanup:
-			return e.doCleanup()
+			if err := e.doCleanup(); err != nil {
+				return err
+			}
+			if e.failure != nil {
+				return fmt.Errorf("lifecycle: %w", e.failure)
+			}
+			return nil
 
 		case StateFailed:
 			return fmt.Errorf("lifecycle: entered failed state")
@@ -279,29 +679,60 @@ func (e *Engine) Run(ctx context.Context) error {
 			policy := e.retryPolicy[e.state]
 			if retry, delay := ShouldRetry(e.state, err, e.attempts[e.state], policy); retry {
 				e.attempts[e.state]++
+				e.stats.addError(err)
 				e.Logger.Info("lifecycle: %s failed (attempt %d/%d), retrying in %v: %v",
 					e.state, e.attempts[e.state], policy.MaxAttempts, delay, err)
+				e.Events.Publish(Event{Kind: EventRetry, To: e.state, Err: err,
+					Step: stepProgress(e.state, e.attempts[e.state], 0)})
 				select {
-				case <-time.After(delay):
+				case <-e.clock.After(delay):
 					continue
 				case <-ctx.Done():
-					e.transition(StateShutdown)
+					e.shutdown(ShutdownUser)
 				}
 			} else {
 				e.Logger.Error("lifecycle: %s failed permanently: %v", e.state, err)
+				e.stats.addError(err)
+				e.failure = fmt.Errorf("%s failed: %w", e.state, err)
 				e.FailSafe.Activate()
-				e.transition(StateShutdown)
+				e.shutdown(failureReason(err))
 			}
 		}
 	}
 }
 
-// Start runs the lifecycle loop in a background goroutine,
-// returning a channel that receives the result.
-func (e *Engine) Start(ctx context.Context) <-chan error {
-	ch := make(chan error, 1)
-	go func() { ch <- e.Run(ctx) }()
-	return ch
+// Reset returns an engine whose Run has returned to StateInit, dropping
+// what it kept of the previous session (saved network configuration,
+// Tor control connection, retry and restart counts), so it can run
+// again. It fails while Run is active. The failsafe is left alone: rules
+// kept after a failure stay until the next session replaces them.
+func (e *Engine) Reset() error {
+	if e.active.Load() {
+		return fmt.Errorf("lifecycle: reset: the engine is running")
+	}
+	if e.state != StateInit {
+		e.reset()
+	}
+	return nil
+}
+
+func (e *Engine) reset() {
+	e.closeTorControl()
+	e.savedNet = nil
+	e.session = nil
+	e.shared = nil
+	e.routed = false
+	e.paused = false
+	e.attempts = make(map[State]int)
+	e.runningSince = time.Time{}
+	e.crashRestarts, e.launchDelay = 0, 0
+	e.failure = nil
+	// A maintenance restart requested as the last run ended.
+	select {
+	case <-e.restartCh:
+	default:
+	}
+	e.transition(StateInit)
 }
 
 func (e *Engine) transition(next State) {
@@ -309,17 +740,18 @@ func (e *Engine) transition(next State) {
 	e.Logger.Debug("lifecycle: %s -> %s", prev, next)
 	delete(e.attempts, prev)
 	e.state = next
+	if e.session != nil {
+		e.session.State = next.String()
+		e.saveSession()
+	}
 	if e.Metrics != nil {
 		e.Metrics.RecordTransition(prev.String(), next.String())
 	}
-	// Snapshot observers under lock to allow concurrent registration.
-	e.observerMu.Lock()
-	snap := make([]StateObserver, len(e.observers))
-	copy(snap, e.observers)
-	e.observerMu.Unlock()
-	for _, fn := range snap {
-		fn(prev, next)
+	ev := Event{Kind: EventState, From: prev, To: next, Step: stepProgress(next, e.attempts[next], 0)}
+	if next == StateShutdown {
+		ev.Reason = e.ShutdownReason()
 	}
+	e.Events.Publish(ev)
 }
 
 func (e *Engine) fail(err error) {
@@ -333,48 +765,335 @@ func (e *Engine) doSaveNetwork() error {
 		return err
 	}
 	e.savedNet = saved
+	e.session = &network.Session{
+		Label:   network.InstanceLabel(e.Config.Instance),
+		Started: e.clock.Now(),
+		State:   e.state.String(),
+		TAPName: e.Config.TAPName,
+		HostIP:  e.Config.HostIP,
+		VMIP:    e.Config.VMIP,
+		Saved:   saved,
+	}
+	e.session.Claim()
+	e.saveSession()
 	e.transition(StateCreateTAP)
 	return nil
 }
 
-func (e *Engine) doCreateTAP() error {
-	hostIP := net.ParseIP(e.Config.HostIP)
+// recoverSession undoes the host network changes of a previous session
+// that did not shut down cleanly. It runs before the new session saves
+// the network configuration, which would otherwise capture the crashed
+// session's routes as the original ones. If the crashed session's VM is
+// still running, it is adopted instead (see reattach), and recoverSession
+// reports true.
+func (e *Engine) recoverSession() (bool, error) {
+	if e.Session == nil {
+		return false, nil
+	}
+	prev, err := e.Session.Load()
+	if err != nil {
+		// An unreadable or tampered record cannot be trusted to restore
+		// anything; the labelled artifacts can still be purged.
+		e.Logger.Error("crash recovery: %v; purging labelled artifacts only", err)
+		prev = &network.Session{TAPName: e.Config.TAPName, VMIP: e.Config.VMIP}
+	}
+	if prev == nil {
+		return false, nil
+	}
+	if prev.Alive() {
+		return false, fmt.Errorf("instance %q is already running (pid %d)", e.Config.Instance, prev.PID)
+	}
+
+	e.Logger.Info("crash recovery: previous session (pid %d, started %s) did not shut down cleanly in state %s; changes applied: %s",
+		prev.PID, prev.Started.Format(time.RFC3339), cmp.Or(prev.State, "unknown"), strings.Join(prev.Changes, ", "))
+	if prev.QEMUPID > 0 && e.reattach(prev) {
+		return true, nil
+	}
+	switch prev.State {
+	case StateShutdown.String(), StateRestoreNetwork.String(), StateCleanup.String():
+		e.Logger.Info("crash recovery: the previous session was shutting down; finishing its cleanup")
+	}
+	removed, err := network.Recover(e.Network, prev, e.Config.KillSwitch)
+	for _, item := range removed {
+		e.Logger.Info("crash recovery: %s", item)
+	}
+	if err != nil {
+		return false, fmt.Errorf("crash recovery: %w (fix the cause or run purge-host-artifacts, then start again)", err)
+	}
+	if e.Config.KillSwitch {
+		e.Logger.Info("crash recovery: kill switch rules left in place until the new session re-arms them")
+	}
+	e.FailSafe.Reset()
+	return false, e.Session.Clear()
+}
+
+// vmAttacher is implemented by VM controllers that can adopt a VM left
+// running by a crashed controller.
+type vmAttacher interface {
+	Attach(pid int, qmpPath string) error
+}
+
+// vmProcess is implemented by VM controllers that run the VM as a host
+// process.
+type vmProcess interface {
+	PID() int
+}
+
+// reattach adopts the VM of a crashed session that is still running, so
+// Tor keeps its state and circuits. The session's routes and rules are
+// purged, leaving the TAP device to the VM, and the caller applies them
+// afresh from StateConfigureTAP; the network configuration saved when the
+// session started is kept for the shutdown to restore. A VM that was not
+// running normally, or whose link cannot be taken over, is stopped
+// instead. Reports whether the VM was adopted.
+func (e *Engine) reattach(prev *network.Session) bool {
+	a, ok := e.VM.(vmAttacher)
+	if !ok {
+		return false
+	}
+	if err := a.Attach(prev.QEMUPID, prev.QMPPath); err != nil {
+		e.Logger.Info("crash recovery: the previous session's VM (pid %d) is gone: %v", prev.QEMUPID, err)
+		return false
+	}
+	var err error
+	switch {
+	case prev.State != StateRunning.String() && prev.State != StatePaused.String():
+		err = fmt.Errorf("it was not running normally (state %s)", prev.State)
+	case prev.Saved == nil || prev.HostIP == "" || prev.VMIP == "":
+		err = fmt.Errorf("the session record lacks its network configuration")
+	case prev.TAPName != e.Config.TAPName || !e.tapPresent(prev.TAPName):
+		err = fmt.Errorf("its TAP device %s is gone or no longer configured", prev.TAPName)
+	}
+	if err == nil {
+		_, err = e.Network.PurgeArtifacts(network.PurgeOptions{
+			TAPName:      prev.TAPName,
+			VMIP:         net.ParseIP(prev.VMIP),
+			KeepFirewall: e.Config.KillSwitch,
+			KeepTAP:      true,
+		})
+	}
+	if err != nil {
+		e.Logger.Info("crash recovery: stopping the previous session's VM (pid %d): %v", prev.QEMUPID, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := e.VM.Stop(ctx); err != nil {
+			e.Logger.Error("crash recovery: stop VM: %v", err)
+		}
+		return false
+	}
+	if prev.State == StatePaused.String() {
+		if p, ok := e.VM.(vmPauser); ok {
+			if err := p.Resume(); err != nil {
+				e.Logger.Error("crash recovery: resume VM: %v", err)
+			}
+		}
+	}
+
+	e.Config.HostIP, e.Config.VMIP = prev.HostIP, prev.VMIP
+	if hostIP, _, mask, err := e.linkAddrs(); err == nil {
+		e.FailSafe.SetLink(e.Config.TAPName, &net.IPNet{IP: hostIP.Mask(mask), Mask: mask})
+	}
+	e.FailSafe.Reset()
+	e.savedNet = prev.Saved
+	prev.Claim()
+	e.session = prev
+	e.saveSession()
+	e.Logger.Info("crash recovery: reattached to the previous session's VM (pid %d); re-applying host routing", prev.QEMUPID)
+	return true
+}
+
+// checkConflicts fails the start if Tor's ports or the QMP socket are
+// taken (see vm.PortConflicts and vm.QMPSocketConflict), which would
+// otherwise show up only as a bootstrap that never finishes or a QMP
+// connection to another QEMU. The error suggests free values.
+func (e *Engine) checkConflicts() error {
+	conflicts := vm.PortConflicts(e.Config)
+	if c := vm.QMPSocketConflict(e.Config.QMPSocketPath); c != nil {
+		conflicts = append(conflicts, *c)
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	s := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		s[i] = c.String()
+	}
+	return fmt.Errorf("preflight: %s", strings.Join(s, "; "))
+}
+
+// checkSharing looks for devices that reach the network through this
+// host. Their traffic is forwarded, not sent by the host, so unless the
+// sharing mode routes it through the VM it bypasses Tor: refuse to start,
+// or warn, as configured.
+func (e *Engine) checkSharing() error {
+	shared, err := e.detectSharing()
+	if err != nil {
+		e.Logger.Error("connection sharing: detection failed: %v", err)
+		return nil
+	}
+	e.shared = shared
+	if len(shared) == 0 {
+		return nil
+	}
+	names := make([]string, len(shared))
+	for i, s := range shared {
+		names[i] = s.String()
+	}
+	list := strings.Join(names, ", ")
+	route := e.Config.Sharing.Mode == "route"
+	switch {
+	case e.Config.Sharing.Mode == "refuse":
+		return fmt.Errorf("the host shares its connection on %s; devices using it would bypass Tor (turn sharing off or set sharing mode to warn)", list)
+	case route:
+		e.Logger.Info("connection sharing: routing clients on %s through Tor", list)
+	default:
+		e.Logger.Error("connection sharing: the host shares its connection on %s; traffic from devices using it is NOT routed through Tor", list)
+	}
+	e.Events.Publish(Event{Kind: EventSharing, Summary: list, Active: route})
+	return nil
+}
+
+// recordChange adds a host network change to the persisted session.
+func (e *Engine) recordChange(change string) {
+	if e.session == nil {
+		return
+	}
+	// The link may have moved in selectSubnet.
+	e.session.HostIP, e.session.VMIP = e.Config.HostIP, e.Config.VMIP
+	if !slices.Contains(e.session.Changes, change) {
+		e.session.Changes = append(e.session.Changes, change)
+	}
+	e.saveSession()
+}
+
+// recordVM adds the VM's process and QMP socket to the persisted
+// session, so the next start can find a VM that outlives a crash.
+func (e *Engine) recordVM() {
+	p, ok := e.VM.(vmProcess)
+	if !ok || e.session == nil {
+		return
+	}
+	e.session.QEMUPID = p.PID()
+	e.session.QMPPath = e.Config.QMPSocketPath
+	e.saveSession()
+}
+
+func (e *Engine) saveSession() {
+	if e.Session == nil || e.session == nil {
+		return
+	}
+	if err := e.Session.Save(e.session); err != nil {
+		e.Logger.Error("crash recovery: %v", err)
+	}
+}
+
+// linkAddrs parses the configured TAP link addresses.
+func (e *Engine) linkAddrs() (hostIP, vmIP net.IP, mask net.IPMask, err error) {
+	hostIP = net.ParseIP(e.Config.HostIP)
 	if hostIP == nil {
-		return fmt.Errorf("invalid HostIP: %q", e.Config.HostIP)
+		return nil, nil, nil, fmt.Errorf("invalid HostIP: %q", e.Config.HostIP)
 	}
-	vmIP := net.ParseIP(e.Config.VMIP)
+	vmIP = net.ParseIP(e.Config.VMIP)
 	if vmIP == nil {
-		return fmt.Errorf("invalid VMIP: %q", e.Config.VMIP)
+		return nil, nil, nil, fmt.Errorf("invalid VMIP: %q", e.Config.VMIP)
 	}
 	maskIP := net.ParseIP(e.Config.SubnetMask)
 	if maskIP == nil {
-		return fmt.Errorf("invalid SubnetMask: %q", e.Config.SubnetMask)
+		return nil, nil, nil, fmt.Errorf("invalid SubnetMask: %q", e.Config.SubnetMask)
+	}
+	return hostIP, vmIP, net.IPMask(maskIP.To4()), nil
+}
+
+func (e *Engine) doCreateTAP() error {
+	hostIP, vmIP, mask, err := e.linkAddrs()
+	if err != nil {
+		return err
+	}
+	// A migrated guest keeps the addresses it booted with on the source.
+	if e.Config.AutoSubnet && e.Config.Incoming == "" {
+		hostIP, vmIP = e.selectSubnet(hostIP, vmIP, mask)
 	}
-	mask := net.IPMask(maskIP.To4())
 
-	if err := e.Network.CreateTAP(e.Config.TAPName, hostIP, vmIP, mask); err != nil {
+	err = e.Network.CreateTAP(e.Config.TAPName, hostIP, vmIP, mask, e.Config.MTU)
+	e.networkOp("create TAP", err)
+	if err != nil {
 		return err
 	}
+	e.recordChange(network.ChangeTAP)
+	e.FailSafe.SetLink(e.Config.TAPName, &net.IPNet{IP: hostIP.Mask(mask), Mask: mask})
 	e.transition(StateLaunchVM)
 	return nil
 }
 
+// selectSubnet moves the TAP link to a free RFC 1918 subnet when the
+// configured one overlaps a host network (common on corporate VPNs). The
+// chosen addresses are written back to the config so the kernel command
+// line and Tor control address follow. On any detection error the
+// configured addresses are kept.
+func (e *Engine) selectSubnet(hostIP, vmIP net.IP, mask net.IPMask) (net.IP, net.IP) {
+	used, err := e.hostNetworks(e.Config.TAPName)
+	if err != nil {
+		e.Logger.Error("subnet check: %v", err)
+		return hostIP, vmIP
+	}
+	newHost, newVM, changed, err := network.SelectSubnet(hostIP, vmIP, mask, used)
+	if err != nil {
+		e.Logger.Error("subnet check: %v; keeping %s", err, hostIP)
+		return hostIP, vmIP
+	}
+	if !changed {
+		return hostIP, vmIP
+	}
+	ones, _ := mask.Size()
+	e.Logger.Info("subnet %s/%d conflicts with a host network; using %s/%d (host %s, vm %s)",
+		hostIP.Mask(mask), ones, newHost.Mask(mask), ones, newHost, newVM)
+	e.Config.HostIP = newHost.String()
+	e.Config.VMIP = newVM.String()
+	return newHost, newVM
+}
+
 func (e *Engine) doLaunchVM(ctx context.Context) error {
+	if e.launchDelay > 0 {
+		select {
+		case <-e.clock.After(e.launchDelay):
+		case <-ctx.Done():
+			return nil // Run shuts down
+		}
+		e.launchDelay = 0
+	}
 	if err := e.VM.Start(ctx); err != nil {
 		return err
 	}
+	e.recordVM()
+	if e.Config.Incoming != "" {
+		mt, ok := e.VM.(migrationTarget)
+		if !ok {
+			return fmt.Errorf("incoming migration is not supported by this VM")
+		}
+		if err := mt.AcceptMigration(ctx); err != nil {
+			return fmt.Errorf("incoming migration: %w", err)
+		}
+		// A later relaunch (maintenance restart) boots normally.
+		e.Config.Incoming = ""
+	}
 	e.transition(StateWaitTAP)
 	return nil
 }
 
+// migrationTarget is implemented by VM controllers that can receive a
+// live migration from another host.
+type migrationTarget interface {
+	AcceptMigration(ctx context.Context) error
+}
+
 func (e *Engine) doWaitTAP(ctx context.Context) error {
 	// Wait up to 60 seconds for the TAP device to become connected.
 	timeout := 60 * time.Second
-	deadline := time.Now().Add(timeout)
+	deadline := e.clock.Now().Add(timeout)
 	backoff := 500 * time.Millisecond
 	const maxBackoff = 10 * time.Second
 
-	for time.Now().Before(deadline) {
+	for e.clock.Now().Before(deadline) {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
@@ -383,7 +1102,7 @@ func (e *Engine) doWaitTAP(ctx context.Context) error {
 		}
 		// Check if we can reach the VM IP.
 		conn, err := net.DialTimeout("tcp",
-			fmt.Sprintf("%s:%d", e.Config.VMIP, e.Config.ControlPort),
+			net.JoinHostPort(e.Config.VMIP, strconv.Itoa(e.Config.ControlPort)),
 			2*time.Second)
 		if err == nil {
 			// Set linger to 0 to close immediately without TIME_WAIT,
@@ -392,10 +1111,13 @@ func (e *Engine) doWaitTAP(ctx context.Context) error {
 				tc.SetLinger(0)
 			}
 			conn.Close()
+			if e.Config.Disk != (config.DiskConfig{}) {
+				e.applyDiskThrottle(e.Config.Disk)
+			}
 			e.transition(StateConfigureTAP)
 			return nil
 		}
-		time.Sleep(backoff)
+		e.clock.Sleep(backoff)
 		// Exponential backoff capped at maxBackoff.
 		backoff = backoff * 2
 		if backoff > maxBackoff {
@@ -405,25 +1127,235 @@ func (e *Engine) doWaitTAP(ctx context.Context) error {
 	return fmt.Errorf("TAP connect timeout after %v", timeout)
 }
 
+// diskThrottler is implemented by VM controllers that can cap state disk
+// I/O while the VM runs.
+type diskThrottler interface {
+	SetDiskThrottle(config.DiskConfig) error
+}
+
+// applyDiskThrottle sets the state disk I/O limits. Failures are logged
+// only; the VM works without them.
+func (e *Engine) applyDiskThrottle(d config.DiskConfig) {
+	dt, ok := e.VM.(diskThrottler)
+	if !ok {
+		return
+	}
+	if err := dt.SetDiskThrottle(d); err != nil {
+		e.Logger.Error("disk throttle failed (non-fatal): %v", err)
+		return
+	}
+	e.Logger.Info("state disk limits: read %d MB/s %d IOPS, write %d MB/s %d IOPS (0 = unlimited)",
+		d.ReadMBps, d.ReadIOPS, d.WriteMBps, d.WriteIOPS)
+}
+
+// ApplyDiskLimits sets the running VM's state disk I/O limits from
+// Config.Disk, after it was edited in place (the GUI settings). While the
+// VM is down it does nothing; the limits apply at the next start.
+func (e *Engine) ApplyDiskLimits() {
+	if e.VM.IsRunning() {
+		e.applyDiskThrottle(e.Config.Disk)
+	}
+}
+
+// vcpuScaler is implemented by VM controllers that can plug vCPUs into
+// the running VM. It returns the number online afterwards.
+type vcpuScaler interface {
+	SetVCPUs(n int) (int, error)
+}
+
+// applyVCPUs brings the running VM to n vCPUs. A change the VM cannot
+// take (fewer vCPUs, or no hot-plug support) is queued for the next
+// start; the returned error explains why.
+func (e *Engine) applyVCPUs(n int) error {
+	vs, ok := e.VM.(vcpuScaler)
+	if !ok {
+		return fmt.Errorf("VMCPUs %d applies when the VM restarts: CPU hot-plug is not available", n)
+	}
+	online, err := vs.SetVCPUs(n)
+	if err != nil {
+		return fmt.Errorf("VMCPUs %d applies when the VM restarts; it keeps %d vCPUs until then: %w", n, online, err)
+	}
+	e.Logger.Info("vCPUs: %d online", online)
+	return nil
+}
+
+// entropySeeder is implemented by VM controllers that can send host
+// entropy into the running guest.
+type entropySeeder interface {
+	Reseed(n int) error
+}
+
+// reseedVM sends Config.Entropy.ReseedBytes of host entropy to the guest.
+// Failures are logged only; the guest keeps its own sources.
+func (e *Engine) reseedVM() {
+	es, ok := e.VM.(entropySeeder)
+	if !ok {
+		return
+	}
+	if err := es.Reseed(e.Config.Entropy.ReseedBytes); err != nil {
+		e.Logger.Error("entropy reseed failed (non-fatal): %v", err)
+		return
+	}
+	e.Logger.Debug("entropy: sent %d bytes to the VM", e.Config.Entropy.ReseedBytes)
+}
+
+// ApplyVCPUs brings the running VM to Config.VMCPUs after it was edited
+// in place (the GUI settings). While the VM is down it does nothing. If
+// the change must wait for a restart, the error says why.
+func (e *Engine) ApplyVCPUs() error {
+	if !e.VM.IsRunning() {
+		return nil
+	}
+	return e.applyVCPUs(e.Config.VMCPUs)
+}
+
 func (e *Engine) doConfigureTAP() error {
 	vmIP := net.ParseIP(e.Config.VMIP)
 	if vmIP == nil {
 		return fmt.Errorf("invalid VMIP: %q", e.Config.VMIP)
 	}
-	if err := e.Network.SetupRouting(e.Config.TAPName, vmIP); err != nil {
+	if err := e.setupHostRouting(vmIP); err != nil {
+		return err
+	}
+	e.transition(StateVerifyRoutes)
+	return nil
+}
+
+// setupHostRouting routes host traffic through the VM at vmIP, replacing
+// the routes of a previous VM, and installs the rules that go with them.
+func (e *Engine) setupHostRouting(vmIP net.IP) (err error) {
+	defer func() { e.networkOp("setup routing", err) }()
+	if e.routed {
+		// Relaunch after a maintenance restart. Routes may have vanished
+		// with the old VM's interface (vmnet), so re-apply them.
+		e.Network.UnrouteSharedClients()
+		e.Network.TeardownLANRoutes()
+		e.Network.UnblockDNSLeaks()
+		e.Network.TeardownIPv6()
+		e.Network.TeardownRouting()
+		e.routed = false
+	}
+	routing := network.RoutingOptions{
+		VMIP:     vmIP,
+		Strategy: e.Config.Route.Strategy,
+		Metric:   e.Config.Route.Metric,
+	}
+	routing.DNS = e.tapDNS()
+	if err := e.Network.SetupRouting(e.Config.TAPName, routing); err != nil {
 		return err
 	}
+	if e.session != nil {
+		e.session.Routes = network.RouteDestinations(routing.Strategy)
+	}
+	e.recordChange(network.ChangeRouting)
+	if e.Config.IPv6.Mode == network.IPv6Off {
+		e.Logger.Info("IPv6 mode is off: host IPv6 traffic is NOT routed through Tor")
+	}
+	if err := e.Network.SetupIPv6(e.Config.TAPName, network.IPv6Options{
+		Mode:      e.Config.IPv6.Mode,
+		HostIP:    net.ParseIP(e.Config.IPv6.HostIP),
+		VMIP:      net.ParseIP(e.Config.IPv6.VMIP),
+		PrefixLen: e.Config.IPv6.PrefixLen,
+	}); err != nil {
+		return err
+	}
+	e.recordChange(network.ChangeIPv6)
+	e.routed = true
+	if e.Config.BlockDNSLeaks {
+		if err := e.blockDNSLeaks(vmIP); err != nil {
+			return err
+		}
+	}
+	if e.Config.LAN.Allow {
+		if err := e.setupLANRoutes(vmIP); err != nil {
+			return err
+		}
+		e.recordChange(network.ChangeLAN)
+	}
+	if e.Config.Sharing.Mode == "route" && len(e.shared) > 0 {
+		if err := e.Network.RouteSharedClients(network.SharingOptions{
+			TAPName: e.Config.TAPName,
+			Shared:  e.shared,
+		}); err != nil {
+			return fmt.Errorf("route shared clients: %w", err)
+		}
+		e.recordChange(network.ChangeSharing)
+	}
+	if e.Config.KillSwitch {
+		if err := e.FailSafe.Arm(); err != nil {
+			return err
+		}
+		e.recordChange(network.ChangeFirewall)
+	}
+	return nil
+}
+
+// tapDNS returns the configured DNS servers of the TAP device.
+func (e *Engine) tapDNS() []net.IP {
+	var dns []net.IP
+	for _, s := range []string{e.Config.DNS1, e.Config.DNS2} {
+		if ip := net.ParseIP(s); ip != nil {
+			dns = append(dns, ip)
+		}
+	}
+	return dns
+}
+
+// blockDNSLeaks drops host DNS that is not addressed to the VM or to the
+// TAP's DNS servers, which the routes send to it, so applications with
+// hardcoded resolvers cannot reach them over a LAN route or an interface
+// the routes do not cover.
+func (e *Engine) blockDNSLeaks(vmIP net.IP) error {
+	opts := network.DNSBlockOptions{VMIP: vmIP, DNS: e.tapDNS()}
+	if e.Config.IPv6.Mode == network.IPv6Route {
+		opts.VMIPv6 = net.ParseIP(e.Config.IPv6.VMIP)
+	}
+	if err := e.Network.BlockDNSLeaks(opts); err != nil {
+		return fmt.Errorf("block DNS leaks: %w", err)
+	}
+	e.recordChange(network.ChangeDNS)
+	return nil
+}
+
+// doVerifyRoutes confirms that the host actually sends traffic to the VM.
+// Another interface with a lower-metric default route would otherwise
+// silently carry traffic around Tor.
+func (e *Engine) doVerifyRoutes() error {
+	hostIP := net.ParseIP(e.Config.HostIP)
+	vmIP := net.ParseIP(e.Config.VMIP)
+	if err := e.verifyRoutes(e.Config.TAPName, hostIP, vmIP); err != nil {
+		return fmt.Errorf("route verification failed, traffic would bypass Tor: %w", err)
+	}
+	e.Logger.Info("route verification passed: traffic is routed through the VM")
 	e.transition(StateFlushDNS)
 	return nil
 }
 
+// setupLANRoutes routes the configured local ranges around the VM.
+func (e *Engine) setupLANRoutes(vmIP net.IP) error {
+	ranges := make([]*net.IPNet, 0, len(e.Config.LAN.Ranges))
+	for _, r := range e.Config.LAN.Ranges {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			return fmt.Errorf("LAN range %q: %w", r, err)
+		}
+		ranges = append(ranges, n)
+	}
+	if err := e.Network.SetupLANRoutes(e.Config.TAPName, vmIP, ranges); err != nil {
+		return err
+	}
+	e.FailSafe.SetLAN(ranges)
+	e.Logger.Info("LAN access allowed: %s routed outside Tor", strings.Join(e.Config.LAN.Ranges, ", "))
+	return nil
+}
+
 func (e *Engine) doFlushDNS() error {
 	if err := e.Network.FlushDNS(); err != nil {
 		e.Logger.Error("flush DNS failed (non-fatal): %v", err)
 	}
 
 	// Establish Tor Control Protocol connection.
-	ctrlAddr := fmt.Sprintf("%s:%d", e.Config.VMIP, e.Config.ControlPort)
+	ctrlAddr := net.JoinHostPort(e.Config.VMIP, strconv.Itoa(e.Config.ControlPort))
 	client, err := tor.NewControlClient(ctrlAddr, 10*time.Second)
 	if err != nil {
 		e.Logger.Error("tor control connect failed (falling back to port probe): %v", err)
@@ -436,6 +1368,8 @@ func (e *Engine) doFlushDNS() error {
 			client.Close()
 		} else {
 			e.TorControl = client
+			e.torWatchStop = make(chan struct{})
+			go e.watchTor(client, e.torWatchStop)
 			e.Logger.Info("tor control connected to %s", ctrlAddr)
 		}
 	}
@@ -447,11 +1381,11 @@ func (e *Engine) doFlushDNS() error {
 func (e *Engine) doWaitBootstrap(ctx context.Context) error {
 	// Wait up to 5 minutes for Tor to bootstrap.
 	timeout := 5 * time.Minute
-	deadline := time.Now().Add(timeout)
+	deadline := e.clock.Now().Add(timeout)
 	backoff := time.Second
 	const maxBackoff = 10 * time.Second
 
-	for time.Now().Before(deadline) {
+	for e.clock.Now().Before(deadline) {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
@@ -463,16 +1397,12 @@ func (e *Engine) doWaitBootstrap(ctx context.Context) error {
 		if e.TorControl != nil {
 			status, err := e.TorControl.GetBootstrapStatus()
 			if err == nil {
-				e.observerMu.Lock()
-				bsnap := make([]BootstrapObserver, len(e.bootstrapObservers))
-				copy(bsnap, e.bootstrapObservers)
-				e.observerMu.Unlock()
-				for _, fn := range bsnap {
-					fn(status.Progress, status.Summary)
-				}
+				e.Events.Publish(Event{Kind: EventBootstrap, Progress: status.Progress, Summary: status.Summary,
+					Step: stepProgress(StateWaitBootstrap, e.attempts[StateWaitBootstrap], status.Progress)})
 				if status.Progress >= 100 {
 					e.Logger.Info("Tor bootstrap complete: %s", status.Summary)
 					e.transition(StateRunning)
+					e.checkConfigAck()
 					return nil
 				}
 				e.Logger.Debug("bootstrap: %d%% - %s", status.Progress, status.Summary)
@@ -482,7 +1412,7 @@ func (e *Engine) doWaitBootstrap(ctx context.Context) error {
 		} else {
 			// Fallback: check SOCKS port availability as a bootstrap indicator.
 			conn, err := net.DialTimeout("tcp",
-				fmt.Sprintf("%s:%d", e.Config.VMIP, e.Config.SOCKSPort),
+				net.JoinHostPort(e.Config.VMIP, strconv.Itoa(e.Config.SOCKSPort)),
 				2*time.Second)
 			if err == nil {
 				if tc, ok := conn.(*net.TCPConn); ok {
@@ -495,39 +1425,502 @@ func (e *Engine) doWaitBootstrap(ctx context.Context) error {
 			}
 		}
 
-		time.Sleep(backoff)
+		e.clock.Sleep(backoff)
 		backoff = backoff * 2
 		if backoff > maxBackoff {
 			backoff = maxBackoff
 		}
 	}
-	return fmt.Errorf("Tor bootstrap timeout after %v", timeout)
+	return fmt.Errorf("%w after %v", ErrBootstrapTimeout, timeout)
 }
 
 func (e *Engine) doRunning(ctx context.Context) error {
 	e.Logger.Info("TorVM is running")
 	e.FailSafe.Deactivate()
+	e.runningSince = e.clock.Now()
+
+	// Block until the VM exits, the context is cancelled, or a
+	// maintenance restart is requested.
+	waitCtx, cancelWait := context.WithCancel(ctx)
+	defer cancelWait()
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- e.VM.Wait(waitCtx) }()
+	tapCheck := e.clock.NewTicker(tapCheckInterval)
+	defer tapCheck.Stop()
+	routeCheck := e.clock.NewTicker(routeCheckInterval)
+	defer routeCheck.Stop()
+	hostNet := hostNetState{lastCheck: e.clock.Now()}
+	hostNet.fingerprint, _ = e.hostFingerprint(e.Config.TAPName)
+	var reseed <-chan time.Time // nil, never ready, with reseeding off
+	if sec := e.Config.Entropy.ReseedIntervalSec; sec > 0 {
+		t := e.clock.NewTicker(time.Duration(sec) * time.Second)
+		defer t.Stop()
+		reseed = t.C()
+	}
+
+	for {
+		var recovered bool
+		var err error
+		select {
+		case err := <-waitCh:
+			reason := ShutdownUser
+			if ctx.Err() == nil {
+				reason = ShutdownVMExit
+			}
+			if err != nil && ctx.Err() == nil {
+				e.vmExited(err)
+				if e.restartAfterCrash() {
+					return nil
+				}
+				e.failure = fmt.Errorf("VM exited unexpectedly: %w", err)
+				reason = ShutdownVMCrash
+			}
+			e.shutdown(reason)
+			return nil
+		case hook := <-e.restartCh:
+			cancelWait()
+			<-waitCh
+			e.restartVM(hook)
+			return nil
+		case reply := <-e.pauseCh:
+			err := e.pauseVM()
+			reply <- err
+			if err != nil {
+				continue
+			}
+			cancelWait()
+			<-waitCh
+			e.transition(StatePaused)
+			return nil
+		case now := <-tapCheck.C():
+			if !e.tapPresent(e.Config.TAPName) {
+				recovered, err = e.recoverTAP()
+				break
+			}
+			reason := e.hostNetworkChanged(&hostNet, now)
+			if reason == "" {
+				continue
+			}
+			recovered, err = e.reassertNetwork(reason)
+		case <-routeCheck.C():
+			verr := e.verifyRoutes(e.Config.TAPName, net.ParseIP(e.Config.HostIP), net.ParseIP(e.Config.VMIP))
+			if verr == nil {
+				continue
+			}
+			recovered, err = e.reassertNetwork(fmt.Sprintf("host routes changed (%v)", verr))
+		case <-reseed:
+			e.reseedVM()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !recovered {
+			cancelWait()
+			<-waitCh
+			e.restartVM(nil)
+			return nil
+		}
+	}
+}
+
+// vmExited reports a VM that exited unexpectedly: it blocks host traffic
+// with the failsafe and publishes EventVMExit.
+func (e *Engine) vmExited(err error) {
+	e.Logger.Error("VM exited unexpectedly: %v", err)
+	e.stats.addError(fmt.Errorf("VM exited unexpectedly: %w", err))
+	e.FailSafe.Activate()
+	e.Events.Publish(Event{Kind: EventVMExit, Err: err, ExitCode: exitCode(err)})
+}
 
-	// Block until the VM exits or context is cancelled.
-	err := e.VM.Wait(ctx)
-	if err != nil && ctx.Err() == nil {
-		e.Logger.Error("VM exited unexpectedly: %v", err)
+// vmPauser is implemented by VM controllers that can freeze the running
+// VM in place.
+type vmPauser interface {
+	Pause() error
+	Resume() error
+}
+
+// pauseTimeout bounds how long Pause and Resume wait for the lifecycle
+// loop to take the request.
+const pauseTimeout = 5 * time.Second
+
+// Pause freezes the running VM without shutting it down, so Tor keeps its
+// bootstrapped state. Host traffic stays routed to the VM, and so stalls,
+// unless Config.PauseUnroute restores the host's own routes meanwhile.
+// It is safe to call from any goroutine.
+func (e *Engine) Pause() error {
+	if e.State() != StateRunning {
+		return fmt.Errorf("pause: the VM is not running")
+	}
+	return e.request(e.pauseCh, "pause")
+}
+
+// Resume continues a VM frozen by Pause, re-applying host routing first
+// if Pause removed it. It is safe to call from any goroutine.
+func (e *Engine) Resume() error {
+	if e.State() != StatePaused {
+		return fmt.Errorf("resume: the VM is not paused")
+	}
+	return e.request(e.resumeCh, "resume")
+}
+
+// request hands a Pause or Resume request to the lifecycle loop and
+// returns its result.
+func (e *Engine) request(ch chan chan error, what string) error {
+	reply := make(chan error, 1)
+	select {
+	case ch <- reply:
+		return <-reply
+	case <-e.clock.After(pauseTimeout):
+		return fmt.Errorf("%s: the lifecycle engine is busy (state %s)", what, e.State())
+	}
+}
+
+// pauseVM stops the guest's vCPUs and, with PauseUnroute, restores the
+// host's own routes and DNS.
+func (e *Engine) pauseVM() error {
+	p, ok := e.VM.(vmPauser)
+	if !ok {
+		return fmt.Errorf("pause: not supported by this VM")
+	}
+	if err := p.Pause(); err != nil {
+		return fmt.Errorf("pause: %w", err)
+	}
+	e.paused = true
+	if e.Config.PauseUnroute {
+		e.withdrawRouting()
+		e.Logger.Info("VM paused; host traffic uses the host's own routes, NOT Tor, until resumed")
+	} else {
+		e.Logger.Info("VM paused; host traffic is held until resumed")
+	}
+	return nil
+}
+
+// withdrawRouting removes the host routing through the VM and restores
+// the saved host network configuration, keeping the TAP device.
+func (e *Engine) withdrawRouting() {
+	e.Network.UnrouteSharedClients()
+	e.Network.TeardownLANRoutes()
+	e.Network.UnblockDNSLeaks()
+	e.Network.TeardownIPv6()
+	e.Network.TeardownRouting()
+	if e.savedNet != nil {
+		if err := e.Network.RestoreConfig(e.savedNet); err != nil {
+			e.Logger.Error("restore network failed: %v", err)
+		}
+	}
+	e.routed = false
+	e.networkOp("withdraw routing", nil)
+	if err := e.Network.FlushDNS(); err != nil {
+		e.Logger.Error("flush DNS failed (non-fatal): %v", err)
+	}
+}
+
+// resumeVM continues the guest and, if pauseVM withdrew it, re-applies
+// host routing through the VM. The failsafe blocks host traffic until
+// the routes are verified.
+func (e *Engine) resumeVM() error {
+	if !e.routed {
 		e.FailSafe.Activate()
 	}
-	e.transition(StateShutdown)
+	if err := e.VM.(vmPauser).Resume(); err != nil {
+		return fmt.Errorf("resume: %w", err)
+	}
+	e.paused = false
+	if e.routed {
+		e.Logger.Info("VM resumed")
+		return nil
+	}
+	hostIP, vmIP, _, err := e.linkAddrs()
+	if err != nil {
+		return err
+	}
+	if err := e.setupHostRouting(vmIP); err != nil {
+		return fmt.Errorf("resume: %w", err)
+	}
+	if err := e.verifyRoutes(e.Config.TAPName, hostIP, vmIP); err != nil {
+		return fmt.Errorf("resume: route verification failed, traffic would bypass Tor: %w", err)
+	}
+	if err := e.Network.FlushDNS(); err != nil {
+		e.Logger.Error("flush DNS failed (non-fatal): %v", err)
+	}
+	e.Logger.Info("VM resumed; host routing through the VM re-applied")
 	return nil
 }
 
-func (e *Engine) doShutdown(ctx context.Context) error {
-	// Close Tor Control connection if open.
-	if e.TorControl != nil {
-		e.TorControl.Close()
-		e.TorControl = nil
+// doPaused waits while the VM is paused for Resume, the VM exiting, or
+// the context being cancelled. doRunning takes over again after Resume.
+func (e *Engine) doPaused(ctx context.Context) error {
+	waitCtx, cancelWait := context.WithCancel(ctx)
+	defer cancelWait()
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- e.VM.Wait(waitCtx) }()
+
+	reason := ShutdownUser
+	select {
+	case err := <-waitCh:
+		if ctx.Err() == nil {
+			reason = ShutdownVMExit
+		}
+		if err != nil && ctx.Err() == nil {
+			e.paused = false
+			e.vmExited(err)
+			e.failure = fmt.Errorf("VM exited unexpectedly: %w", err)
+			reason = ShutdownVMCrash
+		}
+	case reply := <-e.resumeCh:
+		err := e.resumeVM()
+		reply <- err
+		if err != nil {
+			return err
+		}
+		e.transition(StateRunning)
+		return nil
+	case <-ctx.Done():
 	}
+	e.shutdown(reason)
+	return nil
+}
+
+// tapCheckInterval is how often doRunning checks that the TAP device
+// still exists.
+var tapCheckInterval = 5 * time.Second
+
+// routeCheckInterval is how often doRunning verifies the effective host
+// routes. This catches changes that leave the interfaces as they were,
+// such as a DHCP renew that re-adds the original default route.
+var routeCheckInterval = 30 * time.Second
+
+// wakeGap is how much longer than tapCheckInterval the wall clock may
+// advance between two checks before the host is taken to have slept.
+const wakeGap = 30 * time.Second
+
+// hostNetState is what doRunning last saw of the host network.
+type hostNetState struct {
+	fingerprint string
+	lastCheck   time.Time
+}
+
+// hostNetworkChanged returns why host routing needs re-applying since the
+// previous check at s, or "" if it does not, and records now in s. Wall
+// clock time is compared because the monotonic clock stops while the
+// host sleeps on most platforms.
+func (e *Engine) hostNetworkChanged(s *hostNetState, now time.Time) string {
+	gap := now.Round(0).Sub(s.lastCheck.Round(0))
+	s.lastCheck = now
+	fp, err := e.hostFingerprint(e.Config.TAPName)
+	if err != nil {
+		e.Logger.Error("check host network: %v", err)
+		return ""
+	}
+	changed := fp != s.fingerprint
+	s.fingerprint = fp
+	switch {
+	case gap > tapCheckInterval+wakeGap:
+		return "host woke from sleep"
+	case changed:
+		return "host network interfaces changed"
+	}
+	return ""
+}
+
+// reassertNetwork re-applies the host routes, DNS settings, and firewall
+// rules through the VM after a host network change, which may have
+// restored the original default route or resolvers (e.g. a Wi-Fi
+// reconnect). The failsafe blocks host traffic in the meantime. If the
+// routes cannot be applied, the TAP device has likely lost its
+// configuration too and is rebuilt as in recoverTAP, whose result is
+// returned.
+func (e *Engine) reassertNetwork(reason string) (bool, error) {
+	e.Logger.Info("%s: re-applying host routing through the VM", reason)
+	e.FailSafe.Activate()
+
+	hostIP, vmIP, _, err := e.linkAddrs()
+	if err != nil {
+		return false, err
+	}
+	if err := e.setupHostRouting(vmIP); err != nil {
+		e.Logger.Error("re-apply host routing: %v; rebuilding TAP device", err)
+		e.Network.DestroyTAP(e.Config.TAPName)
+		return e.recoverTAP()
+	}
+	if err := e.verifyRoutes(e.Config.TAPName, hostIP, vmIP); err != nil {
+		return false, fmt.Errorf("route verification failed, traffic would bypass Tor: %w", err)
+	}
+	if err := e.Network.FlushDNS(); err != nil {
+		e.Logger.Error("flush DNS failed (non-fatal): %v", err)
+	}
+	e.FailSafe.Deactivate()
+	e.Logger.Info("host routing re-applied")
+	return true, nil
+}
+
+// nicReplugger is implemented by VM controllers that can hot-plug a new
+// NIC into the running VM.
+type nicReplugger interface {
+	ReplugNIC() error
+}
+
+// recoverTAP recreates a TAP device that vanished while the VM runs (e.g.
+// deleted by another tool), re-applies the host routes through it, and
+// hot-plugs a new NIC into the VM, so Tor keeps its state instead of
+// re-bootstrapping. The failsafe blocks host traffic in the meantime.
+// Returns false if the VM cannot take the new NIC and must be restarted.
+func (e *Engine) recoverTAP() (bool, error) {
+	e.Logger.Error("TAP device %s disappeared, recreating it", e.Config.TAPName)
+	e.FailSafe.Activate()
+
+	hostIP, vmIP, mask, err := e.linkAddrs()
+	if err != nil {
+		return false, err
+	}
+	err = e.Network.CreateTAP(e.Config.TAPName, hostIP, vmIP, mask, e.Config.MTU)
+	e.networkOp("recreate TAP", err)
+	if err != nil {
+		return false, fmt.Errorf("recreate TAP: %w", err)
+	}
+	if err := e.setupHostRouting(vmIP); err != nil {
+		return false, err
+	}
+
+	r, ok := e.VM.(nicReplugger)
+	if !ok {
+		e.Logger.Info("TAP recovery: NIC hot-plug unavailable, restarting VM")
+		return false, nil
+	}
+	if err := r.ReplugNIC(); err != nil {
+		e.Logger.Error("TAP recovery: %v; restarting VM", err)
+		return false, nil
+	}
+	if err := e.verifyRoutes(e.Config.TAPName, hostIP, vmIP); err != nil {
+		return false, fmt.Errorf("route verification failed, traffic would bypass Tor: %w", err)
+	}
+	e.FailSafe.Deactivate()
+	e.Logger.Info("TAP recovery: new NIC plugged into the running VM")
+	return true, nil
+}
+
+// RequestVMRestart asks a running engine to stop and relaunch the VM while
+// keeping the TAP device and host routing in place, so host traffic is
+// blackholed rather than leaked while the VM is down. hook, if non-nil,
+// runs while the VM is stopped (e.g. to check the state disk). Returns
+// false if the engine is not running or a restart is already pending.
+func (e *Engine) RequestVMRestart(hook func()) bool {
+	if e.State() != StateRunning {
+		return false
+	}
+	select {
+	case e.restartCh <- hook:
+		return true
+	default:
+		return false
+	}
+}
+
+// restartVM stops the VM, runs hook, and re-enters StateLaunchVM.
+func (e *Engine) restartVM(hook func()) {
+	e.Logger.Info("lifecycle: restarting VM")
+	e.closeTorControl()
+	stopCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := e.VM.Stop(stopCtx); err != nil {
+		e.Logger.Error("VM stop error: %v", err)
+	}
+	if hook != nil {
+		hook()
+	}
+	e.transition(StateLaunchVM)
+}
+
+// restartAfterCrash relaunches the VM after it crashed while running, as
+// allowed by the restart policy, keeping the failsafe active and host
+// routing in place. doLaunchVM waits out the backoff first. It returns
+// false when the policy is disabled or exhausted, or the VM was killed by
+// an emergency stop.
+func (e *Engine) restartAfterCrash() bool {
+	if e.FailSafe.IsHeld() {
+		return false
+	}
+	if e.clock.Since(e.runningSince) >= restartStableAfter {
+		e.crashRestarts = 0
+	}
+	if e.crashRestarts >= e.Restart.MaxRetries {
+		if e.Restart.MaxRetries > 0 {
+			e.Logger.Error("lifecycle: VM crashed %d times in a row, giving up", e.crashRestarts+1)
+		}
+		return false
+	}
+	e.launchDelay = e.Restart.delay(e.crashRestarts)
+	e.crashRestarts++
+	e.Logger.Info("lifecycle: relaunching VM in %v (restart %d/%d)", e.launchDelay, e.crashRestarts, e.Restart.MaxRetries)
+	e.restartVM(nil)
+	return true
+}
+
+// EmergencyStop is the panic button. It blocks host traffic with the
+// failsafe, kills QEMU without a guest shutdown and, with wipe, erases
+// the state disk. The firewall rules outlive the session (see
+// FailSafe.Hold). Callers still cancel the Run context to end the
+// session.
+func (e *Engine) EmergencyStop(wipe bool) error {
+	e.Logger.Error("EMERGENCY STOP requested")
+	e.requestShutdown(ShutdownEmergency)
+	e.FailSafe.Hold()
+	if err := e.VM.Kill(); err != nil {
+		return fmt.Errorf("emergency stop: kill VM: %w", err)
+	}
+	if !wipe {
+		return nil
+	}
+
+	// The kill is asynchronous; QEMU must have let go of the image.
+	deadline := e.clock.Now().Add(5 * time.Second)
+	for e.VM.IsRunning() {
+		if e.clock.Now().After(deadline) {
+			return fmt.Errorf("emergency stop: VM still running, state disk not wiped")
+		}
+		e.clock.Sleep(50 * time.Millisecond)
+	}
+	if err := vm.WipeStateDisk(e.Config.StateDiskPath); err != nil {
+		return fmt.Errorf("emergency stop: %w", err)
+	}
+	e.Logger.Info("emergency stop: state disk wiped")
+	return nil
+}
+
+// ActiveStreams returns the number of open Tor streams, or 0 when the
+// control connection is not available.
+func (e *Engine) ActiveStreams() (int, error) {
+	tc := e.TorControl
+	if tc == nil {
+		return 0, nil
+	}
+	streams, err := tc.GetStreams()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, s := range streams {
+		if s.IsOpen() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (e *Engine) doShutdown(ctx context.Context) error {
+	e.closeTorControl()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// A paused guest cannot act on the shutdown request.
+	if e.paused {
+		if err := e.VM.(vmPauser).Resume(); err != nil {
+			e.Logger.Error("resume VM for shutdown: %v", err)
+		}
+		e.paused = false
+	}
 	if e.VM.IsRunning() {
 		if err := e.VM.Stop(shutdownCtx); err != nil {
 			e.Logger.Error("VM stop error: %v", err)
@@ -538,19 +1931,37 @@ func (e *Engine) doShutdown(ctx context.Context) error {
 }
 
 func (e *Engine) doRestoreNetwork() error {
+	if err := e.Network.UnrouteSharedClients(); err != nil {
+		e.Logger.Error("remove shared client rules failed: %v", err)
+	}
+	if err := e.Network.TeardownLANRoutes(); err != nil {
+		e.Logger.Error("teardown LAN routes failed: %v", err)
+	}
+	if err := e.Network.UnblockDNSLeaks(); err != nil {
+		e.Logger.Error("remove DNS leak rules failed: %v", err)
+	}
+	if err := e.Network.TeardownIPv6(); err != nil {
+		e.Logger.Error("teardown ipv6 failed: %v", err)
+	}
 	if err := e.Network.TeardownRouting(); err != nil {
 		e.Logger.Error("teardown routing failed: %v", err)
+		e.networkOp("teardown routing", err)
 		// Activate failsafe to block unprotected traffic if routing
 		// teardown fails, since traffic may still be flowing without
 		// Tor protection.
 		e.FailSafe.Activate()
 	}
 
+	var restoreErr error
 	if e.savedNet != nil {
-		if err := e.Network.RestoreConfig(e.savedNet); err != nil {
-			e.Logger.Error("restore network failed: %v", err)
+		if restoreErr = e.Network.RestoreConfig(e.savedNet); restoreErr != nil {
+			e.Logger.Error("restore network failed: %v", restoreErr)
+			e.failure = errors.Join(e.failure, fmt.Errorf("restore network: %w", restoreErr))
 		}
 	}
+	e.networkOp("restore network", restoreErr)
+
+	e.routed = false
 
 	e.Network.DestroyTAP(e.Config.TAPName)
 	e.transition(StateCleanup)
@@ -558,18 +1969,45 @@ func (e *Engine) doRestoreNetwork() error {
 }
 
 func (e *Engine) doCleanup() error {
-	e.FailSafe.Deactivate()
+	if e.FailSafe.Release() {
+		// The rules outlive the session; keep its record so the next
+		// start removes them (or, with the kill switch, re-arms).
+		e.recordChange(network.ChangeFirewall)
+	} else if e.Session != nil {
+		if err := e.Session.Clear(); err != nil {
+			e.Logger.Error("crash recovery: %v", err)
+		}
+	}
+	e.session = nil
+	if e.Config.WipeOnExit {
+		e.wipeEphemeral()
+	}
+	e.endSession()
 	e.Logger.Info("lifecycle: cleanup complete")
 	return nil
 }
 
-func checkPrivileges() error {
-	if runtime.GOOS == "windows" {
-		// Windows privilege check is handled by the OS when creating TAP adapters.
-		return nil
+// wipeEphemeral shreds what the session leaves behind that could show
+// how Tor was used: the torrc overlay and guest firewall policy on the
+// state disk, and temporaries beside it. It is best effort; failures are
+// logged.
+func (e *Engine) wipeEphemeral() {
+	if e.VM.IsRunning() {
+		e.Logger.Error("wipe on exit: VM still running, nothing wiped")
+		return
 	}
-	if os.Getuid() != 0 {
-		return fmt.Errorf("must run as root (current uid=%d)", os.Getuid())
+	disk := e.Config.StateDiskPath
+	if _, err := os.Stat(disk); err == nil {
+		if err := vm.ShredStateDiskConfig(disk); err != nil {
+			e.Logger.Error("wipe on exit: %v", err)
+		}
 	}
-	return nil
+	items, err := storage.Ephemeral(disk)
+	if err == nil {
+		err = storage.Shred(items)
+	}
+	if err != nil {
+		e.Logger.Error("wipe on exit: %v", err)
+	}
+	e.Logger.Info("wipe on exit: torrc overlay and %d temporaries shredded", len(items))
 }
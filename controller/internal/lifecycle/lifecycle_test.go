@@ -1,16 +1,27 @@
 package lifecycle
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/user/extorvm/controller/internal/clock"
 	"github.com/user/extorvm/controller/internal/config"
 	"github.com/user/extorvm/controller/internal/network"
+	"github.com/user/extorvm/controller/internal/privexec"
 	"github.com/user/extorvm/controller/internal/testutil"
+	"github.com/user/extorvm/controller/internal/tor"
+	"github.com/user/extorvm/controller/internal/vm"
 )
 
 // mockVM implements VMController for testing.
@@ -22,6 +33,12 @@ type mockVM struct {
 	waitCh     chan error // closed/sent when VM "exits"
 	startCount int
 	stopCount  int
+	killCount  int
+
+	pid         int
+	attachErr   error
+	attachCount int
+	attachedPID int
 }
 
 func newMockVM() *mockVM {
@@ -50,6 +67,31 @@ func (m *mockVM) Stop(ctx context.Context) error {
 	return nil
 }
 
+func (m *mockVM) Kill() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.killCount++
+	m.running = false
+	return nil
+}
+
+func (m *mockVM) PID() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pid
+}
+
+func (m *mockVM) Attach(pid int, qmpPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attachCount++
+	if m.attachErr != nil {
+		return m.attachErr
+	}
+	m.running, m.attachedPID = true, pid
+	return nil
+}
+
 func (m *mockVM) IsRunning() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -83,6 +125,9 @@ type mockNetwork struct {
 	setupRoutingErr  error
 	teardownErr      error
 	flushDNSErr      error
+	purgeErr         error
+	blockErr         error
+	shareErr         error
 
 	createTAPCount     int
 	destroyTAPCount    int
@@ -91,9 +136,22 @@ type mockNetwork struct {
 	setupRoutingCount  int
 	teardownCount      int
 	flushDNSCount      int
+	purgeCount         int
+	blockCount         int
+	unblockCount       int
+	dnsBlockCount      int
+	dnsUnblockCount    int
+	shareCount         int
+	unshareCount       int
+
+	routingOpts network.RoutingOptions
+	blockOpts   network.BlockOptions
+	purgeOpts   network.PurgeOptions
+	dnsOpts     network.DNSBlockOptions
+	shareOpts   network.SharingOptions
 }
 
-func (m *mockNetwork) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask) error {
+func (m *mockNetwork) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask, mtu int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.createTAPCount++
@@ -124,10 +182,11 @@ func (m *mockNetwork) RestoreConfig(cfg *network.SavedConfig) error {
 	return m.restoreConfigErr
 }
 
-func (m *mockNetwork) SetupRouting(tapName string, vmIP net.IP) error {
+func (m *mockNetwork) SetupRouting(tapName string, opts network.RoutingOptions) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.setupRoutingCount++
+	m.routingOpts = opts
 	return m.setupRoutingErr
 }
 
@@ -138,6 +197,22 @@ func (m *mockNetwork) TeardownRouting() error {
 	return m.teardownErr
 }
 
+func (m *mockNetwork) SetupIPv6(tapName string, opts network.IPv6Options) error {
+	return nil
+}
+
+func (m *mockNetwork) TeardownIPv6() error {
+	return nil
+}
+
+func (m *mockNetwork) SetupLANRoutes(tapName string, vmIP net.IP, ranges []*net.IPNet) error {
+	return nil
+}
+
+func (m *mockNetwork) TeardownLANRoutes() error {
+	return nil
+}
+
 func (m *mockNetwork) FlushDNS() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -145,6 +220,59 @@ func (m *mockNetwork) FlushDNS() error {
 	return m.flushDNSErr
 }
 
+func (m *mockNetwork) BlockTraffic(opts network.BlockOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blockCount++
+	m.blockOpts = opts
+	return m.blockErr
+}
+
+func (m *mockNetwork) UnblockTraffic() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unblockCount++
+	return nil
+}
+
+func (m *mockNetwork) BlockDNSLeaks(opts network.DNSBlockOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dnsBlockCount++
+	m.dnsOpts = opts
+	return nil
+}
+
+func (m *mockNetwork) UnblockDNSLeaks() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dnsUnblockCount++
+	return nil
+}
+
+func (m *mockNetwork) RouteSharedClients(opts network.SharingOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shareCount++
+	m.shareOpts = opts
+	return m.shareErr
+}
+
+func (m *mockNetwork) UnrouteSharedClients() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unshareCount++
+	return nil
+}
+
+func (m *mockNetwork) PurgeArtifacts(opts network.PurgeOptions) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purgeCount++
+	m.purgeOpts = opts
+	return nil, m.purgeErr
+}
+
 // testConfig returns a minimal valid config for lifecycle tests.
 func testConfig() *config.Config {
 	return &config.Config{
@@ -168,9 +296,18 @@ func newTestEngine() (*Engine, *mockVM, *mockNetwork) {
 	e := NewEngineWithDeps(cfg, logger, vm, net)
 	// Disable all retries for deterministic tests.
 	e.retryPolicy = map[State]*RetryPolicy{}
+	e.verifyRoutes = skipVerifyRoutes
+	e.tapPresent = func(string) bool { return true }
+	e.hostFingerprint = func(string) (string, error) { return "eth0 up 192.168.1.2/24", nil }
+	e.detectSharing = func() ([]network.SharedInterface, error) { return nil, nil }
+	e.checkAccess = func() error { return nil }
 	return e, vm, net
 }
 
+// skipVerifyRoutes stands in for network.VerifyRoutes, which inspects the
+// real host routing table.
+func skipVerifyRoutes(string, net.IP, net.IP) error { return nil }
+
 func TestNewEngineWithDeps(t *testing.T) {
 	e, vm, net := newTestEngine()
 	if e.VM != vm {
@@ -226,6 +363,17 @@ func TestStateString(t *testing.T) {
 	}
 }
 
+func TestParseState(t *testing.T) {
+	for s := StateInit; s <= StatePaused; s++ {
+		if got, ok := ParseState(s.String()); !ok || got != s {
+			t.Errorf("ParseState(%q) = %v, %v", s.String(), got, ok)
+		}
+	}
+	if _, ok := ParseState("Bogus"); ok {
+		t.Error("ParseState(\"Bogus\") succeeded")
+	}
+}
+
 func TestDoSaveNetwork(t *testing.T) {
 	e, _, _ := newTestEngine()
 	e.state = StateSaveNetwork
@@ -254,6 +402,232 @@ func TestDoSaveNetworkError(t *testing.T) {
 	}
 }
 
+func TestSessionRecordedAndRecovered(t *testing.T) {
+	store, err := network.NewSessionStore(t.TempDir(), "torvm:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _, _ := newTestEngine()
+	e.Session = store
+	if err := e.doSaveNetwork(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.doCreateTAP(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash: the record is left behind by another process.
+	rec, err := store.Load()
+	if err != nil || rec == nil {
+		t.Fatalf("Load = %v, %v; want the running session", rec, err)
+	}
+	if len(rec.Changes) != 1 || rec.Changes[0] != network.ChangeTAP || rec.Saved == nil ||
+		rec.State != StateLaunchVM.String() || rec.HostIP != e.Config.HostIP {
+		t.Fatalf("recorded session = %+v", rec)
+	}
+	rec.PID = 0
+	if err := store.Save(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	next, _, net := newTestEngine()
+	next.Session = store
+	next.Config.KillSwitch = true
+	if _, err := next.recoverSession(); err != nil {
+		t.Fatalf("recoverSession: %v", err)
+	}
+	if net.purgeCount != 1 || net.restoreConfigCount != 1 {
+		t.Errorf("purges = %d, restores = %d; want 1, 1", net.purgeCount, net.restoreConfigCount)
+	}
+	if !net.purgeOpts.KeepFirewall || net.purgeOpts.TAPName != "tap0" {
+		t.Errorf("purge options = %+v; want kill switch rules kept on tap0", net.purgeOpts)
+	}
+	if rec, _ := store.Load(); rec != nil {
+		t.Error("session record not cleared after recovery")
+	}
+}
+
+// crashedSession stores the record of a session whose controller died in
+// state, leaving its VM (pid 4343) behind.
+func crashedSession(t *testing.T, state State) *network.SessionStore {
+	t.Helper()
+	store, err := network.NewSessionStore(t.TempDir(), "torvm:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig()
+	err = store.Save(&network.Session{
+		State:   state.String(),
+		TAPName: cfg.TAPName,
+		HostIP:  "10.10.20.2",
+		VMIP:    "10.10.20.1",
+		Routes:  []string{"0.0.0.0/0"},
+		QEMUPID: 4343,
+		QMPPath: "/run/torvm/qmp.sock",
+		Saved:   &network.SavedConfig{Data: []byte("{}"), Platform: "test"},
+		Changes: []string{network.ChangeTAP, network.ChangeRouting},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestRecoverSessionReattachesRunningVM(t *testing.T) {
+	e, vm, net := newTestEngine()
+	e.Session = crashedSession(t, StateRunning)
+	reattached, err := e.recoverSession()
+	if err != nil || !reattached {
+		t.Fatalf("recoverSession = %v, %v; want reattached", reattached, err)
+	}
+	if vm.attachedPID != 4343 || vm.stopCount != 0 {
+		t.Errorf("attached pid %d, stops %d; want 4343, 0", vm.attachedPID, vm.stopCount)
+	}
+	// Routes and rules are purged for re-applying; the TAP stays with the
+	// VM and the original configuration is kept for the shutdown.
+	if net.purgeCount != 1 || !net.purgeOpts.KeepTAP || net.restoreConfigCount != 0 {
+		t.Errorf("purges = %d (%+v), restores = %d; want 1 keeping the TAP, 0",
+			net.purgeCount, net.purgeOpts, net.restoreConfigCount)
+	}
+	if e.savedNet == nil || e.Config.VMIP != "10.10.20.1" || e.Config.HostIP != "10.10.20.2" {
+		t.Errorf("adopted session: savedNet %v, link %s/%s", e.savedNet, e.Config.HostIP, e.Config.VMIP)
+	}
+	rec, err := e.Session.Load()
+	if err != nil || rec == nil || rec.PID != os.Getpid() {
+		t.Errorf("session record = %+v, %v; want it owned by this process", rec, err)
+	}
+}
+
+func TestRecoverSessionStopsInterruptedVM(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   State
+		tapGone bool
+	}{
+		{"shutting down", StateShutdown, false},
+		{"bootstrapping", StateWaitBootstrap, false},
+		{"TAP gone", StateRunning, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, vm, net := newTestEngine()
+			e.Session = crashedSession(t, tt.state)
+			e.tapPresent = func(string) bool { return !tt.tapGone }
+			reattached, err := e.recoverSession()
+			if err != nil || reattached {
+				t.Fatalf("recoverSession = %v, %v; want cleanup", reattached, err)
+			}
+			if vm.stopCount != 1 {
+				t.Errorf("VM stops = %d, want 1", vm.stopCount)
+			}
+			if net.purgeOpts.KeepTAP || net.restoreConfigCount != 1 {
+				t.Errorf("purge %+v, restores %d; want a full recovery", net.purgeOpts, net.restoreConfigCount)
+			}
+		})
+	}
+}
+
+func TestRecoverSessionVMGone(t *testing.T) {
+	e, vm, net := newTestEngine()
+	e.Session = crashedSession(t, StateRunning)
+	vm.attachErr = errors.New("process 4343: no such process")
+	if reattached, err := e.recoverSession(); err != nil || reattached {
+		t.Fatalf("recoverSession = %v, %v; want cleanup", reattached, err)
+	}
+	if vm.stopCount != 0 || net.restoreConfigCount != 1 {
+		t.Errorf("stops = %d, restores = %d; want 0, 1", vm.stopCount, net.restoreConfigCount)
+	}
+}
+
+func TestRecoverSessionLiveInstance(t *testing.T) {
+	store, err := network.NewSessionStore(t.TempDir(), "torvm:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&network.Session{PID: os.Getppid()}); err != nil {
+		t.Fatal(err)
+	}
+	e, _, net := newTestEngine()
+	e.Session = store
+	if _, err := e.recoverSession(); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("recoverSession = %v, want already running error", err)
+	}
+	if net.purgeCount != 0 {
+		t.Error("artifacts of a live session were purged")
+	}
+}
+
+func TestWipeOnExit(t *testing.T) {
+	e, _, _ := newTestEngine()
+	dir := t.TempDir()
+	e.Config.StateDiskPath = filepath.Join(dir, "state.img")
+	leftover := filepath.Join(dir, "torvm-overlay-1")
+	if err := os.WriteFile(leftover, []byte("Bridge 192.0.2.1:443\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.doCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(leftover); err != nil {
+		t.Fatalf("leftover removed without wipe_on_exit: %v", err)
+	}
+
+	e.Config.WipeOnExit = true
+	if err := e.doCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("leftover not shredded: %v", err)
+	}
+}
+
+func TestEmergencyStop(t *testing.T) {
+	store, err := network.NewSessionStore(t.TempDir(), "torvm:test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, vm, net := newTestEngine()
+	e.Session = store
+	e.Config.StateDiskPath = filepath.Join(t.TempDir(), "state.img")
+	if err := os.WriteFile(e.Config.StateDiskPath, []byte("tor state"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.doSaveNetwork(); err != nil {
+		t.Fatal(err)
+	}
+	vm.running = true
+
+	if err := e.EmergencyStop(true); err != nil {
+		t.Fatalf("EmergencyStop: %v", err)
+	}
+	if vm.killCount != 1 || !e.FailSafe.IsActive() || net.blockCount != 1 {
+		t.Errorf("kills = %d, failsafe active = %v, blocks = %d; want 1, true, 1", vm.killCount, e.FailSafe.IsActive(), net.blockCount)
+	}
+	if _, err := os.Stat(e.Config.StateDiskPath); !os.IsNotExist(err) {
+		t.Errorf("state disk not wiped: %v", err)
+	}
+
+	// The rules outlive the session, and its record stays so the next
+	// start removes them.
+	if err := e.doCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if net.unblockCount != 0 {
+		t.Error("cleanup removed the emergency stop rules")
+	}
+	rec, err := store.Load()
+	if err != nil || rec == nil || !slices.Contains(rec.Changes, network.ChangeFirewall) {
+		t.Fatalf("session record after cleanup = %+v, %v; want firewall change kept", rec, err)
+	}
+	if _, err := e.recoverSession(); err != nil {
+		t.Fatal(err)
+	}
+	if net.purgeCount != 1 || e.FailSafe.IsActive() {
+		t.Errorf("after recovery: purges = %d, failsafe active = %v; want 1, false", net.purgeCount, e.FailSafe.IsActive())
+	}
+}
+
 func TestDoCreateTAP(t *testing.T) {
 	e, _, _ := newTestEngine()
 	e.state = StateCreateTAP
@@ -276,6 +650,23 @@ func TestDoCreateTAPError(t *testing.T) {
 	}
 }
 
+func TestDoCreateTAPSubnetConflict(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateCreateTAP
+	e.Config.AutoSubnet = true
+	e.hostNetworks = func(string) ([]*net.IPNet, error) {
+		_, vpn, _ := net.ParseCIDR("10.0.0.0/8")
+		return []*net.IPNet{vpn}, nil
+	}
+
+	if err := e.doCreateTAP(); err != nil {
+		t.Fatal(err)
+	}
+	if e.Config.HostIP != "172.16.0.2" || e.Config.VMIP != "172.16.0.1" {
+		t.Errorf("relocated to host %s vm %s, want 172.16.0.2 / 172.16.0.1", e.Config.HostIP, e.Config.VMIP)
+	}
+}
+
 func TestDoLaunchVM(t *testing.T) {
 	e, _, _ := newTestEngine()
 	e.state = StateLaunchVM
@@ -320,96 +711,435 @@ func TestDoRunningVMExit(t *testing.T) {
 	if e.FailSafe.IsActive() {
 		t.Error("failsafe should not be active on normal exit")
 	}
+	if r := e.ShutdownReason(); r != ShutdownVMExit {
+		t.Errorf("ShutdownReason = %v, want vm_exit", r)
+	}
 }
 
-func TestDoRunningVMUnexpectedExit(t *testing.T) {
-	e, vm, _ := newTestEngine()
+func TestDoRunningMaintenanceRestart(t *testing.T) {
+	e, vm, net := newTestEngine()
 	e.state = StateRunning
+	vm.running = true
 
-	ctx := context.Background()
-	go func() {
-		time.Sleep(50 * time.Millisecond)
-		vm.SimulateExit(fmt.Errorf("crash"))
-	}()
+	hookRan := false
+	if !e.RequestVMRestart(func() { hookRan = true }) {
+		t.Fatal("RequestVMRestart refused while running")
+	}
+	if e.RequestVMRestart(nil) {
+		t.Error("second RequestVMRestart should be refused while one is pending")
+	}
 
-	if err := e.doRunning(ctx); err != nil {
+	if err := e.doRunning(context.Background()); err != nil {
 		t.Fatal(err)
 	}
-	if !e.FailSafe.IsActive() {
-		t.Error("failsafe should be active on unexpected VM exit")
+	if e.state != StateLaunchVM {
+		t.Errorf("state = %v, want StateLaunchVM", e.state)
+	}
+	if !hookRan {
+		t.Error("restart hook did not run")
+	}
+	if vm.stopCount != 1 {
+		t.Errorf("stopCount = %d, want 1", vm.stopCount)
+	}
+	if net.teardownCount != 0 {
+		t.Error("routing must stay in place across a maintenance restart")
 	}
 }
 
-func TestDoRunningContextCancel(t *testing.T) {
-	e, _, _ := newTestEngine()
-	e.state = StateRunning
+// replugVM is a mockVM that supports NIC hot-plug.
+type replugVM struct {
+	*mockVM
+	replugs int
+}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		time.Sleep(50 * time.Millisecond)
-		cancel()
-	}()
+func (v *replugVM) ReplugNIC() error {
+	v.replugs++
+	v.waitCh <- nil // end doRunning
+	return nil
+}
 
-	if err := e.doRunning(ctx); err != nil {
+func TestDoRunningRecoversTAP(t *testing.T) {
+	defer func(d time.Duration) { tapCheckInterval = d }(tapCheckInterval)
+	tapCheckInterval = time.Millisecond
+
+	e, mvm, net := newTestEngine()
+	rvm := &replugVM{mockVM: mvm}
+	e.VM = rvm
+	e.state = StateRunning
+	mvm.running = true
+	checks := 0
+	e.tapPresent = func(string) bool { checks++; return checks > 1 }
+
+	if err := e.doRunning(context.Background()); err != nil {
 		t.Fatal(err)
 	}
+	if net.createTAPCount != 1 || net.setupRoutingCount != 1 || rvm.replugs != 1 {
+		t.Errorf("createTAP = %d, setupRouting = %d, replugs = %d; want 1 each",
+			net.createTAPCount, net.setupRoutingCount, rvm.replugs)
+	}
+	if mvm.stopCount != 0 || e.FailSafe.IsActive() {
+		t.Errorf("stopCount = %d, failsafe active = %v; want the VM kept and traffic unblocked",
+			mvm.stopCount, e.FailSafe.IsActive())
+	}
 	if e.state != StateShutdown {
 		t.Errorf("state = %v, want StateShutdown", e.state)
 	}
-}
-
-func TestDoShutdown(t *testing.T) {
-	e, vm, _ := newTestEngine()
-	e.state = StateShutdown
-	vm.running = true
 
-	ctx := context.Background()
-	if err := e.doShutdown(ctx); err != nil {
+	// Without hot-plug the VM is restarted on the recreated TAP.
+	e, mvm, net = newTestEngine()
+	e.state = StateRunning
+	mvm.running = true
+	e.tapPresent = func(string) bool { return false }
+	if err := e.doRunning(context.Background()); err != nil {
 		t.Fatal(err)
 	}
-	if e.state != StateRestoreNetwork {
-		t.Errorf("state = %v, want StateRestoreNetwork", e.state)
-	}
-
-	vm.mu.Lock()
-	stopped := vm.stopCount
-	vm.mu.Unlock()
-	if stopped < 1 {
-		t.Error("Stop should have been called")
+	if net.createTAPCount != 1 || mvm.stopCount != 1 || e.state != StateLaunchVM {
+		t.Errorf("createTAP = %d, stopCount = %d, state = %v; want a VM restart",
+			net.createTAPCount, mvm.stopCount, e.state)
 	}
 }
 
-func TestDoRestoreNetwork(t *testing.T) {
-	e, _, net := newTestEngine()
-	e.state = StateRestoreNetwork
-	e.savedNet = &network.SavedConfig{Data: []byte("saved"), Platform: "test"}
+func TestDoRunningReassertsNetwork(t *testing.T) {
+	defer func(d time.Duration) { tapCheckInterval = d }(tapCheckInterval)
+	tapCheckInterval = time.Millisecond
 
-	if err := e.doRestoreNetwork(); err != nil {
-		t.Fatal(err)
-	}
-	if e.state != StateCleanup {
-		t.Errorf("state = %v, want StateCleanup", e.state)
+	e, mvm, net := newTestEngine()
+	e.Config.BlockDNSLeaks = true
+	e.state = StateRunning
+	e.routed = true
+	mvm.running = true
+	calls := 0
+	e.hostFingerprint = func(string) (string, error) {
+		calls++
+		if calls < 3 {
+			return "wlan0 up 192.168.1.2/24", nil
+		}
+		// Wi-Fi reconnected with a new lease; stop after re-applying.
+		mvm.waitCh <- nil
+		return "wlan0 up 192.168.7.9/24", nil
 	}
 
-	net.mu.Lock()
-	teardowns := net.teardownCount
-	restores := net.restoreConfigCount
-	destroys := net.destroyTAPCount
-	net.mu.Unlock()
-	if teardowns < 1 {
-		t.Error("TeardownRouting should have been called")
+	if err := e.doRunning(context.Background()); err != nil {
+		t.Fatal(err)
 	}
-	if restores < 1 {
-		t.Error("RestoreConfig should have been called")
+	if net.setupRoutingCount != 1 || net.teardownCount != 1 || net.dnsBlockCount != 1 || net.flushDNSCount != 1 {
+		t.Errorf("setupRouting = %d, teardown = %d, dnsBlock = %d, flushDNS = %d; want 1 each",
+			net.setupRoutingCount, net.teardownCount, net.dnsBlockCount, net.flushDNSCount)
 	}
-	if destroys < 1 {
-		t.Error("DestroyTAP should have been called")
+	if net.createTAPCount != 0 || mvm.stopCount != 0 || e.FailSafe.IsActive() {
+		t.Errorf("createTAP = %d, stopCount = %d, failsafe active = %v; want routing re-applied in place",
+			net.createTAPCount, mvm.stopCount, e.FailSafe.IsActive())
 	}
 }
 
-func TestDoCleanup(t *testing.T) {
+func TestHostNetworkChangedAfterWake(t *testing.T) {
 	e, _, _ := newTestEngine()
-	e.FailSafe.active = true
+	now := time.Now()
+	s := hostNetState{fingerprint: "eth0 up 192.168.1.2/24", lastCheck: now.Add(-tapCheckInterval)}
+	if reason := e.hostNetworkChanged(&s, now); reason != "" {
+		t.Errorf("unchanged network reported %q", reason)
+	}
+	s.lastCheck = now.Add(-time.Hour)
+	if reason := e.hostNetworkChanged(&s, now); reason != "host woke from sleep" {
+		t.Errorf("after an hour's gap got %q, want a wake", reason)
+	}
+}
+
+func TestDoRunningVMUnexpectedExit(t *testing.T) {
+	e, vm, _ := newTestEngine()
+	e.state = StateRunning
+	var exitErr error
+	e.OnVMExit(func(err error) { exitErr = err })
+
+	ctx := context.Background()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		vm.SimulateExit(fmt.Errorf("crash"))
+	}()
+
+	if err := e.doRunning(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !e.FailSafe.IsActive() {
+		t.Error("failsafe should be active on unexpected VM exit")
+	}
+	if exitErr == nil || exitErr.Error() != "crash" {
+		t.Errorf("VM exit observer got %v, want crash", exitErr)
+	}
+	if r := e.ShutdownReason(); r != ShutdownVMCrash {
+		t.Errorf("ShutdownReason = %v, want vm_crash", r)
+	}
+}
+
+func TestDoRunningRestartsAfterCrash(t *testing.T) {
+	e, vm, net := newTestEngine()
+	e.Restart = RestartPolicy{MaxRetries: 2, Backoff: time.Second}
+	exits := 0
+	e.OnVMExit(func(error) { exits++ })
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second} {
+		e.state = StateRunning
+		vm.SimulateExit(fmt.Errorf("crash"))
+		if err := e.doRunning(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if e.state != StateLaunchVM || e.launchDelay != want {
+			t.Fatalf("crash %d: state = %v, delay = %v; want StateLaunchVM after %v", i+1, e.state, e.launchDelay, want)
+		}
+		if !e.FailSafe.IsActive() {
+			t.Errorf("crash %d: failsafe must stay active until the VM runs again", i+1)
+		}
+	}
+	if vm.stopCount != 2 || net.teardownCount != 0 {
+		t.Errorf("stopCount = %d, teardownCount = %d; want the VM torn down and routing kept", vm.stopCount, net.teardownCount)
+	}
+
+	e.state = StateRunning
+	vm.SimulateExit(fmt.Errorf("crash"))
+	if err := e.doRunning(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StateShutdown {
+		t.Errorf("state after retries ran out = %v, want StateShutdown", e.state)
+	}
+	if exits != 3 {
+		t.Errorf("VM exit observers ran %d times, want 3", exits)
+	}
+
+	// A crash after a stable run starts counting afresh.
+	defer func(d time.Duration) { restartStableAfter = d }(restartStableAfter)
+	restartStableAfter = 0
+	e.state = StateRunning
+	vm.SimulateExit(fmt.Errorf("crash"))
+	e.doRunning(context.Background())
+	if e.state != StateLaunchVM || e.launchDelay != time.Second {
+		t.Errorf("crash after a stable run: state = %v, delay = %v", e.state, e.launchDelay)
+	}
+}
+
+func TestDoRunningNoRestartAfterEmergencyStop(t *testing.T) {
+	e, vm, _ := newTestEngine()
+	e.Restart = RestartPolicy{MaxRetries: 3, Backoff: time.Second}
+	e.state = StateRunning
+	vm.running = true
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if err := e.EmergencyStop(false); err != nil {
+			t.Error(err)
+		}
+		vm.SimulateExit(fmt.Errorf("killed"))
+	}()
+	if err := e.doRunning(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StateShutdown {
+		t.Errorf("state = %v, want StateShutdown", e.state)
+	}
+	if r := e.ShutdownReason(); r != ShutdownEmergency {
+		t.Errorf("ShutdownReason = %v, want emergency_stop rather than a crash", r)
+	}
+}
+
+func TestDoLaunchVMWaitsOutRestartBackoff(t *testing.T) {
+	e, vm, _ := newTestEngine()
+	e.state = StateLaunchVM
+	e.launchDelay = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.doLaunchVM(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if vm.startCount != 0 {
+		t.Error("VM started before the backoff elapsed")
+	}
+
+	if d := (RestartPolicy{Backoff: time.Minute}).delay(10); d != maxRestartBackoff {
+		t.Errorf("delay(10) = %v, want the %v cap", d, maxRestartBackoff)
+	}
+}
+
+func TestDoLaunchVMRelaunchesAfterBackoff(t *testing.T) {
+	e, vm, _ := newTestEngine()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	e.clock = clk
+	e.state = StateLaunchVM
+	e.launchDelay = time.Minute
+	done := make(chan error, 1)
+	go func() { done <- e.doLaunchVM(context.Background()) }()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute - time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("doLaunchVM returned %v before the backoff elapsed", err)
+	default:
+	}
+	clk.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if vm.startCount != 1 || e.state != StateWaitTAP || e.launchDelay != 0 {
+		t.Errorf("startCount = %d, state = %v, delay = %v; want the VM launched once the backoff elapsed",
+			vm.startCount, e.state, e.launchDelay)
+	}
+}
+
+// pausableVM is a mockVM that supports Pause and Resume.
+type pausableVM struct {
+	*mockVM
+	pauses, resumes int
+}
+
+func (v *pausableVM) Pause() error  { v.pauses++; return nil }
+func (v *pausableVM) Resume() error { v.resumes++; return nil }
+
+func TestPauseResume(t *testing.T) {
+	e, mvm, net := newTestEngine()
+	pv := &pausableVM{mockVM: mvm}
+	e.VM = pv
+	e.Config.PauseUnroute = true
+	e.routed = true
+
+	if err := e.Resume(); err == nil {
+		t.Error("Resume accepted while not paused")
+	}
+
+	e.state = StateRunning
+	done := make(chan error, 1)
+	go func() { done <- e.doRunning(context.Background()) }()
+	if err := e.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StatePaused || pv.pauses != 1 || !e.paused {
+		t.Fatalf("after Pause: state = %v, pauses = %d", e.state, pv.pauses)
+	}
+	if net.teardownCount != 1 || e.routed {
+		t.Errorf("PauseUnroute: teardownCount = %d, routed = %v; want routing withdrawn", net.teardownCount, e.routed)
+	}
+
+	setups := net.setupRoutingCount
+	go func() { done <- e.doPaused(context.Background()) }()
+	if err := e.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StateRunning || pv.resumes != 1 || e.paused {
+		t.Errorf("after Resume: state = %v, resumes = %d", e.state, pv.resumes)
+	}
+	if net.setupRoutingCount != setups+1 || !e.routed {
+		t.Errorf("routing not re-applied on resume")
+	}
+}
+
+func TestPauseUnsupported(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateRunning
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.doRunning(ctx) }()
+	if err := e.Pause(); err == nil {
+		t.Error("Pause succeeded on a VM without pause support")
+	}
+	cancel()
+	<-done
+	if e.paused {
+		t.Error("engine marked paused after a failed Pause")
+	}
+}
+
+func TestShutdownResumesPausedVM(t *testing.T) {
+	e, mvm, _ := newTestEngine()
+	pv := &pausableVM{mockVM: mvm}
+	e.VM = pv
+	e.state = StateShutdown
+	e.paused = true
+	mvm.running = true
+	if err := e.doShutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pv.resumes != 1 || mvm.stopCount != 1 {
+		t.Errorf("resumes = %d, stopCount = %d; want the guest resumed, then stopped", pv.resumes, mvm.stopCount)
+	}
+}
+
+func TestDoRunningContextCancel(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateRunning
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	if err := e.doRunning(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StateShutdown {
+		t.Errorf("state = %v, want StateShutdown", e.state)
+	}
+	if r := e.ShutdownReason(); r != ShutdownUser {
+		t.Errorf("ShutdownReason = %v, want user", r)
+	}
+}
+
+func TestDoShutdown(t *testing.T) {
+	e, vm, _ := newTestEngine()
+	e.state = StateShutdown
+	vm.running = true
+
+	ctx := context.Background()
+	if err := e.doShutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StateRestoreNetwork {
+		t.Errorf("state = %v, want StateRestoreNetwork", e.state)
+	}
+
+	vm.mu.Lock()
+	stopped := vm.stopCount
+	vm.mu.Unlock()
+	if stopped < 1 {
+		t.Error("Stop should have been called")
+	}
+}
+
+func TestDoRestoreNetwork(t *testing.T) {
+	e, _, net := newTestEngine()
+	e.state = StateRestoreNetwork
+	e.savedNet = &network.SavedConfig{Data: []byte("saved"), Platform: "test"}
+
+	if err := e.doRestoreNetwork(); err != nil {
+		t.Fatal(err)
+	}
+	if e.state != StateCleanup {
+		t.Errorf("state = %v, want StateCleanup", e.state)
+	}
+
+	net.mu.Lock()
+	teardowns := net.teardownCount
+	restores := net.restoreConfigCount
+	destroys := net.destroyTAPCount
+	net.mu.Unlock()
+	if teardowns < 1 {
+		t.Error("TeardownRouting should have been called")
+	}
+	if restores < 1 {
+		t.Error("RestoreConfig should have been called")
+	}
+	if destroys < 1 {
+		t.Error("DestroyTAP should have been called")
+	}
+}
+
+func TestDoCleanup(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.FailSafe.active = true
 
 	err := e.doCleanup()
 	if err != nil {
@@ -420,6 +1150,254 @@ func TestDoCleanup(t *testing.T) {
 	}
 }
 
+func TestSessionReport(t *testing.T) {
+	e, _, _ := newTestEngine()
+	start := time.Now().Add(-time.Hour)
+	e.stats.reset(start)
+
+	// A fake Tor control port that accepts SETEVENTS and sends events.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 256)
+		conn.Read(buf)
+		fmt.Fprint(conn, "250 OK\r\n"+
+			"650 CIRC 1 LAUNCHED PURPOSE=GENERAL\r\n"+
+			"650 CIRC 1 BUILT $AAAA~relay PURPOSE=GENERAL\r\n"+
+			"650 BW 1024 512\r\n"+
+			"650 BW 2048 0\r\n")
+		conn.Read(buf)
+	}()
+	client, err := tor.NewControlClient(ln.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.TorControl = client
+	e.torWatchStop = make(chan struct{})
+	go e.watchTor(client, e.torWatchStop)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r := e.stats.finish(time.Now())
+		if r.Circuits == 1 && r.BytesRead == 3072 && r.BytesWritten == 512 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events not counted: %+v", r)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if bw, ok := e.Bandwidth(); !ok || bw != (tor.BandwidthStats{BytesRead: 2048}) {
+		t.Errorf("Bandwidth() = %+v, %v; want the last BW event", bw, ok)
+	}
+	e.closeTorControl()
+
+	e.vmExited(fmt.Errorf("exit status 1"))
+	var got *SessionReport
+	e.OnSessionEnd(func(r SessionReport) { got = &r })
+	if err := e.doCleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("session end observer not called")
+	}
+	if !got.Start.Equal(start) || got.Duration() < time.Hour {
+		t.Errorf("Start = %v, Duration = %v", got.Start, got.Duration())
+	}
+	if got.ErrorCount != 1 || !slices.Equal(got.Errors, []string{"VM exited unexpectedly: exit status 1"}) {
+		t.Errorf("ErrorCount = %d, Errors = %q", got.ErrorCount, got.Errors)
+	}
+	want := ", 3.0 KiB received, 512 B sent, 0 new identities, 1 circuit, 1 error"
+	if s := got.Summary(); !strings.HasPrefix(s, "1h0m") || !strings.HasSuffix(s, want) {
+		t.Errorf("Summary() = %q, want 1h0m...%q", s, want)
+	}
+}
+
+// nethelperStub stands in for torvm-nethelper: it answers, or is not
+// running.
+type nethelperStub struct{ running bool }
+
+func (h nethelperStub) RunOps([]privexec.Op) (string, error) {
+	if !h.running {
+		return "", fmt.Errorf("nethelper: %w", privexec.ErrNoElevator)
+	}
+	return "", nil
+}
+
+func TestRunAsUserWithHelper(t *testing.T) {
+	for _, running := range []bool{true, false} {
+		e, _, _ := newTestEngine()
+		e.Config.DNSPort, e.Config.TransPort = 9053, 9040
+		// The run ends once the check is done.
+		ctx, cancel := context.WithCancel(context.Background())
+		e.checkAccess = func() error {
+			defer cancel()
+			return privexec.Access(false, nethelperStub{running})
+		}
+		err := e.Run(ctx)
+		if running && err != nil {
+			t.Errorf("non-root with a helper: Run = %v", err)
+		}
+		if !running && !errors.Is(err, privexec.ErrNoAccess) {
+			t.Errorf("non-root, helper not running: Run = %v, want %v", err, privexec.ErrNoAccess)
+		}
+	}
+}
+
+func TestEngineRunsAgain(t *testing.T) {
+	e, _, _ := newTestEngine()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e.State() != StateCleanup {
+		t.Fatalf("state after run = %v, want StateCleanup", e.State())
+	}
+
+	// Leftovers of a session that ended badly.
+	e.savedNet = &network.SavedConfig{}
+	e.routed = true
+	e.attempts[StateLaunchVM] = 2
+	e.crashRestarts = 3
+	e.restartCh <- nil
+
+	e.active.Store(true)
+	if err := e.Reset(); err == nil {
+		t.Error("Reset succeeded while running")
+	}
+	if err := e.Run(ctx); err == nil {
+		t.Error("second concurrent Run succeeded")
+	}
+	e.active.Store(false)
+
+	var states []State
+	e.OnStateChange(func(_, to State) { states = append(states, to) })
+	if err := e.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if e.State() != StateInit || e.savedNet != nil || e.routed || len(e.attempts) != 0 || e.crashRestarts != 0 || len(e.restartCh) != 0 {
+		t.Errorf("state after Reset = %v, savedNet = %v, routed = %v, attempts = %v, crashRestarts = %d, pending restarts = %d",
+			e.State(), e.savedNet, e.routed, e.attempts, e.crashRestarts, len(e.restartCh))
+	}
+	if err := e.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(states) < 2 || states[0] != StateInit || states[len(states)-1] != StateCleanup {
+		t.Errorf("second run went through %v, want StateInit ... StateCleanup", states)
+	}
+}
+
+// startRunning begins a run of e from StateRunning, with the VM up and
+// the host network saved, as if the run had got there by itself.
+func startRunning(t *testing.T, e *Engine, vm *mockVM) <-chan error {
+	t.Helper()
+	ctx, err := e.begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Start(ctx)
+	e.state = StateRunning
+	e.savedNet = &network.SavedConfig{}
+	done := make(chan error, 1)
+	go func() { done <- e.run(ctx) }()
+	return done
+}
+
+func TestStop(t *testing.T) {
+	e, vm, net := newTestEngine()
+	e.Restart = RestartPolicy{}
+	ctx := context.Background()
+	if err := <-e.Stop(ctx); !errors.Is(err, ErrNotRunning) {
+		t.Fatalf("Stop before Run: err = %v, want ErrNotRunning", err)
+	}
+
+	done := startRunning(t, e, vm)
+	if err := <-e.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Run after Stop = %v, want nil", err)
+	}
+	if e.State() != StateCleanup || vm.stopCount != 1 || net.restoreConfigCount != 1 {
+		t.Errorf("state = %v, VM stops = %d, network restores = %d; want an orderly shutdown",
+			e.State(), vm.stopCount, net.restoreConfigCount)
+	}
+	if r := e.ShutdownReason(); r != ShutdownUser {
+		t.Errorf("ShutdownReason after Stop = %v, want user", r)
+	}
+	if err := <-e.Stop(ctx); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Stop after Run: err = %v, want ErrNotRunning", err)
+	}
+
+	// A stop that cannot restore the host network is not clean.
+	net.restoreConfigErr = errors.New("netsh failed")
+	done = startRunning(t, e, vm)
+	if err := <-e.Stop(ctx); err == nil || !strings.Contains(err.Error(), "restore network: netsh failed") {
+		t.Errorf("Stop with restore failure: err = %v", err)
+	}
+	<-done
+	net.restoreConfigErr = nil
+
+	// StopFor reports its reason, and the first stop's reason stands.
+	done = startRunning(t, e, vm)
+	stopped := e.StopFor(ctx, ShutdownSignal)
+	e.Stop(ctx)
+	<-stopped
+	<-done
+	if r := e.ShutdownReason(); r != ShutdownSignal {
+		t.Errorf("ShutdownReason after StopFor = %v, want signal", r)
+	}
+
+	// Neither is a session that ends without being asked to.
+	done = startRunning(t, e, vm)
+	vm.SimulateExit(errors.New("crash"))
+	if err := <-done; err == nil || err.Error() != "lifecycle: VM exited unexpectedly: crash" {
+		t.Errorf("Run after VM exit = %v", err)
+	}
+	if r := e.ShutdownReason(); r != ShutdownVMCrash || r.ExitCode() == 0 {
+		t.Errorf("ShutdownReason after VM exit = %v (exit code %d), want vm_crash", r, r.ExitCode())
+	}
+}
+
+func TestShutdownReason(t *testing.T) {
+	timeout := fmt.Errorf("%w after %v", ErrBootstrapTimeout, time.Minute)
+	if r := failureReason(fmt.Errorf("%s failed: %w", StateWaitBootstrap, timeout)); r != ShutdownBootstrapTimeout {
+		t.Errorf("failureReason(bootstrap timeout) = %v", r)
+	}
+	if r := failureReason(errors.New("route check failed")); r != ShutdownFailsafe {
+		t.Errorf("failureReason(other) = %v", r)
+	}
+
+	codes := map[int]ShutdownReason{}
+	for r := ShutdownNone; r <= ShutdownEmergency; r++ {
+		text, _ := r.MarshalText()
+		var back ShutdownReason
+		if err := back.UnmarshalText(text); err != nil || back != r {
+			t.Errorf("%v: round trip through %q gave %v, %v", r, text, back, err)
+		}
+		code := r.ExitCode()
+		if code == 0 {
+			continue
+		}
+		if other, dup := codes[code]; dup || code < 3 {
+			t.Errorf("%v: exit code %d also used by %v or reserved", r, code, other)
+		}
+		codes[code] = r
+	}
+	if ShutdownUser.ExitCode() != 0 || ShutdownSignal.ExitCode() != 0 {
+		t.Error("a requested stop must exit with status 0")
+	}
+}
+
 func TestDoFlushDNS(t *testing.T) {
 	e, _, _ := newTestEngine()
 	e.state = StateFlushDNS
@@ -456,6 +1434,182 @@ func TestDoConfigureTAPError(t *testing.T) {
 	}
 }
 
+func TestDoConfigureTAPUsesConfiguredDNS(t *testing.T) {
+	e, _, net := newTestEngine()
+	e.state = StateConfigureTAP
+	e.Config.DNS1 = e.Config.VMIP
+	e.Config.DNS2 = "9.9.9.9"
+
+	if err := e.doConfigureTAP(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := net.routingOpts
+	if opts.VMIP.String() != e.Config.VMIP {
+		t.Errorf("VMIP = %v, want %s", opts.VMIP, e.Config.VMIP)
+	}
+	if len(opts.DNS) != 2 || opts.DNS[0].String() != e.Config.VMIP || opts.DNS[1].String() != "9.9.9.9" {
+		t.Errorf("DNS = %v, want [%s 9.9.9.9]", opts.DNS, e.Config.VMIP)
+	}
+}
+
+func TestDoConfigureTAPArmsKillSwitch(t *testing.T) {
+	e, _, net := newTestEngine()
+	e.state = StateConfigureTAP
+	e.Config.KillSwitch = true
+
+	if err := e.doConfigureTAP(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if net.blockCount != 1 || !net.blockOpts.KillSwitch {
+		t.Errorf("BlockTraffic calls = %d, opts = %+v; want kill switch installed", net.blockCount, net.blockOpts)
+	}
+
+	net.blockErr = fmt.Errorf("nft: not found")
+	e.state = StateConfigureTAP
+	if err := e.doConfigureTAP(); err == nil {
+		t.Error("doConfigureTAP succeeded without the kill switch")
+	}
+}
+
+func TestDoConfigureTAPBlocksDNSLeaks(t *testing.T) {
+	e, _, net := newTestEngine()
+	e.state = StateConfigureTAP
+	e.Config.BlockDNSLeaks = true
+	e.Config.IPv6.Mode = network.IPv6Route
+	e.Config.IPv6.VMIP = "fd10:10:10::1"
+	e.Config.DNS1, e.Config.DNS2 = "4.2.2.4", "4.2.2.2"
+
+	if err := e.doConfigureTAP(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if net.dnsBlockCount != 1 || net.dnsOpts.VMIP.String() != "10.10.10.1" || net.dnsOpts.VMIPv6.String() != "fd10:10:10::1" {
+		t.Errorf("BlockDNSLeaks calls = %d, opts = %+v", net.dnsBlockCount, net.dnsOpts)
+	}
+	// The TAP's resolvers, the Windows defaults, stay reachable.
+	if len(net.dnsOpts.DNS) != 2 || net.dnsOpts.DNS[0].String() != e.Config.DNS1 || net.dnsOpts.DNS[1].String() != e.Config.DNS2 {
+		t.Errorf("BlockDNSLeaks DNS = %v, want [%s %s]", net.dnsOpts.DNS, e.Config.DNS1, e.Config.DNS2)
+	}
+
+	// Relaunch: the rules are replaced along with the routes.
+	e.Config.IPv6.Mode = network.IPv6Block
+	e.state = StateConfigureTAP
+	if err := e.doConfigureTAP(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if net.dnsUnblockCount != 1 || net.dnsBlockCount != 2 || net.dnsOpts.VMIPv6 != nil {
+		t.Errorf("relaunch: unblock = %d, block = %d, opts = %+v", net.dnsUnblockCount, net.dnsBlockCount, net.dnsOpts)
+	}
+
+	e.state = StateRestoreNetwork
+	if err := e.doRestoreNetwork(); err != nil {
+		t.Fatal(err)
+	}
+	if net.dnsUnblockCount != 2 {
+		t.Errorf("UnblockDNSLeaks calls after restore = %d, want 2", net.dnsUnblockCount)
+	}
+}
+
+func TestCheckSharing(t *testing.T) {
+	hotspot := []network.SharedInterface{{Name: "wlan1", Kind: "hotspot"}}
+	tests := []struct {
+		mode       string
+		shared     []network.SharedInterface
+		detectErr  error
+		wantErr    bool
+		wantEvents int
+	}{
+		{"warn", nil, nil, false, 0},
+		{"warn", hotspot, nil, false, 1},
+		{"refuse", hotspot, nil, true, 0},
+		{"refuse", nil, fmt.Errorf("nmcli not found"), false, 0},
+		{"route", hotspot, nil, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.mode, len(tt.shared)), func(t *testing.T) {
+			e, _, _ := newTestEngine()
+			e.Config.Sharing.Mode = tt.mode
+			e.detectSharing = func() ([]network.SharedInterface, error) { return tt.shared, tt.detectErr }
+			var events []Event
+			e.Events.Subscribe(func(ev Event) {
+				if ev.Kind == EventSharing {
+					events = append(events, ev)
+				}
+			})
+
+			err := e.checkSharing()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(events) != tt.wantEvents {
+				t.Fatalf("sharing events = %d, want %d", len(events), tt.wantEvents)
+			}
+			if len(events) == 1 {
+				if events[0].Summary != "wlan1 (hotspot)" || events[0].Active != (tt.mode == "route") {
+					t.Errorf("event = %+v", events[0])
+				}
+			}
+		})
+	}
+}
+
+func TestDoConfigureTAPRoutesSharedClients(t *testing.T) {
+	e, _, net := newTestEngine()
+	e.Config.Sharing.Mode = "route"
+	e.shared = []network.SharedInterface{{Name: "wlan1", Kind: "hotspot"}}
+	e.state = StateConfigureTAP
+
+	if err := e.doConfigureTAP(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if net.shareCount != 1 || net.shareOpts.TAPName != "tap0" || len(net.shareOpts.Shared) != 1 {
+		t.Errorf("RouteSharedClients calls = %d, opts = %+v", net.shareCount, net.shareOpts)
+	}
+
+	e.state = StateRestoreNetwork
+	if err := e.doRestoreNetwork(); err != nil {
+		t.Fatal(err)
+	}
+	if net.unshareCount != 1 {
+		t.Errorf("UnrouteSharedClients calls = %d, want 1", net.unshareCount)
+	}
+}
+
+func TestDoVerifyRoutes(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateVerifyRoutes
+	var gotTAP, gotVM string
+	e.verifyRoutes = func(tap string, hostIP, vmIP net.IP) error {
+		gotTAP, gotVM = tap, vmIP.String()
+		return nil
+	}
+
+	if err := e.doVerifyRoutes(); err != nil {
+		t.Fatal(err)
+	}
+	if gotTAP != e.Config.TAPName || gotVM != e.Config.VMIP {
+		t.Errorf("verifyRoutes called with %q, %q", gotTAP, gotVM)
+	}
+	if e.state != StateFlushDNS {
+		t.Errorf("state = %v, want StateFlushDNS", e.state)
+	}
+}
+
+func TestDoVerifyRoutesLeak(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateVerifyRoutes
+	e.verifyRoutes = func(string, net.IP, net.IP) error {
+		return fmt.Errorf("traffic to 9.9.9.9 leaves via 192.168.1.1 dev wlan0")
+	}
+
+	err := e.doVerifyRoutes()
+	if err == nil || !strings.Contains(err.Error(), "bypass Tor") {
+		t.Errorf("expected route verification error, got %v", err)
+	}
+	if e.state != StateVerifyRoutes {
+		t.Errorf("state = %v, want to stay in StateVerifyRoutes", e.state)
+	}
+}
+
 func TestDoRestoreNetworkTeardownFailure(t *testing.T) {
 	e, _, net := newTestEngine()
 	e.state = StateRestoreNetwork
@@ -475,7 +1629,7 @@ func TestReloadConfigNoChanges(t *testing.T) {
 	e.state = StateRunning
 
 	newCfg := testConfig()
-	if err := e.ReloadConfig(newCfg); err != nil {
+	if _, err := e.ReloadConfig(newCfg); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -486,7 +1640,7 @@ func TestReloadConfigHotReloadableWithoutTorControl(t *testing.T) {
 
 	newCfg := testConfig()
 	newCfg.Verbose = true
-	if err := e.ReloadConfig(newCfg); err != nil {
+	if _, err := e.ReloadConfig(newCfg); err != nil {
 		t.Fatal(err)
 	}
 	// Config should be updated even without TorControl.
@@ -495,13 +1649,159 @@ func TestReloadConfigHotReloadableWithoutTorControl(t *testing.T) {
 	}
 }
 
+// fakeTorConf serves a Tor control port that answers GETCONF from conf
+// and applies SETCONF to it, and returns a client for it.
+func fakeTorConf(t *testing.T, conf map[string][]string) *tor.ControlClient {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			switch cmd {
+			case "GETCONF":
+				for _, k := range strings.Fields(args) {
+					for _, v := range conf[k] {
+						fmt.Fprintf(conn, "250-%s=%s\r\n", k, v)
+					}
+				}
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "SETCONF":
+				for args != "" {
+					k, rest, _ := strings.Cut(args, "=")
+					var v string
+					if strings.HasPrefix(rest, `"`) {
+						end := 1
+						for end < len(rest) && rest[end] != '"' {
+							if rest[end] == '\\' {
+								end++
+							}
+							end++
+						}
+						v, _ = strconv.Unquote(rest[:end+1])
+						rest = rest[min(end+1, len(rest)):]
+					} else {
+						v, rest, _ = strings.Cut(rest, " ")
+					}
+					conf[k] = []string{v}
+					if v == "" {
+						delete(conf, k)
+					}
+					args = strings.TrimLeft(rest, " ")
+				}
+				fmt.Fprint(conn, "250 OK\r\n")
+			default:
+				fmt.Fprint(conn, "250 OK\r\n")
+			}
+		}
+	}()
+	client, err := tor.NewControlClient(ln.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestReloadConfigAckAfterPush(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateRunning
+	e.Config.Proxy = config.ProxyConfig{Type: "socks5", Address: "192.0.2.1:1080"}
+	overlay, err := e.Config.TorrcOverlay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tor as the guest started it, with the overlay of the config.
+	conf := map[string][]string{
+		"ContactInfo": {ackOverlayPrefix + vm.OverlaySum(overlay)},
+		"Socks5Proxy": {"192.0.2.1:1080"},
+	}
+	e.TorControl = fakeTorConf(t, conf)
+
+	newCfg := e.Config.Clone()
+	newCfg.Proxy.Address = "192.0.2.2:1080"
+	if _, err := e.ReloadConfig(newCfg); err != nil {
+		t.Fatal(err)
+	}
+	ack, err := readConfigAck(e.TorControl, e.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ack.Current || len(ack.Problems) != 0 || ack.Proxy != "socks5 192.0.2.2:1080" {
+		t.Errorf("after a live push: ack = %+v, want the pushed overlay current", ack)
+	}
+}
+
+func TestReloadConfigRemovesTorrcExtra(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.state = StateRunning
+	e.Config.TorrcExtra = []string{"NumEntryGuards 2", "NewCircuitPeriod 60"}
+	e.applied = e.Config.Clone()
+	conf := map[string][]string{
+		"NumEntryGuards":   {"2"},
+		"NewCircuitPeriod": {"60"},
+		"SafeSocks":        {"1"}, // from the VM's base torrc
+	}
+	e.TorControl = fakeTorConf(t, conf)
+
+	newCfg := e.Config.Clone()
+	newCfg.TorrcExtra = []string{"NewCircuitPeriod 60"}
+	if _, err := e.ReloadConfig(newCfg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := e.TorControl.GetConf("NumEntryGuards", "NewCircuitPeriod", "SafeSocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := got["NumEntryGuards"]; ok {
+		t.Errorf("NumEntryGuards = %v after its line was removed, want it reset", v)
+	}
+	if v := got["NewCircuitPeriod"]; len(v) != 1 || v[0] != "60" {
+		t.Errorf("NewCircuitPeriod = %v, want [60]", v)
+	}
+	if v := got["SafeSocks"]; len(v) != 1 || v[0] != "1" {
+		t.Errorf("SafeSocks = %v, want the base torrc's [1] left alone", v)
+	}
+
+	// A base torrc directive cannot be overridden, and so never reset.
+	newCfg = e.Config.Clone()
+	newCfg.TorrcExtra = []string{"SafeSocks 0"}
+	if err := newCfg.Validate(); err == nil {
+		t.Error("TorrcExtra may override the base torrc's SafeSocks")
+	}
+}
+
+func TestAckContactInfo(t *testing.T) {
+	fw := ackFirewallPrefix + strings.Repeat("f", 64)
+	old := []string{ackOverlayPrefix + strings.Repeat("0", 64) + " " + fw}
+	if got, want := ackContactInfo(old, "UseBridges 1\n"), ackOverlayPrefix+vm.OverlaySum("UseBridges 1\n")+" "+fw; got != want {
+		t.Errorf("ackContactInfo = %q, want %q", got, want)
+	}
+	if got := ackContactInfo(old, ""); got != fw {
+		t.Errorf("ackContactInfo with no overlay = %q, want %q", got, fw)
+	}
+}
+
 func TestReloadConfigRestartRequired(t *testing.T) {
 	e, _, _ := newTestEngine()
 	e.state = StateRunning
 
 	newCfg := testConfig()
 	newCfg.VMMemoryMB = 256
-	if err := e.ReloadConfig(newCfg); err != nil {
+	if _, err := e.ReloadConfig(newCfg); err != nil {
 		t.Fatal(err)
 	}
 	// Config pointer should be updated.
@@ -510,6 +1810,142 @@ func TestReloadConfigRestartRequired(t *testing.T) {
 	}
 }
 
+func TestReloadConfigHeldForNextRun(t *testing.T) {
+	e, _, _ := newTestEngine()
+	e.active.Store(true) // a run is in progress
+
+	newCfg := testConfig()
+	newCfg.Verbose = true
+	newCfg.VMMemoryMB = 512
+	newCfg.TAPName = "tap9"
+	newCfg.APISocket = "/run/torvm/api.sock"
+	diff, err := e.ReloadConfig(newCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.HotReloadable) != 1 || len(diff.RestartRequired) != 2 || len(diff.RestartNow) != 1 {
+		t.Errorf("diff = %+v", diff)
+	}
+	// The run keeps its TAP and VM; the rest is taken at once.
+	if e.Config.TAPName != "tap0" || e.Config.VMMemoryMB != 0 {
+		t.Errorf("next-start changes applied mid-run: TAP %s, memory %d", e.Config.TAPName, e.Config.VMMemoryMB)
+	}
+	if !e.Config.Verbose || e.Config.APISocket != newCfg.APISocket {
+		t.Errorf("live and restart changes not kept: %+v", e.Config)
+	}
+
+	// The same file again is no change.
+	if diff, _ := e.ReloadConfig(newCfg.Clone()); diff.HasChanges() {
+		t.Errorf("reloading the same config: %+v", diff)
+	}
+
+	e.active.Store(false)
+	e.applyPending()
+	if e.Config.TAPName != "tap9" || e.Config.VMMemoryMB != 512 {
+		t.Errorf("next run did not take the held changes: TAP %s, memory %d", e.Config.TAPName, e.Config.VMMemoryMB)
+	}
+}
+
+func TestReloadConfigEditedInPlace(t *testing.T) {
+	e, _, _ := newTestEngine()
+
+	// The GUI settings edit Config itself before reloading it.
+	e.Config.VMMemoryMB = 512
+	diff, err := e.ReloadConfig(e.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.RestartRequired) != 1 || !strings.HasPrefix(diff.RestartRequired[0], "VMMemoryMB ") {
+		t.Errorf("diff = %+v, want VMMemoryMB for the next start", diff)
+	}
+	if diff, _ := e.ReloadConfig(e.Config); diff.HasChanges() {
+		t.Errorf("second reload: %+v", diff)
+	}
+}
+
+// throttleVM is a mockVM that records disk throttle requests.
+type throttleVM struct {
+	*mockVM
+	throttles []config.DiskConfig
+}
+
+func (v *throttleVM) SetDiskThrottle(d config.DiskConfig) error {
+	v.throttles = append(v.throttles, d)
+	return nil
+}
+
+func TestReloadConfigDiskThrottle(t *testing.T) {
+	e, mvm, _ := newTestEngine()
+	tvm := &throttleVM{mockVM: mvm}
+	e.VM = tvm
+	e.state = StateRunning
+	mvm.running = true
+
+	newCfg := testConfig()
+	newCfg.Disk.WriteMBps = 10
+	if _, err := e.ReloadConfig(newCfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(tvm.throttles) != 1 || tvm.throttles[0].WriteMBps != 10 {
+		t.Errorf("throttles = %+v, want one with WriteMBps 10", tvm.throttles)
+	}
+
+	// Unchanged limits are not re-sent.
+	again := testConfig()
+	again.Disk.WriteMBps = 10
+	again.Verbose = true
+	if _, err := e.ReloadConfig(again); err != nil {
+		t.Fatal(err)
+	}
+	if len(tvm.throttles) != 1 {
+		t.Errorf("throttle re-applied without a change: %+v", tvm.throttles)
+	}
+}
+
+// scaleVM is a mockVM that supports adding vCPUs.
+type scaleVM struct {
+	*mockVM
+	vcpus int
+}
+
+func (v *scaleVM) SetVCPUs(n int) (int, error) {
+	if n < v.vcpus {
+		return v.vcpus, fmt.Errorf("removing vCPUs from a running VM is not supported")
+	}
+	v.vcpus = n
+	return n, nil
+}
+
+func TestReloadConfigVCPUs(t *testing.T) {
+	e, mvm, _ := newTestEngine()
+	svm := &scaleVM{mockVM: mvm, vcpus: 2}
+	e.VM = svm
+	e.state = StateRunning
+	mvm.running = true
+	e.Config.VMCPUs = 2
+
+	newCfg := testConfig()
+	newCfg.VMCPUs = 4
+	if _, err := e.ReloadConfig(newCfg); err != nil {
+		t.Fatal(err)
+	}
+	if svm.vcpus != 4 {
+		t.Errorf("vcpus = %d after scale up, want 4", svm.vcpus)
+	}
+
+	// Scaling down waits for a restart, with the reason.
+	e.Config.VMCPUs = 1
+	err := e.ApplyVCPUs()
+	if err == nil || !strings.Contains(err.Error(), "keeps 4 vCPUs") {
+		t.Errorf("ApplyVCPUs after scale down = %v", err)
+	}
+
+	e.VM = mvm
+	if err := e.ApplyVCPUs(); err == nil {
+		t.Error("ApplyVCPUs succeeded without CPU hot-plug")
+	}
+}
+
 func TestParseTorrcOverlay(t *testing.T) {
 	overlay := "UseBridges 1\nClientTransportPlugin obfs4 exec /usr/bin/obfs4proxy\n"
 	directives := parseTorrcOverlay(overlay)
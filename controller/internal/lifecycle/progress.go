@@ -0,0 +1,54 @@
+package lifecycle
+
+// StepProgress describes how far a session has come in starting up, for
+// progress bars. It accompanies the state events of the startup states,
+// Tor's bootstrap progress, and retries of a startup state.
+type StepProgress struct {
+	Step        int    `json:"step"`              // 1-based position of the state in the startup sequence
+	Steps       int    `json:"steps"`             // number of startup states
+	Percent     int    `json:"percent"`           // overall startup progress, 0-100
+	Description string `json:"description"`       // what the state does, e.g. "Creating the TAP device"
+	Retries     int    `json:"retries,omitempty"` // failed attempts at the state so far
+}
+
+// startupSteps are the states a session passes through before it runs,
+// with the overall progress at which each begins. Tor's bootstrap, which
+// usually takes longest, fills the rest of the bar.
+var startupSteps = []struct {
+	state   State
+	desc    string
+	percent int
+}{
+	{StateCheckPrivileges, "Checking privileges", 0},
+	{StateSaveNetwork, "Saving the network configuration", 3},
+	{StateCreateTAP, "Creating the TAP device", 6},
+	{StateLaunchVM, "Starting the VM", 10},
+	{StateWaitTAP, "Waiting for the VM to boot", 15},
+	{StateConfigureTAP, "Configuring host networking", 30},
+	{StateVerifyRoutes, "Verifying routes", 34},
+	{StateFlushDNS, "Flushing the DNS cache", 37},
+	{StateWaitBootstrap, "Connecting to Tor", 40},
+}
+
+// stepProgress returns the startup progress in state s after retries
+// failed attempts, with Tor bootstrapped to bootstrap percent. It returns
+// nil for states outside the startup sequence.
+func stepProgress(s State, retries, bootstrap int) *StepProgress {
+	for i, st := range startupSteps {
+		if st.state != s {
+			continue
+		}
+		p := &StepProgress{
+			Step:        i + 1,
+			Steps:       len(startupSteps),
+			Percent:     st.percent,
+			Description: st.desc,
+			Retries:     retries,
+		}
+		if s == StateWaitBootstrap {
+			p.Percent += (100 - st.percent) * min(max(bootstrap, 0), 100) / 100
+		}
+		return p
+	}
+	return nil
+}
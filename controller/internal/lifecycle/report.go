@@ -0,0 +1,193 @@
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/tor"
+)
+
+// maxReportErrors bounds the error messages a SessionReport keeps; later
+// errors are only counted.
+const maxReportErrors = 20
+
+// SessionReport summarizes what the gateway did in one session, from Run
+// starting to the clean shutdown. It holds counts only: no destinations,
+// relays, or addresses.
+type SessionReport struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	BytesRead    int64     `json:"bytes_read"`    // received through Tor, across VM restarts
+	BytesWritten int64     `json:"bytes_written"` // sent through Tor
+	Identities   int       `json:"identities"`    // successful New Identity requests
+	Circuits     int       `json:"circuits"`      // circuits Tor built
+	ErrorCount   int       `json:"error_count"`
+	Errors       []string  `json:"errors,omitempty"` // the first maxReportErrors error messages
+
+	ShutdownReason ShutdownReason `json:"shutdown_reason"`
+}
+
+// Duration returns how long the session lasted.
+func (r SessionReport) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// Summary formats the report as a single line.
+func (r SessionReport) Summary() string {
+	return fmt.Sprintf("%v, %s received, %s sent, %s, %s, %s",
+		r.Duration().Round(time.Second), FormatBytes(r.BytesRead), FormatBytes(r.BytesWritten),
+		plural(r.Identities, "new identity", "new identities"),
+		plural(r.Circuits, "circuit", "circuits"),
+		plural(r.ErrorCount, "error", "errors"))
+}
+
+// SessionEndObserver is called with the report of a session that shut
+// down cleanly.
+type SessionEndObserver func(SessionReport)
+
+// OnSessionEnd registers a callback for the end of a session.
+func (e *Engine) OnSessionEnd(fn SessionEndObserver) {
+	e.Events.Subscribe(func(ev Event) {
+		if ev.Kind == EventSession {
+			fn(*ev.Report)
+		}
+	})
+}
+
+// sessionStats accumulates the current session's report and holds Tor's
+// latest traffic rate. NewIdentity and the Tor event watcher update it
+// from their own goroutines.
+type sessionStats struct {
+	mu     sync.Mutex
+	report SessionReport
+	rate   tor.BandwidthStats // bytes in the second before rateAt
+	rateAt time.Time
+}
+
+func (s *sessionStats) reset(now time.Time) {
+	s.mu.Lock()
+	s.report = SessionReport{Start: now}
+	s.mu.Unlock()
+}
+
+func (s *sessionStats) update(fn func(r *SessionReport)) {
+	s.mu.Lock()
+	fn(&s.report)
+	s.mu.Unlock()
+}
+
+func (s *sessionStats) addError(err error) {
+	s.update(func(r *SessionReport) {
+		r.ErrorCount++
+		if len(r.Errors) < maxReportErrors {
+			r.Errors = append(r.Errors, err.Error())
+		}
+	})
+}
+
+// finish returns the report ended at now.
+func (s *sessionStats) finish(now time.Time) SessionReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.report
+	r.End = now
+	r.Errors = slices.Clone(r.Errors)
+	return r
+}
+
+// endSession logs the session report and publishes EventSession.
+func (e *Engine) endSession() {
+	r := e.stats.finish(e.clock.Now())
+	r.ShutdownReason = e.ShutdownReason()
+	e.Logger.Info("lifecycle: session report: %s", r.Summary())
+	e.Events.Publish(Event{Kind: EventSession, Report: &r})
+}
+
+// watchTor subscribes to Tor's circuit and bandwidth events on tc and
+// counts them into the session report, keeping the latest traffic rate
+// for Bandwidth, until stop is closed. BW events arrive every second, so
+// traffic is counted even when the VM crashes.
+func (e *Engine) watchTor(tc *tor.ControlClient, stop <-chan struct{}) {
+	if err := tc.SetEvents([]string{"CIRC", "BW"}); err != nil {
+		e.Logger.Error("tor control: subscribe to events (session report will be incomplete): %v", err)
+		return
+	}
+	for {
+		select {
+		case ev := <-tc.Events():
+			switch ev.Action {
+			case "CIRC":
+				// "CIRC <id> <status> ..."
+				if f := strings.Fields(ev.Lines[0]); len(f) >= 3 && f[2] == "BUILT" {
+					e.stats.update(func(r *SessionReport) { r.Circuits++ })
+				}
+			case "BW":
+				bw, err := tor.ParseBandwidthEvent(ev.Lines[0])
+				if err != nil {
+					continue
+				}
+				e.stats.mu.Lock()
+				e.stats.report.BytesRead += bw.BytesRead
+				e.stats.report.BytesWritten += bw.BytesWritten
+				e.stats.rate, e.stats.rateAt = bw, e.clock.Now()
+				e.stats.mu.Unlock()
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// bandwidthStale is how old Tor's last BW event may be for Bandwidth to
+// report it; Tor sends one every second.
+const bandwidthStale = 5 * time.Second
+
+// Bandwidth returns Tor's traffic rate in bytes per second, from its
+// latest BW event. It returns false while no recent event has arrived,
+// e.g. while the VM is down or paused.
+func (e *Engine) Bandwidth() (tor.BandwidthStats, bool) {
+	e.stats.mu.Lock()
+	defer e.stats.mu.Unlock()
+	if e.clock.Since(e.stats.rateAt) > bandwidthStale {
+		return tor.BandwidthStats{}, false
+	}
+	return e.stats.rate, true
+}
+
+// closeTorControl stops the Tor event watcher and closes the control
+// connection, if open.
+func (e *Engine) closeTorControl() {
+	if e.TorControl == nil {
+		return
+	}
+	if e.torWatchStop != nil {
+		close(e.torWatchStop)
+		e.torWatchStop = nil
+	}
+	e.TorControl.Close()
+	e.TorControl = nil
+}
+
+// FormatBytes formats a byte count with a binary unit, e.g. "3.2 MiB".
+func FormatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
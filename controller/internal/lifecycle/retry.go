@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"strings"
 	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
 )
 
 // RetryPolicy defines the retry behavior for a lifecycle state.
@@ -119,6 +121,12 @@ func DefaultRetryPolicy() map[State]*RetryPolicy {
 			MaxDelay:     15 * time.Second,
 			JitterFactor: 0.2,
 		},
+		StateVerifyRoutes: {
+			MaxAttempts:  3,
+			BaseDelay:    1 * time.Second,
+			MaxDelay:     5 * time.Second,
+			JitterFactor: 0.1,
+		},
 		StateFlushDNS: {
 			MaxAttempts:  2,
 			BaseDelay:    1 * time.Second,
@@ -127,3 +135,35 @@ func DefaultRetryPolicy() map[State]*RetryPolicy {
 		},
 	}
 }
+
+// RestartPolicy controls relaunching a VM that exits unexpectedly while
+// running. The failsafe stays active from the crash until the relaunched
+// VM is running again.
+type RestartPolicy struct {
+	MaxRetries int           // consecutive restarts before giving up; 0 disables
+	Backoff    time.Duration // wait before the first restart, doubled for each further one
+}
+
+// maxRestartBackoff caps the wait between crash restarts.
+const maxRestartBackoff = 5 * time.Minute
+
+// restartStableAfter is how long a VM must run before a crash no longer
+// counts as consecutive with the previous one.
+var restartStableAfter = 10 * time.Minute
+
+// delay returns the wait before restart n (counting from 0).
+func (p RestartPolicy) delay(n int) time.Duration {
+	d := p.Backoff << n
+	if d > maxRestartBackoff || d <= 0 {
+		d = maxRestartBackoff
+	}
+	return d
+}
+
+// restartPolicy returns the crash restart policy configured in c.
+func restartPolicy(c config.RetryConfig) RestartPolicy {
+	return RestartPolicy{
+		MaxRetries: c.RestartMaxRetries,
+		Backoff:    time.Duration(c.RestartBackoffSec) * time.Second,
+	}
+}
@@ -0,0 +1,140 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ShutdownReason is why a run shut down.
+type ShutdownReason int
+
+const (
+	ShutdownNone             ShutdownReason = iota // the run has not shut down, or failed before starting anything
+	ShutdownUser                                   // Stop, or the Run context was cancelled
+	ShutdownSignal                                 // the process was sent SIGINT or SIGTERM
+	ShutdownVMCrash                                // the VM exited with an error and was not restarted
+	ShutdownVMExit                                 // the VM powered off on its own
+	ShutdownBootstrapTimeout                       // Tor did not bootstrap in time
+	ShutdownFailsafe                               // a step failed for good and the failsafe engaged
+	ShutdownEmergency                              // EmergencyStop
+)
+
+var shutdownReasonNames = [...]string{
+	ShutdownNone:             "none",
+	ShutdownUser:             "user",
+	ShutdownSignal:           "signal",
+	ShutdownVMCrash:          "vm_crash",
+	ShutdownVMExit:           "vm_exit",
+	ShutdownBootstrapTimeout: "bootstrap_timeout",
+	ShutdownFailsafe:         "failsafe",
+	ShutdownEmergency:        "emergency_stop",
+}
+
+var shutdownReasonDescriptions = [...]string{
+	ShutdownNone:             "not shut down",
+	ShutdownUser:             "stopped on request",
+	ShutdownSignal:           "stopped by a signal",
+	ShutdownVMCrash:          "the VM crashed",
+	ShutdownVMExit:           "the VM powered off",
+	ShutdownBootstrapTimeout: "Tor did not connect in time",
+	ShutdownFailsafe:         "a startup or network step failed; traffic is blocked",
+	ShutdownEmergency:        "emergency stop",
+}
+
+// String returns the reason's name as used in JSON, e.g. "vm_crash".
+func (r ShutdownReason) String() string {
+	if r >= 0 && int(r) < len(shutdownReasonNames) {
+		return shutdownReasonNames[r]
+	}
+	return "unknown"
+}
+
+// Description returns the reason as a phrase for status text, e.g.
+// "the VM crashed".
+func (r ShutdownReason) Description() string {
+	if r >= 0 && int(r) < len(shutdownReasonDescriptions) {
+		return shutdownReasonDescriptions[r]
+	}
+	return "unknown reason"
+}
+
+// ExitCode returns the exit status of a headless controller whose session
+// shut down for r: 0 when it was asked to stop, otherwise a status per
+// reason from 3 up, so that scripts and service managers can tell them
+// apart (1 and 2 are general errors and usage errors).
+func (r ShutdownReason) ExitCode() int {
+	switch r {
+	case ShutdownNone, ShutdownUser, ShutdownSignal:
+		return 0
+	case ShutdownVMCrash:
+		return 3
+	case ShutdownVMExit:
+		return 4
+	case ShutdownBootstrapTimeout:
+		return 5
+	case ShutdownFailsafe:
+		return 6
+	case ShutdownEmergency:
+		return 7
+	}
+	return 1
+}
+
+// MarshalText encodes the reason by name.
+func (r ShutdownReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a reason encoded by MarshalText.
+func (r *ShutdownReason) UnmarshalText(text []byte) error {
+	for i, name := range shutdownReasonNames {
+		if name == string(text) {
+			*r = ShutdownReason(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("lifecycle: unknown shutdown reason %q", text)
+}
+
+// ErrBootstrapTimeout is wrapped by the error of a session whose Tor did
+// not bootstrap in time.
+var ErrBootstrapTimeout = errors.New("Tor bootstrap timeout")
+
+// ShutdownReason returns why the current or last run shut down, or
+// ShutdownNone while it has not.
+func (e *Engine) ShutdownReason() ShutdownReason {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+	return e.reason
+}
+
+// requestShutdown records the reason for a shutdown that is about to be
+// asked for, unless one already was.
+func (e *Engine) requestShutdown(reason ShutdownReason) {
+	e.runMu.Lock()
+	if e.requested == ShutdownNone {
+		e.requested = reason
+	}
+	e.runMu.Unlock()
+}
+
+// shutdown records why the run ends and moves to StateShutdown. A reason
+// asked for with StopFor or EmergencyStop wins: a step that fails or a VM
+// that exits as the run is being stopped is a consequence of the stop.
+func (e *Engine) shutdown(reason ShutdownReason) {
+	e.runMu.Lock()
+	if e.requested != ShutdownNone {
+		reason = e.requested
+	}
+	e.reason = reason
+	e.runMu.Unlock()
+	e.transition(StateShutdown)
+}
+
+// failureReason classifies a state's permanent failure.
+func failureReason(err error) ShutdownReason {
+	if errors.Is(err, ErrBootstrapTimeout) {
+		return ShutdownBootstrapTimeout
+	}
+	return ShutdownFailsafe
+}
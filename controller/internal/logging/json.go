@@ -63,6 +63,24 @@ func (j *JSONWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// WriteEvent emits a structured event that happened at ts as a line of
+// its own, {"ts":"...","level":"EVENT","event":...}, with event encoded
+// as JSON.
+func (j *JSONWriter) WriteEvent(ts time.Time, event any) error {
+	b, err := json.Marshal(struct {
+		Ts    string `json:"ts"`
+		Level string `json:"level"`
+		Event any    `json:"event"`
+	}{ts.UTC().Format("2006/01/02 15:04:05.000") + " UTC", "EVENT", event})
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.out.Write(append(b, '\n'))
+	return err
+}
+
 // parseLine extracts timestamp, level, and message from a standard log line.
 func parseLine(line string) jsonEntry {
 	// Expected format: [2006/01/02 15:04:05.000 UTC] LEVEL: message
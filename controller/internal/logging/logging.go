@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"sync"
 	"time"
 )
@@ -30,21 +31,34 @@ func (l Level) String() string {
 	}
 }
 
+// EntryWriter is a log output that takes each entry's time, level and
+// message as fields rather than as a formatted line, such as the systemd
+// journal. The logger calls WriteEntry instead of Write on writers that
+// implement it.
+type EntryWriter interface {
+	WriteEntry(t time.Time, lvl Level, msg string) error
+}
+
 // Logger provides thread-safe logging with configurable outputs.
 type Logger struct {
 	mu      sync.Mutex
 	level   Level
 	writers []io.Writer
+
+	// file and filePath track the optional log file so it can be rotated.
+	file     *os.File
+	filePath string
 }
 
 // Options configures the logger.
 type Options struct {
 	LogFile  string
 	Verbose  bool
+	NoStderr bool // omit stderr, e.g. while a TUI owns the terminal
 }
 
-// NewLogger creates a logger. It always writes to stderr.
-// If opts.LogFile is set, it also writes to that file.
+// NewLogger creates a logger. It writes to stderr unless opts.NoStderr
+// is set. If opts.LogFile is set, it also writes to that file.
 // If opts.Verbose is true, debug messages are included.
 func NewLogger(opts Options) (*Logger, error) {
 	level := LevelInfo
@@ -52,22 +66,57 @@ func NewLogger(opts Options) (*Logger, error) {
 		level = LevelDebug
 	}
 
-	writers := []io.Writer{os.Stderr}
+	var writers []io.Writer
+	if !opts.NoStderr {
+		writers = append(writers, os.Stderr)
+	}
 
+	var file *os.File
 	if opts.LogFile != "" {
 		f, err := os.OpenFile(opts.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 		if err != nil {
 			return nil, fmt.Errorf("open log file: %w", err)
 		}
 		writers = append(writers, f)
+		file = f
 	}
 
 	return &Logger{
-		level:   level,
-		writers: writers,
+		level:    level,
+		writers:  writers,
+		file:     file,
+		filePath: opts.LogFile,
 	}, nil
 }
 
+// Rotate renames the log file to "<path>.1", replacing any previous
+// rotation, and continues logging to a fresh file. It is a no-op when the
+// logger has no log file.
+func (l *Logger) Rotate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	if err := os.Rename(l.filePath, l.filePath+".1"); err != nil {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	f, err := os.OpenFile(l.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		// Keep writing to the renamed file rather than losing output.
+		return fmt.Errorf("reopen log file: %w", err)
+	}
+	for i, w := range l.writers {
+		if w == io.Writer(l.file) {
+			l.writers[i] = f
+		}
+	}
+	l.file.Close()
+	l.file = f
+	return nil
+}
+
 func (l *Logger) log(lvl Level, format string, args ...any) {
 	if lvl > l.level {
 		return
@@ -84,6 +133,10 @@ func (l *Logger) log(lvl Level, format string, args ...any) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	for _, w := range l.writers {
+		if ew, ok := w.(EntryWriter); ok {
+			_ = ew.WriteEntry(now, lvl, msg)
+			continue
+		}
 		_, _ = io.WriteString(w, line)
 	}
 }
@@ -95,6 +148,14 @@ func (l *Logger) AddWriter(w io.Writer) {
 	l.writers = append(l.writers, w)
 }
 
+// RemoveWriter stops logging to w, e.g. to stderr once the same lines
+// reach the journal natively.
+func (l *Logger) RemoveWriter(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.writers = slices.DeleteFunc(l.writers, func(x io.Writer) bool { return x == w })
+}
+
 // SetVerbose changes the log level at runtime. When verbose is true,
 // debug messages are included; otherwise only info and error are logged.
 func (l *Logger) SetVerbose(verbose bool) {
@@ -3,8 +3,11 @@ package logging
 import (
 	"bytes"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLevelString(t *testing.T) {
@@ -146,6 +149,42 @@ func TestAddWriter(t *testing.T) {
 	}
 }
 
+// entryRecorder is an EntryWriter that keeps what it is given.
+type entryRecorder struct {
+	bytes.Buffer // written to only if the logger treats it as a plain writer
+	levels       []Level
+	msgs         []string
+}
+
+func (r *entryRecorder) WriteEntry(_ time.Time, lvl Level, msg string) error {
+	r.levels = append(r.levels, lvl)
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func TestEntryWriterAndRemoveWriter(t *testing.T) {
+	var plain bytes.Buffer
+	rec := &entryRecorder{}
+	logger := &Logger{level: LevelInfo, writers: []io.Writer{&plain, rec}}
+
+	logger.Error("disk %s", "full")
+	if len(rec.msgs) != 1 || rec.msgs[0] != "disk full" || rec.levels[0] != LevelError {
+		t.Errorf("entries = %q %v, want the bare message at ERROR", rec.msgs, rec.levels)
+	}
+	if rec.Len() != 0 {
+		t.Errorf("EntryWriter also got the formatted line %q", rec.String())
+	}
+
+	logger.RemoveWriter(&plain)
+	logger.Info("after")
+	if strings.Contains(plain.String(), "after") {
+		t.Error("removed writer still receives lines")
+	}
+	if len(rec.msgs) != 2 {
+		t.Errorf("remaining writer got %d entries, want 2", len(rec.msgs))
+	}
+}
+
 func TestNewLoggerVerbose(t *testing.T) {
 	logger, err := NewLogger(Options{Verbose: true})
 	if err != nil {
@@ -165,3 +204,25 @@ func TestNewLoggerDefault(t *testing.T) {
 		t.Errorf("expected LevelInfo by default, got %v", logger.level)
 	}
 }
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "torvm.log")
+	logger, err := NewLogger(Options{LogFile: path})
+	if err != nil {
+		t.Fatalf("NewLogger: %v", err)
+	}
+	logger.Info("before rotation")
+	if err := logger.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	logger.Info("after rotation")
+
+	old, _ := os.ReadFile(path + ".1")
+	cur, _ := os.ReadFile(path)
+	if !strings.Contains(string(old), "before rotation") || strings.Contains(string(old), "after rotation") {
+		t.Errorf("rotated file = %q", old)
+	}
+	if !strings.Contains(string(cur), "after rotation") || strings.Contains(string(cur), "before rotation") {
+		t.Errorf("current file = %q", cur)
+	}
+}
@@ -82,6 +82,14 @@ func (r *RingWriter) Lines() []string {
 	return out
 }
 
+// Clear discards the stored lines, and the partial one, from memory.
+func (r *RingWriter) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.lines)
+	r.pos, r.full, r.partial = 0, false, ""
+}
+
 // OnLine sets a callback that is invoked for each new complete line.
 func (r *RingWriter) OnLine(fn func(string)) {
 	r.mu.Lock()
@@ -152,3 +152,16 @@ func TestRingWriterWriteReturnValue(t *testing.T) {
 		t.Errorf("expected n=%d, got %d", len(data), n)
 	}
 }
+
+func TestRingWriterClear(t *testing.T) {
+	rw := NewRingWriter(3)
+	rw.Write([]byte("bridge 1\nbridge 2\nbridge 3\nbridge 4\npartial"))
+	rw.Clear()
+	if lines := rw.Lines(); len(lines) != 0 {
+		t.Errorf("Lines after Clear = %q", lines)
+	}
+	rw.Write([]byte(" line\n"))
+	if lines := rw.Lines(); len(lines) != 1 || lines[0] != " line" {
+		t.Errorf("Lines = %q, want the partial line dropped", lines)
+	}
+}
@@ -0,0 +1,111 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func TestWindowOccurrence(t *testing.T) {
+	loc := time.UTC
+	// 2026-03-02 is a Monday.
+	at := func(day, h, m int) time.Time { return time.Date(2026, 3, day, h, m, 0, 0, loc) }
+
+	tests := []struct {
+		name   string
+		spec   string
+		days   []string
+		t      time.Time
+		want   time.Time
+		inside bool
+	}{
+		{"inside", "03:00-05:00", nil, at(2, 4, 30), at(2, 3, 0), true},
+		{"end exclusive", "03:00-05:00", nil, at(2, 5, 0), time.Time{}, false},
+		{"wrap evening", "23:00-01:00", nil, at(2, 23, 30), at(2, 23, 0), true},
+		{"wrap after midnight", "23:00-01:00", nil, at(3, 0, 30), at(2, 23, 0), true},
+		{"day filter match", "03:00-05:00", []string{"mon"}, at(2, 3, 10), at(2, 3, 0), true},
+		{"day filter miss", "03:00-05:00", []string{"sun"}, at(2, 3, 10), time.Time{}, false},
+		{"wrap uses opening day", "23:00-01:00", []string{"mon"}, at(3, 0, 30), at(2, 23, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWindow(tt.spec, tt.days)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, inside := w.Occurrence(tt.t)
+			if inside != tt.inside || !got.Equal(tt.want) {
+				t.Errorf("Occurrence(%v) = %v, %v; want %v, %v", tt.t, got, inside, tt.want, tt.inside)
+			}
+		})
+	}
+}
+
+func TestParseWindowErrors(t *testing.T) {
+	for _, spec := range []string{"", "03:00", "3-5", "25:00-01:00", "03:00-03:00"} {
+		if _, err := ParseWindow(spec, nil); err == nil {
+			t.Errorf("ParseWindow(%q) succeeded, want error", spec)
+		}
+	}
+	if _, err := ParseWindow("03:00-04:00", []string{"someday"}); err == nil {
+		t.Error("invalid weekday accepted")
+	}
+}
+
+func TestSchedulerDefersForActiveStreams(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	w, _ := ParseWindow("03:00-05:00", nil)
+
+	streams := 2
+	s := NewScheduler(w, func() (int, error) { return streams, nil }, logger)
+	clk := clock.NewFake(time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC))
+	s.clock = clk
+
+	var runs, stoppedRuns int
+	s.AddTask("rotate logs", func() error { runs++; return nil })
+	s.SetRestart(func(hook func()) bool { hook(); return true },
+		Task{Name: "fsck", Run: func() error { stoppedRuns++; return nil }})
+
+	if s.tick() {
+		t.Fatal("ran with active streams")
+	}
+	streams = 0
+	clk.Advance(time.Minute)
+	if !s.tick() {
+		t.Fatal("did not run once streams closed")
+	}
+	clk.Advance(time.Minute)
+	if s.tick() {
+		t.Error("ran twice in the same window")
+	}
+	if runs != 1 || stoppedRuns != 1 {
+		t.Errorf("runs = %d, stoppedRuns = %d; want 1, 1", runs, stoppedRuns)
+	}
+
+	// Next day's window runs again.
+	clk.Advance(24 * time.Hour)
+	if !s.tick() || runs != 2 {
+		t.Errorf("next window: runs = %d, want 2", runs)
+	}
+}
+
+func TestSchedulerLoopChecksEachInterval(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	w, _ := ParseWindow("03:00-05:00", nil)
+	s := NewScheduler(w, func() (int, error) { return 0, nil }, logger)
+	clk := clock.NewFake(time.Date(2026, 3, 2, 2, 58, 30, 0, time.UTC))
+	s.clock = clk
+	ran := make(chan time.Time, 1)
+	s.AddTask("rotate logs", func() error { ran <- clk.Now(); return nil })
+	s.Start()
+	defer s.Stop()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	clk.Advance(time.Minute)
+	if got := <-ran; got != time.Date(2026, 3, 2, 3, 0, 30, 0, time.UTC) {
+		t.Errorf("ran at %v, want at the first check inside the window", got)
+	}
+}
@@ -0,0 +1,144 @@
+package maintenance
+
+import (
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// Task is a named maintenance step.
+type Task struct {
+	Name string
+	Run  func() error
+}
+
+// Scheduler runs maintenance tasks once per window occurrence. Tasks are
+// deferred (and retried on the next check) while any Tor stream is open;
+// if the window closes first, that occurrence is skipped.
+type Scheduler struct {
+	window        Window
+	activeStreams func() (int, error)
+	logger        *logging.Logger
+	interval      time.Duration
+	clock         clock.Clock // replaceable in tests
+
+	tasks        []Task
+	restart      func(hook func()) bool
+	stoppedTasks []Task
+
+	mu       sync.Mutex
+	lastRun  time.Time // opening time of the last completed occurrence
+	deferred time.Time // opening time of an occurrence deferred for streams
+	done     chan struct{}
+}
+
+// NewScheduler creates a scheduler for window. activeStreams reports the
+// number of open Tor streams.
+func NewScheduler(window Window, activeStreams func() (int, error), logger *logging.Logger) *Scheduler {
+	return &Scheduler{
+		window:        window,
+		activeStreams: activeStreams,
+		logger:        logger,
+		interval:      time.Minute,
+		clock:         clock.Real,
+		done:          make(chan struct{}),
+	}
+}
+
+// AddTask adds a task that runs while the VM is up.
+func (s *Scheduler) AddTask(name string, fn func() error) {
+	s.tasks = append(s.tasks, Task{Name: name, Run: fn})
+}
+
+// SetRestart enables a VM restart after the regular tasks. restart asks the
+// lifecycle engine to restart the VM and run the given hook while it is
+// stopped; stopped lists tasks that need the VM down.
+func (s *Scheduler) SetRestart(restart func(hook func()) bool, stopped ...Task) {
+	s.restart = restart
+	s.stoppedTasks = stopped
+}
+
+// Start begins checking the window in the background.
+func (s *Scheduler) Start() {
+	go s.loop()
+}
+
+// Stop stops the scheduler.
+func (s *Scheduler) Stop() {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+func (s *Scheduler) loop() {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			s.tick()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// tick runs the tasks if the current time is inside a window occurrence
+// that has not been handled yet. It reports whether tasks ran.
+func (s *Scheduler) tick() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	occ, inside := s.window.Occurrence(s.clock.Now())
+	if !inside {
+		if !s.deferred.IsZero() {
+			s.logger.Info("maintenance: window closed with streams still active; skipped until next window")
+			s.deferred = time.Time{}
+		}
+		return false
+	}
+	if occ.Equal(s.lastRun) {
+		return false
+	}
+
+	n, err := s.activeStreams()
+	if err != nil {
+		s.logger.Error("maintenance: count active streams: %v; deferring", err)
+		s.deferred = occ
+		return false
+	}
+	if n > 0 {
+		if !occ.Equal(s.deferred) {
+			s.logger.Info("maintenance: deferring, %d active stream(s)", n)
+		}
+		s.deferred = occ
+		return false
+	}
+
+	s.lastRun = occ
+	s.deferred = time.Time{}
+	s.logger.Info("maintenance: starting")
+	runTasks(s.logger, s.tasks)
+
+	if s.restart != nil {
+		stopped := s.stoppedTasks
+		if !s.restart(func() { runTasks(s.logger, stopped) }) {
+			s.logger.Info("maintenance: VM restart not possible in current state; skipped")
+		}
+	}
+	return true
+}
+
+func runTasks(logger *logging.Logger, tasks []Task) {
+	for _, t := range tasks {
+		if err := t.Run(); err != nil {
+			logger.Error("maintenance: %s: %v", t.Name, err)
+			continue
+		}
+		logger.Info("maintenance: %s done", t.Name)
+	}
+}
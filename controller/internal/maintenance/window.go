@@ -0,0 +1,92 @@
+// Package maintenance runs scheduled upkeep (update checks, log rotation,
+// state disk checks, VM restarts) inside a configured time window, and
+// only while no Tor streams are active.
+package maintenance
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring daily time range in local time, optionally limited
+// to certain weekdays. A window whose end is before its start wraps past
+// midnight; the weekday filter applies to the day the window opens.
+type Window struct {
+	start, end int // minutes after midnight
+	days       map[time.Weekday]bool
+}
+
+// ParseWindow parses a "HH:MM-HH:MM" range and optional weekday names
+// ("mon".."sun"). An empty days list means every day.
+func ParseWindow(spec string, days []string) (Window, error) {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("maintenance window %q: want HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("maintenance window %q: %w", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("maintenance window %q: %w", spec, err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("maintenance window %q is empty", spec)
+	}
+
+	w := Window{start: start, end: end}
+	if len(days) > 0 {
+		w.days = make(map[time.Weekday]bool, len(days))
+		for _, d := range days {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return Window{}, fmt.Errorf("maintenance day %q: want mon..sun", d)
+			}
+			w.days[wd] = true
+		}
+	}
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Occurrence returns the opening time of the window occurrence containing
+// t, and false if t is outside the window.
+func (w Window) Occurrence(t time.Time) (time.Time, bool) {
+	m := t.Hour()*60 + t.Minute()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	var open time.Time
+	switch {
+	case w.start < w.end && m >= w.start && m < w.end:
+		open = day.Add(time.Duration(w.start) * time.Minute)
+	case w.start > w.end && m >= w.start:
+		open = day.Add(time.Duration(w.start) * time.Minute)
+	case w.start > w.end && m < w.end:
+		open = day.AddDate(0, 0, -1).Add(time.Duration(w.start) * time.Minute)
+	default:
+		return time.Time{}, false
+	}
+	if w.days != nil && !w.days[open.Weekday()] {
+		return time.Time{}, false
+	}
+	return open, true
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net"
 	"net/http"
+	"runtime"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -17,28 +18,65 @@ type HealthStatus struct {
 	Failsafe         bool   `json:"failsafe"`
 	UptimeSeconds    int    `json:"uptime_seconds"`
 	BootstrapPercent int    `json:"tor_bootstrap_percent"`
+	BootstrapSummary string `json:"tor_bootstrap_summary,omitempty"`
 	VMPID            int    `json:"vm_pid"`
 	LastError        string `json:"last_error,omitempty"`
 	Version          string `json:"version"`
 }
 
+// Status is the JSON response for /status: the parts of HealthStatus a
+// dashboard shows.
+type Status struct {
+	State     string `json:"state"`
+	Running   bool   `json:"running"`
+	Bootstrap int    `json:"bootstrap"`
+	Summary   string `json:"summary,omitempty"`
+	Failsafe  bool   `json:"failsafe"`
+}
+
+// VersionInfo is the JSON response for /version.
+type VersionInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
 // HealthFunc returns the current health status.
 type HealthFunc func() HealthStatus
 
-// Server serves Prometheus metrics and a health endpoint.
+// Server serves Prometheus metrics and the health, status, and version
+// endpoints.
 type Server struct {
 	httpServer *http.Server
 	listener   net.Listener
 }
 
 // NewServer creates a metrics/health HTTP server on the given address.
+// The JSON endpoints answer GET only.
 func NewServer(addr string, reg *prometheus.Registry, healthFn HealthFunc) (*Server, error) {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		status := healthFn()
-		json.NewEncoder(w).Encode(status)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, healthFn())
+	})
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		h := healthFn()
+		writeJSON(w, Status{
+			State:     h.State,
+			Running:   h.State == "Running",
+			Bootstrap: h.BootstrapPercent,
+			Summary:   h.BootstrapSummary,
+			Failsafe:  h.Failsafe,
+		})
+	})
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, VersionInfo{
+			Version:   healthFn().Version,
+			GoVersion: runtime.Version(),
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+		})
 	})
 
 	ln, err := net.Listen("tcp", addr)
@@ -50,6 +88,26 @@ func NewServer(addr string, reg *prometheus.Registry, healthFn HealthFunc) (*Ser
 	return &Server{httpServer: srv, listener: ln}, nil
 }
 
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(v)
+}
+
+// IsLoopback reports whether addr, a host:port listen address, only
+// accepts connections from this machine.
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // Start begins serving in a goroutine.
 func (s *Server) Start() {
 	go s.httpServer.Serve(s.listener)
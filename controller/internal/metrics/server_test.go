@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServerEndpoints(t *testing.T) {
+	health := HealthStatus{
+		State:            "WaitBootstrap",
+		Bootstrap:        45,
+		BootstrapPercent: 45,
+		BootstrapSummary: "Loading relay descriptors",
+		Failsafe:         true,
+		Version:          "1.2.3",
+	}
+	srv, err := NewServer("127.0.0.1:0", prometheus.NewRegistry(), func() HealthStatus { return health })
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Start()
+	defer srv.Shutdown(context.Background())
+	base := "http://" + srv.Addr()
+
+	get := func(path string, v any) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("GET %s: Content-Type %q", path, ct)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+	}
+
+	var h HealthStatus
+	get("/healthz", &h)
+	if h != health {
+		t.Errorf("/healthz = %+v, want %+v", h, health)
+	}
+
+	var st Status
+	get("/status", &st)
+	want := Status{State: "WaitBootstrap", Bootstrap: 45, Summary: "Loading relay descriptors", Failsafe: true}
+	if st != want {
+		t.Errorf("/status = %+v, want %+v", st, want)
+	}
+
+	var v VersionInfo
+	get("/version", &v)
+	if v.Version != "1.2.3" || v.GoVersion == "" || v.OS == "" || v.Arch == "" {
+		t.Errorf("/version = %+v", v)
+	}
+
+	resp, err := http.Post(base+"/status", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /status: status %d, want 405", resp.StatusCode)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"127.0.0.1:9100": true,
+		"[::1]:9100":     true,
+		"localhost:9100": true,
+		"0.0.0.0:9100":   false,
+		":9100":          false,
+		"10.0.0.5:9100":  false,
+		"127.0.0.1":      false,
+	} {
+		if got := IsLoopback(addr); got != want {
+			t.Errorf("IsLoopback(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package moat requests bridges from the Tor Project's Moat API, the
+// one Tor Browser uses, so a censored user gets bridge lines without
+// leaving TorVM. obfs4 bridges are handed out after a CAPTCHA; the
+// built-in snowflake and meek-azure bridges are not.
+//
+// Tor is not connected yet when bridges are needed, so the requests go
+// straight from the host over HTTPS, or domain fronted: the TLS
+// connection, and all a censor sees, is to a CDN host, and the request
+// inside it names the Moat host.
+package moat
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// The Moat service, and the CDN front and reflector Tor Browser reaches
+// it through when it is blocked.
+const (
+	DefaultURL   = "https://bridges.torproject.org/moat"
+	FrontedURL   = "https://moat.torproject.org.global.prod.fastly.net/moat"
+	DefaultFront = "cdn.sstatic.net"
+)
+
+// apiVersion is the Moat protocol version of the requests.
+const apiVersion = "0.1.0"
+
+// maxResponse bounds a response; a CAPTCHA image is some 10 KiB.
+const maxResponse = 1 << 20
+
+// ErrWrongSolution is returned by Check when the CAPTCHA solution is
+// wrong. The challenge is used up: Fetch a new one.
+var ErrWrongSolution = errors.New("moat: the CAPTCHA solution is wrong")
+
+// Client talks to a Moat service.
+type Client struct {
+	// URL is the service, such as DefaultURL or FrontedURL.
+	URL string
+	// Front, if set, is the host connected to instead of URL's, which
+	// is sent only as the HTTP Host.
+	Front string
+	// HTTP makes the requests; nil means a client with a 30s timeout.
+	HTTP *http.Client
+}
+
+// Direct returns a client for the Moat service itself.
+func Direct() *Client {
+	return &Client{URL: DefaultURL}
+}
+
+// Fronted returns a client that reaches the Moat service through the
+// default CDN front.
+func Fronted() *Client {
+	return &Client{URL: FrontedURL, Front: DefaultFront}
+}
+
+// Challenge is a CAPTCHA to solve for bridges.
+type Challenge struct {
+	Transport string
+	Image     []byte // JPEG or PNG
+	token     string
+}
+
+// Fetch requests a CAPTCHA for bridges of transport, such as "obfs4".
+func (c *Client) Fetch(ctx context.Context, transport string) (*Challenge, error) {
+	req := []map[string]any{{
+		"version":   apiVersion,
+		"type":      "client-transports",
+		"supported": []string{transport},
+	}}
+	var resp []struct {
+		Type      string `json:"type"`
+		Transport string `json:"transport"`
+		Image     string `json:"image"`
+		Challenge string `json:"challenge"`
+	}
+	if err := c.call(ctx, "/fetch", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 || resp[0].Type != "moat-challenge" || resp[0].Challenge == "" {
+		return nil, errors.New("moat: no CAPTCHA in the response")
+	}
+	img, err := base64.StdEncoding.DecodeString(resp[0].Image)
+	if err != nil {
+		return nil, fmt.Errorf("moat: CAPTCHA image: %w", err)
+	}
+	ch := &Challenge{Transport: resp[0].Transport, Image: img, token: resp[0].Challenge}
+	if ch.Transport == "" {
+		ch.Transport = transport
+	}
+	return ch, nil
+}
+
+// Check sends the solution to ch and returns the bridge lines it earns.
+// Lines that config.ParseBridgeLine rejects are left out.
+func (c *Client) Check(ctx context.Context, ch *Challenge, solution string) ([]string, error) {
+	req := []map[string]any{{
+		"id":        "2",
+		"version":   apiVersion,
+		"type":      "moat-solution",
+		"transport": ch.Transport,
+		"challenge": ch.token,
+		"solution":  solution,
+		"qrcode":    "false",
+	}}
+	var resp []struct {
+		Type    string   `json:"type"`
+		Bridges []string `json:"bridges"`
+	}
+	if err := c.call(ctx, "/check", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 || resp[0].Type != "moat-bridges" {
+		return nil, errors.New("moat: no bridges in the response")
+	}
+	return usable(resp[0].Bridges)
+}
+
+// Builtin returns the built-in bridges of transport, such as
+// "snowflake" or "meek-azure", which need no CAPTCHA.
+func (c *Client) Builtin(ctx context.Context, transport string) ([]string, error) {
+	data, status, err := c.post(ctx, "/circumvention/builtin", []byte("{}"))
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("moat: server returned %d %s", status, http.StatusText(status))
+	}
+	var resp map[string][]string
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("moat: decode response: %w", err)
+	}
+	return usable(resp[transport])
+}
+
+// call posts the JSON:API document {"data": req} to path and decodes the
+// data of the reply into resp, or returns its first error.
+func (c *Client) call(ctx context.Context, path string, req, resp any) error {
+	body, err := json.Marshal(map[string]any{"data": req})
+	if err != nil {
+		return fmt.Errorf("moat: %w", err)
+	}
+	data, status, err := c.post(ctx, path, body)
+	if err != nil {
+		return err
+	}
+	// Errors come with the status of their code, so the document is
+	// read whatever the status.
+	var doc struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Code   int    `json:"code"`
+			Detail string `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if status != http.StatusOK {
+			return fmt.Errorf("moat: server returned %d %s", status, http.StatusText(status))
+		}
+		return fmt.Errorf("moat: decode response: %w", err)
+	}
+	if len(doc.Errors) > 0 {
+		e := doc.Errors[0]
+		if e.Code == 419 {
+			return ErrWrongSolution
+		}
+		return fmt.Errorf("moat: error %d: %s", e.Code, e.Detail)
+	}
+	if err := json.Unmarshal(doc.Data, resp); err != nil {
+		return fmt.Errorf("moat: decode response: %w", err)
+	}
+	return nil
+}
+
+// post posts body to path and returns the response and its status.
+func (c *Client) post(ctx context.Context, path string, body []byte) ([]byte, int, error) {
+	u, err := url.Parse(c.URL + path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("moat: %w", err)
+	}
+	host := u.Host
+	if c.Front != "" {
+		u.Host = c.Front
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("moat: %w", err)
+	}
+	req.Host = host
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+
+	client := c.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("moat: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, 0, fmt.Errorf("moat: %w", err)
+	}
+	return data, resp.StatusCode, nil
+}
+
+// usable returns the lines that are valid bridge lines, or an error if
+// there are none.
+func usable(lines []string) ([]string, error) {
+	var ok []string
+	for _, line := range lines {
+		if _, err := config.ParseBridgeLine(line); err == nil {
+			ok = append(ok, line)
+		}
+	}
+	if len(ok) == 0 {
+		return nil, errors.New("moat: the service returned no usable bridges")
+	}
+	return ok, nil
+}
@@ -0,0 +1,91 @@
+package moat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testBridge = "obfs4 192.0.2.1:443 0123456789ABCDEF0123456789ABCDEF01234567 cert=AbCd+ef/gh iat-mode=0"
+
+// fakeMoat answers as the Moat service does, with the solution "abc".
+func fakeMoat(t *testing.T, hosts *[]string) *httptest.Server {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hosts = append(*hosts, r.Host)
+		body, _ := io.ReadAll(r.Body)
+		var doc struct {
+			Data []map[string]any `json:"data"`
+		}
+		json.Unmarshal(body, &doc)
+		w.Header().Set("Content-Type", "application/vnd.api+json")
+		switch r.URL.Path {
+		case "/moat/fetch":
+			io.WriteString(w, `{"data":[{"id":"1","type":"moat-challenge","version":"0.1.0","transport":"obfs4","image":"aW1n","challenge":"tok"}]}`)
+		case "/moat/check":
+			if doc.Data[0]["challenge"] != "tok" || doc.Data[0]["solution"] != "abc" {
+				w.WriteHeader(419)
+				io.WriteString(w, `{"errors":[{"id":"4","code":419,"status":"No You're A Teapot","detail":"The CAPTCHA solution was incorrect."}]}`)
+				return
+			}
+			io.WriteString(w, `{"data":[{"id":"3","type":"moat-bridges","version":"0.1.0","bridges":["`+testBridge+`","obfs4 bogus"],"qrcode":null}]}`)
+		case "/moat/circumvention/builtin":
+			io.WriteString(w, `{"snowflake":["snowflake 192.0.2.3:80 2B280B23E1107BB62ABFC40DDCC8824814F80A72 url=https://snowflake.example/"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchCheck(t *testing.T) {
+	var hosts []string
+	srv := fakeMoat(t, &hosts)
+	c := &Client{URL: srv.URL + "/moat", HTTP: srv.Client()}
+	ctx := context.Background()
+
+	ch, err := c.Fetch(ctx, "obfs4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Transport != "obfs4" || string(ch.Image) != "img" {
+		t.Errorf("challenge = %+v", ch)
+	}
+	if _, err := c.Check(ctx, ch, "xyz"); !errors.Is(err, ErrWrongSolution) {
+		t.Errorf("Check with a wrong solution = %v, want ErrWrongSolution", err)
+	}
+	lines, err := c.Check(ctx, ch, "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(lines, []string{testBridge}) {
+		t.Errorf("bridges = %q, want the valid line only", lines)
+	}
+
+	lines, err = c.Builtin(ctx, "snowflake")
+	if err != nil || len(lines) != 1 || !strings.HasPrefix(lines[0], "snowflake ") {
+		t.Errorf("Builtin(snowflake) = %q, %v", lines, err)
+	}
+	if _, err := c.Builtin(ctx, "meek-azure"); err == nil {
+		t.Error("Builtin(meek-azure) returned bridges the service has none of")
+	}
+}
+
+func TestFronted(t *testing.T) {
+	var hosts []string
+	srv := fakeMoat(t, &hosts)
+	front := strings.TrimPrefix(srv.URL, "https://")
+	c := &Client{URL: "https://moat.example/moat", Front: front, HTTP: srv.Client()}
+	if _, err := c.Fetch(context.Background(), "obfs4"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(hosts, []string{"moat.example"}) {
+		t.Errorf("Host = %q, want the Moat host behind the front", hosts)
+	}
+}
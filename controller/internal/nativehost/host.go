@@ -0,0 +1,177 @@
+// Package nativehost implements a browser native messaging host that
+// bridges a companion extension to the control API, so the extension can
+// show Tor status, start and stop the VM, and point its browser profile's
+// proxy at the VM's SOCKS port.
+//
+// Chrome and Firefox frame each message as a 32-bit length in native byte
+// order followed by that many bytes of JSON. The extension sends Request
+// objects; the host answers each with a Response carrying the same id,
+// and after a "subscribe" request also sends Responses with Event set and
+// no id.
+package nativehost
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/user/extorvm/controller/api"
+)
+
+// Name is the host name the extension passes to connectNative.
+const Name = "org.torproject.torvm"
+
+// maxMessage bounds a message from the browser. Requests are tiny; a
+// larger length means the stream is not native messaging framing.
+const maxMessage = 1 << 20
+
+// Commands accepted in Request.Cmd.
+const (
+	CmdStatus    = "status"
+	CmdStart     = "start"
+	CmdStop      = "stop"
+	CmdSubscribe = "subscribe" // stream events until the port closes or the controller exits
+)
+
+// Request is a message from the extension.
+type Request struct {
+	ID  json.RawMessage `json:"id,omitempty"` // echoed in the Response
+	Cmd string          `json:"cmd"`
+}
+
+// Response is a message to the extension.
+type Response struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	OK     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Status *api.Status     `json:"status,omitempty"`
+	Event  *api.Event      `json:"event,omitempty"`
+}
+
+// ReadMessage reads one framed message into v. It returns io.EOF when the
+// browser has closed the port.
+func ReadMessage(r io.Reader, v any) error {
+	var n uint32
+	if err := binary.Read(r, binary.NativeEndian, &n); err != nil {
+		return err
+	}
+	if n > maxMessage {
+		return fmt.Errorf("native messaging: message of %d bytes exceeds %d", n, maxMessage)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return fmt.Errorf("native messaging: %w", err)
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return fmt.Errorf("native messaging: %w", err)
+	}
+	return nil
+}
+
+// WriteMessage writes v as one framed message.
+func WriteMessage(w io.Writer, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	msg := binary.NativeEndian.AppendUint32(make([]byte, 0, 4+len(buf)), uint32(len(buf)))
+	_, err = w.Write(append(msg, buf...))
+	return err
+}
+
+// Client is the part of the control API client the host uses.
+type Client interface {
+	Status(ctx context.Context) (api.Status, error)
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Events(ctx context.Context) (<-chan api.Event, error)
+}
+
+// Host serves one extension connection.
+type Host struct {
+	client     Client
+	subscribed atomic.Bool
+
+	mu sync.Mutex // serializes writes
+	w  io.Writer
+}
+
+// New returns a host that answers requests using client.
+func New(client Client) *Host {
+	return &Host{client: client}
+}
+
+// Serve reads requests from r and writes responses to w until the browser
+// closes r (a nil return) or ctx is cancelled. The controller not running
+// is reported to the extension per request, not returned.
+func (h *Host) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	h.w = w
+
+	for {
+		var req Request
+		if err := ReadMessage(r, &req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		resp := Response{ID: req.ID, OK: true}
+		var err error
+		switch req.Cmd {
+		case CmdStatus:
+			var st api.Status
+			if st, err = h.client.Status(ctx); err == nil {
+				resp.Status = &st
+			}
+		case CmdStart:
+			err = h.client.Start(ctx)
+		case CmdStop:
+			err = h.client.Stop(ctx)
+		case CmdSubscribe:
+			if h.subscribed.CompareAndSwap(false, true) {
+				var events <-chan api.Event
+				if events, err = h.client.Events(ctx); err != nil {
+					h.subscribed.Store(false)
+				} else {
+					go h.forward(ctx, events)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown command %q", req.Cmd)
+		}
+		if err != nil {
+			resp.OK, resp.Error = false, err.Error()
+		}
+		if err := h.send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// forward sends events to the extension. If the stream ends while the
+// connection is open (the controller exited), it tells the extension,
+// which may subscribe again.
+func (h *Host) forward(ctx context.Context, events <-chan api.Event) {
+	for ev := range events {
+		if h.send(Response{OK: true, Event: &ev}) != nil {
+			return
+		}
+	}
+	h.subscribed.Store(false)
+	if ctx.Err() == nil {
+		h.send(Response{Error: "event stream ended"})
+	}
+}
+
+func (h *Host) send(resp Response) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return WriteMessage(h.w, resp)
+}
@@ -0,0 +1,158 @@
+package nativehost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/user/extorvm/controller/api"
+)
+
+type fakeClient struct {
+	events chan api.Event
+}
+
+func (f *fakeClient) Status(context.Context) (api.Status, error) {
+	return api.Status{State: "Running", Running: true, SOCKS: "10.10.10.1:9050"}, nil
+}
+
+func (f *fakeClient) Start(context.Context) error {
+	return &api.Error{Code: 409, Message: "the VM is already running"}
+}
+
+func (f *fakeClient) Stop(context.Context) error { return nil }
+
+func (f *fakeClient) Events(context.Context) (<-chan api.Event, error) {
+	return f.events, nil
+}
+
+func TestFraming(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMessage(&buf, Request{Cmd: CmdStatus}); err != nil {
+		t.Fatal(err)
+	}
+	var req Request
+	if err := ReadMessage(&buf, &req); err != nil || req.Cmd != CmdStatus {
+		t.Fatalf("ReadMessage = %+v, %v", req, err)
+	}
+	if err := ReadMessage(&buf, &req); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadMessage at end = %v, want io.EOF", err)
+	}
+
+	huge := []byte{0xff, 0xff, 0xff, 0x7f}
+	if err := ReadMessage(bytes.NewReader(huge), &req); err == nil {
+		t.Error("oversized message accepted")
+	}
+}
+
+func TestServe(t *testing.T) {
+	client := &fakeClient{events: make(chan api.Event, 1)}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- New(client).Serve(context.Background(), inR, outW) }()
+
+	call := func(id int, cmd string) Response {
+		t.Helper()
+		if err := WriteMessage(inW, Request{ID: json.RawMessage(strconv.Itoa(id)), Cmd: cmd}); err != nil {
+			t.Fatal(err)
+		}
+		var resp Response
+		if err := ReadMessage(outR, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.ID) != strconv.Itoa(id) {
+			t.Errorf("%s: id = %s, want %d", cmd, resp.ID, id)
+		}
+		return resp
+	}
+
+	if r := call(1, CmdStatus); !r.OK || r.Status == nil || r.Status.SOCKS != "10.10.10.1:9050" {
+		t.Errorf("status = %+v", r)
+	}
+	if r := call(2, CmdStart); r.OK || r.Error == "" {
+		t.Errorf("start = %+v, want the API error", r)
+	}
+	if r := call(3, "reboot"); r.OK {
+		t.Errorf("unknown command = %+v, want an error", r)
+	}
+	if r := call(4, CmdSubscribe); !r.OK {
+		t.Errorf("subscribe = %+v", r)
+	}
+
+	client.events <- api.Event{Kind: api.EventState, State: "Running"}
+	var ev Response
+	if err := ReadMessage(outR, &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != nil || ev.Event == nil || ev.Event.State != "Running" {
+		t.Errorf("event = %+v", ev)
+	}
+
+	// The controller exiting ends the stream; the extension is told.
+	close(client.events)
+	if err := ReadMessage(outR, &ev); err != nil || ev.OK || ev.Error == "" {
+		t.Errorf("end of stream = %+v, %v", ev, err)
+	}
+
+	inW.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve = %v, want nil when the browser closes the port", err)
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	m, err := NewManifest("chrome", "/opt/torvm-native-host", "abcdefghijklmnopabcdefghijklmnop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.AllowedOrigins) != 1 || m.AllowedOrigins[0] != "chrome-extension://abcdefghijklmnopabcdefghijklmnop/" || m.AllowedExtensions != nil {
+		t.Errorf("chrome manifest = %+v", m)
+	}
+	if m, err = NewManifest("firefox", "/opt/torvm-native-host", "torvm@example.org"); err != nil || m.AllowedExtensions[0] != "torvm@example.org" {
+		t.Errorf("firefox manifest = %+v, %v", m, err)
+	}
+
+	for _, bad := range []struct{ browser, id string }{
+		{"chrome", "torvm@example.org"},
+		{"firefox", `a"b`},
+		{"safari", "x"},
+	} {
+		if _, err := NewManifest(bad.browser, "/x", bad.id); err == nil {
+			t.Errorf("NewManifest(%q, %q) accepted", bad.browser, bad.id)
+		}
+	}
+}
+
+func TestInstallValidatesFirst(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	for _, bad := range []struct {
+		browser, id string
+		command     []string
+	}{
+		{"chrome", "torvm@example.org", []string{"/opt/torvm"}},
+		{"safari", "x", []string{"/opt/torvm"}},
+		{"firefox", "torvm@example.org", nil},
+	} {
+		if _, err := Install(bad.browser, bad.id, bad.command); err == nil {
+			t.Errorf("Install(%q, %q, %q) accepted", bad.browser, bad.id, bad.command)
+		}
+	}
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Install wrote %v for invalid inputs, want nothing", entries)
+	}
+}
@@ -0,0 +1,131 @@
+package nativehost
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// Browsers lists the browsers Install supports.
+var Browsers = []string{"chrome", "chromium", "firefox"}
+
+var (
+	// chromeIDRe matches a Chrome extension ID: 32 letters a-p.
+	chromeIDRe = regexp.MustCompile(`^[a-p]{32}$`)
+	// firefoxIDRe matches a Firefox add-on ID, an email-like string or
+	// a braced UUID.
+	firefoxIDRe = regexp.MustCompile(`^[A-Za-z0-9._@{}-]{1,80}$`)
+)
+
+// Manifest is a native messaging host manifest.
+type Manifest struct {
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	Path              string   `json:"path"`
+	Type              string   `json:"type"`
+	AllowedOrigins    []string `json:"allowed_origins,omitempty"`    // Chrome and Chromium
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"` // Firefox
+}
+
+// NewManifest returns the manifest that lets the extension extensionID
+// in browser start the launcher at path.
+func NewManifest(browser, path, extensionID string) (Manifest, error) {
+	m := Manifest{
+		Name:        Name,
+		Description: "TorVM status and control",
+		Path:        path,
+		Type:        "stdio",
+	}
+	switch browser {
+	case "chrome", "chromium":
+		if !chromeIDRe.MatchString(extensionID) {
+			return m, fmt.Errorf("%q is not a Chrome extension ID (32 letters a-p)", extensionID)
+		}
+		m.AllowedOrigins = []string{"chrome-extension://" + extensionID + "/"}
+	case "firefox":
+		if !firefoxIDRe.MatchString(extensionID) {
+			return m, fmt.Errorf("%q is not a Firefox add-on ID", extensionID)
+		}
+		m.AllowedExtensions = []string{extensionID}
+	default:
+		return m, fmt.Errorf("unsupported browser %q (want one of %v)", browser, Browsers)
+	}
+	return m, nil
+}
+
+// launcherDir holds the launcher script (and, on Windows, the manifests).
+func launcherDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "torvm", "native-host"), nil
+}
+
+// Install registers the host with browser for the current user, allowing
+// only extensionID to start it. Browsers cannot pass arguments to a host,
+// so Install writes a launcher script that runs command (the controller
+// and its arguments) followed by the browser's own arguments. It returns
+// the manifest's path. Nothing is written unless every input is valid.
+func Install(browser, extensionID string, command []string) (string, error) {
+	if len(command) == 0 {
+		return "", fmt.Errorf("native host install: no command to launch")
+	}
+	dir, err := launcherDir()
+	if err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+	launcher := filepath.Join(dir, launcherName)
+	m, err := NewManifest(browser, launcher, extensionID)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	mdir, err := manifestDir(browser)
+	if err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+	if err := os.WriteFile(launcher, []byte(launcherScript(command)), 0755); err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+	if err := os.MkdirAll(mdir, 0755); err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+	path := filepath.Join(mdir, Name+".json")
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+	if err := register(browser, path); err != nil {
+		return "", fmt.Errorf("native host install: %w", err)
+	}
+	return path, nil
+}
+
+// Uninstall removes the host's manifest for browser. The launcher is
+// left for the other browsers.
+func Uninstall(browser string) error {
+	if !slices.Contains(Browsers, browser) {
+		return fmt.Errorf("unsupported browser %q (want one of %v)", browser, Browsers)
+	}
+	if err := unregister(browser); err != nil {
+		return fmt.Errorf("native host uninstall: %w", err)
+	}
+	mdir, err := manifestDir(browser)
+	if err != nil {
+		return fmt.Errorf("native host uninstall: %w", err)
+	}
+	if err := os.Remove(filepath.Join(mdir, Name+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("native host uninstall: %w", err)
+	}
+	return nil
+}
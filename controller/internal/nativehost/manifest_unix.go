@@ -0,0 +1,56 @@
+//go:build !windows
+
+package nativehost
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const launcherName = "torvm-native-host"
+
+// manifestDir returns the per-user directory browser reads host
+// manifests from. A manifest there is all the registration needed.
+func manifestDir(browser string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "darwin" {
+		base := filepath.Join(home, "Library", "Application Support")
+		switch browser {
+		case "chrome":
+			return filepath.Join(base, "Google", "Chrome", "NativeMessagingHosts"), nil
+		case "chromium":
+			return filepath.Join(base, "Chromium", "NativeMessagingHosts"), nil
+		default:
+			return filepath.Join(base, "Mozilla", "NativeMessagingHosts"), nil
+		}
+	}
+	switch browser {
+	case "chrome":
+		return filepath.Join(home, ".config", "google-chrome", "NativeMessagingHosts"), nil
+	case "chromium":
+		return filepath.Join(home, ".config", "chromium", "NativeMessagingHosts"), nil
+	default:
+		return filepath.Join(home, ".mozilla", "native-messaging-hosts"), nil
+	}
+}
+
+func register(browser, manifestPath string) error { return nil }
+
+func unregister(browser string) error { return nil }
+
+// launcherScript returns a shell script that runs command with the
+// script's arguments appended.
+func launcherScript(command []string) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\nexec")
+	for _, arg := range command {
+		b.WriteString(" '" + strings.ReplaceAll(arg, "'", `'\''`) + "'")
+	}
+	b.WriteString(" \"$@\"\n")
+	return b.String()
+}
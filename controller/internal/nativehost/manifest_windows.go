@@ -0,0 +1,62 @@
+//go:build windows
+
+package nativehost
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const launcherName = "torvm-native-host.bat"
+
+// registryKeys are the per-user keys browsers look up host manifests in.
+var registryKeys = map[string]string{
+	"chrome":   `Software\Google\Chrome\NativeMessagingHosts\` + Name,
+	"chromium": `Software\Chromium\NativeMessagingHosts\` + Name,
+	"firefox":  `Software\Mozilla\NativeMessagingHosts\` + Name,
+}
+
+// manifestDir returns where the manifest for browser is kept. Windows
+// browsers find it through the registry, not by location.
+func manifestDir(browser string) (string, error) {
+	dir, err := launcherDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, browser), nil
+}
+
+// register points browser's registry key at the manifest.
+func register(browser, manifestPath string) error {
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, registryKeys[browser], registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetStringValue("", manifestPath)
+}
+
+func unregister(browser string) error {
+	err := registry.DeleteKey(registry.CURRENT_USER, registryKeys[browser])
+	if err == registry.ErrNotExist {
+		return nil
+	}
+	return err
+}
+
+// launcherScript returns a batch file that runs command with the
+// script's arguments appended.
+func launcherScript(command []string) string {
+	var b strings.Builder
+	b.WriteString("@echo off\r\n")
+	for i, arg := range command {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(`"` + strings.ReplaceAll(arg, "%", "%%") + `"`)
+	}
+	b.WriteString(" %*\r\n")
+	return b.String()
+}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package nethelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"os/exec"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+// safePath is the PATH the helper runs its programs with; the caller's
+// environment is dropped.
+const safePath = "/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Main is the helper's main function: it answers the request on standard
+// input on standard output and returns the exit code.
+func Main() int {
+	rep := serve()
+	json.NewEncoder(os.Stdout).Encode(rep)
+	if rep.Error != "" {
+		return 1
+	}
+	return 0
+}
+
+func serve() reply {
+	os.Clearenv()
+	os.Setenv("PATH", safePath)
+	syscall.Umask(022)
+
+	uid := os.Getuid()
+	if !allowed(uid) {
+		return reply{Refused: true, Error: fmt.Sprintf("nethelper: only root and members of the %s group may use the helper", Group)}
+	}
+	// Setuid root: the programs run as root through and through, rather
+	// than with the caller's real uid. Otherwise they inherit
+	// cap_net_admin, the one capability they need, as an ambient one.
+	attr := &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 0, Gid: 0}}
+	if os.Geteuid() != 0 {
+		if !hasNetAdmin() {
+			return reply{Refused: true, Error: "nethelper: the helper is neither setuid root nor has cap_net_admin"}
+		}
+		attr = &syscall.SysProcAttr{AmbientCaps: []uintptr{unix.CAP_NET_ADMIN}}
+	}
+
+	// Without syslog the commands still run, unlogged.
+	logger, _ := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, "torvm-nethelper")
+	s := &Server{
+		uid:   uid,
+		isTap: isTap,
+		run:   func(op privexec.Op) (string, error) { return run(op, attr) },
+		audit: func(rec privexec.Record) {
+			if logger != nil {
+				logger.Notice(fmt.Sprintf("uid %d: %s", uid, rec))
+			}
+		},
+	}
+	return s.Handle(os.Stdin)
+}
+
+// allowed reports whether the user uid, who ran the helper, may use it.
+func allowed(uid int) bool {
+	if uid == 0 {
+		return true
+	}
+	g, err := user.LookupGroup(Group)
+	if err != nil {
+		return false
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return false
+	}
+	groups, err := os.Getgroups()
+	return err == nil && (os.Getgid() == gid || slices.Contains(groups, gid))
+}
+
+// hasNetAdmin reports whether cap_net_admin is in the helper's permitted
+// set, as the file capability puts it.
+func hasNetAdmin() bool {
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&hdr, &data[0]); err != nil {
+		return false
+	}
+	return data[0].Permitted&(1<<unix.CAP_NET_ADMIN) != 0
+}
+
+// isTap reports whether dev is a TUN or TAP device.
+func isTap(dev string) bool {
+	_, err := os.Stat("/sys/class/net/" + dev + "/tun_flags")
+	return err == nil
+}
+
+// run runs op with attr and returns its combined output.
+func run(op privexec.Op, attr *syscall.SysProcAttr) (string, error) {
+	cmd := exec.Command(op.Program, op.Args...)
+	if op.Stdin != "" {
+		cmd.Stdin = strings.NewReader(op.Stdin)
+	}
+	cmd.Dir = "/"
+	cmd.SysProcAttr = attr
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("%s %v: %s: %w", op.Program, op.Args, strings.TrimSpace(string(out)), err)
+	}
+	return string(out), err
+}
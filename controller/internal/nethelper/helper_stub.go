@@ -0,0 +1,14 @@
+//go:build !linux
+
+package nethelper
+
+import (
+	"fmt"
+	"os"
+)
+
+// Main returns an error: the network helper is Linux only.
+func Main() int {
+	fmt.Fprintln(os.Stderr, "torvm-nethelper: the network helper is only available on Linux")
+	return 1
+}
@@ -0,0 +1,180 @@
+// Package nethelper is the Linux network helper: a small binary,
+// torvm-nethelper, installed setuid root or with the cap_net_admin file
+// capability, that makes the controller's network changes so that the
+// controller, with its GUI and QEMU supervision, never needs root.
+//
+// The controller runs the helper once per batch of changes and writes a
+// request to its standard input. A request is a list of commands from a
+// short, fixed set, such as "tap-add" or "route", each with arguments the
+// helper checks on its own: interface names, addresses, route fields, and
+// nftables scripts that may touch only TorVM's tables. The helper builds
+// the ip, nft, and resolvectl command lines itself, so it never runs an
+// argument vector the caller wrote. It serves only root and members of
+// the torvm group, and logs every command it runs to syslog.
+//
+// The Client turns privexec ops into commands and implements
+// privexec.Elevator. Ops outside the protocol, such as installing a
+// systemd unit, go to pkexec as before.
+package nethelper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+const (
+	// DefaultPath is where the helper is installed.
+	DefaultPath = "/usr/libexec/torvm/torvm-nethelper"
+	// Group is the group whose members may use the helper, besides root.
+	Group = "torvm"
+
+	// protocolVersion changes when request or reply do.
+	protocolVersion = 1
+
+	// maxRequest bounds the request the helper reads.
+	maxRequest = 1 << 20
+)
+
+// Command is one network change, as the helper understands it.
+type Command struct {
+	Name    string   `json:"name"`
+	Args    []string `json:"args,omitempty"`
+	Input   string   `json:"input,omitempty"`    // the script of "nft"
+	MayFail bool     `json:"may_fail,omitempty"` // as privexec.Op.MayFail
+}
+
+// request is what the controller sends.
+type request struct {
+	Version  int       `json:"version"`
+	Commands []Command `json:"commands"`
+}
+
+// reply is what the helper answers. Refused is set when the caller may
+// not use the helper or the helper lacks its privileges, so the
+// controller falls back to pkexec.
+type reply struct {
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Refused bool   `json:"refused,omitempty"`
+}
+
+// Installed reports whether the helper is installed at DefaultPath.
+func Installed() bool {
+	fi, err := os.Stat(DefaultPath)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// Client runs commands through the helper. It implements
+// privexec.Elevator.
+type Client struct {
+	Path string // DefaultPath if empty
+}
+
+// RunOps runs ops through the helper and waits for them. Its error wraps
+// privexec.ErrNoElevator if an op is not a network change the helper
+// makes, or if the helper is missing or refuses the caller.
+func (c Client) RunOps(ops []privexec.Op) (string, error) {
+	req := request{Version: protocolVersion, Commands: make([]Command, len(ops))}
+	for i, op := range ops {
+		cmd, err := FromOp(op)
+		if err != nil {
+			return "", fmt.Errorf("nethelper: %w: %v", privexec.ErrNoElevator, err)
+		}
+		req.Commands[i] = cmd
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("nethelper: %w", err)
+	}
+
+	path := c.Path
+	if path == "" {
+		path = DefaultPath
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+	var rep reply
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		if errors.Is(runErr, fs.ErrNotExist) || errors.Is(runErr, fs.ErrPermission) {
+			return "", fmt.Errorf("nethelper: %w: %v", privexec.ErrNoElevator, runErr)
+		}
+		return "", fmt.Errorf("nethelper: %s: %v", strings.TrimSpace(stderr.String()), errors.Join(runErr, err))
+	}
+	if rep.Refused {
+		return "", fmt.Errorf("nethelper: %w: %s", privexec.ErrNoElevator, rep.Error)
+	}
+	if rep.Error != "" {
+		return rep.Output, errors.New(rep.Error)
+	}
+	return rep.Output, nil
+}
+
+// FromOp returns the command that makes the change op does, or an error
+// if op is not one the helper makes.
+func FromOp(op privexec.Op) (Command, error) {
+	cmd, ok := fromOp(op)
+	if !ok || op.Dir != "" {
+		return Command{}, fmt.Errorf("%s is not a network change the helper makes", op)
+	}
+	cmd.MayFail = op.MayFail
+	return cmd, nil
+}
+
+func fromOp(op privexec.Op) (Command, bool) {
+	a := op.Args
+	switch filepath.Base(op.Program) {
+	case "resolvectl":
+		return Command{Name: "dns-flush"}, match(a, "flush-caches")
+	case "nft":
+		return Command{Name: "nft", Input: op.Stdin}, match(a, "-f", "-")
+	case "ip":
+	default:
+		return Command{}, false
+	}
+	if op.Stdin != "" {
+		return Command{}, false
+	}
+
+	family := "" // as ip infers it
+	if len(a) > 0 && (a[0] == "-4" || a[0] == "-6") {
+		family, a = a[0][1:], a[1:]
+	}
+	switch {
+	case len(a) == 6 && match(a, "tuntap", "add", "dev", a[3], "mode", "tap"):
+		return Command{Name: "tap-add", Args: []string{a[3]}}, true
+	case len(a) == 6 && match(a, "tuntap", "del", "dev", a[3], "mode", "tap"):
+		return Command{Name: "tap-del", Args: []string{a[3]}}, true
+	case len(a) == 6 && match(a, "link", "set", "dev", a[3], "alias", a[5]):
+		return Command{Name: "link-alias", Args: []string{a[3], a[5]}}, true
+	case len(a) == 6 && match(a, "link", "set", "dev", a[3], "mtu", a[5]):
+		return Command{Name: "link-mtu", Args: []string{a[3], a[5]}}, true
+	case len(a) == 4 && match(a, "link", "set", a[2], "up"):
+		return Command{Name: "link-up", Args: []string{a[2]}}, true
+	case len(a) == 5 && family == "" && match(a, "addr", "add", a[2], "dev", a[4]),
+		len(a) == 6 && family == "6" && match(a, "addr", "add", a[2], "dev", a[4], "nodad"):
+		return Command{Name: "addr-add", Args: []string{a[2], a[4]}}, true
+	case len(a) == 5 && match(a, "addr", "replace", a[2], "dev", a[4]):
+		return Command{Name: "addr-replace", Args: []string{a[2], a[4]}}, true
+	case len(a) >= 3 && a[0] == "route" && (a[1] == "add" || a[1] == "del" || a[1] == "replace"):
+		return Command{Name: "route", Args: append([]string{family, a[1]}, a[2:]...)}, true
+	}
+	return Command{}, false
+}
+
+// match reports whether args are want.
+func match(args []string, want ...string) bool {
+	return slices.Equal(args, want)
+}
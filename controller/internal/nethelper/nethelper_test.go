@@ -0,0 +1,239 @@
+package nethelper
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+func testServer(run func(privexec.Op) (string, error)) *Server {
+	return &Server{
+		uid:   1000,
+		isTap: func(dev string) bool { return strings.HasPrefix(dev, "tap") },
+		run:   run,
+	}
+}
+
+// TestFromOp checks that the ops the network package makes become
+// commands the helper turns back into the same command lines.
+func TestFromOp(t *testing.T) {
+	s := testServer(nil)
+	for _, tt := range []struct {
+		op   privexec.Op
+		want []string // the helper's arguments to ip, if not op's
+	}{
+		{op: privexec.Command("ip", "tuntap", "add", "dev", "tap0", "mode", "tap"),
+			want: []string{"tuntap", "add", "dev", "tap0", "mode", "tap", "user", "1000"}},
+		{op: privexec.Command("ip", "tuntap", "del", "dev", "tap0", "mode", "tap")},
+		{op: privexec.Command("ip", "link", "set", "dev", "tap0", "alias", "torvm:default")},
+		{op: privexec.Command("ip", "addr", "add", "10.10.10.1/30", "dev", "tap0")},
+		{op: privexec.Command("ip", "link", "set", "dev", "tap0", "mtu", "1500")},
+		{op: privexec.Command("ip", "link", "set", "tap0", "up")},
+		{op: privexec.Command("ip", "addr", "replace", "192.168.1.5/24", "dev", "wlp3s0")},
+		{op: privexec.Command("ip", "addr", "replace", "10.0.0.2/24", "dev", "eth0")}, // a host address put back
+		{op: privexec.Command("ip", "route", "add", "0.0.0.0/1", "via", "10.10.10.2", "dev", "tap0", "metric", "50", "proto", "122")},
+		{op: privexec.Command("ip", "route", "replace", "default", "via", "192.168.1.1", "dev", "wlp3s0", "proto", "dhcp", "src", "192.168.1.5", "metric", "600")},
+		{op: privexec.Command("ip", "route", "del", "default", "metric", "50", "proto", "122")},
+		{op: privexec.Command("ip", "-6", "addr", "add", "fd00::1/64", "dev", "tap0", "nodad")},
+		{op: privexec.Command("ip", "-6", "route", "add", "unreachable", "2000::/3", "metric", "50", "proto", "122")},
+		{op: privexec.Command("ip", "-4", "route", "del", "default", "via", "10.10.10.2", "dev", "tap0", "metric", "50", "proto", "122")},
+		{op: privexec.Command("resolvectl", "flush-caches")},
+	} {
+		cmd, err := FromOp(tt.op)
+		if err != nil {
+			t.Errorf("FromOp(%s): %v", tt.op, err)
+			continue
+		}
+		got, err := s.op(cmd)
+		if err != nil {
+			t.Errorf("%s: %+v: %v", tt.op, cmd, err)
+			continue
+		}
+		want := tt.op.Args
+		if tt.want != nil {
+			want = tt.want
+		}
+		if got.Program != tt.op.Program || !slices.Equal(got.Args, want) {
+			t.Errorf("%s became %s", tt.op, got)
+		}
+	}
+
+	nft := privexec.Command("nft", "-f", "-")
+	nft.Stdin = "table inet torvm_default\ndelete table inet torvm_default\n"
+	nft.MayFail = true
+	cmd, err := FromOp(nft)
+	if err != nil || cmd.Name != "nft" || cmd.Input != nft.Stdin || !cmd.MayFail {
+		t.Errorf("FromOp(nft) = %+v, %v", cmd, err)
+	}
+}
+
+func TestFromOpRefuses(t *testing.T) {
+	inDir := privexec.Command("ip", "link", "set", "tap0", "up")
+	inDir.Dir = "/tmp"
+	for _, op := range []privexec.Op{
+		privexec.Command("systemctl", "daemon-reload"),
+		privexec.Command("install", "-m", "0644", "/tmp/x", "/etc/systemd/system/torvm.service"),
+		privexec.Command("ip", "link", "set", "dev", "tap0", "netns", "1"),
+		privexec.Command("ip", "rule", "add", "from", "all", "lookup", "main"),
+		privexec.Command("nft", "flush", "ruleset"),
+		privexec.Command("resolvectl", "dns", "eth0", "1.1.1.1"),
+		inDir,
+	} {
+		if cmd, err := FromOp(op); err == nil {
+			t.Errorf("FromOp(%s) = %+v, want an error", op, cmd)
+		}
+	}
+}
+
+// TestOpChecks checks commands a caller could write by hand.
+func TestOpChecks(t *testing.T) {
+	s := testServer(nil)
+	for _, c := range []Command{
+		{Name: "exec", Args: []string{"/bin/sh"}},
+		{Name: "tap-add", Args: []string{"tap0", "extra"}},
+		{Name: "tap-add", Args: []string{"../../x"}},
+		{Name: "link-up", Args: []string{"eth0"}},
+		{Name: "link-mtu", Args: []string{"tap0", "1"}},
+		{Name: "link-alias", Args: []string{"tap0", "other"}},
+		{Name: "addr-add", Args: []string{"10.0.0.1/24", "eth0"}},
+		{Name: "addr-replace", Args: []string{"not an address", "eth0"}},
+		{Name: "route", Args: []string{"4", "flush", "default"}},
+		{Name: "route", Args: []string{"4", "add", "default", "table", "main"}},
+		{Name: "route", Args: []string{"4", "add", "default", "via", "-x"}},
+		{Name: "route", Args: []string{"4", "add", "default", "metric"}},
+		{Name: "route", Args: []string{"5", "add", "default"}},
+		{Name: "nft", Input: "flush ruleset\n"},
+		{Name: "dns-flush", Args: []string{"--all"}},
+	} {
+		if op, err := s.op(c); err == nil {
+			t.Errorf("%+v became %s, want an error", c, op)
+		}
+	}
+}
+
+func TestCheckScript(t *testing.T) {
+	ok := []string{
+		"table inet torvm_default\ndelete table inet torvm_default\n",
+		`table inet torvm_default
+delete table inet torvm_default
+table inet torvm_default {
+	chain input {
+		type filter hook input priority 0; policy drop;
+		iifname "lo" accept
+		iifname "tap0" ip saddr 10.10.10.0/30 accept
+	}
+}
+`,
+		"table inet torvm_default_dns { # DNS leaks\n\tchain output { type filter hook output priority 0; policy accept; }\n}\n",
+	}
+	for _, s := range ok {
+		if err := checkScript(s); err != nil {
+			t.Errorf("checkScript(%q): %v", s, err)
+		}
+	}
+	bad := []string{
+		"",
+		"flush ruleset\n",
+		"table inet filter { chain input { policy accept; } }\n",
+		"table ip torvm_default\n",
+		"delete table inet filter\n",
+		"delete chain inet filter input\n",
+		"add rule inet filter input accept\n",
+		"table inet torvm_default { } ; flush ruleset\n",
+		"table inet torvm_default { iifname \"}\" } flush ruleset\n",
+		"table inet torvm_default # }\nflush ruleset\n",
+		"table inet torvm_default {\n\tinclude \"/etc/nftables.conf\"\n}\n",
+		"include \"/etc/nftables.conf\"\n",
+		"table inet torvm_default {\n",
+		"}\n",
+		"table inet torvm_default \\\n{ }\n",
+		"{ flush ruleset }\n",
+	}
+	for _, s := range bad {
+		if err := checkScript(s); err == nil {
+			t.Errorf("checkScript(%q) passed", s)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	var ran []string
+	s := testServer(func(op privexec.Op) (string, error) {
+		ran = append(ran, op.String())
+		if op.Args[0] == "route" {
+			return "RTNETLINK answers: No such process", errors.New("exit status 2")
+		}
+		return "ok", nil
+	})
+	var audited int
+	s.audit = func(privexec.Record) { audited++ }
+	handle := func(cmds ...Command) reply {
+		data, _ := json.Marshal(request{Version: protocolVersion, Commands: cmds})
+		ran = nil
+		return s.Handle(strings.NewReader(string(data)))
+	}
+
+	up := Command{Name: "link-up", Args: []string{"tap0"}}
+	del := Command{Name: "route", Args: []string{"", "del", "default", "proto", "122"}}
+	if rep := handle(up); rep.Error != "" || rep.Output != "ok" {
+		t.Errorf("single command: %+v", rep)
+	}
+
+	// A command that may fail does not stop the rest.
+	del.MayFail = true
+	if rep := handle(del, up); rep.Error != "" || len(ran) != 2 || audited != 3 {
+		t.Errorf("may fail: %+v, ran %q", rep, ran)
+	}
+	del.MayFail = false
+	if rep := handle(del, up); rep.Error == "" || len(ran) != 1 {
+		t.Errorf("failure: %+v, ran %q", rep, ran)
+	}
+
+	// Nothing runs unless every command passes.
+	if rep := handle(up, Command{Name: "link-up", Args: []string{"eth0"}}); rep.Error == "" || len(ran) != 0 {
+		t.Errorf("refused command: %+v, ran %q", rep, ran)
+	}
+	if rep := s.Handle(strings.NewReader(`{"version":99,"commands":[{"name":"dns-flush"}]}`)); rep.Error == "" {
+		t.Errorf("wrong version: %+v", rep)
+	}
+}
+
+func TestClientFallsBack(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the helper")
+	}
+	dir := t.TempDir()
+	refusing := filepath.Join(dir, "refusing")
+	if err := os.WriteFile(refusing, []byte("#!/bin/sh\ncat >/dev/null\necho '{\"refused\":true,\"error\":\"no\"}'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	failing := filepath.Join(dir, "failing")
+	if err := os.WriteFile(failing, []byte("#!/bin/sh\ncat >/dev/null\necho '{\"output\":\"x\",\"error\":\"ip failed\"}'\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	up := privexec.Command("ip", "link", "set", "tap0", "up")
+	for _, tt := range []struct {
+		path string
+		ops  []privexec.Op
+	}{
+		{filepath.Join(dir, "missing"), []privexec.Op{up}},
+		{refusing, []privexec.Op{up}},
+		{failing, []privexec.Op{up, privexec.Command("systemctl", "daemon-reload")}},
+	} {
+		if _, err := (Client{Path: tt.path}).RunOps(tt.ops); !errors.Is(err, privexec.ErrNoElevator) {
+			t.Errorf("%s: err = %v, want ErrNoElevator", filepath.Base(tt.path), err)
+		}
+	}
+	out, err := Client{Path: failing}.RunOps([]privexec.Op{up})
+	if err == nil || errors.Is(err, privexec.ErrNoElevator) || out != "x" {
+		t.Errorf("failing helper: %q, %v", out, err)
+	}
+}
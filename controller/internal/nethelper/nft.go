@@ -0,0 +1,123 @@
+package nethelper
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tableRe matches the names of TorVM's nftables tables: a label of
+// network.InstanceLabel with ":" made "_", and a suffix for the DNS leak
+// and sharing tables.
+var tableRe = regexp.MustCompile(`^torvm_[A-Za-z0-9_]{1,48}$`)
+
+// checkScript checks that an nftables script changes only TorVM's
+// tables: at the top level it may only declare, fill in, and delete inet
+// tables whose names tableRe matches, and it may not include files.
+// The script is read the way nft reads it, with quoted strings, "#"
+// comments, and statements ended by a newline or ";". Backslashes and
+// single quotes, which the controller's scripts do not use, are refused
+// rather than interpreted.
+func checkScript(script string) error {
+	if strings.TrimSpace(script) == "" {
+		return errors.New("empty script")
+	}
+	var (
+		depth int
+		stmt  []string // the words of the top-level statement so far
+		word  strings.Builder
+	)
+	endWord := func() error {
+		w := word.String()
+		word.Reset()
+		switch {
+		case w == "":
+		case w == "include":
+			return errors.New("include is not allowed")
+		case depth == 0:
+			stmt = append(stmt, w)
+		}
+		return nil
+	}
+	endStmt := func(block bool) error {
+		if err := endWord(); err != nil {
+			return err
+		}
+		err := checkStatement(stmt, block)
+		stmt = nil
+		return err
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch c {
+		case '"':
+			end := strings.IndexByte(script[i+1:], '"')
+			if end < 0 {
+				return errors.New("unterminated string")
+			}
+			if depth == 0 {
+				return errors.New("string outside a table")
+			}
+			i += end + 1
+		case '#':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end - 1 // the newline ends the statement
+		case '\\', '\'':
+			return fmt.Errorf("%q is not allowed", c)
+		case '{':
+			if depth == 0 {
+				if err := endStmt(true); err != nil {
+					return err
+				}
+			} else if err := endWord(); err != nil {
+				return err
+			}
+			depth++
+		case '}':
+			if err := endWord(); err != nil {
+				return err
+			}
+			if depth == 0 {
+				return errors.New("unbalanced }")
+			}
+			depth--
+		case '\n', ';':
+			if depth == 0 {
+				if err := endStmt(false); err != nil {
+					return err
+				}
+			} else if err := endWord(); err != nil {
+				return err
+			}
+		case ' ', '\t', '\r':
+			if err := endWord(); err != nil {
+				return err
+			}
+		default:
+			word.WriteByte(c)
+		}
+	}
+	if depth != 0 {
+		return errors.New("unbalanced {")
+	}
+	return endStmt(false)
+}
+
+// checkStatement checks a top-level statement; block is set if it opens
+// a block.
+func checkStatement(words []string, block bool) error {
+	switch {
+	case len(words) == 0 && !block:
+		return nil
+	case len(words) == 3 && words[0] == "table" && words[1] == "inet" && tableRe.MatchString(words[2]):
+		return nil
+	case len(words) == 4 && !block && words[0] == "delete" && words[1] == "table" && words[2] == "inet" && tableRe.MatchString(words[3]):
+		return nil
+	}
+	return fmt.Errorf("%q is not a TorVM table statement", strings.Join(words, " "))
+}
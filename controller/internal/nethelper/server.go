@@ -0,0 +1,282 @@
+package nethelper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strconv"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+// Server checks the commands of a request and runs them for one caller.
+type Server struct {
+	uid int // the caller, who owns the TAP devices it creates
+
+	isTap func(dev string) bool             // replaceable in tests
+	run   func(privexec.Op) (string, error) // replaceable in tests
+	audit func(privexec.Record)
+}
+
+// Handle reads a request from in and runs its commands, all of them
+// checked before the first runs. They run in order and stop at the first
+// that fails, unless it may; the reply holds the output of a single
+// command.
+func (s *Server) Handle(in io.Reader) reply {
+	var req request
+	if err := json.NewDecoder(io.LimitReader(in, maxRequest)).Decode(&req); err != nil {
+		return reply{Error: fmt.Sprintf("nethelper: read request: %v", err)}
+	}
+	if req.Version != protocolVersion {
+		return reply{Error: fmt.Sprintf("nethelper: protocol version %d, helper speaks %d; install the helper built with this controller", req.Version, protocolVersion)}
+	}
+	if len(req.Commands) == 0 {
+		return reply{Error: "nethelper: no commands"}
+	}
+	ops := make([]privexec.Op, len(req.Commands))
+	for i, c := range req.Commands {
+		op, err := s.op(c)
+		if err != nil {
+			return reply{Error: fmt.Sprintf("nethelper: %s: %v", c.Name, err)}
+		}
+		ops[i] = op
+	}
+
+	var rep reply
+	for i, op := range ops {
+		out, err := s.run(op)
+		if s.audit != nil {
+			s.audit(privexec.Record{Op: op, Elevated: true, Err: err})
+		}
+		if len(ops) == 1 {
+			rep.Output = out
+		}
+		if err != nil && !req.Commands[i].MayFail {
+			rep.Error = err.Error()
+			break
+		}
+	}
+	return rep
+}
+
+// op checks c and returns the command line that carries it out.
+func (s *Server) op(c Command) (privexec.Op, error) {
+	args := c.Args
+	arity := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("want %d arguments, got %d", n, len(args))
+		}
+		return nil
+	}
+	ip := func(args ...string) privexec.Op { return privexec.Command("ip", args...) }
+
+	switch c.Name {
+	case "tap-add":
+		if err := arity(1); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := checkDev(args[0]); err != nil {
+			return privexec.Op{}, err
+		}
+		// Owned by the caller, so that QEMU, run by the caller, can
+		// open it.
+		return ip("tuntap", "add", "dev", args[0], "mode", "tap", "user", strconv.Itoa(s.uid)), nil
+	case "tap-del":
+		if err := arity(1); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := checkDev(args[0]); err != nil {
+			return privexec.Op{}, err
+		}
+		return ip("tuntap", "del", "dev", args[0], "mode", "tap"), nil
+	case "link-alias":
+		if err := arity(2); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := s.checkTap(args[0]); err != nil {
+			return privexec.Op{}, err
+		}
+		if !aliasRe.MatchString(args[1]) {
+			return privexec.Op{}, fmt.Errorf("%q is not a TorVM label", args[1])
+		}
+		return ip("link", "set", "dev", args[0], "alias", args[1]), nil
+	case "link-mtu":
+		if err := arity(2); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := s.checkTap(args[0]); err != nil {
+			return privexec.Op{}, err
+		}
+		if mtu, err := strconv.Atoi(args[1]); err != nil || mtu < 68 || mtu > 65535 {
+			return privexec.Op{}, fmt.Errorf("MTU %q is not 68-65535", args[1])
+		}
+		return ip("link", "set", "dev", args[0], "mtu", args[1]), nil
+	case "link-up":
+		if err := arity(1); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := s.checkTap(args[0]); err != nil {
+			return privexec.Op{}, err
+		}
+		return ip("link", "set", args[0], "up"), nil
+	case "addr-add":
+		if err := arity(2); err != nil {
+			return privexec.Op{}, err
+		}
+		p, err := netip.ParsePrefix(args[0])
+		if err != nil {
+			return privexec.Op{}, err
+		}
+		if err := s.checkTap(args[1]); err != nil {
+			return privexec.Op{}, err
+		}
+		if p.Addr().Is6() {
+			return ip("-6", "addr", "add", args[0], "dev", args[1], "nodad"), nil
+		}
+		return ip("addr", "add", args[0], "dev", args[1]), nil
+	case "addr-replace":
+		// Puts back an address of the host's that went missing during a
+		// session, on any interface.
+		if err := arity(2); err != nil {
+			return privexec.Op{}, err
+		}
+		if _, err := netip.ParsePrefix(args[0]); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := checkDev(args[1]); err != nil {
+			return privexec.Op{}, err
+		}
+		return ip("addr", "replace", args[0], "dev", args[1]), nil
+	case "route":
+		if len(args) < 3 {
+			return privexec.Op{}, fmt.Errorf("want a family (\"\" to infer it), an action, and a route")
+		}
+		var family []string
+		switch args[0] {
+		case "":
+		case "4", "6":
+			family = []string{"-" + args[0]}
+		default:
+			return privexec.Op{}, fmt.Errorf("family %q is not 4 or 6", args[0])
+		}
+		switch args[1] {
+		case "add", "del", "replace":
+		default:
+			return privexec.Op{}, fmt.Errorf("action %q is not add, del, or replace", args[1])
+		}
+		if err := checkRoute(args[2:]); err != nil {
+			return privexec.Op{}, err
+		}
+		return ip(append(append(family, "route", args[1]), args[2:]...)...), nil
+	case "nft":
+		if err := arity(0); err != nil {
+			return privexec.Op{}, err
+		}
+		if err := checkScript(c.Input); err != nil {
+			return privexec.Op{}, err
+		}
+		op := privexec.Command("nft", "-f", "-")
+		op.Stdin = c.Input
+		return op, nil
+	case "dns-flush":
+		if err := arity(0); err != nil {
+			return privexec.Op{}, err
+		}
+		return privexec.Command("resolvectl", "flush-caches"), nil
+	}
+	return privexec.Op{}, fmt.Errorf("unknown command")
+}
+
+var (
+	// devRe matches interface names: at most IFNAMSIZ-1 characters.
+	devRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+	// aliasRe matches the labels network.InstanceLabel makes.
+	aliasRe = regexp.MustCompile(`^torvm:[A-Za-z0-9_-]{1,32}$`)
+	// wordRe matches the names ip gives route protocols, scopes, and
+	// preferences, and numbers.
+	wordRe = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+)
+
+func checkDev(dev string) error {
+	if !devRe.MatchString(dev) || dev == "." || dev == ".." {
+		return fmt.Errorf("%q is not an interface name", dev)
+	}
+	return nil
+}
+
+// checkTap checks that dev is a TAP (or TUN) device: the link commands
+// may change only those.
+func (s *Server) checkTap(dev string) error {
+	if err := checkDev(dev); err != nil {
+		return err
+	}
+	if !s.isTap(dev) {
+		return fmt.Errorf("%s is not a TAP device", dev)
+	}
+	return nil
+}
+
+// routeAttrs are the attributes a route may give, with how their values
+// are checked. They are those "ip route show" prints for the routes the
+// controller replaces and removes.
+var routeAttrs = map[string]func(string) error{
+	"via":    checkAddr,
+	"src":    checkAddr,
+	"dev":    checkDev,
+	"metric": checkWord,
+	"proto":  checkWord,
+	"scope":  checkWord,
+	"pref":   checkWord,
+	"nhid":   checkWord,
+}
+
+// routeFlags are the attributes a route may give without a value.
+var routeFlags = map[string]bool{"onlink": true, "linkdown": true, "dead": true}
+
+// checkRoute checks a route: an optional "unreachable", the destination,
+// then attributes.
+func checkRoute(route []string) error {
+	if route[0] == "unreachable" {
+		route = route[1:]
+	}
+	if len(route) == 0 {
+		return fmt.Errorf("no destination")
+	}
+	if dst := route[0]; dst != "default" {
+		if _, err := netip.ParsePrefix(dst); err != nil && checkAddr(dst) != nil {
+			return fmt.Errorf("destination %q is not an address or prefix", dst)
+		}
+	}
+	for i := 1; i < len(route); i++ {
+		key := route[i]
+		if routeFlags[key] {
+			continue
+		}
+		check, ok := routeAttrs[key]
+		if !ok {
+			return fmt.Errorf("route attribute %q is not allowed", key)
+		}
+		if i+1 >= len(route) {
+			return fmt.Errorf("route attribute %q has no value", key)
+		}
+		i++
+		if err := check(route[i]); err != nil {
+			return fmt.Errorf("route %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func checkAddr(s string) error {
+	_, err := netip.ParseAddr(s)
+	return err
+}
+
+func checkWord(s string) error {
+	if !wordRe.MatchString(s) {
+		return fmt.Errorf("%q is not allowed", s)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// dnsPorts lists the ports BlockDNSLeaks closes: DNS and DNS over TLS.
+// DNS over HTTPS shares port 443 with ordinary web traffic and cannot be
+// told apart by a firewall.
+var dnsPorts = []string{"53", "853"}
+
+// DNSBlockOptions configures BlockDNSLeaks.
+type DNSBlockOptions struct {
+	VMIP   net.IP // the VM redirects DNS sent to it to Tor's DNSPort
+	VMIPv6 net.IP // VM end of the IPv6 link in route mode, else nil
+	// DNS are the DNS servers set on the TAP device, such as the default
+	// 4.2.2.4 and 4.2.2.2 on Windows. The routes send them to the VM,
+	// which answers for them.
+	DNS []net.IP
+}
+
+// allowed returns the addresses DNS may still be sent to.
+func (o DNSBlockOptions) allowed() []net.IP {
+	var ips []net.IP
+	for _, ip := range append([]net.IP{o.VMIP, o.VMIPv6}, o.DNS...) {
+		if ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// dnsBlockName derives the name of the DNS leak nftables table or pf anchor
+// from an instance label. It is kept apart from the failsafe so either
+// can be removed without touching the other.
+func dnsBlockName(label string) string {
+	return failsafeName(label) + "_dns"
+}
+
+// nftDNSBlockRuleset returns an nft script that replaces table with an
+// output chain dropping DNS and DNS over TLS to anything but loopback,
+// the VM, and the TAP's DNS servers. Other traffic is left to the rest of the ruleset.
+func nftDNSBlockRuleset(table string, opts DNSBlockOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", table)
+	fmt.Fprintf(&b, "delete table inet %s\n", table)
+	fmt.Fprintf(&b, "table inet %s {\n", table)
+	b.WriteString("\tchain output {\n\t\ttype filter hook output priority 0; policy accept;\n")
+	b.WriteString("\t\toif \"lo\" accept\n")
+	for _, ip := range opts.allowed() {
+		family := "ip"
+		if ip.To4() == nil {
+			family = "ip6"
+		}
+		fmt.Fprintf(&b, "\t\t%s daddr %s accept\n", family, ip)
+	}
+	fmt.Fprintf(&b, "\t\tmeta l4proto { tcp, udp } th dport { %s } drop\n", strings.Join(dnsPorts, ", "))
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// pfDNSBlockRules returns a pf ruleset for the DNS leak anchor. It only
+// blocks, so it never passes traffic the failsafe anchor would drop.
+func pfDNSBlockRules(opts DNSBlockOptions) string {
+	var addrs []string
+	for _, ip := range opts.allowed() {
+		addrs = append(addrs, ip.String())
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "table <torvm_dns> const { %s }\n", strings.Join(addrs, " "))
+	fmt.Fprintf(&b, "block drop out quick on ! lo0 proto { tcp udp } from any to ! <torvm_dns> port { %s }\n",
+		strings.Join(dnsPorts, " "))
+	return b.String()
+}
+
+// dnsBlockedRanges returns the remote addresses the Windows DNS leak rules
+// block: everything but loopback, the VM, and the TAP's DNS servers.
+func dnsBlockedRanges(opts DNSBlockOptions) []string {
+	var allowed []*net.IPNet
+	for _, ip := range opts.allowed() {
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		allowed = append(allowed, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return blockedRanges(allowed)
+}
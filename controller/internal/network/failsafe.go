@@ -0,0 +1,188 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// failsafeName derives the name of the failsafe nftables table, pf
+// anchor, or Windows Firewall rule from an instance label ("torvm:default" -> "torvm_default").
+// nftables names cannot contain ':' or '-'.
+func failsafeName(label string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, label)
+}
+
+// nftFamily returns the nft address match keyword for n.
+func nftFamily(n *net.IPNet) string {
+	if n.IP.To4() == nil {
+		return "ip6"
+	}
+	return "ip"
+}
+
+// nftFailsafeRuleset returns an nft script that replaces table with a
+// drop-all ruleset allowing only loopback, traffic between the host and
+// the TAP subnet, and the LAN ranges (plus the opts.KillSwitch
+// exceptions). Declaring the table before deleting it makes the delete
+// succeed whether or not it exists; nft -f applies the whole script as
+// one transaction, so there is no window without rules.
+func nftFailsafeRuleset(table string, opts BlockOptions) string {
+	var in, fwd, out strings.Builder
+	switch n := opts.Subnet; {
+	case opts.KillSwitch:
+		fmt.Fprintf(&in, "\t\tiifname %q accept\n", opts.TAPName)
+		fmt.Fprintf(&out, "\t\toifname %q accept\n", opts.TAPName)
+		fmt.Fprintf(&fwd, "\t\tiifname %q accept\n", opts.TAPName)
+		fmt.Fprintf(&fwd, "\t\toifname %q ct state established,related accept\n", opts.TAPName)
+		in.WriteString("\t\tudp sport 67 udp dport 68 accept\n")
+		out.WriteString("\t\tudp sport 68 udp dport 67 accept\n")
+	case n != nil:
+		fmt.Fprintf(&in, "\t\tiifname %q %s saddr %s accept\n", opts.TAPName, nftFamily(n), n)
+		fmt.Fprintf(&out, "\t\toifname %q %s daddr %s accept\n", opts.TAPName, nftFamily(n), n)
+	}
+	for _, n := range opts.LAN {
+		fmt.Fprintf(&in, "\t\t%s saddr %s accept\n", nftFamily(n), n)
+		fmt.Fprintf(&out, "\t\t%s daddr %s accept\n", nftFamily(n), n)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", table)
+	fmt.Fprintf(&b, "delete table inet %s\n", table)
+	fmt.Fprintf(&b, "table inet %s {\n", table)
+	b.WriteString("\tchain input {\n\t\ttype filter hook input priority 0; policy drop;\n")
+	b.WriteString("\t\tiif \"lo\" accept\n")
+	b.WriteString(in.String())
+	b.WriteString("\t}\n")
+	b.WriteString("\tchain forward {\n\t\ttype filter hook forward priority 0; policy drop;\n")
+	b.WriteString(fwd.String())
+	b.WriteString("\t}\n")
+	b.WriteString("\tchain output {\n\t\ttype filter hook output priority 0; policy drop;\n")
+	b.WriteString("\t\toif \"lo\" accept\n")
+	b.WriteString(out.String())
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// pfAnchorParent is the anchor under which the failsafe rules are loaded.
+// The stock macOS /etc/pf.conf evaluates "com.apple/*", so rules placed
+// there take effect without editing pf.conf.
+const pfAnchorParent = "com.apple/"
+
+// pfFailsafeRules returns a pf ruleset for the failsafe anchor that passes
+// loopback, traffic between the host and the VM subnet, and the LAN
+// ranges (plus the opts.KillSwitch exceptions), and drops everything
+// else. The rules are quick, so they end evaluation and cannot be
+// overridden by later rules in pf.conf.
+func pfFailsafeRules(opts BlockOptions) string {
+	var b strings.Builder
+	b.WriteString("pass quick on lo0 all\n")
+	if opts.KillSwitch {
+		// vmnet NATs the VM's traffic out of the uplink; the tag
+		// follows those packets from the bridge to the uplink.
+		fmt.Fprintf(&b, "pass in quick on %s all tag torvm\n", opts.TAPName)
+		fmt.Fprintf(&b, "pass out quick on %s all\n", opts.TAPName)
+		b.WriteString("pass out quick all tagged torvm\n")
+		b.WriteString("pass out quick proto udp from any port 68 to any port 67\n")
+		b.WriteString("pass in quick proto udp from any port 67 to any port 68\n")
+	}
+	pass := func(n *net.IPNet) {
+		family := "inet"
+		if n.IP.To4() == nil {
+			family = "inet6"
+		}
+		fmt.Fprintf(&b, "pass in quick %s from %s to any\n", family, n)
+		fmt.Fprintf(&b, "pass out quick %s from any to %s\n", family, n)
+	}
+	if opts.Subnet != nil {
+		pass(opts.Subnet)
+	}
+	for _, n := range opts.LAN {
+		pass(n)
+	}
+	b.WriteString("block drop quick all\n")
+	return b.String()
+}
+
+// parsePfctlToken extracts the reference token printed by "pfctl -E"
+// ("Token : 1234"), or "" if there is none.
+func parsePfctlToken(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if key, val, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "Token" {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
+
+// addrRange is an inclusive range of addresses of one family.
+type addrRange struct{ from, to netip.Addr }
+
+func prefixRange(p netip.Prefix) addrRange {
+	p = p.Masked()
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	last, _ := netip.AddrFromSlice(b)
+	return addrRange{p.Addr(), last}
+}
+
+// blockedRanges returns every address outside loopback and allowed, as
+// "first-last" ranges in the form accepted by the remoteip option of
+// "netsh advfirewall firewall". Windows Firewall block rules take
+// precedence over allow rules, so the failsafe has to block the
+// complement of what it allows rather than block all and allow some.
+func blockedRanges(allowed []*net.IPNet) []string {
+	var out []string
+	for _, family := range []struct{ all, loopback string }{
+		{"0.0.0.0/0", "127.0.0.0/8"},
+		{"::/0", "::1/128"},
+	} {
+		all := prefixRange(netip.MustParsePrefix(family.all))
+		ranges := []addrRange{prefixRange(netip.MustParsePrefix(family.loopback))}
+		for _, n := range allowed {
+			addr, ok := netip.AddrFromSlice(n.IP)
+			ones, bits := n.Mask.Size()
+			if !ok || bits == 0 {
+				continue
+			}
+			if bits == 32 {
+				addr = addr.Unmap()
+			}
+			if addr.Is4() != all.from.Is4() {
+				continue
+			}
+			ranges = append(ranges, prefixRange(netip.PrefixFrom(addr, ones)))
+		}
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i].from.Less(ranges[j].from) })
+
+		// next is the first address not yet allowed or blocked.
+		next, covered := all.from, false
+		for _, r := range ranges {
+			if next.Less(r.from) {
+				out = append(out, next.String()+"-"+r.from.Prev().String())
+			}
+			if !r.to.Less(next) {
+				if r.to == all.to {
+					covered = true
+					break
+				}
+				next = r.to.Next()
+			}
+		}
+		if !covered {
+			out = append(out, next.String()+"-"+all.to.String())
+		}
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestFailsafeName(t *testing.T) {
+	if got := failsafeName(InstanceLabel("lab-2")); got != "torvm_lab_2" {
+		t.Errorf("failsafeName = %q, want torvm_lab_2", got)
+	}
+}
+
+func TestPFFailsafeRules(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("192.168.64.0/24")
+	_, lan, _ := net.ParseCIDR("10.0.0.0/8")
+	rules := pfFailsafeRules(BlockOptions{TAPName: "bridge100", Subnet: subnet, LAN: []*net.IPNet{lan}})
+
+	lines := strings.Split(strings.TrimSpace(rules), "\n")
+	if last := lines[len(lines)-1]; last != "block drop quick all" {
+		t.Errorf("last rule = %q, want block drop quick all", last)
+	}
+	for _, want := range []string{
+		"pass quick on lo0 all",
+		"pass in quick inet from 192.168.64.0/24 to any",
+		"pass out quick inet from any to 192.168.64.0/24",
+		"pass in quick inet from 10.0.0.0/8 to any",
+		"pass out quick inet from any to 10.0.0.0/8",
+	} {
+		if !strings.Contains(rules, want+"\n") {
+			t.Errorf("rules lack %q:\n%s", want, rules)
+		}
+	}
+}
+
+func TestParsePfctlToken(t *testing.T) {
+	out := "No ALTQ support in kernel\nALTQ related functions disabled\npf enabled\nToken : 13297435404929531399\n"
+	if got := parsePfctlToken(out); got != "13297435404929531399" {
+		t.Errorf("parsePfctlToken = %q", got)
+	}
+	if got := parsePfctlToken("pf enabled\n"); got != "" {
+		t.Errorf("parsePfctlToken without token = %q, want empty", got)
+	}
+}
+
+func TestNFTFailsafeRuleset(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.10.10.0/30")
+	_, lan, _ := net.ParseCIDR("192.168.0.0/16")
+	rs := nftFailsafeRuleset("torvm_default", BlockOptions{TAPName: "tap0", Subnet: subnet, LAN: []*net.IPNet{lan}})
+
+	// Replace-in-place idiom: declare, delete, then define.
+	if !strings.HasPrefix(rs, "table inet torvm_default\ndelete table inet torvm_default\ntable inet torvm_default {\n") {
+		t.Errorf("ruleset does not replace the table atomically:\n%s", rs)
+	}
+	for _, want := range []string{
+		"type filter hook input priority 0; policy drop;",
+		"type filter hook forward priority 0; policy drop;",
+		"type filter hook output priority 0; policy drop;",
+		`iif "lo" accept`,
+		`oif "lo" accept`,
+		`iifname "tap0" ip saddr 10.10.10.0/30 accept`,
+		`oifname "tap0" ip daddr 10.10.10.0/30 accept`,
+		"ip saddr 192.168.0.0/16 accept",
+		"ip daddr 192.168.0.0/16 accept",
+	} {
+		if !strings.Contains(rs, want) {
+			t.Errorf("ruleset lacks %q:\n%s", want, rs)
+		}
+	}
+
+	if rs := nftFailsafeRuleset("torvm_default", BlockOptions{TAPName: "tap0"}); strings.Contains(rs, "tap0") {
+		t.Errorf("ruleset without subnet allows the TAP:\n%s", rs)
+	}
+}
+
+func TestFailsafeRulesKillSwitch(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.10.10.0/30")
+	opts := BlockOptions{TAPName: "tap0", Subnet: subnet, KillSwitch: true}
+
+	rs := nftFailsafeRuleset("torvm_default", opts)
+	for _, want := range []string{
+		"\t\tiifname \"tap0\" accept\n",
+		"\t\toifname \"tap0\" accept\n",
+		`oifname "tap0" ct state established,related accept`,
+		"udp sport 68 udp dport 67 accept",
+		"udp sport 67 udp dport 68 accept",
+	} {
+		if !strings.Contains(rs, want) {
+			t.Errorf("nft ruleset lacks %q:\n%s", want, rs)
+		}
+	}
+	if fwd := rs[strings.Index(rs, "chain forward"):strings.Index(rs, "chain output")]; !strings.Contains(fwd, `iifname "tap0" accept`) {
+		t.Errorf("forward chain does not pass VM traffic:\n%s", fwd)
+	}
+
+	opts.TAPName = "bridge100"
+	rules := pfFailsafeRules(opts)
+	for _, want := range []string{
+		"pass in quick on bridge100 all tag torvm",
+		"pass out quick on bridge100 all",
+		"pass out quick all tagged torvm",
+	} {
+		if !strings.Contains(rules, want+"\n") {
+			t.Errorf("pf rules lack %q:\n%s", want, rules)
+		}
+	}
+	if !strings.HasSuffix(rules, "block drop quick all\n") {
+		t.Errorf("pf rules do not end with block:\n%s", rules)
+	}
+}
+
+func TestBlockedRanges(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.10.10.0/30")
+	_, lan, _ := net.ParseCIDR("10.0.0.0/8")
+	_, link, _ := net.ParseCIDR("169.254.0.0/16")
+	got := blockedRanges([]*net.IPNet{subnet, link, lan})
+	want := []string{
+		"0.0.0.0-9.255.255.255",
+		"11.0.0.0-126.255.255.255",
+		"128.0.0.0-169.253.255.255",
+		"169.255.0.0-255.255.255.255",
+		"::-::",
+		"::2-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("blockedRanges =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	_, all, _ := net.ParseCIDR("0.0.0.0/0")
+	if got := blockedRanges([]*net.IPNet{all}); len(got) != 2 || !strings.HasPrefix(got[0], "::") {
+		t.Errorf("blockedRanges with 0.0.0.0/0 = %v, want IPv6 ranges only", got)
+	}
+}
+
+func TestDNSBlockRules(t *testing.T) {
+	opts := DNSBlockOptions{VMIP: net.ParseIP("10.10.10.1"), VMIPv6: net.ParseIP("fd10:10:10::1")}
+
+	rs := nftDNSBlockRuleset("torvm_default_dns", opts)
+	for _, want := range []string{
+		"delete table inet torvm_default_dns\n",
+		"policy accept;",
+		"oif \"lo\" accept",
+		"ip daddr 10.10.10.1 accept",
+		"ip6 daddr fd10:10:10::1 accept",
+		"meta l4proto { tcp, udp } th dport { 53, 853 } drop",
+	} {
+		if !strings.Contains(rs, want) {
+			t.Errorf("nft ruleset missing %q:\n%s", want, rs)
+		}
+	}
+
+	pf := pfDNSBlockRules(opts)
+	if strings.Contains(pf, "pass") {
+		t.Errorf("pf DNS rules must only block:\n%s", pf)
+	}
+	for _, want := range []string{
+		"table <torvm_dns> const { 10.10.10.1 fd10:10:10::1 }",
+		"block drop out quick on ! lo0 proto { tcp udp } from any to ! <torvm_dns> port { 53 853 }",
+	} {
+		if !strings.Contains(pf, want) {
+			t.Errorf("pf rules missing %q:\n%s", want, pf)
+		}
+	}
+
+	got := strings.Join(dnsBlockedRanges(DNSBlockOptions{VMIP: net.ParseIP("10.10.10.1")}), ",")
+	if !strings.HasPrefix(got, "0.0.0.0-10.10.10.0,10.10.10.2-126.255.255.255,128.0.0.0-255.255.255.255,") {
+		t.Errorf("dnsBlockedRanges = %s", got)
+	}
+
+	// The Windows TAP defaults to the resolvers 4.2.2.4 and 4.2.2.2,
+	// which must not be blocked.
+	got = strings.Join(dnsBlockedRanges(DNSBlockOptions{
+		VMIP: net.ParseIP("10.10.10.1"),
+		DNS:  []net.IP{net.ParseIP("4.2.2.4"), net.ParseIP("4.2.2.2")},
+	}), ",")
+	if !strings.HasPrefix(got, "0.0.0.0-4.2.2.1,4.2.2.3-4.2.2.3,4.2.2.5-10.10.10.0,") {
+		t.Errorf("dnsBlockedRanges with the Windows defaults = %s", got)
+	}
+}
@@ -0,0 +1,171 @@
+package network
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+// Routes cannot carry free-form comments, so the controller tags the
+// routes it installs with an iproute2 protocol number instead, one per
+// instance so that one instance's cleanup leaves another's routes alone.
+// The numbers routeProtoBase to routeProtoBase+routeProtoCount-1 are
+// unassigned in /etc/iproute2/rt_protos; the default instance keeps
+// routeProtoBase, which every instance used before.
+const (
+	routeProtoBase  = 122
+	routeProtoCount = 64
+)
+
+// routeProto returns the protocol number that tags the routes of the
+// instance with the given label (see InstanceLabel).
+func routeProto(label string) string {
+	if label == InstanceLabel("default") {
+		return strconv.Itoa(routeProtoBase)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(label))
+	return strconv.Itoa(routeProtoBase + 1 + int(h.Sum32()%(routeProtoCount-1)))
+}
+
+// isRouteProto reports whether proto tags the routes of some instance.
+func isRouteProto(proto string) bool {
+	n, err := strconv.Atoi(proto)
+	return err == nil && n >= routeProtoBase && n < routeProtoBase+routeProtoCount
+}
+
+// ipAddr is an interface address captured from "ip -o addr show".
+type ipAddr struct {
+	Dev  string `json:"dev"`
+	CIDR string `json:"cidr"`
+}
+
+// parseDefaultRoutes parses "ip route show default" output into argument
+// lists suitable for "ip route replace". Status flags that iproute2 prints
+// but does not accept as input (linkdown, dead) are dropped.
+func parseDefaultRoutes(out string) [][]string {
+	var routes [][]string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != "default" {
+			continue
+		}
+		args := make([]string, 0, len(fields))
+		for _, f := range fields {
+			switch f {
+			case "linkdown", "dead":
+				continue
+			}
+			args = append(args, f)
+		}
+		routes = append(routes, args)
+	}
+	return routes
+}
+
+// untaggedRoutes returns the routes, as parsed by parseDefaultRoutes, that
+// no instance of the controller installed.
+func untaggedRoutes(routes [][]string) [][]string {
+	var out [][]string
+	for _, r := range routes {
+		if i := slices.Index(r, "proto"); i < 0 || i+1 >= len(r) || !isRouteProto(r[i+1]) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// parseAddrs parses "ip -o addr show" output into interface addresses,
+// skipping loopback, and the dynamic addresses of DHCP and SLAAC, whose
+// leases their clients keep.
+func parseAddrs(out string) []ipAddr {
+	var addrs []ipAddr
+	for _, line := range strings.Split(out, "\n") {
+		// Format: "2: eth0    inet 192.168.1.5/24 brd ... scope global eth0\ ..."
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		dev := fields[1]
+		family := fields[2]
+		if family != "inet" && family != "inet6" {
+			continue
+		}
+		if dev == "lo" {
+			continue
+		}
+		// Link-local IPv6 addresses are recreated by the kernel.
+		if strings.HasPrefix(fields[3], "fe80:") || isDynamic(fields) {
+			continue
+		}
+		addrs = append(addrs, ipAddr{Dev: dev, CIDR: fields[3]})
+	}
+	return addrs
+}
+
+// defaultGateway returns the gateway and device of the first saved default
+// route that does not go out excludeDev. gw is empty for a point-to-point
+// default route without a next hop.
+func defaultGateway(routes [][]string, excludeDev string) (gw, dev string) {
+	for _, r := range routes {
+		var via, d string
+		for i := 0; i+1 < len(r); i++ {
+			switch r[i] {
+			case "via":
+				via = r[i+1]
+			case "dev":
+				d = r[i+1]
+			}
+		}
+		if d != "" && d != excludeDev {
+			return via, d
+		}
+	}
+	return "", ""
+}
+
+// routeDev returns the device of a route as "ip route show" prints it,
+// or "".
+func routeDev(fields []string) string {
+	if i := slices.Index(fields, "dev"); i >= 0 && i+1 < len(fields) {
+		return fields[i+1]
+	}
+	return ""
+}
+
+// isDynamic reports whether the fields of an "ip -o addr show" line flag
+// the address dynamic. The flags end where the "\" that stands for a
+// line break starts, which may follow the last one without a space.
+func isDynamic(fields []string) bool {
+	for _, f := range fields[4:] {
+		flag, end := strings.CutSuffix(f, `\`)
+		if flag == "dynamic" {
+			return true
+		}
+		if end {
+			break
+		}
+	}
+	return false
+}
+
+// missingAddrs returns the addresses of saved that are not among cur.
+func missingAddrs(saved, cur []ipAddr) []ipAddr {
+	var out []ipAddr
+	for _, a := range saved {
+		if !slices.Contains(cur, a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// restoreAddrOp returns the op that puts back the host address a. It is
+// "ip addr replace", not "add": the network helper adds addresses only
+// to TAP devices, and replaces them on any interface.
+func restoreAddrOp(a ipAddr) privexec.Op {
+	return privexec.Command("ip", "addr", "replace", a.CIDR, "dev", a.Dev)
+}
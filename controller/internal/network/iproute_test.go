@@ -0,0 +1,113 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/nethelper"
+)
+
+func TestParseDefaultRoutes(t *testing.T) {
+	out := "default via 192.168.1.1 dev wlan0 proto dhcp src 192.168.1.5 metric 600\n" +
+		"default via 10.0.0.1 dev eth0 metric 100 linkdown\n" +
+		"10.10.10.0/30 dev torvm0 proto kernel scope link src 10.10.10.2\n"
+	got := parseDefaultRoutes(out)
+	want := [][]string{
+		{"default", "via", "192.168.1.1", "dev", "wlan0", "proto", "dhcp", "src", "192.168.1.5", "metric", "600"},
+		{"default", "via", "10.0.0.1", "dev", "eth0", "metric", "100"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDefaultRoutes = %q, want %q", got, want)
+	}
+}
+
+func TestUntaggedRoutes(t *testing.T) {
+	routes := [][]string{
+		{"default", "via", "10.10.10.1", "dev", "torvm0", "proto", "122", "metric", "50"},
+		{"default", "via", "192.168.1.1", "dev", "wlan0", "proto", "dhcp", "metric", "0"},
+		{"default", "dev", "ppp0", "scope", "link"},
+	}
+	got := untaggedRoutes(routes)
+	if !reflect.DeepEqual(got, routes[1:]) {
+		t.Errorf("untaggedRoutes = %q, want %q", got, routes[1:])
+	}
+}
+
+func TestRouteProtoPerInstance(t *testing.T) {
+	def, lab := routeProto(InstanceLabel("default")), routeProto(InstanceLabel("lab"))
+	if def != "122" {
+		t.Errorf("default instance proto = %s, want 122 as before", def)
+	}
+	if lab == def || !isRouteProto(lab) {
+		t.Errorf("lab instance proto = %s, want one of its own", lab)
+	}
+	if routeProto(InstanceLabel("lab")) != lab {
+		t.Error("routeProto is not stable")
+	}
+
+	// Neither instance takes the other's default route for the host's.
+	routes := [][]string{
+		{"default", "via", "10.10.10.1", "dev", "torvm0", "proto", def, "metric", "50"},
+		{"default", "via", "10.10.11.1", "dev", "torvm1", "proto", lab, "metric", "50"},
+		{"default", "via", "192.168.1.1", "dev", "wlan0", "proto", "dhcp", "metric", "600"},
+	}
+	if got := untaggedRoutes(routes); !reflect.DeepEqual(got, routes[2:]) {
+		t.Errorf("untaggedRoutes = %q, want the host's route only", got)
+	}
+	if dev := routeDev(routes[1]); dev != "torvm1" {
+		t.Errorf("routeDev = %q", dev)
+	}
+}
+
+func TestParseAddrs(t *testing.T) {
+	out := "1: lo    inet 127.0.0.1/8 scope host lo\\       valid_lft forever preferred_lft forever\n" +
+		"2: wlan0    inet 192.168.1.5/24 brd 192.168.1.255 scope global dynamic wlan0\\       valid_lft 3000sec\n" +
+		"2: wlan0    inet6 fe80::1/64 scope link\\       valid_lft forever\n" +
+		"2: wlan0    inet6 2001:db8::5/64 scope global dynamic\\       valid_lft 3000sec\n" +
+		"3: eth0    inet 10.0.0.2/24 brd 10.0.0.255 scope global eth0\\       valid_lft forever preferred_lft forever\n" +
+		"3: eth0    inet6 2001:db8:1::2/64 scope global\\       valid_lft forever\n"
+	got := parseAddrs(out)
+	// The DHCP and SLAAC addresses are their clients' to restore.
+	want := []ipAddr{
+		{Dev: "eth0", CIDR: "10.0.0.2/24"},
+		{Dev: "eth0", CIDR: "2001:db8:1::2/64"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAddrs = %+v, want %+v", got, want)
+	}
+
+	// Only the static address that went away is added back.
+	if got := missingAddrs(want, want[1:]); !reflect.DeepEqual(got, want[:1]) {
+		t.Errorf("missingAddrs = %+v, want %+v", got, want[:1])
+	}
+}
+
+func TestRestoreAddrThroughHelper(t *testing.T) {
+	// The network helper must take the op for a host interface, which
+	// its addr-add refuses as not a TAP device.
+	op := restoreAddrOp(ipAddr{Dev: "eth0", CIDR: "10.0.0.2/24"})
+	cmd, err := nethelper.FromOp(op)
+	if err != nil {
+		t.Fatalf("FromOp(%s): %v", op, err)
+	}
+	if cmd.Name != "addr-replace" || !reflect.DeepEqual(cmd.Args, []string{"10.0.0.2/24", "eth0"}) {
+		t.Errorf("FromOp(%s) = %+v, want addr-replace", op, cmd)
+	}
+}
+
+func TestDefaultGateway(t *testing.T) {
+	routes := [][]string{
+		{"default", "via", "10.10.10.1", "dev", "torvm0", "proto", "122", "metric", "50"},
+		{"default", "via", "192.168.1.1", "dev", "wlan0", "proto", "dhcp", "metric", "600"},
+	}
+	if gw, dev := defaultGateway(routes, "torvm0"); gw != "192.168.1.1" || dev != "wlan0" {
+		t.Errorf("defaultGateway = %q, %q; want 192.168.1.1, wlan0", gw, dev)
+	}
+	ppp := [][]string{{"default", "dev", "ppp0", "scope", "link"}}
+	if gw, dev := defaultGateway(ppp, "torvm0"); gw != "" || dev != "ppp0" {
+		t.Errorf("defaultGateway(ppp) = %q, %q; want \"\", ppp0", gw, dev)
+	}
+	if _, dev := defaultGateway(routes[:1], "torvm0"); dev != "" {
+		t.Errorf("defaultGateway returned excluded device %q", dev)
+	}
+}
@@ -0,0 +1,36 @@
+package network
+
+import (
+	"net"
+	"strings"
+)
+
+// linkLocalNet is the IPv4 link-local range (169.254.0.0/16).
+var linkLocalNet = &net.IPNet{IP: net.IPv4(169, 254, 0, 0).To4(), Mask: net.CIDRMask(16, 32)}
+
+// isLinkLocal reports whether n lies within 169.254.0.0/16. Link-local
+// destinations are reached on-link rather than through a gateway.
+func isLinkLocal(n *net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	return ones >= 16 && linkLocalNet.Contains(n.IP)
+}
+
+// parseRoutePrintDefaults parses Windows "route print -4 0.0.0.0" output
+// into the gateways of the active default routes, skipping on-link entries
+// and any route through exclude (the VM).
+func parseRoutePrintDefaults(out, exclude string) []string {
+	var gws []string
+	for _, line := range strings.Split(out, "\n") {
+		// Format: "          0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.50     25"
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		gw := fields[2]
+		if net.ParseIP(gw) == nil || gw == exclude {
+			continue
+		}
+		gws = append(gws, gw)
+	}
+	return gws
+}
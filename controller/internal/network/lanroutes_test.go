@@ -0,0 +1,37 @@
+package network
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseRoutePrintDefaults(t *testing.T) {
+	out := "IPv4 Route Table\r\n" +
+		"===========================================================================\r\n" +
+		"Active Routes:\r\n" +
+		"Network Destination        Netmask          Gateway       Interface  Metric\r\n" +
+		"          0.0.0.0          0.0.0.0       10.10.10.1      10.10.10.2      2\r\n" +
+		"          0.0.0.0          0.0.0.0      192.168.1.1    192.168.1.50     25\r\n" +
+		"===========================================================================\r\n" +
+		"Persistent Routes:\r\n" +
+		"  None\r\n"
+	got := parseRoutePrintDefaults(out, "10.10.10.1")
+	if want := []string{"192.168.1.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseRoutePrintDefaults = %q, want %q", got, want)
+	}
+}
+
+func TestIsLinkLocal(t *testing.T) {
+	for cidr, want := range map[string]bool{
+		"169.254.0.0/16": true,
+		"169.254.1.0/24": true,
+		"169.0.0.0/8":    false,
+		"192.168.0.0/16": false,
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		if got := isLinkLocal(n); got != want {
+			t.Errorf("isLinkLocal(%s) = %v, want %v", cidr, got, want)
+		}
+	}
+}
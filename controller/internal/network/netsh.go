@@ -0,0 +1,216 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+// The Windows network configuration is saved with "netsh interface ip
+// dump" and restored with "netsh exec". The dump is kept byte for byte
+// so netsh reads back exactly what it wrote; it is only decoded to check
+// it before the restore.
+//
+// netsh writes the dump in the OEM code page of the Windows locale (850
+// on German or French systems, 866 on Russian, 932 on Japanese). Its
+// commands and keywords are English in every locale: only the comments
+// and the interface names ("LAN-Verbindung", "Подключение по локальной
+// сети") are localized. validateNetshDump therefore skips comments and
+// checks the commands and the shape of their arguments, never the
+// values.
+
+// oemCodePages maps the Windows OEM and ANSI code pages a netsh dump may
+// be written in to their decoders.
+var oemCodePages = map[uint32]encoding.Encoding{
+	437:  charmap.CodePage437,
+	850:  charmap.CodePage850,
+	852:  charmap.CodePage852,
+	855:  charmap.CodePage855,
+	858:  charmap.CodePage858,
+	860:  charmap.CodePage860,
+	862:  charmap.CodePage862,
+	863:  charmap.CodePage863,
+	865:  charmap.CodePage865,
+	866:  charmap.CodePage866,
+	874:  charmap.Windows874,
+	932:  japanese.ShiftJIS,
+	936:  simplifiedchinese.GBK,
+	949:  korean.EUCKR,
+	950:  traditionalchinese.Big5,
+	1250: charmap.Windows1250,
+	1251: charmap.Windows1251,
+	1252: charmap.Windows1252,
+	1253: charmap.Windows1253,
+	1254: charmap.Windows1254,
+	1255: charmap.Windows1255,
+	1256: charmap.Windows1256,
+	1257: charmap.Windows1257,
+	1258: charmap.Windows1258,
+}
+
+// decodeNetshDump converts a netsh dump written in codePage to UTF-8. A
+// byte order mark overrides codePage, and code page 65001 is UTF-8.
+func decodeNetshDump(data []byte, codePage uint32) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		out, err := textunicode.UTF16(textunicode.LittleEndian, textunicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return "", fmt.Errorf("decode UTF-16 netsh dump: %w", err)
+		}
+		return string(out), nil
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		data = data[3:]
+		codePage = 65001
+	}
+	if enc, ok := oemCodePages[codePage]; ok {
+		out, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			return "", fmt.Errorf("decode netsh dump from code page %d: %w", codePage, err)
+		}
+		return string(out), nil
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("netsh dump is not valid UTF-8 and code page %d is not supported", codePage)
+	}
+	return string(data), nil
+}
+
+// netshContexts are the contexts a dump may enter with pushd.
+var netshContexts = map[string]bool{
+	"interface":             true,
+	"interface ip":          true,
+	"interface ipv4":        true,
+	"interface ipv6":        true,
+	"interface httpstunnel": true,
+	"interface isatap":      true,
+	"interface 6to4":        true,
+	"interface teredo":      true,
+	"interface portproxy":   true,
+	"interface tcp":         true,
+}
+
+// netshObjects are the objects a dump may set or add, per verb.
+var netshObjects = map[string]map[string]bool{
+	"set": {
+		"address": true, "dns": true, "dnsservers": true, "wins": true, "winsservers": true,
+		"interface": true, "subinterface": true, "global": true, "route": true,
+		"state": true, "client": true, "relay": true, "privacy": true, "teredo": true,
+		"compartment": true, "dynamicportrange": true,
+	},
+	"add": {
+		"address": true, "dns": true, "dnsservers": true, "wins": true, "winsservers": true,
+		"route": true, "neighbors": true, "v4tov4": true, "v4tov6": true, "v6tov4": true, "v6tov6": true,
+	},
+}
+
+// validateNetshDump checks a decoded netsh dump before "netsh exec" runs
+// it, so a tampered or foreign file cannot run other netsh commands
+// (exec, firewall or wlan contexts). Every line must be empty, a comment,
+// pushd into an interface context, popd, reset, or a set or add of a
+// network object whose arguments are words or key=value pairs.
+func validateNetshDump(text string) error {
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := validateNetshLine(line); err != nil {
+			return fmt.Errorf("netsh dump line %d: %w: %q", i+1, err, line)
+		}
+	}
+	return nil
+}
+
+func validateNetshLine(line string) error {
+	words, err := netshFields(line)
+	if err != nil {
+		return err
+	}
+	verb := strings.ToLower(words[0])
+	args := words[1:]
+	switch verb {
+	case "rem":
+		return nil
+	case "popd":
+		args = nil
+	case "pushd":
+		ctx := strings.ToLower(strings.Join(args, " "))
+		if !netshContexts[ctx] {
+			return fmt.Errorf("context %q not allowed", ctx)
+		}
+		return nil
+	case "reset":
+	case "set", "add":
+		if len(args) == 0 || !netshObjects[verb][strings.ToLower(args[0])] {
+			return fmt.Errorf("command not allowed")
+		}
+		args = args[1:]
+	default:
+		return fmt.Errorf("command %q not allowed", verb)
+	}
+	for _, a := range args {
+		// Values are not checked: they may be localized names.
+		if key, _, ok := strings.Cut(a, "="); ok {
+			a = key
+		} else if strings.HasPrefix(a, `"`) {
+			continue
+		}
+		if !netshKeyword(a) {
+			return fmt.Errorf("unexpected argument %q", a)
+		}
+	}
+	return nil
+}
+
+// netshKeyword reports whether s looks like a netsh keyword or an
+// unquoted value such as an address: ASCII letters, digits and . : / - _.
+func netshKeyword(s string) bool {
+	return s != "" && !strings.ContainsFunc(s, func(r rune) bool {
+		return r >= utf8.RuneSelf || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(".:/-_", r))
+	})
+}
+
+// netshFields splits a netsh command line into words. Double quotes group
+// a value with spaces (an interface name) and are kept in the word; the
+// value may hold any printable characters.
+func netshFields(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord, quoted := false, false
+	for _, r := range line {
+		switch {
+		case unicode.IsControl(r) && r != '\t':
+			return nil, fmt.Errorf("control character %U", r)
+		case r == '"':
+			quoted = !quoted
+			cur.WriteRune(r)
+			inWord = true
+		case !quoted && unicode.IsSpace(r):
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
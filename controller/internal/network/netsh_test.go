@@ -0,0 +1,79 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The fixtures are "netsh interface ip dump" output as written on Windows
+// in each locale, in its OEM code page: dump_<locale>.<code page>.txt.
+func TestNetshDumpFixtures(t *testing.T) {
+	names := map[string]string{
+		"en-US": "Ethernet",
+		"de-DE": "LAN-Verbindung",
+		"fr-FR": "Connexion au réseau local",
+		"ru-RU": "Подключение по локальной сети",
+		"ja-JP": "ローカル エリア接続",
+		"zh-CN": "本地连接",
+	}
+	files, _ := filepath.Glob("testdata/netsh/dump_*.txt")
+	if len(files) != len(names) {
+		t.Fatalf("found %d fixtures, want %d", len(files), len(names))
+	}
+	for _, file := range files {
+		locale, cp, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "dump_"), ".txt"), ".")
+		t.Run(locale, func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			codePage, _ := strconv.Atoi(cp)
+			text, err := decodeNetshDump(data, uint32(codePage))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `interface="` + names[locale] + `"`; !strings.Contains(text, want) {
+				t.Errorf("decoded dump lacks %s", want)
+			}
+			if err := validateNetshDump(text); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestDecodeNetshDump(t *testing.T) {
+	utf16 := []byte{0xff, 0xfe, 'p', 0, 'o', 0, 'p', 0, 'd', 0}
+	if s, err := decodeNetshDump(utf16, 850); err != nil || s != "popd" {
+		t.Errorf("UTF-16 with BOM: %q, %v", s, err)
+	}
+	if s, err := decodeNetshDump([]byte("\xef\xbb\xbfpopd é"), 850); err != nil || s != "popd é" {
+		t.Errorf("UTF-8 with BOM: %q, %v", s, err)
+	}
+	if s, err := decodeNetshDump([]byte("popd é"), 65001); err != nil || s != "popd é" {
+		t.Errorf("code page 65001: %q, %v", s, err)
+	}
+	if _, err := decodeNetshDump([]byte("popd \x82"), 12345); err == nil {
+		t.Error("invalid UTF-8 in an unknown code page was accepted")
+	}
+}
+
+func TestValidateNetshDumpRejects(t *testing.T) {
+	for _, line := range []string{
+		`exec C:\Users\Public\evil.txt`,
+		`pushd advfirewall`,
+		`pushd wlan`,
+		`delete address name="Ethernet" address=192.168.1.10`,
+		`set address name="Ethernet`,
+		`add helper evil.dll`,
+		`set address name="Ethernet" source=static & calc`,
+		"set address name=\"Ethernet\"\x1b[2J",
+	} {
+		if err := validateNetshDump("pushd interface ipv4\r\n" + line + "\r\npopd\r\n"); err == nil {
+			t.Errorf("accepted %q", line)
+		}
+	}
+}
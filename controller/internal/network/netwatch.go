@@ -0,0 +1,44 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// HostFingerprint summarizes the state of the host's interfaces (name,
+// up flag, and IPv4 addresses), excluding loopback and the named TAP
+// adapter. It changes when an interface goes up or down or its addresses
+// change, as on a Wi-Fi reconnect or a DHCP renew that assigns a new
+// lease. IPv6 addresses are left out: temporary ones rotate on their own.
+func HostFingerprint(excludeIface string) (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("list interfaces: %w", err)
+	}
+	var lines []string
+	for _, iface := range ifaces {
+		if iface.Name == excludeIface || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		line := iface.Name
+		if iface.Flags&net.FlagUp != 0 {
+			line += " up"
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		var as []string
+		for _, a := range addrs {
+			if ipn, ok := a.(*net.IPNet); ok && ipn.IP.To4() != nil {
+				as = append(as, ipn.String())
+			}
+		}
+		sort.Strings(as)
+		lines = append(lines, line+" "+strings.Join(as, ","))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
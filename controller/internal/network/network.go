@@ -5,15 +5,17 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
-	"os/exec"
+	"runtime"
+	"slices"
 )
 
 // Manager provides platform-specific network configuration.
 type Manager interface {
-	// CreateTAP creates and configures a TAP adapter.
-	CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask) error
+	// CreateTAP creates and configures a TAP adapter with the given MTU.
+	CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask, mtu int) error
 
 	// DestroyTAP removes a TAP adapter.
 	DestroyTAP(name string) error
@@ -25,14 +27,165 @@ type Manager interface {
 	// RestoreConfig restores a previously saved network configuration.
 	RestoreConfig(cfg *SavedConfig) error
 
-	// SetupRouting configures routes so traffic flows through the VM.
-	SetupRouting(tapName string, vmIP net.IP) error
+	// SetupRouting configures routes (and, where the platform needs it,
+	// the resolver) so traffic flows through the VM.
+	SetupRouting(tapName string, opts RoutingOptions) error
 
 	// TeardownRouting removes routes added by SetupRouting.
 	TeardownRouting() error
 
+	// SetupIPv6 applies the IPv6 policy: either routes all global IPv6
+	// through the VM over a ULA link, or blackholes it so it cannot leak
+	// around the VM.
+	SetupIPv6(tapName string, opts IPv6Options) error
+
+	// TeardownIPv6 removes routes added by SetupIPv6.
+	TeardownIPv6() error
+
+	// SetupLANRoutes routes the given local ranges through the host's
+	// original default gateway rather than the VM, so local devices stay
+	// reachable. The routes are more specific than the VM default route.
+	SetupLANRoutes(tapName string, vmIP net.IP, ranges []*net.IPNet) error
+
+	// TeardownLANRoutes removes routes added by SetupLANRoutes.
+	TeardownLANRoutes() error
+
 	// FlushDNS clears the system DNS cache.
 	FlushDNS() error
+
+	// BlockTraffic atomically installs a host firewall ruleset that drops
+	// all traffic except loopback, the TAP subnet, and opts.LAN, so a dead
+	// VM leaves the host offline instead of falling back to the original
+	// default route. Returns ErrBlockUnsupported where no firewall backend
+	// is implemented.
+	BlockTraffic(opts BlockOptions) error
+
+	// UnblockTraffic removes the ruleset installed by BlockTraffic. It is
+	// a no-op if none is installed.
+	UnblockTraffic() error
+
+	// BlockDNSLeaks installs firewall rules that drop outbound DNS and
+	// DNS over TLS to anything but the VM, so applications with
+	// hardcoded resolvers cannot get around Tor's DNSPort (e.g. over a
+	// LAN route). The rules are separate from the failsafe ones.
+	BlockDNSLeaks(opts DNSBlockOptions) error
+
+	// UnblockDNSLeaks removes the rules installed by BlockDNSLeaks. It is
+	// a no-op if none are installed.
+	UnblockDNSLeaks() error
+
+	// RouteSharedClients sends the traffic of devices using the host's
+	// shared connection through the VM, and drops it if it would go
+	// anywhere else. Returns ErrSharingUnsupported where the platform's
+	// sharing service cannot be redirected.
+	RouteSharedClients(opts SharingOptions) error
+
+	// UnrouteSharedClients removes what RouteSharedClients installed. It
+	// is a no-op if nothing is installed.
+	UnrouteSharedClients() error
+
+	// PurgeArtifacts removes host artifacts (TAP configuration, routes,
+	// firewall rules) left behind by a previous session of this instance,
+	// returning a description of each item removed.
+	PurgeArtifacts(opts PurgeOptions) ([]string, error)
+}
+
+// PurgeOptions configures PurgeArtifacts.
+type PurgeOptions struct {
+	TAPName string
+	VMIP    net.IP
+
+	// KeepFirewall leaves failsafe and kill switch rules in place, for
+	// crash recovery while the kill switch is enabled.
+	KeepFirewall bool
+
+	// KeepTAP leaves the TAP device and its addresses in place, for a
+	// VM that is still attached to it.
+	KeepTAP bool
+}
+
+// ErrBlockUnsupported is returned by BlockTraffic on platforms without a
+// firewall-based failsafe.
+var ErrBlockUnsupported = errors.New("traffic blocking not supported on this platform")
+
+// BlockOptions configures BlockTraffic.
+type BlockOptions struct {
+	TAPName string
+	Subnet  *net.IPNet   // TAP link subnet; nil allows loopback only
+	LAN     []*net.IPNet // ranges that bypass Tor anyway (lan.allow)
+
+	// KillSwitch also passes everything on the TAP link, traffic the VM
+	// sends out through the host, and DHCP on other links, so the
+	// ruleset can stay installed while the VM is up. Nothing else gets
+	// out, even if the controller dies.
+	KillSwitch bool
+}
+
+// RoutingOptions configures SetupRouting.
+type RoutingOptions struct {
+	VMIP net.IP
+	// DNS lists resolvers to set on the TAP adapter where the platform
+	// configures per-adapter DNS (Windows). The VM redirects port 53 to
+	// Tor's DNSPort, so any address routed through it works, including
+	// the VM's own. Empty means use VMIP.
+	DNS []net.IP
+	// Strategy is how the host's IPv4 traffic is claimed for the VM, one
+	// of the Route constants; empty means the platform's default.
+	Strategy string
+	// Metric is the metric of the routes through the VM; 0 means the
+	// platform's default. macOS has no route metrics and ignores it.
+	Metric int
+}
+
+// Default route strategies accepted by SetupRouting. A DHCP client may
+// install a default route with a lower metric than ours, which then wins
+// silently; RouteReplace and RouteSplit do not depend on metrics.
+const (
+	RouteMetric  = "metric"  // add a default route through the VM (Linux and Windows default)
+	RouteReplace = "replace" // also remove the host's other default routes until teardown
+	RouteSplit   = "split"   // route 0.0.0.0/1 and 128.0.0.0/1 through the VM (macOS default)
+)
+
+// IPv6 handling modes accepted by SetupIPv6.
+const (
+	IPv6Block = "block" // blackhole global IPv6 while the VM routes traffic
+	IPv6Route = "route" // route global IPv6 through the VM
+	IPv6Off   = "off"   // leave host IPv6 untouched (traffic bypasses Tor)
+)
+
+// IPv6Options configures SetupIPv6.
+type IPv6Options struct {
+	Mode      string
+	HostIP    net.IP // host end of the ULA link (route mode only)
+	VMIP      net.IP // VM end of the ULA link (route mode only)
+	PrefixLen int
+}
+
+// ipv4SplitRoutes together cover all of IPv4 while being more specific
+// than 0.0.0.0/0, so they win over any default route whatever its metric.
+var ipv4SplitRoutes = []string{"0.0.0.0/1", "128.0.0.0/1"}
+
+// RouteDestinations returns the IPv4 destinations SetupRouting routes
+// through the VM with strategy on this platform.
+func RouteDestinations(strategy string) []string {
+	if strategy == RouteSplit || (strategy == "" && runtime.GOOS == "darwin") {
+		return slices.Clone(ipv4SplitRoutes)
+	}
+	return []string{"0.0.0.0/0"}
+}
+
+// ipv6SplitRoutes together cover all of IPv6 while being more specific
+// than ::/0, mirroring the IPv4 0.0.0.0/1 + 128.0.0.0/1 split.
+var ipv6SplitRoutes = []string{"::/1", "8000::/1"}
+
+// LabelPrefix starts every label attached to host artifacts created by
+// the controller, so stragglers can be found after a crash.
+const LabelPrefix = "torvm:"
+
+// InstanceLabel returns the label used to tag host artifacts created for
+// the named controller instance, e.g. "torvm:default".
+func InstanceLabel(instance string) string {
+	return LabelPrefix + instance
 }
 
 // SavedConfig holds opaque platform-specific network state.
@@ -42,14 +195,6 @@ type SavedConfig struct {
 	HMAC     string // Hex-encoded HMAC for integrity verification.
 }
 
-func run(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("%s %v: %s: %w", name, args, string(out), err)
-	}
-	return nil
-}
-
 // newSessionKey generates a 32-byte random key for HMAC integrity verification
 // of saved network configs. Returns nil if random bytes are unavailable.
 func newSessionKey() []byte {
@@ -3,26 +3,74 @@
 package network
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"os/exec"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/privexec"
 )
 
 type darwinManager struct {
-	sessionKey []byte
+	key   []byte // HMAC key for SavedConfig, persisted in the state dir
+	label string
+
+	// services lists the network services whose DNS servers were captured
+	// by SaveConfig and are overridden by SetupRouting.
+	services []string
+
+	lanRoutes  []string // destinations added by SetupLANRoutes
+	pfToken    string   // pf enable reference from BlockTraffic
+	dnsPFToken string   // pf enable reference from BlockDNSLeaks
+
+	// replaced records that SetupRouting pointed the default route at the
+	// VM (RouteReplace), and replacedGW is the gateway it had before.
+	replaced   bool
+	replacedGW string
+}
+
+// darwinSavedState is the JSON payload stored in SavedConfig.Data on macOS.
+type darwinSavedState struct {
+	Routes string              `json:"routes"`
+	DNS    map[string][]string `json:"dns"` // service name -> manual DNS servers (empty = DHCP)
+}
+
+// DefaultStateDir is where the controller keeps network state that must
+// survive a crash (see SessionStore).
+func DefaultStateDir() string {
+	return "/var/db/torvm"
+}
+
+// TAPPresent always reports true: QEMU's vmnet backend creates and owns
+// the VM's interface, so there is no host TAP device to lose.
+func TAPPresent(name string) bool {
+	return true
 }
 
-// NewManager returns a macOS network manager.
-func NewManager() Manager {
+// CheckTAPSupport always succeeds: QEMU's vmnet backend needs no TAP
+// driver.
+func CheckTAPSupport(name string) error {
+	return nil
+}
+
+// NewManager returns a macOS network manager. macOS routes and resolver
+// settings cannot carry labels, so PurgeArtifacts matches stragglers by
+// the VM gateway address instead. Saved configurations are authenticated
+// with a key kept in stateDir.
+func NewManager(label, stateDir string) Manager {
 	return &darwinManager{
-		sessionKey: newSessionKey(),
+		key:   managerKey(stateDir),
+		label: label,
 	}
 }
 
-func (m *darwinManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask) error {
+func (m *darwinManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask, mtu int) error {
 	// On macOS, QEMU uses vmnet-shared for networking. The TAP device
 	// is managed by QEMU itself via the Virtualization.framework.
-	// We only need to ensure the host-side routing is configured.
+	// We only need to ensure the host-side routing is configured. The
+	// MTU is applied inside the guest; TCP through the VM then picks up
+	// the smaller MSS.
 	return nil
 }
 
@@ -36,10 +84,35 @@ func (m *darwinManager) SaveConfig() (*SavedConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("save routes: %w", err)
 	}
+
+	// Capture the manual DNS servers of every enabled network service so
+	// they can be put back after SetupRouting points them at the VM.
+	svcOut, err := exec.Command("networksetup", "-listallnetworkservices").Output()
+	if err != nil {
+		return nil, fmt.Errorf("list network services: %w", err)
+	}
+	state := darwinSavedState{
+		Routes: string(out),
+		DNS:    make(map[string][]string),
+	}
+	services := parseNetworkServices(string(svcOut))
+	for _, svc := range services {
+		dnsOut, err := exec.Command("networksetup", "-getdnsservers", svc).Output()
+		if err != nil {
+			return nil, fmt.Errorf("get dns servers for %q: %w", svc, err)
+		}
+		state.DNS[svc] = parseDNSServers(string(dnsOut))
+	}
+	m.services = services
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("encode saved network state: %w", err)
+	}
 	return &SavedConfig{
-		Data:     out,
+		Data:     data,
 		Platform: "darwin",
-		HMAC:     computeHMAC(m.sessionKey, out),
+		HMAC:     computeHMAC(m.key, data),
 	}, nil
 }
 
@@ -47,32 +120,389 @@ func (m *darwinManager) RestoreConfig(cfg *SavedConfig) error {
 	if cfg == nil || cfg.Platform != "darwin" {
 		return fmt.Errorf("invalid saved config for darwin")
 	}
-	if err := verifyHMAC(m.sessionKey, cfg.Data, cfg.HMAC); err != nil {
+	if err := verifyHMAC(m.key, cfg.Data, cfg.HMAC); err != nil {
 		return fmt.Errorf("saved config integrity check failed: %w", err)
 	}
-	// Route restoration is handled by TeardownRouting.
+	var state darwinSavedState
+	if err := json.Unmarshal(cfg.Data, &state); err != nil {
+		return fmt.Errorf("decode saved network state: %w", err)
+	}
+
+	// Route restoration is handled by TeardownRouting. Put each service's
+	// resolver configuration back; "Empty" reverts to DHCP-provided DNS.
+	var failed []string
+	for svc, servers := range state.DNS {
+		args := []string{"-setdnsservers", svc}
+		if len(servers) == 0 {
+			args = append(args, "Empty")
+		} else {
+			args = append(args, servers...)
+		}
+		if err := privexec.Run("networksetup", args...); err != nil {
+			failed = append(failed, svc)
+		}
+	}
+	m.services = nil
+	if len(failed) > 0 {
+		return fmt.Errorf("restore dns servers for %s", strings.Join(failed, ", "))
+	}
 	return nil
 }
 
-func (m *darwinManager) SetupRouting(tapName string, vmIP net.IP) error {
-	if err := run("route", "-n", "add", "-net", "0.0.0.0/1", vmIP.String()); err != nil {
-		return fmt.Errorf("add route 0.0.0.0/1: %w", err)
+func (m *darwinManager) SetupRouting(tapName string, opts RoutingOptions) error {
+	vmIP := opts.VMIP
+	switch opts.Strategy {
+	case "", RouteSplit:
+		for _, dst := range ipv4SplitRoutes {
+			if err := privexec.Run("route", "-n", "add", "-net", dst, vmIP.String()); err != nil {
+				return fmt.Errorf("add route %s: %w", dst, err)
+			}
+		}
+	case RouteReplace:
+		if err := m.replaceDefaultRoute(vmIP); err != nil {
+			return err
+		}
+	case RouteMetric:
+		return fmt.Errorf("route strategy %q is not supported on macOS, which has no route metrics", opts.Strategy)
+	default:
+		return fmt.Errorf("unknown route strategy %q", opts.Strategy)
 	}
-	if err := run("route", "-n", "add", "-net", "128.0.0.0/1", vmIP.String()); err != nil {
-		return fmt.Errorf("add route 128.0.0.0/1: %w", err)
+
+	// The split routes alone leave the system resolver pointing at the
+	// DHCP-provided DNS servers. Override every saved network service so
+	// lookups go to the VM, which redirects port 53 to Tor's DNSPort.
+	// opts.DNS is not used: vmnet has no adapter-level resolver.
+	for _, svc := range m.services {
+		if err := privexec.Run("networksetup", "-setdnsservers", svc, vmIP.String()); err != nil {
+			return fmt.Errorf("override dns for %q: %w", svc, err)
+		}
 	}
 	return nil
 }
 
+func (m *darwinManager) SetupIPv6(tapName string, opts IPv6Options) error {
+	switch opts.Mode {
+	case IPv6Route:
+		// vmnet-shared owns the host side of the link and offers no way
+		// to assign our ULA address to it.
+		return fmt.Errorf("ipv6 route mode is not supported with vmnet-shared; use %q", IPv6Block)
+	case IPv6Block:
+		for _, dst := range ipv6SplitRoutes {
+			if err := privexec.Run("route", "-n", "add", "-inet6", "-net", dst, "::1", "-reject"); err != nil {
+				return fmt.Errorf("add ipv6 reject route %s: %w", dst, err)
+			}
+		}
+	case IPv6Off:
+	default:
+		return fmt.Errorf("unknown ipv6 mode %q", opts.Mode)
+	}
+	return nil
+}
+
+func (m *darwinManager) TeardownIPv6() error {
+	for _, dst := range ipv6SplitRoutes {
+		_ = privexec.Run("route", "-n", "delete", "-inet6", "-net", dst)
+	}
+	return nil
+}
+
+func (m *darwinManager) SetupLANRoutes(tapName string, vmIP net.IP, ranges []*net.IPNet) error {
+	// The split routes leave the physical default route in place, so it
+	// still names the original gateway.
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return fmt.Errorf("get default route: %w", err)
+	}
+	gw, iface := parseRouteGet(string(out))
+	if gw == "" || gw == vmIP.String() {
+		return fmt.Errorf("no default gateway outside the VM for LAN routes")
+	}
+	for _, n := range ranges {
+		args := []string{"-n", "add", "-net", n.String()}
+		if isLinkLocal(n) && iface != "" {
+			args = append(args, "-interface", iface)
+		} else {
+			args = append(args, gw)
+		}
+		if err := privexec.Run("route", args...); err != nil {
+			return fmt.Errorf("add LAN route %s: %w", n, err)
+		}
+		m.lanRoutes = append(m.lanRoutes, n.String())
+	}
+	return nil
+}
+
+func (m *darwinManager) TeardownLANRoutes() error {
+	for _, dst := range m.lanRoutes {
+		_ = privexec.Run("route", "-n", "delete", "-net", dst)
+	}
+	m.lanRoutes = nil
+	return nil
+}
+
+// replaceDefaultRoute points the default route at the VM for
+// RouteReplace, keeping the gateway it had for TeardownRouting.
+func (m *darwinManager) replaceDefaultRoute(vmIP net.IP) error {
+	m.replacedGW = ""
+	if out, err := exec.Command("route", "-n", "get", "default").Output(); err == nil {
+		m.replacedGW, _ = parseRouteGet(string(out))
+	}
+	verb := "change"
+	if m.replacedGW == "" {
+		verb = "add"
+	}
+	if err := privexec.Run("route", "-n", verb, "default", vmIP.String()); err != nil {
+		return fmt.Errorf("%s default route: %w", verb, err)
+	}
+	m.replaced = true
+	return nil
+}
+
 func (m *darwinManager) TeardownRouting() error {
-	_ = run("route", "-n", "delete", "-net", "0.0.0.0/1")
-	_ = run("route", "-n", "delete", "-net", "128.0.0.0/1")
+	if !m.replaced {
+		for _, dst := range ipv4SplitRoutes {
+			_ = privexec.Run("route", "-n", "delete", "-net", dst)
+		}
+		return nil
+	}
+	m.replaced = false
+	if m.replacedGW == "" {
+		_ = privexec.Run("route", "-n", "delete", "default")
+		return nil
+	}
+	if err := privexec.Run("route", "-n", "change", "default", m.replacedGW); err != nil {
+		return fmt.Errorf("restore default route via %s: %w", m.replacedGW, err)
+	}
 	return nil
 }
 
 func (m *darwinManager) FlushDNS() error {
-	_ = run("dscacheutil", "-flushcache")
-	_ = run("killall", "-HUP", "mDNSResponder")
+	_ = privexec.Run("dscacheutil", "-flushcache")
+	_ = privexec.Run("killall", "-HUP", "mDNSResponder")
+	return nil
+}
+
+func (m *darwinManager) PurgeArtifacts(opts PurgeOptions) ([]string, error) {
+	var removed []string
+
+	// Split and default routes are only ours if they point at the VM
+	// gateway; other VPN clients install the same 0/1 + 128.0/1 pair.
+	out, err := exec.Command("netstat", "-rn", "-f", "inet").Output()
+	if err != nil {
+		return nil, fmt.Errorf("netstat -rn: %w", err)
+	}
+	vmStr := opts.VMIP.String()
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != vmStr {
+			continue
+		}
+		var dest string
+		switch fields[0] {
+		case "0/1":
+			dest = "0.0.0.0/1"
+		case "128.0/1":
+			dest = "128.0.0.0/1"
+		case "default":
+			// Pointed at the VM by RouteReplace.
+			dest = "default"
+		default:
+			continue
+		}
+		if err := privexec.Run("route", "-n", "delete", "-net", dest, vmStr); err != nil {
+			return removed, fmt.Errorf("delete route %s: %w", dest, err)
+		}
+		removed = append(removed, "route: "+dest+" via "+vmStr)
+	}
+
+	// IPv6 reject routes installed by SetupIPv6 in block mode.
+	out6, err := exec.Command("netstat", "-rn", "-f", "inet6").Output()
+	if err == nil {
+		for _, line := range strings.Split(string(out6), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[1] != "::1" || !strings.Contains(fields[2], "R") {
+				continue
+			}
+			for _, dst := range ipv6SplitRoutes {
+				if fields[0] == dst {
+					if err := privexec.Run("route", "-n", "delete", "-inet6", "-net", dst); err == nil {
+						removed = append(removed, "ipv6 reject route: "+dst)
+					}
+				}
+			}
+		}
+	}
+
+	// Resolver overrides pointing solely at the VM revert to DHCP.
+	svcOut, err := exec.Command("networksetup", "-listallnetworkservices").Output()
+	if err != nil {
+		return removed, fmt.Errorf("list network services: %w", err)
+	}
+	for _, svc := range parseNetworkServices(string(svcOut)) {
+		dnsOut, err := exec.Command("networksetup", "-getdnsservers", svc).Output()
+		if err != nil {
+			continue
+		}
+		servers := parseDNSServers(string(dnsOut))
+		if len(servers) != 1 || servers[0] != vmStr {
+			continue
+		}
+		if err := privexec.Run("networksetup", "-setdnsservers", svc, "Empty"); err != nil {
+			return removed, fmt.Errorf("reset dns for %q: %w", svc, err)
+		}
+		removed = append(removed, "dns override: "+svc)
+	}
+
+	// A failsafe anchor left by a crashed session keeps the host offline.
+	// Its pf enable reference died with the process.
+	dnsAnchor := pfAnchorParent + dnsBlockName(m.label)
+	if rules, err := exec.Command("pfctl", "-a", dnsAnchor, "-s", "rules").Output(); err == nil && len(strings.TrimSpace(string(rules))) > 0 {
+		if err := privexec.Run("pfctl", "-a", dnsAnchor, "-F", "all"); err != nil {
+			return removed, fmt.Errorf("flush pf anchor %s: %w", dnsAnchor, err)
+		}
+		removed = append(removed, "pf anchor: "+dnsAnchor)
+	}
+
+	anchor := pfAnchorParent + failsafeName(m.label)
+	if opts.KeepFirewall {
+		return removed, nil
+	}
+	if rules, err := exec.Command("pfctl", "-a", anchor, "-s", "rules").Output(); err == nil && len(strings.TrimSpace(string(rules))) > 0 {
+		if err := privexec.Run("pfctl", "-a", anchor, "-F", "all"); err != nil {
+			return removed, fmt.Errorf("flush pf anchor %s: %w", anchor, err)
+		}
+		removed = append(removed, "pf anchor: "+anchor)
+	}
+	return removed, nil
+}
+
+func (m *darwinManager) BlockTraffic(opts BlockOptions) error {
+	// Leave the split routes alone: with the VM gone they blackhole
+	// traffic, whereas removing them would expose the default route.
+	if opts.KillSwitch {
+		// vmnet creates the bridge itself; find it by its address.
+		name, err := linkWithSubnet(opts.Subnet)
+		if err != nil {
+			return fmt.Errorf("find vmnet bridge: %w", err)
+		}
+		opts.TAPName = name
+	}
+	anchor := pfAnchorParent + failsafeName(m.label)
+	load := privexec.Command("pfctl", "-a", anchor, "-f", "-")
+	load.Stdin = pfFailsafeRules(opts)
+	if out, err := privexec.Output(load); err != nil {
+		return fmt.Errorf("load pf anchor %s: %s: %w", anchor, strings.TrimSpace(out), err)
+	}
+
+	// Enable pf with a reference so UnblockTraffic only drops ours and
+	// leaves pf on if something else enabled it.
+	if m.pfToken == "" {
+		out, err := privexec.Output(privexec.Command("pfctl", "-E"))
+		if err != nil {
+			return fmt.Errorf("enable pf: %s: %w", strings.TrimSpace(out), err)
+		}
+		m.pfToken = parsePfctlToken(out)
+	}
+	return nil
+}
+
+func (m *darwinManager) BlockDNSLeaks(opts DNSBlockOptions) error {
+	anchor := pfAnchorParent + dnsBlockName(m.label)
+	load := privexec.Command("pfctl", "-a", anchor, "-f", "-")
+	load.Stdin = pfDNSBlockRules(opts)
+	if out, err := privexec.Output(load); err != nil {
+		return fmt.Errorf("load pf anchor %s: %s: %w", anchor, strings.TrimSpace(out), err)
+	}
+	if m.dnsPFToken == "" {
+		out, err := privexec.Output(privexec.Command("pfctl", "-E"))
+		if err != nil {
+			return fmt.Errorf("enable pf: %s: %w", strings.TrimSpace(out), err)
+		}
+		m.dnsPFToken = parsePfctlToken(out)
+	}
 	return nil
 }
 
+// DetectSharing returns the interfaces macOS Internet Sharing shares the
+// host's connection to.
+func DetectSharing() ([]SharedInterface, error) {
+	out, err := exec.Command("defaults", "read", "/Library/Preferences/SystemConfiguration/com.apple.nat").Output()
+	if err != nil {
+		// The preferences do not exist until sharing is first set up.
+		return nil, nil
+	}
+	enabled, devices := parseNATPlist(string(out))
+	if !enabled {
+		return nil, nil
+	}
+	if len(devices) == 0 {
+		devices = []string{"bridge100"}
+	}
+	var shared []SharedInterface
+	for _, d := range devices {
+		shared = append(shared, SharedInterface{Name: d, Kind: "Internet Sharing"})
+	}
+	return shared, nil
+}
+
+// RouteSharedClients is not supported: Internet Sharing runs its own NAT
+// to the primary interface, which pf rules would have to override.
+func (m *darwinManager) RouteSharedClients(opts SharingOptions) error {
+	return ErrSharingUnsupported
+}
+
+func (m *darwinManager) UnrouteSharedClients() error {
+	return nil
+}
+
+func (m *darwinManager) UnblockDNSLeaks() error {
+	anchor := pfAnchorParent + dnsBlockName(m.label)
+	if err := privexec.Run("pfctl", "-a", anchor, "-F", "all"); err != nil {
+		return fmt.Errorf("flush pf anchor %s: %w", anchor, err)
+	}
+	if m.dnsPFToken != "" {
+		if err := privexec.Run("pfctl", "-X", m.dnsPFToken); err != nil {
+			return fmt.Errorf("release pf reference: %w", err)
+		}
+		m.dnsPFToken = ""
+	}
+	return nil
+}
+
+func (m *darwinManager) UnblockTraffic() error {
+	anchor := pfAnchorParent + failsafeName(m.label)
+	if err := privexec.Run("pfctl", "-a", anchor, "-F", "all"); err != nil {
+		return fmt.Errorf("flush pf anchor %s: %w", anchor, err)
+	}
+	if m.pfToken != "" {
+		if err := privexec.Run("pfctl", "-X", m.pfToken); err != nil {
+			return fmt.Errorf("release pf reference: %w", err)
+		}
+		m.pfToken = ""
+	}
+	return nil
+}
+
+// linkWithSubnet returns the name of the interface with an address in
+// subnet.
+func linkWithSubnet(subnet *net.IPNet) (string, error) {
+	if subnet == nil {
+		return "", fmt.Errorf("no VM subnet")
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipn, ok := a.(*net.IPNet); ok && subnet.Contains(ipn.IP) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no interface in %s", subnet)
+}
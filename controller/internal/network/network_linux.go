@@ -3,37 +3,109 @@
 package network
 
 import (
+	"cmp"
+	"encoding/json"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/privexec"
 )
 
+const resolvConfPath = "/etc/resolv.conf"
+
+// linuxSavedState is the JSON payload stored in SavedConfig.Data on Linux.
+type linuxSavedState struct {
+	DefaultRoutes [][]string `json:"default_routes"`
+	Addrs         []ipAddr   `json:"addrs"`
+
+	// ResolvConfLink is the symlink target of /etc/resolv.conf (e.g. the
+	// systemd-resolved stub), or empty if it is a regular file.
+	ResolvConfLink string `json:"resolv_conf_link,omitempty"`
+	ResolvConf     []byte `json:"resolv_conf,omitempty"`
+}
+
 type linuxManager struct {
-	sessionKey []byte
+	key       []byte // HMAC key for SavedConfig, persisted in the state dir
+	label     string
+	proto     string   // routeProto(label), which tags the routes it installs
+	ipv6Mode  string   // mode applied by SetupIPv6, for teardown
+	lanRoutes []string // destinations added by SetupLANRoutes
+
+	// routes are the destinations SetupRouting routed through the VM with
+	// routeMetric; replaced holds the host default routes it removed, as
+	// "ip route" arguments, for TeardownRouting to put back.
+	routes      []string
+	routeMetric string
+	replaced    [][]string
+}
+
+// defaultRouteMetric is the metric of the routes through the VM unless
+// RoutingOptions.Metric sets one. Most DHCP clients install their default
+// routes with a metric of 100 or more, but some use 0, which then wins.
+const defaultRouteMetric = 50
+
+// DefaultStateDir is where the controller keeps network state that must
+// survive a crash (see SessionStore).
+func DefaultStateDir() string {
+	return "/var/lib/torvm"
 }
 
-// NewManager returns a Linux network manager.
-func NewManager() Manager {
+// TAPPresent reports whether the TAP device still exists, so the engine
+// can notice one deleted behind its back (e.g. by another tool).
+func TAPPresent(name string) bool {
+	_, err := net.InterfaceByName(name)
+	return err == nil
+}
+
+// CheckTAPSupport reports whether the kernel can create TAP devices. The
+// device itself is created at startup, so name is not checked.
+func CheckTAPSupport(name string) error {
+	if _, err := os.Stat("/dev/net/tun"); err != nil {
+		return fmt.Errorf("TUN/TAP driver not available: %w", err)
+	}
+	return nil
+}
+
+// NewManager returns a Linux network manager that tags the interfaces it
+// creates with the given label (see InstanceLabel). Saved configurations
+// are authenticated with a key kept in stateDir.
+func NewManager(label, stateDir string) Manager {
 	return &linuxManager{
-		sessionKey: newSessionKey(),
+		key:   managerKey(stateDir),
+		label: label,
+		proto: routeProto(label),
 	}
 }
 
-func (m *linuxManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask) error {
+func (m *linuxManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask, mtu int) error {
 	// Create the TAP device.
-	if err := run("ip", "tuntap", "add", "dev", name, "mode", "tap"); err != nil {
+	if err := privexec.Run("ip", "tuntap", "add", "dev", name, "mode", "tap"); err != nil {
 		return fmt.Errorf("create tap: %w", err)
 	}
 
+	// Tag the interface so PurgeArtifacts can find it after a crash.
+	if err := privexec.Run("ip", "link", "set", "dev", name, "alias", m.label); err != nil {
+		return fmt.Errorf("label tap: %w", err)
+	}
+
 	// Assign the host IP address.
 	ones, _ := mask.Size()
 	cidr := fmt.Sprintf("%s/%d", hostIP.String(), ones)
-	if err := run("ip", "addr", "add", cidr, "dev", name); err != nil {
+	if err := privexec.Run("ip", "addr", "add", cidr, "dev", name); err != nil {
 		return fmt.Errorf("set tap address: %w", err)
 	}
 
+	if err := privexec.Run("ip", "link", "set", "dev", name, "mtu", strconv.Itoa(mtu)); err != nil {
+		return fmt.Errorf("set tap mtu: %w", err)
+	}
+
 	// Bring the interface up.
-	if err := run("ip", "link", "set", name, "up"); err != nil {
+	if err := privexec.Run("ip", "link", "set", name, "up"); err != nil {
 		return fmt.Errorf("bring tap up: %w", err)
 	}
 
@@ -41,18 +113,46 @@ func (m *linuxManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMa
 }
 
 func (m *linuxManager) DestroyTAP(name string) error {
-	return run("ip", "tuntap", "del", "dev", name, "mode", "tap")
+	return privexec.Run("ip", "tuntap", "del", "dev", name, "mode", "tap")
 }
 
 func (m *linuxManager) SaveConfig() (*SavedConfig, error) {
-	out, err := exec.Command("ip", "route", "show").Output()
+	var state linuxSavedState
+
+	routes, err := exec.Command("ip", "route", "show", "default").Output()
 	if err != nil {
 		return nil, fmt.Errorf("save routes: %w", err)
 	}
+	state.DefaultRoutes = parseDefaultRoutes(string(routes))
+
+	addrs, err := exec.Command("ip", "-o", "addr", "show").Output()
+	if err != nil {
+		return nil, fmt.Errorf("save addresses: %w", err)
+	}
+	state.Addrs = parseAddrs(string(addrs))
+
+	fi, err := os.Lstat(resolvConfPath)
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return nil, fmt.Errorf("stat %s: %w", resolvConfPath, err)
+	case err == nil && fi.Mode()&os.ModeSymlink != 0:
+		if state.ResolvConfLink, err = os.Readlink(resolvConfPath); err != nil {
+			return nil, fmt.Errorf("read %s link: %w", resolvConfPath, err)
+		}
+	case err == nil:
+		if state.ResolvConf, err = os.ReadFile(resolvConfPath); err != nil {
+			return nil, fmt.Errorf("read %s: %w", resolvConfPath, err)
+		}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, fmt.Errorf("encode saved network state: %w", err)
+	}
 	return &SavedConfig{
-		Data:     out,
+		Data:     data,
 		Platform: "linux",
-		HMAC:     computeHMAC(m.sessionKey, out),
+		HMAC:     computeHMAC(m.key, data),
 	}, nil
 }
 
@@ -60,32 +160,417 @@ func (m *linuxManager) RestoreConfig(cfg *SavedConfig) error {
 	if cfg == nil || cfg.Platform != "linux" {
 		return fmt.Errorf("invalid saved config for linux")
 	}
-	if err := verifyHMAC(m.sessionKey, cfg.Data, cfg.HMAC); err != nil {
+	if err := verifyHMAC(m.key, cfg.Data, cfg.HMAC); err != nil {
 		return fmt.Errorf("saved config integrity check failed: %w", err)
 	}
-	// Route restoration is handled by TeardownRouting, which removes
-	// the specific routes we added. The kernel restores defaults
-	// when the TAP device is removed.
+	var state linuxSavedState
+	if err := json.Unmarshal(cfg.Data, &state); err != nil {
+		return fmt.Errorf("decode saved network state: %w", err)
+	}
+
+	var errs []string
+
+	// Re-add static interface addresses that disappeared during the
+	// session. Those still present are left alone, so their lifetimes
+	// and flags stay as they are.
+	out, err := exec.Command("ip", "-o", "addr", "show").Output()
+	if err != nil {
+		return fmt.Errorf("list addresses: %w", err)
+	}
+	for _, a := range missingAddrs(state.Addrs, parseAddrs(string(out))) {
+		if _, err := net.InterfaceByName(a.Dev); err != nil {
+			continue // interface no longer exists (e.g. unplugged USB NIC)
+		}
+		if err := privexec.RunOp(restoreAddrOp(a)); err != nil {
+			errs = append(errs, fmt.Sprintf("address %s on %s: %v", a.CIDR, a.Dev, err))
+		}
+	}
+
+	// Replay the original default routes. TeardownRouting has already
+	// removed ours; this restores any route that another tool (or a
+	// crash mid-session) deleted.
+	for _, r := range state.DefaultRoutes {
+		args := append([]string{"route", "replace"}, r...)
+		if err := privexec.Run("ip", args...); err != nil {
+			errs = append(errs, fmt.Sprintf("route %q: %v", strings.Join(r, " "), err))
+		}
+	}
+
+	if err := restoreResolvConf(state); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("restore network: %s", strings.Join(errs, "; "))
+	}
 	return nil
 }
 
-func (m *linuxManager) SetupRouting(tapName string, vmIP net.IP) error {
-	// Add a default route through the VM.
-	if err := run("ip", "route", "add", "default", "via", vmIP.String(), "dev", tapName, "metric", "50"); err != nil {
-		return fmt.Errorf("add default route: %w", err)
+// restoreResolvConf puts /etc/resolv.conf back to its saved contents or
+// symlink target if it was changed during the session.
+func restoreResolvConf(state linuxSavedState) error {
+	if state.ResolvConfLink != "" {
+		if cur, err := os.Readlink(resolvConfPath); err == nil && cur == state.ResolvConfLink {
+			return nil
+		}
+		tmp := resolvConfPath + ".torvm"
+		os.Remove(tmp)
+		if err := os.Symlink(state.ResolvConfLink, tmp); err != nil {
+			return fmt.Errorf("restore %s link: %w", resolvConfPath, err)
+		}
+		if err := os.Rename(tmp, resolvConfPath); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("restore %s link: %w", resolvConfPath, err)
+		}
+		return nil
+	}
+	if state.ResolvConf == nil {
+		return nil
+	}
+	if cur, err := os.ReadFile(resolvConfPath); err == nil && string(cur) == string(state.ResolvConf) {
+		return nil
+	}
+	// Write via a temp file in the same directory so the swap is atomic.
+	tmp, err := os.CreateTemp(filepath.Dir(resolvConfPath), ".resolv.conf.torvm-*")
+	if err != nil {
+		return fmt.Errorf("restore %s: %w", resolvConfPath, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(state.ResolvConf); err != nil {
+		tmp.Close()
+		return fmt.Errorf("restore %s: %w", resolvConfPath, err)
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("restore %s: %w", resolvConfPath, err)
+	}
+	if err := os.Rename(tmp.Name(), resolvConfPath); err != nil {
+		return fmt.Errorf("restore %s: %w", resolvConfPath, err)
+	}
+	return nil
+}
+
+func (m *linuxManager) SetupRouting(tapName string, opts RoutingOptions) error {
+	dsts := []string{"default"}
+	switch opts.Strategy {
+	case "", RouteMetric:
+	case RouteReplace:
+		// Removed first: a host route with the same metric would make
+		// ours a duplicate.
+		if err := m.removeDefaultRoutes(); err != nil {
+			return err
+		}
+	case RouteSplit:
+		dsts = ipv4SplitRoutes
+	default:
+		return fmt.Errorf("unknown route strategy %q", opts.Strategy)
+	}
+	m.routeMetric = strconv.Itoa(cmp.Or(opts.Metric, defaultRouteMetric))
+	for _, dst := range dsts {
+		if err := privexec.Run("ip", "route", "add", dst, "via", opts.VMIP.String(), "dev", tapName,
+			"metric", m.routeMetric, "proto", m.proto); err != nil {
+			return fmt.Errorf("add %s route: %w", dst, err)
+		}
+		m.routes = append(m.routes, dst)
+	}
+	return nil
+}
+
+// removeDefaultRoutes deletes the host's IPv4 default routes for
+// RouteReplace, keeping them for TeardownRouting.
+func (m *linuxManager) removeDefaultRoutes() error {
+	out, err := exec.Command("ip", "-4", "route", "show", "default").Output()
+	if err != nil {
+		return fmt.Errorf("list default routes: %w", err)
+	}
+	for _, r := range untaggedRoutes(parseDefaultRoutes(string(out))) {
+		if err := privexec.Run("ip", append([]string{"route", "del"}, r...)...); err != nil {
+			return fmt.Errorf("remove default route %q: %w", strings.Join(r, " "), err)
+		}
+		m.replaced = append(m.replaced, r)
 	}
 	return nil
 }
 
 func (m *linuxManager) TeardownRouting() error {
-	// Remove our added route. Errors are expected if it was already cleaned up.
-	_ = run("ip", "route", "del", "default", "metric", "50")
+	// Remove our routes. Errors are expected if they were already cleaned
+	// up, or were never added in this process.
+	dsts, metric := m.routes, m.routeMetric
+	if dsts == nil {
+		dsts, metric = []string{"default"}, strconv.Itoa(defaultRouteMetric)
+	}
+	for _, dst := range dsts {
+		_ = privexec.Run("ip", "route", "del", dst, "metric", metric, "proto", m.proto)
+	}
+
+	var errs []string
+	for _, r := range m.replaced {
+		if err := privexec.Run("ip", append([]string{"route", "replace"}, r...)...); err != nil {
+			errs = append(errs, fmt.Sprintf("%q: %v", strings.Join(r, " "), err))
+		}
+	}
+	m.routes, m.routeMetric, m.replaced = nil, "", nil
+	if len(errs) > 0 {
+		return fmt.Errorf("restore default routes: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (m *linuxManager) SetupIPv6(tapName string, opts IPv6Options) error {
+	switch opts.Mode {
+	case IPv6Route:
+		cidr := fmt.Sprintf("%s/%d", opts.HostIP, opts.PrefixLen)
+		if err := privexec.Run("ip", "-6", "addr", "add", cidr, "dev", tapName, "nodad"); err != nil {
+			return fmt.Errorf("set tap ipv6 address: %w", err)
+		}
+		for _, dst := range ipv6SplitRoutes {
+			if err := privexec.Run("ip", "-6", "route", "add", dst, "via", opts.VMIP.String(), "dev", tapName,
+				"metric", "50", "proto", m.proto); err != nil {
+				return fmt.Errorf("add ipv6 route %s: %w", dst, err)
+			}
+		}
+	case IPv6Block:
+		// Unreachable routes fail fast instead of timing out, and leave
+		// link-local and on-link LAN prefixes (more specific) working.
+		for _, dst := range ipv6SplitRoutes {
+			if err := privexec.Run("ip", "-6", "route", "add", "unreachable", dst,
+				"metric", "50", "proto", m.proto); err != nil {
+				return fmt.Errorf("add ipv6 blackhole %s: %w", dst, err)
+			}
+		}
+	case IPv6Off:
+		return nil
+	default:
+		return fmt.Errorf("unknown ipv6 mode %q", opts.Mode)
+	}
+	m.ipv6Mode = opts.Mode
 	return nil
 }
 
+func (m *linuxManager) TeardownIPv6() error {
+	for _, dst := range ipv6SplitRoutes {
+		args := []string{"-6", "route", "del"}
+		if m.ipv6Mode == IPv6Block {
+			args = append(args, "unreachable")
+		}
+		args = append(args, dst, "metric", "50", "proto", m.proto)
+		_ = privexec.Run("ip", args...)
+	}
+	m.ipv6Mode = ""
+	return nil
+}
+
+func (m *linuxManager) SetupLANRoutes(tapName string, vmIP net.IP, ranges []*net.IPNet) error {
+	out, err := exec.Command("ip", "-4", "route", "show", "default").Output()
+	if err != nil {
+		return fmt.Errorf("list default routes: %w", err)
+	}
+	gw, dev := defaultGateway(parseDefaultRoutes(string(out)), tapName)
+	if dev == "" {
+		return fmt.Errorf("no default route outside %s for LAN routes", tapName)
+	}
+	for _, n := range ranges {
+		// Tagged with m.proto so PurgeArtifacts also finds these.
+		args := []string{"route", "add", n.String()}
+		if gw != "" && !isLinkLocal(n) {
+			args = append(args, "via", gw)
+		}
+		args = append(args, "dev", dev, "proto", m.proto)
+		if err := privexec.Run("ip", args...); err != nil {
+			return fmt.Errorf("add LAN route %s: %w", n, err)
+		}
+		m.lanRoutes = append(m.lanRoutes, n.String())
+	}
+	return nil
+}
+
+func (m *linuxManager) TeardownLANRoutes() error {
+	for _, dst := range m.lanRoutes {
+		_ = privexec.Run("ip", "route", "del", dst, "proto", m.proto)
+	}
+	m.lanRoutes = nil
+	return nil
+}
+
+func (m *linuxManager) PurgeArtifacts(opts PurgeOptions) ([]string, error) {
+	var removed []string
+
+	// TAP devices carry the instance label as their interface alias.
+	links, err := os.ReadDir("/sys/class/net")
+	if err != nil {
+		return removed, fmt.Errorf("list interfaces: %w", err)
+	}
+	var ours []string
+	others := make(map[string]bool)
+	for _, link := range links {
+		alias, err := os.ReadFile(filepath.Join("/sys/class/net", link.Name(), "ifalias"))
+		switch a := strings.TrimSpace(string(alias)); {
+		case err != nil:
+		case a == m.label:
+			ours = append(ours, link.Name())
+		case strings.HasPrefix(a, LabelPrefix):
+			others[link.Name()] = true
+		}
+	}
+
+	// Routes tagged with our protocol number outlive the controller if it
+	// crashed before TeardownRouting. Should another instance's number be
+	// the same, its routes through its own TAP device are still kept.
+	for _, family := range []string{"-4", "-6"} {
+		out, err := exec.Command("ip", family, "route", "show", "proto", m.proto).Output()
+		if err != nil {
+			return removed, fmt.Errorf("list tagged routes: %w", err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || others[routeDev(fields)] {
+				continue
+			}
+			args := append([]string{family, "route", "del"}, fields...)
+			args = append(args, "proto", m.proto)
+			if err := privexec.Run("ip", args...); err != nil {
+				return removed, fmt.Errorf("delete route %q: %w", line, err)
+			}
+			removed = append(removed, "route: "+line)
+		}
+	}
+
+	if opts.KeepTAP {
+		ours = nil
+	}
+	for _, name := range ours {
+		if err := m.DestroyTAP(name); err != nil {
+			return removed, fmt.Errorf("delete tap %s: %w", name, err)
+		}
+		removed = append(removed, "tap: "+name)
+	}
+
+	if dns := dnsBlockName(m.label); exec.Command("nft", "list", "table", "inet", dns).Run() == nil {
+		if err := m.UnblockDNSLeaks(); err != nil {
+			return removed, err
+		}
+		removed = append(removed, "nftables table: inet "+dns)
+	}
+	if share := sharingName(m.label); exec.Command("nft", "list", "table", "inet", share).Run() == nil {
+		if err := m.UnrouteSharedClients(); err != nil {
+			return removed, err
+		}
+		removed = append(removed, "nftables table: inet "+share)
+	}
+
+	// A failsafe ruleset left by a crashed session keeps the host offline.
+	table := failsafeName(m.label)
+	if !opts.KeepFirewall && exec.Command("nft", "list", "table", "inet", table).Run() == nil {
+		if err := m.UnblockTraffic(); err != nil {
+			return removed, err
+		}
+		removed = append(removed, "nftables table: inet "+table)
+	}
+	return removed, nil
+}
+
 func (m *linuxManager) FlushDNS() error {
 	// systemd-resolved
-	_ = run("resolvectl", "flush-caches")
+	_ = privexec.Run("resolvectl", "flush-caches")
+	return nil
+}
+
+func (m *linuxManager) BlockTraffic(opts BlockOptions) error {
+	// Leave the routes alone: with the VM gone they blackhole traffic,
+	// whereas removing them would expose the original default route.
+	rs := nftFailsafeRuleset(failsafeName(m.label), opts)
+	if err := nft(rs); err != nil {
+		return fmt.Errorf("install nftables failsafe: %w", err)
+	}
+	return nil
+}
+
+func (m *linuxManager) BlockDNSLeaks(opts DNSBlockOptions) error {
+	if err := nft(nftDNSBlockRuleset(dnsBlockName(m.label), opts)); err != nil {
+		return fmt.Errorf("install nftables DNS leak rules: %w", err)
+	}
+	return nil
+}
+
+func (m *linuxManager) UnblockDNSLeaks() error {
+	table := dnsBlockName(m.label)
+	if err := nft(fmt.Sprintf("table inet %s\ndelete table inet %s\n", table, table)); err != nil {
+		return fmt.Errorf("remove nftables DNS leak rules: %w", err)
+	}
+	return nil
+}
+
+// DetectSharing returns the interfaces other devices reach the network
+// through: wireless interfaces in access point mode and NetworkManager
+// shared connections. Without IPv4 forwarding nothing is shared.
+func DetectSharing() ([]SharedInterface, error) {
+	fwd, err := os.ReadFile("/proc/sys/net/ipv4/ip_forward")
+	if err != nil {
+		return nil, fmt.Errorf("read ip_forward: %w", err)
+	}
+	if strings.TrimSpace(string(fwd)) != "1" {
+		return nil, nil
+	}
+	var shared []SharedInterface
+	seen := make(map[string]bool)
+	add := func(name, kind string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			shared = append(shared, SharedInterface{Name: name, Kind: kind})
+		}
+	}
+	// Either tool may be missing; each finds what the other cannot.
+	if out, err := exec.Command("iw", "dev").Output(); err == nil {
+		for _, iface := range parseIWDev(string(out)) {
+			add(iface, "hotspot")
+		}
+	}
+	if out, err := exec.Command("nmcli", "-t", "-f", "DEVICE,UUID", "connection", "show", "--active").Output(); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			dev, uuid, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			method, err := exec.Command("nmcli", "-g", "ipv4.method", "connection", "show", uuid).Output()
+			if err == nil && strings.TrimSpace(string(method)) == "shared" {
+				add(dev, "shared connection")
+			}
+		}
+	}
+	return shared, nil
+}
+
+func (m *linuxManager) RouteSharedClients(opts SharingOptions) error {
+	if err := nft(nftSharingRuleset(sharingName(m.label), opts)); err != nil {
+		return fmt.Errorf("install nftables sharing rules: %w", err)
+	}
+	return nil
+}
+
+func (m *linuxManager) UnrouteSharedClients() error {
+	table := sharingName(m.label)
+	if err := nft(fmt.Sprintf("table inet %s\ndelete table inet %s\n", table, table)); err != nil {
+		return fmt.Errorf("remove nftables sharing rules: %w", err)
+	}
+	return nil
+}
+
+func (m *linuxManager) UnblockTraffic() error {
+	// Declaring the table first makes the delete succeed if it is absent.
+	table := failsafeName(m.label)
+	if err := nft(fmt.Sprintf("table inet %s\ndelete table inet %s\n", table, table)); err != nil {
+		return fmt.Errorf("remove nftables failsafe: %w", err)
+	}
+	return nil
+}
+
+// nft applies script as a single nftables transaction.
+func nft(script string) error {
+	op := privexec.Command("nft", "-f", "-")
+	op.Stdin = script
+	if out, err := privexec.Output(op); err != nil {
+		return fmt.Errorf("nft: %s: %w", strings.TrimSpace(out), err)
+	}
 	return nil
 }
 
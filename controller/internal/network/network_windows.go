@@ -3,85 +3,102 @@
 package network
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"golang.org/x/sys/windows"
+
+	"github.com/user/extorvm/controller/internal/privexec"
 )
 
 type windowsManager struct {
 	stateDir   string
-	sessionKey []byte // Session-derived key for HMAC integrity of saved config.
+	key        []byte // HMAC key for saved config, persisted in stateDir
+	label      string
+	ipv6TAP    string // adapter that SetupIPv6 routed through, for teardown
+
+	// lanRoutes holds "route delete" arguments for routes added by
+	// SetupLANRoutes.
+	lanRoutes [][]string
+
+	// routeTAP is the adapter SetupRouting routed through. splitRoutes and
+	// metricSet record that it added the IPv4 split routes there and set
+	// its interface metric; replacedGWs are the gateways of the host
+	// default routes it removed.
+	routeTAP    string
+	splitRoutes bool
+	metricSet   bool
+	replacedGWs []string
 }
 
-// NewManager returns a Windows network manager.
-// Ported from torvm.c: configtap(), savenetconfig(), restorenetconfig().
-func NewManager() Manager {
-	// Derive state directory from the executable's location to avoid
-	// relying on the working directory, which could be attacker-controlled.
-	stateDir := filepath.Join(".", "state") // fallback
+// DefaultStateDir is where the controller keeps network state that must
+// survive a crash (see SessionStore). It is derived from the executable's
+// location to avoid relying on the working directory, which could be
+// attacker-controlled.
+func DefaultStateDir() string {
 	if exe, err := os.Executable(); err == nil {
-		stateDir = filepath.Join(filepath.Dir(exe), "state")
+		return filepath.Join(filepath.Dir(exe), "state")
+	}
+	return filepath.Join(".", "state") // fallback
+}
+
+// TAPPresent reports whether the TAP adapter still exists, so the engine
+// can notice one removed behind its back (e.g. by another tool).
+func TAPPresent(name string) bool {
+	_, err := net.InterfaceByName(name)
+	return err == nil
+}
+
+// CheckTAPSupport reports whether the TAP-Windows adapter name exists.
+// TorVM configures the adapter but cannot install the driver.
+func CheckTAPSupport(name string) error {
+	if !TAPPresent(name) {
+		return fmt.Errorf("TAP adapter %q not found", name)
 	}
+	return nil
+}
 
+// NewManager returns a Windows network manager.
+// Ported from torvm.c: configtap(), savenetconfig(), restorenetconfig().
+func NewManager(label, stateDir string) Manager {
 	return &windowsManager{
-		stateDir:   stateDir,
-		sessionKey: newSessionKey(),
+		stateDir: stateDir,
+		key:      managerKey(stateDir),
+		label:    label,
 	}
 }
 
-func (m *windowsManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask) error {
+func (m *windowsManager) CreateTAP(name string, hostIP, vmIP net.IP, mask net.IPMask, mtu int) error {
 	// TAP-Windows6 adapter is expected to be pre-installed.
 	// Configure the adapter IP address via netsh, matching legacy configtap().
-	if err := run("netsh", "interface", "ip", "set", "address",
+	if err := privexec.Run("netsh", "interface", "ip", "set", "address",
 		name, "static", hostIP.String(), net.IP(mask).String(), vmIP.String(), "1"); err != nil {
 		return fmt.Errorf("configure tap address: %w", err)
 	}
+	if err := privexec.Run("netsh", "interface", "ipv4", "set", "subinterface",
+		name, fmt.Sprintf("mtu=%d", mtu), "store=active"); err != nil {
+		return fmt.Errorf("set tap mtu: %w", err)
+	}
 	return nil
 }
 
 func (m *windowsManager) DestroyTAP(name string) error {
 	// Remove the IP configuration; the adapter itself persists.
-	_ = run("netsh", "interface", "ip", "delete", "address", name, "all")
+	_ = privexec.Run("netsh", "interface", "ip", "delete", "address", name, "all")
 	return nil
 }
 
-// validateNetshDump checks that every non-empty, non-comment line in a netsh
-// dump starts with a known-safe prefix to prevent command injection.
-func validateNetshDump(data []byte) error {
-	safePrefixes := []string{
-		"set address", "add dns", "set dns",
-		"add wins", "set wins",
-		"pushd", "popd",
-		"set interface",
-		"add address",
-	}
+var procGetOEMCP = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetOEMCP")
 
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "rem ") {
-			continue
-		}
-		safe := false
-		lower := strings.ToLower(line)
-		for _, prefix := range safePrefixes {
-			if strings.HasPrefix(lower, prefix) {
-				safe = true
-				break
-			}
-		}
-		if !safe {
-			return fmt.Errorf("netsh dump line %d has unexpected content: %q", lineNum, line)
-		}
-	}
-	return scanner.Err()
+// oemCodePage returns the OEM code page netsh writes its output in.
+func oemCodePage() uint32 {
+	cp, _, _ := procGetOEMCP.Call()
+	return uint32(cp)
 }
 
 
@@ -104,7 +121,7 @@ func (m *windowsManager) SaveConfig() (*SavedConfig, error) {
 	return &SavedConfig{
 		Data:     out,
 		Platform: "windows",
-		HMAC:     computeHMAC(m.sessionKey, out),
+		HMAC:     computeHMAC(m.key, out),
 	}, nil
 }
 
@@ -114,12 +131,16 @@ func (m *windowsManager) RestoreConfig(cfg *SavedConfig) error {
 	}
 
 	// Verify HMAC integrity before restoring.
-	if err := verifyHMAC(m.sessionKey, cfg.Data, cfg.HMAC); err != nil {
+	if err := verifyHMAC(m.key, cfg.Data, cfg.HMAC); err != nil {
 		return fmt.Errorf("saved config integrity check failed: %w", err)
 	}
 
 	// Validate the saved dump before executing it.
-	if err := validateNetshDump(cfg.Data); err != nil {
+	text, err := decodeNetshDump(cfg.Data, oemCodePage())
+	if err != nil {
+		return fmt.Errorf("netsh dump validation failed: %w", err)
+	}
+	if err := validateNetshDump(text); err != nil {
 		return fmt.Errorf("netsh dump validation failed: %w", err)
 	}
 
@@ -130,7 +151,7 @@ func (m *windowsManager) RestoreConfig(cfg *SavedConfig) error {
 		return fmt.Errorf("write netcfg for restore: %w", err)
 	}
 
-	if err := run("netsh", "exec", savePath); err != nil {
+	if err := privexec.Run("netsh", "exec", savePath); err != nil {
 		os.Remove(savePath)
 		return fmt.Errorf("netsh exec restore: %w", err)
 	}
@@ -139,22 +160,344 @@ func (m *windowsManager) RestoreConfig(cfg *SavedConfig) error {
 	return nil
 }
 
-func (m *windowsManager) SetupRouting(tapName string, vmIP net.IP) error {
-	// Set DNS servers on the TAP adapter, matching legacy configtap().
-	if err := run("netsh", "interface", "ip", "set", "dns", tapName, "static", "4.2.2.4"); err != nil {
-		return fmt.Errorf("set dns1: %w", err)
+func (m *windowsManager) SetupRouting(tapName string, opts RoutingOptions) error {
+	// Set DNS servers on the TAP adapter, as legacy configtap() did.
+	servers := opts.DNS
+	if len(servers) == 0 {
+		servers = []net.IP{opts.VMIP}
+	}
+	if err := privexec.Run("netsh", "interface", "ip", "set", "dns", tapName, "static", servers[0].String()); err != nil {
+		return fmt.Errorf("set dns %s: %w", servers[0], err)
+	}
+	for _, ip := range servers[1:] {
+		if err := privexec.Run("netsh", "interface", "ip", "add", "dns", tapName, ip.String()); err != nil {
+			return fmt.Errorf("add dns %s: %w", ip, err)
+		}
+	}
+
+	// CreateTAP made the VM the adapter's gateway, which gives the
+	// default route of RouteMetric.
+	m.routeTAP = tapName
+	switch opts.Strategy {
+	case "", RouteMetric:
+	case RouteReplace:
+		if err := m.removeDefaultRoutes(opts.VMIP); err != nil {
+			return err
+		}
+	case RouteSplit:
+		m.splitRoutes = true
+		for _, dst := range ipv4SplitRoutes {
+			if err := privexec.Run("netsh", "interface", "ipv4", "add", "route", dst, tapName,
+				opts.VMIP.String(), "store=active"); err != nil {
+				return fmt.Errorf("add route %s: %w", dst, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown route strategy %q", opts.Strategy)
+	}
+	if opts.Metric > 0 {
+		// Windows adds the interface metric to the metric of every route
+		// through the adapter; the automatic one follows the link speed.
+		m.metricSet = true
+		if err := setInterfaceMetric(tapName, opts.Metric); err != nil {
+			return fmt.Errorf("set interface metric: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeDefaultRoutes deletes the host's IPv4 default routes other than
+// the VM's for RouteReplace, keeping their gateways for TeardownRouting.
+func (m *windowsManager) removeDefaultRoutes(vmIP net.IP) error {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return fmt.Errorf("list default routes: %w", err)
 	}
-	if err := run("netsh", "interface", "ip", "add", "dns", tapName, "4.2.2.2"); err != nil {
-		return fmt.Errorf("set dns2: %w", err)
+	for _, gw := range parseRoutePrintDefaults(string(out), vmIP.String()) {
+		if err := privexec.Run("route", "delete", "0.0.0.0", "mask", "0.0.0.0", gw); err != nil {
+			return fmt.Errorf("remove default route via %s: %w", gw, err)
+		}
+		m.replacedGWs = append(m.replacedGWs, gw)
 	}
 	return nil
 }
 
+// setInterfaceMetric sets the IPv4 interface metric of an adapter, or
+// with metric 0 returns it to the automatic one.
+func setInterfaceMetric(adapter string, metric int) error {
+	setting := "-AutomaticMetric Enabled"
+	if metric > 0 {
+		setting = "-InterfaceMetric " + strconv.Itoa(metric)
+	}
+	cmd := fmt.Sprintf("Set-NetIPInterface -InterfaceAlias '%s' -AddressFamily IPv4 %s",
+		strings.ReplaceAll(adapter, "'", "''"), setting)
+	return privexec.Run("powershell", "-NoProfile", "-NonInteractive", "-Command", cmd)
+}
+
 func (m *windowsManager) TeardownRouting() error {
+	// The gateway set by CreateTAP goes with the adapter's address when
+	// the network is restored.
+	var errs []string
+	if m.splitRoutes {
+		for _, dst := range ipv4SplitRoutes {
+			_ = privexec.Run("netsh", "interface", "ipv4", "delete", "route", dst, m.routeTAP)
+		}
+	}
+	if m.metricSet {
+		if err := setInterfaceMetric(m.routeTAP, 0); err != nil {
+			errs = append(errs, fmt.Sprintf("interface metric: %v", err))
+		}
+	}
+	for _, gw := range m.replacedGWs {
+		if err := privexec.Run("route", "add", "0.0.0.0", "mask", "0.0.0.0", gw); err != nil {
+			errs = append(errs, fmt.Sprintf("default route via %s: %v", gw, err))
+		}
+	}
+	m.routeTAP, m.splitRoutes, m.metricSet, m.replacedGWs = "", false, false, nil
+	if len(errs) > 0 {
+		return fmt.Errorf("teardown routing: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (m *windowsManager) SetupIPv6(tapName string, opts IPv6Options) error {
+	switch opts.Mode {
+	case IPv6Route:
+		addr := fmt.Sprintf("%s/%d", opts.HostIP, opts.PrefixLen)
+		if err := privexec.Run("netsh", "interface", "ipv6", "add", "address", tapName, addr, "store=active"); err != nil {
+			return fmt.Errorf("set tap ipv6 address: %w", err)
+		}
+		for _, dst := range ipv6SplitRoutes {
+			if err := privexec.Run("netsh", "interface", "ipv6", "add", "route", dst, tapName,
+				opts.VMIP.String(), "metric=50", "store=active"); err != nil {
+				return fmt.Errorf("add ipv6 route %s: %w", dst, err)
+			}
+		}
+	case IPv6Block:
+		// Windows has no blackhole routes. Point the split routes on-link
+		// at the TAP adapter instead: the VM drops all IPv6, so nothing
+		// escapes, and the routes still outrank the physical default.
+		for _, dst := range ipv6SplitRoutes {
+			if err := privexec.Run("netsh", "interface", "ipv6", "add", "route", dst, tapName,
+				"metric=50", "store=active"); err != nil {
+				return fmt.Errorf("add ipv6 block route %s: %w", dst, err)
+			}
+		}
+	case IPv6Off:
+		return nil
+	default:
+		return fmt.Errorf("unknown ipv6 mode %q", opts.Mode)
+	}
+	m.ipv6TAP = tapName
+	return nil
+}
+
+func (m *windowsManager) TeardownIPv6() error {
+	if m.ipv6TAP == "" {
+		return nil
+	}
+	for _, dst := range ipv6SplitRoutes {
+		_ = privexec.Run("netsh", "interface", "ipv6", "delete", "route", dst, m.ipv6TAP)
+	}
+	m.ipv6TAP = ""
+	return nil
+}
+
+func (m *windowsManager) SetupLANRoutes(tapName string, vmIP net.IP, ranges []*net.IPNet) error {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return fmt.Errorf("list default routes: %w", err)
+	}
+	gws := parseRoutePrintDefaults(string(out), vmIP.String())
+	if len(gws) == 0 {
+		return fmt.Errorf("no default gateway outside the VM for LAN routes")
+	}
+	for _, n := range ranges {
+		// Windows keeps an on-link 169.254.0.0/16 route per adapter.
+		if isLinkLocal(n) {
+			continue
+		}
+		dst, mask := n.IP.String(), net.IP(n.Mask).String()
+		if err := privexec.Run("route", "add", dst, "mask", mask, gws[0], "metric", "1"); err != nil {
+			return fmt.Errorf("add LAN route %s: %w", n, err)
+		}
+		m.lanRoutes = append(m.lanRoutes, []string{"delete", dst, "mask", mask, gws[0]})
+	}
+	return nil
+}
+
+func (m *windowsManager) TeardownLANRoutes() error {
+	for _, args := range m.lanRoutes {
+		_ = privexec.Run("route", args...)
+	}
+	m.lanRoutes = nil
 	return nil
 }
 
 func (m *windowsManager) FlushDNS() error {
-	return run("ipconfig", "/flushdns")
+	return privexec.Run("ipconfig", "/flushdns")
+}
+
+func (m *windowsManager) PurgeArtifacts(opts PurgeOptions) ([]string, error) {
+	var removed []string
+	if m.hasRule(m.dnsRule()) {
+		if err := m.UnblockDNSLeaks(); err != nil {
+			return nil, err
+		}
+		removed = append(removed, "firewall rules: "+m.dnsRule())
+	}
+	if !opts.KeepFirewall && m.hasFirewallRule() {
+		if err := m.UnblockTraffic(); err != nil {
+			return nil, err
+		}
+		removed = append(removed, "firewall rules: "+m.firewallRule())
+	}
+
+	// The TAP-Windows adapter persists across sessions and cannot carry a
+	// label; only its static address and DNS configuration are ours.
+	out, err := exec.Command("netsh", "interface", "ip", "show", "config", "name="+opts.TAPName).CombinedOutput()
+	if err != nil {
+		// Adapter not present: nothing more to purge.
+		return removed, nil
+	}
+	for _, dst := range ipv4SplitRoutes {
+		if err := privexec.Run("netsh", "interface", "ipv4", "delete", "route", dst, opts.TAPName); err == nil {
+			removed = append(removed, "route: "+dst+" on "+opts.TAPName)
+		}
+	}
+	for _, dst := range ipv6SplitRoutes {
+		if err := privexec.Run("netsh", "interface", "ipv6", "delete", "route", dst, opts.TAPName); err == nil {
+			removed = append(removed, "ipv6 route: "+dst+" on "+opts.TAPName)
+		}
+	}
+	if opts.KeepTAP || !strings.Contains(string(out), opts.VMIP.String()) {
+		return removed, nil
+	}
+	if err := privexec.Run("netsh", "interface", "ip", "set", "address", opts.TAPName, "dhcp"); err != nil {
+		return removed, fmt.Errorf("reset tap address: %w", err)
+	}
+	if err := privexec.Run("netsh", "interface", "ip", "set", "dns", opts.TAPName, "dhcp"); err != nil {
+		return removed, fmt.Errorf("reset tap dns: %w", err)
+	}
+	return append(removed, "tap configuration: "+opts.TAPName), nil
+}
+
+func (m *windowsManager) BlockTraffic(opts BlockOptions) error {
+	if opts.KillSwitch {
+		// The rules below match remote addresses on every adapter;
+		// netsh cannot exempt the TAP adapter from a block rule.
+		return fmt.Errorf("persistent kill switch: %w", ErrBlockUnsupported)
+	}
+	var allowed []*net.IPNet
+	if opts.Subnet != nil {
+		allowed = append(allowed, opts.Subnet)
+	}
+	allowed = append(allowed, opts.LAN...)
+	remote := strings.Join(blockedRanges(allowed), ",")
+
+	// Replace rules left by an earlier activation rather than stacking
+	// duplicates.
+	if err := m.UnblockTraffic(); err != nil {
+		return err
+	}
+	name := m.firewallRule()
+	for _, dir := range []string{"out", "in"} {
+		if err := privexec.Run("netsh", "advfirewall", "firewall", "add", "rule",
+			"name="+name, "dir="+dir, "action=block", "profile=any",
+			"enable=yes", "remoteip="+remote); err != nil {
+			return fmt.Errorf("add %sbound firewall rule: %w", dir, err)
+		}
+	}
+	return nil
 }
 
+func (m *windowsManager) UnblockTraffic() error {
+	if !m.hasFirewallRule() {
+		return nil
+	}
+	if err := privexec.Run("netsh", "advfirewall", "firewall", "delete", "rule", "name="+m.firewallRule()); err != nil {
+		return fmt.Errorf("remove firewall rules: %w", err)
+	}
+	return nil
+}
+
+// firewallRule names the Windows Firewall rules installed by BlockTraffic.
+func (m *windowsManager) BlockDNSLeaks(opts DNSBlockOptions) error {
+	if err := m.UnblockDNSLeaks(); err != nil {
+		return err
+	}
+	remote := strings.Join(dnsBlockedRanges(opts), ",")
+	ports := strings.Join(dnsPorts, ",")
+	for _, proto := range []string{"UDP", "TCP"} {
+		if err := privexec.Run("netsh", "advfirewall", "firewall", "add", "rule",
+			"name="+m.dnsRule(), "dir=out", "action=block", "profile=any",
+			"enable=yes", "protocol="+proto, "remoteport="+ports,
+			"remoteip="+remote); err != nil {
+			return fmt.Errorf("add %s DNS leak rule: %w", proto, err)
+		}
+	}
+	return nil
+}
+
+func (m *windowsManager) UnblockDNSLeaks() error {
+	if !m.hasRule(m.dnsRule()) {
+		return nil
+	}
+	if err := privexec.Run("netsh", "advfirewall", "firewall", "delete", "rule", "name="+m.dnsRule()); err != nil {
+		return fmt.Errorf("remove DNS leak rules: %w", err)
+	}
+	return nil
+}
+
+// icsQuery lists the adapters Internet Connection Sharing (which also
+// backs the Mobile Hotspot) shares the connection to: the private side,
+// SharingConnectionType 1.
+const icsQuery = `$m = New-Object -ComObject HNetCfg.HNetShare; ` +
+	`foreach ($c in $m.EnumEveryConnection) { ` +
+	`$s = $m.INetSharingConfigurationForINetConnection.Invoke($c); ` +
+	`if ($s.SharingEnabled -and $s.SharingConnectionType -eq 1) { $m.NetConnectionProps.Invoke($c).Name } }`
+
+// DetectSharing returns the adapters that Internet Connection Sharing or
+// the Mobile Hotspot shares the host's connection to.
+func DetectSharing() ([]SharedInterface, error) {
+	out, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", icsQuery).Output()
+	if err != nil {
+		return nil, fmt.Errorf("query connection sharing: %w", err)
+	}
+	var shared []SharedInterface
+	for _, name := range strings.Split(string(out), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			shared = append(shared, SharedInterface{Name: name, Kind: "ICS"})
+		}
+	}
+	return shared, nil
+}
+
+// RouteSharedClients is not supported: ICS translates its clients to the
+// public adapter it was set up with, whatever the routing table says.
+func (m *windowsManager) RouteSharedClients(opts SharingOptions) error {
+	return ErrSharingUnsupported
+}
+
+func (m *windowsManager) UnrouteSharedClients() error {
+	return nil
+}
+
+func (m *windowsManager) dnsRule() string {
+	return "TorVM DNS block " + failsafeName(m.label)
+}
+
+func (m *windowsManager) firewallRule() string {
+	return "TorVM failsafe " + failsafeName(m.label)
+}
+
+// hasFirewallRule reports whether the failsafe rules are installed.
+// "delete rule" fails when nothing matches, with a localized message, so
+// the rules are looked up first.
+func (m *windowsManager) hasFirewallRule() bool {
+	return m.hasRule(m.firewallRule())
+}
+
+func (m *windowsManager) hasRule(name string) bool {
+	return exec.Command("netsh", "advfirewall", "firewall", "show", "rule", "name="+name).Run() == nil
+}
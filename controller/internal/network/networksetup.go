@@ -0,0 +1,41 @@
+package network
+
+import (
+	"net"
+	"strings"
+)
+
+// parseNetworkServices parses the output of
+// "networksetup -listallnetworkservices" into a list of enabled service
+// names. The first line of the output is an explanatory header, and
+// disabled services are prefixed with an asterisk.
+func parseNetworkServices(out string) []string {
+	var services []string
+	for i, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if i == 0 && strings.Contains(line, "asterisk") {
+			continue
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "*") {
+			continue
+		}
+		services = append(services, line)
+	}
+	return services
+}
+
+// parseDNSServers parses the output of "networksetup -getdnsservers <svc>".
+// It returns nil when the service has no manually configured DNS servers,
+// meaning the resolver falls back to DHCP-provided servers.
+func parseDNSServers(out string) []string {
+	var servers []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if net.ParseIP(line) == nil {
+			// "There aren't any DNS Servers set on <svc>." or similar.
+			continue
+		}
+		servers = append(servers, line)
+	}
+	return servers
+}
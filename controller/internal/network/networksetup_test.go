@@ -0,0 +1,39 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNetworkServices(t *testing.T) {
+	out := "An asterisk (*) denotes that a network service is disabled.\n" +
+		"Wi-Fi\n" +
+		"USB 10/100/1000 LAN\n" +
+		"*Thunderbolt Bridge\n" +
+		"\n"
+	got := parseNetworkServices(out)
+	want := []string{"Wi-Fi", "USB 10/100/1000 LAN"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetworkServices = %q, want %q", got, want)
+	}
+}
+
+func TestParseDNSServers(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []string
+	}{
+		{"none set", "There aren't any DNS Servers set on Wi-Fi.\n", nil},
+		{"ipv4", "1.1.1.1\n9.9.9.9\n", []string{"1.1.1.1", "9.9.9.9"}},
+		{"mixed", "10.0.0.1\nfd00::1\n", []string{"10.0.0.1", "fd00::1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseDNSServers(tt.out)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseDNSServers = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"strings"
+)
+
+// parseIPRouteGet parses Linux "ip -4 route get <dst>" output into the
+// next hop and output device. gw is empty for on-link destinations.
+func parseIPRouteGet(out string) (gw, dev string) {
+	// Format: "9.9.9.9 via 10.10.10.1 dev torvm0 src 10.10.10.2 uid 0"
+	fields := strings.Fields(out)
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "via":
+			gw = fields[i+1]
+		case "dev":
+			dev = fields[i+1]
+		}
+	}
+	return gw, dev
+}
+
+// parseRouteGet parses macOS "route -n get <dst>" output into the gateway
+// address and interface name.
+func parseRouteGet(out string) (gw, iface string) {
+	for _, line := range strings.Split(out, "\n") {
+		key, val, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "gateway":
+			gw = strings.TrimSpace(val)
+		case "interface":
+			iface = strings.TrimSpace(val)
+		}
+	}
+	return gw, iface
+}
+
+// parseFindNetRoute parses the "<InterfaceAlias>|<NextHop>" line printed by
+// the Find-NetRoute query in the Windows verifier.
+func parseFindNetRoute(out string) (gw, alias string) {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if a, hop, ok := strings.Cut(line, "|"); ok {
+			return strings.TrimSpace(hop), strings.TrimSpace(a)
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,34 @@
+package network
+
+import "testing"
+
+func TestParseIPRouteGet(t *testing.T) {
+	gw, dev := parseIPRouteGet("9.9.9.9 via 10.10.10.1 dev torvm0 src 10.10.10.2 uid 0 \n    cache \n")
+	if gw != "10.10.10.1" || dev != "torvm0" {
+		t.Errorf("parseIPRouteGet = %q, %q; want 10.10.10.1, torvm0", gw, dev)
+	}
+	gw, dev = parseIPRouteGet("192.168.1.7 dev wlan0 src 192.168.1.5 uid 1000\n")
+	if gw != "" || dev != "wlan0" {
+		t.Errorf("parseIPRouteGet(on-link) = %q, %q; want \"\", wlan0", gw, dev)
+	}
+}
+
+func TestParseRouteGet(t *testing.T) {
+	out := "   route to: 9.9.9.9\n" +
+		"destination: 0.0.0.0\n" +
+		"       mask: 128.0.0.0\n" +
+		"    gateway: 10.10.10.1\n" +
+		"  interface: bridge100\n" +
+		"      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING>\n"
+	gw, iface := parseRouteGet(out)
+	if gw != "10.10.10.1" || iface != "bridge100" {
+		t.Errorf("parseRouteGet = %q, %q; want 10.10.10.1, bridge100", gw, iface)
+	}
+}
+
+func TestParseFindNetRoute(t *testing.T) {
+	gw, alias := parseFindNetRoute("\r\nTorVM Tap|10.10.10.1\r\n")
+	if gw != "10.10.10.1" || alias != "TorVM Tap" {
+		t.Errorf("parseFindNetRoute = %q, %q; want 10.10.10.1, TorVM Tap", gw, alias)
+	}
+}
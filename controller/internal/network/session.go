@@ -0,0 +1,208 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+// Host network changes recorded in Session.Changes, in the order a
+// session applies them.
+const (
+	ChangeTAP      = "tap"
+	ChangeRouting  = "routing"
+	ChangeIPv6     = "ipv6"
+	ChangeDNS      = "dns"
+	ChangeLAN      = "lan"
+	ChangeSharing  = "sharing"
+	ChangeFirewall = "firewall"
+)
+
+// Session records the host network changes made by a running controller.
+// It is kept on disk while the session runs, so that if the controller
+// crashes the next start can undo the changes before doing anything else.
+type Session struct {
+	Label   string    `json:"label"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	// PIDStart is platform.ProcessStart of PID, which tells the
+	// controller apart from a later process given its PID.
+	PIDStart string `json:"pid_start,omitempty"`
+	// State is the lifecycle state the session last entered.
+	State   string   `json:"state,omitempty"`
+	TAPName string   `json:"tap_name"`
+	HostIP  string   `json:"host_ip,omitempty"`
+	VMIP    string   `json:"vm_ip"`
+	Routes  []string `json:"routes,omitempty"` // IPv4 destinations routed through the VM
+	// QEMUPID and QMPPath identify the VM, which outlives a crashed
+	// controller: the next start reattaches to it or stops it.
+	QEMUPID int          `json:"qemu_pid,omitempty"`
+	QMPPath string       `json:"qmp_path,omitempty"`
+	Saved   *SavedConfig `json:"saved,omitempty"`
+	Changes []string     `json:"changes"`
+}
+
+// Claim makes the current process the one that owns s.
+func (s *Session) Claim() {
+	s.PID = os.Getpid()
+	s.PIDStart, _ = platform.ProcessStart(s.PID)
+}
+
+// Alive reports whether the process that wrote s, other than the current
+// one, is still running; its changes then belong to a live session. A
+// process that has the PID but started at another time, or in another
+// boot, is not the one.
+func (s *Session) Alive() bool {
+	if s.PID <= 0 || s.PID == os.Getpid() {
+		return false
+	}
+	start, err := platform.ProcessStart(s.PID)
+	if err != nil {
+		return false
+	}
+	// A session written before start times were recorded has none.
+	return s.PIDStart == "" || start == s.PIDStart
+}
+
+// SessionStore persists the Session of one controller instance in the
+// state directory, authenticated with the same persisted HMAC key the
+// Manager uses for SavedConfig.
+type SessionStore struct {
+	path string
+	key  []byte
+}
+
+// sessionFile is the on-disk form of a Session.
+type sessionFile struct {
+	Session json.RawMessage `json:"session"`
+	HMAC    string          `json:"hmac"`
+}
+
+// NewSessionStore returns the store for the instance with the given label
+// (see InstanceLabel) under stateDir, creating the HMAC key if needed.
+func NewSessionStore(stateDir, label string) (*SessionStore, error) {
+	key, err := stateKey(stateDir)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionStore{
+		path: filepath.Join(stateDir, "session-"+failsafeName(label)+".json"),
+		key:  key,
+	}, nil
+}
+
+// Save writes s, replacing any previous record.
+func (st *SessionStore) Save(s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	out, err := json.Marshal(sessionFile{Session: data, HMAC: computeHMAC(st.key, data)})
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	// Write and rename so a crash mid-write leaves the old record intact.
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0600); err != nil {
+		return fmt.Errorf("write session: %w", err)
+	}
+	if err := os.Rename(tmp, st.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write session: %w", err)
+	}
+	return nil
+}
+
+// Load returns the stored session, or nil if there is none.
+func (st *SessionStore) Load() (*Session, error) {
+	data, err := os.ReadFile(st.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+	var f sessionFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode session: %w", err)
+	}
+	if err := verifyHMAC(st.key, f.Session, f.HMAC); err != nil {
+		return nil, fmt.Errorf("session integrity check failed: %w", err)
+	}
+	var s Session
+	if err := json.Unmarshal(f.Session, &s); err != nil {
+		return nil, fmt.Errorf("decode session: %w", err)
+	}
+	return &s, nil
+}
+
+// Clear removes the stored session. It is a no-op if there is none.
+func (st *SessionStore) Clear() error {
+	if err := os.Remove(st.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove session: %w", err)
+	}
+	return nil
+}
+
+// Recover undoes the changes of a crashed session: it purges the
+// instance's labelled artifacts and restores the network configuration
+// saved when the session started. With keepFirewall, failsafe and kill
+// switch rules stay in place. Returns a description of each item removed.
+func Recover(m Manager, s *Session, keepFirewall bool) ([]string, error) {
+	removed, err := m.PurgeArtifacts(PurgeOptions{
+		TAPName:      s.TAPName,
+		VMIP:         net.ParseIP(s.VMIP),
+		KeepFirewall: keepFirewall,
+	})
+	if err != nil {
+		return removed, err
+	}
+	if s.Saved != nil {
+		if err := m.RestoreConfig(s.Saved); err != nil {
+			return removed, fmt.Errorf("restore saved network configuration: %w", err)
+		}
+		removed = append(removed, "network changes of the session started "+s.Started.Format(time.RFC3339)+" (saved configuration restored)")
+	}
+	return removed, nil
+}
+
+// stateKey returns the HMAC key stored in stateDir, creating it on first
+// use. Unlike a per-process key it verifies state written before a crash.
+func stateKey(stateDir string) ([]byte, error) {
+	path := filepath.Join(stateDir, "netcfg.key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read state key: %w", err)
+	}
+
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return nil, fmt.Errorf("create state dir: %w", err)
+	}
+	key = newSessionKey()
+	if key == nil {
+		return nil, fmt.Errorf("generate state key: no randomness available")
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("write state key: %w", err)
+	}
+	return key, nil
+}
+
+// managerKey returns the persisted HMAC key for a Manager, falling back to
+// a per-process key (which cannot verify state from a crashed session)
+// when stateDir is not writable.
+func managerKey(stateDir string) []byte {
+	if key, err := stateKey(stateDir); err == nil {
+		return key
+	}
+	return newSessionKey()
+}
@@ -0,0 +1,159 @@
+package network
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+func TestSessionStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	st, err := NewSessionStore(dir, "torvm:default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := st.Load(); s != nil || err != nil {
+		t.Fatalf("Load on empty store = %v, %v; want nil, nil", s, err)
+	}
+
+	want := &Session{
+		Label:   "torvm:default",
+		PID:     4242,
+		Started: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		State:   "Running",
+		TAPName: "torvm0",
+		HostIP:  "10.10.10.2",
+		VMIP:    "10.10.10.1",
+		Routes:  []string{"0.0.0.0/1", "128.0.0.0/1"},
+		QEMUPID: 4343,
+		QMPPath: "/run/torvm/qmp.sock",
+		Saved:   &SavedConfig{Data: []byte(`{"default_routes":[]}`), Platform: "linux", HMAC: "ab"},
+		Changes: []string{ChangeTAP, ChangeRouting},
+	}
+	if err := st.Save(want); err != nil {
+		t.Fatal(err)
+	}
+
+	// A store opened later (after a crash) shares the persisted key.
+	st2, err := NewSessionStore(dir, "torvm:default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := st2.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.PID != want.PID || !got.Started.Equal(want.Started) || got.VMIP != want.VMIP ||
+		!bytes.Equal(got.Saved.Data, want.Saved.Data) || strings.Join(got.Changes, ",") != "tap,routing" ||
+		got.State != want.State || got.HostIP != want.HostIP || strings.Join(got.Routes, ",") != "0.0.0.0/1,128.0.0.0/1" ||
+		got.QEMUPID != want.QEMUPID || got.QMPPath != want.QMPPath {
+		t.Errorf("Load = %+v, want %+v", got, want)
+	}
+
+	if err := st2.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st2.Clear(); err != nil {
+		t.Errorf("second Clear: %v", err)
+	}
+	if s, _ := st.Load(); s != nil {
+		t.Error("session still present after Clear")
+	}
+}
+
+func TestSessionStoreTampered(t *testing.T) {
+	dir := t.TempDir()
+	st, err := NewSessionStore(dir, "torvm:default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Save(&Session{TAPName: "torvm0", VMIP: "10.10.10.1"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "session-torvm_default.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("10.10.10.1"), []byte("10.10.10.9"), 1)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Load(); err == nil || !strings.Contains(err.Error(), "integrity") {
+		t.Errorf("Load of tampered record = %v, want integrity error", err)
+	}
+}
+
+func TestStateKeyPersisted(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	k1, err := stateKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := stateKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k1) != 32 || !bytes.Equal(k1, k2) {
+		t.Errorf("keys differ across loads or have wrong length (%d)", len(k1))
+	}
+	fi, err := os.Stat(filepath.Join(dir, "netcfg.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		t.Errorf("key file mode = %v, want owner-only", fi.Mode().Perm())
+	}
+}
+
+func TestSessionAlive(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSessionAliveHelper$")
+	cmd.Env = append(os.Environ(), "TORVM_TEST_SLEEP=1")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+	start, err := platform.ProcessStart(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Session{PID: cmd.Process.Pid, PIDStart: start}
+	if !s.Alive() {
+		t.Error("session of a running controller is not alive")
+	}
+	// The PID taken by another process: after a reboot, say.
+	s.PIDStart = "other-boot:" + start
+	if s.Alive() {
+		t.Error("session is alive by PID alone")
+	}
+
+	var own Session
+	own.Claim()
+	if own.Alive() {
+		t.Error("the current process's own session is alive")
+	}
+	if own.PID != os.Getpid() || own.PIDStart == "" {
+		t.Errorf("Claim = %+v", own)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	s.PIDStart = start
+	if s.Alive() {
+		t.Error("session of an exited controller is alive")
+	}
+}
+
+func TestSessionAliveHelper(t *testing.T) {
+	if os.Getenv("TORVM_TEST_SLEEP") == "" {
+		t.Skip("helper process for TestSessionAlive")
+	}
+	time.Sleep(time.Minute)
+}
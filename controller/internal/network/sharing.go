@@ -0,0 +1,114 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SharedInterface is a host interface that other devices reach the
+// network through: a Wi-Fi hotspot, a NetworkManager shared connection,
+// Windows Internet Connection Sharing, or macOS Internet Sharing. Their
+// traffic is forwarded by the host rather than sent by it, so the
+// failsafe and DNS leak rules do not cover it.
+type SharedInterface struct {
+	Name string // interface or adapter name
+	Kind string // how it is shared, e.g. "hotspot"
+}
+
+func (s SharedInterface) String() string {
+	return s.Name + " (" + s.Kind + ")"
+}
+
+// SharingOptions configures RouteSharedClients.
+type SharingOptions struct {
+	TAPName string
+	Shared  []SharedInterface
+}
+
+// ErrSharingUnsupported is returned by RouteSharedClients on platforms
+// where the connection sharing service cannot be pointed at the VM.
+var ErrSharingUnsupported = errors.New("routing shared clients through the VM is not supported on this platform")
+
+// sharingName derives the name of the nftables table that routes shared
+// clients through the VM from an instance label.
+func sharingName(label string) string {
+	return failsafeName(label) + "_share"
+}
+
+// nftSharingRuleset returns an nft script that replaces table with rules
+// sending traffic forwarded from the shared interfaces into the TAP,
+// masqueraded as the host so the VM redirects it into Tor, and dropping
+// it anywhere else.
+func nftSharingRuleset(table string, opts SharingOptions) string {
+	names := make([]string, len(opts.Shared))
+	for i, s := range opts.Shared {
+		names[i] = fmt.Sprintf("%q", s.Name)
+	}
+	shared := "{ " + strings.Join(names, ", ") + " }"
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s\n", table)
+	fmt.Fprintf(&b, "delete table inet %s\n", table)
+	fmt.Fprintf(&b, "table inet %s {\n", table)
+	b.WriteString("\tchain forward {\n\t\ttype filter hook forward priority -1; policy accept;\n")
+	fmt.Fprintf(&b, "\t\tiifname %s oifname %q accept\n", shared, opts.TAPName)
+	fmt.Fprintf(&b, "\t\tiifname %s oifname %s accept\n", shared, shared)
+	fmt.Fprintf(&b, "\t\tiifname %s drop\n", shared)
+	b.WriteString("\t}\n")
+	b.WriteString("\tchain postrouting {\n\t\ttype nat hook postrouting priority srcnat; policy accept;\n")
+	fmt.Fprintf(&b, "\t\tiifname %s oifname %q masquerade\n", shared, opts.TAPName)
+	b.WriteString("\t}\n")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// parseIWDev parses "iw dev" output into the wireless interfaces running
+// as an access point.
+func parseIWDev(out string) []string {
+	var aps []string
+	var iface string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 2 && fields[0] == "Interface":
+			iface = fields[1]
+		case len(fields) == 2 && fields[0] == "type" && fields[1] == "AP" && iface != "":
+			aps = append(aps, iface)
+		}
+	}
+	return aps
+}
+
+// parseNATPlist parses the output of "defaults read
+// /Library/Preferences/SystemConfiguration/com.apple.nat" into whether
+// macOS Internet Sharing is enabled and the interfaces it shares to. Only
+// the keys directly in the NAT dictionary count; the nested AirPort and
+// PrimaryInterface dictionaries have Enabled keys of their own.
+func parseNATPlist(out string) (enabled bool, devices []string) {
+	depth, inList := 0, false
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		key, val, _ := strings.Cut(line, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		switch {
+		case inList:
+			if strings.HasPrefix(line, ")") {
+				inList = false
+			} else if d := strings.Trim(line, `",`); d != "" {
+				devices = append(devices, d)
+			}
+		case depth == 2 && key == "Enabled":
+			enabled = val == "1;"
+		case depth == 2 && key == "SharingDevices":
+			list := strings.TrimSuffix(strings.TrimPrefix(val, "("), ");")
+			inList = !strings.HasSuffix(val, ");")
+			for _, d := range strings.Split(list, ",") {
+				if d = strings.Trim(strings.TrimSpace(d), `"`); d != "" {
+					devices = append(devices, d)
+				}
+			}
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+	}
+	return enabled, devices
+}
@@ -0,0 +1,110 @@
+package network
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseIWDev(t *testing.T) {
+	out := `phy#1
+	Interface wlan1
+		ifindex 5
+		wdev 0x100000001
+		addr 02:11:22:33:44:55
+		ssid torvm-hotspot
+		type AP
+		channel 6 (2437 MHz), width: 20 MHz, center1: 2437 MHz
+phy#0
+	Interface wlan0
+		ifindex 3
+		wdev 0x1
+		addr 00:11:22:33:44:55
+		ssid HomeNet
+		type managed
+`
+	if got := parseIWDev(out); !slices.Equal(got, []string{"wlan1"}) {
+		t.Errorf("parseIWDev = %v, want [wlan1]", got)
+	}
+	if got := parseIWDev(""); got != nil {
+		t.Errorf("parseIWDev(\"\") = %v, want nil", got)
+	}
+}
+
+func TestParseNATPlist(t *testing.T) {
+	tests := []struct {
+		name        string
+		out         string
+		wantEnabled bool
+		wantDevices []string
+	}{
+		{
+			name: "enabled multi-line",
+			out: `{
+    NAT =     {
+        AirPort =         {
+            Enabled = 0;
+        };
+        Enabled = 1;
+        PrimaryInterface =         {
+            Device = en0;
+            Enabled = 0;
+        };
+        SharingDevices =         (
+            en1,
+            "bridge100"
+        );
+    };
+}`,
+			wantEnabled: true,
+			wantDevices: []string{"en1", "bridge100"},
+		},
+		{
+			name: "enabled single-line",
+			out: `{
+    NAT =     {
+        Enabled = 1;
+        SharingDevices = (en5);
+    };
+}`,
+			wantEnabled: true,
+			wantDevices: []string{"en5"},
+		},
+		{
+			name: "disabled, nested enabled",
+			out: `{
+    NAT =     {
+        AirPort =         {
+            Enabled = 1;
+        };
+        Enabled = 0;
+    };
+}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enabled, devices := parseNATPlist(tt.out)
+			if enabled != tt.wantEnabled || !slices.Equal(devices, tt.wantDevices) {
+				t.Errorf("parseNATPlist = %v, %v; want %v, %v", enabled, devices, tt.wantEnabled, tt.wantDevices)
+			}
+		})
+	}
+}
+
+func TestNFTSharingRuleset(t *testing.T) {
+	got := nftSharingRuleset("torvm_failsafe_share", SharingOptions{
+		TAPName: "tap0",
+		Shared:  []SharedInterface{{Name: "wlan1", Kind: "hotspot"}, {Name: "usb0", Kind: "shared connection"}},
+	})
+	for _, want := range []string{
+		"delete table inet torvm_failsafe_share\n",
+		`iifname { "wlan1", "usb0" } oifname "tap0" accept`,
+		`iifname { "wlan1", "usb0" } drop`,
+		`iifname { "wlan1", "usb0" } oifname "tap0" masquerade`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ruleset missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// privateRanges are the RFC 1918 blocks searched for a free TAP subnet,
+// in order of preference.
+var privateRanges = []*net.IPNet{
+	{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(172, 16, 0, 0).To4(), Mask: net.CIDRMask(12, 32)},
+	{IP: net.IPv4(192, 168, 0, 0).To4(), Mask: net.CIDRMask(16, 32)},
+}
+
+// HostNetworks returns the IPv4 networks assigned to host interfaces,
+// excluding the named TAP adapter (which may still exist from a previous
+// run and would otherwise always conflict with itself).
+func HostNetworks(excludeIface string) ([]*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list interfaces: %w", err)
+	}
+	var nets []*net.IPNet
+	for _, iface := range ifaces {
+		if iface.Name == excludeIface || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			ipn, ok := a.(*net.IPNet)
+			if !ok || ipn.IP.To4() == nil {
+				continue
+			}
+			nets = append(nets, &net.IPNet{IP: ipn.IP.Mask(ipn.Mask).To4(), Mask: ipn.Mask})
+		}
+	}
+	return nets, nil
+}
+
+// SelectSubnet checks whether the subnet containing hostIP and vmIP
+// overlaps any of the used networks. If it does, it searches the RFC 1918
+// ranges for the first free subnet of the same size and returns the host
+// and VM addresses at the same offsets within it. changed reports whether
+// a different subnet was chosen.
+func SelectSubnet(hostIP, vmIP net.IP, mask net.IPMask, used []*net.IPNet) (newHost, newVM net.IP, changed bool, err error) {
+	h4, v4 := hostIP.To4(), vmIP.To4()
+	if h4 == nil || v4 == nil {
+		return nil, nil, false, fmt.Errorf("subnet selection requires IPv4 addresses")
+	}
+	ones, bits := mask.Size()
+	if bits != 32 || ones == 0 {
+		return nil, nil, false, fmt.Errorf("invalid IPv4 mask %s", mask)
+	}
+
+	current := &net.IPNet{IP: h4.Mask(mask), Mask: mask}
+	if !overlapsAny(current, used) {
+		return h4, v4, false, nil
+	}
+
+	base := binary.BigEndian.Uint32(current.IP)
+	hostOff := binary.BigEndian.Uint32(h4) - base
+	vmOff := binary.BigEndian.Uint32(v4) - base
+	step := uint32(1) << uint(32-ones)
+
+	for _, r := range privateRanges {
+		rOnes, _ := r.Mask.Size()
+		if rOnes > ones {
+			continue
+		}
+		start := binary.BigEndian.Uint32(r.IP)
+		end := start + (uint32(1) << uint(32-rOnes))
+		for n := start; n < end && n >= start; n += step {
+			candidate := &net.IPNet{IP: uint32ToIP(n), Mask: mask}
+			if overlapsAny(candidate, used) {
+				continue
+			}
+			return uint32ToIP(n + hostOff), uint32ToIP(n + vmOff), true, nil
+		}
+	}
+	return nil, nil, false, fmt.Errorf("no free private /%d subnet available", ones)
+}
+
+// overlapsAny reports whether n overlaps any network in used.
+func overlapsAny(n *net.IPNet, used []*net.IPNet) bool {
+	for _, u := range used {
+		if u.Contains(n.IP) || n.Contains(u.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func uint32ToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
@@ -0,0 +1,62 @@
+package network
+
+import (
+	"net"
+	"testing"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSelectSubnet(t *testing.T) {
+	hostIP := net.ParseIP("10.10.10.2")
+	vmIP := net.ParseIP("10.10.10.1")
+	mask := net.CIDRMask(30, 32)
+
+	tests := []struct {
+		name        string
+		used        []string
+		wantHost    string
+		wantVM      string
+		wantChanged bool
+	}{
+		{"no conflict", []string{"192.168.1.0/24"}, "10.10.10.2", "10.10.10.1", false},
+		{"corporate vpn /8", []string{"10.0.0.0/8"}, "172.16.0.2", "172.16.0.1", true},
+		{"exact overlap", []string{"10.10.10.0/30"}, "10.0.0.2", "10.0.0.1", true},
+		{"skips used candidates", []string{"10.10.0.0/16", "10.0.0.0/30"}, "10.0.0.6", "10.0.0.5", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var used []*net.IPNet
+			for _, c := range tt.used {
+				used = append(used, mustCIDR(t, c))
+			}
+			h, v, changed, err := SelectSubnet(hostIP, vmIP, mask, used)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.String() != tt.wantHost || v.String() != tt.wantVM || changed != tt.wantChanged {
+				t.Errorf("SelectSubnet = %s, %s, %v; want %s, %s, %v",
+					h, v, changed, tt.wantHost, tt.wantVM, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestSelectSubnetExhausted(t *testing.T) {
+	used := []*net.IPNet{
+		mustCIDR(t, "10.0.0.0/8"),
+		mustCIDR(t, "172.16.0.0/12"),
+		mustCIDR(t, "192.168.0.0/16"),
+	}
+	_, _, _, err := SelectSubnet(net.ParseIP("10.10.10.2"), net.ParseIP("10.10.10.1"), net.CIDRMask(30, 32), used)
+	if err == nil {
+		t.Error("expected error when all private ranges are in use")
+	}
+}
@@ -25,6 +25,67 @@ type VerifierConfig struct {
 
 	// ExpectedVMIP is the VM gateway IP that routes should point to.
 	ExpectedVMIP net.IP
+
+	// ExpectedHostIP is the host address of the TAP device. Optional;
+	// when set, outgoing traffic must also use it as source address.
+	ExpectedHostIP net.IP
+}
+
+// routeProbeTargets are public addresses, one in each half of the IPv4
+// space so split routes are both covered, whose effective route must lead
+// to the VM. They are only looked up and "dialed" over UDP, which sends
+// no packets.
+var routeProbeTargets = []net.IP{
+	net.IPv4(9, 9, 9, 9),
+	net.IPv4(149, 112, 112, 112),
+}
+
+// VerifyRoutes checks that traffic to public destinations actually goes
+// to the VM, as decided by the host's own route selection: the next hop
+// must be vmIP and, where the host end is the TAP device, the outgoing
+// device must be tapName and the source address hostIP (if non-nil). A
+// route through another interface with a lower metric fails the check.
+func VerifyRoutes(tapName string, hostIP, vmIP net.IP) error {
+	for _, dst := range routeProbeTargets {
+		gw, dev, err := effectiveRoute(dst)
+		if err != nil {
+			return err
+		}
+		if !vmIP.Equal(net.ParseIP(gw)) {
+			if gw == "" {
+				gw = "on-link"
+			}
+			return fmt.Errorf("traffic to %s leaves via %s dev %s instead of the VM at %s", dst, gw, dev, vmIP)
+		}
+		if !hostSideIsTAP {
+			continue
+		}
+		if dev != "" && dev != tapName {
+			return fmt.Errorf("traffic to %s leaves via dev %s instead of %s", dst, dev, tapName)
+		}
+		if hostIP == nil {
+			continue
+		}
+		src, err := probeSource(dst)
+		if err != nil {
+			return err
+		}
+		if !src.Equal(hostIP) {
+			return fmt.Errorf("traffic to %s would be sent from %s instead of the TAP address %s", dst, src, hostIP)
+		}
+	}
+	return nil
+}
+
+// probeSource returns the source address the host would use for dst.
+// Connecting a UDP socket performs the route lookup without sending.
+func probeSource(dst net.IP) (net.IP, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(dst.String(), "53"))
+	if err != nil {
+		return nil, fmt.Errorf("probe route to %s: %w", dst, err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
 }
 
 // RouteVerifier periodically checks that host routes and DNS still point
@@ -86,7 +147,7 @@ func (v *RouteVerifier) Start(ctx context.Context, cfg VerifierConfig) <-chan Dr
 
 func (v *RouteVerifier) check(ctx context.Context, cfg VerifierConfig, ch chan<- DriftEvent) {
 	// Platform-specific route verification.
-	if err := verifyRoutes(cfg.ExpectedTAP, cfg.ExpectedVMIP); err != nil {
+	if err := VerifyRoutes(cfg.ExpectedTAP, cfg.ExpectedHostIP, cfg.ExpectedVMIP); err != nil {
 		v.logger.Error("route drift detected: %v", err)
 		select {
 		case ch <- DriftEvent{Type: "route_drift", Description: err.Error()}:
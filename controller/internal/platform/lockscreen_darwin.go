@@ -0,0 +1,9 @@
+//go:build darwin
+
+package platform
+
+import "os/exec"
+
+func lockScreen() error {
+	return exec.Command("pmset", "displaysleepnow").Run()
+}
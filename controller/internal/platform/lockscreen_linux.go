@@ -0,0 +1,24 @@
+//go:build linux
+
+package platform
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func lockScreen() error {
+	arg := "lock-session"
+	if elevated() {
+		// root has no session of its own: lock the users'.
+		arg = "lock-sessions"
+	}
+	err := exec.Command("loginctl", arg).Run()
+	if err == nil {
+		return nil
+	}
+	if err2 := exec.Command("xdg-screensaver", "lock").Run(); err2 != nil {
+		return errors.Join(err, err2)
+	}
+	return nil
+}
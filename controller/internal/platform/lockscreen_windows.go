@@ -0,0 +1,14 @@
+//go:build windows
+
+package platform
+
+import "golang.org/x/sys/windows"
+
+var procLockWorkStation = windows.NewLazySystemDLL("user32.dll").NewProc("LockWorkStation")
+
+func lockScreen() error {
+	if r, _, err := procLockWorkStation.Call(); r == 0 {
+		return err
+	}
+	return nil
+}
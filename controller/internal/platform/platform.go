@@ -39,6 +39,37 @@ func DetectAccel() (*Info, error) {
 	return Detect()
 }
 
+// Elevated reports whether the process has the privileges TorVM needs to
+// change the host network: root on Linux and macOS, an elevated
+// (Administrator) token on Windows.
+func Elevated() bool {
+	return elevated()
+}
+
+// ProcessStart returns when process pid started, as an opaque string
+// that differs for a later process given the same PID, even after a
+// reboot: the boot ID and start time on Linux, the start time on macOS
+// and Windows. It fails if pid is not running.
+func ProcessStart(pid int) (string, error) {
+	start, err := processStart(pid)
+	if err != nil {
+		return "", fmt.Errorf("process %d: %w", pid, err)
+	}
+	return start, nil
+}
+
+// LockScreen locks the desktop session, as the emergency stop may. On
+// Linux it asks logind (every session when run as root), falling back to
+// xdg-screensaver; on macOS it sleeps the display, which locks it when a
+// password is required at once after sleep; on Windows it locks the
+// workstation.
+func LockScreen() error {
+	if err := lockScreen(); err != nil {
+		return fmt.Errorf("lock screen: %w", err)
+	}
+	return nil
+}
+
 // ParseAccel converts a user-supplied string to an AccelType.
 func ParseAccel(s string) (AccelType, error) {
 	switch s {
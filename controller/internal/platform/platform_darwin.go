@@ -3,6 +3,7 @@
 package platform
 
 import (
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -22,6 +23,10 @@ func detect() (*Info, error) {
 	return info, nil
 }
 
+func elevated() bool {
+	return os.Geteuid() == 0
+}
+
 func detectAccel() (AccelType, error) {
 	info, _ := detect()
 	return info.Accel, nil
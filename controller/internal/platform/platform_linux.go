@@ -31,6 +31,10 @@ func detect() (*Info, error) {
 	return info, nil
 }
 
+func elevated() bool {
+	return os.Geteuid() == 0
+}
+
 func detectAccel() (AccelType, error) {
 	info, _ := detect()
 	return info.Accel, nil
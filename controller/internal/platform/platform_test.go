@@ -1,6 +1,8 @@
 package platform
 
 import (
+	"os"
+	"os/exec"
 	"testing"
 )
 
@@ -51,3 +53,21 @@ func TestDetectReturnsNonNil(t *testing.T) {
 		t.Errorf("Detect returned unknown accel: %q", info.Accel)
 	}
 }
+
+func TestProcessStart(t *testing.T) {
+	a, err := ProcessStart(os.Getpid())
+	if err != nil || a == "" {
+		t.Fatalf("ProcessStart(self) = %q, %v", a, err)
+	}
+	if b, _ := ProcessStart(os.Getpid()); b != a {
+		t.Errorf("ProcessStart changed: %q, then %q", a, b)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := ProcessStart(cmd.Process.Pid); err == nil {
+		t.Errorf("ProcessStart of an exited process = %q, want an error", s)
+	}
+}
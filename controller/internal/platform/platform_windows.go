@@ -5,6 +5,8 @@ package platform
 import (
 	"os/exec"
 	"strings"
+
+	"golang.org/x/sys/windows"
 )
 
 func detect() (*Info, error) {
@@ -24,6 +26,10 @@ func detect() (*Info, error) {
 	return info, nil
 }
 
+func elevated() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
+
 func detectAccel() (AccelType, error) {
 	info, _ := detect()
 	return info.Accel, nil
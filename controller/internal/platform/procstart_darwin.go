@@ -0,0 +1,25 @@
+//go:build darwin
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// szomb is the p_stat of a zombie process.
+const szomb = 5
+
+func processStart(pid int) (string, error) {
+	kp, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return "", err
+	}
+	if int(kp.Proc.P_pid) != pid || kp.Proc.P_stat == szomb {
+		return "", errors.New("process is not running")
+	}
+	t := kp.Proc.P_starttime
+	return fmt.Sprintf("%d.%06d", t.Sec, t.Usec), nil
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package platform
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func processStart(pid int) (string, error) {
+	boot, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", err
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", err
+	}
+	// The command name, in parentheses, may hold spaces; the fields
+	// after it start with the state, and the start time is the 20th.
+	i := strings.LastIndex(string(stat), ") ")
+	if i < 0 {
+		return "", errors.New("unexpected /proc stat format")
+	}
+	fields := strings.Fields(string(stat)[i+2:])
+	if len(fields) < 20 {
+		return "", errors.New("unexpected /proc stat format")
+	}
+	if fields[0] == "Z" || fields[0] == "X" {
+		return "", errors.New("process has exited")
+	}
+	return strings.TrimSpace(string(boot)) + ":" + fields[19], nil
+}
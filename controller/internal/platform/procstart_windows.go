@@ -0,0 +1,36 @@
+//go:build windows
+
+package platform
+
+import (
+	"errors"
+	"strconv"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code GetExitCodeProcess reports for a process
+// that is running.
+const stillActive = 259
+
+func processStart(pid int) (string, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(h)
+	// A process that has exited can be opened while others hold handles
+	// to it.
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return "", err
+	}
+	if code != stillActive {
+		return "", errors.New("process has exited")
+	}
+	var created, exited, kernel, user windows.Filetime
+	if err := windows.GetProcessTimes(h, &created, &exited, &kernel, &user); err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(created.Nanoseconds(), 10), nil
+}
@@ -0,0 +1,213 @@
+// Package poll runs the periodic status checks behind the GUI (service
+// manager status, circuit lists, and the like) from a single goroutine.
+// Each check has its own interval; checks that need the VM, and checks
+// that fail, back off exponentially until the VM is up or the check
+// succeeds again.
+package poll
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// Task is a periodic check.
+type Task struct {
+	Name     string
+	Interval time.Duration
+	// NeedsVM marks checks that are pointless while the VM is down; they
+	// are skipped and backed off instead of run.
+	NeedsVM bool
+	Run     func(ctx context.Context) error
+}
+
+type entry struct {
+	task     Task
+	interval time.Duration // current interval, Task.Interval unless backed off
+	next     time.Time
+	removed  bool
+}
+
+// Coordinator schedules registered tasks. Tasks run one at a time, so a
+// slow check delays the others rather than piling up goroutines.
+type Coordinator struct {
+	vmUp       func() bool
+	maxBackoff time.Duration
+	logger     *logging.Logger
+	clock      clock.Clock // replaceable in tests
+
+	mu      sync.Mutex
+	entries []*entry
+	wake    chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a coordinator. vmUp reports whether the VM is running;
+// backed-off intervals never exceed maxBackoff.
+func New(vmUp func() bool, maxBackoff time.Duration, logger *logging.Logger) *Coordinator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Coordinator{
+		vmUp:       vmUp,
+		maxBackoff: maxBackoff,
+		logger:     logger,
+		clock:      clock.Real,
+		wake:       make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Handle controls a registered task.
+type Handle struct {
+	c *Coordinator
+	e *entry
+}
+
+// Add registers t. Its first run is due after one interval; callers that
+// want an immediate result run the check themselves or call Kick.
+func (c *Coordinator) Add(t Task) *Handle {
+	e := &entry{task: t, interval: t.Interval, next: c.clock.Now().Add(t.Interval)}
+	c.mu.Lock()
+	c.entries = append(c.entries, e)
+	c.mu.Unlock()
+	c.poke()
+	return &Handle{c: c, e: e}
+}
+
+// Remove unregisters the task. It is safe to call from the task itself
+// and more than once.
+func (h *Handle) Remove() {
+	c := h.c
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h.e.removed = true
+	for i, e := range c.entries {
+		if e == h.e {
+			c.entries = append(c.entries[:i], c.entries[i+1:]...)
+			break
+		}
+	}
+}
+
+// Kick runs the task as soon as possible and resets any backoff, e.g.
+// after the user started the VM or the service.
+func (h *Handle) Kick() {
+	c := h.c
+	c.mu.Lock()
+	h.e.interval = h.e.task.Interval
+	h.e.next = c.clock.Now()
+	c.mu.Unlock()
+	c.poke()
+}
+
+// Len returns the number of registered tasks.
+func (c *Coordinator) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Start begins running tasks in the background.
+func (c *Coordinator) Start() {
+	go c.loop()
+}
+
+// Stop stops the coordinator and cancels the context of a running task.
+func (c *Coordinator) Stop() {
+	c.cancel()
+}
+
+func (c *Coordinator) poke() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Coordinator) loop() {
+	timer := c.clock.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		wait := c.step()
+		if wait <= 0 {
+			continue
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C():
+		case <-c.wake:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// step runs the tasks that are due and returns how long to wait for the
+// next one. A zero return means more tasks became due meanwhile.
+func (c *Coordinator) step() time.Duration {
+	for _, e := range c.due() {
+		if c.ctx.Err() != nil {
+			return time.Hour
+		}
+		c.run(e)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	wait := time.Hour
+	for _, e := range c.entries {
+		if d := e.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return max(wait, 0)
+}
+
+func (c *Coordinator) due() []*entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	var due []*entry
+	for _, e := range c.entries {
+		if !e.next.After(now) {
+			due = append(due, e)
+		}
+	}
+	return due
+}
+
+func (c *Coordinator) run(e *entry) {
+	c.mu.Lock()
+	removed := e.removed
+	c.mu.Unlock()
+	if removed {
+		return
+	}
+
+	var err error
+	skipped := e.task.NeedsVM && !c.vmUp()
+	if !skipped {
+		err = e.task.Run(c.ctx)
+		if err != nil && c.ctx.Err() == nil {
+			c.logger.Debug("poll: %s: %v", e.task.Name, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e.removed {
+		return
+	}
+	if skipped || err != nil {
+		e.interval = min(e.interval*2, max(c.maxBackoff, e.task.Interval))
+	} else {
+		e.interval = e.task.Interval
+	}
+	e.next = c.clock.Now().Add(e.interval)
+}
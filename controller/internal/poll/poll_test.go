@@ -0,0 +1,100 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func newTestCoordinator(vmUp *bool) (*Coordinator, *clock.Fake) {
+	logger, _ := testutil.NewTestLogger()
+	c := New(func() bool { return *vmUp }, 40*time.Second, logger)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	c.clock = clk
+	return c, clk
+}
+
+func TestStepIntervals(t *testing.T) {
+	up := true
+	c, clk := newTestCoordinator(&up)
+	var fast, slow int
+	c.Add(Task{Name: "fast", Interval: 5 * time.Second, Run: func(context.Context) error { fast++; return nil }})
+	c.Add(Task{Name: "slow", Interval: 15 * time.Second, Run: func(context.Context) error { slow++; return nil }})
+
+	if wait := c.step(); wait != 5*time.Second || fast+slow != 0 {
+		t.Fatalf("first step: wait = %v, runs = %d, %d; want 5s, nothing run", wait, fast, slow)
+	}
+	for i := 0; i < 3; i++ {
+		clk.Advance(5 * time.Second)
+		c.step()
+	}
+	if fast != 3 || slow != 1 {
+		t.Errorf("runs after 15s = %d, %d; want 3, 1", fast, slow)
+	}
+}
+
+func TestStepBackoff(t *testing.T) {
+	up := false
+	c, clk := newTestCoordinator(&up)
+	var runs int
+	var fail error
+	h := c.Add(Task{Name: "circuits", Interval: 5 * time.Second, NeedsVM: true, Run: func(context.Context) error {
+		runs++
+		return fail
+	}})
+
+	// VM down: skipped, interval doubles up to the 40s ceiling.
+	clk.Advance(5 * time.Second)
+	for _, want := range []time.Duration{10, 20, 40, 40} {
+		if wait := c.step(); wait != want*time.Second {
+			t.Fatalf("wait = %v, want %v", wait, want*time.Second)
+		}
+		clk.Advance(want * time.Second)
+	}
+	if runs != 0 {
+		t.Fatalf("task ran %d times while VM down", runs)
+	}
+
+	// VM up: runs and returns to its base interval.
+	up = true
+	if wait := c.step(); wait != 5*time.Second || runs != 1 {
+		t.Fatalf("after VM up: wait = %v, runs = %d", wait, runs)
+	}
+
+	// Errors back off too.
+	fail = errors.New("control port closed")
+	clk.Advance(5 * time.Second)
+	if wait := c.step(); wait != 10*time.Second {
+		t.Errorf("wait after error = %v, want 10s", wait)
+	}
+
+	// Kick makes the task due now at its base interval.
+	fail = nil
+	h.Kick()
+	if wait := c.step(); wait != 5*time.Second || runs != 3 {
+		t.Errorf("after kick: wait = %v, runs = %d", wait, runs)
+	}
+}
+
+func TestRemoveFromTask(t *testing.T) {
+	up := true
+	c, clk := newTestCoordinator(&up)
+	var runs int
+	var h *Handle
+	h = c.Add(Task{Name: "once", Interval: time.Second, Run: func(context.Context) error {
+		runs++
+		h.Remove()
+		return nil
+	}})
+	clk.Advance(time.Second)
+	c.step()
+	clk.Advance(time.Minute)
+	c.step()
+	if runs != 1 || c.Len() != 0 {
+		t.Errorf("runs = %d, Len = %d; want 1, 0", runs, c.Len())
+	}
+}
@@ -0,0 +1,31 @@
+//go:build darwin
+
+package privexec
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// elevatedScript runs ops as root through osascript's "do shell script
+// ... with administrator privileges", which asks for an administrator's
+// password. do shell script returns only stdout, so stderr is sent there
+// too: pfctl -E, for one, prints its token on stderr.
+func elevatedScript(ops []Op) (*exec.Cmd, func(), error) {
+	dir, cleanup, err := writeStdin(ops)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	script := fmt.Sprintf(`do shell script "%s" with administrator privileges`,
+		escapeAppleScript("exec 2>&1; "+scriptString(ops, dir)))
+	return exec.Command("osascript", "-e", script), cleanup, nil
+}
+
+// escapeAppleScript escapes s for an AppleScript string literal.
+// Backslashes go first, so the ones escaping quotes stay single.
+func escapeAppleScript(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return s
+}
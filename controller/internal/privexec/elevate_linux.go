@@ -0,0 +1,22 @@
+//go:build linux
+
+package privexec
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// elevatedScript runs ops as root through pkexec, which asks for
+// authorization with the desktop's polkit agent.
+func elevatedScript(ops []Op) (*exec.Cmd, func(), error) {
+	pkexec, err := exec.LookPath("pkexec")
+	if err != nil {
+		return nil, func() {}, fmt.Errorf("privexec: not running as root and pkexec is not available: %w", err)
+	}
+	dir, cleanup, err := writeStdin(ops)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	return exec.Command(pkexec, "/bin/sh", "-c", scriptString(ops, dir)), cleanup, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !windows
+
+package privexec
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func elevatedScript([]Op) (*exec.Cmd, func(), error) {
+	return nil, func() {}, fmt.Errorf("privexec: not running as root and no elevation tool on this platform")
+}
@@ -0,0 +1,65 @@
+//go:build windows
+
+package privexec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode/utf16"
+)
+
+// elevatedScript runs ops in an elevated PowerShell, started with
+// Start-Process -Verb RunAs, which shows the UAC prompt. The elevated
+// process has no console of ours, so only its exit code comes back.
+func elevatedScript(ops []Op) (*exec.Cmd, func(), error) {
+	dir, cleanup, err := writeStdin(ops)
+	if err != nil {
+		return nil, cleanup, err
+	}
+	inner := encodePowerShell(powerShellScript(ops, dir))
+	outer := fmt.Sprintf(
+		"$p = Start-Process -FilePath powershell -Verb RunAs -Wait -PassThru -WindowStyle Hidden "+
+			"-ArgumentList '-NoProfile','-NonInteractive','-EncodedCommand','%s'; exit $p.ExitCode", inner)
+	return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", outer), cleanup, nil
+}
+
+// powerShellScript runs ops in order and exits with the exit code of the
+// first that fails, unless it is marked MayFail.
+func powerShellScript(ops []Op, dir string) string {
+	var b strings.Builder
+	for i, op := range ops {
+		line := "& " + psQuote(op.Program)
+		for _, a := range op.Args {
+			line += " " + psQuote(a)
+		}
+		if op.Stdin != "" {
+			line = "Get-Content -Raw -LiteralPath " + psQuote(stdinPath(dir, i)) + " | " + line
+		}
+		if op.Dir != "" {
+			line = "Push-Location -LiteralPath " + psQuote(op.Dir) + "; " + line + "; Pop-Location"
+		}
+		b.WriteString(line + "\n")
+		if !op.MayFail {
+			b.WriteString("if ($LASTEXITCODE -ne 0) { exit $LASTEXITCODE }\n")
+		}
+	}
+	b.WriteString("exit 0\n")
+	return b.String()
+}
+
+// psQuote quotes s as a PowerShell verbatim string.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// encodePowerShell encodes script for -EncodedCommand: base64 of UTF-16LE.
+func encodePowerShell(script string) string {
+	units := utf16.Encode([]rune(script))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,476 @@
+// Package privexec runs the commands that change the host: network
+// configuration, firewall rules, DNS, and service registration. Each is an
+// Op, a program and its arguments rather than a shell string, and all go
+// through one Runner, which validates them, runs them directly when the
+// controller is privileged or through the platform's elevation tool
+// (pkexec, osascript, or an elevated PowerShell) otherwise, and reports
+// each to an audit hook. A dry run reports the ops without running them.
+// An Elevator, such as the macOS privileged helper, can take the place of
+// the elevation tool so the user is not asked for a password each time.
+//
+// Read-only queries, such as listing routes, do not change the host and
+// are run with os/exec directly.
+package privexec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+// Op is one privileged command.
+type Op struct {
+	Program string // looked up on PATH, or an absolute path
+	Args    []string
+	Stdin   string // e.g. an nftables script; "" for none
+	Dir     string // working directory; "" for the current one
+
+	// MayFail marks a best-effort step: in RunAll its failure neither
+	// stops the steps after it nor is reported.
+	MayFail bool
+}
+
+// Command returns the Op that runs program with args.
+func Command(program string, args ...string) Op {
+	return Op{Program: program, Args: args}
+}
+
+// String returns the op as a shell would read it, for logs.
+func (op Op) String() string {
+	s := op.commandLine()
+	if op.Stdin != "" {
+		s += fmt.Sprintf(" <<(%d bytes)", len(op.Stdin))
+	}
+	return s
+}
+
+// commandLine quotes the program and its arguments for a POSIX shell.
+func (op Op) commandLine() string {
+	words := make([]string, 0, len(op.Args)+1)
+	words = append(words, shellQuote(op.Program))
+	for _, a := range op.Args {
+		words = append(words, shellQuote(a))
+	}
+	return strings.Join(words, " ")
+}
+
+// Record is what the audit hook learns of each op.
+type Record struct {
+	Time     time.Time
+	Op       Op
+	Elevated bool // run through the elevation tool
+	DryRun   bool // not run
+	Err      error
+}
+
+func (r Record) String() string {
+	s := r.Op.String()
+	switch {
+	case r.DryRun:
+		s = "would run: " + s
+	case r.Elevated:
+		s = "ran elevated: " + s
+	default:
+		s = "ran: " + s
+	}
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
+
+// Elevator runs ops as root for a controller that is not, in place of
+// the platform's elevation tool.
+type Elevator interface {
+	// RunOps runs ops in order like Runner.RunAll and returns the
+	// combined output of a single op. It returns an error wrapping
+	// ErrNoElevator if it cannot run them at all, and the Runner then
+	// falls back to the elevation tool.
+	RunOps(ops []Op) (string, error)
+}
+
+// ErrNoElevator is wrapped by the error of an Elevator that is not
+// available, such as a helper that is not installed or not running.
+var ErrNoElevator = errors.New("privexec: elevator not available")
+
+// Runner runs ops. The zero value runs them, elevating when needed.
+type Runner struct {
+	mu       sync.Mutex
+	dryRun   bool
+	audit    func(Record)
+	elevator Elevator
+
+	privileged func() bool                     // replaceable in tests
+	exec       func(*exec.Cmd) ([]byte, error) // replaceable in tests
+}
+
+// Default is the runner the packages that change the host use.
+var Default = &Runner{}
+
+// SetDryRun makes r report ops to the audit hook without running them,
+// or run them again.
+func (r *Runner) SetDryRun(on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dryRun = on
+}
+
+// SetElevator makes r run the ops that need elevation through el, or
+// through the elevation tool again if el is nil.
+func (r *Runner) SetElevator(el Elevator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.elevator = el
+}
+
+// SetAudit sets the hook called after each op, or removes it if fn is
+// nil. fn must not block.
+func (r *Runner) SetAudit(fn func(Record)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.audit = fn
+}
+
+// Run runs program with args on Default.
+func Run(program string, args ...string) error {
+	return Default.Run(Command(program, args...))
+}
+
+// RunOp runs op on Default.
+func RunOp(op Op) error {
+	return Default.Run(op)
+}
+
+// Output runs op on Default and returns its combined output.
+func Output(op Op) (string, error) {
+	return Default.Output(op)
+}
+
+// RunAll runs ops in order on Default; see Runner.RunAll.
+func RunAll(ops ...Op) error {
+	return Default.RunAll(ops...)
+}
+
+// CheckAccess checks Default; see Runner.CheckAccess.
+func CheckAccess() error {
+	return Default.CheckAccess()
+}
+
+// ErrNoAccess is returned by CheckAccess when neither the controller nor
+// an elevator can change the host network.
+var ErrNoAccess = errors.New("privexec: not privileged to change the host network, and no helper answers")
+
+// CheckAccess reports whether r can make the changes a VM run needs
+// without asking for authorization at each: it is privileged (root, or
+// an elevated Administrator on Windows), or its elevator answers. The
+// elevation tool alone is not enough, as a run makes too many changes.
+func (r *Runner) CheckAccess() error {
+	_, elevate, el := r.mode()
+	return Access(!elevate, el)
+}
+
+// Access is CheckAccess for a controller that is privileged or not and
+// has the elevator el, or nil.
+func Access(privileged bool, el Elevator) error {
+	if privileged {
+		return nil
+	}
+	if el != nil {
+		if _, err := el.RunOps(nil); !errors.Is(err, ErrNoElevator) {
+			return nil
+		}
+	}
+	return ErrNoAccess
+}
+
+// Run runs op. Its error names the command and holds its output.
+func (r *Runner) Run(op Op) error {
+	_, err := r.Output(op)
+	return err
+}
+
+// Output runs op and returns its combined stdout and stderr. In a dry run
+// it returns "".
+func (r *Runner) Output(op Op) (string, error) {
+	if err := validate(op); err != nil {
+		return "", err
+	}
+	dryRun, elevate, el := r.mode()
+	rec := Record{Op: op, DryRun: dryRun, Elevated: elevate && !dryRun}
+	if !dryRun && el != nil {
+		if out, err := el.RunOps([]Op{op}); !errors.Is(err, ErrNoElevator) {
+			rec.Err = err
+			r.report(rec)
+			return out, err
+		}
+	}
+	var out []byte
+	if !dryRun {
+		cmd, cleanup, err := r.command(op, elevate)
+		if err == nil {
+			out, err = r.run(cmd)
+			cleanup()
+			if err != nil {
+				err = fmt.Errorf("%s %v: %s: %w", op.Program, op.Args, strings.TrimSpace(string(out)), err)
+			}
+		}
+		rec.Err = err
+	}
+	r.report(rec)
+	return string(out), rec.Err
+}
+
+// RunAll runs ops in order and stops at the first that fails, unless it
+// is marked MayFail. When elevation is needed, the ops go to the Elevator
+// in one request, or run as one script so that the user is asked only
+// once.
+func (r *Runner) RunAll(ops ...Op) error {
+	for _, op := range ops {
+		if err := validate(op); err != nil {
+			return err
+		}
+	}
+	dryRun, elevate, el := r.mode()
+	if dryRun || !elevate || len(ops) < 2 {
+		for _, op := range ops {
+			if err := r.Run(op); err != nil && !op.MayFail {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if el != nil {
+		_, err = el.RunOps(ops)
+	}
+	if el == nil || errors.Is(err, ErrNoElevator) {
+		err = r.runScript(ops)
+	}
+	for i, op := range ops {
+		rec := Record{Op: op, Elevated: true}
+		if i == len(ops)-1 {
+			rec.Err = err // the script reports only that some step failed
+		}
+		r.report(rec)
+	}
+	return err
+}
+
+// runScript runs ops as one script through the elevation tool.
+func (r *Runner) runScript(ops []Op) error {
+	cmd, cleanup, err := elevatedScript(ops)
+	if err == nil {
+		var out []byte
+		out, err = r.run(cmd)
+		cleanup()
+		if err != nil {
+			err = fmt.Errorf("privexec: %d commands: %s: %w", len(ops), strings.TrimSpace(string(out)), err)
+		}
+	}
+	return err
+}
+
+// mode returns whether r is in a dry run, whether ops need elevation,
+// and the elevator to use for them, if any.
+func (r *Runner) mode() (dryRun, elevate bool, el Elevator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	privileged := platform.Elevated
+	if r.privileged != nil {
+		privileged = r.privileged
+	}
+	elevate = !privileged()
+	if elevate {
+		el = r.elevator
+	}
+	return r.dryRun, elevate, el
+}
+
+func (r *Runner) report(rec Record) {
+	rec.Time = time.Now()
+	r.mu.Lock()
+	audit := r.audit
+	r.mu.Unlock()
+	if audit != nil {
+		audit(rec)
+	}
+}
+
+// command builds the process for op, wrapped in the elevation tool if
+// elevate is set.
+func (r *Runner) command(op Op, elevate bool) (cmd *exec.Cmd, cleanup func(), err error) {
+	if elevate {
+		return elevatedScript([]Op{op})
+	}
+	cmd = exec.Command(op.Program, op.Args...)
+	if op.Stdin != "" {
+		cmd.Stdin = strings.NewReader(op.Stdin)
+	}
+	cmd.Dir = op.Dir
+	return cmd, func() {}, nil
+}
+
+func (r *Runner) run(cmd *exec.Cmd) ([]byte, error) {
+	if r.exec != nil {
+		return r.exec(cmd)
+	}
+	return cmd.CombinedOutput()
+}
+
+// allowedPrograms are the programs an Op may run, by base name without
+// ".exe". Anything else is a programming error.
+var allowedPrograms = map[string]bool{
+	// Linux
+	"ip": true, "nft": true, "resolvectl": true, "systemctl": true,
+	"install": true, "rm": true,
+	// macOS
+	"route": true, "pfctl": true, "networksetup": true, "dscacheutil": true,
+	"killall": true, "launchctl": true, "PlistBuddy": true,
+	"mkdir": true, "cp": true, "chmod": true,
+	// Windows
+	"netsh": true, "ipconfig": true, "powershell": true,
+	"addtap.bat": true, "deltapall.bat": true,
+}
+
+// systemDirs returns the directories a program given by absolute path
+// may be in: the system's own, which only an administrator can write
+// to, and on Windows the TAP-Windows scripts' directory.
+func systemDirs() []string {
+	if runtime.GOOS != "windows" {
+		return []string{"/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/libexec"}
+	}
+	root := os.Getenv("SystemRoot")
+	if root == "" {
+		root = `C:\Windows`
+	}
+	dirs := []string{
+		filepath.Join(root, "System32"),
+		filepath.Join(root, "System32", "WindowsPowerShell", "v1.0"),
+	}
+	for _, pf := range []string{
+		os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)"),
+		`C:\Program Files`, `C:\Program Files (x86)`,
+	} {
+		if pf != "" {
+			dirs = append(dirs, filepath.Join(pf, "TAP-Windows", "bin"))
+		}
+	}
+	return dirs
+}
+
+// inSystemDir reports whether the absolute path program is in one of
+// systemDirs.
+func inSystemDir(program string) bool {
+	dir := filepath.Dir(filepath.Clean(program))
+	for _, d := range systemDirs() {
+		if dir == d || runtime.GOOS == "windows" && strings.EqualFold(dir, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks op before it runs: a known program, given by name or
+// by its path in a system directory, and no argument that could end a
+// command or a line when an elevation tool has to pass the op through a
+// script.
+func validate(op Op) error {
+	name := filepath.Base(op.Program)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	}
+	if op.Program != name && !filepath.IsAbs(op.Program) {
+		return fmt.Errorf("privexec: %q must be a program name or an absolute path", op.Program)
+	}
+	if !allowedPrograms[name] {
+		return fmt.Errorf("privexec: %q is not an allowed program", op.Program)
+	}
+	if op.Program != name && !inSystemDir(op.Program) {
+		return fmt.Errorf("privexec: %q is not in a system directory", op.Program)
+	}
+	for _, a := range op.Args {
+		if strings.ContainsAny(a, "\x00\r\n") {
+			return fmt.Errorf("privexec: %s: argument %q contains a control character", name, a)
+		}
+	}
+	if strings.ContainsRune(op.Stdin, 0) {
+		return fmt.Errorf("privexec: %s: input contains a NUL byte", name)
+	}
+	return nil
+}
+
+// safeWordRe matches words a POSIX shell reads as they are.
+var safeWordRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	if safeWordRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// scriptString joins ops into one POSIX shell command line that stops at
+// the first failing op not marked MayFail. An op's input is read from the
+// file stdin-<i> in dir, which writeStdin creates.
+func scriptString(ops []Op, dir string) string {
+	var b strings.Builder
+	for i, op := range ops {
+		if i > 0 {
+			b.WriteString(" && ")
+		}
+		cmd := op.commandLine()
+		if op.Stdin != "" {
+			cmd += " < " + shellQuote(stdinPath(dir, i))
+		}
+		if op.Dir != "" {
+			cmd = "cd " + shellQuote(op.Dir) + " && " + cmd
+		}
+		if op.MayFail {
+			cmd = "{ " + cmd + " || true; }"
+		} else if op.Dir != "" {
+			cmd = "( " + cmd + " )"
+		}
+		b.WriteString(cmd)
+	}
+	return b.String()
+}
+
+func stdinPath(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("stdin-%d", i))
+}
+
+// writeStdin writes the input of each op that has one to a file in a new
+// temporary directory, for an elevated script to read. It returns "" if
+// no op has input.
+func writeStdin(ops []Op) (dir string, cleanup func(), err error) {
+	cleanup = func() {}
+	if !slices.ContainsFunc(ops, func(op Op) bool { return op.Stdin != "" }) {
+		return "", cleanup, nil
+	}
+	dir, err = os.MkdirTemp("", "torvm-privexec-")
+	if err != nil {
+		return "", cleanup, fmt.Errorf("privexec: %w", err)
+	}
+	for i, op := range ops {
+		if op.Stdin == "" {
+			continue
+		}
+		if err := os.WriteFile(stdinPath(dir, i), []byte(op.Stdin), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", cleanup, fmt.Errorf("privexec: %w", err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }, nil
+}
@@ -0,0 +1,223 @@
+package privexec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testRunner returns a runner that records the commands it would start
+// instead of starting them, running as root if privileged.
+func testRunner(privileged bool, fail string) (*Runner, *[]*exec.Cmd, *[]Record) {
+	var cmds []*exec.Cmd
+	var recs []Record
+	r := &Runner{
+		privileged: func() bool { return privileged },
+		exec: func(cmd *exec.Cmd) ([]byte, error) {
+			cmds = append(cmds, cmd)
+			if fail != "" && strings.Contains(strings.Join(cmd.Args, " "), fail) {
+				return []byte("no such device"), errors.New("exit status 1")
+			}
+			return []byte("ok"), nil
+		},
+	}
+	r.SetAudit(func(rec Record) { recs = append(recs, rec) })
+	return r, &cmds, &recs
+}
+
+func TestRunDirect(t *testing.T) {
+	r, cmds, recs := testRunner(true, "")
+	op := Command("nft", "-f", "-")
+	op.Stdin = "flush ruleset\n"
+	out, err := r.Output(op)
+	if err != nil || out != "ok" {
+		t.Fatalf("Output = %q, %v", out, err)
+	}
+	if len(*cmds) != 1 || strings.Join((*cmds)[0].Args, " ") != "nft -f -" || (*cmds)[0].Stdin == nil {
+		t.Errorf("ran %v, want nft -f - with input", (*cmds)[0].Args)
+	}
+	if len(*recs) != 1 || (*recs)[0].Elevated || (*recs)[0].DryRun || (*recs)[0].Time.IsZero() {
+		t.Errorf("audit records = %+v", *recs)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	r, _, recs := testRunner(true, "tap0")
+	err := r.Run(Command("ip", "link", "delete", "tap0"))
+	if err == nil || !strings.Contains(err.Error(), "ip [link delete tap0]: no such device") {
+		t.Errorf("err = %v, want the command and its output", err)
+	}
+	if len(*recs) != 1 || (*recs)[0].Err == nil {
+		t.Errorf("audit records = %+v, want the failure", *recs)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	r, cmds, recs := testRunner(false, "")
+	r.SetDryRun(true)
+	if err := r.RunAll(Command("ip", "route", "del", "default"), Command("rm", "-f", "/etc/x")); err != nil {
+		t.Fatal(err)
+	}
+	if len(*cmds) != 0 {
+		t.Errorf("a dry run started %d commands", len(*cmds))
+	}
+	if len(*recs) != 2 || !(*recs)[0].DryRun || (*recs)[1].String() != "would run: rm -f /etc/x" {
+		t.Errorf("audit records = %v", *recs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r, cmds, recs := testRunner(true, "")
+	for _, op := range []Op{
+		Command("sh", "-c", "reboot"),
+		Command("./ip", "link"),
+		Command("/tmp/x/ip", "link"),
+		Command("/usr/bin/../../tmp/ip", "link"),
+		Command("ip", "link", "set", "tap0\nreboot"),
+		{Program: "nft", Stdin: "a\x00b"},
+	} {
+		if err := r.Run(op); err == nil {
+			t.Errorf("Run(%s) succeeded, want it refused", op)
+		}
+	}
+	if err := r.RunAll(Command("ip", "link"), Command("sh")); err == nil {
+		t.Errorf("RunAll ran a script with a refused op")
+	}
+	if len(*cmds) != 0 || len(*recs) != 0 {
+		t.Errorf("refused ops ran: %d commands, %d records", len(*cmds), len(*recs))
+	}
+	if err := r.Run(Command("/usr/libexec/PlistBuddy", "-c", "Set :RunAtLoad true")); err != nil {
+		t.Errorf("absolute path refused: %v", err)
+	}
+}
+
+func TestRunAllDirectStopsAtFailure(t *testing.T) {
+	r, cmds, _ := testRunner(true, "disable")
+	stop := Command("systemctl", "stop", "torvm.service")
+	disable := Command("systemctl", "disable", "torvm.service")
+	disable.MayFail = true
+	err := r.RunAll(stop, disable, Command("rm", "-f", "/etc/x"), Command("systemctl", "daemon-reload"))
+	if err != nil || len(*cmds) != 4 {
+		t.Errorf("RunAll = %v after %d commands, want MayFail to continue", err, len(*cmds))
+	}
+
+	r, cmds, _ = testRunner(true, "install")
+	err = r.RunAll(Command("install", "-m", "0644", "a", "b"), Command("systemctl", "enable", "x"))
+	if err == nil || len(*cmds) != 1 {
+		t.Errorf("RunAll = %v after %d commands, want it to stop at the failure", err, len(*cmds))
+	}
+}
+
+func TestScriptString(t *testing.T) {
+	unload := Command("launchctl", "unload", "/Library/LaunchDaemons/it's.plist")
+	unload.MayFail = true
+	load := Command("pfctl", "-a", "com.apple/torvm", "-f", "-")
+	load.Stdin = "block all\n"
+	tap := Command(`C:\TAP\addtap.bat`)
+	tap.Dir = "/opt/tap bin"
+	got := scriptString([]Op{unload, load, tap}, "/tmp/d")
+	want := `{ launchctl unload '/Library/LaunchDaemons/it'\''s.plist' || true; } && ` +
+		`pfctl -a com.apple/torvm -f - < ` + shellQuote(stdinPath("/tmp/d", 1)) + ` && ` +
+		`( cd '/opt/tap bin' && 'C:\TAP\addtap.bat' )`
+	if got != want {
+		t.Errorf("scriptString =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestScriptRuns(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	cp := Command("cp", "/dev/stdin", out)
+	cp.Stdin = "it's $HOME `x`\n"
+	rm := Command("rm", filepath.Join(dir, "missing"))
+	rm.MayFail = true
+	ops := []Op{rm, cp}
+
+	stdin, cleanup, err := writeStdin(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if b, err := exec.Command("sh", "-c", scriptString(ops, stdin)).CombinedOutput(); err != nil {
+		t.Fatalf("script: %v: %s", err, b)
+	}
+	if b, _ := os.ReadFile(out); string(b) != cp.Stdin {
+		t.Errorf("input = %q, want %q", b, cp.Stdin)
+	}
+}
+
+// fakeElevator records the ops it is asked to run.
+type fakeElevator struct {
+	calls [][]Op
+	err   error
+}
+
+func (f *fakeElevator) RunOps(ops []Op) (string, error) {
+	f.calls = append(f.calls, ops)
+	if f.err != nil {
+		return "", f.err
+	}
+	return "helper", nil
+}
+
+func TestElevator(t *testing.T) {
+	r, cmds, recs := testRunner(false, "")
+	el := &fakeElevator{}
+	r.SetElevator(el)
+	out, err := r.Output(Command("pfctl", "-E"))
+	if err != nil || out != "helper" {
+		t.Fatalf("Output = %q, %v; want the elevator's output", out, err)
+	}
+	if err := r.RunAll(Command("mkdir", "-p", "/var/log/torvm"), Command("launchctl", "load", "/x.plist")); err != nil {
+		t.Fatal(err)
+	}
+	if len(*cmds) != 0 || len(el.calls) != 2 || len(el.calls[1]) != 2 {
+		t.Errorf("started %d commands, elevator calls %v; want both through the elevator", len(*cmds), el.calls)
+	}
+	if len(*recs) != 3 || !(*recs)[0].Elevated {
+		t.Errorf("audit records = %v", *recs)
+	}
+
+	// An elevator that is not there falls back to the elevation tool
+	// (which may be missing here too, but is then what fails).
+	el.err = fmt.Errorf("helper: %w", ErrNoElevator)
+	if err := r.Run(Command("route", "-n", "add", "default", "10.10.10.2")); errors.Is(err, ErrNoElevator) {
+		t.Errorf("err = %v, want the elevation tool tried", err)
+	}
+
+	// Root needs no elevator.
+	root, _, _ := testRunner(true, "")
+	root.SetElevator(el)
+	el.calls = nil
+	root.Run(Command("route", "-n", "get", "default"))
+	if len(el.calls) != 0 {
+		t.Errorf("a privileged runner used the elevator")
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	root, _, _ := testRunner(true, "")
+	if err := root.CheckAccess(); err != nil {
+		t.Errorf("privileged: %v", err)
+	}
+	user, _, _ := testRunner(false, "")
+	if err := user.CheckAccess(); !errors.Is(err, ErrNoAccess) {
+		t.Errorf("no elevator: err = %v, want %v", err, ErrNoAccess)
+	}
+	el := &fakeElevator{}
+	user.SetElevator(el)
+	if err := user.CheckAccess(); err != nil {
+		t.Errorf("with a helper: %v", err)
+	}
+	el.err = fmt.Errorf("helper: %w", ErrNoElevator)
+	if err := user.CheckAccess(); !errors.Is(err, ErrNoAccess) {
+		t.Errorf("helper not running: err = %v, want %v", err, ErrNoAccess)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build darwin
+
+package privhelper
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/servicefile"
+)
+
+// installer runs the installation through osascript even when Default
+// sends ops to an installed helper, which would refuse to replace itself.
+var installer = &privexec.Runner{}
+
+// Installed reports whether the helper is installed.
+func Installed() bool {
+	_, err := os.Stat(PlistPath)
+	return err == nil
+}
+
+// Install copies the running binary to HelperPath and registers it as a
+// launchd daemon that starts at boot, replacing an installed helper. It
+// asks for an administrator's password once.
+func Install() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("privhelper: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("privhelper: %w", err)
+	}
+	plist, err := servicefile.Plist(servicefile.Spec{
+		Label:         Label,
+		Program:       HelperPath,
+		Args:          []string{"helper", "serve"},
+		LogPath:       LogPath,
+		ServiceConfig: config.ServiceConfig{RunAtLoad: true},
+	})
+	if err != nil {
+		return err
+	}
+	if err := servicefile.ValidatePlist(plist); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "torvm-helper-*.plist")
+	if err != nil {
+		return fmt.Errorf("privhelper: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(plist); err != nil {
+		tmp.Close()
+		return fmt.Errorf("privhelper: write plist: %w", err)
+	}
+	tmp.Close()
+
+	unload := privexec.Command("launchctl", "unload", PlistPath)
+	unload.MayFail = true
+	return installer.RunAll(
+		unload,
+		privexec.Command("mkdir", "-p", filepath.Dir(HelperPath), filepath.Dir(LogPath)),
+		privexec.Command("cp", exe, HelperPath),
+		privexec.Command("chmod", "544", HelperPath),
+		privexec.Command("cp", tmp.Name(), PlistPath),
+		privexec.Command("chmod", "644", PlistPath),
+		privexec.Command("launchctl", "load", "-w", PlistPath),
+	)
+}
+
+// Uninstall stops the helper and removes its files, asking for an
+// administrator's password once.
+func Uninstall() error {
+	unload := privexec.Command("launchctl", "unload", PlistPath)
+	unload.MayFail = true
+	return installer.RunAll(unload, privexec.Command("rm", "-f", PlistPath, HelperPath, SocketPath))
+}
+
+// Listen opens the helper's socket at SocketPath, replacing a stale one,
+// for root and the admin group only.
+func Listen() (net.Listener, error) {
+	os.Remove(SocketPath)
+	ln, err := net.Listen("unix", SocketPath)
+	if err != nil {
+		return nil, fmt.Errorf("privhelper: %w", err)
+	}
+	if err := os.Chown(SocketPath, 0, adminGID); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("privhelper: %w", err)
+	}
+	if err := os.Chmod(SocketPath, 0660); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("privhelper: %w", err)
+	}
+	return ln, nil
+}
+
+// peerCredentials returns the user and groups of the process at the
+// other end of conn, from the kernel.
+func peerCredentials(conn *net.UnixConn) (Peer, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return Peer{}, err
+	}
+	var cred *unix.Xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return Peer{}, err
+	}
+	if credErr != nil {
+		return Peer{}, credErr
+	}
+	n := max(0, min(int(cred.Ngroups), len(cred.Groups)))
+	return Peer{UID: cred.Uid, Groups: append([]uint32(nil), cred.Groups[:n]...)}, nil
+}
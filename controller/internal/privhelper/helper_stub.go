@@ -0,0 +1,30 @@
+//go:build !darwin
+
+package privhelper
+
+import (
+	"fmt"
+	"net"
+)
+
+// Installed reports false: the helper is macOS only.
+func Installed() bool { return false }
+
+// Install returns an error: the helper is macOS only.
+func Install() error {
+	return fmt.Errorf("privhelper: the privileged helper is only available on macOS")
+}
+
+// Uninstall returns an error: the helper is macOS only.
+func Uninstall() error {
+	return fmt.Errorf("privhelper: the privileged helper is only available on macOS")
+}
+
+// Listen returns an error: the helper is macOS only.
+func Listen() (net.Listener, error) {
+	return nil, fmt.Errorf("privhelper: the privileged helper is only available on macOS")
+}
+
+func peerCredentials(*net.UnixConn) (Peer, error) {
+	return Peer{}, fmt.Errorf("privhelper: peer credentials are only checked on macOS")
+}
@@ -0,0 +1,232 @@
+package privhelper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// plistKeys are the keys of the controller's service definition as
+// servicefile.Plist writes it. Others, such as UserName or Program, are
+// not installed without a password.
+var plistKeys = map[string]bool{
+	"Label": true, "ProgramArguments": true, "RunAtLoad": true, "KeepAlive": true,
+	"Nice": true, "SoftResourceLimits": true, "HardResourceLimits": true,
+	"WatchPaths": true, "EnvironmentVariables": true,
+	"StandardOutPath": true, "StandardErrorPath": true,
+}
+
+// checkPlist checks that data, a launchd plist to install as the
+// controller's service, runs the installed torvm as TorVM's service: as
+// launchd runs it as root, a definition of the caller's choosing would
+// let an administrator run anything as root without a password. Its
+// program must pass s.program, a config file it names must be root's,
+// it may set no DYLD_ variables, and it logs under /var/log/torvm.
+func (s *Server) checkPlist(data []byte) error {
+	dict, err := parsePlist(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUntrusted, err)
+	}
+	untrusted := func(format string, a ...any) error {
+		return fmt.Errorf("%w: "+format, append([]any{errUntrusted}, a...)...)
+	}
+	for k := range dict {
+		if !plistKeys[k] {
+			return untrusted("key %s", k)
+		}
+	}
+	if dict["Label"] != controllerLabel {
+		return untrusted("label %v", dict["Label"])
+	}
+	args, _ := dict["ProgramArguments"].([]any)
+	if len(args) == 0 {
+		return untrusted("no ProgramArguments")
+	}
+	prog, _ := args[0].(string)
+	if err := s.program(prog); err != nil {
+		return untrusted("%v", err)
+	}
+	for i := 1; i < len(args); i++ {
+		switch a, _ := args[i].(string); a {
+		case "--headless", "--backend":
+		case "--config":
+			i++
+			if i == len(args) {
+				return untrusted("--config without a file")
+			}
+			path, _ := args[i].(string)
+			if _, err := s.rootOwned(path); err != nil {
+				return untrusted("config %v", err)
+			}
+		default:
+			return untrusted("argument %q", a)
+		}
+	}
+	if env, ok := dict["EnvironmentVariables"].(map[string]any); ok {
+		for k := range env {
+			if strings.HasPrefix(k, "DYLD_") {
+				return untrusted("environment variable %s", k)
+			}
+		}
+	}
+	for _, k := range []string{"StandardOutPath", "StandardErrorPath"} {
+		path, _ := dict[k].(string)
+		if !filepath.IsAbs(path) || !managed(path) || filepath.Clean(path) == controllerPlist {
+			return untrusted("%s %q is not under /var/log/torvm", k, path)
+		}
+	}
+	return nil
+}
+
+// installedTorvm checks that path is the torvm the helper was installed
+// from: the same binary as the helper, in a place only root can change.
+func (s *Server) installedTorvm(path string) error {
+	fi, err := s.rootOwned(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	want, err := fileSum(self)
+	if err != nil {
+		return err
+	}
+	got, err := fileSum(path)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%s is not the torvm the helper was installed from; reinstall the helper", path)
+	}
+	return nil
+}
+
+// rootOwned checks that path is absolute, not a symlink, and that it
+// and the directories above it are root's and writable by no one else,
+// short of sticky directories such as /tmp, and returns its FileInfo.
+func (s *Server) rootOwned(path string) (os.FileInfo, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("%q is not an absolute path", path)
+	}
+	path = filepath.Clean(path)
+	var file os.FileInfo
+	for p := path; ; p = filepath.Dir(p) {
+		fi, err := s.stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if p == path {
+			file = fi
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return nil, fmt.Errorf("%s is a symlink", p)
+		}
+		if uid, ok := fileOwner(fi); !ok || uid != 0 {
+			return nil, fmt.Errorf("%s is not owned by root", p)
+		}
+		sticky := fi.IsDir() && fi.Mode()&os.ModeSticky != 0
+		if fi.Mode().Perm()&0022 != 0 && (p == path || !sticky) {
+			return nil, fmt.Errorf("%s is writable by other users", p)
+		}
+		if p == filepath.Dir(p) {
+			return file, nil
+		}
+	}
+}
+
+func fileSum(path string) ([sha256.Size]byte, error) {
+	f, err := openNoFollow(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return [sha256.Size]byte(h.Sum(nil)), nil
+}
+
+// parsePlist decodes an XML property list whose root is a dict into a
+// map of strings, booleans, integers (as strings), arrays, and dicts.
+func parsePlist(data []byte) (map[string]any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "dict" {
+			v, err := plistValue(dec, se)
+			if err != nil {
+				return nil, err
+			}
+			return v.(map[string]any), nil
+		}
+	}
+}
+
+func plistValue(dec *xml.Decoder, se xml.StartElement) (any, error) {
+	switch se.Name.Local {
+	case "string", "integer", "key":
+		var s string
+		if err := dec.DecodeElement(&s, &se); err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		return s, nil
+	case "true", "false":
+		if err := dec.Skip(); err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		return se.Name.Local == "true", nil
+	case "array", "dict":
+	default:
+		return nil, fmt.Errorf("plist: unexpected <%s>", se.Name.Local)
+	}
+	var items []any
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("plist: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			v, err := plistValue(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		case xml.EndElement:
+			if se.Name.Local == "array" {
+				return items, nil
+			}
+			if len(items)%2 != 0 {
+				return nil, errors.New("plist: a dict key without a value")
+			}
+			dict := make(map[string]any, len(items)/2)
+			for i := 0; i < len(items); i += 2 {
+				k, ok := items[i].(string)
+				if !ok {
+					return nil, errors.New("plist: a dict key that is not a string")
+				}
+				if _, dup := dict[k]; dup {
+					return nil, fmt.Errorf("plist: key %s given twice", k)
+				}
+				dict[k] = items[i+1]
+			}
+			return dict, nil
+		}
+	}
+}
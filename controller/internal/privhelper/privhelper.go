@@ -0,0 +1,415 @@
+// Package privhelper is the macOS privileged helper: a small daemon,
+// installed once, that runs the controller's privileged commands as root
+// so the user is not asked for an administrator password by osascript on
+// every service action and network change.
+//
+// It takes the place of an SMJobBless helper. The helper is the torvm
+// binary copied to /Library/PrivilegedHelperTools and started by a
+// launchd daemon, as SMJobBless would install it, but the one-time
+// installation asks for the password through osascript rather than the
+// ServiceManagement framework, which needs a code-signed app bundle. The
+// controller talks to it over a Unix socket that only root and the admin
+// group can open, one JSON request and reply per connection. The helper
+// checks each request's ops against privexec's list of programs and its
+// own policy on the files they may touch, so it runs nothing the
+// controller could not.
+package privhelper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+const (
+	// Label is the helper's launchd label.
+	Label = "org.torproject.torvm.helper"
+	// HelperPath is where the helper binary is installed.
+	HelperPath = "/Library/PrivilegedHelperTools/" + Label
+	// PlistPath is the helper's launchd daemon definition.
+	PlistPath = "/Library/LaunchDaemons/" + Label + ".plist"
+	// SocketPath is the socket the helper listens on.
+	SocketPath = "/var/run/" + Label + ".sock"
+	// LogPath receives the helper's output.
+	LogPath = "/var/log/torvm/helper.log"
+
+	// adminGID is the macOS admin group, whose members may use the
+	// helper.
+	adminGID = 80
+
+	// protocolVersion changes when request or reply do.
+	protocolVersion = 1
+)
+
+// requestTimeout bounds a request, including the commands it runs.
+const requestTimeout = 2 * time.Minute
+
+// request is what the controller sends.
+type request struct {
+	Version int           `json:"version"`
+	Ops     []privexec.Op `json:"ops"`
+}
+
+// reply is what the helper answers. Refused is set when the peer may not
+// use the helper, or the helper will not run the ops without a password,
+// so the controller falls back to osascript.
+type reply struct {
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Refused bool   `json:"refused,omitempty"`
+}
+
+// errRefused is the error of a peer that may not use the helper.
+var errRefused = errors.New("privhelper: only root and administrators may use the helper")
+
+// errUntrusted is the error of a service definition the helper does not
+// install without a password: one that does not run the installed
+// torvm as TorVM's service. Like errRefused, it sends the controller to
+// osascript, which asks for the password.
+var errUntrusted = errors.New("privhelper: the service definition does not run the installed torvm")
+
+// Client sends ops to the helper. It implements privexec.Elevator.
+type Client struct {
+	Socket string // SocketPath if empty
+}
+
+// RunOps sends ops to the helper and waits for them to run. Its error
+// wraps privexec.ErrNoElevator if the helper cannot be reached or does
+// not serve the caller.
+func (c Client) RunOps(ops []privexec.Op) (string, error) {
+	socket := c.Socket
+	if socket == "" {
+		socket = SocketPath
+	}
+	conn, err := net.DialTimeout("unix", socket, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("privhelper: %w: %v", privexec.ErrNoElevator, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	if err := json.NewEncoder(conn).Encode(request{Version: protocolVersion, Ops: ops}); err != nil {
+		return "", fmt.Errorf("privhelper: send: %w", err)
+	}
+	var rep reply
+	if err := json.NewDecoder(conn).Decode(&rep); err != nil {
+		return "", fmt.Errorf("privhelper: read reply: %w", err)
+	}
+	if rep.Refused {
+		return "", fmt.Errorf("%w: %s", privexec.ErrNoElevator, rep.Error)
+	}
+	if rep.Error != "" {
+		return rep.Output, errors.New(rep.Error)
+	}
+	return rep.Output, nil
+}
+
+// Peer is the user at the other end of a connection.
+type Peer struct {
+	UID    uint32
+	Groups []uint32
+}
+
+// allowed reports whether p may use the helper: root, or a member of
+// the admin group, who could authorize the commands anyway.
+func (p Peer) allowed() bool {
+	return p.UID == 0 || slices.Contains(p.Groups, adminGID)
+}
+
+// opRunner runs ops; a privexec.Runner.
+type opRunner interface {
+	Output(privexec.Op) (string, error)
+	RunAll(...privexec.Op) error
+}
+
+// Server answers the controller's requests.
+type Server struct {
+	runner opRunner
+
+	peer    func(*net.UnixConn) (Peer, error) // replaceable in tests
+	stat    func(string) (os.FileInfo, error) // replaceable in tests
+	program func(string) error                // checks a service's program; replaceable in tests
+	tempDir string                            // where copies are staged; "" for the system's
+}
+
+// NewServer returns a server that runs ops with runner, which must be
+// privileged.
+func NewServer(runner *privexec.Runner) *Server {
+	s := &Server{runner: runner, peer: peerCredentials, stat: os.Lstat}
+	s.program = s.installedTorvm
+	return s
+}
+
+// Serve answers connections on ln until it is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	out, err := s.serve(conn)
+	rep := reply{Output: out, Refused: errors.Is(err, errRefused) || errors.Is(err, errUntrusted)}
+	if err != nil {
+		rep.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(rep)
+}
+
+func (s *Server) serve(conn net.Conn) (string, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return "", fmt.Errorf("privhelper: not a Unix socket connection")
+	}
+	peer, err := s.peer(uc)
+	if err != nil {
+		return "", fmt.Errorf("privhelper: peer credentials: %w", err)
+	}
+	if !peer.allowed() {
+		return "", errRefused
+	}
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return "", fmt.Errorf("privhelper: read request: %w", err)
+	}
+	if req.Version != protocolVersion {
+		return "", fmt.Errorf("privhelper: protocol version %d, helper speaks %d; reinstall it with \"torvm helper install\"", req.Version, protocolVersion)
+	}
+	if len(req.Ops) == 0 {
+		return "", fmt.Errorf("privhelper: no ops")
+	}
+	ops := make([]privexec.Op, len(req.Ops))
+	var staged []string
+	defer func() {
+		for _, f := range staged {
+			os.Remove(f)
+		}
+	}()
+	for i, op := range req.Ops {
+		if err := s.check(op, peer); err != nil {
+			return "", err
+		}
+		// The commands run in / whatever the helper's directory, and a
+		// copy reads the file as it was checked.
+		op.Dir = "/"
+		if isProgram(op, "cp") {
+			src, err := s.stage(op.Args[0], op.Args[1], peer)
+			if err != nil {
+				return "", err
+			}
+			staged = append(staged, src)
+			op.Args = []string{src, op.Args[1]}
+		}
+		ops[i] = op
+	}
+	if len(ops) == 1 {
+		return s.runner.Output(ops[0])
+	}
+	return "", s.runner.RunAll(ops...)
+}
+
+// controllerLabel is the launchd label of the controller's own service,
+// the one service the helper manages.
+const controllerLabel = "org.torproject.torvm"
+
+// controllerPlist is the controller's launchd daemon definition.
+const controllerPlist = "/Library/LaunchDaemons/" + controllerLabel + ".plist"
+
+// managedPaths are the files and directories an op may name: the
+// controller's launchd daemon and its log directory. The helper's own
+// binary and daemon are not among them.
+var managedPaths = []string{
+	controllerPlist,
+	"/var/log/torvm",
+}
+
+// chmodModeRe matches the octal mode of a chmod.
+var chmodModeRe = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// plistBuddyRe matches the PlistBuddy commands the controller runs.
+var plistBuddyRe = regexp.MustCompile(`^(Set :RunAtLoad (true|false)|Print :[A-Za-z]+)$`)
+
+func isProgram(op privexec.Op, name string) bool {
+	return filepath.Base(op.Program) == name
+}
+
+// check applies the helper's policy to op, beyond what privexec
+// validates: it may name only TorVM's own files, each by its absolute
+// path, and its launchd service, and a copy may read only a regular file
+// of the peer's, so the helper cannot be used to read, write, or start
+// anything else as root. Programs that take no files may name none.
+func (s *Server) check(op privexec.Op, peer Peer) error {
+	if op.Dir != "" {
+		return fmt.Errorf("privhelper: %s: ops run in the helper's directory", op)
+	}
+	args := op.Args
+	var paths []string
+	switch filepath.Base(op.Program) {
+	case "cp":
+		if len(args) != 2 || !filepath.IsAbs(args[0]) {
+			return fmt.Errorf("privhelper: %s: want an absolute source and a destination", op)
+		}
+		paths = args[1:]
+	case "rm", "mkdir":
+		for _, a := range args {
+			switch {
+			case a == "-f" || a == "-p":
+			case strings.HasPrefix(a, "-"):
+				return fmt.Errorf("privhelper: %s: option %s is not allowed", op, a)
+			default:
+				paths = append(paths, a)
+			}
+		}
+	case "chmod":
+		if len(args) < 2 || !chmodModeRe.MatchString(args[0]) {
+			return fmt.Errorf("privhelper: %s: want an octal mode and files", op)
+		}
+		paths = args[1:]
+	case "launchctl":
+		return checkLaunchctl(op)
+	case "PlistBuddy":
+		if len(args) != 3 || args[0] != "-c" || !plistBuddyRe.MatchString(args[1]) || args[2] != controllerPlist {
+			return fmt.Errorf("privhelper: %s: only the TorVM service's RunAtLoad may be changed", op)
+		}
+		return nil
+	case "killall":
+		if !slices.Equal(args, []string{"-HUP", "mDNSResponder"}) {
+			return fmt.Errorf("privhelper: %s: only mDNSResponder may be signalled", op)
+		}
+		return nil
+	case "pfctl":
+		for i, a := range args {
+			if a == "-f" && (i+1 == len(args) || args[i+1] != "-") {
+				return fmt.Errorf("privhelper: %s: rules are read from standard input only", op)
+			}
+		}
+		return nil
+	default:
+		// route, networksetup, and dscacheutil take no files.
+		for _, a := range args {
+			if strings.HasPrefix(a, "/") || strings.HasPrefix(a, ".") {
+				return fmt.Errorf("privhelper: %s: %s takes no file", op, filepath.Base(op.Program))
+			}
+		}
+		return nil
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("privhelper: %s: no file", op)
+	}
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("privhelper: %s: %s is not an absolute path", op, p)
+		}
+		if !managed(p) {
+			return fmt.Errorf("privhelper: %s: %s is not a TorVM file", op, p)
+		}
+	}
+	return nil
+}
+
+// checkLaunchctl allows loading and unloading the TorVM service's plist,
+// and starting and stopping the service.
+func checkLaunchctl(op privexec.Op) error {
+	args := op.Args
+	ok := false
+	if len(args) > 0 {
+		switch args[0] {
+		case "load", "unload":
+			rest := args[1:]
+			if len(rest) > 0 && rest[0] == "-w" {
+				rest = rest[1:]
+			}
+			ok = slices.Equal(rest, []string{controllerPlist})
+		case "kickstart":
+			ok = slices.Equal(args[1:], []string{"-k", "system/" + controllerLabel}) ||
+				slices.Equal(args[1:], []string{"system/" + controllerLabel})
+		case "kill":
+			ok = len(args) == 3 && strings.HasPrefix(args[1], "SIG") && args[2] == "system/"+controllerLabel
+		}
+	}
+	if !ok {
+		return fmt.Errorf("privhelper: %s: not the TorVM service", op)
+	}
+	return nil
+}
+
+// managed reports whether path is one of managedPaths or lies under one.
+func managed(path string) bool {
+	path = filepath.Clean(path)
+	for _, m := range managedPaths {
+		if path == m || strings.HasPrefix(path, m+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// maxCopySize bounds a file the helper copies: a plist or a log.
+const maxCopySize = 1 << 20
+
+// stage copies the source of a copy to dst into a file of the helper's
+// own and returns its path, so that the copy reads what was checked and
+// not whatever the peer has put at src since. src must be a regular file
+// the peer owns, opened without following a symlink. The controller's
+// service definition must also pass checkPlist.
+func (s *Server) stage(src, dst string, peer Peer) (string, error) {
+	f, err := openNoFollow(src)
+	if err != nil {
+		return "", fmt.Errorf("privhelper: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("privhelper: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("privhelper: %s is not a regular file", src)
+	}
+	if uid, ok := fileOwner(fi); !ok || (uid != peer.UID && peer.UID != 0) {
+		return "", fmt.Errorf("privhelper: %s is not the caller's file", src)
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxCopySize+1))
+	if err != nil {
+		return "", fmt.Errorf("privhelper: %w", err)
+	}
+	if len(data) > maxCopySize {
+		return "", fmt.Errorf("privhelper: %s is too large to copy", src)
+	}
+	if filepath.Clean(dst) == controllerPlist {
+		if err := s.checkPlist(data); err != nil {
+			return "", err
+		}
+	}
+	tmp, err := os.CreateTemp(s.tempDir, "torvm-helper-*")
+	if err != nil {
+		return "", fmt.Errorf("privhelper: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("privhelper: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("privhelper: %w", err)
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,227 @@
+package privhelper
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/privexec"
+)
+
+// fakeRunner records the ops it is asked to run.
+type fakeRunner struct {
+	ran [][]privexec.Op
+}
+
+func (f *fakeRunner) Output(op privexec.Op) (string, error) {
+	f.ran = append(f.ran, []privexec.Op{op})
+	return "Token : 42", nil
+}
+
+func (f *fakeRunner) RunAll(ops ...privexec.Op) error {
+	f.ran = append(f.ran, ops)
+	return nil
+}
+
+// startTestServer serves a helper on a temporary socket for peer and
+// returns a client for it.
+func startTestServer(t *testing.T, peer Peer) (*fakeRunner, *Server, Client) {
+	t.Helper()
+	runner := &fakeRunner{}
+	srv := NewServer(nil)
+	srv.runner = runner
+	srv.peer = func(*net.UnixConn) (Peer, error) { return peer, nil }
+	sock := filepath.Join(t.TempDir(), "helper.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return runner, srv, Client{Socket: sock}
+}
+
+func TestClientServer(t *testing.T) {
+	runner, _, c := startTestServer(t, Peer{UID: 501, Groups: []uint32{20, adminGID}})
+
+	out, err := c.RunOps([]privexec.Op{privexec.Command("pfctl", "-E")})
+	if err != nil || out != "Token : 42" {
+		t.Fatalf("RunOps = %q, %v", out, err)
+	}
+	ops := []privexec.Op{
+		privexec.Command("mkdir", "-p", "/var/log/torvm"),
+		privexec.Command("launchctl", "kickstart", "-k", "system/org.torproject.torvm"),
+	}
+	if _, err := c.RunOps(ops); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.ran) != 2 || len(runner.ran[1]) != 2 || runner.ran[1][1].Args[2] != "system/org.torproject.torvm" {
+		t.Errorf("ran %v", runner.ran)
+	}
+
+	// Outside the policy.
+	for _, op := range []privexec.Op{
+		privexec.Command("rm", "-f", "/etc/pf.conf"),
+		privexec.Command("chmod", "777", PlistPath),
+		privexec.Command("launchctl", "load", "/Library/LaunchDaemons/com.example.plist"),
+		privexec.Command("launchctl", "kickstart", "system/com.apple.sshd"),
+		privexec.Command("cp", "/etc/master.passwd", "/var/log/torvm/x"),
+		{Program: "route", Args: []string{"-n", "get", "default"}, Dir: "/tmp"},
+	} {
+		if _, err := c.RunOps([]privexec.Op{op}); err == nil || errors.Is(err, privexec.ErrNoElevator) {
+			t.Errorf("RunOps(%s): err = %v, want it refused", op, err)
+		}
+	}
+	if len(runner.ran) != 2 {
+		t.Errorf("ran %d requests, want none outside the policy", len(runner.ran))
+	}
+}
+
+func TestClientRefused(t *testing.T) {
+	runner, _, c := startTestServer(t, Peer{UID: 502, Groups: []uint32{20}})
+	_, err := c.RunOps([]privexec.Op{privexec.Command("pfctl", "-E")})
+	if !errors.Is(err, privexec.ErrNoElevator) || len(runner.ran) != 0 {
+		t.Errorf("err = %v, ran %v; want a non-administrator refused and sent elsewhere", err, runner.ran)
+	}
+
+	// No helper at all.
+	_, err = Client{Socket: filepath.Join(t.TempDir(), "none.sock")}.RunOps(nil)
+	if !errors.Is(err, privexec.ErrNoElevator) {
+		t.Errorf("err = %v, want ErrNoElevator", err)
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	runner, _, c := startTestServer(t, Peer{UID: 501, Groups: []uint32{20, adminGID}})
+	for _, op := range []privexec.Op{
+		privexec.Command("rm", "-rf", "etc/sudoers"),
+		privexec.Command("rm", "-f", "../../etc/sudoers"),
+		privexec.Command("chmod", "777", "usr/bin"),
+		privexec.Command("mkdir", "-p", "var/log/torvm"),
+		privexec.Command("cp", "plist", "Library/LaunchDaemons/org.torproject.torvm.plist"),
+		privexec.Command("launchctl", "load", "Library/LaunchDaemons/org.torproject.torvm.plist"),
+		privexec.Command("pfctl", "-f", "etc/pf.conf"),
+	} {
+		if _, err := c.RunOps([]privexec.Op{op}); err == nil || errors.Is(err, privexec.ErrNoElevator) {
+			t.Errorf("RunOps(%s): err = %v, want it refused", op, err)
+		}
+	}
+	if len(runner.ran) != 0 {
+		t.Errorf("ran %v, want nothing", runner.ran)
+	}
+}
+
+// testPlist returns a service definition as servicefile.Plist writes
+// it, running program.
+func testPlist(program string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>org.torproject.torvm</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>` + program + `</string>
+		<string>--headless</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>/var/log/torvm/torvm.log</string>
+	<key>StandardErrorPath</key>
+	<string>/var/log/torvm/torvm.log</string>
+</dict>
+</plist>
+`
+}
+
+func TestServicePlist(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("copies are served on Unix only")
+	}
+	uid := uint32(os.Getuid())
+	runner, srv, c := startTestServer(t, Peer{UID: uid, Groups: []uint32{adminGID}})
+	srv.tempDir = t.TempDir()
+	srv.program = func(path string) error {
+		if path != "/usr/local/bin/torvm" {
+			return errors.New("not torvm")
+		}
+		return nil
+	}
+	dir := t.TempDir()
+	install := func(plist string) error {
+		src := filepath.Join(dir, "torvm-plist-1.plist")
+		if err := os.WriteFile(src, []byte(plist), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := c.RunOps([]privexec.Op{
+			privexec.Command("cp", src, "/Library/LaunchDaemons/org.torproject.torvm.plist"),
+			privexec.Command("launchctl", "load", "/Library/LaunchDaemons/org.torproject.torvm.plist"),
+		})
+		return err
+	}
+
+	if err := install(testPlist("/usr/local/bin/torvm")); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if len(runner.ran) != 1 {
+		t.Fatalf("ran %v", runner.ran)
+	}
+	cp := runner.ran[0][0]
+	if !strings.HasPrefix(cp.Args[0], srv.tempDir) || cp.Dir != "/" {
+		t.Errorf("cp = %+v, want the staged copy run in /", cp)
+	}
+
+	// A forged service runs something else as root: the controller is
+	// sent to osascript, which asks for the password.
+	forged := []string{
+		testPlist("/bin/sh"),
+		strings.Replace(testPlist("/usr/local/bin/torvm"), "<string>--headless</string>", "<string>-c</string>", 1),
+		strings.Replace(testPlist("/usr/local/bin/torvm"), "<key>RunAtLoad</key>", "<key>UserName</key><string>root</string><key>RunAtLoad</key>", 1),
+		strings.Replace(testPlist("/usr/local/bin/torvm"), "org.torproject.torvm<", "com.example<", 1),
+		strings.ReplaceAll(testPlist("/usr/local/bin/torvm"), "/var/log/torvm/torvm.log", "/etc/sudoers"),
+		"<plist><dict><key>Label</key>",
+	}
+	for _, plist := range forged {
+		if err := install(plist); !errors.Is(err, privexec.ErrNoElevator) {
+			t.Errorf("install of a forged plist: err = %v, want ErrNoElevator\n%s", err, plist)
+		}
+	}
+	if len(runner.ran) != 1 {
+		t.Errorf("ran %d requests, want no forged plist installed", len(runner.ran))
+	}
+}
+
+func TestCopySource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file owners are checked on Unix only")
+	}
+	_, srv, _ := startTestServer(t, Peer{UID: uint32(os.Getuid())})
+	srv.tempDir = t.TempDir()
+	src := filepath.Join(t.TempDir(), "torvm.log")
+	os.WriteFile(src, []byte("log"), 0600)
+	dst := "/var/log/torvm/torvm.log"
+	staged, err := srv.stage(src, dst, Peer{UID: uint32(os.Getuid())})
+	if err != nil {
+		t.Fatalf("copy of the caller's file: %v", err)
+	}
+	if data, _ := os.ReadFile(staged); string(data) != "log" {
+		t.Errorf("staged %q", data)
+	}
+	link := src + ".link"
+	if err := os.Symlink("/etc/hosts", link); err == nil {
+		if _, err := srv.stage(link, dst, Peer{UID: uint32(os.Getuid())}); err == nil {
+			t.Error("copy through a symlink allowed")
+		}
+	}
+	if _, err := srv.stage(src, dst, Peer{UID: uint32(os.Getuid()) + 1}); err == nil || !strings.Contains(err.Error(), "caller's file") {
+		t.Errorf("copy of another user's file: err = %v", err)
+	}
+}
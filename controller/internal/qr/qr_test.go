@@ -0,0 +1,213 @@
+package qr
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at 1-M, the worked example of the standard's tutorials.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("ECC = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionInfo(t *testing.T) {
+	for _, tt := range []struct {
+		level Level
+		mask  int
+		want  int
+	}{
+		{Low, 0, 0b111011111000100},
+		{Medium, 0, 0b101010000010010},
+		{Quartile, 7, 0b010101111101101},
+		{High, 3, 0b001100111010000},
+	} {
+		if got := formatInfo(tt.level, tt.mask); got != tt.want {
+			t.Errorf("format info (%d, mask %d) = %015b, want %015b", tt.level, tt.mask, got, tt.want)
+		}
+	}
+
+	// Version 7 information, read back from the top right block.
+	c := encode([]byte("x"), 7, Low)
+	got := 0
+	for i := 17; i >= 0; i-- {
+		got <<= 1
+		if c.Dark(c.Size-11+i%3, i/3) {
+			got |= 1
+		}
+	}
+	if got != 0b000111110010010100 {
+		t.Errorf("version 7 info = %018b", got)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	for _, tt := range []struct {
+		version int
+		level   Level
+		bytes   int
+	}{
+		{1, Low, 17}, {1, High, 7}, {10, Medium, 213}, {40, Low, 2953}, {40, Medium, 2331}, {40, High, 1273},
+	} {
+		c, err := Encode(make([]byte, tt.bytes), tt.level)
+		if err != nil || c.Version != tt.version {
+			t.Errorf("%d bytes at level %d: version %v, %v; want version %d", tt.bytes, tt.level, c, err, tt.version)
+		}
+		if tt.version < 40 {
+			if c, _ := Encode(make([]byte, tt.bytes+1), tt.level); c == nil || c.Version <= tt.version {
+				t.Errorf("%d bytes at level %d fit version %d", tt.bytes+1, tt.level, tt.version)
+			}
+		}
+	}
+	if _, err := Encode(make([]byte, 2954), Low); err == nil {
+		t.Error("oversized data encoded")
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	for v, want := range map[int][]int{
+		2: {6, 18}, 7: {6, 22, 38}, 15: {6, 26, 48, 70}, 32: {6, 34, 60, 86, 112, 138}, 40: {6, 30, 58, 86, 114, 142, 170},
+	} {
+		if got := alignmentPositions(v); !slices.Equal(got, want) {
+			t.Errorf("version %d: %v, want %v", v, got, want)
+		}
+	}
+}
+
+// decode reads a code back: format information, unmasking, codeword
+// order, block interleaving, ECC and the byte-mode segment.
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+	bits := 0
+	for i := 14; i >= 0; i-- {
+		var x, y int
+		switch {
+		case i <= 5:
+			x, y = 8, i
+		case i == 6:
+			x, y = 8, 7
+		case i == 7:
+			x, y = 8, 8
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		bits <<= 1
+		if c.Dark(x, y) {
+			bits |= 1
+		}
+	}
+	level, mask := Level(-1), -1
+	for l := Low; l <= High; l++ {
+		for m := 0; m < 8; m++ {
+			if formatInfo(l, m) == bits {
+				level, mask = l, m
+			}
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("format bits %015b match no level and mask", bits)
+	}
+
+	plain := &Code{Version: c.Version, Size: c.Size, dark: slices.Clone(c.dark), fn: c.fn}
+	plain.applyMask(mask)
+	raw := rawModules(c.Version) / 8
+	words := make([]byte, raw)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				if x := right - j; !c.fn[y*c.Size+x] && i < raw*8 {
+					if plain.Dark(x, y) {
+						words[i>>3] |= 0x80 >> (i & 7)
+					}
+					i++
+				}
+			}
+		}
+	}
+
+	nblocks, eccLen := numBlocks[level][c.Version], eccPerBlock[level][c.Version]
+	numShort, shortLen := nblocks-raw%nblocks, raw/nblocks
+	blocks := make([][]byte, nblocks)
+	k := 0
+	for i := 0; i <= shortLen; i++ {
+		for j := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				blocks[j] = append(blocks[j], words[k])
+				k++
+			}
+		}
+	}
+	var data []byte
+	for j, b := range blocks {
+		n := len(b) - eccLen
+		if ecc := rsRemainder(b[:n], rsDivisor(eccLen)); !bytes.Equal(ecc, b[n:]) {
+			t.Fatalf("block %d: ECC mismatch", j)
+		}
+		data = append(data, b[:n]...)
+	}
+
+	bit := func(pos, n int) int {
+		v := 0
+		for i := pos; i < pos+n; i++ {
+			v = v<<1 | int(data[i>>3]>>(7-i&7)&1)
+		}
+		return v
+	}
+	if m := bit(0, 4); m != 4 {
+		t.Fatalf("mode %d, want byte mode", m)
+	}
+	cb := countBits(c.Version)
+	n := bit(4, cb)
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(bit(4+cb+8*i, 8))
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 1, 17, 100, 300, 1000} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i*7 + n)
+		}
+		for l := Low; l <= High; l++ {
+			c, err := Encode(data, l)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := decode(t, c); !bytes.Equal(got, data) {
+				t.Errorf("%d bytes at level %d: decoded %d bytes that differ", n, l, len(got))
+			}
+		}
+	}
+}
+
+func TestFinderPatterns(t *testing.T) {
+	c, _ := Encode([]byte("torvm"), Medium)
+	for _, o := range [][2]int{{0, 0}, {c.Size - 7, 0}, {0, c.Size - 7}} {
+		for i := 0; i < 7; i++ {
+			if !c.Dark(o[0]+i, o[1]) || !c.Dark(o[0], o[1]+i) || !c.Dark(o[0]+3, o[1]+3) || c.Dark(o[0]+1, o[1]+1) {
+				t.Fatalf("no finder pattern at %v", o)
+			}
+		}
+	}
+	img := c.Image(2, 4)
+	if w := img.Bounds().Dx(); w != (c.Size+8)*2 {
+		t.Errorf("image width %d", w)
+	}
+}
@@ -0,0 +1,198 @@
+// Package recovery diagnoses a failed TorVM run: from the error and the
+// log lines leading up to it, it names the most likely cause and the
+// fixes worth trying. The GUI offers the fixes as buttons after a run
+// ends in failure.
+package recovery
+
+import (
+	"strings"
+
+	"github.com/user/extorvm/controller/internal/help"
+)
+
+// Fix is a remedy the recovery assistant can apply.
+type Fix int
+
+const (
+	// Retry starts TorVM again unchanged.
+	Retry Fix = iota
+	// RetryTCG starts TorVM again with software emulation instead of
+	// hardware acceleration, until TorVM is restarted.
+	RetryTCG
+	// ResetStateDisk replaces the state disk with an empty one.
+	ResetStateDisk
+	// FetchBridges requests bridges from the Tor Project's Moat service.
+	FetchBridges
+	// RunDoctor runs the preflight checks.
+	RunDoctor
+)
+
+func (f Fix) String() string {
+	switch f {
+	case Retry:
+		return "Retry"
+	case RetryTCG:
+		return "Retry without acceleration"
+	case ResetStateDisk:
+		return "Reset state disk"
+	case FetchBridges:
+		return "Get bridges"
+	case RunDoctor:
+		return "Run checks"
+	}
+	return "unknown fix"
+}
+
+// Cause is a known reason for a run to fail.
+type Cause struct {
+	ID      string
+	Title   string
+	Explain string
+	Topic   string // help topic ID, or "" if none applies
+	Fixes   []Fix  // most useful first
+}
+
+// Unknown is the cause given when nothing in the catalog matches.
+var Unknown = Cause{
+	ID:      "unknown",
+	Title:   "Unrecognized failure",
+	Explain: "TorVM could not tell what went wrong. The log lines below may show the cause; the preflight checks find most setup problems.",
+	Fixes:   []Fix{Retry, RunDoctor},
+}
+
+// catalog lists the known causes with the phrases that identify them in
+// an error message or log line. The first cause with a matching phrase
+// wins, so more specific causes come first. A generic cause describes a
+// symptom; a specific cause found in the log replaces it.
+var catalog = []struct {
+	phrases []string
+	cause   Cause
+	generic bool
+}{
+	{[]string{"shares its connection", "shared clients"}, Cause{
+		ID:      "sharing",
+		Title:   "Connection sharing is active",
+		Explain: "This computer shares its network connection with other devices, and the sharing policy refused to start. Turn sharing off or change the policy in Settings.",
+		Topic:   help.ConnectionSharing,
+		Fixes:   []Fix{Retry},
+	}, false},
+	{[]string{"crash recovery", "is already running (pid"}, Cause{
+		ID:      "recovery",
+		Title:   "A previous session is still active",
+		Explain: "Another TorVM is running, or a crashed session could not be cleaned up. Stop the other instance, or run torvm --purge.",
+		Topic:   help.CrashRecovery,
+		Fixes:   []Fix{Retry, RunDoctor},
+	}, false},
+	{[]string{"must run as root", "access is denied", "operation not permitted", "permission denied"}, Cause{
+		ID:      "privileges",
+		Title:   "Missing privileges",
+		Explain: "TorVM needs administrator rights to create the TAP device and change routes.",
+		Topic:   help.Privileges,
+		Fixes:   []Fix{RunDoctor},
+	}, false},
+	{[]string{"e2fsck", "ext4-fs error", "state disk", "i/o error", "structure needs cleaning"}, Cause{
+		ID:      "state-disk",
+		Title:   "Damaged state disk",
+		Explain: "The disk holding Tor's state could not be used. Resetting it costs Tor its cached consensus and guard choices, which it rebuilds on the next start.",
+		Topic:   help.DiskLimits,
+		Fixes:   []Fix{ResetStateDisk, Retry},
+	}, false},
+	{[]string{"kvm", "hvf", "whpx", "accel"}, Cause{
+		ID:      "acceleration",
+		Title:   "Hardware acceleration unavailable",
+		Explain: "QEMU could not use hardware virtualization. Software emulation (TCG) is slower but works everywhere.",
+		Topic:   help.Acceleration,
+		Fixes:   []Fix{RetryTCG, RunDoctor},
+	}, false},
+	{[]string{"qemu-system", "qemu version", "qemu not found", "executable file not found"}, Cause{
+		ID:      "qemu",
+		Title:   "QEMU missing or too old",
+		Explain: "TorVM could not start QEMU. Check that a supported QEMU version is installed and on the PATH.",
+		Topic:   help.QEMU,
+		Fixes:   []Fix{RunDoctor},
+	}, false},
+	{[]string{"bootstrap timeout", "bootstrap stalled", "bridge"}, Cause{
+		ID:      "bootstrap",
+		Title:   "Tor could not connect",
+		Explain: "Tor did not finish connecting to the network in time. If Tor is blocked where you are, bridges can get around the block.",
+		Topic:   help.Bridges,
+		Fixes:   []Fix{FetchBridges, Retry},
+	}, false},
+	{[]string{"bypass tor", "route verification"}, Cause{
+		ID:      "routing",
+		Title:   "Traffic could bypass Tor",
+		Explain: "The host routes did not send all traffic into the VM, so TorVM stopped rather than leak. Another VPN or network manager may be changing the routes.",
+		Topic:   help.Routing,
+		Fixes:   []Fix{Retry, RunDoctor},
+	}, false},
+	{[]string{"tap", "/dev/net/tun"}, Cause{
+		ID:      "tap",
+		Title:   "TAP device problem",
+		Explain: "The virtual network adapter linking the host to the VM could not be set up.",
+		Topic:   help.TAP,
+		Fixes:   []Fix{RunDoctor, Retry},
+	}, false},
+	{[]string{"vm exited unexpectedly"}, Cause{
+		ID:      "vm-exit",
+		Title:   "The VM stopped unexpectedly",
+		Explain: "QEMU exited while TorVM was running. A damaged state disk or too little memory are the usual reasons.",
+		Topic:   help.VMResources,
+		Fixes:   []Fix{RunDoctor, ResetStateDisk, Retry},
+	}, true},
+}
+
+// Diagnosis is what the recovery assistant shows for a failed run.
+type Diagnosis struct {
+	State string   // the lifecycle state that failed
+	Error string   // the error the run ended with
+	Cause Cause    // the most likely cause
+	Log   []string // the log lines leading up to the failure
+}
+
+// Diagnose finds the most likely cause of a run that failed in state
+// with err. The error is matched first; the error lines of the log tail,
+// newest first, only if the error names no specific cause. At most
+// maxLog lines of the tail are kept in the diagnosis.
+func Diagnose(state string, err error, logTail []string, maxLog int) Diagnosis {
+	d := Diagnosis{State: state, Cause: Unknown}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if len(logTail) > maxLog {
+		logTail = logTail[len(logTail)-maxLog:]
+	}
+	d.Log = logTail
+
+	c, generic, ok := match(d.Error)
+	if ok {
+		d.Cause = c
+		if !generic {
+			return d
+		}
+	}
+	for i := len(logTail) - 1; i >= 0; i-- {
+		if !strings.Contains(logTail[i], "] ERROR: ") {
+			continue
+		}
+		if c, generic, ok := match(logTail[i]); ok && !generic {
+			d.Cause = c
+			return d
+		}
+	}
+	return d
+}
+
+func match(text string) (c Cause, generic, ok bool) {
+	text = strings.ToLower(text)
+	if text == "" {
+		return Cause{}, false, false
+	}
+	for _, e := range catalog {
+		for _, p := range e.phrases {
+			if strings.Contains(text, p) {
+				return e.cause, e.generic, true
+			}
+		}
+	}
+	return Cause{}, false, false
+}
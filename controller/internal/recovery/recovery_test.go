@@ -0,0 +1,57 @@
+package recovery
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/help"
+)
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		log   []string
+		cause string
+	}{
+		{"acceleration", errors.New("lifecycle: LaunchVM failed: qemu-system-x86_64: Could not access KVM kernel module"), nil, "acceleration"},
+		{"bootstrap", errors.New("lifecycle: WaitBootstrap failed: bootstrap timeout after 5m0s"), nil, "bootstrap"},
+		{"privileges before tap", errors.New("lifecycle: CreateTAP failed: permission denied"), nil, "privileges"},
+		{"from log", errors.New("lifecycle: VM exited unexpectedly: exit status 1"), []string{
+			"[2026/01/02 10:00:00.000 UTC] INFO: lifecycle: entering state CreateTAP",
+			"[2026/01/02 10:00:01.000 UTC] ERROR: vm: EXT4-fs error (device vda): bad block bitmap",
+		}, "state-disk"},
+		{"info lines ignored", errors.New("something odd"), []string{
+			"[2026/01/02 10:00:00.000 UTC] INFO: lifecycle: entering state CreateTAP",
+		}, "unknown"},
+		{"nil error", nil, nil, "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Diagnose("Running", tt.err, tt.log, 20)
+			if d.Cause.ID != tt.cause {
+				t.Errorf("cause %q, want %q", d.Cause.ID, tt.cause)
+			}
+			if len(d.Cause.Fixes) == 0 {
+				t.Error("no fixes offered")
+			}
+		})
+	}
+}
+
+func TestDiagnoseTrimsLog(t *testing.T) {
+	log := []string{"a", "b", "c", "d"}
+	d := Diagnose("WaitTAP", nil, log, 2)
+	if !slices.Equal(d.Log, []string{"c", "d"}) {
+		t.Errorf("log %q, want the last two lines", d.Log)
+	}
+}
+
+func TestCatalogTopics(t *testing.T) {
+	for _, e := range catalog {
+		if _, ok := help.Lookup(e.cause.Topic); !ok {
+			t.Errorf("cause %s: no help topic %q", e.cause.ID, e.cause.Topic)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package servicefile renders the definitions that run the controller as
+// a system service: the launchd plist (macOS), the systemd unit (Linux),
+// and the Windows service settings. All are built from one Spec, so the
+// user's overrides in the config's "service" section apply the same way
+// on every platform that supports them.
+package servicefile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// Spec describes the service to generate.
+type Spec struct {
+	Label       string   // launchd label, e.g. "org.torproject.torvm"
+	Description string   // systemd Description and Windows service description
+	Program     string   // absolute path of the controller binary
+	Args        []string // arguments after Program
+	LogPath     string   // launchd stdout/stderr; systemd uses the journal
+	// Devices are further devices the systemd unit may open, such as a
+	// hardware RNG given as entropy.serial_entropy_device.
+	Devices []string
+
+	config.ServiceConfig
+}
+
+var funcs = template.FuncMap{
+	"xml":     xmlEscape,
+	"execArg": execArg,
+	"env":     unitEnv,
+	"device":  unitDevice,
+	"list":    func(s ...string) []string { return s },
+}
+
+var plistTmpl = template.Must(template.New("plist").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Program}}</string>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>RunAtLoad</key>
+	<{{.RunAtLoad}}/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+{{- if .Nice}}
+	<key>Nice</key>
+	<integer>{{.Nice}}</integer>
+{{- end}}
+{{- if or .MaxOpenFiles .MaxProcesses}}
+{{- range (list "SoftResourceLimits" "HardResourceLimits")}}
+	<key>{{.}}</key>
+	<dict>
+{{- if $.MaxOpenFiles}}
+		<key>NumberOfFiles</key>
+		<integer>{{$.MaxOpenFiles}}</integer>
+{{- end}}
+{{- if $.MaxProcesses}}
+		<key>NumberOfProcesses</key>
+		<integer>{{$.MaxProcesses}}</integer>
+{{- end}}
+	</dict>
+{{- end}}
+{{- end}}
+{{- if .WatchPaths}}
+	<key>WatchPaths</key>
+	<array>
+{{- range .WatchPaths}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+{{- end}}
+{{- if .Environment}}
+	<key>EnvironmentVariables</key>
+	<dict>
+{{- range $k, $v := .Environment}}
+		<key>{{xml $k}}</key>
+		<string>{{xml $v}}</string>
+{{- end}}
+	</dict>
+{{- end}}
+	<key>StandardOutPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogPath}}</string>
+</dict>
+</plist>
+`))
+
+var unitTmpl = template.Must(template.New("unit").Funcs(funcs).Parse(`[Unit]
+Description={{.Description}}
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{execArg .Program}}{{range .Args}} {{execArg .}}{{end}}
+ExecReload=/bin/kill -HUP $MAINPID
+ExecStop=/bin/kill -SIGTERM $MAINPID
+Restart=on-failure
+RestartSec=10
+WatchdogSec=60
+KillMode=mixed
+TimeoutStopSec=30
+NoNewPrivileges=yes
+ProtectSystem=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectKernelTunables=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+PrivateTmp=yes
+RestrictSUIDSGID=yes
+RestrictNamespaces=yes
+RestrictRealtime=yes
+LockPersonality=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6 AF_NETLINK
+CapabilityBoundingSet=CAP_NET_ADMIN CAP_NET_RAW CAP_NET_BIND_SERVICE CAP_DAC_OVERRIDE CAP_FOWNER CAP_CHOWN
+DevicePolicy=closed
+DeviceAllow=/dev/kvm rw
+DeviceAllow=/dev/net/tun rw
+DeviceAllow=/dev/vhost-net rw
+{{- range .Devices}}
+DeviceAllow={{device .}} rw
+{{- end}}
+{{- if .Nice}}
+Nice={{.Nice}}
+{{- end}}
+{{- if .MaxOpenFiles}}
+LimitNOFILE={{.MaxOpenFiles}}
+{{- end}}
+{{- if .MaxProcesses}}
+LimitNPROC={{.MaxProcesses}}
+{{- end}}
+{{- range $k, $v := .Environment}}
+Environment={{env $k $v}}
+{{- end}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// Plist renders the launchd property list for s.
+func Plist(s Spec) (string, error) {
+	return render(plistTmpl, s)
+}
+
+// Unit renders the systemd service unit for s. WatchPaths has no
+// equivalent in a service unit and is ignored.
+//
+// The unit runs the controller as root, which it needs for the TAP
+// device, routes and firewall rules, but drops every other capability
+// and device. CAP_CHOWN stays for the API sockets' api_group. /etc stays writable (ProtectSystem=yes rather than full)
+// because the controller replaces /etc/resolv.conf while Tor handles
+// DNS and restores it afterwards.
+func Unit(s Spec) (string, error) {
+	return render(unitTmpl, s)
+}
+
+// WindowsService holds the settings of the Windows service for a Spec.
+type WindowsService struct {
+	Description string
+	Args        []string
+	// Environment is the service's REG_MULTI_SZ "Environment" value,
+	// as NAME=value strings sorted by name.
+	Environment []string
+}
+
+// Windows returns the Windows service settings for s. The SCM has no
+// nice level, resource limits, or watch paths; those are ignored.
+func Windows(s Spec) WindowsService {
+	w := WindowsService{Description: s.Description, Args: s.Args}
+	for _, k := range slices.Sorted(maps.Keys(s.Environment)) {
+		w.Environment = append(w.Environment, k+"="+s.Environment[k])
+	}
+	return w
+}
+
+func render(t *template.Template, s Spec) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, s); err != nil {
+		return "", fmt.Errorf("render %s: %w", t.Name(), err)
+	}
+	return b.String(), nil
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// execArg quotes one ExecStart word. "%" starts a unit specifier and "$"
+// a variable, so both are doubled.
+func execArg(s string) string {
+	s = strings.ReplaceAll(s, "$", "$$")
+	return unitQuote(s)
+}
+
+// unitDeviceRe matches a device path DeviceAllow= can take as it is.
+var unitDeviceRe = regexp.MustCompile(`^/dev/[A-Za-z0-9._/-]+$`)
+
+// unitDevice returns path for a DeviceAllow= line, which cannot be
+// quoted, or an error if it is not a plain /dev path.
+func unitDevice(path string) (string, error) {
+	if !unitDeviceRe.MatchString(path) || strings.Contains(path, "..") {
+		return "", fmt.Errorf("device %q is not a plain /dev path", path)
+	}
+	return path, nil
+}
+
+// unitEnv formats an Environment= assignment.
+func unitEnv(name, value string) string {
+	return unitQuote(name + "=" + value)
+}
+
+// unitQuote escapes "%" and, if s is empty or contains whitespace,
+// quotes or backslashes, wraps it in double quotes.
+func unitQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,158 @@
+package servicefile
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+func testSpec() Spec {
+	return Spec{
+		Label:       "org.torproject.torvm",
+		Description: "TorVM - Transparent Tor Proxy Virtual Machine",
+		Program:     "/usr/local/bin/torvm",
+		Args:        []string{"--headless"},
+		LogPath:     "/var/log/torvm/torvm.log",
+	}
+}
+
+func testOverrides() config.ServiceConfig {
+	return config.ServiceConfig{
+		RunAtLoad:    true,
+		Nice:         5,
+		MaxOpenFiles: 4096,
+		MaxProcesses: 64,
+		WatchPaths:   []string{"/etc/torvm/config.json"},
+		Environment:  map[string]string{"TZ": "UTC", "TORVM_NOTE": `50% <a "b">`},
+	}
+}
+
+// wellFormed reports whether s parses as XML.
+func wellFormed(s string) error {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func TestPlist(t *testing.T) {
+	s := testSpec()
+	out, err := Plist(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wellFormed(out); err != nil {
+		t.Fatalf("plist is not well-formed: %v\n%s", err, out)
+	}
+	for _, absent := range []string{"Nice", "ResourceLimits", "WatchPaths", "EnvironmentVariables"} {
+		if strings.Contains(out, absent) {
+			t.Errorf("plist without overrides contains %s", absent)
+		}
+	}
+
+	s.ServiceConfig = testOverrides()
+	if out, err = Plist(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := wellFormed(out); err != nil {
+		t.Fatalf("plist is not well-formed: %v\n%s", err, out)
+	}
+	for _, want := range []string{
+		"<key>RunAtLoad</key>\n\t<true/>",
+		"<key>Nice</key>\n\t<integer>5</integer>",
+		"<key>SoftResourceLimits</key>",
+		"<key>HardResourceLimits</key>",
+		"<key>NumberOfFiles</key>\n\t\t<integer>4096</integer>",
+		"<key>NumberOfProcesses</key>\n\t\t<integer>64</integer>",
+		"<string>/etc/torvm/config.json</string>",
+		"<key>TORVM_NOTE</key>\n\t\t<string>50% &lt;a &#34;b&#34;&gt;</string>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plist lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnit(t *testing.T) {
+	s := testSpec()
+	s.Args = append(s.Args, "--config", "/etc/tor vm/100%.json")
+	s.ServiceConfig = testOverrides()
+	s.Devices = []string{"/dev/ttyACM0"}
+	out, err := Unit(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`ExecStart=/usr/local/bin/torvm --headless --config "/etc/tor vm/100%%.json"` + "\n",
+		"Nice=5\n",
+		"LimitNOFILE=4096\n",
+		"LimitNPROC=64\n",
+		"ProtectSystem=yes\n",
+		"CapabilityBoundingSet=CAP_NET_ADMIN ",
+		" CAP_CHOWN\n",
+		"DevicePolicy=closed\n",
+		"DeviceAllow=/dev/kvm rw\nDeviceAllow=/dev/net/tun rw\n",
+		"DeviceAllow=/dev/ttyACM0 rw\n",
+		`Environment="TORVM_NOTE=50%% <a \"b\">"` + "\nEnvironment=TZ=UTC\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("unit lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "config.json\n") {
+		t.Error("unit contains the macOS-only watch path")
+	}
+
+	// A device that would break out of its line is refused.
+	s.Devices = []string{"/dev/ttyACM0 rw\nExecStartPre=/bin/sh"}
+	if _, err := Unit(s); err == nil {
+		t.Error("Unit accepted a device path with a newline")
+	}
+}
+
+func TestWindows(t *testing.T) {
+	s := testSpec()
+	s.ServiceConfig = testOverrides()
+	w := Windows(s)
+	if want := []string{`TORVM_NOTE=50% <a "b">`, "TZ=UTC"}; !slices.Equal(w.Environment, want) {
+		t.Errorf("Environment = %q, want %q", w.Environment, want)
+	}
+	if !slices.Equal(w.Args, s.Args) {
+		t.Errorf("Args = %q, want %q", w.Args, s.Args)
+	}
+}
+
+func TestValidateUnit(t *testing.T) {
+	if _, err := exec.LookPath("systemd-analyze"); err != nil {
+		t.Skip("systemd-analyze not installed")
+	}
+	s := testSpec()
+	s.Program = "/bin/true"
+	s.ServiceConfig = testOverrides()
+	out, err := Unit(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateUnit("torvm.service", out); err != nil {
+		t.Errorf("ValidateUnit: %v", err)
+	}
+
+	s.Program = "/nonexistent/torvm"
+	if out, err = Unit(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateUnit("torvm.service", out); err == nil {
+		t.Error("unit with a missing binary passed validation")
+	}
+}
@@ -0,0 +1,45 @@
+package servicefile
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ValidatePlist checks a rendered plist with "plutil -lint". It returns
+// nil when plutil is not installed.
+func ValidatePlist(content string) error {
+	return lint(content, "torvm.plist", "plutil", "-lint")
+}
+
+// ValidateUnit checks a rendered unit with "systemd-analyze verify",
+// which also checks that the ExecStart binary exists. It returns nil when
+// systemd-analyze is not installed.
+func ValidateUnit(name, content string) error {
+	return lint(content, name, "systemd-analyze", "verify")
+}
+
+// lint writes content to a temporary file with the given base name (the
+// tools look at the extension) and runs tool with args and its path.
+func lint(content, name, tool string, args ...string) error {
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "torvm-service-")
+	if err != nil {
+		return fmt.Errorf("validate %s: %w", name, err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		return fmt.Errorf("validate %s: %w", name, err)
+	}
+	out, err := exec.Command(path, append(args, file)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s rejected the generated %s: %w: %s", tool, name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+// Package storage accounts for the disk space the controller uses: the
+// state disks, including saved identities, the logs and event journal,
+// and the leftovers of interrupted work, such as half-made state disks,
+// torrc overlay temporaries, and trial directories. Leftovers and rotated
+// logs can be removed, by hand or by retention rules.
+//
+// The crash-recovery session records and the live log files are never
+// counted as reclaimable: the first are needed to restore the host's
+// network after a crash, the second are open for writing.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/identity"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// Category groups the items of a report.
+type Category string
+
+const (
+	StateDisks Category = "State disks"
+	Logs       Category = "Logs"
+	Leftovers  Category = "Leftovers"
+)
+
+// Categories lists the categories in report order.
+var Categories = []Category{StateDisks, Logs, Leftovers}
+
+// MinAge is how old a leftover must be before it is reclaimable. A newer
+// one may belong to work in progress, such as a running trial.
+const MinAge = time.Hour
+
+// Item is one file or directory that uses space.
+type Item struct {
+	Category    Category
+	Path        string
+	Size        int64
+	Modified    time.Time
+	Reclaimable bool
+	Note        string // what it is
+}
+
+// Options says where the controller keeps its files.
+type Options struct {
+	StateDisks []string // the state disks in use; saved identities beside them are found
+	Logs       []string // log files; their rotated "<path>.1" copies are counted too
+	TempDir    string   // where trials make their directories; "" means os.TempDir()
+}
+
+// Report is the result of a Scan.
+type Report struct {
+	Items []Item
+}
+
+// Total returns the space used by the items in category c.
+func (r Report) Total(c Category) int64 {
+	var n int64
+	for _, it := range r.Items {
+		if it.Category == c {
+			n += it.Size
+		}
+	}
+	return n
+}
+
+// Reclaimable returns the reclaimable items.
+func (r Report) Reclaimable() []Item {
+	var out []Item
+	for _, it := range r.Items {
+		if it.Reclaimable {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// Scan finds the files the controller uses, as of now. Missing files are
+// left out; a directory that cannot be read is reported in the error,
+// with the items found elsewhere still returned.
+func Scan(opts Options, now time.Time) (Report, error) {
+	s := &scanner{now: now}
+	seen := map[string]bool{}
+	for _, disk := range opts.StateDisks {
+		if disk == "" || seen[disk] {
+			continue
+		}
+		seen[disk] = true
+		s.add(StateDisks, disk, "state disk", false)
+		ids := identity.Open(disk).Dir()
+		names, err := filepath.Glob(filepath.Join(ids, "*.img"))
+		if err != nil {
+			s.errs = append(s.errs, fmt.Errorf("storage: %w", err))
+		}
+		for _, m := range names {
+			s.add(StateDisks, m, "identity "+strings.TrimSuffix(filepath.Base(m), ".img"), false)
+		}
+		s.leftovers(disk)
+	}
+
+	for _, log := range opts.Logs {
+		if log == "" || seen[log] {
+			continue
+		}
+		seen[log] = true
+		s.add(Logs, log, "log", false)
+		s.add(Logs, log+".1", "rotated log", true)
+	}
+
+	tmp := opts.TempDir
+	if tmp == "" {
+		tmp = os.TempDir()
+	}
+	s.glob(Leftovers, filepath.Join(tmp, "torvm-trial-*"), "trial directory")
+
+	return s.r, errors.Join(s.errs...)
+}
+
+// Ephemeral returns the leftovers of interrupted work beside the state
+// disk at disk, whatever their age, for a controller that has stopped
+// the VM using it to shred.
+func Ephemeral(disk string) ([]Item, error) {
+	s := &scanner{}
+	s.leftovers(disk)
+	return s.r.Items, errors.Join(s.errs...)
+}
+
+// scanner collects the items of a report.
+type scanner struct {
+	now  time.Time
+	r    Report
+	errs []error
+}
+
+// add reports the file or directory at path, if it exists. It is
+// reclaimable if it may be and is at least MinAge old.
+func (s *scanner) add(c Category, path, note string, reclaimable bool) {
+	it, err := stat(c, path, note)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.errs = append(s.errs, err)
+		}
+		return
+	}
+	it.Reclaimable = reclaimable && s.now.Sub(it.Modified) >= MinAge
+	s.r.Items = append(s.r.Items, it)
+}
+
+// glob reports the reclaimable files and directories matching pattern.
+func (s *scanner) glob(c Category, pattern, note string) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		s.errs = append(s.errs, fmt.Errorf("storage: %w", err))
+	}
+	for _, m := range matches {
+		s.add(c, m, note, true)
+	}
+}
+
+// leftovers reports the leftovers beside the state disk at disk: a disk
+// being made, torrc overlay temporaries, and identity temporaries.
+func (s *scanner) leftovers(disk string) {
+	s.add(Leftovers, disk+".new", "unfinished state disk", true)
+	s.glob(Leftovers, filepath.Join(filepath.Dir(disk), "torvm-overlay-*"), "torrc overlay temporary")
+	s.glob(Leftovers, filepath.Join(identity.Open(disk).Dir(), "*.tmp"), "identity temporary")
+}
+
+// stat describes the file or directory at path. A directory's size and
+// modification time are those of the files in it, the latest of them.
+func stat(c Category, path, note string) (Item, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return Item{}, err
+	}
+	it := Item{Category: c, Path: path, Size: fi.Size(), Modified: fi.ModTime(), Note: note}
+	if !fi.IsDir() {
+		return it, nil
+	}
+	it.Size = 0
+	var latest time.Time
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			it.Size += info.Size()
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+		}
+		return nil
+	})
+	if !latest.IsZero() {
+		it.Modified = latest
+	}
+	if err != nil {
+		return it, fmt.Errorf("storage: %w", err)
+	}
+	return it, nil
+}
+
+// Clean removes the reclaimable items among items and returns the space
+// freed. Items that are not reclaimable are skipped.
+func Clean(items []Item) (int64, error) {
+	var freed int64
+	var errs []error
+	for _, it := range items {
+		if !it.Reclaimable {
+			continue
+		}
+		if err := os.RemoveAll(it.Path); err != nil {
+			errs = append(errs, fmt.Errorf("storage: %w", err))
+			continue
+		}
+		freed += it.Size
+	}
+	return freed, errors.Join(errs...)
+}
+
+// Shred overwrites the files of items with zeros, as vm.ShredFile does,
+// and removes them, directories included. Unlike Clean it does not check
+// that they are reclaimable.
+func Shred(items []Item) error {
+	var errs []error
+	for _, it := range items {
+		err := filepath.WalkDir(it.Path, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				err = vm.ShredFile(path)
+			}
+			return err
+		})
+		if err == nil {
+			err = os.RemoveAll(it.Path)
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("storage: shred: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Policy is a set of retention rules. An age of 0 disables its rule.
+type Policy struct {
+	LeftoverAge time.Duration // remove leftovers older than this
+	LogAge      time.Duration // remove rotated logs older than this
+}
+
+// Expired returns the reclaimable items of r that p says to remove as of
+// now.
+func (p Policy) Expired(r Report, now time.Time) []Item {
+	var out []Item
+	for _, it := range r.Reclaimable() {
+		age := p.LeftoverAge
+		if it.Category == Logs {
+			age = p.LogAge
+		}
+		if age > 0 && now.Sub(it.Modified) >= age {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// Enforce scans opts and removes what p says to, returning the space
+// freed.
+func Enforce(opts Options, p Policy, now time.Time) (int64, error) {
+	r, scanErr := Scan(opts, now)
+	freed, err := Clean(p.Expired(r, now))
+	return freed, errors.Join(scanErr, err)
+}
+
+// FormatSize formats n bytes for display, as "512 B", "3.4 MB", or
+// "1.2 GB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 3; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGT"[exp])
+}
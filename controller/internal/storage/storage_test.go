@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tree lays out a state disk, a saved identity, a log, and leftovers in
+// a temporary directory, all last modified at mod.
+func tree(t *testing.T, mod time.Time) Options {
+	t.Helper()
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, "tmp")
+	files := map[string]int{
+		"state.img":                    4096,
+		"state.img.new":                1024,
+		"torvm-overlay-123":            10,
+		"identities/publishing.img":    4096,
+		"identities/active.tmp":        8,
+		"torvm.log":                    100,
+		"torvm.log.1":                  200,
+		"tmp/torvm-trial-1/run.log":    50,
+		"tmp/torvm-trial-1/disk/s.img": 500,
+		"tmp/unrelated":                7,
+	}
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	return Options{
+		StateDisks: []string{filepath.Join(dir, "state.img")},
+		Logs:       []string{filepath.Join(dir, "torvm.log"), filepath.Join(dir, "events.jsonl")},
+		TempDir:    tmp,
+	}
+}
+
+func TestScan(t *testing.T) {
+	now := time.Now()
+	opts := tree(t, now.Add(-48*time.Hour))
+	r, err := Scan(opts, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Total(StateDisks); got != 8192 {
+		t.Errorf("state disks = %d, want 8192", got)
+	}
+	if got := r.Total(Logs); got != 300 {
+		t.Errorf("logs = %d, want 300", got)
+	}
+	if got := r.Total(Leftovers); got != 1024+10+8+550 {
+		t.Errorf("leftovers = %d, want %d", got, 1024+10+8+550)
+	}
+	var reclaim int64
+	for _, it := range r.Reclaimable() {
+		if it.Category == StateDisks || filepath.Base(it.Path) == "torvm.log" {
+			t.Errorf("%s is reclaimable", it.Path)
+		}
+		reclaim += it.Size
+	}
+	if reclaim != 200+1024+10+8+550 {
+		t.Errorf("reclaimable = %d", reclaim)
+	}
+}
+
+// TestRecentNotReclaimable checks that leftovers that may be in use are
+// kept.
+func TestRecentNotReclaimable(t *testing.T) {
+	now := time.Now()
+	r, err := Scan(tree(t, now.Add(-time.Minute)), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Reclaimable(); len(got) != 0 {
+		t.Errorf("reclaimable = %v, want none", got)
+	}
+}
+
+func TestCleanAndEnforce(t *testing.T) {
+	now := time.Now()
+	opts := tree(t, now.Add(-10*24*time.Hour))
+
+	// Logs are kept 30 days, leftovers 7: only leftovers go.
+	p := Policy{LeftoverAge: 7 * 24 * time.Hour, LogAge: 30 * 24 * time.Hour}
+	freed, err := Enforce(opts, p, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 1024+10+8+550 {
+		t.Errorf("Enforce freed %d", freed)
+	}
+	r, _ := Scan(opts, now)
+	if r.Total(Leftovers) != 0 || r.Total(Logs) != 300 || r.Total(StateDisks) != 8192 {
+		t.Errorf("after Enforce: %+v", r.Items)
+	}
+
+	// A disabled rule removes nothing.
+	if freed, _ := Enforce(opts, Policy{}, now); freed != 0 {
+		t.Errorf("Enforce with no rules freed %d", freed)
+	}
+
+	freed, err = Clean(r.Items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freed != 200 {
+		t.Errorf("Clean freed %d, want 200", freed)
+	}
+	if _, err := os.Stat(opts.StateDisks[0]); err != nil {
+		t.Errorf("state disk removed: %v", err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		512:       "512 B",
+		1536:      "1.5 KB",
+		256 << 20: "256.0 MB",
+		3 << 30:   "3.0 GB",
+		5 << 40:   "5.0 TB",
+	} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestEphemeralShred(t *testing.T) {
+	// Leftovers made a moment ago are shredded too.
+	opts := tree(t, time.Now())
+	items, err := Ephemeral(opts.StateDisks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Ephemeral = %+v, want the disk, overlay, and identity temporaries", items)
+	}
+	if err := Shred(items); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := Scan(opts, time.Now())
+	if r.Total(Leftovers) != 550 {
+		t.Errorf("after Shred: %+v, want only the trial directory left", r.Items)
+	}
+	if r.Total(StateDisks) != 8192 {
+		t.Errorf("Shred touched a state disk: %+v", r.Items)
+	}
+}
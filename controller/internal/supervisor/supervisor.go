@@ -0,0 +1,256 @@
+// Package supervisor runs auxiliary host processes alongside the VM, such
+// as a pluggable transport client, a DNS forwarder, or a proxy frontend.
+// Each helper is restarted with backoff when it exits, and its output is
+// merged into the controller's log.
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+const (
+	// initialBackoff is the wait before the first restart of a helper
+	// that exited; it doubles with each restart up to maxBackoff.
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+
+	// stableAfter is how long a helper must run for the backoff to start
+	// over at initialBackoff.
+	stableAfter = time.Minute
+
+	// stopTimeout is how long a stopping helper has to exit after the
+	// termination signal before it is killed.
+	stopTimeout = 5 * time.Second
+)
+
+// errNotRunnable marks a helper executable that is missing or unsafe to
+// run; such a helper is not restarted.
+var errNotRunnable = errors.New("not runnable")
+
+// Helper is an auxiliary process.
+type Helper struct {
+	Name string
+	Path string // absolute path of the executable
+	Args []string
+}
+
+// handle is a supervised helper. cancel stops it, and stopping records
+// that it has been called; done is closed once the helper has exited
+// and will not be restarted.
+type handle struct {
+	cancel   context.CancelFunc
+	stopping bool
+	done     chan struct{}
+}
+
+// stop cancels hd. The caller holds the supervisor's mu.
+func (hd *handle) stop() {
+	hd.cancel()
+	hd.stopping = true
+}
+
+// active reports whether hd is supervised. The caller holds the
+// supervisor's mu.
+func (hd *handle) active() bool {
+	select {
+	case <-hd.done:
+		return false
+	default:
+		return !hd.stopping
+	}
+}
+
+// Supervisor starts, restarts, and stops helpers.
+type Supervisor struct {
+	Logger *logging.Logger
+
+	clock clock.Clock // replaceable in tests
+
+	// exec runs h until it exits; replaceable in tests.
+	exec func(ctx context.Context, h Helper) error
+
+	mu      sync.Mutex
+	helpers map[string]*handle
+}
+
+// New creates a supervisor that logs to logger.
+func New(logger *logging.Logger) *Supervisor {
+	s := &Supervisor{
+		Logger:  logger,
+		clock:   clock.Real,
+		helpers: make(map[string]*handle),
+	}
+	s.exec = s.execHelper
+	return s
+}
+
+// Start begins supervising h unless a helper of that name is already
+// supervised. If one is still exiting after Stop, h is launched once it
+// has.
+func (s *Supervisor) Start(h Helper) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.helpers[h.Name]
+	if prev != nil && prev.active() {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	hd := &handle{cancel: cancel, done: make(chan struct{})}
+	s.helpers[h.Name] = hd
+	go func() {
+		defer close(hd.done)
+		if prev != nil {
+			<-prev.done
+		}
+		s.run(ctx, h)
+	}()
+}
+
+// Stop stops the named helper without waiting for it to exit.
+func (s *Supervisor) Stop(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hd := s.helpers[name]; hd != nil {
+		hd.stop()
+	}
+}
+
+// StopAll stops every helper and waits for them to exit.
+func (s *Supervisor) StopAll() {
+	s.mu.Lock()
+	var done []chan struct{}
+	for _, hd := range s.helpers {
+		hd.stop()
+		done = append(done, hd.done)
+	}
+	s.mu.Unlock()
+	for _, ch := range done {
+		<-ch
+	}
+}
+
+// Running returns the names of the helpers being supervised, sorted.
+func (s *Supervisor) Running() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name, hd := range s.helpers {
+		if hd.active() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// run runs h until ctx is cancelled, restarting it with backoff each time
+// it exits.
+func (s *Supervisor) run(ctx context.Context, h Helper) {
+	restarts := 0
+	for {
+		s.Logger.Info("helper %s: starting %s", h.Name, h.Path)
+		started := s.clock.Now()
+		err := s.exec(ctx, h)
+		if ctx.Err() != nil {
+			s.Logger.Info("helper %s: stopped", h.Name)
+			return
+		}
+		if errors.Is(err, errNotRunnable) {
+			s.Logger.Error("helper %s: %v; not restarting it", h.Name, err)
+			return
+		}
+		if err == nil {
+			err = errors.New("exited")
+		}
+		if s.clock.Since(started) >= stableAfter {
+			restarts = 0
+		}
+		delay := backoff(restarts)
+		restarts++
+		s.Logger.Error("helper %s: %v; restarting in %v", h.Name, err, delay)
+		select {
+		case <-s.clock.After(delay):
+		case <-ctx.Done():
+			s.Logger.Info("helper %s: stopped", h.Name)
+			return
+		}
+	}
+}
+
+// backoff returns the wait before restart n, counting from 0.
+func backoff(n int) time.Duration {
+	d := initialBackoff << n
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return d
+}
+
+// execHelper runs h until it exits or ctx is cancelled, when it is asked
+// to terminate and killed after stopTimeout.
+func (s *Supervisor) execHelper(ctx context.Context, h Helper) error {
+	if err := checkExecutable(h.Path); err != nil {
+		return fmt.Errorf("%w: %v", errNotRunnable, err)
+	}
+	stdout := &lineLogger{logger: s.Logger, name: h.Name}
+	stderr := &lineLogger{logger: s.Logger, name: h.Name}
+	cmd := exec.CommandContext(ctx, h.Path, h.Args...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.Cancel = func() error { return terminate(cmd.Process) }
+	cmd.WaitDelay = stopTimeout
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	return err
+}
+
+// lineLogger writes a helper's output to the log, one entry per line.
+type lineLogger struct {
+	logger *logging.Logger
+	name   string
+	buf    []byte
+}
+
+// maxLine caps a line held back waiting for its newline.
+const maxLine = 4096
+
+func (w *lineLogger) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) > maxLine {
+		w.flush()
+	}
+	return len(p), nil
+}
+
+// flush logs a partial last line.
+func (w *lineLogger) flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *lineLogger) emit(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) > 0 {
+		w.logger.Info("helper %s: %s", w.name, line)
+	}
+}
@@ -0,0 +1,120 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/clock"
+	"github.com/user/extorvm/controller/internal/testutil"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	s := New(logger)
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.clock = clk
+	runs := make(chan time.Time, 10)
+	s.exec = func(ctx context.Context, h Helper) error {
+		runs <- clk.Now()
+		return errors.New("exit status 1")
+	}
+
+	s.Start(Helper{Name: "dns", Path: "/usr/bin/dnsproxy"})
+	start := <-runs
+	for _, want := range []time.Duration{time.Second, 3 * time.Second, 7 * time.Second} {
+		clk.BlockUntil(1)
+		clk.Advance(want - clk.Since(start) - time.Millisecond)
+		select {
+		case <-runs:
+			t.Fatalf("restarted before %v", want)
+		default:
+		}
+		clk.Advance(time.Millisecond)
+		if got := (<-runs).Sub(start); got != want {
+			t.Errorf("restarted after %v, want %v", got, want)
+		}
+	}
+	if got := s.Running(); !slices.Equal(got, []string{"dns"}) {
+		t.Errorf("Running = %v, want [dns]", got)
+	}
+	s.StopAll()
+	if got := s.Running(); len(got) != 0 {
+		t.Errorf("Running after StopAll = %v", got)
+	}
+}
+
+func TestStopAndStartAgain(t *testing.T) {
+	logger, _ := testutil.NewTestLogger()
+	s := New(logger)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	s.exec = func(ctx context.Context, h Helper) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		<-release // exiting takes a while
+		return ctx.Err()
+	}
+
+	h := Helper{Name: "pt", Path: "/usr/bin/lyrebird"}
+	s.Start(h)
+	<-started
+	s.Start(h) // already running
+	s.Stop("pt")
+	s.Start(h) // waits for the first to exit
+	select {
+	case <-started:
+		t.Fatal("second instance started while the first was still exiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-started
+	s.StopAll()
+}
+
+func TestNotRunnableIsNotRestarted(t *testing.T) {
+	logger, buf := testutil.NewTestLogger()
+	s := New(logger)
+	s.Start(Helper{Name: "missing", Path: filepath.Join(t.TempDir(), "nope")})
+	s.mu.Lock()
+	done := s.helpers["missing"].done
+	s.mu.Unlock()
+	<-done
+	if got := s.Running(); len(got) != 0 {
+		t.Errorf("Running = %v after the helper was given up on", got)
+	}
+	if !strings.Contains(buf.String(), "not restarting it") {
+		t.Errorf("log does not say the helper is given up on:\n%s", buf.String())
+	}
+}
+
+func TestHelperOutputIsLogged(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "helper.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho listening on 127.0.0.1:5353\necho warning >&2\nprintf partial\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	logger, buf := testutil.NewTestLogger()
+	s := New(logger)
+	if err := s.execHelper(context.Background(), Helper{Name: "dns", Path: script}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"helper dns: listening on 127.0.0.1:5353", "helper dns: warning", "helper dns: partial"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	os.Chmod(script, 0777)
+	if err := s.execHelper(context.Background(), Helper{Name: "dns", Path: script}); !errors.Is(err, errNotRunnable) {
+		t.Errorf("world-writable helper: err = %v, want errNotRunnable", err)
+	}
+}
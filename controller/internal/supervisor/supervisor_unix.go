@@ -0,0 +1,30 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkExecutable refuses a helper that is not a regular executable file
+// or that other users could replace: the controller runs it as root.
+func checkExecutable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() || fi.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not an executable file", path)
+	}
+	if perm := fi.Mode().Perm(); perm&0022 != 0 {
+		return fmt.Errorf("%s has insecure permissions %04o; must not be group-writable or world-writable", path, perm)
+	}
+	return nil
+}
+
+// terminate asks p to exit.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkExecutable refuses a helper that is not a regular file. Windows
+// file modes do not reflect ACLs, so permissions are left to them.
+func checkExecutable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not an executable file", path)
+	}
+	return nil
+}
+
+// terminate stops p. Windows has no termination signal to send a
+// console-less child, so it is killed.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
@@ -3,44 +3,90 @@
 package systemd
 
 import (
+	"encoding/binary"
 	"fmt"
+	"maps"
 	"net"
+	"os"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/logging"
 )
 
 const journalSocket = "/run/systemd/journal/socket"
 
-// JournalWriter implements io.Writer and sends log entries to the systemd
-// journal via the native journal protocol socket at /run/systemd/journal/socket.
-// Each Write call sends one journal entry with MESSAGE and PRIORITY fields.
+// syslogIdentifier tags the controller's journal entries, so
+// "journalctl -t torvm" finds them outside the unit too.
+const syslogIdentifier = "torvm"
+
+// JournalWriter sends log entries to the systemd journal via the native
+// journal protocol socket at /run/systemd/journal/socket. It implements
+// logging.EntryWriter, so each entry carries its level as the syslog
+// PRIORITY and the journal's own timestamp is the only one.
 type JournalWriter struct {
 	conn *net.UnixConn
+
+	mu     sync.Mutex
+	fields map[string]string // set with SetField, added to every entry
 }
 
 // NewJournalWriter opens a connection to the systemd journal socket.
 func NewJournalWriter() (*JournalWriter, error) {
+	return newJournalWriter(journalSocket)
+}
+
+func newJournalWriter(path string) (*JournalWriter, error) {
 	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{
-		Name: journalSocket,
+		Name: path,
 		Net:  "unixgram",
 	})
 	if err != nil {
 		return nil, fmt.Errorf("systemd: dial journal socket: %w", err)
 	}
-	return &JournalWriter{conn: conn}, nil
+	return &JournalWriter{conn: conn, fields: make(map[string]string)}, nil
 }
 
-// Write sends p as a journal MESSAGE with PRIORITY=6 (informational).
-// It satisfies the io.Writer interface.
-func (w *JournalWriter) Write(p []byte) (int, error) {
-	msg := strings.TrimRight(string(p), "\n")
+// SetField adds the journal field name=value to every later entry, or
+// removes it if value is empty. Names are upper case letters, digits and
+// underscores, e.g. "TORVM_STATE", which "journalctl TORVM_STATE=Running"
+// then matches.
+func (w *JournalWriter) SetField(name, value string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if value == "" {
+		delete(w.fields, name)
+	} else {
+		w.fields[name] = value
+	}
+}
 
-	// Journal native protocol: KEY=VALUE pairs separated by newlines.
-	// PRIORITY follows syslog levels: 6 = informational.
-	entry := "PRIORITY=6\nMESSAGE=" + msg + "\n"
+// WriteEntry sends one journal entry with msg as its MESSAGE.
+func (w *JournalWriter) WriteEntry(_ time.Time, lvl logging.Level, msg string) error {
+	var b []byte
+	b = appendField(b, "MESSAGE", msg)
+	b = appendField(b, "PRIORITY", priority(lvl))
+	b = appendField(b, "SYSLOG_IDENTIFIER", syslogIdentifier)
+	w.mu.Lock()
+	for _, k := range slices.Sorted(maps.Keys(w.fields)) {
+		b = appendField(b, k, w.fields[k])
+	}
+	w.mu.Unlock()
 
-	_, err := w.conn.Write([]byte(entry))
-	if err != nil {
-		return 0, fmt.Errorf("systemd: write journal: %w", err)
+	if _, err := w.conn.Write(b); err != nil {
+		return fmt.Errorf("systemd: write journal: %w", err)
+	}
+	return nil
+}
+
+// Write sends p as an informational journal entry, for use as a plain
+// io.Writer.
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	if err := w.WriteEntry(time.Now(), logging.LevelInfo, strings.TrimRight(string(p), "\n")); err != nil {
+		return 0, err
 	}
 	return len(p), nil
 }
@@ -49,3 +95,49 @@ func (w *JournalWriter) Write(p []byte) (int, error) {
 func (w *JournalWriter) Close() error {
 	return w.conn.Close()
 }
+
+// priority maps a log level to a syslog priority: err, info, or debug.
+func priority(lvl logging.Level) string {
+	switch lvl {
+	case logging.LevelError:
+		return "3"
+	case logging.LevelDebug:
+		return "7"
+	default:
+		return "6"
+	}
+}
+
+// appendField encodes one field in the native journal protocol: NAME=value
+// and a newline, or, for a value that holds a newline itself, the name,
+// a newline, the value's length as a little-endian uint64, the value, and
+// a newline.
+func appendField(b []byte, name, value string) []byte {
+	if !strings.Contains(value, "\n") {
+		b = append(b, name...)
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, name...)
+	b = append(b, '\n')
+	b = binary.LittleEndian.AppendUint64(b, uint64(len(value)))
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// StderrIsJournal reports whether stderr is connected to the journal, as
+// systemd sets it up for a service: JOURNAL_STREAM then names the device
+// and inode of the stream. Lines written there would reach the journal a
+// second time, with a timestamp of their own and no priority.
+func StderrIsJournal() bool {
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(os.Getenv("JOURNAL_STREAM"), "%d:%d", &dev, &ino); err != nil {
+		return false
+	}
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(os.Stderr.Fd()), &st); err != nil {
+		return false
+	}
+	return uint64(st.Dev) == dev && uint64(st.Ino) == ino
+}
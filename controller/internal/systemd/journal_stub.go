@@ -2,7 +2,12 @@
 
 package systemd
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/logging"
+)
 
 // JournalWriter is a stub for non-Linux platforms.
 type JournalWriter struct{}
@@ -13,6 +18,14 @@ func NewJournalWriter() (*JournalWriter, error) {
 	return nil, fmt.Errorf("systemd: journal not available on this platform")
 }
 
+// SetField is a no-op stub.
+func (w *JournalWriter) SetField(_, _ string) {}
+
+// WriteEntry is a stub that always returns an error.
+func (w *JournalWriter) WriteEntry(_ time.Time, _ logging.Level, _ string) error {
+	return fmt.Errorf("systemd: journal not available on this platform")
+}
+
 // Write is a stub that always returns an error.
 func (w *JournalWriter) Write(p []byte) (int, error) {
 	return 0, fmt.Errorf("systemd: journal not available on this platform")
@@ -22,3 +35,6 @@ func (w *JournalWriter) Write(p []byte) (int, error) {
 func (w *JournalWriter) Close() error {
 	return nil
 }
+
+// StderrIsJournal always returns false on non-Linux platforms.
+func StderrIsJournal() bool { return false }
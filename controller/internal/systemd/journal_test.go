@@ -0,0 +1,60 @@
+//go:build linux
+
+package systemd
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+func TestAppendField(t *testing.T) {
+	if got := string(appendField(nil, "MESSAGE", "hello")); got != "MESSAGE=hello\n" {
+		t.Errorf("simple field = %q", got)
+	}
+	got := appendField(nil, "MESSAGE", "a\nb")
+	want := append([]byte("MESSAGE\n"), binary.LittleEndian.AppendUint64(nil, 3)...)
+	want = append(want, "a\nb\n"...)
+	if string(got) != string(want) {
+		t.Errorf("multi-line field = %q, want %q", got, want)
+	}
+}
+
+func TestJournalWriterEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.sock")
+	srv, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	w, err := newJournalWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.SetField("TORVM_STATE", "WaitBootstrap")
+	if err := w.WriteEntry(time.Now(), logging.LevelError, "bootstrap stalled"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4096)
+	srv.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := srv.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(buf[:n])
+	for _, want := range []string{"MESSAGE=bootstrap stalled\n", "PRIORITY=3\n", "SYSLOG_IDENTIFIER=torvm\n", "TORVM_STATE=WaitBootstrap\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("entry lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "UTC]") {
+		t.Errorf("entry carries a formatted timestamp:\n%s", got)
+	}
+}
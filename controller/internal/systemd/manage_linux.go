@@ -7,13 +7,16 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/privexec"
+	"github.com/user/extorvm/controller/internal/servicefile"
 )
 
 const (
-	unitName = "torvm.service"
-	unitPath = "/etc/systemd/system/" + unitName
-	// bundledUnit is the path to the unit file shipped with the binary.
-	bundledUnit = "/usr/local/share/torvm/torvm.service"
+	unitName   = "torvm.service"
+	unitPath   = "/etc/systemd/system/" + unitName
+	binaryPath = "/usr/local/bin/torvm"
 )
 
 // ServiceStatus holds the current state of the systemd service.
@@ -25,61 +28,87 @@ type ServiceStatus struct {
 	Status    string
 }
 
-// Install copies the unit file and enables the service.
-func Install() error {
-	// Read bundled unit file.
-	data, err := os.ReadFile(bundledUnit)
+// Install generates the unit file with the overrides in svc, checks it
+// with systemd-analyze, installs it, and enables the service, asking for
+// authorization once if not run as root. The service may open
+// entropyDevice, the config's serial entropy device, if it is set.
+func Install(svc config.ServiceConfig, entropyDevice string) error {
+	spec := servicefile.Spec{
+		Description:   "TorVM - Transparent Tor Proxy Virtual Machine",
+		Program:       binaryPath,
+		Args:          svc.Args(),
+		ServiceConfig: svc,
+	}
+	if entropyDevice != "" {
+		spec.Devices = []string{entropyDevice}
+	}
+	unit, err := servicefile.Unit(spec)
 	if err != nil {
-		return fmt.Errorf("systemd: read unit file %s: %w", bundledUnit, err)
+		return fmt.Errorf("systemd: %w", err)
 	}
-
-	if err := os.WriteFile(unitPath, data, 0644); err != nil {
-		return fmt.Errorf("systemd: write unit file: %w", err)
+	if err := servicefile.ValidateUnit(unitName, unit); err != nil {
+		return fmt.Errorf("systemd: %w", err)
 	}
 
-	if err := systemctl("daemon-reload"); err != nil {
-		return fmt.Errorf("systemd: daemon-reload: %w", err)
+	tmp, err := os.CreateTemp("", "torvm-unit-*.service")
+	if err != nil {
+		return fmt.Errorf("systemd: create temp file: %w", err)
 	}
-
-	if err := systemctl("enable", unitName); err != nil {
-		return fmt.Errorf("systemd: enable: %w", err)
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(unit); err != nil {
+		tmp.Close()
+		return fmt.Errorf("systemd: write temp unit: %w", err)
+	}
+	tmp.Close()
+
+	if err := privexec.RunAll(
+		privexec.Command("install", "-m", "0644", tmp.Name(), unitPath),
+		privexec.Command("systemctl", "daemon-reload"),
+		privexec.Command("systemctl", "enable", unitName),
+	); err != nil {
+		return fmt.Errorf("systemd: install: %w", err)
 	}
-
 	return nil
 }
 
 // Uninstall stops, disables, and removes the service unit file.
 func Uninstall() error {
-	_ = systemctl("stop", unitName)
-	_ = systemctl("disable", unitName)
-	os.Remove(unitPath)
-	_ = systemctl("daemon-reload")
+	stop := privexec.Command("systemctl", "stop", unitName)
+	stop.MayFail = true
+	disable := privexec.Command("systemctl", "disable", unitName)
+	disable.MayFail = true
+	if err := privexec.RunAll(stop, disable,
+		privexec.Command("rm", "-f", unitPath),
+		privexec.Command("systemctl", "daemon-reload"),
+	); err != nil {
+		return fmt.Errorf("systemd: uninstall: %w", err)
+	}
 	return nil
 }
 
 // Start starts the systemd service.
 func Start() error {
-	return systemctl("start", unitName)
+	return privexec.Run("systemctl", "start", unitName)
 }
 
 // Stop stops the systemd service.
 func Stop() error {
-	return systemctl("stop", unitName)
+	return privexec.Run("systemctl", "stop", unitName)
 }
 
 // Restart restarts the systemd service.
 func Restart() error {
-	return systemctl("restart", unitName)
+	return privexec.Run("systemctl", "restart", unitName)
 }
 
 // Enable enables the service to start on boot.
 func Enable() error {
-	return systemctl("enable", unitName)
+	return privexec.Run("systemctl", "enable", unitName)
 }
 
 // Disable disables the service from starting on boot.
 func Disable() error {
-	return systemctl("disable", unitName)
+	return privexec.Run("systemctl", "disable", unitName)
 }
 
 // QueryStatus returns the current service status.
@@ -139,11 +168,10 @@ func ReadJournalLogs(n int) (string, error) {
 	return out, nil
 }
 
+// systemctl runs a systemctl query, such as is-active, for its exit status.
+// Commands that change the system go through privexec.
 func systemctl(args ...string) error {
-	cmd := exec.Command("systemctl", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return exec.Command("systemctl", args...).Run()
 }
 
 func systemctlOutput(args ...string) (string, error) {
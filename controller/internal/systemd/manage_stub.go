@@ -2,6 +2,8 @@
 
 package systemd
 
+import "github.com/user/extorvm/controller/internal/config"
+
 // ServiceStatus holds the current state of the systemd service.
 type ServiceStatus struct {
 	Installed bool
@@ -12,7 +14,7 @@ type ServiceStatus struct {
 }
 
 // Install is a no-op on non-Linux platforms.
-func Install() error { return nil }
+func Install(_ config.ServiceConfig, _ string) error { return nil }
 
 // Uninstall is a no-op on non-Linux platforms.
 func Uninstall() error { return nil }
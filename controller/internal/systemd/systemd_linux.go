@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"strconv"
+	"time"
 )
 
 // IsRunningUnderSystemd returns true if the process was started by systemd,
@@ -39,6 +40,26 @@ func Status(status string) error {
 	return notify("STATUS=" + status)
 }
 
+// ExtendTimeout asks systemd to wait d longer for the service to report
+// READY=1 before it gives up on the start, so a slow Tor bootstrap does
+// not outlast TimeoutStartSec.
+func ExtendTimeout(d time.Duration) error {
+	return notify("EXTEND_TIMEOUT_USEC=" + strconv.FormatInt(d.Microseconds(), 10))
+}
+
+// WatchdogInterval returns how often to call Watchdog: half the
+// WatchdogSec systemd set for this process, or false if it set none.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
+
 // MainPID sends MAINPID=<pid> to systemd, identifying the main process.
 func MainPID(pid int) error {
 	return notify("MAINPID=" + strconv.Itoa(pid))
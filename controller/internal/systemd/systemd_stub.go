@@ -2,6 +2,8 @@
 
 package systemd
 
+import "time"
+
 // IsRunningUnderSystemd always returns false on non-Linux platforms.
 func IsRunningUnderSystemd() bool { return false }
 
@@ -17,5 +19,11 @@ func Watchdog() error { return nil }
 // Status is a no-op on non-Linux platforms.
 func Status(_ string) error { return nil }
 
+// ExtendTimeout is a no-op on non-Linux platforms.
+func ExtendTimeout(_ time.Duration) error { return nil }
+
+// WatchdogInterval always returns false on non-Linux platforms.
+func WatchdogInterval() (time.Duration, bool) { return 0, false }
+
 // MainPID is a no-op on non-Linux platforms.
 func MainPID(_ int) error { return nil }
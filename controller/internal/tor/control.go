@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -116,7 +117,7 @@ func (c *ControlClient) SetConf(directives map[string]string) error {
 		if err := validateNoNewlines(v); err != nil {
 			return fmt.Errorf("tor: setconf value: %w", err)
 		}
-		parts = append(parts, fmt.Sprintf("%s=%s", k, v))
+		parts = append(parts, k+"="+quoteConfValue(v))
 	}
 
 	lines, err := c.sendCommand("SETCONF " + strings.Join(parts, " "))
@@ -126,6 +127,53 @@ func (c *ControlClient) SetConf(directives map[string]string) error {
 	return expectOK(lines)
 }
 
+// quoteConfValue returns v as a SETCONF value: as it is if it is one
+// word, else as a quoted string, such as a bridge line needs.
+func quoteConfValue(v string) string {
+	if !strings.ContainsAny(v, " \t\"\\") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// GetConf retrieves the values Tor uses for the given configuration
+// options. An option given more than once, such as Bridge, has a value
+// per line; an option left at its default has none.
+func (c *ControlClient) GetConf(keys ...string) (map[string][]string, error) {
+	for _, k := range keys {
+		if err := validateNoNewlines(k); err != nil {
+			return nil, fmt.Errorf("tor: getconf: %w", err)
+		}
+	}
+
+	lines, err := c.sendCommand("GETCONF " + strings.Join(keys, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]string, len(keys))
+	for _, line := range lines {
+		// Lines are like "250-Bridge=obfs4 ..." or "250 UseBridges" for
+		// an option at its default.
+		body := stripStatusPrefix(line)
+		key, value, ok := strings.Cut(body, "=")
+		if !ok {
+			if _, seen := result[key]; !seen {
+				result[key] = nil
+			}
+			continue
+		}
+		// Tor quotes a value with characters a torrc line cannot hold.
+		if strings.HasPrefix(value, "\"") {
+			if uq, err := strconv.Unquote(value); err == nil {
+				value = uq
+			}
+		}
+		result[key] = append(result[key], value)
+	}
+	return result, nil
+}
+
 // SetEvents subscribes to the given async events (e.g. BW, CIRC, STATUS_CLIENT).
 func (c *ControlClient) SetEvents(events []string) error {
 	for _, ev := range events {
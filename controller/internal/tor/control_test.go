@@ -214,6 +214,18 @@ func TestSetConfSuccess(t *testing.T) {
 	}
 }
 
+func TestQuoteConfValue(t *testing.T) {
+	for v, want := range map[string]string{
+		"600":                          "600",
+		"obfs4 192.0.2.1:443 cert=abc": `"obfs4 192.0.2.1:443 cert=abc"`,
+		`a "b" \c`:                     `"a \"b\" \\c"`,
+	} {
+		if got := quoteConfValue(v); got != want {
+			t.Errorf("quoteConfValue(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
+
 func TestSetConfFailure(t *testing.T) {
 	addr, conns := mockTorServer(t)
 
@@ -241,6 +253,50 @@ func TestSetConfFailure(t *testing.T) {
 	}
 }
 
+func TestGetConf(t *testing.T) {
+	addr, conns := mockTorServer(t)
+
+	done := make(chan struct{})
+	go func() {
+		conn := <-conns
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		cmd, _ := readCommand(r)
+		if cmd != "GETCONF Bridge UseBridges Socks5Proxy ContactInfo" {
+			t.Errorf("expected GETCONF of four options, got %q", cmd)
+		}
+		fmt.Fprintf(conn, "250-Bridge=obfs4 192.0.2.1:443 cert=abc iat-mode=0\r\n"+
+			"250-Bridge=obfs4 192.0.2.2:443 cert=def iat-mode=0\r\n"+
+			"250-UseBridges=1\r\n250-Socks5Proxy\r\n"+
+			"250 ContactInfo=\"a \\\"quoted\\\" value\"\r\n")
+		<-done
+	}()
+
+	client, err := NewControlClient(addr, 2*time.Second)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer func() { close(done); client.Close() }()
+
+	result, err := client.GetConf("Bridge", "UseBridges", "Socks5Proxy", "ContactInfo")
+	if err != nil {
+		t.Fatalf("getconf: %v", err)
+	}
+	if len(result["Bridge"]) != 2 || result["Bridge"][1] != "obfs4 192.0.2.2:443 cert=def iat-mode=0" {
+		t.Fatalf("unexpected Bridge values %q", result["Bridge"])
+	}
+	if v := result["UseBridges"]; len(v) != 1 || v[0] != "1" {
+		t.Fatalf("unexpected UseBridges values %q", v)
+	}
+	if v, ok := result["Socks5Proxy"]; !ok || len(v) != 0 {
+		t.Fatalf("expected Socks5Proxy at its default, got %q (present %v)", v, ok)
+	}
+	if v := result["ContactInfo"]; len(v) != 1 || v[0] != `a "quoted" value` {
+		t.Fatalf("unexpected ContactInfo values %q", v)
+	}
+}
+
 func TestAsyncEventDelivery(t *testing.T) {
 	addr, conns := mockTorServer(t)
 
@@ -436,3 +492,16 @@ func TestParseCircuitLineNoPath(t *testing.T) {
 		t.Fatalf("expected purpose GENERAL, got %q", ci.Purpose)
 	}
 }
+
+func TestParseStreamLine(t *testing.T) {
+	si := parseStreamLine("12 SUCCEEDED 5 example.com:443")
+	if si.ID != "12" || si.Status != "SUCCEEDED" || si.CircuitID != "5" || si.Target != "example.com:443" {
+		t.Fatalf("unexpected stream: %+v", si)
+	}
+	if !si.IsOpen() {
+		t.Fatal("SUCCEEDED stream should be open")
+	}
+	if parseStreamLine("13 CLOSED 5 example.com:80").IsOpen() {
+		t.Fatal("CLOSED stream should not be open")
+	}
+}
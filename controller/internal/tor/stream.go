@@ -0,0 +1,66 @@
+package tor
+
+import (
+	"strings"
+)
+
+// StreamInfo represents a Tor application stream.
+type StreamInfo struct {
+	ID        string
+	Status    string // NEW, SENTCONNECT, SUCCEEDED, FAILED, CLOSED, ...
+	CircuitID string
+	Target    string
+}
+
+// IsOpen reports whether the stream is still carrying (or about to carry)
+// traffic.
+func (s StreamInfo) IsOpen() bool {
+	switch s.Status {
+	case "FAILED", "CLOSED", "DETACHED":
+		return false
+	}
+	return true
+}
+
+// GetStreams retrieves the list of current Tor streams.
+func (c *ControlClient) GetStreams() ([]StreamInfo, error) {
+	info, err := c.GetInfo("stream-status")
+	if err != nil {
+		return nil, err
+	}
+
+	raw, ok := info["stream-status"]
+	if !ok {
+		return nil, nil
+	}
+
+	var streams []StreamInfo
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		streams = append(streams, parseStreamLine(line))
+	}
+	return streams, nil
+}
+
+// parseStreamLine parses a single stream-status line.
+// Format: StreamID SP StreamStatus SP CircuitID SP Target
+func parseStreamLine(line string) StreamInfo {
+	si := StreamInfo{}
+	fields := strings.Fields(line)
+	if len(fields) >= 1 {
+		si.ID = fields[0]
+	}
+	if len(fields) >= 2 {
+		si.Status = fields[1]
+	}
+	if len(fields) >= 3 {
+		si.CircuitID = fields[2]
+	}
+	if len(fields) >= 4 {
+		si.Target = fields[3]
+	}
+	return si
+}
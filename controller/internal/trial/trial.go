@@ -0,0 +1,269 @@
+// Package trial boots the VM with variants of the configuration, such as
+// two sets of bridges, and compares how Tor bootstraps with each, as a
+// support volunteer would by hand. Every boot runs against a throwaway
+// copy of the state disk holding the variant's torrc overlay, so neither
+// the user's overlay nor Tor's state on their disk is touched.
+package trial
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/storage"
+	"github.com/user/extorvm/controller/internal/vm"
+)
+
+// Variant is one configuration to try.
+type Variant struct {
+	Name   string
+	Config *config.Config
+}
+
+// Result is the outcome of one boot.
+type Result struct {
+	Variant   string
+	Run       int  // counting from 1
+	OK        bool // Tor bootstrapped within the timeout
+	Bootstrap time.Duration
+	Progress  int // the last bootstrap progress seen, 0-100
+	Summary   string
+	Error     string
+}
+
+// Runner boots the variants.
+type Runner struct {
+	Logger  *logging.Logger
+	Runs    int           // boots per variant
+	Timeout time.Duration // for one boot to bootstrap
+
+	// boot runs one trial of cfg; replaceable in tests.
+	boot func(ctx context.Context, cfg *config.Config) Result
+}
+
+// NewRunner returns a Runner that boots each variant runs times, giving
+// up on a boot after timeout.
+func NewRunner(logger *logging.Logger, runs int, timeout time.Duration) *Runner {
+	r := &Runner{Logger: logger, Runs: runs, Timeout: timeout}
+	r.boot = r.bootVM
+	return r
+}
+
+// Run boots the variants in turn, A B A B rather than A A B B, so a
+// change in network conditions during the test affects them alike. done,
+// if not nil, is called with each result as it comes in. Run stops early,
+// with the results so far, when ctx is cancelled.
+func (r *Runner) Run(ctx context.Context, variants []Variant, done func(Result)) []Result {
+	var results []Result
+	for run := 1; run <= r.Runs; run++ {
+		for _, v := range variants {
+			if ctx.Err() != nil {
+				return results
+			}
+			r.Logger.Info("trial: %s, run %d of %d", v.Name, run, r.Runs)
+			res := r.boot(ctx, v.Config)
+			res.Variant, res.Run = v.Name, run
+			results = append(results, res)
+			if done != nil {
+				done(res)
+			}
+		}
+	}
+	return results
+}
+
+// bootVM runs one session of cfg on a throwaway state disk, until Tor has
+// bootstrapped or the timeout passes, and shuts it down again.
+func (r *Runner) bootVM(ctx context.Context, cfg *config.Config) (res Result) {
+	dir, err := os.MkdirTemp("", "torvm-trial-*")
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer func() {
+		if cfg.WipeOnExit {
+			// The throwaway disk holds the variant's torrc overlay.
+			if err := storage.Shred([]storage.Item{{Path: dir}}); err != nil {
+				r.Logger.Error("trial: %v", err)
+			}
+		}
+		os.RemoveAll(dir)
+	}()
+
+	trialCfg := *cfg
+	trialCfg.StateDiskPath = filepath.Join(dir, "state.img")
+	if err := prepareDisk(trialCfg.StateDiskPath, cfg); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	engine := lifecycle.NewEngine(&trialCfg, r.Logger)
+	engine.Restart = lifecycle.RestartPolicy{}
+	var mu sync.Mutex
+	var progress int
+	var summary string
+	ready := make(chan struct{})
+	engine.Events.Subscribe(func(ev lifecycle.Event) {
+		switch {
+		case ev.Kind == lifecycle.EventBootstrap:
+			mu.Lock()
+			progress, summary = ev.Progress, ev.Summary
+			mu.Unlock()
+		case ev.Kind == lifecycle.EventState && ev.To == lifecycle.StateRunning:
+			select {
+			case <-ready:
+			default:
+				close(ready)
+			}
+		}
+	})
+	defer func() {
+		mu.Lock()
+		res.Summary = summary
+		if !res.OK {
+			res.Progress = progress
+		}
+		mu.Unlock()
+	}()
+
+	timer := time.NewTimer(r.Timeout)
+	defer timer.Stop()
+	start := time.Now()
+	runCh := engine.Start(ctx)
+	select {
+	case <-ready:
+		res.OK, res.Bootstrap, res.Progress = true, time.Since(start), 100
+	case err := <-runCh:
+		if err == nil {
+			err = errors.New("the session ended before Tor bootstrapped")
+		}
+		res.Error = err.Error()
+		return res
+	case <-timer.C:
+		res.Error = fmt.Sprintf("Tor did not bootstrap within %v", r.Timeout)
+	case <-ctx.Done():
+		res.Error = ctx.Err().Error()
+	}
+	// The VM is shut down and the host network restored even when ctx
+	// has been cancelled.
+	if err := <-engine.Stop(context.Background()); err != nil && !errors.Is(err, lifecycle.ErrNotRunning) {
+		r.Logger.Error("trial: shutdown: %v", err)
+	}
+	return res
+}
+
+// prepareDisk makes the throwaway state disk at path: a copy of cfg's
+// state disk if there is one, so Tor starts from the same cached
+// directory information in every trial, or an empty disk. It holds cfg's
+// torrc overlay, empty if cfg has none, so an overlay already on the
+// copied disk is not applied.
+func prepareDisk(path string, cfg *config.Config) error {
+	overlay, err := cfg.TorrcOverlay()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(cfg.StateDiskPath); err == nil {
+		err = vm.CopyStateDisk(path, cfg.StateDiskPath, nil)
+	} else {
+		err = vm.CreateStateDisk(path, vm.StateDiskSizes[0])
+	}
+	if err != nil {
+		return err
+	}
+	return vm.WriteTorrcOverlay(path, overlay)
+}
+
+// Summary sums up the results of one variant.
+type Summary struct {
+	Variant   string
+	Runs      int
+	OK        int
+	Median    time.Duration // bootstrap time of the successful runs
+	Fastest   time.Duration
+	LastError string
+}
+
+// Summarize sums up results by variant, in the order the variants first
+// appear.
+func Summarize(results []Result) []Summary {
+	var sums []Summary
+	times := make(map[string][]time.Duration)
+	for _, res := range results {
+		i := slices.IndexFunc(sums, func(s Summary) bool { return s.Variant == res.Variant })
+		if i < 0 {
+			sums = append(sums, Summary{Variant: res.Variant})
+			i = len(sums) - 1
+		}
+		sums[i].Runs++
+		if res.OK {
+			sums[i].OK++
+			times[res.Variant] = append(times[res.Variant], res.Bootstrap)
+		} else {
+			sums[i].LastError = res.Error
+		}
+	}
+	for i := range sums {
+		t := times[sums[i].Variant]
+		if len(t) == 0 {
+			continue
+		}
+		slices.Sort(t)
+		sums[i].Fastest = t[0]
+		if n := len(t); n%2 == 1 {
+			sums[i].Median = t[n/2]
+		} else {
+			sums[i].Median = (t[n/2-1] + t[n/2]) / 2
+		}
+	}
+	return sums
+}
+
+// clearMargin is how much faster a variant must bootstrap, as a fraction
+// of the other's median, to be recommended on speed alone.
+const clearMargin = 0.1
+
+// Recommend picks the variant that bootstrapped most reliably, and of
+// those the fastest, with the reason. It returns "" when every boot
+// failed, or when the best variants did equally well within clearMargin.
+func Recommend(sums []Summary) (variant, reason string) {
+	ranked := slices.Clone(sums)
+	slices.SortStableFunc(ranked, func(a, b Summary) int {
+		if ra, rb := rate(a), rate(b); ra != rb {
+			if ra > rb {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Median, b.Median)
+	})
+	if len(ranked) == 0 || ranked[0].OK == 0 {
+		return "", "no variant bootstrapped"
+	}
+	best := ranked[0]
+	reason = fmt.Sprintf("%d of %d runs bootstrapped, median %v", best.OK, best.Runs, best.Median.Round(time.Second))
+	if len(ranked) == 1 {
+		return best.Variant, reason
+	}
+	next := ranked[1]
+	if rate(next) == rate(best) && float64(next.Median-best.Median) <= clearMargin*float64(next.Median) {
+		return "", fmt.Sprintf("no clear difference between %s and %s", best.Variant, next.Variant)
+	}
+	return best.Variant, reason
+}
+
+// rate is the fraction of a variant's runs that bootstrapped.
+func rate(s Summary) float64 {
+	if s.Runs == 0 {
+		return 0
+	}
+	return float64(s.OK) / float64(s.Runs)
+}
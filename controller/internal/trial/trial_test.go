@@ -0,0 +1,89 @@
+package trial
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+func TestRunInterleaves(t *testing.T) {
+	logger, _ := logging.NewLogger(logging.Options{NoStderr: true})
+	a, b := config.DefaultConfig(), config.DefaultConfig()
+	r := NewRunner(logger, 2, time.Minute)
+	var booted []*config.Config
+	r.boot = func(ctx context.Context, cfg *config.Config) Result {
+		booted = append(booted, cfg)
+		return Result{OK: true, Bootstrap: time.Second}
+	}
+	var done []string
+	results := r.Run(context.Background(), []Variant{{"a", a}, {"b", b}}, func(res Result) {
+		done = append(done, res.Variant)
+	})
+	if !slices.Equal(booted, []*config.Config{a, b, a, b}) {
+		t.Error("variants were not booted in turn")
+	}
+	if !slices.Equal(done, []string{"a", "b", "a", "b"}) || len(results) != 4 || results[3].Run != 2 {
+		t.Errorf("results = %+v", results)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.boot = func(context.Context, *config.Config) Result {
+		cancel()
+		return Result{Error: "context canceled"}
+	}
+	if results := r.Run(ctx, []Variant{{"a", a}, {"b", b}}, nil); len(results) != 1 {
+		t.Errorf("Run went on for %d boots after cancellation", len(results))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	sums := Summarize([]Result{
+		{Variant: "a", OK: true, Bootstrap: 40 * time.Second},
+		{Variant: "b", Error: "timeout"},
+		{Variant: "a", OK: true, Bootstrap: 20 * time.Second},
+		{Variant: "b", OK: true, Bootstrap: 30 * time.Second},
+		{Variant: "a", OK: true, Bootstrap: 90 * time.Second},
+	})
+	want := []Summary{
+		{Variant: "a", Runs: 3, OK: 3, Median: 40 * time.Second, Fastest: 20 * time.Second},
+		{Variant: "b", Runs: 2, OK: 1, Median: 30 * time.Second, Fastest: 30 * time.Second, LastError: "timeout"},
+	}
+	if !slices.Equal(sums, want) {
+		t.Errorf("Summarize = %+v, want %+v", sums, want)
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	tests := []struct {
+		name string
+		sums []Summary
+		want string
+	}{
+		{"more reliable wins over faster", []Summary{
+			{Variant: "a", Runs: 3, OK: 2, Median: 20 * time.Second},
+			{Variant: "b", Runs: 3, OK: 3, Median: 60 * time.Second},
+		}, "b"},
+		{"equally reliable, clearly faster", []Summary{
+			{Variant: "a", Runs: 3, OK: 3, Median: 60 * time.Second},
+			{Variant: "b", Runs: 3, OK: 3, Median: 30 * time.Second},
+		}, "b"},
+		{"no clear difference", []Summary{
+			{Variant: "a", Runs: 3, OK: 3, Median: 60 * time.Second},
+			{Variant: "b", Runs: 3, OK: 3, Median: 57 * time.Second},
+		}, ""},
+		{"all failed", []Summary{
+			{Variant: "a", Runs: 2},
+			{Variant: "b", Runs: 2},
+		}, ""},
+	}
+	for _, tt := range tests {
+		got, reason := Recommend(tt.sums)
+		if got != tt.want || reason == "" {
+			t.Errorf("%s: Recommend = %q (%s), want %q", tt.name, got, reason, tt.want)
+		}
+	}
+}
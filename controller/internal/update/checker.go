@@ -14,6 +14,13 @@ import (
 // Version is the current application version. Set at build time via ldflags.
 var Version = "0.1.0"
 
+// DefaultOwner and DefaultRepo identify the GitHub repository checked for
+// new releases.
+const (
+	DefaultOwner = "sonoransun"
+	DefaultRepo  = "torvmremix"
+)
+
 // GitHubRelease represents a subset of the GitHub Releases API response.
 type GitHubRelease struct {
 	TagName string `json:"tag_name"`
@@ -88,6 +95,13 @@ func (c *Checker) Stop() {
 	}
 }
 
+// CheckNow performs a single update check synchronously, notifying
+// observers if the result changed.
+func (c *Checker) CheckNow() UpdateInfo {
+	c.check()
+	return c.Latest()
+}
+
 func (c *Checker) loop() {
 	c.check()
 	ticker := time.NewTicker(c.interval)
@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+// errAttachedExit is what Wait returns when an attached QEMU exits on
+// Unix, where the exit status of a process that is not a child is lost.
+var errAttachedExit = errors.New("qemu exited (exit status unknown)")
+
+// Attach adopts a QEMU process that a crashed controller started, so the
+// VM keeps running and Tor keeps its circuits. pid must be alive and a
+// QEMU must answer on the QMP socket at qmpPath, which must be this
+// instance's; a reused PID or a stale socket fails.
+func (inst *Instance) Attach(pid int, qmpPath string) error {
+	if qmpPath != inst.Config.QMPSocketPath {
+		return fmt.Errorf("vm: attach: QMP socket moved from %s to %s", qmpPath, inst.Config.QMPSocketPath)
+	}
+	proc, err := findProcess(pid)
+	if err != nil {
+		return fmt.Errorf("vm: attach: %w", err)
+	}
+	// The start time tells QEMU from a later process given its PID.
+	start, err := platform.ProcessStart(pid)
+	if err != nil {
+		proc.Release()
+		return fmt.Errorf("vm: attach: %w", err)
+	}
+	qmp, err := NewQMPClient(qmpPath)
+	if err == nil {
+		_, _, err = qmp.QueryStatus()
+		qmp.Close()
+	}
+	if err != nil {
+		proc.Release()
+		return fmt.Errorf("vm: attach: %w", err)
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.running {
+		proc.Release()
+		return fmt.Errorf("vm: already running")
+	}
+	select {
+	case <-inst.waitErr:
+	default:
+	}
+	inst.attached = proc
+	inst.running = true
+	go func() {
+		err := waitProcess(proc, start)
+		inst.mu.Lock()
+		inst.running = false
+		inst.attached = nil
+		inst.mu.Unlock()
+		inst.waitErr <- err
+	}()
+	inst.Logger.Info("attached to QEMU process %d", pid)
+	return nil
+}
+
+// PID returns the QEMU process ID, or 0 if the VM is not running.
+func (inst *Instance) PID() int {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if p := inst.process(); p != nil && inst.running {
+		return p.Pid
+	}
+	return 0
+}
+
+// process returns the QEMU process, started or attached. The caller
+// holds mu.
+func (inst *Instance) process() *os.Process {
+	if inst.attached != nil {
+		return inst.attached
+	}
+	if inst.Process != nil {
+		return inst.Process.Process
+	}
+	return nil
+}
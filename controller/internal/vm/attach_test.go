@@ -0,0 +1,30 @@
+package vm
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWaitProcessReusedPID(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows waits on a process handle")
+	}
+	self, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The PID is alive, but not the process that started at start.
+	done := make(chan error, 1)
+	go func() { done <- waitProcess(self, "an earlier process") }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errAttachedExit) {
+			t.Errorf("waitProcess = %v, want %v", err, errAttachedExit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("waitProcess still waits on a PID another process took")
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package vm
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/platform"
+)
+
+// findProcess returns process pid if it is alive.
+func findProcess(pid int) (*os.Process, error) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Signal(syscall.Signal(0)); err != nil {
+		return nil, fmt.Errorf("process %d: %w", pid, err)
+	}
+	return p, nil
+}
+
+// waitProcess waits for p, which started at start (as
+// platform.ProcessStart gives it), to exit. Unix only lets a parent wait
+// for its children, so it polls, and a later process given the same PID
+// counts as the exit.
+func waitProcess(p *os.Process, start string) error {
+	for {
+		if cur, err := platform.ProcessStart(p.Pid); err != nil || cur != start {
+			return errAttachedExit
+		}
+		time.Sleep(time.Second)
+	}
+}
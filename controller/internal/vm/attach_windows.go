@@ -0,0 +1,31 @@
+//go:build windows
+
+package vm
+
+import (
+	"fmt"
+	"os"
+)
+
+// findProcess returns process pid if it is alive.
+func findProcess(pid int) (*os.Process, error) {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("process %d: %w", pid, err)
+	}
+	return p, nil
+}
+
+// waitProcess waits for p to exit. Windows can wait for any process it
+// holds a handle to, and the handle keeps the PID from being reused, so
+// start is not needed.
+func waitProcess(p *os.Process, start string) error {
+	st, err := p.Wait()
+	if err != nil {
+		return err
+	}
+	if !st.Success() {
+		return fmt.Errorf("qemu %s", st)
+	}
+	return nil
+}
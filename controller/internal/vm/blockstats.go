@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// StateDriveID is the QEMU drive id of the state disk (see blockArgs).
+const StateDriveID = "drive0"
+
+// BlockStats are the I/O counters of one block device, as returned by
+// query-blockstats.
+type BlockStats struct {
+	Device string `json:"device"`
+	Stats  struct {
+		RdBytes         int64 `json:"rd_bytes"`
+		WrBytes         int64 `json:"wr_bytes"`
+		RdOperations    int64 `json:"rd_operations"`
+		WrOperations    int64 `json:"wr_operations"`
+		FlushOperations int64 `json:"flush_operations"`
+		RdTotalTimeNs   int64 `json:"rd_total_time_ns"`
+		WrTotalTimeNs   int64 `json:"wr_total_time_ns"`
+	} `json:"stats"`
+}
+
+// IOThrottle holds the limits set by block_set_io_throttle. Zero means
+// unlimited; total and per-direction limits are mutually exclusive.
+type IOThrottle struct {
+	BPS       int64 `json:"bps"`
+	BPSRead   int64 `json:"bps_rd"`
+	BPSWrite  int64 `json:"bps_wr"`
+	IOPS      int64 `json:"iops"`
+	IOPSRead  int64 `json:"iops_rd"`
+	IOPSWrite int64 `json:"iops_wr"`
+}
+
+// DiskThrottle converts the configured state disk limits to an IOThrottle.
+func DiskThrottle(d config.DiskConfig) IOThrottle {
+	return IOThrottle{
+		BPSRead:   int64(d.ReadMBps) << 20,
+		BPSWrite:  int64(d.WriteMBps) << 20,
+		IOPSRead:  int64(d.ReadIOPS),
+		IOPSWrite: int64(d.WriteIOPS),
+	}
+}
+
+// QueryBlockstats returns the I/O counters of the VM's block devices.
+func (c *QMPClient) QueryBlockstats() ([]BlockStats, error) {
+	var stats []BlockStats
+	err := c.call("query-blockstats", nil, &stats)
+	return stats, err
+}
+
+// SetIOThrottle replaces the I/O limits of the drive with the given id.
+func (c *QMPClient) SetIOThrottle(drive string, t IOThrottle) error {
+	args := struct {
+		Device string `json:"device"`
+		IOThrottle
+	}{drive, t}
+	if err := c.call("block_set_io_throttle", args, nil); err != nil {
+		return fmt.Errorf("throttle %s: %w", drive, err)
+	}
+	return nil
+}
+
+// SetDiskThrottle applies d to the state disk of the running VM.
+func (inst *Instance) SetDiskThrottle(d config.DiskConfig) error {
+	qmp, err := NewQMPClient(inst.Config.QMPSocketPath)
+	if err != nil {
+		return err
+	}
+	defer qmp.Close()
+	return qmp.SetIOThrottle(StateDriveID, DiskThrottle(d))
+}
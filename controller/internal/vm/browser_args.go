@@ -89,8 +89,8 @@ func BuildBrowserArgs(cfg *config.Config) ([]string, error) {
 		"-device", "virtio-net-pci,netdev=net0",
 	)
 
-	// Virtio entropy device.
-	args = append(args, browserRngArgs()...)
+	// Virtio entropy device, rate-limited like the Tor VM's.
+	args = append(args, rngArgs(cfg)...)
 
 	// Virtio memory balloon.
 	args = append(args, "-device", "virtio-balloon-pci")
@@ -113,14 +113,22 @@ func BuildBrowserArgs(cfg *config.Config) ([]string, error) {
 	// QMP monitor socket.
 	if runtime.GOOS == "windows" {
 		args = append(args,
-			"-qmp", fmt.Sprintf("pipe:%s,server,nowait", bcfg.QMPSocketPath),
+			"-qmp", fmt.Sprintf("pipe:%s,server,nowait", optEscape(bcfg.QMPSocketPath)),
 		)
 	} else {
 		args = append(args,
-			"-qmp", fmt.Sprintf("unix:%s,server,nowait", bcfg.QMPSocketPath),
+			"-qmp", fmt.Sprintf("unix:%s,server,nowait", optEscape(bcfg.QMPSocketPath)),
 		)
 	}
 
+	// Make sure each configured path reaches QEMU whole.
+	if err := checkArgs(args, []optValue{
+		{name: "Browser.StateDiskPath", option: "-drive", prefix: "file=", value: bcfg.StateDiskPath, disk: true},
+		{name: "Browser.QMPSocketPath", option: "-qmp", prefix: qmpPrefix(), value: bcfg.QMPSocketPath},
+	}); err != nil {
+		return nil, err
+	}
+
 	return args, nil
 }
 
@@ -131,17 +139,17 @@ func browserBlockArgs(bcfg *config.BrowserConfig, accel string) []string {
 	case "kvm":
 		driveOpts = fmt.Sprintf(
 			"file=%s,id=drive0,if=none,format=raw,cache=none,aio=native",
-			bcfg.StateDiskPath,
+			optEscape(bcfg.StateDiskPath),
 		)
 	case "hvf", "whpx":
 		driveOpts = fmt.Sprintf(
 			"file=%s,id=drive0,if=none,format=raw,cache=writeback,aio=threads",
-			bcfg.StateDiskPath,
+			optEscape(bcfg.StateDiskPath),
 		)
 	default:
 		driveOpts = fmt.Sprintf(
 			"file=%s,id=drive0,if=none,format=raw,cache=writeback",
-			bcfg.StateDiskPath,
+			optEscape(bcfg.StateDiskPath),
 		)
 	}
 	return []string{
@@ -150,20 +158,6 @@ func browserBlockArgs(bcfg *config.BrowserConfig, accel string) []string {
 	}
 }
 
-// browserRngArgs returns virtio-rng arguments for the browser VM.
-func browserRngArgs() []string {
-	var rngBackend string
-	if runtime.GOOS == "windows" {
-		rngBackend = "rng-builtin,id=rng0"
-	} else {
-		rngBackend = "rng-random,id=rng0,filename=/dev/urandom"
-	}
-	return []string{
-		"-object", rngBackend,
-		"-device", "virtio-rng-pci,rng=rng0,max-bytes=1024,period=1000",
-	}
-}
-
 // browserSecwatchSocketPath returns the Unix socket path for the secwatch
 // virtio-serial channel.
 func browserSecwatchSocketPath(bcfg *config.BrowserConfig) string {
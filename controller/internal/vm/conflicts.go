@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// Conflict is a setting whose port or socket something else already
+// holds, found before the VM starts rather than as a stalled bootstrap
+// or a QMP connection to the wrong QEMU.
+type Conflict struct {
+	Key    string // the config key
+	Value  string
+	Reason string
+	Free   string // a value that would do instead, or ""
+}
+
+func (c Conflict) String() string {
+	s := fmt.Sprintf("%s %s %s", c.Key, c.Value, c.Reason)
+	if c.Free != "" {
+		s += fmt.Sprintf("; %s is free", c.Free)
+	}
+	return s
+}
+
+// PortConflicts checks Tor's ports in the VM, which the host reaches at
+// cfg.VMIP. Two of them conflict if they are the same. A port also
+// conflicts with a program listening on it on the host, if the VM
+// address is one of the host's own, where that program would answer
+// instead of Tor; with AutoSubnet set the VM is moved off such an
+// address, so that is not checked.
+func PortConflicts(cfg *config.Config) []Conflict {
+	ports := []struct {
+		key string
+		n   int
+	}{
+		{"socks_port", cfg.SOCKSPort},
+		{"control_port", cfg.ControlPort},
+		{"trans_port", cfg.TransPort},
+		{"dns_port", cfg.DNSPort},
+	}
+	var host net.IP
+	if !cfg.AutoSubnet {
+		if ip := net.ParseIP(cfg.VMIP); isHostAddr(ip) {
+			host = ip
+		}
+	}
+	inUse := func(port int) bool {
+		if host == nil {
+			return false
+		}
+		ln, err := net.Listen("tcp", net.JoinHostPort(host.String(), strconv.Itoa(port)))
+		if err != nil {
+			return true
+		}
+		ln.Close()
+		return false
+	}
+
+	taken := make(map[int]string, len(ports))
+	for _, p := range ports {
+		if _, ok := taken[p.n]; !ok {
+			taken[p.n] = p.key
+		}
+	}
+	var conflicts []Conflict
+	for _, p := range ports {
+		c := Conflict{Key: p.key, Value: strconv.Itoa(p.n)}
+		switch {
+		case taken[p.n] != p.key:
+			c.Reason = "is also " + taken[p.n]
+		case inUse(p.n):
+			c.Reason = fmt.Sprintf("is in use on %s, the VM's address, by a program on this host", host)
+		default:
+			continue
+		}
+		for free := p.n + 1; free <= 65535; free++ {
+			if _, ok := taken[free]; !ok && !inUse(free) {
+				taken[free] = p.key
+				c.Free = strconv.Itoa(free)
+				break
+			}
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts
+}
+
+// isHostAddr reports whether ip is assigned to one of the host's
+// interfaces.
+func isHostAddr(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if ip == nil || err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipn, ok := a.(*net.IPNet); ok && ipn.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// QMPSocketConflict returns a conflict if a process, such as the QEMU
+// of another TorVM instance, accepts connections on the QMP socket at
+// path: the VM's QEMU would take the path over, and the controller could
+// reach the other one first. A socket file nothing listens on is left
+// from a crash and is fine. Named pipes on Windows are not checked.
+func QMPSocketConflict(path string) *Conflict {
+	if runtime.GOOS == "windows" || !socketInUse(path) {
+		return nil
+	}
+	c := &Conflict{Key: "qmp_socket_path", Value: path, Reason: "is in use by another process, likely the QEMU of another TorVM instance"}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 2; i < 100; i++ {
+		if free := fmt.Sprintf("%s-%d%s", base, i, ext); !socketInUse(free) {
+			c.Free = free
+			break
+		}
+	}
+	return c
+}
+
+func socketInUse(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,52 @@
+package vm
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+func TestPortConflicts(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DNSPort = cfg.SOCKSPort
+	got := PortConflicts(cfg)
+	if len(got) != 1 || got[0].Key != "dns_port" || got[0].Reason != "is also socks_port" || got[0].Free != "9052" {
+		t.Errorf("duplicate port: %v", got)
+	}
+
+	// A program on the host holds a port at the VM's address.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	cfg = config.DefaultConfig()
+	cfg.VMIP = "127.0.0.1"
+	cfg.SOCKSPort = ln.Addr().(*net.TCPAddr).Port
+	if got := PortConflicts(cfg); len(got) != 0 {
+		t.Errorf("with auto_subnet: %v", got)
+	}
+	cfg.AutoSubnet = false
+	got = PortConflicts(cfg)
+	if len(got) != 1 || got[0].Key != "socks_port" || got[0].Free == "" {
+		t.Errorf("port in use: %v", got)
+	}
+}
+
+func TestQMPSocketConflict(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("QMP uses a named pipe")
+	}
+	srv := newMockQMPServer(t)
+	defer srv.Close()
+	c := QMPSocketConflict(srv.sockPath)
+	if c == nil || c.Free != filepath.Join(filepath.Dir(srv.sockPath), "qmp-2.sock") {
+		t.Errorf("socket in use: %v", c)
+	}
+	if c := QMPSocketConflict(filepath.Join(t.TempDir(), "qmp.sock")); c != nil {
+		t.Errorf("free socket: %v", c)
+	}
+}
@@ -0,0 +1,103 @@
+package vm
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// HotpluggableCPU is one vCPU slot, as returned by
+// query-hotpluggable-cpus. QOMPath is empty while the slot is free.
+type HotpluggableCPU struct {
+	Type       string         `json:"type"`
+	VCPUsCount int            `json:"vcpus-count"`
+	Props      map[string]int `json:"props"`
+	QOMPath    string         `json:"qom-path,omitempty"`
+}
+
+// cpuHotplug reports whether the accelerator supports adding vCPUs to a
+// running VM. WHPX and HVF are left out.
+func cpuHotplug(accel string) bool {
+	return accel == "kvm" || accel == "tcg"
+}
+
+// smpArg returns the -smp value. With CPU hot-plug the VM gets
+// config.MaxVMCPUs slots, of which VMCPUs are plugged at boot.
+func smpArg(cfg *config.Config, accel string) string {
+	if !cpuHotplug(accel) || cfg.VMCPUs >= config.MaxVMCPUs {
+		return fmt.Sprintf("%d", cfg.VMCPUs)
+	}
+	return fmt.Sprintf("%d,maxcpus=%d", cfg.VMCPUs, config.MaxVMCPUs)
+}
+
+// QueryHotpluggableCPUs lists the VM's vCPU slots.
+func (c *QMPClient) QueryHotpluggableCPUs() ([]HotpluggableCPU, error) {
+	var cpus []HotpluggableCPU
+	err := c.call("query-hotpluggable-cpus", nil, &cpus)
+	return cpus, err
+}
+
+// AddVCPUs plugs vCPUs into free slots, lowest topology ids first, until n
+// are plugged. Removing vCPUs needs the guest's cooperation and is not
+// supported; use a restart. Returns the number plugged afterwards.
+func (c *QMPClient) AddVCPUs(n int) (int, error) {
+	cpus, err := c.QueryHotpluggableCPUs()
+	if err != nil {
+		return 0, err
+	}
+	plugged := 0
+	var free []HotpluggableCPU
+	for _, cpu := range cpus {
+		if cpu.QOMPath != "" {
+			plugged += cpu.VCPUsCount
+		} else {
+			free = append(free, cpu)
+		}
+	}
+	if n < plugged {
+		return plugged, fmt.Errorf("removing vCPUs from a running VM is not supported")
+	}
+	if n-plugged > len(free) {
+		return plugged, fmt.Errorf("only %d free vCPU slots for %d more vCPUs (CPU hot-plug needs KVM or TCG)",
+			len(free), n-plugged)
+	}
+
+	// QEMU lists slots from the highest id down.
+	slices.SortFunc(free, func(a, b HotpluggableCPU) int {
+		return cmp.Or(
+			cmp.Compare(a.Props["socket-id"], b.Props["socket-id"]),
+			cmp.Compare(a.Props["core-id"], b.Props["core-id"]),
+			cmp.Compare(a.Props["thread-id"], b.Props["thread-id"]),
+		)
+	})
+	for _, cpu := range free {
+		if plugged >= n {
+			break
+		}
+		args := map[string]any{
+			"driver": cpu.Type,
+			"id":     fmt.Sprintf("vcpu%d", plugged),
+		}
+		for k, v := range cpu.Props {
+			args[k] = v
+		}
+		if err := c.DeviceAdd(args); err != nil {
+			return plugged, err
+		}
+		plugged += cpu.VCPUsCount
+	}
+	return plugged, nil
+}
+
+// SetVCPUs plugs vCPUs into the running VM until n are online; see
+// AddVCPUs. The guest onlines new vCPUs itself.
+func (inst *Instance) SetVCPUs(n int) (int, error) {
+	qmp, err := NewQMPClient(inst.Config.QMPSocketPath)
+	if err != nil {
+		return 0, err
+	}
+	defer qmp.Close()
+	return qmp.AddVCPUs(n)
+}
@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// entropyChannel is the name of the virtio-serial port over which the
+// controller reseeds the guest's entropy pool. The guest's init mixes
+// whatever arrives on it into /dev/urandom.
+const entropyChannel = "com.torvm.entropy"
+
+// EntropySocketPath returns the host end of the VM's entropy channel,
+// named after its QMP socket so that instances do not share one.
+func EntropySocketPath(cfg *config.Config) string {
+	if runtime.GOOS == "windows" {
+		return cfg.QMPSocketPath + "-entropy"
+	}
+	base := strings.TrimSuffix(filepath.Base(cfg.QMPSocketPath), ".sock")
+	return filepath.Join(filepath.Dir(cfg.QMPSocketPath), base+"-entropy.sock")
+}
+
+// entropyArgs returns QEMU arguments for the entropy channel, or nil when
+// periodic reseeding is off.
+func entropyArgs(cfg *config.Config) []string {
+	if cfg.Entropy.ReseedIntervalSec <= 0 {
+		return nil
+	}
+	path := optEscape(EntropySocketPath(cfg))
+	chardev := fmt.Sprintf("socket,id=entropy,path=%s,server=on,wait=off", path)
+	if runtime.GOOS == "windows" {
+		chardev = fmt.Sprintf("pipe,id=entropy,path=%s", path)
+	}
+	return []string{
+		"-device", "virtio-serial-pci,id=vserial0",
+		"-chardev", chardev,
+		"-device", "virtserialport,bus=vserial0.0,chardev=entropy,name=" + entropyChannel,
+	}
+}
+
+// Reseed sends n bytes from the host's CSPRNG to the running guest over
+// the entropy channel. It supplements the ENTROPY= seed the guest got at
+// boot, which is all it would otherwise receive from the host besides
+// the rate-limited virtio-rng device.
+func (inst *Instance) Reseed(n int) error {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("vm: reseed: %w", err)
+	}
+	conn, err := net.DialTimeout("unix", EntropySocketPath(inst.Config), 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("vm: reseed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(buf); err != nil {
+		return fmt.Errorf("vm: reseed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestBuildArgsEntropyChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.QMPSocketPath = filepath.Join(t.TempDir(), "qmp.sock")
+	cfg.Entropy.SerialEntropyDevice = "/dev/ttyUSB0"
+	args, err := testInstance(cfg).BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		sock := filepath.Join(filepath.Dir(cfg.QMPSocketPath), "qmp-entropy.sock")
+		assertContains(t, args, "-chardev", "socket,id=entropy,path="+sock+",server=on,wait=off")
+	}
+	assertContains(t, args, "-device", "virtserialport,bus=vserial0.0,chardev=entropy,name="+entropyChannel)
+
+	cfg.Entropy.ReseedIntervalSec = 0
+	if args, err = testInstance(cfg).BuildArgs(); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range args {
+		if a == "virtio-serial-pci,id=vserial0" {
+			t.Error("entropy channel present with reseeding off")
+		}
+	}
+}
+
+func TestReseed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the entropy channel is a named pipe on Windows")
+	}
+	cfg := testConfig()
+	cfg.QMPSocketPath = filepath.Join(t.TempDir(), "qmp.sock")
+	ln, err := net.Listen("unix", EntropySocketPath(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	got := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			got <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		got <- data
+	}()
+
+	if err := testInstance(cfg).Reseed(256); err != nil {
+		t.Fatal(err)
+	}
+	if data := <-got; len(data) != 256 {
+		t.Errorf("guest end received %d bytes, want 256", len(data))
+	}
+
+	ln.Close()
+	if err := testInstance(cfg).Reseed(256); err == nil {
+		t.Error("Reseed succeeded with no VM listening")
+	}
+}
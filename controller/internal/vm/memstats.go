@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+)
+
+// BalloonQOMPath is the QOM path of the VM's virtio-balloon device.
+const BalloonQOMPath = "/machine/peripheral/" + balloonID
+
+const balloonID = "balloon0"
+
+// BalloonInfo is the result of query-balloon.
+type BalloonInfo struct {
+	Actual int64 `json:"actual"` // guest RAM in bytes after ballooning
+}
+
+// Memdev describes a memory backend, as returned by query-memdev.
+type Memdev struct {
+	ID        string `json:"id,omitempty"`
+	Size      int64  `json:"size"` // bytes
+	Merge     bool   `json:"merge"`
+	Dump      bool   `json:"dump"`
+	Prealloc  bool   `json:"prealloc"`
+	Share     bool   `json:"share"`
+	HostNodes []int  `json:"host-nodes"`
+	Policy    string `json:"policy"`
+}
+
+// GuestMemStats are the guest's memory statistics as reported by the
+// balloon driver. Byte counts are -1 when the guest does not report them.
+type GuestMemStats struct {
+	LastUpdate int64 `json:"last-update"` // Unix time; 0 until the first report
+	Stats      struct {
+		SwapIn      int64 `json:"stat-swap-in"`
+		SwapOut     int64 `json:"stat-swap-out"`
+		MajorFaults int64 `json:"stat-major-faults"`
+		MinorFaults int64 `json:"stat-minor-faults"`
+		Free        int64 `json:"stat-free-memory"`
+		Total       int64 `json:"stat-total-memory"`
+		Available   int64 `json:"stat-available-memory"`
+		DiskCaches  int64 `json:"stat-disk-caches"`
+	} `json:"stats"`
+}
+
+// QueryBalloon returns the current balloon size.
+func (c *QMPClient) QueryBalloon() (BalloonInfo, error) {
+	var info BalloonInfo
+	err := c.call("query-balloon", nil, &info)
+	return info, err
+}
+
+// QueryMemdev lists the VM's memory backends.
+func (c *QMPClient) QueryMemdev() ([]Memdev, error) {
+	var devs []Memdev
+	err := c.call("query-memdev", nil, &devs)
+	return devs, err
+}
+
+// QOMGet reads property of the QOM object at path into out.
+func (c *QMPClient) QOMGet(path, property string, out any) error {
+	return c.call("qom-get", map[string]string{"path": path, "property": property}, out)
+}
+
+// QOMSet sets property of the QOM object at path.
+func (c *QMPClient) QOMSet(path, property string, value any) error {
+	return c.call("qom-set", map[string]any{"path": path, "property": property, "value": value}, nil)
+}
+
+// EnableGuestMemStats asks the balloon driver to report guest memory
+// statistics every interval. Zero disables reporting.
+func (c *QMPClient) EnableGuestMemStats(interval time.Duration) error {
+	if err := c.QOMSet(BalloonQOMPath, "guest-stats-polling-interval", int(interval.Seconds())); err != nil {
+		return fmt.Errorf("enable balloon stats: %w", err)
+	}
+	return nil
+}
+
+// GuestMemStats returns the last statistics reported by the guest. They
+// are only updated while reporting is enabled (EnableGuestMemStats).
+func (c *QMPClient) GuestMemStats() (GuestMemStats, error) {
+	var stats GuestMemStats
+	err := c.QOMGet(BalloonQOMPath, "guest-stats", &stats)
+	return stats, err
+}
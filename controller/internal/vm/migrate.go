@@ -0,0 +1,327 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Object and job ids used during a migration.
+const (
+	migrationTLSID  = "migtls"
+	mirrorTargetID  = "migtarget"
+	mirrorJobID     = "migmirror"
+	migrateExportID = "migexport"
+)
+
+// MigrationInfo is the result of query-migrate.
+type MigrationInfo struct {
+	Status string `json:"status"` // e.g. "active", "completed", "failed"
+	RAM    struct {
+		Transferred int64 `json:"transferred"`
+		Remaining   int64 `json:"remaining"`
+		Total       int64 `json:"total"`
+	} `json:"ram"`
+	ErrorDesc string `json:"error-desc,omitempty"`
+}
+
+// BlockJob is one entry of query-block-jobs.
+type BlockJob struct {
+	Device string `json:"device"`
+	Len    int64  `json:"len"`
+	Offset int64  `json:"offset"`
+	Ready  bool   `json:"ready"`
+}
+
+// migrationAddr is a parsed migration address. RAM and device state go
+// to its port, the state disk is mirrored over NBD to the next one. The
+// host is kept as given: TLS checks it against the peer's certificate.
+type migrationAddr struct {
+	host string
+	port int
+}
+
+// parseMigrationAddr parses host:port. Only a destination listening
+// for the VM may leave out the host, or give a wildcard, to listen on
+// all addresses; the source connects to the host and checks it against
+// the destination's certificate.
+func parseMigrationAddr(addr string, listen bool) (migrationAddr, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return migrationAddr{}, fmt.Errorf("migration address %q: %w", addr, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65534 {
+		return migrationAddr{}, fmt.Errorf("migration address %q: port must be 1-65534", addr)
+	}
+	if ip := net.ParseIP(host); !listen && (host == "" || ip != nil && ip.IsUnspecified()) {
+		return migrationAddr{}, fmt.Errorf("migration address %q: give the destination's host name", addr)
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	return migrationAddr{host: host, port: port}, nil
+}
+
+func (m migrationAddr) uri() string {
+	return "tcp:" + net.JoinHostPort(m.host, strconv.Itoa(m.port))
+}
+
+func (m migrationAddr) nbdServer() map[string]string {
+	return map[string]string{"host": m.host, "port": strconv.Itoa(m.port + 1)}
+}
+
+// checkTLSDir verifies that dir holds the x509 files QEMU needs for the
+// given endpoint ("server" or "client"), so a missing file is reported
+// before QEMU's less specific error.
+func checkTLSDir(dir, endpoint string) error {
+	for _, name := range []string{"ca-cert.pem", endpoint + "-cert.pem", endpoint + "-key.pem"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("migration TLS: %w", err)
+		}
+	}
+	return nil
+}
+
+// AddTLSCreds loads the x509 credentials in dir as the migration TLS
+// object. Peers must present a certificate signed by ca-cert.pem.
+func (c *QMPClient) AddTLSCreds(dir, endpoint string) error {
+	if err := checkTLSDir(dir, endpoint); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("migration TLS: %w", err)
+	}
+	err = c.call("object-add", map[string]any{
+		"qom-type":    "tls-creds-x509",
+		"id":          migrationTLSID,
+		"dir":         abs,
+		"endpoint":    endpoint,
+		"verify-peer": true,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("migration TLS: %w", err)
+	}
+	return nil
+}
+
+// QueryMigrate returns the state of the current migration.
+func (c *QMPClient) QueryMigrate() (MigrationInfo, error) {
+	var info MigrationInfo
+	err := c.call("query-migrate", nil, &info)
+	return info, err
+}
+
+// QueryBlockJobs lists the running block jobs.
+func (c *QMPClient) QueryBlockJobs() ([]BlockJob, error) {
+	var jobs []BlockJob
+	err := c.call("query-block-jobs", nil, &jobs)
+	return jobs, err
+}
+
+// Quit makes QEMU exit immediately with status 0.
+func (c *QMPClient) Quit() error {
+	return c.execute("quit")
+}
+
+// MigrateOut moves the running VM to a destination waiting in
+// AcceptMigration at dest: it mirrors the state disk over NBD, then
+// transfers RAM and device state, both over TLS with the credentials in
+// tlsDir. progress, if non-nil, is called about once a second. On success
+// the VM here is paused for good; the caller quits QEMU.
+func (c *QMPClient) MigrateOut(ctx context.Context, dest, tlsDir string, progress func(MigrationInfo)) error {
+	addr, err := parseMigrationAddr(dest, false)
+	if err != nil {
+		return err
+	}
+	if err := c.AddTLSCreds(tlsDir, "client"); err != nil {
+		return err
+	}
+
+	// Mirror the state disk first; the mirror keeps following guest
+	// writes until it is cancelled after the switchover.
+	server := addr.nbdServer()
+	server["type"] = "inet"
+	err = c.call("blockdev-add", map[string]any{
+		"driver":    "nbd",
+		"node-name": mirrorTargetID,
+		"server":    server,
+		"export":    StateDriveID,
+		"tls-creds": migrationTLSID,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("connect to destination disk: %w", err)
+	}
+	err = c.call("blockdev-mirror", map[string]any{
+		"job-id": mirrorJobID,
+		"device": StateDriveID,
+		"target": mirrorTargetID,
+		"sync":   "full",
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("mirror state disk: %w", err)
+	}
+	for {
+		jobs, err := c.QueryBlockJobs()
+		if err != nil {
+			return err
+		}
+		ready := false
+		for _, j := range jobs {
+			if j.Device == mirrorJobID {
+				ready = j.Ready
+			}
+		}
+		if ready {
+			break
+		}
+		if err := sleepCtx(ctx, time.Second); err != nil {
+			c.call("block-job-cancel", map[string]any{"device": mirrorJobID, "force": true}, nil)
+			return err
+		}
+	}
+
+	if err := c.call("migrate-set-parameters", map[string]any{"tls-creds": migrationTLSID}, nil); err != nil {
+		return fmt.Errorf("enable migration TLS: %w", err)
+	}
+	if err := c.call("migrate", map[string]string{"uri": addr.uri()}, nil); err != nil {
+		return fmt.Errorf("start migration: %w", err)
+	}
+	for {
+		info, err := c.QueryMigrate()
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(info)
+		}
+		switch info.Status {
+		case "completed":
+			// The VM is paused here and runs at the destination; the
+			// mirror is in sync, so cancelling it completes it.
+			if err := c.call("block-job-cancel", map[string]string{"device": mirrorJobID}, nil); err != nil {
+				return fmt.Errorf("finish state disk mirror: %w", err)
+			}
+			return nil
+		case "failed", "cancelled":
+			c.call("block-job-cancel", map[string]any{"device": mirrorJobID, "force": true}, nil)
+			return fmt.Errorf("migration %s: %s", info.Status, info.ErrorDesc)
+		}
+		if err := sleepCtx(ctx, time.Second); err != nil {
+			c.execute("migrate_cancel")
+			return err
+		}
+	}
+}
+
+// AcceptMigration prepares a VM started with Config.Incoming set (and
+// thus "-incoming defer") to receive a migration from MigrateOut, and
+// blocks until it completes and the VM runs here. The state disk must
+// exist with the source's size; its contents are overwritten.
+func (inst *Instance) AcceptMigration(ctx context.Context) error {
+	addr, err := parseMigrationAddr(inst.Config.Incoming, true)
+	if err != nil {
+		return err
+	}
+	qmp, err := dialQMP(ctx, inst.Config.QMPSocketPath)
+	if err != nil {
+		return err
+	}
+	defer qmp.Close()
+
+	if err := qmp.AddTLSCreds(inst.Config.Migration.TLSDir, "server"); err != nil {
+		return err
+	}
+	err = qmp.call("nbd-server-start", map[string]any{
+		"addr": map[string]any{
+			"type": "inet",
+			"data": addr.nbdServer(),
+		},
+		"tls-creds": migrationTLSID,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("start disk receiver: %w", err)
+	}
+	defer qmp.execute("nbd-server-stop")
+	err = qmp.call("block-export-add", map[string]any{
+		"type":      "nbd",
+		"id":        migrateExportID,
+		"node-name": inst.stateDiskNode(qmp),
+		"name":      StateDriveID,
+		"writable":  true,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("export state disk: %w", err)
+	}
+	if err := qmp.call("migrate-set-parameters", map[string]any{"tls-creds": migrationTLSID}, nil); err != nil {
+		return fmt.Errorf("enable migration TLS: %w", err)
+	}
+	if err := qmp.call("migrate-incoming", map[string]string{"uri": addr.uri()}, nil); err != nil {
+		return fmt.Errorf("listen for migration: %w", err)
+	}
+	inst.Logger.Info("waiting for incoming migration on %s (state disk on port %d)", inst.Config.Incoming, addr.port+1)
+
+	for {
+		if err := sleepCtx(ctx, time.Second); err != nil {
+			return err
+		}
+		info, err := qmp.QueryMigrate()
+		if err != nil {
+			return err
+		}
+		switch info.Status {
+		case "completed":
+			inst.Logger.Info("incoming migration completed")
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("incoming migration %s: %s", info.Status, info.ErrorDesc)
+		}
+	}
+}
+
+// stateDiskNode returns the block node name of the state disk, which
+// block-export-add needs; QEMU generates it for -drive devices.
+func (inst *Instance) stateDiskNode(qmp *QMPClient) string {
+	var devs []struct {
+		Device   string `json:"device"`
+		Inserted struct {
+			NodeName string `json:"node-name"`
+		} `json:"inserted"`
+	}
+	if err := qmp.call("query-block", nil, &devs); err == nil {
+		for _, d := range devs {
+			if d.Device == StateDriveID && d.Inserted.NodeName != "" {
+				return d.Inserted.NodeName
+			}
+		}
+	}
+	return StateDriveID
+}
+
+// dialQMP connects to a QMP socket that QEMU may still be creating.
+func dialQMP(ctx context.Context, path string) (*QMPClient, error) {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		qmp, err := NewQMPClient(path)
+		if err == nil || time.Now().After(deadline) {
+			return qmp, err
+		}
+		if err := sleepCtx(ctx, 200*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
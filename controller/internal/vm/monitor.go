@@ -19,12 +19,14 @@ type qmpGreeting struct {
 }
 
 type qmpCommand struct {
-	Execute string `json:"execute"`
+	Execute   string `json:"execute"`
+	Arguments any    `json:"arguments,omitempty"`
 }
 
 type qmpResponse struct {
 	Return json.RawMessage `json:"return,omitempty"`
 	Error  *qmpError       `json:"error,omitempty"`
+	Event  string          `json:"event,omitempty"` // asynchronous event, not a reply
 }
 
 type qmpError struct {
@@ -74,24 +76,10 @@ func (c *QMPClient) SystemPowerdown() error {
 
 // QueryStatus returns the current VM run state.
 func (c *QMPClient) QueryStatus() (string, bool, error) {
-	if err := c.encoder.Encode(qmpCommand{Execute: "query-status"}); err != nil {
-		return "", false, fmt.Errorf("qmp: send query-status: %w", err)
-	}
-
-	var resp qmpResponse
-	if err := c.decoder.Decode(&resp); err != nil {
-		return "", false, fmt.Errorf("qmp: read response: %w", err)
-	}
-
-	if resp.Error != nil {
-		return "", false, fmt.Errorf("qmp: %s: %s", resp.Error.Class, resp.Error.Desc)
-	}
-
 	var status qmpStatusResult
-	if err := json.Unmarshal(resp.Return, &status); err != nil {
-		return "", false, fmt.Errorf("qmp: parse status: %w", err)
+	if err := c.call("query-status", nil, &status); err != nil {
+		return "", false, err
 	}
-
 	return status.Status, status.Running, nil
 }
 
@@ -101,18 +89,34 @@ func (c *QMPClient) Close() error {
 }
 
 func (c *QMPClient) execute(command string) error {
-	if err := c.encoder.Encode(qmpCommand{Execute: command}); err != nil {
+	return c.call(command, nil, nil)
+}
+
+// call runs command with optional arguments and decodes its return value
+// into result, if non-nil. Events QEMU emits in the meantime are skipped.
+func (c *QMPClient) call(command string, args, result any) error {
+	if err := c.encoder.Encode(qmpCommand{Execute: command, Arguments: args}); err != nil {
 		return fmt.Errorf("qmp: send %s: %w", command, err)
 	}
 
 	var resp qmpResponse
-	if err := c.decoder.Decode(&resp); err != nil {
-		return fmt.Errorf("qmp: read response: %w", err)
+	for {
+		resp = qmpResponse{}
+		if err := c.decoder.Decode(&resp); err != nil {
+			return fmt.Errorf("qmp: read response: %w", err)
+		}
+		if resp.Event == "" {
+			break
+		}
 	}
 
 	if resp.Error != nil {
 		return fmt.Errorf("qmp: %s: %s", resp.Error.Class, resp.Error.Desc)
 	}
-
+	if result != nil {
+		if err := json.Unmarshal(resp.Return, result); err != nil {
+			return fmt.Errorf("qmp: parse %s result: %w", command, err)
+		}
+	}
 	return nil
 }
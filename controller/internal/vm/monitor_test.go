@@ -1,12 +1,17 @@
 package vm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+
+	"github.com/user/extorvm/controller/internal/config"
 )
 
 // mockQMPServer simulates a QMP server on a Unix socket.
@@ -243,6 +248,270 @@ func TestQMPClientClose(t *testing.T) {
 	}
 }
 
+func TestMemoryStats(t *testing.T) {
+	srv := newMockQMPServer(t)
+	defer srv.Close()
+
+	srv.serve(func(cmd string, enc *json.Encoder) {
+		switch cmd {
+		case "query-balloon":
+			// Events can arrive before the reply.
+			enc.Encode(map[string]interface{}{"event": "BALLOON_CHANGE", "data": map[string]int{"actual": 1}})
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{"actual": 134217728}})
+		case "query-memdev":
+			enc.Encode(map[string]interface{}{"return": []map[string]interface{}{
+				{"size": 134217728, "merge": true, "dump": true, "prealloc": false, "share": false, "host-nodes": []int{}, "policy": "default"},
+			}})
+		case "qom-get":
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{
+				"last-update": 1700000000,
+				"stats":       map[string]int64{"stat-free-memory": 50331648, "stat-total-memory": 125829120, "stat-swap-in": -1},
+			}})
+		}
+	})
+
+	client, err := NewQMPClient(srv.sockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	bal, err := client.QueryBalloon()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bal.Actual != 134217728 {
+		t.Errorf("balloon actual = %d, want 134217728", bal.Actual)
+	}
+
+	devs, err := client.QueryMemdev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 1 || devs[0].Size != 134217728 || devs[0].Policy != "default" {
+		t.Errorf("memdevs = %+v", devs)
+	}
+
+	stats, err := client.GuestMemStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.LastUpdate != 1700000000 || stats.Stats.Free != 50331648 || stats.Stats.Total != 125829120 || stats.Stats.SwapIn != -1 {
+		t.Errorf("guest stats = %+v", stats)
+	}
+}
+
+func TestBlockStatsAndThrottle(t *testing.T) {
+	srv := newMockQMPServer(t)
+	defer srv.Close()
+
+	srv.serve(func(cmd string, enc *json.Encoder) {
+		switch cmd {
+		case "query-blockstats":
+			enc.Encode(map[string]interface{}{"return": []map[string]interface{}{
+				{"device": "drive0", "stats": map[string]int64{"rd_bytes": 4096, "wr_bytes": 1048576, "wr_operations": 256}},
+			}})
+		case "block_set_io_throttle":
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		default:
+			enc.Encode(map[string]interface{}{"error": map[string]string{"class": "CommandNotFound", "desc": cmd}})
+		}
+	})
+
+	client, err := NewQMPClient(srv.sockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stats, err := client.QueryBlockstats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Device != StateDriveID || stats[0].Stats.WrBytes != 1048576 || stats[0].Stats.WrOperations != 256 {
+		t.Errorf("blockstats = %+v", stats)
+	}
+
+	if err := client.SetIOThrottle(StateDriveID, IOThrottle{BPSWrite: 10 << 20}); err != nil {
+		t.Errorf("SetIOThrottle: %v", err)
+	}
+
+	th := DiskThrottle(config.DiskConfig{ReadMBps: 2, WriteIOPS: 300})
+	if th.BPSRead != 2<<20 || th.IOPSWrite != 300 || th.BPS != 0 || th.BPSWrite != 0 {
+		t.Errorf("DiskThrottle = %+v", th)
+	}
+}
+
+func TestReplugNIC(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("NIC hot-plug is not supported with vmnet")
+	}
+	srv := newMockQMPServer(t)
+	defer srv.Close()
+
+	var cmds []string
+	plugged := true
+	srv.serve(func(cmd string, enc *json.Encoder) {
+		cmds = append(cmds, cmd)
+		switch cmd {
+		case "qom-list":
+			// The guest releases the NIC after the first poll.
+			props := []map[string]string{{"name": "balloon0", "type": "child<virtio-balloon-pci>"}}
+			if plugged {
+				props = append(props, map[string]string{"name": nicID, "type": "child<virtio-net-pci>"})
+				plugged = false
+			}
+			enc.Encode(map[string]interface{}{"return": props})
+		case "device_del", "netdev_del", "netdev_add", "device_add":
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		default:
+			enc.Encode(map[string]interface{}{"error": map[string]string{"class": "CommandNotFound", "desc": cmd}})
+		}
+	})
+
+	cfg := &config.Config{TAPName: "torvm0", QMPSocketPath: srv.sockPath}
+	inst := &Instance{Config: cfg}
+	if err := inst.ReplugNIC(); err != nil {
+		t.Fatal(err)
+	}
+	want := "device_del,qom-list,qom-list,netdev_del,netdev_add,device_add"
+	if got := strings.Join(cmds, ","); got != want {
+		t.Errorf("commands = %s, want %s", got, want)
+	}
+
+	if nd := tapNetdev(cfg); nd["ifname"] != "torvm0" || nd["id"] != netdevID || nd["vhost"] != nil {
+		t.Errorf("tapNetdev = %v", nd)
+	}
+}
+
+func TestAddVCPUs(t *testing.T) {
+	srv := newMockQMPServer(t)
+	defer srv.Close()
+
+	slot := func(socket int, qomPath string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "qemu64-x86_64-cpu", "vcpus-count": 1, "qom-path": qomPath,
+			"props": map[string]int{"socket-id": socket, "core-id": 0, "thread-id": 0},
+		}
+	}
+	adds := 0
+	srv.serve(func(cmd string, enc *json.Encoder) {
+		switch cmd {
+		case "query-hotpluggable-cpus":
+			// Highest id first, as QEMU lists them.
+			enc.Encode(map[string]interface{}{"return": []map[string]interface{}{
+				slot(3, ""), slot(2, ""), slot(1, "/machine/unattached/device[1]"), slot(0, "/machine/unattached/device[0]"),
+			}})
+		case "device_add":
+			adds++
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		default:
+			enc.Encode(map[string]interface{}{"error": map[string]string{"class": "CommandNotFound", "desc": cmd}})
+		}
+	})
+
+	client, err := NewQMPClient(srv.sockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if n, err := client.AddVCPUs(3); err != nil || n != 3 || adds != 1 {
+		t.Errorf("AddVCPUs(3) = %d, %v with %d device_add; want 3, nil, 1", n, err, adds)
+	}
+	if n, err := client.AddVCPUs(1); err == nil || n != 2 {
+		t.Errorf("AddVCPUs(1) = %d, %v; want 2 and an error", n, err)
+	}
+	if _, err := client.AddVCPUs(5); err == nil {
+		t.Error("AddVCPUs(5) succeeded with 2 free slots for 3 vCPUs")
+	}
+}
+
+func TestMigrateOut(t *testing.T) {
+	srv := newMockQMPServer(t)
+	defer srv.Close()
+
+	var cmds []string
+	srv.serve(func(cmd string, enc *json.Encoder) {
+		cmds = append(cmds, cmd)
+		switch cmd {
+		case "query-block-jobs":
+			enc.Encode(map[string]interface{}{"return": []map[string]interface{}{
+				{"device": mirrorJobID, "len": 1 << 20, "offset": 1 << 20, "ready": true},
+			}})
+		case "query-migrate":
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{
+				"status": "completed", "ram": map[string]int{"transferred": 100, "remaining": 0, "total": 100},
+			}})
+		default:
+			enc.Encode(map[string]interface{}{"return": map[string]interface{}{}})
+		}
+	})
+
+	client, err := NewQMPClient(srv.sockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	dir := t.TempDir()
+	if err := client.MigrateOut(context.Background(), "dest.example:4444", dir, nil); err == nil {
+		t.Fatal("MigrateOut succeeded without TLS credentials")
+	}
+	for _, name := range []string{"ca-cert.pem", "client-cert.pem", "client-key.pem"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var last MigrationInfo
+	if err := client.MigrateOut(context.Background(), "dest.example:4444", dir, func(info MigrationInfo) { last = info }); err != nil {
+		t.Fatalf("MigrateOut: %v", err)
+	}
+	want := "object-add blockdev-add blockdev-mirror query-block-jobs migrate-set-parameters migrate query-migrate block-job-cancel"
+	if got := strings.Join(cmds, " "); got != want {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+	if last.Status != "completed" || last.RAM.Total != 100 {
+		t.Errorf("last progress = %+v", last)
+	}
+}
+
+func TestParseMigrationAddr(t *testing.T) {
+	tests := []struct {
+		in      string
+		listen  bool
+		uri     string
+		nbdPort string
+	}{
+		{"dest.example:4444", false, "tcp:dest.example:4444", "4445"},
+		{"[fd00::2]:5000", false, "tcp:[fd00::2]:5000", "5001"},
+		{":4444", true, "tcp:0.0.0.0:4444", "4445"},
+		{"[::]:4444", true, "tcp:[::]:4444", "4445"},
+	}
+	for _, tt := range tests {
+		a, err := parseMigrationAddr(tt.in, tt.listen)
+		if err != nil {
+			t.Errorf("parseMigrationAddr(%q): %v", tt.in, err)
+			continue
+		}
+		if a.uri() != tt.uri || a.nbdServer()["port"] != tt.nbdPort {
+			t.Errorf("parseMigrationAddr(%q) = %s, nbd port %s; want %s, %s", tt.in, a.uri(), a.nbdServer()["port"], tt.uri, tt.nbdPort)
+		}
+	}
+	for _, bad := range []string{"dest.example", "dest.example:0", "dest.example:65535", "dest.example:x"} {
+		if _, err := parseMigrationAddr(bad, true); err == nil {
+			t.Errorf("parseMigrationAddr(%q) succeeded", bad)
+		}
+	}
+	// The source must name the destination: it dials it and checks
+	// its certificate.
+	for _, bad := range []string{":4444", "0.0.0.0:4444", "[::]:4444"} {
+		if _, err := parseMigrationAddr(bad, false); err == nil {
+			t.Errorf("parseMigrationAddr(%q) succeeded for the source", bad)
+		}
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsSubstring(s, substr))
 }
@@ -0,0 +1,140 @@
+package vm
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/user/extorvm/controller/internal/config"
+)
+
+// The VM's network backend and NIC (see tapArgs). The NIC keeps a fixed
+// MAC address so a hot-plugged replacement looks the same to the guest
+// and to the host's neighbour table.
+const (
+	netdevID = "net0"
+	nicID    = "nic0"
+	nicMAC   = "52:54:00:12:34:56"
+)
+
+// nicUnplugTimeout bounds the wait for the guest to release the NIC.
+var nicUnplugTimeout = 10 * time.Second
+
+// QOMProperty is one entry of a qom-list result.
+type QOMProperty struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// QOMList lists the properties (including child objects) of the QOM
+// object at path.
+func (c *QMPClient) QOMList(path string) ([]QOMProperty, error) {
+	var props []QOMProperty
+	err := c.call("qom-list", map[string]string{"path": path}, &props)
+	return props, err
+}
+
+// NetdevAdd adds a network backend. args holds the netdev_add arguments,
+// including "type" and "id".
+func (c *QMPClient) NetdevAdd(args map[string]any) error {
+	if err := c.call("netdev_add", args, nil); err != nil {
+		return fmt.Errorf("add netdev %v: %w", args["id"], err)
+	}
+	return nil
+}
+
+// NetdevDel removes the network backend with the given id.
+func (c *QMPClient) NetdevDel(id string) error {
+	if err := c.call("netdev_del", map[string]string{"id": id}, nil); err != nil {
+		return fmt.Errorf("remove netdev %s: %w", id, err)
+	}
+	return nil
+}
+
+// DeviceAdd hot-plugs a device. args holds the device_add arguments,
+// including "driver" and "id".
+func (c *QMPClient) DeviceAdd(args map[string]any) error {
+	if err := c.call("device_add", args, nil); err != nil {
+		return fmt.Errorf("add device %v: %w", args["id"], err)
+	}
+	return nil
+}
+
+// DeviceDel asks the guest to release the device with the given id. The
+// removal completes asynchronously; see WaitDeviceGone.
+func (c *QMPClient) DeviceDel(id string) error {
+	if err := c.call("device_del", map[string]string{"id": id}, nil); err != nil {
+		return fmt.Errorf("remove device %s: %w", id, err)
+	}
+	return nil
+}
+
+// WaitDeviceGone polls until the device with the given id has been
+// unplugged or timeout elapses.
+func (c *QMPClient) WaitDeviceGone(id string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		props, err := c.QOMList("/machine/peripheral")
+		if err != nil {
+			return err
+		}
+		if !slices.ContainsFunc(props, func(p QOMProperty) bool { return p.Name == id }) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device %s: guest did not release it within %v", id, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// tapNetdev returns the netdev_add arguments for the TAP backend, matching
+// the -netdev argument of tapArgs.
+func tapNetdev(cfg *config.Config) map[string]any {
+	args := map[string]any{
+		"type":       "tap",
+		"id":         netdevID,
+		"ifname":     cfg.TAPName,
+		"script":     "no",
+		"downscript": "no",
+	}
+	if vhostNet(cfg) {
+		args["vhost"] = true
+	}
+	return args
+}
+
+// ReplugNIC replaces the VM's NIC and its TAP backend without a restart,
+// after the host TAP device was lost and recreated. The guest sees the
+// NIC unplugged and a new one with the same MAC plugged in. Not available
+// on macOS, where the vmnet backend has no host TAP device.
+func (inst *Instance) ReplugNIC() error {
+	if runtime.GOOS == "darwin" {
+		return fmt.Errorf("NIC hot-plug is not supported with vmnet")
+	}
+	qmp, err := NewQMPClient(inst.Config.QMPSocketPath)
+	if err != nil {
+		return err
+	}
+	defer qmp.Close()
+
+	if err := qmp.DeviceDel(nicID); err != nil {
+		return err
+	}
+	if err := qmp.WaitDeviceGone(nicID, nicUnplugTimeout); err != nil {
+		return err
+	}
+	if err := qmp.NetdevDel(netdevID); err != nil {
+		return err
+	}
+	if err := qmp.NetdevAdd(tapNetdev(inst.Config)); err != nil {
+		return err
+	}
+	return qmp.DeviceAdd(map[string]any{
+		"driver": "virtio-net-pci",
+		"id":     nicID,
+		"netdev": netdevID,
+		"mac":    nicMAC,
+	})
+}
@@ -0,0 +1,32 @@
+package vm
+
+// Pause stops the guest's vCPUs. QEMU keeps the guest's memory and
+// devices as they are until Resume.
+func (c *QMPClient) Pause() error {
+	return c.execute("stop")
+}
+
+// Resume restarts the guest's vCPUs after Pause.
+func (c *QMPClient) Resume() error {
+	return c.execute("cont")
+}
+
+// Pause freezes the running VM in place.
+func (inst *Instance) Pause() error {
+	qmp, err := NewQMPClient(inst.Config.QMPSocketPath)
+	if err != nil {
+		return err
+	}
+	defer qmp.Close()
+	return qmp.Pause()
+}
+
+// Resume continues the VM after Pause.
+func (inst *Instance) Resume() error {
+	qmp, err := NewQMPClient(inst.Config.QMPSocketPath)
+	if err != nil {
+		return err
+	}
+	defer qmp.Close()
+	return qmp.Resume()
+}
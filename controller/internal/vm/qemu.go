@@ -2,6 +2,7 @@ package vm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -72,10 +73,16 @@ type Instance struct {
 	Process  *exec.Cmd
 	QEMUPath string // Resolved and validated QEMU binary path.
 
+	// QEMUVersion is the probed QEMU release (zero if unknown).
+	// qemuErr is set when that release cannot run TorVM.
+	QEMUVersion QEMUVersion
+	qemuErr     error
+
 	mu       sync.Mutex
 	qmp      *QMPClient
 	running  bool
 	waitErr  chan error
+	attached *os.Process // set by Attach instead of Process
 }
 
 // NewInstance creates a new VM instance. It resolves the QEMU binary
@@ -93,11 +100,33 @@ func NewInstance(cfg *config.Config, logger *logging.Logger) *Instance {
 	} else {
 		inst.QEMUPath = qemuPath
 		logger.Info("resolved QEMU binary: %s", qemuPath)
+		inst.probeVersion()
 	}
 
 	return inst
 }
 
+// probeVersion checks the QEMU release against the compatibility table.
+// An unrecognized version string (e.g. a custom build) is logged and
+// otherwise ignored.
+func (inst *Instance) probeVersion() {
+	v, err := probeQEMUVersion(inst.QEMUPath)
+	if err != nil {
+		inst.Logger.Error("QEMU version check skipped: %v", err)
+		return
+	}
+	inst.QEMUVersion = v
+	inst.Logger.Info("QEMU version %s", v)
+	warnings, err := checkQEMUVersion(v, runtime.GOOS)
+	for _, w := range warnings {
+		inst.Logger.Info("warning: %s", w)
+	}
+	if err != nil {
+		inst.Logger.Error("%v", err)
+		inst.qemuErr = err
+	}
+}
+
 // Start launches the QEMU process with the configured arguments.
 func (inst *Instance) Start(ctx context.Context) error {
 	inst.mu.Lock()
@@ -118,12 +147,19 @@ func (inst *Instance) Start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("vm: torrc overlay: %w", err)
 	}
-	if overlay != "" {
-		if err := WriteStateDiskFile(inst.Config.StateDiskPath, "torrc.override", overlay); err != nil {
+	// An incoming migration overwrites the state disk with the source's.
+	if overlay != "" && inst.Config.Incoming == "" {
+		if err := WriteTorrcOverlay(inst.Config.StateDiskPath, overlay); err != nil {
 			return fmt.Errorf("vm: write torrc overlay: %w", err)
 		}
 		inst.Logger.Info("wrote torrc overlay to state disk")
 	}
+	if rules := inst.Config.GuestFirewallRules(); rules != "" && inst.Config.Incoming == "" {
+		if err := WriteGuestFirewall(inst.Config.StateDiskPath, rules); err != nil {
+			return fmt.Errorf("vm: write guest firewall: %w", err)
+		}
+		inst.Logger.Info("wrote guest firewall policy to state disk")
+	}
 
 	// Verify VM image files exist before launching QEMU.
 	for _, pair := range []struct{ name, path string }{
@@ -152,6 +188,9 @@ func (inst *Instance) Start(ctx context.Context) error {
 	if inst.QEMUPath == "" {
 		return fmt.Errorf("vm: QEMU binary not resolved; cannot start")
 	}
+	if inst.qemuErr != nil {
+		return fmt.Errorf("vm: %w", inst.qemuErr)
+	}
 
 	inst.Logger.Info("starting QEMU with %d args", len(args))
 	inst.Logger.Debug("qemu binary: %s, args: %v", inst.QEMUPath, args)
@@ -185,7 +224,7 @@ func (inst *Instance) Stop(ctx context.Context) error {
 		return nil
 	}
 	// Capture process reference while holding the lock to avoid race.
-	proc := inst.Process
+	proc := inst.process()
 	inst.mu.Unlock()
 
 	// Try graceful shutdown via QMP.
@@ -201,6 +240,9 @@ func (inst *Instance) Stop(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 		case err := <-inst.waitErr:
+			if errors.Is(err, errAttachedExit) {
+				return nil
+			}
 			return err
 		}
 	}
@@ -208,13 +250,26 @@ func (inst *Instance) Stop(ctx context.Context) error {
 	// Fallback: kill the process using captured reference.
 	inst.mu.Lock()
 	defer inst.mu.Unlock()
-	if inst.running && proc != nil && proc.Process != nil {
+	if inst.running && proc != nil {
 		inst.Logger.Info("killing QEMU process")
-		return proc.Process.Kill()
+		return proc.Kill()
 	}
 	return nil
 }
 
+// Kill terminates QEMU immediately, without a guest shutdown, for the
+// emergency stop.
+func (inst *Instance) Kill() error {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	proc := inst.process()
+	if !inst.running || proc == nil {
+		return nil
+	}
+	inst.Logger.Info("killing QEMU process")
+	return proc.Kill()
+}
+
 // IsRunning reports whether the QEMU process is still alive.
 func (inst *Instance) IsRunning() bool {
 	inst.mu.Lock()
@@ -50,15 +50,22 @@ func (inst *Instance) BuildArgs() ([]string, error) {
 	}
 
 	kernelAppend := fmt.Sprintf(
-		"quiet IP=%s MASK=%s GW=%s MTU=1500 PRIVIP=%s CTLSOCK=%s:%d ENTROPY=%s",
+		"quiet IP=%s MASK=%s GW=%s MTU=%d PRIVIP=%s CTLSOCK=%s:%d ENTROPY=%s",
 		cfg.HostIP,
 		cfg.SubnetMask,
 		cfg.VMIP,
+		cfg.MTU,
 		cfg.VMIP,
 		cfg.VMIP,
 		cfg.ControlPort,
 		entropy,
 	)
+	if cfg.IPv6.Mode == "route" {
+		kernelAppend += fmt.Sprintf(" IP6=%s/%d", cfg.IPv6.VMIP, cfg.IPv6.PrefixLen)
+	}
+	if rules := cfg.GuestFirewallRules(); rules != "" {
+		kernelAppend += " FWSUM=" + OverlaySum(rules)
+	}
 	if cfg.Entropy.EnableHaveged {
 		kernelAppend += " HAVEGED=1"
 	}
@@ -77,7 +84,7 @@ func (inst *Instance) BuildArgs() ([]string, error) {
 		"-machine", machine,
 		"-cpu", cpu,
 		"-accel", accel,
-		"-smp", fmt.Sprintf("%d", cfg.VMCPUs),
+		"-smp", smpArg(cfg, accel),
 		"-m", fmt.Sprintf("%d", cfg.VMMemoryMB),
 		"-kernel", cfg.KernelPath,
 		"-initrd", cfg.InitrdPath,
@@ -102,25 +109,49 @@ func (inst *Instance) BuildArgs() ([]string, error) {
 		args = append(args, serialArgs...)
 	}
 
-	// Virtio memory balloon for dynamic memory management.
-	args = append(args, "-device", "virtio-balloon-pci")
+	// Channel for periodic reseeding from the host (see Reseed).
+	args = append(args, entropyArgs(cfg)...)
+
+	// Virtio memory balloon for dynamic memory management. The id gives
+	// it a fixed QOM path for memory statistics (BalloonQOMPath).
+	args = append(args, "-device", "virtio-balloon-pci,id="+balloonID)
 
 	args = append(args, "-nographic")
 
 	// Network device: platform-specific TAP with vhost acceleration.
 	args = append(args, tapArgs(cfg)...)
 
+	// Receive a live migration instead of booting (see AcceptMigration).
+	if cfg.Incoming != "" {
+		args = append(args, "-incoming", "defer")
+	}
+
 	// QMP monitor socket.
 	if runtime.GOOS == "windows" {
 		args = append(args,
-			"-qmp", fmt.Sprintf("pipe:%s,server,nowait", cfg.QMPSocketPath),
+			"-qmp", fmt.Sprintf("pipe:%s,server,nowait", optEscape(cfg.QMPSocketPath)),
 		)
 	} else {
 		args = append(args,
-			"-qmp", fmt.Sprintf("unix:%s,server,nowait", cfg.QMPSocketPath),
+			"-qmp", fmt.Sprintf("unix:%s,server,nowait", optEscape(cfg.QMPSocketPath)),
 		)
 	}
 
+	// Make sure each configured path reaches QEMU whole.
+	values := []optValue{
+		{name: "StateDiskPath", option: "-drive", prefix: "file=", value: cfg.StateDiskPath, disk: true},
+		{name: "QMPSocketPath", option: "-qmp", prefix: qmpPrefix(), value: cfg.QMPSocketPath},
+	}
+	if dev := cfg.Entropy.SerialEntropyDevice; dev != "" {
+		values = append(values, optValue{name: "Entropy.SerialEntropyDevice", option: "-chardev", prefix: "path=", value: dev, id: "entropy_serial"})
+	}
+	if cfg.Entropy.ReseedIntervalSec > 0 {
+		values = append(values, optValue{name: "entropy channel", option: "-chardev", prefix: "path=", value: EntropySocketPath(cfg), id: "entropy"})
+	}
+	if err := checkArgs(args, values); err != nil {
+		return nil, err
+	}
+
 	return args, nil
 }
 
@@ -162,20 +193,20 @@ func blockArgs(cfg *config.Config) []string {
 		// cache for lowest latency and avoids double-caching.
 		driveOpts = fmt.Sprintf(
 			"file=%s,id=drive0,if=none,format=raw,cache=none,aio=native",
-			cfg.StateDiskPath,
+			optEscape(cfg.StateDiskPath),
 		)
 	case "hvf", "whpx":
 		// Thread-based AIO with writeback cache; native AIO not
 		// available on macOS/Windows.
 		driveOpts = fmt.Sprintf(
 			"file=%s,id=drive0,if=none,format=raw,cache=writeback,aio=threads",
-			cfg.StateDiskPath,
+			optEscape(cfg.StateDiskPath),
 		)
 	default:
 		// TCG: safe defaults.
 		driveOpts = fmt.Sprintf(
 			"file=%s,id=drive0,if=none,format=raw,cache=writeback",
-			cfg.StateDiskPath,
+			optEscape(cfg.StateDiskPath),
 		)
 	}
 
@@ -222,7 +253,7 @@ func serialEntropyArgs(cfg *config.Config) []string {
 		return nil
 	}
 	return []string{
-		"-chardev", fmt.Sprintf("serial,id=entropy_serial,path=%s", dev),
+		"-chardev", fmt.Sprintf("serial,id=entropy_serial,path=%s", optEscape(dev)),
 		"-device", "isa-serial,chardev=entropy_serial",
 	}
 }
@@ -236,22 +267,29 @@ func tapArgs(cfg *config.Config) []string {
 			"-netdev", fmt.Sprintf(
 				"vmnet-shared,id=net0,start-address=%s,end-address=%s,subnet-mask=%s",
 				cfg.VMIP, cfg.HostIP, cfg.SubnetMask),
-			"-device", "virtio-net-pci,netdev=net0",
+			"-device", nicDevice,
 		}
 	}
 
 	// Linux and Windows use TAP devices.
 	netdev := fmt.Sprintf("tap,id=net0,ifname=%s,script=no,downscript=no", cfg.TAPName)
 
-	// Enable vhost-net on Linux when the kernel module is available.
-	// vhost-net moves virtio packet processing into the kernel,
-	// eliminating QEMU userspace overhead for each packet.
-	if cfg.VhostNet && runtime.GOOS == "linux" {
+	if vhostNet(cfg) {
 		netdev += ",vhost=on"
 	}
 
 	return []string{
 		"-netdev", netdev,
-		"-device", "virtio-net-pci,netdev=net0",
+		"-device", nicDevice,
 	}
 }
+
+// nicDevice is the -device argument of the VM's NIC (see ReplugNIC).
+const nicDevice = "virtio-net-pci,netdev=" + netdevID + ",id=" + nicID + ",mac=" + nicMAC
+
+// vhostNet reports whether to enable vhost-net on Linux, which the caller
+// detected as available. vhost-net moves virtio packet processing into
+// the kernel, eliminating QEMU userspace overhead for each packet.
+func vhostNet(cfg *config.Config) bool {
+	return cfg.VhostNet && runtime.GOOS == "linux"
+}
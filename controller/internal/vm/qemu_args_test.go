@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -39,7 +40,7 @@ func TestBuildArgsBasic(t *testing.T) {
 	// Default config has ExposeRDRAND=true, so TCG gets +rdrand.
 	assertContains(t, args, "-cpu", "qemu64,+rdrand")
 	assertContains(t, args, "-accel", "tcg")
-	assertContains(t, args, "-smp", fmt.Sprintf("%d", cfg.VMCPUs))
+	assertContains(t, args, "-smp", fmt.Sprintf("%d,maxcpus=%d", cfg.VMCPUs, config.MaxVMCPUs))
 	assertContains(t, args, "-m", fmt.Sprintf("%d", cfg.VMMemoryMB))
 	assertContains(t, args, "-kernel", cfg.KernelPath)
 	assertContains(t, args, "-initrd", cfg.InitrdPath)
@@ -87,8 +88,16 @@ func TestBuildArgsSMPAndMemory(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	assertContains(t, args, "-smp", "4")
+	assertContains(t, args, "-smp", "4,maxcpus=16")
 	assertContains(t, args, "-m", "256")
+
+	// No hot-plug slots where the accelerator cannot use them.
+	cfg.Accel = "whpx"
+	args, err = inst.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, args, "-smp", "4")
 }
 
 func TestBuildArgsNullByteRejection(t *testing.T) {
@@ -309,6 +318,26 @@ func TestBuildArgsNoIOMMUWithoutKVM(t *testing.T) {
 	}
 }
 
+func TestBuildArgsIncoming(t *testing.T) {
+	cfg := testConfig()
+	inst := testInstance(cfg)
+	args, err := inst.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range args {
+		if a == "-incoming" {
+			t.Fatal("-incoming present without a migration address")
+		}
+	}
+
+	cfg.Incoming = ":4444"
+	if args, err = inst.BuildArgs(); err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, args, "-incoming", "defer")
+}
+
 func TestBuildArgsQMPSocket(t *testing.T) {
 	cfg := testConfig()
 	inst := testInstance(cfg)
@@ -368,6 +397,7 @@ func TestBuildArgsKernelAppend(t *testing.T) {
 		"IP=" + cfg.HostIP,
 		"MASK=" + cfg.SubnetMask,
 		"GW=" + cfg.VMIP,
+		fmt.Sprintf("MTU=%d", cfg.MTU),
 		"PRIVIP=" + cfg.VMIP,
 		fmt.Sprintf("CTLSOCK=%s:%d", cfg.VMIP, cfg.ControlPort),
 		"ENTROPY=",
@@ -386,7 +416,7 @@ func TestBuildArgsContainsVirtioBalloon(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	assertContains(t, args, "-device", "virtio-balloon-pci")
+	assertContains(t, args, "-device", "virtio-balloon-pci,id=balloon0")
 }
 
 func TestRngArgsConfigurableRate(t *testing.T) {
@@ -516,6 +546,60 @@ func TestBuildArgsKernelEntropySize(t *testing.T) {
 	}
 }
 
+func TestBuildArgsKernelAppendIPv6(t *testing.T) {
+	cfg := testConfig()
+	for _, tt := range []struct {
+		mode string
+		want bool
+	}{
+		{"block", false},
+		{"route", true},
+		{"off", false},
+	} {
+		cfg.IPv6.Mode = tt.mode
+		inst := testInstance(cfg)
+		args, err := inst.BuildArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendArg := ""
+		for i, a := range args {
+			if a == "-append" && i+1 < len(args) {
+				appendArg = args[i+1]
+				break
+			}
+		}
+		ip6 := fmt.Sprintf("IP6=%s/%d", cfg.IPv6.VMIP, cfg.IPv6.PrefixLen)
+		if got := strings.Contains(appendArg, ip6); got != tt.want {
+			t.Errorf("mode %q: -append contains %q = %v, want %v", tt.mode, ip6, got, tt.want)
+		}
+	}
+}
+
+func TestBuildArgsKernelAppendGuestFirewall(t *testing.T) {
+	cfg := testConfig()
+	for _, on := range []bool{false, true} {
+		cfg.GuestFirewall = on
+		args, err := testInstance(cfg).BuildArgs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		appendArg := ""
+		for i, a := range args {
+			if a == "-append" && i+1 < len(args) {
+				appendArg = args[i+1]
+			}
+		}
+		sum := "FWSUM=" + OverlaySum(cfg.GuestFirewallRules())
+		if got := strings.Contains(appendArg, sum); got != on {
+			t.Errorf("guest firewall %t: -append contains %q = %t", on, sum, got)
+		}
+		if !on && strings.Contains(appendArg, "FWSUM=") {
+			t.Errorf("guest firewall off: -append = %q", appendArg)
+		}
+	}
+}
+
 // assertContains checks that args contains a consecutive pair of flag and value.
 func assertContains(t *testing.T, args []string, flag, value string) {
 	t.Helper()
@@ -537,3 +621,77 @@ func assertArgPresent(t *testing.T, args []string, arg string) {
 	}
 	t.Errorf("args missing %s", arg)
 }
+
+func TestBuildArgsEscapesCommasInPaths(t *testing.T) {
+	cfg := testConfig()
+	cfg.StateDiskPath = "/srv/vm,format=qcow2/state.img"
+	cfg.QMPSocketPath = "/run/a,b/qmp.sock"
+	cfg.Entropy.SerialEntropyDevice = "/dev/ttyUSB0,mux=on"
+	args, err := testInstance(cfg).BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, want := range []string{
+		"file=/srv/vm,,format=qcow2/state.img,id=drive0",
+		":/run/a,,b/qmp.sock,server",
+		"path=/dev/ttyUSB0,,mux=on",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("args lack %q: %s", want, joined)
+		}
+	}
+}
+
+func TestBuildArgsSpacesAndUnicodeInPaths(t *testing.T) {
+	// Home directories as each platform lays them out.
+	dir := "/home/zoë müller/.local/share/torvm"
+	switch runtime.GOOS {
+	case "darwin":
+		dir = "/Users/Zoë Müller/Library/Application Support/TorVM"
+	case "windows":
+		dir = `C:\Users\José García\AppData\Local\TorVM`
+	}
+	join := func(name string) string { return dir + string(filepath.Separator) + name }
+	cfg := testConfig()
+	cfg.KernelPath = join("vmlinuz")
+	cfg.InitrdPath = join("initrd.gz")
+	cfg.StateDiskPath = join("état, 2.img")
+	if runtime.GOOS != "windows" {
+		cfg.QMPSocketPath = join("qmp 1.sock")
+	}
+	args, err := testInstance(cfg).BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, args, "-kernel", cfg.KernelPath)
+	assertContains(t, args, "-initrd", cfg.InitrdPath)
+	assertContains(t, args, "-drive", "file="+optEscape(cfg.StateDiskPath)+",id=drive0,if=none,format=raw,cache=writeback")
+	assertContains(t, args, "-qmp", qmpPrefix()+cfg.QMPSocketPath+",server,nowait")
+}
+
+func TestCheckArgs(t *testing.T) {
+	disk := optValue{name: "StateDiskPath", option: "-drive", prefix: "file=", disk: true}
+	tests := []struct {
+		name    string
+		drive   string
+		value   string
+		wantErr bool
+	}{
+		{"plain", "file=/srv/state.img,format=raw", "/srv/state.img", false},
+		{"escaped", "file=/srv/a,,b.img,format=raw", "/srv/a,b.img", false},
+		{"unescaped", "file=/srv/a,b.img,format=raw", "/srv/a,b.img", true},
+		{"injected parameter", "file=/srv/x,format=qcow2,format=raw", "/srv/x,format=qcow2", true},
+		{"protocol", "file=nbd:evil:10809,format=raw", "nbd:evil:10809", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := disk
+			v.value = tt.value
+			err := checkArgs([]string{"-m", "128", "-drive", tt.drive}, []optValue{v})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got err=%v, wantErr=%v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package vm
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// QEMU reads the values of -drive, -chardev, -qmp and most other options
+// as comma-separated parameter lists in which ",," stands for a literal
+// comma. A path pasted in unescaped ends its parameter at the first comma
+// and adds whatever follows as parameters of its own: a state disk at
+// "/srv/vm,format=qcow2/state.img" would change the disk format.
+
+// optEscape escapes s for use as a parameter value in a QEMU option list.
+func optEscape(s string) string {
+	return strings.ReplaceAll(s, ",", ",,")
+}
+
+// splitOpts splits a QEMU option list into its parameters, turning ",,"
+// back into ",", as QEMU's option parser does.
+func splitOpts(s string) []string {
+	var params []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != ',' {
+			cur.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == ',' {
+			cur.WriteByte(',')
+			i++
+			continue
+		}
+		params = append(params, cur.String())
+		cur.Reset()
+	}
+	return append(params, cur.String())
+}
+
+// optValue is a configured value that a generated command line places in
+// an option list: after option, in the parameter starting with prefix.
+type optValue struct {
+	name   string // the config field, for errors
+	option string // e.g. "-drive"
+	prefix string // e.g. "file=", or "unix:" for -qmp
+	value  string
+	// disk marks a block device file name, which QEMU takes for a
+	// protocol such as "nbd:" or "http:" if it looks like one.
+	disk bool
+	// id, if set, limits the check to the option list with this id=,
+	// for an option given more than once, such as -chardev.
+	id string
+}
+
+// checkArgs is the last pass over a generated QEMU command line. It
+// parses the option lists holding each of values as QEMU will and fails
+// unless every value comes back out whole, in a single parameter, so a
+// value that was not escaped cannot add parameters of its own.
+func checkArgs(args []string, values []optValue) error {
+	for _, v := range values {
+		if v.disk && hasProtocol(v.value) {
+			return fmt.Errorf("%s %q would be read by QEMU as a network protocol; use an absolute path", v.name, v.value)
+		}
+		var found []string
+		for i := 0; i+1 < len(args); i++ {
+			if args[i] != v.option {
+				continue
+			}
+			opts := splitOpts(args[i+1])
+			if v.id != "" && !slices.Contains(opts, "id="+v.id) {
+				continue
+			}
+			for _, p := range opts {
+				if rest, ok := strings.CutPrefix(p, v.prefix); ok {
+					found = append(found, rest)
+				}
+			}
+		}
+		if len(found) != 1 || found[0] != v.value {
+			return fmt.Errorf("%s %q would be split into separate QEMU %s parameters; refusing to start", v.name, v.value, v.option)
+		}
+	}
+	return nil
+}
+
+// qmpPrefix precedes the QMP socket path in the -qmp option.
+func qmpPrefix() string {
+	if runtime.GOOS == "windows" {
+		return "pipe:"
+	}
+	return "unix:"
+}
+
+// hasProtocol reports whether QEMU would read the file name path as
+// "protocol:rest": a colon before the first path separator, other than
+// after a Windows drive letter.
+func hasProtocol(path string) bool {
+	seps := ":/"
+	if runtime.GOOS == "windows" {
+		if len(path) >= 2 && path[1] == ':' && ('a' <= path[0]|0x20 && path[0]|0x20 <= 'z') {
+			return false
+		}
+		seps = `:/\`
+	}
+	i := strings.IndexAny(path, seps)
+	return i > 0 && path[i] == ':'
+}
@@ -0,0 +1,150 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QEMUVersion is a parsed QEMU release number.
+type QEMUVersion struct {
+	Major, Minor, Micro int
+}
+
+func (v QEMUVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Micro)
+}
+
+// Less reports whether v is an older release than o.
+func (v QEMUVersion) Less(o QEMUVersion) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Micro < o.Micro
+}
+
+// minQEMUVersion is the oldest QEMU accepted. 4.2 introduced the -accel
+// option and the rng-builtin backend used on Windows.
+var minQEMUVersion = QEMUVersion{4, 2, 0}
+
+// vmnetMinVersion is the first QEMU release with vmnet-shared networking,
+// the only host network backend used on macOS.
+var vmnetMinVersion = QEMUVersion{7, 1, 0}
+
+// brokenQEMUVersion describes a release with a regression that breaks
+// TorVM. Fatal entries refuse to launch; others log a warning.
+type brokenQEMUVersion struct {
+	Version QEMUVersion
+	GOOS    string // empty matches every platform
+	Reason  string
+	Fatal   bool
+}
+
+// knownBrokenQEMU lists QEMU releases with confirmed TorVM regressions.
+var knownBrokenQEMU []brokenQEMUVersion
+
+var qemuVersionRe = regexp.MustCompile(`QEMU emulator version (\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseQEMUVersion extracts the release number from "qemu --version"
+// output, e.g. "QEMU emulator version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)".
+func ParseQEMUVersion(out string) (QEMUVersion, error) {
+	m := qemuVersionRe.FindStringSubmatch(out)
+	if m == nil {
+		return QEMUVersion{}, fmt.Errorf("unrecognized qemu --version output: %q", firstLine(out))
+	}
+	var v QEMUVersion
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Micro, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// checkQEMUVersion returns an error if v cannot run TorVM on goos, and a
+// list of warnings for releases with known non-fatal problems.
+func checkQEMUVersion(v QEMUVersion, goos string) (warnings []string, err error) {
+	if v.Less(minQEMUVersion) {
+		return nil, fmt.Errorf("QEMU %s is too old; TorVM requires %s or newer", v, minQEMUVersion)
+	}
+	if goos == "darwin" && v.Less(vmnetMinVersion) {
+		return nil, fmt.Errorf("QEMU %s lacks vmnet-shared networking (added in %s); upgrade QEMU, e.g. \"brew upgrade qemu\"",
+			v, vmnetMinVersion)
+	}
+	for _, b := range knownBrokenQEMU {
+		if b.Version != v || (b.GOOS != "" && b.GOOS != goos) {
+			continue
+		}
+		if b.Fatal {
+			return nil, fmt.Errorf("QEMU %s is known to be broken: %s", v, b.Reason)
+		}
+		warnings = append(warnings, fmt.Sprintf("QEMU %s has a known issue: %s", v, b.Reason))
+	}
+	return warnings, nil
+}
+
+// probeQEMUVersion runs "<qemuPath> --version" and parses the result.
+func probeQEMUVersion(qemuPath string) (QEMUVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, qemuPath, "--version").Output()
+	if err != nil {
+		return QEMUVersion{}, fmt.Errorf("run %s --version: %w", qemuPath, err)
+	}
+	return ParseQEMUVersion(string(out))
+}
+
+// ProbeQEMU locates the QEMU binary and checks its release as
+// NewInstance does, for preflight checks. path is empty if no acceptable
+// binary was found; v is zero if its version could not be read.
+func ProbeQEMU() (path string, v QEMUVersion, warnings []string, err error) {
+	path, err = resolveQEMUBinary()
+	if err != nil {
+		return "", v, nil, err
+	}
+	v, err = probeQEMUVersion(path)
+	if err != nil {
+		return path, v, nil, err
+	}
+	warnings, err = checkQEMUVersion(v, runtime.GOOS)
+	return path, v, warnings, err
+}
+
+// QEMUAccels returns the accelerators the QEMU binary at qemuPath was
+// built with, from "-accel help".
+func QEMUAccels(qemuPath string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, qemuPath, "-accel", "help").Output()
+	if err != nil {
+		return nil, fmt.Errorf("run %s -accel help: %w", qemuPath, err)
+	}
+	return parseAccelHelp(string(out)), nil
+}
+
+// parseAccelHelp parses "-accel help" output: a heading followed by one
+// accelerator name per line.
+func parseAccelHelp(out string) []string {
+	var accels []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		accels = append(accels, line)
+	}
+	return accels
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
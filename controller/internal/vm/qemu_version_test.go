@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQEMUVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want QEMUVersion
+	}{
+		{"QEMU emulator version 8.2.2 (Debian 1:8.2.2+ds-0ubuntu1)\nCopyright (c) 2003-2023 Fabrice Bellard\n", QEMUVersion{8, 2, 2}},
+		{"QEMU emulator version 9.0.0\n", QEMUVersion{9, 0, 0}},
+		{"QEMU emulator version 7.1\n", QEMUVersion{7, 1, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseQEMUVersion(tt.out)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseQEMUVersion(%q) = %v, %v; want %v", tt.out, got, err, tt.want)
+		}
+	}
+	if _, err := ParseQEMUVersion("qemu-system-x86_64: invalid option\n"); err == nil {
+		t.Error("expected error for unrecognized output")
+	}
+}
+
+func TestCheckQEMUVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       QEMUVersion
+		goos    string
+		wantErr string
+	}{
+		{"current linux", QEMUVersion{8, 2, 2}, "linux", ""},
+		{"minimum", QEMUVersion{4, 2, 0}, "windows", ""},
+		{"too old", QEMUVersion{4, 1, 1}, "linux", "too old"},
+		{"darwin without vmnet", QEMUVersion{7, 0, 0}, "darwin", "vmnet-shared"},
+		{"darwin with vmnet", QEMUVersion{7, 1, 0}, "darwin", ""},
+		{"vmnet irrelevant on linux", QEMUVersion{7, 0, 0}, "linux", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := checkQEMUVersion(tt.v, tt.goos)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckQEMUVersionKnownBroken(t *testing.T) {
+	saved := knownBrokenQEMU
+	defer func() { knownBrokenQEMU = saved }()
+	knownBrokenQEMU = []brokenQEMUVersion{
+		{Version: QEMUVersion{8, 1, 0}, Reason: "virtio-net stalls", Fatal: true},
+		{Version: QEMUVersion{8, 1, 1}, GOOS: "windows", Reason: "slow pipe QMP"},
+	}
+
+	if _, err := checkQEMUVersion(QEMUVersion{8, 1, 0}, "linux"); err == nil {
+		t.Error("fatal known-broken release accepted")
+	}
+	warnings, err := checkQEMUVersion(QEMUVersion{8, 1, 1}, "windows")
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("got warnings=%v err=%v; want one warning", warnings, err)
+	}
+	if warnings, _ := checkQEMUVersion(QEMUVersion{8, 1, 1}, "linux"); len(warnings) != 0 {
+		t.Errorf("platform-specific entry matched other platform: %v", warnings)
+	}
+}
+
+func TestParseAccelHelp(t *testing.T) {
+	out := "Accelerators supported in QEMU binary:\ntcg\nkvm\n"
+	got := parseAccelHelp(out)
+	if strings.Join(got, ",") != "tcg,kvm" {
+		t.Errorf("parseAccelHelp = %v, want [tcg kvm]", got)
+	}
+}
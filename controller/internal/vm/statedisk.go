@@ -1,16 +1,18 @@
 package vm
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
-)
 
-// safeHostPathRe validates that a host filesystem path contains only safe characters.
-var safeHostPathRe = regexp.MustCompile(`^[a-zA-Z0-9/_.\-]+$`)
+	"github.com/user/extorvm/controller/internal/ext4"
+)
 
 var guestPathRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._/-]*$`)
 
@@ -31,15 +33,32 @@ func validateGuestPath(p string) error {
 	return nil
 }
 
+// debugfsQuote quotes a host path for a debugfs command line, which reads
+// a double-quoted argument literally apart from "", which stands for ".
+// Host paths may hold spaces and any other characters debugfs would split
+// or interpret, as under C:\Users\<name> or a macOS home directory, but
+// not a line break, which would end the command.
+func debugfsQuote(path string) (string, error) {
+	if strings.ContainsAny(path, "\r\n") {
+		return "", fmt.Errorf("host path contains a line break: %q", path)
+	}
+	return `"` + strings.ReplaceAll(path, `"`, `""`) + `"`, nil
+}
+
 // WriteStateDiskFile writes content to a file inside an ext4 disk image
 // using debugfs. This avoids needing root or mount privileges.
+//
+// The content is written beside the file as guestPath.new and swapped in
+// only once complete, keeping the file it replaces as guestPath.prev, so
+// an interrupted write leaves an intact copy behind. The file is read
+// back afterwards, since debugfs reports a failed command but exits 0.
 func WriteStateDiskFile(diskPath, guestPath, content string) error {
 	// Validate guest path to prevent injection into debugfs commands.
 	if err := validateGuestPath(guestPath); err != nil {
 		return fmt.Errorf("invalid guest path: %w", err)
 	}
 
-	// Resolve disk path to absolute to prevent ambiguity.
+	// Resolve disk path to absolute, so it cannot be mistaken for an option.
 	diskPath, err := filepath.Abs(diskPath)
 	if err != nil {
 		return fmt.Errorf("resolve disk path: %w", err)
@@ -66,7 +85,8 @@ func WriteStateDiskFile(diskPath, guestPath, content string) error {
 		return fmt.Errorf("create temp file: %w", err)
 	}
 	tmpName := tmp.Name()
-	defer os.Remove(tmpName)
+	// The content may hold bridge lines and proxy credentials.
+	defer ShredFile(tmpName)
 
 	if _, err := tmp.WriteString(content); err != nil {
 		tmp.Close()
@@ -74,23 +94,318 @@ func WriteStateDiskFile(diskPath, guestPath, content string) error {
 	}
 	tmp.Close()
 
-	// Validate the temp file path contains only safe characters to prevent
-	// injection into the debugfs command string.
-	if !safeHostPathRe.MatchString(tmpName) {
-		return fmt.Errorf("temp file path contains unsafe characters: %q", tmpName)
-	}
-	if !safeHostPathRe.MatchString(diskPath) {
-		return fmt.Errorf("disk path contains unsafe characters: %q", diskPath)
+	// The temp file, beside the disk, is named in the debugfs script; the
+	// disk is only ever an argument of its own.
+	quotedTmp, err := debugfsQuote(tmpName)
+	if err != nil {
+		return err
 	}
 
-	// Use debugfs to write the temp file into the disk image.
-	// Quote both paths in the debugfs -R command to handle any edge cases.
-	cmd := exec.Command("debugfs", "-w", "-R",
-		fmt.Sprintf("write \"%s\" %s", tmpName, guestPath),
-		diskPath)
+	// Write and swap in one debugfs session. ln and unlink leave link
+	// counts alone, so each pair moves a name without changing its
+	// inode's count. rm and ln report the files that are missing on a
+	// first write, which is harmless.
+	newPath, prevPath := guestPath+".new", guestPath+".prev"
+	script := strings.Join([]string{
+		"rm " + newPath,
+		"write " + quotedTmp + " " + newPath,
+		"rm " + prevPath,
+		"ln " + guestPath + " " + prevPath,
+		"unlink " + guestPath,
+		"ln " + newPath + " " + guestPath,
+		"unlink " + newPath,
+	}, "\n") + "\n"
+	cmd := exec.Command("debugfs", "-w", "-f", "-", diskPath)
+	cmd.Stdin = strings.NewReader(script)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("debugfs write: %w: %s", err, string(out))
 	}
+
+	got, err := exec.Command("debugfs", "-R", "cat "+guestPath, diskPath).Output()
+	if err != nil {
+		return fmt.Errorf("debugfs read back: %w", err)
+	}
+	if string(got) != content {
+		return fmt.Errorf("debugfs write: %s on the state disk does not hold the new content: %s", guestPath, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// torrcOverlayFile is the torrc overlay's name on the state disk, where
+// the guest's init reads it.
+const torrcOverlayFile = "torrc.override"
+
+// overlayHeader starts the first line of a torrc overlay, followed by the
+// hex SHA-256 of the rest of the file.
+const overlayHeader = "# torvm-overlay sha256 "
+
+// WriteTorrcOverlay writes the torrc overlay to the state disk as by
+// WriteStateDiskFile, headed by its checksum. The guest applies the first
+// of torrc.override, torrc.override.new, and torrc.override.prev whose
+// checksum matches, and halts rather than starting Tor without the
+// overlay if none does.
+func WriteTorrcOverlay(diskPath, overlay string) error {
+	return WriteStateDiskFile(diskPath, torrcOverlayFile, overlayHeader+OverlaySum(overlay)+"\n"+overlay)
+}
+
+// OverlaySum returns the checksum that heads overlay on the state disk.
+// The guest reports the checksum of the overlay it applied back through
+// Tor's ContactInfo.
+func OverlaySum(overlay string) string {
+	sum := sha256.Sum256([]byte(overlay))
+	return hex.EncodeToString(sum[:])
+}
+
+// guestFirewallFile is the guest firewall policy's name on the state
+// disk, where the guest's init reads it.
+const guestFirewallFile = "firewall.rules"
+
+// firewallHeader starts the first line of the guest firewall policy,
+// followed by the hex SHA-256 of the rest of the file.
+const firewallHeader = "# torvm-firewall sha256 "
+
+// WriteGuestFirewall writes the guest firewall policy, as
+// config.GuestFirewallRules generates it, to the state disk as by
+// WriteStateDiskFile, headed by its checksum. The kernel command line
+// carries the same checksum (FWSUM=), and the guest applies the first of
+// firewall.rules, firewall.rules.new, and firewall.rules.prev that
+// matches it, or halts if none does.
+func WriteGuestFirewall(diskPath, rules string) error {
+	return WriteStateDiskFile(diskPath, guestFirewallFile, firewallHeader+OverlaySum(rules)+"\n"+rules)
+}
+
+// CheckStateDisk runs a forced, non-interactive e2fsck on the state disk
+// image. It must only be called while the VM is stopped. Exit status 1
+// (errors corrected) is treated as success.
+func CheckStateDisk(diskPath string) error {
+	// An absolute path cannot be mistaken for an option.
+	diskPath, err := filepath.Abs(diskPath)
+	if err != nil {
+		return fmt.Errorf("resolve disk path: %w", err)
+	}
+	out, err := exec.Command("e2fsck", "-f", "-p", diskPath).CombinedOutput()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return nil
+		}
+		return fmt.Errorf("e2fsck: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// WipeStateDisk overwrites the state disk image with zeros and deletes
+// it, as ShredFile does, discarding the Tor state it holds (guard
+// choices, cached consensus). It must only be called while the VM is
+// stopped. A missing image is not an error.
+func WipeStateDisk(diskPath string) error {
+	if err := ShredFile(diskPath); err != nil {
+		return fmt.Errorf("wipe state disk: %w", err)
+	}
+	return nil
+}
+
+// ShredFile overwrites the file at path with zeros, syncs it, and deletes
+// it. On SSDs and copy-on-write filesystems the old blocks may survive
+// the overwrite; deletion is what is guaranteed. A missing file is not an
+// error.
+func ShredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	zeros := make([]byte, min(fi.Size(), 1<<20))
+	for left := fi.Size(); left > 0; left -= int64(len(zeros)) {
+		if _, err := f.Write(zeros[:min(left, int64(len(zeros)))]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	return os.Remove(path)
+}
+
+// ShredStateDiskConfig overwrites the torrc overlay and the guest
+// firewall policy on the state disk, with their .new and .prev copies,
+// with zeros and deletes them, so the disk keeps no record of the bridges,
+// proxy, or firewall used. Both are written again at the next start. It
+// needs debugfs and must only be called while the VM is stopped.
+func ShredStateDiskConfig(diskPath string) error {
+	diskPath, err := filepath.Abs(diskPath)
+	if err != nil {
+		return fmt.Errorf("shred state disk config: %w", err)
+	}
+	if fi, err := os.Stat(diskPath); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("shred state disk config: %s is not a disk image", diskPath)
+	}
+	var script []string
+	for _, base := range []string{torrcOverlayFile, guestFirewallFile} {
+		for _, name := range []string{base, base + ".new", base + ".prev"} {
+			// "blocks" lists the file's blocks, or nothing if it is
+			// missing; zap_block -f counts blocks within the file.
+			out, _ := exec.Command("debugfs", "-R", "blocks "+name, diskPath).Output()
+			for i := range strings.Fields(string(out)) {
+				script = append(script, fmt.Sprintf("zap_block -f %s %d", name, i))
+			}
+			script = append(script, "rm "+name)
+		}
+	}
+	cmd := exec.Command("debugfs", "-w", "-f", "-", diskPath)
+	cmd.Stdin = strings.NewReader(strings.Join(script, "\n") + "\n")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("shred state disk config: debugfs: %w: %s", err, out)
+	}
+	return nil
+}
+
+// StateDiskLabel is the ext4 label of the state disk, as the VM image
+// build creates it.
+const StateDiskLabel = "torstate"
+
+// ResetStateDisk replaces the state disk image with an empty ext4
+// filesystem of the same size, discarding the Tor state it holds. The new
+// image is made beside the old one, which is then wiped as by
+// WipeStateDisk, so a failure leaves the old image in place. It needs
+// mkfs.ext4 and must only be called while the VM is stopped.
+func ResetStateDisk(diskPath string) error {
+	// An absolute path cannot be mistaken for an option.
+	diskPath, err := filepath.Abs(diskPath)
+	if err != nil {
+		return fmt.Errorf("resolve disk path: %w", err)
+	}
+	mkfs, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		return fmt.Errorf("reset state disk: %w", err)
+	}
+	fi, err := os.Stat(diskPath)
+	if err != nil {
+		return fmt.Errorf("reset state disk: %w", err)
+	}
+
+	tmpPath := diskPath + ".new"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("reset state disk: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	err = f.Truncate(fi.Size())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("reset state disk: %w", err)
+	}
+	out, err := exec.Command(mkfs, "-F", "-q", "-L", StateDiskLabel,
+		"-E", "lazy_itable_init=0,lazy_journal_init=0", tmpPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mkfs.ext4: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	if err := WipeStateDisk(diskPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, diskPath); err != nil {
+		return fmt.Errorf("reset state disk: %w", err)
+	}
+	return nil
+}
+
+// StateDiskSizes are the sizes offered for a new state disk, smallest
+// first. The VM image build makes a 64 MiB one.
+var StateDiskSizes = []int64{64 << 20, 128 << 20, 256 << 20, 512 << 20, 1 << 30}
+
+// CreateStateDisk makes a state disk image of size bytes at diskPath,
+// holding an empty ext4 filesystem labelled StateDiskLabel. Unlike
+// ResetStateDisk it needs no mkfs.ext4, so it works on every host. The
+// image is made beside diskPath and renamed into place, so a failure
+// leaves nothing behind. diskPath must not exist.
+func CreateStateDisk(diskPath string, size int64) error {
+	return makeStateDisk(diskPath, func(f *os.File) error {
+		if err := f.Truncate(size); err != nil {
+			return err
+		}
+		return ext4.Format(f, size, ext4.Options{Label: StateDiskLabel})
+	})
+}
+
+// CopyStateDisk makes a state disk image at diskPath by copying the
+// template image, such as the one shipped with TorVM, calling progress,
+// if not nil, with the bytes copied so far and the total. diskPath must
+// not exist.
+func CopyStateDisk(diskPath, template string, progress func(done, total int64)) error {
+	src, err := os.Open(template)
+	if err != nil {
+		return fmt.Errorf("copy state disk: %w", err)
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("copy state disk: %w", err)
+	}
+	return makeStateDisk(diskPath, func(f *os.File) error {
+		buf := make([]byte, 1<<20)
+		var done int64
+		for {
+			n, err := src.Read(buf)
+			if n > 0 {
+				if _, werr := f.Write(buf[:n]); werr != nil {
+					return werr
+				}
+				done += int64(n)
+				if progress != nil {
+					progress(done, fi.Size())
+				}
+			}
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// makeStateDisk creates diskPath's directory, fills a new image beside
+// diskPath with fill, and renames it into place. The image is readable
+// by its owner only, as it holds Tor's keys once used.
+func makeStateDisk(diskPath string, fill func(*os.File) error) error {
+	if _, err := os.Stat(diskPath); err == nil {
+		return fmt.Errorf("create state disk: %s already exists", diskPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(diskPath), 0755); err != nil {
+		return fmt.Errorf("create state disk: %w", err)
+	}
+	tmpPath := diskPath + ".new"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create state disk: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	err = fill(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("create state disk: %w", err)
+	}
+	if err := os.Rename(tmpPath, diskPath); err != nil {
+		return fmt.Errorf("create state disk: %w", err)
+	}
 	return nil
 }
@@ -1,6 +1,10 @@
 package vm
 
 import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -36,28 +40,244 @@ func TestValidateGuestPath(t *testing.T) {
 	}
 }
 
-func TestSafeHostPathRegex(t *testing.T) {
+func TestDebugfsQuote(t *testing.T) {
 	tests := []struct {
-		name  string
-		path  string
-		match bool
+		path    string
+		want    string
+		wantErr bool
 	}{
-		{"valid unix path", "/tmp/torvm-overlay-12345", true},
-		{"valid relative", "dist/vm/state.img", true},
-		{"valid with hyphens", "/usr/local/share/torvm/state.img", true},
-		{"valid with underscore", "/tmp/torvm_test", true},
-		{"contains space", "/tmp/my file", false},
-		{"contains backtick", "/tmp/`whoami`", false},
-		{"contains dollar", "/tmp/$HOME", false},
-		{"contains semicolon", "/tmp/a;b", false},
-		{"empty", "", false},
+		{"/tmp/torvm-overlay-12345", `"/tmp/torvm-overlay-12345"`, false},
+		{"/Users/Zoë Müller/Library/Application Support/TorVM/torvm-overlay-1", `"/Users/Zoë Müller/Library/Application Support/TorVM/torvm-overlay-1"`, false},
+		{`C:\Users\José\AppData\Local\TorVM\torvm-overlay-1`, `"C:\Users\José\AppData\Local\TorVM\torvm-overlay-1"`, false},
+		{`/tmp/say "hi"; rm x`, `"/tmp/say ""hi""; rm x"`, false},
+		{"/tmp/a\nrm torrc", "", true},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := safeHostPathRe.MatchString(tt.path)
-			if got != tt.match {
-				t.Errorf("safeHostPathRe.MatchString(%q) = %v, want %v", tt.path, got, tt.match)
-			}
-		})
+		got, err := debugfsQuote(tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("debugfsQuote(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+}
+
+func TestWipeStateDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.img")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("guard"), 500000), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WipeStateDisk(path); err != nil {
+		t.Fatalf("WipeStateDisk: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state disk still present: %v", err)
+	}
+	if err := WipeStateDisk(path); err != nil {
+		t.Errorf("WipeStateDisk on missing image: %v", err)
+	}
+}
+
+func TestResetStateDisk(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 not installed")
+	}
+	path := filepath.Join(t.TempDir(), "state.img")
+	if err := os.WriteFile(path, bytes.Repeat([]byte("guard"), 2<<20), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetStateDisk(path); err != nil {
+		t.Fatalf("ResetStateDisk: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 10<<20 {
+		t.Errorf("size %d, want %d", len(data), 10<<20)
+	}
+	// The ext4 superblock magic, 0xEF53 at offset 1080.
+	if data[1080] != 0x53 || data[1081] != 0xef {
+		t.Error("no ext4 filesystem on the reset disk")
+	}
+	if bytes.Contains(data, []byte("guardguard")) {
+		t.Error("old state survived the reset")
+	}
+}
+
+func TestCreateStateDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm", "state.img")
+	if err := CreateStateDisk(path, 64<<20); err != nil {
+		t.Fatalf("CreateStateDisk: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 64<<20 {
+		t.Errorf("size %d, want %d", fi.Size(), 64<<20)
+	}
+	if err := CreateStateDisk(path, 64<<20); err == nil {
+		t.Error("CreateStateDisk overwrote an existing image")
+	}
+	if _, err := os.Stat(path + ".new"); !os.IsNotExist(err) {
+		t.Errorf("temporary image left behind: %v", err)
+	}
+
+	if _, err := exec.LookPath("debugfs"); err != nil {
+		t.Skip("debugfs not installed")
+	}
+	if err := WriteStateDiskFile(path, "torrc.override", "UseBridges 1\n"); err != nil {
+		t.Fatalf("WriteStateDiskFile: %v", err)
+	}
+	if _, err := exec.LookPath("e2fsck"); err != nil {
+		t.Skip("e2fsck not installed")
+	}
+	if out, err := exec.Command("e2fsck", "-fn", path).CombinedOutput(); err != nil {
+		t.Errorf("e2fsck: %v\n%s", err, out)
+	}
+}
+
+func TestCopyStateDisk(t *testing.T) {
+	dir := t.TempDir()
+	template := filepath.Join(dir, "template.img")
+	want := bytes.Repeat([]byte("template"), 300<<10)
+	if err := os.WriteFile(template, want, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "state.img")
+	var last, total int64
+	err := CopyStateDisk(path, template, func(done, n int64) { last, total = done, n })
+	if err != nil {
+		t.Fatalf("CopyStateDisk: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("copy differs from the template")
+	}
+	if last != int64(len(want)) || total != int64(len(want)) {
+		t.Errorf("last progress %d of %d, want %d of %d", last, total, len(want), len(want))
+	}
+}
+
+// catStateDiskFile reads a file from a disk image with debugfs.
+func catStateDiskFile(t *testing.T, diskPath, guestPath string) string {
+	t.Helper()
+	out, err := exec.Command("debugfs", "-R", "cat "+guestPath, diskPath).Output()
+	if err != nil {
+		t.Fatalf("debugfs cat %s: %v", guestPath, err)
+	}
+	return string(out)
+}
+
+func TestWriteStateDiskFileReplaces(t *testing.T) {
+	for _, tool := range []string{"debugfs", "e2fsck"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool + " not installed")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "state.img")
+	if err := CreateStateDisk(path, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"UseBridges 1\n", "UseBridges 0\n", "Socks5Proxy 10.0.0.1:1080\n"} {
+		if err := WriteStateDiskFile(path, "torrc.override", content); err != nil {
+			t.Fatalf("WriteStateDiskFile(%q): %v", content, err)
+		}
+	}
+	if got := catStateDiskFile(t, path, "torrc.override"); got != "Socks5Proxy 10.0.0.1:1080\n" {
+		t.Errorf("torrc.override = %q", got)
+	}
+	if got := catStateDiskFile(t, path, "torrc.override.prev"); got != "UseBridges 0\n" {
+		t.Errorf("torrc.override.prev = %q", got)
+	}
+	out, _ := exec.Command("debugfs", "-R", "ls -l", path).Output()
+	if strings.Contains(string(out), "torrc.override.new") {
+		t.Errorf("torrc.override.new left behind:\n%s", out)
+	}
+	// Moving names with ln and unlink must leave link counts consistent.
+	if out, err := exec.Command("e2fsck", "-fn", path).CombinedOutput(); err != nil {
+		t.Errorf("e2fsck: %v\n%s", err, out)
+	}
+}
+
+func TestWriteStateDiskFileUnusualPath(t *testing.T) {
+	if _, err := exec.LookPath("debugfs"); err != nil {
+		t.Skip("debugfs not installed")
+	}
+	dir := filepath.Join(t.TempDir(), `Zoë "Z" Müller`, "Application Support")
+	path := filepath.Join(dir, "state 1.img")
+	if err := CreateStateDisk(path, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteStateDiskFile(path, "torrc.override", "UseBridges 1\n"); err != nil {
+		t.Fatalf("WriteStateDiskFile: %v", err)
+	}
+	if got := catStateDiskFile(t, path, "torrc.override"); got != "UseBridges 1\n" {
+		t.Errorf("torrc.override = %q", got)
+	}
+	if _, err := exec.LookPath("e2fsck"); err == nil {
+		if err := CheckStateDisk(path); err != nil {
+			t.Errorf("CheckStateDisk: %v", err)
+		}
+	}
+}
+
+func TestWriteTorrcOverlay(t *testing.T) {
+	if _, err := exec.LookPath("debugfs"); err != nil {
+		t.Skip("debugfs not installed")
+	}
+	path := filepath.Join(t.TempDir(), "state.img")
+	if err := CreateStateDisk(path, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	overlay := "UseBridges 1\nBridge 192.0.2.1:443\n"
+	if err := WriteTorrcOverlay(path, overlay); err != nil {
+		t.Fatalf("WriteTorrcOverlay: %v", err)
+	}
+	got := catStateDiskFile(t, path, "torrc.override")
+	header, rest, _ := strings.Cut(got, "\n")
+	// The overlay's SHA-256, as the guest computes it with sha256sum.
+	want := overlayHeader + "5d70cf04f48b0e99fe37bf2085f7ee14eee3d19a67a24c8b4480258a3e742f45"
+	if header != want {
+		t.Errorf("header %q, want %q", header, want)
+	}
+	if rest != overlay {
+		t.Errorf("overlay %q, want %q", rest, overlay)
+	}
+}
+
+func TestShredStateDiskConfig(t *testing.T) {
+	if _, err := exec.LookPath("debugfs"); err != nil {
+		t.Skip("debugfs not installed")
+	}
+	path := filepath.Join(t.TempDir(), "state.img")
+	if err := CreateStateDisk(path, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	bridge := "Bridge 192.0.2.1:443\n"
+	for i := 0; i < 2; i++ {
+		if err := WriteTorrcOverlay(path, bridge); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ShredStateDiskConfig(path); err != nil {
+		t.Fatalf("ShredStateDiskConfig: %v", err)
+	}
+	out, _ := exec.Command("debugfs", "-R", "ls -l", path).Output()
+	if strings.Contains(string(out), "torrc.override") {
+		t.Errorf("overlay left on the disk:\n%s", out)
+	}
+	image, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(image, []byte(bridge)) {
+		t.Error("the bridge line survives in the image")
+	}
+	// A disk without them is left as it is.
+	if err := ShredStateDiskConfig(path); err != nil {
+		t.Errorf("ShredStateDiskConfig on a clean disk: %v", err)
 	}
 }
@@ -5,18 +5,25 @@ package winsvc
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc/eventlog"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
 )
 
-// EventLogWriter implements io.Writer by sending log entries to the
-// Windows Event Log. It can be attached to the logger via AddWriter.
+// EventLogWriter sends log entries and lifecycle events to the Windows
+// Event Log. It implements logging.EntryWriter, so it can be attached to
+// the logger via AddWriter: errors become Error entries, other lines
+// Information entries, and debug lines are left out.
 type EventLogWriter struct {
 	elog *eventlog.Log
 }
 
 // NewEventLogWriter opens a handle to the Windows Event Log for the
-// TorVM service name.
+// TorVM event source.
 func NewEventLogWriter() (*EventLogWriter, error) {
 	elog, err := eventlog.Open(serviceName)
 	if err != nil {
@@ -25,15 +32,76 @@ func NewEventLogWriter() (*EventLogWriter, error) {
 	return &EventLogWriter{elog: elog}, nil
 }
 
+// RegisterEventSource registers the TorVM event source with the
+// Application log, so Event Viewer shows its messages rather than a
+// missing-description notice. It is a no-op if the source exists, and
+// needs Administrator rights otherwise.
+func RegisterEventSource() error {
+	err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err == nil || eventSourceExists() {
+		return nil
+	}
+	return fmt.Errorf("winsvc: install event log source: %w", err)
+}
+
+func eventSourceExists() bool {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SYSTEM\CurrentControlSet\Services\EventLog\Application\`+serviceName, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	k.Close()
+	return true
+}
+
+// WriteEntry sends one log line as an entry with ID EventIDLog.
+func (w *EventLogWriter) WriteEntry(_ time.Time, lvl logging.Level, msg string) error {
+	var err error
+	switch lvl {
+	case logging.LevelDebug:
+		return nil
+	case logging.LevelError:
+		err = w.elog.Error(EventIDLog, msg)
+	default:
+		err = w.elog.Info(EventIDLog, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("winsvc: write event log: %w", err)
+	}
+	return nil
+}
+
 // Write sends p as an informational event log entry. It satisfies io.Writer.
 func (w *EventLogWriter) Write(p []byte) (int, error) {
-	msg := strings.TrimRight(string(p), "\n")
-	if err := w.elog.Info(1, msg); err != nil {
-		return 0, fmt.Errorf("winsvc: write event log: %w", err)
+	if err := w.WriteEntry(time.Now(), logging.LevelInfo, strings.TrimRight(string(p), "\n")); err != nil {
+		return 0, err
 	}
 	return len(p), nil
 }
 
+// ReportEvents writes an entry with its own event ID (see EventIDRunning
+// and the others) for each lifecycle event on engine's bus that
+// administrators need to see: the session running or failing, retries,
+// failed network operations, the failsafe, and VM crashes. The returned
+// func stops the reports.
+func (w *EventLogWriter) ReportEvents(engine *lifecycle.Engine) (stop func()) {
+	return engine.Events.Subscribe(func(ev lifecycle.Event) {
+		id, typ, msg, ok := eventRecord(ev)
+		if !ok {
+			return
+		}
+		// A failed write has nowhere better to be reported.
+		switch typ {
+		case eventError:
+			w.elog.Error(id, msg)
+		case eventWarning:
+			w.elog.Warning(id, msg)
+		default:
+			w.elog.Info(id, msg)
+		}
+	})
+}
+
 // Close releases the event log handle.
 func (w *EventLogWriter) Close() error {
 	return w.elog.Close()
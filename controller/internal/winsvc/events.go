@@ -0,0 +1,62 @@
+package winsvc
+
+import (
+	"fmt"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// Event IDs of the entries the service writes to the Application event
+// log under the source "TorVM". Log lines share one ID; lifecycle events
+// have their own, so monitoring can match on them without parsing text.
+const (
+	EventIDLog          = 1   // a log line; Error or Information by its level
+	EventIDRunning      = 100 // Tor bootstrapped and traffic flows through the VM
+	EventIDFailed       = 200 // the session failed and stopped
+	EventIDRetry        = 201 // a startup step failed and is tried again
+	EventIDNetworkError = 202 // a host network operation failed
+	EventIDFailsafeOn   = 300 // the failsafe blocks host traffic
+	EventIDFailsafeOff  = 301 // the failsafe released host traffic
+	EventIDVMCrashed    = 400 // the VM exited unexpectedly
+)
+
+// eventType is the type of an event log entry.
+type eventType int
+
+const (
+	eventInfo eventType = iota
+	eventWarning
+	eventError
+)
+
+// eventRecord returns the event log entry for ev, or ok false if ev does
+// not warrant one.
+func eventRecord(ev lifecycle.Event) (id uint32, typ eventType, msg string, ok bool) {
+	switch ev.Kind {
+	case lifecycle.EventState:
+		switch ev.To {
+		case lifecycle.StateRunning:
+			return EventIDRunning, eventInfo, "TorVM is running: Tor has bootstrapped and traffic is routed through the VM.", true
+		case lifecycle.StateFailed:
+			return EventIDFailed, eventError, fmt.Sprintf("TorVM session failed in state %s.", ev.From), true
+		}
+	case lifecycle.EventRetry:
+		return EventIDRetry, eventWarning, fmt.Sprintf("%s failed and is retried: %v", ev.To, ev.Err), true
+	case lifecycle.EventNetwork:
+		if ev.Err != nil {
+			return EventIDNetworkError, eventError, fmt.Sprintf("Host network operation %q failed: %v", ev.Op, ev.Err), true
+		}
+	case lifecycle.EventFailsafe:
+		if ev.Active {
+			return EventIDFailsafeOn, eventWarning, "Failsafe activated: host traffic is blocked.", true
+		}
+		return EventIDFailsafeOff, eventInfo, "Failsafe released: host traffic is no longer blocked.", true
+	case lifecycle.EventVMExit:
+		msg := fmt.Sprintf("The VM exited unexpectedly (exit code %d).", ev.ExitCode)
+		if ev.Err != nil {
+			msg = fmt.Sprintf("The VM exited unexpectedly (exit code %d): %v", ev.ExitCode, ev.Err)
+		}
+		return EventIDVMCrashed, eventError, msg, true
+	}
+	return 0, 0, "", false
+}
@@ -0,0 +1,41 @@
+package winsvc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+func TestEventRecord(t *testing.T) {
+	for _, tt := range []struct {
+		ev   lifecycle.Event
+		id   uint32
+		typ  eventType
+		text string
+	}{
+		{lifecycle.Event{Kind: lifecycle.EventState, From: lifecycle.StateWaitBootstrap, To: lifecycle.StateRunning}, EventIDRunning, eventInfo, "running"},
+		{lifecycle.Event{Kind: lifecycle.EventState, From: lifecycle.StateLaunchVM, To: lifecycle.StateFailed}, EventIDFailed, eventError, "LaunchVM"},
+		{lifecycle.Event{Kind: lifecycle.EventRetry, To: lifecycle.StateWaitTAP, Err: errors.New("no tap")}, EventIDRetry, eventWarning, "WaitTAP failed and is retried: no tap"},
+		{lifecycle.Event{Kind: lifecycle.EventNetwork, Op: "setup routing", Err: errors.New("route add")}, EventIDNetworkError, eventError, `"setup routing" failed: route add`},
+		{lifecycle.Event{Kind: lifecycle.EventFailsafe, Active: true}, EventIDFailsafeOn, eventWarning, "blocked"},
+		{lifecycle.Event{Kind: lifecycle.EventFailsafe}, EventIDFailsafeOff, eventInfo, "released"},
+		{lifecycle.Event{Kind: lifecycle.EventVMExit, ExitCode: -1, Err: errors.New("signal: killed")}, EventIDVMCrashed, eventError, "exit code -1): signal: killed"},
+	} {
+		id, typ, msg, ok := eventRecord(tt.ev)
+		if !ok || id != tt.id || typ != tt.typ || !strings.Contains(msg, tt.text) {
+			t.Errorf("eventRecord(%s) = %d, %d, %q, %t; want %d, %d, containing %q", tt.ev.Kind, id, typ, msg, ok, tt.id, tt.typ, tt.text)
+		}
+	}
+
+	for _, ev := range []lifecycle.Event{
+		{Kind: lifecycle.EventState, To: lifecycle.StateLaunchVM},
+		{Kind: lifecycle.EventNetwork, Op: "setup routing"},
+		{Kind: lifecycle.EventBootstrap, Progress: 50},
+	} {
+		if id, _, msg, ok := eventRecord(ev); ok {
+			t.Errorf("eventRecord(%s) = %d, %q; want no entry", ev.Kind, id, msg)
+		}
+	}
+}
@@ -5,8 +5,10 @@ package winsvc
 import (
 	"fmt"
 	"runtime"
+	"time"
 
 	"github.com/user/extorvm/controller/internal/config"
+	"github.com/user/extorvm/controller/internal/lifecycle"
 	"github.com/user/extorvm/controller/internal/logging"
 )
 
@@ -27,18 +29,33 @@ func (w *EventLogWriter) Write(p []byte) (int, error) {
 	return 0, errUnsupported()
 }
 
+// WriteEntry is a stub that always returns an error.
+func (w *EventLogWriter) WriteEntry(_ time.Time, _ logging.Level, _ string) error {
+	return errUnsupported()
+}
+
+// ReportEvents is a no-op stub.
+func (w *EventLogWriter) ReportEvents(_ *lifecycle.Engine) (stop func()) {
+	return func() {}
+}
+
 // Close is a no-op stub.
 func (w *EventLogWriter) Close() error {
 	return nil
 }
 
+// RegisterEventSource is not supported on non-Windows platforms.
+func RegisterEventSource() error {
+	return errUnsupported()
+}
+
 // RunService is not supported on non-Windows platforms.
 func RunService(_ *config.Config, _ *logging.Logger) error {
 	return errUnsupported()
 }
 
 // InstallService is not supported on non-Windows platforms.
-func InstallService() error {
+func InstallService(_ config.ServiceConfig) error {
 	return errUnsupported()
 }
 
@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/eventlog"
 	"golang.org/x/sys/windows/svc/mgr"
@@ -15,6 +16,7 @@ import (
 	"github.com/user/extorvm/controller/internal/config"
 	"github.com/user/extorvm/controller/internal/lifecycle"
 	"github.com/user/extorvm/controller/internal/logging"
+	"github.com/user/extorvm/controller/internal/servicefile"
 )
 
 const serviceName = "TorVM"
@@ -22,8 +24,9 @@ const serviceDescription = "TorVM - Transparent Tor Network Routing"
 
 // TorVMService implements svc.Handler for the Windows Service Control Manager.
 type TorVMService struct {
-	Config *config.Config
-	Logger *logging.Logger
+	Config   *config.Config
+	Logger   *logging.Logger
+	EventLog *EventLogWriter // nil if the event log could not be opened
 }
 
 // Execute is called by the Windows service manager. It reports status
@@ -37,6 +40,9 @@ func (s *TorVMService) Execute(args []string, r <-chan svc.ChangeRequest, change
 	defer cancel()
 
 	engine := lifecycle.NewEngine(s.Config, s.Logger)
+	if s.EventLog != nil {
+		defer s.EventLog.ReportEvents(engine)()
+	}
 
 	// Notify SCM that the service is now running.
 	changes <- svc.Status{State: svc.Running, Accepts: acceptedCmds}
@@ -59,7 +65,7 @@ func (s *TorVMService) Execute(args []string, r <-chan svc.ChangeRequest, change
 			case svc.Interrogate:
 				changes <- cr.CurrentStatus
 			case svc.Stop, svc.Shutdown:
-				s.Logger.Info("received service %s request", cr.Cmd)
+				s.Logger.Info("received service control request %d", cr.Cmd)
 				changes <- svc.Status{State: svc.StopPending}
 				cancel()
 				// Wait for engine to finish with a timeout.
@@ -77,6 +83,11 @@ func (s *TorVMService) Execute(args []string, r <-chan svc.ChangeRequest, change
 // RunService runs the TorVM service under the Windows Service Control Manager.
 // This should be called when the process is started with --service-run.
 func RunService(cfg *config.Config, logger *logging.Logger) error {
+	// A service installed before the source was registered at install
+	// time, or by hand with sc.exe, registers it now.
+	if err := RegisterEventSource(); err != nil {
+		logger.Error("%v", err)
+	}
 	ew, err := NewEventLogWriter()
 	if err != nil {
 		logger.Error("failed to open event log: %v", err)
@@ -86,8 +97,9 @@ func RunService(cfg *config.Config, logger *logging.Logger) error {
 	}
 
 	svcHandler := &TorVMService{
-		Config: cfg,
-		Logger: logger,
+		Config:   cfg,
+		Logger:   logger,
+		EventLog: ew,
 	}
 
 	if err := svc.Run(serviceName, svcHandler); err != nil {
@@ -96,8 +108,14 @@ func RunService(cfg *config.Config, logger *logging.Logger) error {
 	return nil
 }
 
-// InstallService registers TorVM as a Windows service.
-func InstallService() error {
+// InstallService registers TorVM as a Windows service with the
+// environment in svc. The other overrides have no SCM equivalent.
+func InstallService(svc config.ServiceConfig) error {
+	spec := servicefile.Windows(servicefile.Spec{
+		Description:   serviceDescription,
+		Args:          []string{"--service-run", "--headless"},
+		ServiceConfig: svc,
+	})
 	exePath, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("winsvc: get executable path: %w", err)
@@ -117,24 +135,45 @@ func InstallService() error {
 
 	s, err = m.CreateService(serviceName, exePath, mgr.Config{
 		DisplayName: serviceName,
-		Description: serviceDescription,
+		Description: spec.Description,
 		StartType:   mgr.StartAutomatic,
-	}, "--service-run", "--headless")
+	}, spec.Args...)
 	if err != nil {
 		return fmt.Errorf("winsvc: create service: %w", err)
 	}
 	defer s.Close()
 
+	if len(spec.Environment) > 0 {
+		if err := setServiceEnvironment(spec.Environment); err != nil {
+			s.Delete()
+			return err
+		}
+	}
+
 	// Set up the event log source for this service.
-	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
-		// Non-fatal: service is installed but event log source may not work.
+	if err := RegisterEventSource(); err != nil {
 		s.Delete()
-		return fmt.Errorf("winsvc: install event log source: %w", err)
+		return err
 	}
 
 	return nil
 }
 
+// setServiceEnvironment sets the environment the SCM passes to the
+// service process, stored in the service's registry key.
+func setServiceEnvironment(env []string) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE,
+		`SYSTEM\CurrentControlSet\Services\`+serviceName, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("winsvc: open service key: %w", err)
+	}
+	defer k.Close()
+	if err := k.SetStringsValue("Environment", env); err != nil {
+		return fmt.Errorf("winsvc: set service environment: %w", err)
+	}
+	return nil
+}
+
 // RemoveService unregisters the TorVM Windows service.
 func RemoveService() error {
 	m, err := mgr.Connect()
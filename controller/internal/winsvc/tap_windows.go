@@ -8,6 +8,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/user/extorvm/controller/internal/privexec"
 )
 
 // TAPStatus describes the current state of the TAP-Windows adapter.
@@ -61,11 +63,10 @@ func InstallTAPAdapter() error {
 		return fmt.Errorf("winsvc: addtap.bat not found; install TAP-Windows6 driver first")
 	}
 
-	cmd := exec.Command(batPath)
-	cmd.Dir = filepath.Dir(batPath)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("winsvc: addtap failed: %w: %s", err, strings.TrimSpace(string(out)))
+	op := privexec.Command(batPath)
+	op.Dir = filepath.Dir(batPath)
+	if err := privexec.RunOp(op); err != nil {
+		return fmt.Errorf("winsvc: addtap failed: %w", err)
 	}
 	return nil
 }
@@ -78,11 +79,10 @@ func RemoveTAPAdapter() error {
 		return fmt.Errorf("winsvc: deltapall.bat not found; TAP-Windows6 driver may not be installed")
 	}
 
-	cmd := exec.Command(batPath)
-	cmd.Dir = filepath.Dir(batPath)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("winsvc: deltapall failed: %w: %s", err, strings.TrimSpace(string(out)))
+	op := privexec.Command(batPath)
+	op.Dir = filepath.Dir(batPath)
+	if err := privexec.RunOp(op); err != nil {
+		return fmt.Errorf("winsvc: deltapall failed: %w", err)
 	}
 	return nil
 }
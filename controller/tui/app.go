@@ -0,0 +1,100 @@
+// Package tui implements a terminal user interface for TorVM, for servers
+// and SSH sessions where the Fyne GUI is unavailable.
+package tui
+
+import (
+	"context"
+	"errors"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/extorvm/controller/internal/lifecycle"
+	"github.com/user/extorvm/controller/internal/logging"
+)
+
+// Engine is the subset of the lifecycle engine driven by the TUI.
+type Engine interface {
+	Start(ctx context.Context) <-chan error
+	Stop(ctx context.Context) <-chan error
+	State() lifecycle.State
+	ActiveStreams() (int, error)
+	NewIdentity() error
+}
+
+// App is the terminal UI application.
+type App struct {
+	engine  *lifecycle.Engine
+	logger  *logging.Logger
+	model   *model
+	program *tea.Program
+	exited  chan struct{} // closed when Run returns
+}
+
+// New creates a TUI application. Log lines are read from ring, which
+// should be the logger's only terminal output while the TUI runs.
+func New(engine *lifecycle.Engine, logger *logging.Logger, ring *logging.RingWriter) *App {
+	m := newModel(engine, ring.Lines)
+	return &App{
+		engine:  engine,
+		logger:  logger,
+		model:   m,
+		program: tea.NewProgram(m, tea.WithAltScreen()),
+		exited:  make(chan struct{}),
+	}
+}
+
+// SetAutoStart starts the VM as soon as the TUI opens.
+func (a *App) SetAutoStart(on bool) {
+	a.model.autoStart = on
+}
+
+// RequestShutdown stops the VM without confirmation and exits the TUI.
+// It is safe to call from any goroutine (e.g. a signal handler).
+func (a *App) RequestShutdown() {
+	a.program.Send(shutdownMsg{})
+}
+
+// StartVM starts the VM as if the user had pressed the start key. It is
+// safe to call from any goroutine.
+func (a *App) StartVM() error {
+	return a.send(func(reply chan<- error) tea.Msg { return startMsg{reply} })
+}
+
+// StopVM stops the VM without asking for confirmation and waits for the
+// shutdown. It is safe to call from any goroutine.
+func (a *App) StopVM(ctx context.Context) error {
+	return a.send(func(reply chan<- error) tea.Msg { return stopMsg{ctx, reply} })
+}
+
+// send delivers a message built by msg to the model and waits for its
+// reply, or fails if the TUI has exited.
+func (a *App) send(msg func(reply chan<- error) tea.Msg) error {
+	reply := make(chan error, 1)
+	a.program.Send(msg(reply))
+	select {
+	case err := <-reply:
+		return err
+	case <-a.exited:
+		return errors.New("the TUI has exited")
+	}
+}
+
+// Run takes over the terminal until the user quits. A running VM is shut
+// down before Run returns.
+func (a *App) Run() error {
+	defer close(a.exited)
+	a.engine.OnStateChange(func(_, to lifecycle.State) {
+		a.program.Send(stateMsg(to))
+	})
+	a.engine.OnBootstrapProgress(func(progress int, summary string) {
+		a.program.Send(bootstrapMsg{progress: progress, summary: summary})
+	})
+
+	if _, err := a.program.Run(); err != nil {
+		return err
+	}
+	if a.model.err != nil {
+		a.logger.Error("lifecycle error: %v", a.model.err)
+	}
+	return nil
+}
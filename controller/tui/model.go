@@ -0,0 +1,344 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+// logRefresh is how often the log pane re-reads the ring buffer.
+const logRefresh = 250 * time.Millisecond
+
+type (
+	stateMsg     lifecycle.State
+	bootstrapMsg struct {
+		progress int
+		summary  string
+	}
+	doneMsg     struct{ err error }
+	logTickMsg  struct{}
+	shutdownMsg struct{}
+	// startMsg and stopMsg come from the control API; the outcome is
+	// sent on reply, for stopMsg once the VM has shut down.
+	startMsg struct{ reply chan<- error }
+	stopMsg  struct {
+		ctx   context.Context
+		reply chan<- error
+	}
+)
+
+// Confirmation prompts shown before cutting off active streams.
+const (
+	confirmNone = iota
+	confirmStop
+	confirmQuit
+)
+
+var (
+	titleStyle = lipgloss.NewStyle().Bold(true)
+	helpStyle  = lipgloss.NewStyle().Faint(true)
+	warnStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("3"))
+	stateStyle = map[string]lipgloss.Style{
+		"running": lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("2")),
+		"failed":  lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("1")),
+		"busy":    lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("3")),
+		"stopped": lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("8")),
+	}
+)
+
+// model is the bubbletea model for the TUI.
+type model struct {
+	engine    Engine
+	lines     func() []string
+	autoStart bool
+
+	state    lifecycle.State
+	progress int
+	summary  string
+	logs     []string
+
+	cancel   context.CancelFunc
+	done     <-chan error
+	confirm  int
+	streams  int
+	quitting bool
+	notice   string
+	err      error
+
+	width, height int
+}
+
+func newModel(engine Engine, lines func() []string) *model {
+	return &model{engine: engine, lines: lines, state: engine.State()}
+}
+
+func (m *model) Init() tea.Cmd {
+	cmds := []tea.Cmd{logTick()}
+	if m.autoStart {
+		cmds = append(cmds, m.start())
+	}
+	return tea.Batch(cmds...)
+}
+
+func logTick() tea.Cmd {
+	return tea.Tick(logRefresh, func(time.Time) tea.Msg { return logTickMsg{} })
+}
+
+// waitDone reports the lifecycle result once the engine exits.
+func waitDone(done <-chan error) tea.Cmd {
+	return func() tea.Msg { return doneMsg{err: <-done} }
+}
+
+func (m *model) running() bool { return m.cancel != nil }
+
+func (m *model) start() tea.Cmd {
+	if m.running() {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.err = nil
+	m.notice = ""
+	m.progress, m.summary = 0, ""
+	m.done = m.engine.Start(ctx)
+	return waitDone(m.done)
+}
+
+// requestStop stops the VM (and quits, if quit is set), first asking for
+// confirmation when Tor streams are open.
+func (m *model) requestStop(quit bool) tea.Cmd {
+	if !m.running() {
+		if quit {
+			return tea.Quit
+		}
+		return nil
+	}
+	if m.engine.State() == lifecycle.StateRunning {
+		if n, err := m.engine.ActiveStreams(); err == nil && n > 0 {
+			m.streams = n
+			m.confirm = confirmStop
+			if quit {
+				m.confirm = confirmQuit
+			}
+			return nil
+		}
+	}
+	return m.doStop(quit)
+}
+
+func (m *model) doStop(quit bool) tea.Cmd {
+	m.quitting = m.quitting || quit
+	m.notice = "Stopping..."
+	// doneMsg follows once the engine has shut down.
+	m.engine.Stop(context.Background())
+	return nil
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case stateMsg:
+		m.state = lifecycle.State(msg)
+		if m.state == lifecycle.StateRunning {
+			m.progress = 100
+		}
+
+	case bootstrapMsg:
+		m.progress, m.summary = msg.progress, msg.summary
+
+	case logTickMsg:
+		m.logs = m.lines()
+		return m, logTick()
+
+	case doneMsg:
+		m.cancel = nil
+		m.done = nil
+		m.err = msg.err
+		m.notice = ""
+		if m.quitting {
+			return m, tea.Quit
+		}
+
+	case shutdownMsg:
+		return m, m.interrupt()
+
+	case startMsg:
+		if m.running() {
+			msg.reply <- controlapi.ErrRunning
+			return m, nil
+		}
+		msg.reply <- nil
+		return m, m.start()
+
+	case stopMsg:
+		if !m.running() {
+			msg.reply <- controlapi.ErrNotRunning
+			return m, nil
+		}
+		m.notice = "Stopping..."
+		stopped := m.engine.Stop(msg.ctx)
+		go func() { msg.reply <- <-stopped }()
+		return m, nil
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg.String())
+	}
+	return m, nil
+}
+
+func (m *model) handleKey(key string) tea.Cmd {
+	if key == "ctrl+c" {
+		return m.interrupt()
+	}
+	if m.confirm != confirmNone {
+		quit := m.confirm == confirmQuit
+		switch key {
+		case "y", "Y":
+			m.confirm = confirmNone
+			return m.doStop(quit)
+		case "n", "N", "esc":
+			m.confirm = confirmNone
+		}
+		return nil
+	}
+
+	switch key {
+	case "s":
+		return m.start()
+	case "x":
+		return m.requestStop(false)
+	case "i":
+		if err := m.engine.NewIdentity(); err != nil {
+			m.notice = "New identity: " + err.Error()
+		} else {
+			m.notice = "Tor identity renewed"
+		}
+	case "q":
+		return m.requestStop(true)
+	}
+	return nil
+}
+
+// interrupt stops and quits without confirmation, for ctrl+c and signals.
+func (m *model) interrupt() tea.Cmd {
+	m.confirm = confirmNone
+	if !m.running() {
+		return tea.Quit
+	}
+	return m.doStop(true)
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+
+	b.WriteString(titleStyle.Render("TorVM"))
+	b.WriteString("  ")
+	b.WriteString(m.stateLabel())
+	b.WriteString("\n\n")
+	b.WriteString(m.pipeline())
+	b.WriteString("\n\n")
+	fmt.Fprintf(&b, "Bootstrap %s %3d%%  %s\n", progressBar(m.progress, 30), m.progress, m.summary)
+
+	switch {
+	case m.confirm != confirmNone:
+		b.WriteString(warnStyle.Render(fmt.Sprintf(
+			"%d active connection(s) will be terminated. Continue? [y/n]", m.streams)))
+	case m.err != nil:
+		b.WriteString(stateStyle["failed"].Render("Error: " + m.err.Error()))
+	case m.notice != "":
+		b.WriteString(m.notice)
+	}
+	b.WriteString("\n\n")
+
+	// Fill the remaining height with the most recent log lines.
+	header := strings.Count(b.String(), "\n") + 2
+	n := m.height - header
+	if m.height == 0 {
+		n = 10
+	}
+	logs := m.logs
+	if n < 0 {
+		n = 0
+	}
+	if len(logs) > n {
+		logs = logs[len(logs)-n:]
+	}
+	for _, line := range logs {
+		if m.width > 0 && len(line) > m.width {
+			line = line[:m.width]
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	for i := len(logs); i < n; i++ {
+		b.WriteString("\n")
+	}
+
+	b.WriteString(helpStyle.Render("s start  x stop  i new identity  q quit"))
+	return b.String()
+}
+
+func (m *model) stateLabel() string {
+	name := m.state.String()
+	switch {
+	case m.state == lifecycle.StateRunning:
+		return stateStyle["running"].Render(name)
+	case m.state == lifecycle.StateFailed || m.err != nil:
+		return stateStyle["failed"].Render(name)
+	case m.running():
+		return stateStyle["busy"].Render(name)
+	default:
+		return stateStyle["stopped"].Render("Stopped")
+	}
+}
+
+// startupStates are shown as the state machine's progress line.
+var startupStates = []lifecycle.State{
+	lifecycle.StateCheckPrivileges,
+	lifecycle.StateSaveNetwork,
+	lifecycle.StateCreateTAP,
+	lifecycle.StateLaunchVM,
+	lifecycle.StateWaitTAP,
+	lifecycle.StateConfigureTAP,
+	lifecycle.StateVerifyRoutes,
+	lifecycle.StateFlushDNS,
+	lifecycle.StateWaitBootstrap,
+	lifecycle.StateRunning,
+}
+
+// pipeline renders the startup states, marking completed ones and the
+// current one.
+func (m *model) pipeline() string {
+	parts := make([]string, len(startupStates))
+	for i, st := range startupStates {
+		switch {
+		case st == m.state && m.running():
+			parts[i] = "[" + st.String() + "]"
+		case m.running() && st < m.state && m.state <= lifecycle.StateRunning:
+			parts[i] = "+" + st.String()
+		default:
+			parts[i] = helpStyle.Render(st.String())
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+func progressBar(pct, width int) string {
+	if pct < 0 {
+		pct = 0
+	}
+	if pct > 100 {
+		pct = 100
+	}
+	filled := pct * width / 100
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
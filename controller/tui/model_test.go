@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/user/extorvm/controller/internal/controlapi"
+	"github.com/user/extorvm/controller/internal/lifecycle"
+)
+
+type fakeEngine struct {
+	state   lifecycle.State
+	streams int
+	starts  int
+	stops   int
+	stopErr error // the result Stop reports
+	ctx     context.Context
+	done    chan error
+}
+
+func (f *fakeEngine) Start(ctx context.Context) <-chan error {
+	f.starts++
+	f.ctx = ctx
+	f.done = make(chan error, 1)
+	return f.done
+}
+
+func (f *fakeEngine) Stop(ctx context.Context) <-chan error {
+	f.stops++
+	ch := make(chan error, 1)
+	ch <- f.stopErr
+	return ch
+}
+
+func (f *fakeEngine) State() lifecycle.State      { return f.state }
+func (f *fakeEngine) ActiveStreams() (int, error) { return f.streams, nil }
+func (f *fakeEngine) NewIdentity() error          { return nil }
+
+func key(s string) tea.KeyMsg {
+	if s == "ctrl+c" {
+		return tea.KeyMsg{Type: tea.KeyCtrlC}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+// isQuit reports whether cmd is tea.Quit.
+func isQuit(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	_, ok := cmd().(tea.QuitMsg)
+	return ok
+}
+
+func TestStartAndStop(t *testing.T) {
+	eng := &fakeEngine{}
+	m := newModel(eng, func() []string { return nil })
+
+	m.Update(key("s"))
+	m.Update(key("s"))
+	if eng.starts != 1 {
+		t.Fatalf("starts = %d, want 1", eng.starts)
+	}
+
+	m.Update(key("x"))
+	if eng.stops == 0 {
+		t.Fatal("stop did not stop the engine")
+	}
+	if _, cmd := m.Update(doneMsg{}); isQuit(cmd) {
+		t.Error("stop quit the TUI")
+	}
+	if m.running() {
+		t.Error("still running after doneMsg")
+	}
+}
+
+func TestStopConfirmsActiveStreams(t *testing.T) {
+	eng := &fakeEngine{streams: 3}
+	m := newModel(eng, func() []string { return nil })
+	m.Update(key("s"))
+	eng.state = lifecycle.StateRunning
+	m.Update(stateMsg(lifecycle.StateRunning))
+
+	m.Update(key("q"))
+	if m.confirm != confirmQuit || eng.stops != 0 {
+		t.Fatalf("quit with open streams did not ask first (confirm=%d)", m.confirm)
+	}
+	if !strings.Contains(m.View(), "3 active connection(s)") {
+		t.Error("confirmation prompt not shown")
+	}
+
+	m.Update(key("n"))
+	if m.confirm != confirmNone || eng.stops != 0 {
+		t.Fatal("declining still stopped the VM")
+	}
+
+	m.Update(key("q"))
+	m.Update(key("y"))
+	if eng.stops == 0 {
+		t.Fatal("confirmed quit did not stop the VM")
+	}
+	if _, cmd := m.Update(doneMsg{}); !isQuit(cmd) {
+		t.Error("TUI did not exit after the VM stopped")
+	}
+}
+
+func TestInterruptSkipsConfirmation(t *testing.T) {
+	eng := &fakeEngine{streams: 1, state: lifecycle.StateRunning}
+	m := newModel(eng, func() []string { return nil })
+	m.Update(key("s"))
+	m.Update(key("x"))
+
+	m.Update(key("ctrl+c"))
+	if m.confirm != confirmNone || eng.stops == 0 {
+		t.Fatal("ctrl+c did not stop immediately")
+	}
+	if _, cmd := m.Update(doneMsg{}); !isQuit(cmd) {
+		t.Error("TUI did not exit after ctrl+c")
+	}
+}
+
+func TestAPIStartStop(t *testing.T) {
+	eng := &fakeEngine{streams: 1, state: lifecycle.StateRunning}
+	m := newModel(eng, func() []string { return nil })
+	reply := make(chan error, 1)
+
+	m.Update(stopMsg{context.Background(), reply})
+	if err := <-reply; !errors.Is(err, controlapi.ErrNotRunning) {
+		t.Errorf("stop before start: err = %v, want ErrNotRunning", err)
+	}
+
+	m.Update(startMsg{reply})
+	if err := <-reply; err != nil || eng.starts != 1 {
+		t.Fatalf("start: err = %v, starts = %d", err, eng.starts)
+	}
+	m.Update(startMsg{reply})
+	if err := <-reply; !errors.Is(err, controlapi.ErrRunning) {
+		t.Errorf("second start: err = %v, want ErrRunning", err)
+	}
+
+	// The API stops without the confirmation the keyboard asks for.
+	m.Update(stopMsg{context.Background(), reply})
+	if err := <-reply; err != nil || m.confirm != confirmNone || eng.stops != 1 {
+		t.Errorf("stop: err = %v, confirm = %d, stops = %d", err, m.confirm, eng.stops)
+	}
+
+	// The reply carries the outcome of the shutdown.
+	eng.stopErr = errors.New("lifecycle: restore network: failed")
+	m.Update(stopMsg{context.Background(), reply})
+	if err := <-reply; err != eng.stopErr {
+		t.Errorf("failed stop: err = %v, want %v", err, eng.stopErr)
+	}
+}
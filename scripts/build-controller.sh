@@ -15,6 +15,10 @@ for platform in $PLATFORMS; do
   [ "$OS" = "windows" ] && EXT=".exe"
   echo "  Building torvm-${OS}-${ARCH}${EXT}..."
   GOOS=$OS GOARCH=$ARCH go build -trimpath -ldflags "-s -w" -o "../dist/controller/torvm-${OS}-${ARCH}${EXT}" ./cmd/torvm/ &
+  if [ "$OS" = "linux" ]; then
+    echo "  Building torvm-nethelper-${OS}-${ARCH}..."
+    CGO_ENABLED=0 GOOS=$OS GOARCH=$ARCH go build -trimpath -ldflags "-s -w" -o "../dist/controller/torvm-nethelper-${OS}-${ARCH}" ./cmd/torvm-nethelper/ &
+  fi
 done
 
 wait
@@ -188,6 +188,29 @@ vmr_redir() {
   iptables -t nat "$1" $cli_prenat_tbl -i "$2" -d "$3" -p tcp --dport "$4" -j REDIRECT --to "$5" >>"$LOG_TO" 2>&1
 }
 
+vmr_strict() {
+  vmr_log "vmr_strict"
+  # expects the guest firewall policy file the controller wrote: an
+  # iptables-restore ruleset, a "# ip6tables" line, and an
+  # ip6tables-restore ruleset. Its chains go ahead of the router rules.
+  if [ -z "$1" ]; then
+    return "$FAIL"
+  fi
+  if ! sed '/^# ip6tables$/,$d' "$1" | iptables-restore --noflush >>"$LOG_TO" 2>&1; then
+    vmr_log "CRITICAL: guest firewall IPv4 policy failed to load"
+    return "$FAIL"
+  fi
+  if ! sed '1,/^# ip6tables$/d' "$1" | ip6tables-restore --noflush >>"$LOG_TO" 2>&1; then
+    vmr_log "CRITICAL: guest firewall IPv6 policy failed to load"
+    return "$FAIL"
+  fi
+  # reset the trap target at top of chain
+  iptables -t filter -D INPUT -j $trap_tbl >>"$LOG_TO" 2>&1
+  iptables -t filter -I INPUT -j $trap_tbl >>"$LOG_TO" 2>&1
+  iptables -t filter -D OUTPUT -j $trap_tbl >>"$LOG_TO" 2>&1
+  iptables -t filter -I OUTPUT -j $trap_tbl >>"$LOG_TO" 2>&1
+}
+
 vmr_setarp() {
   vmr_log "vmr_setarp"
   # expects interface, ip, mac arguments
@@ -207,3 +230,26 @@ vmr_init_ipv6() {
   ip6tables -t filter -A INPUT -i lo -j ACCEPT >>"$LOG_TO" 2>&1
   ip6tables -t filter -A OUTPUT -o lo -j ACCEPT >>"$LOG_TO" 2>&1
 }
+
+vmr_fwdadd6() {
+  vmr_log "vmr_fwdadd6"
+  # expects interface and local IPv6 address as arguments; redirects
+  # routed IPv6 client traffic into Tor the same way vmr_fwdadd does for IPv4.
+  if [ -z "$1" ] || [ -z "$2" ]; then
+    return "$FAIL"
+  fi
+  ip6tables -t filter -A INPUT -i "$1" -m state --state RELATED,ESTABLISHED -j ACCEPT >>"$LOG_TO" 2>&1
+  ip6tables -t filter -A INPUT -i "$1" -p ipv6-icmp -j ACCEPT >>"$LOG_TO" 2>&1
+  ip6tables -t filter -A INPUT -i "$1" -p tcp --dport $TOR_TRANSPORT -j ACCEPT >>"$LOG_TO" 2>&1
+  ip6tables -t filter -A INPUT -i "$1" -p udp --dport $TOR_DNSPORT -j ACCEPT >>"$LOG_TO" 2>&1
+  ip6tables -t filter -A OUTPUT -o "$1" -m state --state RELATED,ESTABLISHED -j ACCEPT >>"$LOG_TO" 2>&1
+  ip6tables -t filter -A OUTPUT -o "$1" -p ipv6-icmp -j ACCEPT >>"$LOG_TO" 2>&1
+  if ! ip6tables -t nat -A PREROUTING -i "$1" -p tcp ! -d "$2" -j REDIRECT --to $TOR_TRANSPORT >>"$LOG_TO" 2>&1; then
+    vmr_log "CRITICAL: IPv6 TCP REDIRECT rule failed for $1"
+    return "$FAIL"
+  fi
+  if ! ip6tables -t nat -A PREROUTING -i "$1" -p udp --dport 53 -j REDIRECT --to $TOR_DNSPORT >>"$LOG_TO" 2>&1; then
+    vmr_log "CRITICAL: IPv6 DNS REDIRECT rule failed for $1"
+    return "$FAIL"
+  fi
+}